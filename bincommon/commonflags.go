@@ -21,10 +21,12 @@ package bincommon
 import (
 	"context"
 	"flag"
+	"io"
 	"net/http"
 	"os"
 	"reflect"
 	"strings"
+	"time"
 
 	"fortio.org/dflag"
 	"fortio.org/fortio/fhttp"
@@ -40,8 +42,10 @@ type FortioHook func(*fhttp.HTTPOptions, *periodic.RunnerOptions)
 
 var (
 	compressionFlag = flag.Bool("compression", false, "Enable HTTP compression")
-	keepAliveFlag   = flag.Bool("keepalive", true, "Keep connection alive (only for fast HTTP/1.1)")
-	halfCloseFlag   = flag.Bool("halfclose", false,
+	autoDecompFlag  = flag.Bool("auto-decompress", false,
+		"Decompress gzip responses even when Accept-Encoding is set explicitly (implies -stdclient)")
+	keepAliveFlag = flag.Bool("keepalive", true, "Keep connection alive (only for fast HTTP/1.1)")
+	halfCloseFlag = flag.Bool("halfclose", false,
 		"When not keepalive, whether to half close the connection (only for fast http)")
 	httpReqTimeoutFlag  = flag.Duration("timeout", fhttp.HTTPReqTimeOutDefaultValue, "Connection and read timeout value (for HTTP)")
 	stdClientFlag       = flag.Bool("stdclient", false, "Use the slower net/http standard client (slower but supports h2/h2c)")
@@ -60,7 +64,8 @@ var (
 	PayloadSizeFlag = flag.Int("payload-size", 0, "Additional random payload size, replaces -payload when set > 0,"+
 		" must be smaller than -maxpayloadsizekb. Setting this switches HTTP to POST.")
 	// PayloadFlag is the value of -payload.
-	PayloadFlag = flag.String("payload", "", "Payload string to send along")
+	PayloadFlag = flag.String("payload", "", "Payload string to send along, or - to read it from stdin, "+
+		"or @path to read each HTTP request's body (up to -payload-chunk-size bytes) from that file or FIFO")
 	// PayloadFileFlag is the value of -paylaod-file.
 	PayloadFileFlag = flag.String("payload-file", "", "File `path` to be use as payload (POST for HTTP), replaces -payload when set.")
 	// PayloadStreamFlag for streaming payload from stdin (curl only).
@@ -71,6 +76,9 @@ var (
 	CertFlag = flag.String("cert", "", "`Path` to the certificate file to be used for client or server TLS")
 	// KeyFlag is the flag for the path for the key for the `cert`.
 	KeyFlag = flag.String("key", "", "`Path` to the key file matching the -cert")
+	// Reloading of the cert and key files.
+	certRotationFlag = flag.Duration("cert-rotation-interval", 0,
+		"Reload the -cert and -key files every `interval` (e.g. 1h), for short-lived certificates during long runs")
 	// CACertFlag is the flag for the path of the custom CA to verify server certificates in client calls.
 	CACertFlag = flag.String("cacert", "",
 		"`Path` to a custom CA certificate file to be used for the TLS client connections, "+
@@ -83,6 +91,8 @@ var (
 	// HelpFlag is true if help/usage is being requested by the user.
 	warmupFlag = flag.Bool("sequential-warmup", false,
 		"http(s) runner warmup done sequentially instead of parallel. When set, restores pre 1.21 behavior")
+	warmupStaggerFlag = flag.Duration("warmup-stagger", 0,
+		"In parallel http(s) runner warmup, each thread waits thread# times that `duration` before its first connection")
 	curlHeadersStdout = flag.Bool("curl-stdout-headers", false,
 		"Restore pre 1.22 behavior where HTTP headers of the fast client are output to stdout in curl mode. now stderr by default.")
 	// ConnectionReuseRange Dynamic string flag to set the max connection reuse range.
@@ -93,7 +103,91 @@ var (
 	// NoReResolveFlag is false if we want to resolve the DNS name for each new connection.
 	NoReResolveFlag = flag.Bool("no-reresolve", false, "Keep the initial DNS resolution and "+
 		"don't re-resolve when making new connections (because of error or reuse limit reached)")
+	// DNSCacheTTLFlag is the duration to cache the DNS resolution for, when positive.
+	DNSCacheTTLFlag = flag.Duration("dns-cache-ttl", 0, "Cache the DNS resolution for that `duration` and re-resolve "+
+		"on new connections after it expires, regardless of -no-reresolve. 0 (default) means no caching")
 	MethodFlag = flag.String("X", "", "HTTP method to use instead of GET/POST depending on payload/content-type")
+	// httpProxyFlag is the explicit proxy to use instead of the environment variables.
+	httpProxyFlag = flag.String("http-proxy", "", "Proxy `host:port` to tunnel the HTTP(S) connections through "+
+		"(using CONNECT), overrides the HTTPS_PROXY/HTTP_PROXY environment variables")
+	// detectHSTSFlag turns on the Strict-Transport-Security header detection.
+	detectHSTSFlag = flag.Bool("detect-hsts", false,
+		"Warn (once per thread) and report in the results when responses have a Strict-Transport-Security header")
+	// pipeliningDepthFlag is the number of HTTP/1.1 requests sent back to back by the fast client.
+	pipeliningDepthFlag = flag.Int("pipelining-depth", 0, "HTTP/1.1 pipelining: send `N` requests back to back "+
+		"on the connection then read all the responses (fast client, keep-alive only; each call then covers N requests). "+
+		"Note that pipelining is disabled by most modern HTTP servers")
+	// Separate connection and response timeouts, defaulting to -timeout.
+	connectTimeoutFlag = flag.Duration("connect-timeout", 0,
+		"Timeout for establishing HTTP connections, including TLS handshake (default 0 means same as -timeout)")
+	responseTimeoutFlag = flag.Duration("response-timeout", 0,
+		"Timeout for getting HTTP responses (default 0 means same as -timeout)")
+	timeoutJitterFlag = flag.Duration("timeout-jitter", 0,
+		"Randomly vary each request's response timeout by up to plus or minus that `duration`")
+	// cacheValidationFlag turns on conditional requests (ETag/Last-Modified).
+	cacheValidationFlag = flag.Bool("cache-validation", false,
+		"Send the ETag (or Last-Modified) of the first response back as If-None-Match (or If-Modified-Since) "+
+			"and count the 304 Not Modified responses as successes (cache hits)")
+	// Source region annotation of the results, for distributed/cloud runs.
+	annotateGeoFlag = flag.Bool("annotate-geo", false,
+		"Look up the region/country of the source IP (once per run) and add it to the results as SourceRegion")
+	geoAPIURLFlag = flag.String("geo-api-url", fhttp.DefaultGeoAPIURL,
+		"`URL` of the JSON IP geolocation service used by -annotate-geo")
+	// Std client circuit breaker.
+	circuitBreakerThresholdFlag = flag.Float64("circuit-breaker-threshold", 0,
+		"Std client circuit breaker: open the circuit (fail requests immediately) when that `fraction` "+
+			"of the last -circuit-breaker-window requests failed, 0 disables")
+	circuitBreakerWindowFlag = flag.Int("circuit-breaker-window", 20,
+		"Number of recent requests considered by the circuit breaker")
+	circuitBreakerCooldownFlag = flag.Duration("circuit-breaker-cooldown", 5*time.Second,
+		"Time the circuit breaker stays open before letting a probe request through")
+	// Byte range requests.
+	rangeStartFlag = flag.Int64("range-start", 0,
+		"Request the byte range starting at that `offset` (Range: bytes=start-end header)")
+	rangeEndFlag = flag.Int64("range-end", 0,
+		"Last byte `offset` (inclusive) of the requested range, 0 means until the end (when -range-start is set)")
+	rangeRandomFlag = flag.Bool("range-random", false,
+		"Request a random byte range within the Content-Length (from a HEAD request at startup) for each request")
+	// HMAC request signing.
+	hmacSignKeyFlag = flag.String("hmac-sign-key", "",
+		"Sign each request with HMAC-SHA256(`key`, body+timestamp) in the -hmac-sign-header header "+
+			"(and the timestamp in "+fhttp.SignatureTimestampHeader+")")
+	hmacSignHeaderFlag = flag.String("hmac-sign-header", "X-Signature",
+		"Header `name` for the -hmac-sign-key signature")
+	// CORS preflight load testing.
+	corsPreflightFlag = flag.String("cors-preflight", "",
+		"Send CORS preflight requests (OPTIONS with Access-Control-Request-Method) for that `method`, e.g. GET, "+
+			"with the Origin from -H or "+fhttp.DefaultCORSPreflightOrigin)
+	corsPreflightCacheFlag = flag.Bool("cors-preflight-cache", false,
+		"Like browsers, send CORS preflight (OPTIONS) requests before the requests, cached per their "+
+			"Access-Control-Max-Age (implies -stdclient)")
+	// Std client retry of requests failing with a connection reset (ECONNRESET).
+	retryOnResetFlag = flag.Bool("retry-on-reset", true,
+		"Retry idempotent std client requests once, on a new connection, when they fail with a connection reset")
+	retryNonIdempotentFlag = flag.Bool("retry-non-idempotent", false,
+		"Also -retry-on-reset the non idempotent (e.g. POST) requests, which the server may have processed")
+	// nagleFlag keeps Nagle's algorithm on, instead of the default TCP_NODELAY.
+	nagleFlag = flag.Bool("nagle", false,
+		"Keep Nagle's algorithm enabled on the HTTP connections (default is TCP_NODELAY, for lower latency of small requests)")
+	// sequenceHeaderFlag is the header for the per thread request sequence numbers.
+	sequenceHeaderFlag = flag.String("sequence-header", "",
+		"Add that header `name` with a runid/thread/sequence number value to each request, for tracing correlation")
+	// payloadChunkSizeFlag is the maximum size of each request body read from a -payload @path.
+	payloadChunkSizeFlag = flag.Int("payload-chunk-size", 32*fnet.KILOBYTE,
+		"Maximum `size` in bytes of each request body read from a -payload @path file or FIFO")
+	// tcpInfoFlag enables the kernel TCP_INFO metrics of the connections.
+	tcpInfoFlag = flag.Bool("tcp-info", false,
+		"Report the connections' kernel TCP_INFO round trip time, congestion window and retransmits (Linux, fast client only)")
+	// detectDedupFlag turns on the comparison of the responses' fingerprint header.
+	detectDedupFlag = flag.Bool("detect-dedup", false,
+		"Count the responses whose -fingerprint-header value differs from the first response's one "+
+			"(e.g. a cache serving different content for identical requests)")
+	// fingerprintHeaderFlag is the response header compared by -detect-dedup.
+	fingerprintHeaderFlag = flag.String("fingerprint-header", fhttp.DefaultFingerprintHeader,
+		"Response header `name` compared by -detect-dedup, e.g. ETag or Content-MD5")
+	// serverTimingFlag turns on the recording of the responses' Server-Timing metrics.
+	serverTimingFlag = flag.Bool("server-timing", false,
+		"Record the dur of each metric of the responses' Server-Timing headers in a per metric histogram")
 )
 
 // SharedMain is the common part of main from fortio_main and fcurl.
@@ -103,8 +197,21 @@ func SharedMain() {
 	flag.Func("H",
 		"Additional HTTP header(s) or gRPC metadata. Multiple `key:value` pairs can be passed using multiple -H.",
 		httpOpts.AddAndValidateExtraHeader)
+	flag.Func("trailer",
+		"Request trailer(s) `key:value` sent after the body, which is then chunked (e.g. for gRPC-web). Can be repeated.",
+		httpOpts.AddRequestTrailer)
+	flag.Func("forbidden-response-header",
+		"Response header `name` which should never be sent back (e.g. Authorization), the responses with it "+
+			"are counted and fortio load exits with code 3 if any. Can be repeated.",
+		func(name string) error {
+			httpOpts.ForbiddenResponseHeaders = append(httpOpts.ForbiddenResponseHeaders, name)
+			return nil
+		})
 	flag.IntVar(&fhttp.BufferSizeKb, "httpbufferkb", fhttp.BufferSizeKb,
 		"Size of the buffer (max data size) for the optimized HTTP client in `kbytes`")
+	flag.IntVar(&httpOpts.HeaderBufferKb, "httpheaderbufferkb", 0,
+		"Max size of the response headers for the optimized HTTP client in `kbytes`, the buffer grows when needed "+
+			"to fit them plus -httpbufferkb of data. Defaults to (and can't be less than) -httpbufferkb")
 	flag.BoolVar(&fhttp.CheckConnectionClosedHeader, "httpccch", fhttp.CheckConnectionClosedHeader,
 		"Check for Connection: Close Header")
 	// FlagResolveIPType indicates which IP types to resolve.
@@ -116,6 +223,8 @@ func SharedMain() {
 	// default assumes one gets all the IPs in the first call and does round-robin across these.
 	// first just picks the first answer, rr rounds robin on each answer.
 	dflag.Flag("dns-method", fnet.FlagResolveMethod)
+	// FlagDOHURL is the DNS over HTTPS server used by the doh dns-method.
+	dflag.Flag("doh-url", fnet.FlagDOHURL)
 	dflag.Flag("echo-server-default-params", fhttp.DefaultEchoServerParams)
 	dflag.FlagBool("proxy-all-headers", fhttp.Fetch2CopiesAllHeader)
 	dflag.Flag("server-idle-timeout", fhttp.ServerIdleTimeout)
@@ -162,6 +271,22 @@ func FetchURL(o *fhttp.HTTPOptions) {
 	}
 }
 
+// payloadFlagValue returns the -payload string, read from stdin (like curl -d @-) when it is "-"
+// and no other payload option replaces it. Unlike -stream, the whole payload is read upfront so
+// it can be sent by the fast client and repeated for load tests.
+func payloadFlagValue() string {
+	if *PayloadFlag != "-" || *PayloadFileFlag != "" || *PayloadSizeFlag > 0 {
+		return *PayloadFlag
+	}
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		log.Errf("Unable to read payload from stdin: %v", err)
+		os.Exit(1)
+	}
+	log.LogVf("Read %d bytes of payload from stdin", len(data))
+	return string(data)
+}
+
 // TLSInsecure returns true if -k or -https-insecure was passed.
 func TLSInsecure() bool {
 	TLSInsecure := *httpsInsecureFlag || *httpsInsecureFlagL
@@ -173,6 +298,11 @@ func TLSInsecure() bool {
 	return TLSInsecure
 }
 
+// RequestTimeout returns the -timeout flag value.
+func RequestTimeout() time.Duration {
+	return *httpReqTimeoutFlag
+}
+
 // ConnectionReuseRangeValidator returns a validator function that checks if the connection reuse range is valid
 // and set in httpOpts.
 func ConnectionReuseRangeValidator(httpOpts *fhttp.HTTPOptions) func(string) error {
@@ -190,11 +320,38 @@ func SharedHTTPOptions() *fhttp.HTTPOptions {
 	httpOpts.H2 = *h2Flag
 	httpOpts.DisableFastClient = *stdClientFlag
 	httpOpts.DisableKeepAlive = !*keepAliveFlag
+	httpOpts.DisableRetryOnReset = !*retryOnResetFlag
+	httpOpts.RetryNonIdempotent = *retryNonIdempotentFlag
+	httpOpts.EnableNagle = *nagleFlag
+	httpOpts.SequenceNumberHeader = *sequenceHeaderFlag
+	httpOpts.TCPInfo = *tcpInfoFlag
+	httpOpts.DetectDedup = *detectDedupFlag
+	httpOpts.FingerprintHeader = *fingerprintHeaderFlag
+	httpOpts.ParseServerTiming = *serverTimingFlag
 	httpOpts.AllowHalfClose = *halfCloseFlag
 	httpOpts.Compression = *compressionFlag
+	httpOpts.AutoDecompress = *autoDecompFlag
 	httpOpts.HTTPReqTimeOut = *httpReqTimeoutFlag
 	httpOpts.Insecure = TLSInsecure()
 	httpOpts.Resolve = *resolve
+	httpOpts.HTTPProxy = *httpProxyFlag
+	httpOpts.DetectHSTS = *detectHSTSFlag
+	httpOpts.PipeliningDepth = *pipeliningDepthFlag
+	httpOpts.ConnectTimeout = *connectTimeoutFlag
+	httpOpts.ResponseTimeout = *responseTimeoutFlag
+	httpOpts.TimeoutJitter = *timeoutJitterFlag
+	httpOpts.CacheValidation = *cacheValidationFlag
+	httpOpts.AnnotateGeo = *annotateGeoFlag
+	httpOpts.GeoAPIURL = *geoAPIURLFlag
+	httpOpts.CircuitBreakerThreshold = *circuitBreakerThresholdFlag
+	httpOpts.CircuitBreakerWindow = *circuitBreakerWindowFlag
+	httpOpts.CircuitBreakerCooldown = *circuitBreakerCooldownFlag
+	httpOpts.RangeStart = *rangeStartFlag
+	httpOpts.RangeEnd = *rangeEndFlag
+	httpOpts.RangeRandom = *rangeRandomFlag
+	if *hmacSignKeyFlag != "" {
+		httpOpts.Signer = fhttp.HMACSHA256Signer(*hmacSignKeyFlag, *hmacSignHeaderFlag)
+	}
 	httpOpts.UserCredentials = *userCredentialsFlag
 	if len(*contentTypeFlag) > 0 {
 		// only set content-type from flag if flag isn't empty as it can come also from -H content-type:...
@@ -202,9 +359,18 @@ func SharedHTTPOptions() *fhttp.HTTPOptions {
 	}
 	if *PayloadStreamFlag {
 		httpOpts.PayloadReader = os.Stdin
+	} else if fname, found := strings.CutPrefix(*PayloadFlag, "@"); found && *PayloadFileFlag == "" && *PayloadSizeFlag <= 0 {
+		// Opening a FIFO blocks until the writing side opens it too.
+		f, err := os.Open(fname)
+		if err != nil {
+			log.Errf("Unable to open payload %s: %v", fname, err)
+			os.Exit(1)
+		}
+		httpOpts.PayloadReader = f
+		httpOpts.PayloadChunkSize = *payloadChunkSizeFlag
 	} else {
 		// Returns nil if file read error, an empty but non nil slice if no payload is requested.
-		httpOpts.Payload = fnet.GeneratePayload(*PayloadFileFlag, *PayloadSizeFlag, *PayloadFlag)
+		httpOpts.Payload = fnet.GeneratePayload(*PayloadFileFlag, *PayloadSizeFlag, payloadFlagValue())
 		if httpOpts.Payload == nil {
 			// Error already logged
 			os.Exit(1)
@@ -218,11 +384,16 @@ func SharedHTTPOptions() *fhttp.HTTPOptions {
 	httpOpts.CACert = *CACertFlag
 	httpOpts.Cert = *CertFlag
 	httpOpts.Key = *KeyFlag
+	httpOpts.CertRotationInterval = *certRotationFlag
 	httpOpts.MTLS = *mTLS
 	httpOpts.LogErrors = *LogErrorsFlag
 	httpOpts.SequentialWarmup = *warmupFlag
+	httpOpts.WarmupStagger = *warmupStaggerFlag
 	httpOpts.NoResolveEachConn = *NoReResolveFlag
+	httpOpts.DNSCacheTTL = *DNSCacheTTLFlag
 	httpOpts.MethodOverride = *MethodFlag
+	httpOpts.CORSPreflightMethod = *corsPreflightFlag
+	httpOpts.CORSPreflight = *corsPreflightCacheFlag
 	fhttp.DefaultHTTPOptions = &httpOpts
 	return &httpOpts
 }
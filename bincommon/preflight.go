@@ -0,0 +1,71 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bincommon
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"fortio.org/fortio/fgrpc"
+	"fortio.org/fortio/fhttp"
+	"fortio.org/fortio/fnet"
+	"fortio.org/fortio/tcprunner"
+	"fortio.org/log"
+)
+
+// PreflightTimeout is the timeout of the PreflightScan connection.
+var PreflightTimeout = 2 * time.Second
+
+// PreflightScan checks that the load test destination accepts connections, connecting (within
+// PreflightTimeout) to the same address as the runner will: the -unix-socket, the -proxy or the resolved
+// (or -resolve overridden) host and port. Only http(s)://, tcp:// and gRPC destinations can be checked,
+// other ones are skipped.
+func PreflightScan(ctx context.Context, o *fhttp.HTTPOptions, grpc bool) error {
+	dest := o.URL
+	var addr net.Addr
+	switch {
+	case grpc:
+		tAddr, err := fnet.TCPResolveDestination(ctx, fgrpc.Destination(dest))
+		if err != nil {
+			return err
+		}
+		addr = tAddr
+	case strings.HasPrefix(dest, tcprunner.TCPURLPrefix):
+		tAddr, err := fnet.TCPResolveDestination(ctx, dest)
+		if err != nil {
+			return err
+		}
+		addr = tAddr
+	case strings.HasPrefix(dest, fnet.PrefixHTTP), strings.HasPrefix(dest, fnet.PrefixHTTPS):
+		var err error
+		if addr, err = o.ConnectAddress(ctx); err != nil {
+			return err
+		}
+	default:
+		log.Warnf("Preflight scan not possible for %s, skipping", dest)
+		return nil
+	}
+	dialer := net.Dialer{Timeout: PreflightTimeout}
+	conn, err := dialer.DialContext(ctx, addr.Network(), addr.String())
+	if err != nil {
+		return fmt.Errorf("%s (%s) is unreachable (wrong host or port?): %w", dest, addr, err)
+	}
+	_ = conn.Close()
+	log.Infof("Preflight scan: %s (%s) is reachable", dest, addr)
+	return nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bincommon
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"fortio.org/fortio/fhttp"
+	"fortio.org/fortio/fnet"
+)
+
+func TestPreflightScan(t *testing.T) {
+	open, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer open.Close()
+	openPort := fnet.GetPort(open.Addr())
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	closedPort := fnet.GetPort(closed.Addr())
+	closed.Close()
+	socket := filepath.Join(t.TempDir(), "preflight.sock")
+	unix, err := net.Listen(fnet.UnixDomainSocket, socket)
+	if err != nil {
+		t.Fatalf("Unable to listen on %s: %v", socket, err)
+	}
+	defer unix.Close()
+	tests := []struct {
+		url     string
+		resolve string
+		socket  string
+		grpc    bool
+		ok      bool
+	}{
+		{url: "http://127.0.0.1:" + openPort + "/", ok: true},
+		{url: "http://127.0.0.1:" + closedPort + "/", ok: false},
+		{url: "tcp://127.0.0.1:" + openPort, ok: true},
+		{url: "tcp://127.0.0.1:" + closedPort, ok: false},
+		{url: "127.0.0.1:" + openPort, grpc: true, ok: true},
+		{url: "127.0.0.1:" + closedPort, grpc: true, ok: false},
+		// the runner connects to the -resolve address or the unix socket, not the URL's host
+		{url: "http://fortio.invalid:" + openPort + "/", resolve: "127.0.0.1", ok: true},
+		{url: "http://fortio.invalid:" + closedPort + "/", resolve: "127.0.0.1", ok: false},
+		{url: "http://fortio.invalid/", socket: socket, ok: true},
+		{url: "udp://127.0.0.1:" + closedPort, ok: true}, // skipped
+	}
+	for _, tst := range tests {
+		o := fhttp.HTTPOptions{Resolve: tst.resolve}
+		o.UnixDomainSocket = tst.socket
+		o.URL = tst.url
+		err := PreflightScan(context.Background(), &o, tst.grpc)
+		if (err == nil) != tst.ok {
+			t.Errorf("PreflightScan(%+v) got %v, expected ok %v", tst, err, tst.ok)
+		}
+	}
+}
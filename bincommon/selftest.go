@@ -0,0 +1,166 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bincommon
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"fortio.org/fortio/fhttp"
+	"fortio.org/log"
+)
+
+// SelfTestTimeout is the maximum duration of each component's Test.
+var SelfTestTimeout = 5 * time.Second
+
+// ServerComponent is one of the servers started by `fortio server` that can check it is working.
+type ServerComponent interface {
+	Name() string
+	// Test makes a single request to the server and returns an error if it didn't get the expected reply.
+	Test() error
+}
+
+// SelfTest runs the Test of each component, logging the results, and returns the errors of the failed ones.
+func SelfTest(components []ServerComponent) []error {
+	var errs []error
+	for _, c := range components {
+		start := time.Now()
+		err := c.Test()
+		if err != nil {
+			log.S(log.Error, "Self test failed", log.Str("component", c.Name()), log.Attr("err", err))
+			errs = append(errs, fmt.Errorf("%s: %w", c.Name(), err))
+			continue
+		}
+		log.S(log.Info, "Self test ok", log.Str("component", c.Name()), log.Attr("duration", time.Since(start)))
+	}
+	return errs
+}
+
+// selfTestDestination returns the host:port to connect to for a server listening on addr,
+// localhost when listening on all the addresses.
+func selfTestDestination(addr net.Addr) string {
+	var ip net.IP
+	var port int
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip, port = a.IP, a.Port
+	case *net.UDPAddr:
+		ip, port = a.IP, a.Port
+	default:
+		return addr.String()
+	}
+	if ip == nil || ip.IsUnspecified() {
+		return net.JoinHostPort("localhost", fmt.Sprint(port))
+	}
+	return net.JoinHostPort(ip.String(), fmt.Sprint(port))
+}
+
+var selfTestPayload = []byte("fortio self test\n")
+
+// echoTest sends selfTestPayload on a new connection to addr and checks it gets it back.
+func echoTest(network string, addr net.Addr) error {
+	conn, err := net.DialTimeout(network, selfTestDestination(addr), SelfTestTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(SelfTestTimeout))
+	if _, err = conn.Write(selfTestPayload); err != nil {
+		return err
+	}
+	buf := make([]byte, len(selfTestPayload))
+	if _, err = io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	if !bytes.Equal(buf, selfTestPayload) {
+		return fmt.Errorf("unexpected echo %q", buf)
+	}
+	return nil
+}
+
+// TCPEchoComponent is the TCP echo server (see fnet.TCPEchoServer) listening on Addr.
+type TCPEchoComponent struct {
+	Addr net.Addr
+}
+
+func (c *TCPEchoComponent) Name() string {
+	return "tcp-echo"
+}
+
+// Test connects to the server and checks a message is echoed back.
+func (c *TCPEchoComponent) Test() error {
+	return echoTest("tcp", c.Addr)
+}
+
+// UDPEchoComponent is the UDP echo server (see fnet.UDPEchoServer) listening on Addr.
+type UDPEchoComponent struct {
+	Addr net.Addr
+}
+
+func (c *UDPEchoComponent) Name() string {
+	return "udp-echo"
+}
+
+// Test sends a datagram to the server and checks it is echoed back.
+func (c *UDPEchoComponent) Test() error {
+	return echoTest("udp", c.Addr)
+}
+
+// HTTPComponent is the HTTP (or HTTPS when TLS is set) echo server listening on Addr,
+// which can be a unix domain socket.
+type HTTPComponent struct {
+	Addr net.Addr
+	TLS  bool
+}
+
+func (c *HTTPComponent) Name() string {
+	if c.TLS {
+		return "https-echo"
+	}
+	return "http-echo"
+}
+
+// Test makes a GET request to the server and checks it replies with a 200 status.
+func (c *HTTPComponent) Test() error {
+	scheme := "http"
+	if c.TLS {
+		scheme = "https"
+	}
+	host := "localhost"
+	if _, unix := c.Addr.(*net.UnixAddr); !unix {
+		host = selfTestDestination(c.Addr)
+	}
+	o := fhttp.NewHTTPOptions(scheme + "://" + host + "/")
+	if unix, ok := c.Addr.(*net.UnixAddr); ok {
+		o.UnixDomainSocket = unix.Name
+	}
+	o.Insecure = true // testing our own (possibly self signed) certificate
+	o.HTTPReqTimeOut = SelfTestTimeout
+	client, err := fhttp.NewClient(o)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	code, _, _ := client.Fetch(context.Background())
+	if code != http.StatusOK {
+		return fmt.Errorf("unexpected http code %d", code)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bincommon
+
+import (
+	"errors"
+	"testing"
+
+	"fortio.org/fortio/fhttp"
+	"fortio.org/fortio/fnet"
+)
+
+type failingComponent struct{}
+
+func (failingComponent) Name() string {
+	return "failing"
+}
+
+func (failingComponent) Test() error {
+	return errors.New("test failure")
+}
+
+func TestSelfTest(t *testing.T) {
+	_, httpAddr := fhttp.ServeTCP("0", "")
+	components := []ServerComponent{
+		&TCPEchoComponent{Addr: fnet.TCPEchoServer("test-tcp-echo", "0")},
+		&UDPEchoComponent{Addr: fnet.UDPEchoServer("test-udp-echo", "0", false)},
+		&HTTPComponent{Addr: httpAddr},
+	}
+	if errs := SelfTest(components); len(errs) != 0 {
+		t.Errorf("Unexpected self test errors: %v", errs)
+	}
+	// Nothing listening anymore on a closed port.
+	l, addr := fnet.Listen("closed", "0")
+	l.Close()
+	components = append(components, failingComponent{}, &TCPEchoComponent{Addr: addr})
+	errs := SelfTest(components)
+	if len(errs) != 2 {
+		t.Fatalf("Expected 2 self test errors, got %v", errs)
+	}
+	if errs[0].Error() != "failing: test failure" {
+		t.Errorf("Unexpected error %v", errs[0])
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bincommon
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"fortio.org/fortio/stats"
+)
+
+// SLALimit is a maximum latency for a percentile.
+type SLALimit struct {
+	Name       string // as specified, e.g. "p99"
+	Percentile float64
+	Limit      time.Duration
+}
+
+// SLASpec is the list of latency limits of the -fail-on-sla flag.
+type SLASpec []SLALimit
+
+// ParseSLAFlag parses a comma separated list of percentile limits, e.g. "p99=50ms" or "p50=10ms,p99.9=100ms".
+func ParseSLAFlag(s string) (SLASpec, error) {
+	var spec SLASpec
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, limit, found := strings.Cut(part, "=")
+		name = strings.TrimSpace(name)
+		if !found || len(name) < 2 || (name[0] != 'p' && name[0] != 'P') {
+			return nil, fmt.Errorf("invalid sla %q, expecting pNN=duration (e.g. p99=50ms)", part)
+		}
+		p, err := strconv.ParseFloat(name[1:], 64)
+		if err != nil || p <= 0 || p > 100 {
+			return nil, fmt.Errorf("invalid sla percentile %q, expecting a number in ]0, 100]", name)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(limit))
+		if err != nil {
+			return nil, fmt.Errorf("invalid sla limit for %s: %w", name, err)
+		}
+		spec = append(spec, SLALimit{Name: name, Percentile: p, Limit: d})
+	}
+	if len(spec) == 0 {
+		return nil, fmt.Errorf("empty sla %q", s)
+	}
+	return spec, nil
+}
+
+// Violations returns a message for each of the limits exceeded by the corresponding percentile
+// of the (duration in seconds) histogram, e.g. "p99=67.3ms exceeds limit 50ms". Empty when all are met.
+func (spec SLASpec) Violations(h *stats.HistogramData) []string {
+	var res []string
+	for _, l := range spec {
+		v := time.Duration(h.CalcPercentile(l.Percentile) * float64(time.Second))
+		if v > l.Limit {
+			res = append(res, fmt.Sprintf("%s=%v exceeds limit %v", l.Name, v.Round(100*time.Microsecond), l.Limit))
+		}
+	}
+	return res
+}
@@ -0,0 +1,89 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bincommon
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"fortio.org/fortio/stats"
+)
+
+func TestParseSLAFlag(t *testing.T) {
+	tests := []struct {
+		flag     string
+		expected SLASpec // nil for errors
+	}{
+		{"p99=50ms", SLASpec{{"p99", 99, 50 * time.Millisecond}}},
+		{" p50 = 10ms , P99.9=1s,", SLASpec{{"p50", 50, 10 * time.Millisecond}, {"P99.9", 99.9, time.Second}}},
+		{"p100=2s", SLASpec{{"p100", 100, 2 * time.Second}}},
+		// malformed
+		{"", nil},
+		{",", nil},
+		{"p99", nil},
+		{"p99:50ms", nil},
+		{"p=50ms", nil},
+		{"p99=50", nil},
+		{"p99=fast", nil},
+		// unknown metric / percentile
+		{"avg=50ms", nil},
+		{"max=1s", nil},
+		{"pxx=50ms", nil},
+		{"p0=50ms", nil},
+		{"p101=50ms", nil},
+		{"p-1=50ms", nil},
+	}
+	for _, tst := range tests {
+		spec, err := ParseSLAFlag(tst.flag)
+		if tst.expected == nil {
+			if err == nil {
+				t.Errorf("ParseSLAFlag(%q) expected an error, got %v", tst.flag, spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSLAFlag(%q) unexpected error: %v", tst.flag, err)
+		}
+		if !reflect.DeepEqual(spec, tst.expected) {
+			t.Errorf("ParseSLAFlag(%q) got %v, expected %v", tst.flag, spec, tst.expected)
+		}
+	}
+}
+
+func TestSLAViolations(t *testing.T) {
+	h := stats.NewHistogram(0, 0.001)
+	h.RecordN(0.010, 90) // 10ms
+	h.RecordN(0.100, 10) // 100ms
+	data := h.Export()
+	tests := []struct {
+		flag     string
+		expected []string
+	}{
+		{"p50=20ms", nil},
+		{"p50=10ms,p100=100ms", nil},
+		{"p50=5ms", []string{"p50=10ms exceeds limit 5ms"}},
+		{"p50=5ms,p90=1s,p100=50ms", []string{"p50=10ms exceeds limit 5ms", "p100=100ms exceeds limit 50ms"}},
+	}
+	for _, tst := range tests {
+		spec, err := ParseSLAFlag(tst.flag)
+		if err != nil {
+			t.Fatalf("ParseSLAFlag(%q) unexpected error: %v", tst.flag, err)
+		}
+		if v := spec.Violations(data); !reflect.DeepEqual(v, tst.expected) {
+			t.Errorf("Violations(%q) got %q, expected %q", tst.flag, v, tst.expected)
+		}
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"net"
 	"os"
 	"path"
 	"runtime"
@@ -32,11 +33,13 @@ import (
 
 	"fortio.org/cli"
 	"fortio.org/fortio/bincommon"
+	"fortio.org/fortio/dnsrunner"
 	"fortio.org/fortio/fgrpc"
 	"fortio.org/fortio/fhttp"
 	"fortio.org/fortio/fnet"
 	"fortio.org/fortio/periodic"
 	"fortio.org/fortio/rapi"
+	"fortio.org/fortio/sctprunner"
 	"fortio.org/fortio/stats"
 	"fortio.org/fortio/tcprunner"
 	"fortio.org/fortio/udprunner"
@@ -49,16 +52,17 @@ import (
 
 // fortio's help/args message.
 func helpArgsString() string {
-	return fmt.Sprintf("target\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s",
+	return fmt.Sprintf("target\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s",
 		"where command is one of: load (load testing), server (starts ui, rest api,",
 		" http-echo, redirect, proxies, tcp-echo, udp-echo and grpc ping servers), ",
 		" tcp-echo (only the tcp-echo server), udp-echo (only udp-echo server),",
 		" report (report only UI server), redirect (only the redirect server),",
-		" proxies (only the -M and -P configured proxies), grpcping (gRPC client),",
-		" or curl (single URL debug), or nc (single tcp or udp:// connection),",
-		" or version (prints the full version and build details).",
+		" proxies (only the -M, -P, -connect-proxy and -ssl-bump ones), grpcping (gRPC client),",
+		" or curl (single URL debug), or nc (single tcp, udp:// or sctp:// connection),",
+		" or version (prints the full version and build details, -deps for the modules list).",
 		"where target is a URL (http load tests) or host:port (grpc health test),",
-		" or tcp://host:port (tcp load test), or udp://host:port (udp load test).")
+		" or tcp://host:port (tcp load test), or udp://host:port (udp load test),",
+		" or dns://host[:port]/name (dns resolver load test), or sctp://host:port (sctp load test).")
 }
 
 // Attention: every flag that is common to HTTP client goes to bincommon/
@@ -66,6 +70,8 @@ func helpArgsString() string {
 
 const (
 	disabled = "disabled"
+	// Width of the -ascii-histogram chart when stdout isn't a terminal.
+	defaultTerminalWidth = 80
 )
 
 var (
@@ -87,6 +93,10 @@ var (
 		"tcp-echo server port. Can be in the form of host:port, ip:port, `port` or /unix/domain/path or \""+disabled+"\".")
 	udpPortFlag = flag.String("udp-port", "8078",
 		"udp-echo server port. Can be in the form of host:port, ip:port, `port` or \""+disabled+"\".")
+	sctpPortFlag = flag.String("sctp-port", disabled,
+		"sctp-echo server port (Linux only). Can be in the form of host:port, ip:port, `port` or \""+disabled+"\".")
+	stunPortFlag = flag.String("stun-port", disabled,
+		"STUN binding (reflexive address) echo server port. Can be in the form of host:port, ip:port, `port` or \""+disabled+"\".")
 	udpAsyncFlag = flag.Bool("udp-async", false, "if true, udp echo server will use separate go routine to reply")
 	grpcPortFlag = flag.String("grpc-port", fnet.DefaultGRPCPort,
 		"grpc server port. Can be in the form of host:port, ip:port or `port` or /unix/domain/path or \""+disabled+
@@ -95,6 +105,8 @@ var (
 		"http echo server `URI` for debug, empty turns off that part (more secure)")
 	jsonFlag = flag.String("json", "",
 		"JSON output to provided file `path` or '-' for stdout (empty = no json output, unless -a is used)")
+	depsFlag = flag.Bool("deps", false,
+		"For the version command: list the module@version of all the dependencies fortio was built with (as JSON with -json)")
 	uiPathFlag = flag.String("ui-path", "/fortio/", "HTTP server `URI` for UI, empty turns off that part (more secure)")
 	curlFlag   = flag.Bool("curl", false, "Just fetch the content once")
 	labelsFlag = flag.String("labels", "",
@@ -103,12 +115,39 @@ var (
 	// which is now embedded in the binary thanks to that support in golang 1.16.
 	_           = flag.String("static-dir", "", "Deprecated/unused `path`.")
 	dataDirFlag = flag.String("data-dir", ".", "`Directory` where JSON results are stored/read")
+	// API tokens for shared servers.
+	apiTokenFileFlag = flag.String("api-token-file", "", "`Path` of a file with token:username lines: "+
+		"the REST run, replay and stop calls then require an 'Authorization: Bearer token' header and "+
+		"runs can only be stopped by the user who started them (or the "+rapi.AdminUser+" user)")
+	corsOriginFlag = flag.String("cors-origin", "",
+		"`Origin` allowed to call the REST API from a browser (CORS), e.g. '*' or 'https://dashboard.example.com', "+
+			"empty for no CORS headers")
+	maxConcurrentRunsFlag = flag.Int("max-concurrent-runs", 0,
+		"Maximum `number` of REST/UI runs at the same time, 0 for unlimited; additional runs are queued "+
+			"by their priority (REST priority= argument, higher first)")
+	fairScheduleFlag = flag.Bool("fair-schedule", true,
+		"Increase the priority of runs queued because of -max-concurrent-runs by 1 every 10s to avoid starvation")
+	lifecycleWebhookFlag = flag.String("lifecycle-webhook", "",
+		"`URL` to POST a JSON notification to for each REST/UI run state change (started, stopped or error)")
+	webhookSecretFlag = flag.String("webhook-secret", "",
+		"Key to sign the -lifecycle-webhook notifications with (HMAC-SHA256 in the "+rapi.WebhookSignatureHeader+" header)")
 	proxies     = make([]string, 0)
 	httpMulties = make([]string, 0)
 
+	connectProxyFlag = flag.String("connect-proxy", "",
+		"HTTP CONNECT (forward) proxy `port` to run, e.g. to test clients with -http-proxy or HTTPS_PROXY set, empty for none")
+	sslBumpFlag = flag.String("ssl-bump", "",
+		"HTTPS intercepting (SSL bump) CONNECT proxy `port` to run: TLS is terminated with certificates signed by "+
+			"-bump-ca-cert and the requests are forwarded to the destination (verified unless -k), empty for none")
+	bumpCACertFlag = flag.String("bump-ca-cert", "", "`Path` of the CA certificate signing the -ssl-bump proxy certificates")
+	bumpCAKeyFlag  = flag.String("bump-ca-key", "", "`Path` of the key of the -bump-ca-cert CA")
+
 	allowInitialErrorsFlag = flag.Bool("allow-initial-errors", false, "Allow and don't abort on initial warmup errors")
 	abortOnFlag            = flag.Int("abort-on", 0,
-		"HTTP status code that if encountered aborts the run. e.g., 503 or -1 for socket errors.")
+		"HTTP status code that if encountered aborts the run. e.g., 503 or -1 for socket errors"+
+			" (or only -3 for connection resets, -4 refused, -5 timeouts).")
+	verifyTraceEchoFlag = flag.Bool("verify-trace-echo", false,
+		"Check that the responses (to -X TRACE requests) echo all the sent headers, counting the mismatches as errors")
 	autoSaveFlag = flag.Bool("a", false, "Automatically save JSON result with filename based on labels & timestamp")
 	redirectFlag = flag.String("redirect-port", "8081", "Redirect all incoming traffic to https:// URL"+
 		" (need ingress to work properly). Can be in the form of host:port, ip:port, `port` or \""+disabled+"\" to disable the feature.")
@@ -118,6 +157,8 @@ var (
 	syncFlag         = flag.String("sync", "", "index.tsv or s3/gcs bucket XML `URL` to fetch at startup for server modes.")
 	syncIntervalFlag = flag.Duration("sync-interval", 0, "Refresh the URL every given interval (default, no refresh)")
 
+	staticOverlayDirFlag = flag.String("static-overlay-dir", "",
+		"`Directory` whose files (e.g. static/img/logo.svg) override the embedded UI static ones")
 	baseURLFlag = flag.String("base-url", "",
 		"base `URL` used as prefix for data/index.tsv generation. (when empty, the URL from the first request is used)")
 	newMaxPayloadSizeKb = flag.Int("maxpayloadsizekb", fnet.MaxPayloadSize/fnet.KILOBYTE,
@@ -138,12 +179,27 @@ var (
 	uniformFlag   = flag.Bool("uniform", false, "set to true to de-synchronize parallel clients' requests uniformly")
 	nocatchupFlag = flag.Bool("nocatchup", false,
 		"set to exact fixed qps and prevent fortio from trying to catchup when the target fails to keep up temporarily")
+	hdrFlag = flag.Bool("hdr", false,
+		"use high dynamic range histograms (1us to 1h with 1% precision) for the durations, instead of -r resolution ones")
+	shardedHistogramFlag = flag.Bool("sharded-histogram", false,
+		"use a shard per CPU for the live histograms, less contention with many (1000+) connections")
+	asciiHistogramFlag = flag.Bool("ascii-histogram", false,
+		"print the response time histogram as a bar chart (terminal width) at the end of the load test")
 	// nc mode flag(s).
 	ncDontStopOnCloseFlag = flag.Bool("nc-dont-stop-on-eof", false, "in netcat (nc) mode, don't abort as soon as remote side closes")
+	ncBandwidthTestFlag   = flag.Duration("nc-bw-test", 0,
+		"in netcat (nc) mode, instead of stdin/stderr, send zeros as fast as possible for that `duration` "+
+			"and report the throughput in both directions (e.g. to an echo server)")
 	// Mirror origin global setting (should be per destination eventually).
 	mirrorOriginFlag = flag.Bool("multi-mirror-origin", true, "Mirror the request URL to the target for multi proxies (-M)")
 	multiSerialFlag  = flag.Bool("multi-serial-mode", false, "Multi server (-M) requests one at a time instead of parallel mode")
 	udpTimeoutFlag   = flag.Duration("udp-timeout", udprunner.UDPTimeOutDefaultValue, "Udp timeout")
+	udpSTUNFlag      = flag.Bool("udp-stun", false, "Send STUN binding requests instead of echo payloads for udp:// load tests")
+	// dns:// load test flags.
+	dnsQueryTypeFlag = flag.String("dns-query-type", dnsrunner.DefaultQueryType,
+		"DNS query `type` for dns:// load tests (A, AAAA, MX, CNAME, NS, TXT, SOA, SRV, PTR)")
+	dnsQueryNameFlag = flag.String("dns-query-name", "",
+		"DNS `name` to query for dns:// load tests, defaults to the path part of the dns:// url")
 
 	accessLogFileFlag = flag.String("access-log-file", "",
 		"file `path` to log all requests to. Maybe have performance impacts")
@@ -151,6 +207,44 @@ var (
 		"`format` for access log. Supported values: [json, influx]")
 	calcQPS = flag.Bool("calc-qps", false, "Calculate the qps based on number of requests (-n) and duration (-t)")
 	pprofOn = flag.Bool("pprof", false, "Enable pprof HTTP endpoint in the Web UI handler server")
+	// Warmup phase (not counted in the main results).
+	warmupDurationFlag = flag.Duration("warmup-duration", 0,
+		"Optional `duration` of a warmup phase before the main run, reported separately")
+	warmupQPSFlag = flag.Float64("warmup-qps", 0, "Queries per second during the warmup phase, 0 means same as -qps, negative is max")
+	// Graphite (carbon plaintext protocol) server to send the results metrics to.
+	graphiteHostFlag = flag.String("graphite-host", "",
+		"Graphite/Carbon `host:port` (port defaults to 2003) to send the run's metrics to, over TCP, after a load test")
+	// InfluxDB (line protocol) write endpoint to send the results metrics to.
+	influxURLFlag = flag.String("influx-url", "",
+		"InfluxDB write endpoint `URL` (e.g. http://influx:8086/write?db=fortio) to POST the run's metrics to, "+
+			"in line protocol, after a load test")
+	// CI gate: exit code 2 when latency percentiles exceed the limits.
+	failOnSLAFlag = flag.String("fail-on-sla", "",
+		"Exit with code 2 when any of the `pNN=duration` (comma separated, e.g. p99=50ms) latency limits is exceeded")
+	// gRPC compressor (by name, gzip or registered ones like zstd).
+	grpcCompressorFlag = flag.String("grpc-compressor", "",
+		"gRPC compressor `name` to use (gzip, or any other registered like zstd), reports the compressed bytes")
+	grpcCallTimeoutFlag = flag.Duration("grpc-call-timeout", 0,
+		"Deadline of each gRPC call (propagated to the server), 0 for none. The calls exceeding it are counted separately")
+	// Reachability check of the target before the load test.
+	preflightScanFlag = flag.Bool("preflight-scan", false,
+		"Check that the target's TCP port accepts connections before starting the load test, exit with an error if not")
+	// Startup liveness check of the server components.
+	selfTestFlag = flag.Bool("self-test", false,
+		"server mode: after starting them, check each server (http, grpc ping, tcp and udp echo) with a single request")
+	selfTestFailFastFlag = flag.Bool("self-test-fail-fast", false, "Like -self-test but exit with code 1 if any check fails")
+	// Checkpointing of long runs, to resume them after an interruption.
+	checkpointFlag = flag.String("checkpoint", "",
+		"File `path` to periodically save the run's state to; when it exists the interrupted run is resumed from it"+
+			" (the url, labels, -n or -t and histogram options must be the same). The http return codes and sizes are"+
+			" only saved when the run is interrupted (e.g. SIGTERM), the other runners' specific results aren't")
+	checkpointIntervalFlag = flag.Duration("checkpoint-interval", periodic.DefaultCheckpointInterval,
+		"How often to save the -checkpoint file")
+	runTimeoutFlag = flag.Duration("run-timeout", 0,
+		"Abandon each call after this `duration`, counted as a timeout error, so a stuck one doesn't block its thread."+
+			" Only supported by the tcp runner, whose calls then each use a new connection")
+	webdavPathFlag = flag.String("webdav-path", "",
+		"http echo server `URI` (e.g. /webdav/) of a fake WebDAV server, empty (default) turns it off")
 )
 
 // serverArgCheck always returns true after checking arguments length.
@@ -164,12 +258,14 @@ func serverArgCheck() bool {
 
 func FortioMain(hook bincommon.FortioHook) {
 	flag.Func("P",
-		"TCP proxies to run, e.g -P \"localport1 dest_host1:dest_port1\" -P \"[::1]:0 www.google.com:443\" ...",
+		"TCP proxies to run, e.g -P \"localport1 dest_host1:dest_port1\" -P \"[::1]:0 www.google.com:443\" ..."+
+			" or UDP ones when the destination starts with udp://",
 		func(value string) error {
 			proxies = append(proxies, value)
 			return nil
 		})
-	flag.Func("M", "HTTP multi proxy to run, e.g -M \"localport1 baseDestURL1 baseDestURL2\" -M ...",
+	flag.Func("M", "HTTP multi proxy to run, e.g -M \"localport1 baseDestURL1 baseDestURL2\" -M ..."+
+		" with optional host routes, e.g \"*.example.com=destURL3\", for the matching requests",
 		func(value string) error {
 			httpMulties = append(httpMulties, value)
 			return nil
@@ -228,42 +324,82 @@ func FortioMain(hook bincommon.FortioHook) {
 	case "proxies":
 		isServer = serverArgCheck()
 		if startProxies() == 0 {
-			cli.ErrUsage("Error: fortio proxies command needs at least one -P / -M flag")
+			cli.ErrUsage("Error: fortio proxies command needs at least one -P / -M / -connect-proxy / -ssl-bump flag")
 		}
 	case "server":
 		isServer = serverArgCheck()
 		tlsOptions := &bincommon.SharedHTTPOptions().TLSOptions
+		var components []bincommon.ServerComponent
 		if *tcpPortFlag != disabled {
-			fnet.TCPEchoServer("tcp-echo", *tcpPortFlag)
+			if addr := fnet.TCPEchoServer("tcp-echo", *tcpPortFlag); addr != nil {
+				components = append(components, &bincommon.TCPEchoComponent{Addr: addr})
+			}
 		}
 		if *udpPortFlag != disabled {
-			fnet.UDPEchoServer("udp-echo", *udpPortFlag, *udpAsyncFlag)
+			if addr := fnet.UDPEchoServer("udp-echo", *udpPortFlag, *udpAsyncFlag); addr != nil {
+				components = append(components, &bincommon.UDPEchoComponent{Addr: addr})
+			}
+		}
+		if *sctpPortFlag != disabled {
+			fnet.SCTPEchoServer("sctp-echo", *sctpPortFlag)
+		}
+		if *stunPortFlag != disabled {
+			fnet.STUNEchoServer(*stunPortFlag)
 		}
 		if *grpcPortFlag != disabled {
-			fgrpc.PingServer(*grpcPortFlag, *healthSvcFlag, safecast.MustConvert[uint32](*maxStreamsFlag), tlsOptions)
+			addr := fgrpc.PingServer(*grpcPortFlag, *healthSvcFlag, safecast.MustConvert[uint32](*maxStreamsFlag), tlsOptions)
+			if addr != nil {
+				components = append(components, &grpcPingComponent{addr: addr, tls: tlsOptions.DoTLS()})
+			}
 		}
 		if *redirectFlag != disabled {
 			fhttp.RedirectToHTTPS(*redirectFlag)
 		}
+		fhttp.WebDAVPath = *webdavPathFlag
 		if *echoPortFlag != disabled {
+			var apiTokens map[string]string
+			if *apiTokenFileFlag != "" {
+				var err error
+				apiTokens, err = rapi.LoadTokens(*apiTokenFileFlag)
+				if err != nil {
+					log.Errf("Unable to load API tokens: %v", err)
+					os.Exit(1)
+				}
+			}
 			uiCfg := ui.ServerConfig{
-				BaseURL:        baseURL,
-				Port:           *echoPortFlag,
-				DebugPath:      *echoDbgPathFlag,
-				UIPath:         *uiPathFlag,
-				DataDir:        *dataDirFlag,
-				PProfOn:        *pprofOn,
-				PercentileList: percList(),
-				TLSOptions:     tlsOptions,
+				BaseURL:          baseURL,
+				Port:             *echoPortFlag,
+				DebugPath:        *echoDbgPathFlag,
+				UIPath:           *uiPathFlag,
+				DataDir:          *dataDirFlag,
+				PProfOn:          *pprofOn,
+				PercentileList:   percList(),
+				TLSOptions:       tlsOptions,
+				StaticOverlayDir: *staticOverlayDirFlag,
+				APITokens:        apiTokens,
+				CORSOrigin:       *corsOriginFlag,
 			}
+			uiCfg.MaxConcurrentRuns = *maxConcurrentRunsFlag
+			uiCfg.FairSchedule = *fairScheduleFlag
+			uiCfg.LifecycleWebhook = *lifecycleWebhookFlag
+			uiCfg.WebhookSecret = *webhookSecretFlag
 			if !ui.Serve(hook, &uiCfg) {
 				os.Exit(1) // error already logged
 			}
+			components = append(components, &bincommon.HTTPComponent{Addr: uiCfg.Addr, TLS: tlsOptions.DoTLS()})
 		}
 		startProxies()
+		if *selfTestFlag || *selfTestFailFastFlag {
+			if errs := bincommon.SelfTest(components); len(errs) > 0 && *selfTestFailFastFlag {
+				log.Critf("Self test failed for %d of %d servers: %v", len(errs), len(components), errs)
+				os.Exit(1)
+			}
+		}
 	case "grpcping":
 		log.SetDefaultsForClientTools()
 		grpcClient()
+	case "version":
+		fortioVersion()
 	default:
 		cli.ErrUsage("Error: unknown command %q", cli.Command)
 	}
@@ -304,7 +440,14 @@ func startProxies() int {
 		if len(s) != 2 {
 			log.Errf("Invalid syntax for proxy \"%s\", should be \"localAddr destHost:destPort\"", proxy)
 		}
-		fnet.ProxyToDestination(ctx, s[0], s[1])
+		if strings.HasPrefix(s[1], fnet.UDPPrefix) {
+			if _, err := fnet.UDPProxyToDestination(ctx, s[0], s[1]); err != nil {
+				log.Errf("Unable to start udp proxy \"%s\": %v", proxy, err)
+				continue
+			}
+		} else {
+			fnet.ProxyToDestination(ctx, s[0], s[1])
+		}
 		numProxies++
 	}
 	for _, hmulti := range httpMulties {
@@ -313,18 +456,60 @@ func startProxies() int {
 			log.Errf("Invalid syntax for HTTP multi \"%s\", should be \"localAddr destURL1 destURL2...\"", hmulti)
 		}
 		mcfg := fhttp.MultiServerConfig{Serial: *multiSerialFlag}
-		n := len(s) - 1
-		mcfg.Targets = make([]fhttp.TargetConf, n)
-		for i := range n {
-			mcfg.Targets[i].Destination = s[i+1]
-			mcfg.Targets[i].MirrorOrigin = *mirrorOriginFlag
+		for _, dest := range s[1:] {
+			// pattern=destURL routes (the pattern can't have URL characters, unlike URLs with queries).
+			if pattern, routeDest, found := strings.Cut(dest, "="); found && !strings.ContainsAny(pattern, ":/?") {
+				mcfg.SNIRouting = append(mcfg.SNIRouting, fhttp.SNIRoute{SNIPattern: pattern, Destination: routeDest})
+				continue
+			}
+			mcfg.Targets = append(mcfg.Targets, fhttp.TargetConf{Destination: dest, MirrorOrigin: *mirrorOriginFlag})
 		}
 		fhttp.MultiServer(s[0], &mcfg)
 		numProxies++
 	}
+	if *connectProxyFlag != "" {
+		if fnet.HTTPConnectProxyServer(*connectProxyFlag, bincommon.RequestTimeout()) != nil {
+			numProxies++
+		}
+	}
+	if *sslBumpFlag != "" {
+		o := &fhttp.SSLBumpOptions{CACert: *bumpCACertFlag, CAKey: *bumpCAKeyFlag, Insecure: bincommon.TLSInsecure()}
+		if _, err := fhttp.SSLBumpServer(*sslBumpFlag, o); err != nil {
+			log.Errf("Unable to start ssl bump proxy: %v", err)
+		} else {
+			numProxies++
+		}
+	}
 	return numProxies
 }
 
+// fortioVersion is the version command with flags (`fortio version` alone is handled by cli):
+// the full version and build details or, with -deps, the list of modules fortio was built with.
+func fortioVersion() {
+	if !*depsFlag {
+		fmt.Print(version.Full())
+		return
+	}
+	deps := version.BuildDeps()
+	if *jsonFlag == "" {
+		fmt.Println(strings.Join(deps, "\n"))
+		return
+	}
+	j, err := json.MarshalIndent(deps, "", "  ")
+	if err != nil {
+		log.Fatalf("Unable to json serialize dependencies: %v", err)
+	}
+	j = append(j, '\n')
+	if *jsonFlag == "-" {
+		_, err = os.Stdout.Write(j)
+	} else {
+		err = os.WriteFile(*jsonFlag, j, 0o644) //nolint:gosec // we do want 644
+	}
+	if err != nil {
+		log.Fatalf("Unable to write dependencies json to %s: %v", *jsonFlag, err)
+	}
+}
+
 func fortioNC() {
 	l := len(flag.Args())
 	if l != 1 && l != 2 {
@@ -334,6 +519,14 @@ func fortioNC() {
 	if l == 2 {
 		d = d + ":" + flag.Args()[1]
 	}
+	if *ncBandwidthTestFlag > 0 {
+		res, err := fnet.NetCatBandwidth(context.Background(), d, *ncBandwidthTestFlag)
+		if err != nil {
+			os.Exit(1) // already logged
+		}
+		res.Print(os.Stdout)
+		return
+	}
 	err := fnet.NetCat(context.Background(), d, os.Stdin, os.Stderr, !*ncDontStopOnCloseFlag /* stop when server closes connection */)
 	if err != nil {
 		// already logged, but exit with error back to shell/caller
@@ -366,6 +559,24 @@ func fortioLoad(justCurl bool, percList []float64, hook bincommon.FortioHook) {
 		qps = float64(*exactlyFlag) / durationFlag.Seconds()
 		log.LogVf("Calculated QPS to do %d request in %v: %f", *exactlyFlag, *durationFlag, qps)
 	}
+	var sla bincommon.SLASpec
+	if *failOnSLAFlag != "" {
+		var err error
+		if sla, err = bincommon.ParseSLAFlag(*failOnSLAFlag); err != nil {
+			cli.ErrUsage("Error: invalid -fail-on-sla: %v", err)
+		}
+	}
+	if *influxURLFlag != "" {
+		if err := rapi.ValidateWebhookURL(*influxURLFlag); err != nil {
+			cli.ErrUsage("Error: invalid -influx-url: %v", err)
+		}
+	}
+	if *preflightScanFlag {
+		if err := bincommon.PreflightScan(context.Background(), httpOpts, *grpcFlag); err != nil {
+			log.Errf("Preflight scan failed: %v", err)
+			os.Exit(1)
+		}
+	}
 	_, _ = fmt.Fprintf(out, "Fortio %s running at %g queries per second, %d->%d procs",
 		version.Short(), qps, prevGoMaxProcs, runtime.GOMAXPROCS(0))
 	if *exactlyFlag > 0 {
@@ -409,6 +620,17 @@ func fortioLoad(justCurl bool, percList []float64, hook bincommon.FortioHook) {
 		RunID:       *bincommon.RunIDFlag,
 		Offset:      *offsetFlag,
 		NoCatchUp:   *nocatchupFlag,
+		UseHDR:      *hdrFlag,
+
+		ShardedHistogram: *shardedHistogramFlag,
+
+		WarmupDuration: *warmupDurationFlag,
+		WarmupQPS:      *warmupQPSFlag,
+
+		CheckpointFile:     *checkpointFlag,
+		CheckpointInterval: *checkpointIntervalFlag,
+		CheckpointTarget:   url,
+		RunTimeout:         *runTimeoutFlag,
 	}
 	err := ro.AddAccessLogger(*accessLogFileFlag, *accessLogFileFormat)
 	if err != nil {
@@ -432,6 +654,8 @@ func fortioLoad(justCurl bool, percList []float64, hook bincommon.FortioHook) {
 			UsePing:            *doPingLoadFlag,
 			Metadata:           httpHeader2grpcMetadata(httpOpts.AllHeaders()),
 			GrpcCompression:    *grpcCompression,
+			GRPCCompressor:     *grpcCompressorFlag,
+			GRPCCallTimeout:    *grpcCallTimeoutFlag,
 			Profiler:           *profileFlag,
 		}
 		o.TLSOptions = httpOpts.TLSOptions
@@ -451,7 +675,25 @@ func fortioLoad(justCurl bool, percList []float64, hook bincommon.FortioHook) {
 		o.ReqTimeout = *udpTimeoutFlag
 		o.Destination = url
 		o.Payload = httpOpts.Payload
+		o.STUNMode = *udpSTUNFlag
 		res, err = udprunner.RunUDPTest(&o)
+	case strings.HasPrefix(url, sctprunner.SCTPURLPrefix):
+		o := sctprunner.RunnerOptions{
+			RunnerOptions: ro,
+		}
+		o.ReqTimeout = *udpTimeoutFlag
+		o.Destination = url
+		o.Payload = httpOpts.Payload
+		res, err = sctprunner.RunSCTPTest(&o)
+	case strings.HasPrefix(url, dnsrunner.DNSURLPrefix):
+		o := dnsrunner.RunnerOptions{
+			RunnerOptions: ro,
+		}
+		o.ReqTimeout = *udpTimeoutFlag
+		o.Destination = url
+		o.QueryType = *dnsQueryTypeFlag
+		o.QueryName = *dnsQueryNameFlag
+		res, err = dnsrunner.RunDNSTest(&o)
 	default:
 		o := fhttp.HTTPRunnerOptions{
 			HTTPOptions:        *httpOpts,
@@ -459,6 +701,7 @@ func fortioLoad(justCurl bool, percList []float64, hook bincommon.FortioHook) {
 			Profiler:           *profileFlag,
 			AllowInitialErrors: *allowInitialErrorsFlag,
 			AbortOn:            *abortOnFlag,
+			VerifyTraceEcho:    *verifyTraceEchoFlag,
 		}
 		res, err = fhttp.RunHTTPTest(&o)
 	}
@@ -476,6 +719,19 @@ func fortioLoad(justCurl bool, percList []float64, hook bincommon.FortioHook) {
 		warmup,
 		1000.*rr.DurationHistogram.Avg,
 		rr.ActualQPS)
+	if *asciiHistogramFlag {
+		rr.DurationHistogram.PrintASCII(out, terminalWidth())
+	}
+	if *graphiteHostFlag != "" {
+		if err = rapi.SendToGraphite(*graphiteHostFlag, rr); err != nil {
+			log.Errf("Unable to send metrics to graphite %s: %v", *graphiteHostFlag, err)
+		}
+	}
+	if *influxURLFlag != "" {
+		if err = rapi.SendToInflux(*influxURLFlag, rr); err != nil {
+			log.Errf("Unable to send metrics to influx: %v", err)
+		}
+	}
 	jsonFileName := *jsonFlag
 	if *autoSaveFlag || len(jsonFileName) > 0 { //nolint:nestif // but probably should breakup this function
 		var j []byte
@@ -496,7 +752,8 @@ func fortioLoad(justCurl bool, percList []float64, hook bincommon.FortioHook) {
 				log.Fatalf("Unable to create %s: %v", jsonFileName, err)
 			}
 		}
-		n, err := f.Write(append(j, '\n'))
+		j = append(j, '\n')
+		n, err := f.Write(j)
 		if err != nil {
 			log.Fatalf("Unable to write json to %s: %v", jsonFileName, err)
 		}
@@ -505,9 +762,23 @@ func fortioLoad(justCurl bool, percList []float64, hook bincommon.FortioHook) {
 			if err != nil {
 				log.Fatalf("Close error for %s: %v", jsonFileName, err)
 			}
+			// So the result can be checked by rest/data/{id}.json?verify=1 when saved in the data dir.
+			if err = rapi.WriteChecksum(jsonFileName, j); err != nil {
+				log.Errf("Unable to write checksum of %s: %v", jsonFileName, err)
+			}
 		}
 		_, _ = fmt.Fprintf(out, "Successfully wrote %d bytes of Json data to %s\n", n, jsonFileName)
 	}
+	if violations := sla.Violations(rr.DurationHistogram); len(violations) > 0 {
+		for _, v := range violations {
+			_, _ = fmt.Fprintf(out, "FAIL: %s\n", v)
+		}
+		os.Exit(2)
+	}
+	if hr, ok := res.(*fhttp.HTTPRunnerResults); ok && hr.ForbiddenHeaderCount > 0 {
+		_, _ = fmt.Fprintf(out, "FAIL: %d responses with forbidden headers %v\n", hr.ForbiddenHeaderCount, hr.ForbiddenResponseHeaders)
+		os.Exit(3)
+	}
 }
 
 func grpcClient() {
@@ -540,6 +811,26 @@ func grpcClient() {
 	}
 }
 
+// grpcPingComponent is the gRPC ping server, for -self-test.
+type grpcPingComponent struct {
+	addr net.Addr
+	tls  bool
+}
+
+func (c *grpcPingComponent) Name() string {
+	return "grpc-ping"
+}
+
+func (c *grpcPingComponent) Test() error {
+	dest := net.JoinHostPort("localhost", fnet.GetPort(c.addr))
+	if c.tls {
+		dest = "https://" + dest
+	}
+	// testing our own (possibly self signed) certificate, so insecure.
+	_, err := fgrpc.PingClientCall(dest, 1, "", 0, &fhttp.TLSOptions{Insecure: c.tls}, nil)
+	return err
+}
+
 // httpHeader2grpcMetadata converts md's key to lowercase and filter invalid key.
 func httpHeader2grpcMetadata(headers map[string][]string) map[string][]string {
 	ret := make(map[string][]string)
@@ -0,0 +1,350 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dnsrunner is the DNS resolver load testing runner: each call sends a raw
+// query over UDP to the destination and measures the round trip time.
+package dnsrunner // import "fortio.org/fortio/dnsrunner"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"fortio.org/fortio/fnet"
+	"fortio.org/fortio/periodic"
+	"fortio.org/fortio/stats"
+	"fortio.org/log"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var (
+	// DNSURLPrefix is the URL prefix for triggering DNS load.
+	DNSURLPrefix = "dns://"
+	// DNSTimeOutDefaultValue is the default per query timeout.
+	DNSTimeOutDefaultValue = 750 * time.Millisecond
+	// DefaultQueryType is the query type used when none is specified.
+	DefaultQueryType = "A"
+	// DNSStatusOK is the map key on success (NOERROR response code).
+	DNSStatusOK = "NOERROR"
+	errTimeout  = errors.New("timeout")
+)
+
+// queryTypes are the supported QueryType values.
+var queryTypes = map[string]dnsmessage.Type{
+	"A":     dnsmessage.TypeA,
+	"AAAA":  dnsmessage.TypeAAAA,
+	"MX":    dnsmessage.TypeMX,
+	"CNAME": dnsmessage.TypeCNAME,
+	"NS":    dnsmessage.TypeNS,
+	"TXT":   dnsmessage.TypeTXT,
+	"SOA":   dnsmessage.TypeSOA,
+	"SRV":   dnsmessage.TypeSRV,
+	"PTR":   dnsmessage.TypePTR,
+}
+
+// rcodeNames are the usual (dig) names of response codes which are used as RetCodes keys.
+var rcodeNames = map[dnsmessage.RCode]string{
+	dnsmessage.RCodeSuccess:        DNSStatusOK,
+	dnsmessage.RCodeFormatError:    "FORMERR",
+	dnsmessage.RCodeServerFailure:  "SERVFAIL",
+	dnsmessage.RCodeNameError:      "NXDOMAIN",
+	dnsmessage.RCodeNotImplemented: "NOTIMP",
+	dnsmessage.RCodeRefused:        "REFUSED",
+}
+
+// RCodeName returns the dig style name of the response code (e.g. NXDOMAIN).
+func RCodeName(rc dnsmessage.RCode) string {
+	if n, found := rcodeNames[rc]; found {
+		return n
+	}
+	return fmt.Sprintf("RCODE%d", rc)
+}
+
+type DNSResultMap map[string]int64
+
+// DNSRunnerResults is the aggregated result of a DNS runner.
+// Also is the internal type used per thread/goroutine.
+type DNSRunnerResults struct {
+	periodic.RunnerResults
+	DNSOptions
+	// Response codes (NOERROR, NXDOMAIN, SERVFAIL...) or errors (timeout...) counts.
+	RetCodes    DNSResultMap
+	SocketCount int
+	// Histogram of the number of answers in the (NOERROR) responses.
+	Answers *stats.HistogramData
+	answers *stats.Histogram
+	client  *DNSClient
+	aborter *periodic.Aborter
+}
+
+// Run does one DNS query. Main call being run at the target QPS.
+// To be set as the Function in RunnerOptions.
+func (dnsstate *DNSRunnerResults) Run(_ context.Context, t periodic.ThreadID) (bool, string) {
+	log.Debugf("Calling in %d", t)
+	rcode, numAnswers, err := dnsstate.client.Query()
+	if err != nil {
+		errStr := err.Error()
+		dnsstate.RetCodes[errStr]++
+		return false, errStr
+	}
+	code := RCodeName(rcode)
+	dnsstate.RetCodes[code]++
+	if rcode != dnsmessage.RCodeSuccess {
+		return false, code
+	}
+	dnsstate.answers.Record(float64(numAnswers))
+	return true, code
+}
+
+// DNSOptions are options to the DNSClient.
+type DNSOptions struct {
+	// Resolver to query, as dns://host[:port][/name] (port defaults to 53).
+	Destination string
+	// A, AAAA, MX,... (defaults to A).
+	QueryType string
+	// Name to lookup, if empty, the path part of the Destination is used.
+	QueryName  string
+	ReqTimeout time.Duration
+}
+
+// RunnerOptions includes the base RunnerOptions plus DNS specific
+// options.
+type RunnerOptions struct {
+	periodic.RunnerOptions
+	DNSOptions
+}
+
+// DNSClient is the client used for DNS load testing.
+type DNSClient struct {
+	buffer      []byte
+	query       []byte
+	dest        net.Addr
+	socket      net.Conn
+	id          uint16
+	socketCount int
+	destination string
+	reqTimeout  time.Duration
+}
+
+// ParseDestination splits a dns://host[:port][/name] destination into the
+// resolver's host:port (with default port 53) and the optional name.
+func ParseDestination(dest string) (string, string) {
+	dest = strings.TrimPrefix(dest, DNSURLPrefix)
+	name := ""
+	if i := strings.Index(dest, "/"); i >= 0 {
+		name = dest[i+1:]
+		dest = dest[:i]
+	}
+	if _, _, err := net.SplitHostPort(dest); err != nil {
+		dest = net.JoinHostPort(strings.Trim(dest, "[]"), "53")
+	}
+	return dest, name
+}
+
+// NewDNSClient creates and initialize and returns a client based on the DNSOptions.
+func NewDNSClient(o *DNSOptions) (*DNSClient, error) {
+	c := DNSClient{}
+	c.destination = o.Destination
+	hostPort, name := ParseDestination(o.Destination)
+	if o.QueryName != "" {
+		name = o.QueryName
+	}
+	if name == "" {
+		return nil, fmt.Errorf("no query name specified for %q", o.Destination)
+	}
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	qName, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query name %q: %w", name, err)
+	}
+	qTypeStr := strings.ToUpper(o.QueryType)
+	if qTypeStr == "" {
+		qTypeStr = DefaultQueryType
+	}
+	qType, found := queryTypes[qTypeStr]
+	if !found {
+		return nil, fmt.Errorf("unsupported query type %q", o.QueryType)
+	}
+	uAddr, err := fnet.UDPResolveDestination(context.Background(), hostPort)
+	if uAddr == nil {
+		return nil, err
+	}
+	c.dest = uAddr
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{RecursionDesired: true},
+		Questions: []dnsmessage.Question{
+			{Name: qName, Type: qType, Class: dnsmessage.ClassINET},
+		},
+	}
+	c.query, err = msg.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("unable to build query for %q: %w", name, err)
+	}
+	c.buffer = make([]byte, 4096) // plenty for non EDNS UDP responses (512)
+	c.reqTimeout = o.ReqTimeout
+	if c.reqTimeout <= 0 {
+		log.Debugf("Request timeout not set, using default %v", DNSTimeOutDefaultValue)
+		c.reqTimeout = DNSTimeOutDefaultValue
+	}
+	return &c, nil
+}
+
+func (c *DNSClient) connect() (net.Conn, error) {
+	c.socketCount++
+	socket, err := net.Dial(c.dest.Network(), c.dest.String())
+	if err != nil {
+		log.Errf("Unable to connect to %v : %v", c.dest, err)
+		return nil, err
+	}
+	return socket, nil
+}
+
+// Query sends the query and waits for the matching response, returning
+// its response code and number of answers.
+func (c *DNSClient) Query() (dnsmessage.RCode, int, error) {
+	conn := c.socket
+	if conn == nil {
+		var err error
+		conn, err = c.connect()
+		if conn == nil {
+			return 0, 0, err
+		}
+		c.socket = conn
+	}
+	c.id++
+	// ID is the first 2 bytes of the query, big endian.
+	c.query[0] = byte(c.id >> 8)
+	c.query[1] = byte(c.id)
+	if err := conn.SetDeadline(time.Now().Add(c.reqTimeout)); err != nil {
+		return 0, 0, err
+	}
+	if _, err := conn.Write(c.query); err != nil {
+		log.Errf("Unable to write to %v : %v", c.dest, err)
+		c.closeSocket()
+		return 0, 0, err
+	}
+	var p dnsmessage.Parser
+	for {
+		n, err := conn.Read(c.buffer)
+		if os.IsTimeout(err) {
+			return 0, 0, errTimeout
+		}
+		if err != nil {
+			log.Errf("Unable to read from %v : %v", c.dest, err)
+			c.closeSocket()
+			return 0, 0, err
+		}
+		h, err := p.Start(c.buffer[:n])
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid response: %w", err)
+		}
+		if h.ID != c.id || !h.Response {
+			// Late response to a previous (timed out) query, keep waiting for ours.
+			log.Debugf("Skipping response id %d while waiting for %d", h.ID, c.id)
+			continue
+		}
+		if err = p.SkipAllQuestions(); err != nil {
+			return 0, 0, fmt.Errorf("invalid response questions: %w", err)
+		}
+		answers, err := p.AllAnswers()
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid response answers: %w", err)
+		}
+		return h.RCode, len(answers), nil
+	}
+}
+
+func (c *DNSClient) closeSocket() {
+	if c.socket != nil {
+		if err := c.socket.Close(); err != nil {
+			log.Warnf("Error closing dns client's socket: %v", err)
+		}
+		c.socket = nil
+	}
+}
+
+// Close closes the last connection and returns the total number of sockets used for the run.
+func (c *DNSClient) Close() int {
+	log.Debugf("Closing %p: %s socket count %d", c, c.destination, c.socketCount)
+	c.closeSocket()
+	return c.socketCount
+}
+
+// RunDNSTest runs a DNS test and returns the aggregated stats.
+func RunDNSTest(o *RunnerOptions) (*DNSRunnerResults, error) {
+	o.RunType = "DNS"
+	log.Infof("Starting dns test for %s %s %s with %d threads at %.1f qps",
+		o.Destination, o.QueryType, o.QueryName, o.NumThreads, o.QPS)
+	r := periodic.NewPeriodicRunner(&o.RunnerOptions)
+	defer r.Options().Abort()
+	numThreads := r.Options().NumThreads
+	out := r.Options().Out // Important as the default value is set from nil to stdout inside NewPeriodicRunner
+	total := DNSRunnerResults{
+		DNSOptions: o.DNSOptions,
+		aborter:    r.Options().Stop,
+		RetCodes:   make(DNSResultMap),
+		answers:    stats.NewHistogram(0, 1),
+	}
+	dnsstate := make([]DNSRunnerResults, numThreads)
+	var err error
+	for i := range numThreads {
+		r.Options().Runners[i] = &dnsstate[i]
+		dnsstate[i].client, err = NewDNSClient(&o.DNSOptions)
+		if dnsstate[i].client == nil {
+			return nil, fmt.Errorf("unable to create client %d for %s: %w", i, o.Destination, err)
+		}
+		if o.Exactly <= 0 {
+			rcode, numAnswers, err := dnsstate[i].client.Query()
+			if i == 0 && log.LogVerbose() {
+				log.LogVf("first query of %s: err %v, rcode %s, answers %d", o.Destination, err, RCodeName(rcode), numAnswers)
+			}
+		}
+		// Set up the stats for each 'thread'
+		dnsstate[i].aborter = total.aborter
+		dnsstate[i].RetCodes = make(DNSResultMap)
+		dnsstate[i].answers = total.answers.Clone()
+	}
+	total.RunnerResults = r.Run()
+	// Numthreads may have reduced, but it should be ok to accumulate 0s from
+	// unused ones. We also must clean up all the created clients.
+	keys := []string{}
+	for i := range numThreads {
+		total.SocketCount += dnsstate[i].client.Close()
+		total.answers.Transfer(dnsstate[i].answers)
+		for k := range dnsstate[i].RetCodes {
+			if _, exists := total.RetCodes[k]; !exists {
+				keys = append(keys, k)
+			}
+			total.RetCodes[k] += dnsstate[i].RetCodes[k]
+		}
+	}
+	// Cleanup state:
+	r.Options().ReleaseRunners()
+	total.Answers = total.answers.Export()
+	totalCount := float64(total.DurationHistogram.Count)
+	_, _ = fmt.Fprintf(out, "Sockets used: %d (for perfect no error run, would be %d)\n", total.SocketCount, r.Options().NumThreads)
+	total.answers.Counter.Print(out, "Answers per response")
+	sort.Strings(keys)
+	for _, k := range keys {
+		_, _ = fmt.Fprintf(out, "dns %s : %d (%.1f %%)\n", k, total.RetCodes[k], 100.*float64(total.RetCodes[k])/totalCount)
+	}
+	return &total, nil
+}
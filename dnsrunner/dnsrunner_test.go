@@ -0,0 +1,148 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dnsrunner
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// testDNSServer answers 2 A records for "ok.fortio.test." and NXDOMAIN for everything else.
+func testDNSServer(t *testing.T) int {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var req dnsmessage.Message
+			if err = req.Unpack(buf[:n]); err != nil || len(req.Questions) != 1 {
+				continue
+			}
+			q := req.Questions[0]
+			resp := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: req.ID, Response: true, RCode: dnsmessage.RCodeNameError},
+				Questions: req.Questions,
+			}
+			if q.Name.String() == "ok.fortio.test." && q.Type == dnsmessage.TypeA {
+				resp.RCode = dnsmessage.RCodeSuccess
+				for i := range 2 {
+					resp.Answers = append(resp.Answers, dnsmessage.Resource{
+						Header: dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: q.Class, TTL: 60},
+						Body:   &dnsmessage.AResource{A: [4]byte{10, 0, 0, byte(i + 1)}},
+					})
+				}
+			}
+			out, _ := resp.Pack()
+			_, _ = conn.WriteTo(out, addr)
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestParseDestination(t *testing.T) {
+	tests := []struct {
+		in, hostPort, name string
+	}{
+		{"dns://8.8.8.8", "8.8.8.8:53", ""},
+		{"dns://8.8.8.8:5353/fortio.org", "8.8.8.8:5353", "fortio.org"},
+		{"dns://[::1]/fortio.org", "[::1]:53", "fortio.org"},
+		{"1.1.1.1:53", "1.1.1.1:53", ""},
+	}
+	for _, tst := range tests {
+		hp, n := ParseDestination(tst.in)
+		if hp != tst.hostPort || n != tst.name {
+			t.Errorf("ParseDestination(%q) got %q, %q expected %q, %q", tst.in, hp, n, tst.hostPort, tst.name)
+		}
+	}
+}
+
+func TestDNSRunner(t *testing.T) {
+	port := testDNSServer(t)
+	opts := RunnerOptions{}
+	opts.QPS = 100
+	opts.Exactly = 20
+	opts.NumThreads = 2
+	opts.Destination = fmt.Sprintf("dns://127.0.0.1:%d/ok.fortio.test", port)
+	res, err := RunDNSTest(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RetCodes[DNSStatusOK] != opts.Exactly {
+		t.Errorf("Expected %d %s got %v", opts.Exactly, DNSStatusOK, res.RetCodes)
+	}
+	if res.Answers.Count != opts.Exactly || res.Answers.Avg != 2 {
+		t.Errorf("Expected 2 answers each time, got %+v", res.Answers)
+	}
+	if res.SocketCount != res.RunnerResults.NumThreads {
+		t.Errorf("%d socket used, expected same as thread# %d", res.SocketCount, res.RunnerResults.NumThreads)
+	}
+	opts.QueryName = "missing.fortio.test"
+	res, err = RunDNSTest(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RetCodes["NXDOMAIN"] != opts.Exactly {
+		t.Errorf("Expected %d NXDOMAIN got %v", opts.Exactly, res.RetCodes)
+	}
+	if res.ErrorsDurationHistogram.Count != opts.Exactly {
+		t.Errorf("NXDOMAIN should count as errors, got %d", res.ErrorsDurationHistogram.Count)
+	}
+}
+
+func TestDNSRunnerBadOptions(t *testing.T) {
+	opts := RunnerOptions{}
+	opts.Destination = "dns://127.0.0.1:1"
+	if _, err := RunDNSTest(&opts); err == nil {
+		t.Errorf("Expected error when no query name is specified")
+	}
+	opts.QueryName = "fortio.org"
+	opts.QueryType = "BOGUS"
+	if _, err := RunDNSTest(&opts); err == nil {
+		t.Errorf("Expected error for invalid query type")
+	}
+}
+
+func TestDNSRunnerTimeout(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0") // never answers
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	opts := RunnerOptions{}
+	opts.QPS = 10
+	opts.Exactly = 2
+	opts.NumThreads = 1
+	opts.ReqTimeout = 50 * time.Millisecond
+	opts.Destination = fmt.Sprintf("dns://%s/fortio.org", conn.LocalAddr().String())
+	res, err := RunDNSTest(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RetCodes["timeout"] != opts.Exactly {
+		t.Errorf("Expected %d timeouts got %v", opts.Exactly, res.RetCodes)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fgrpc // import "fortio.org/fortio/fgrpc"
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/stats"
+)
+
+// compressorName returns the name of the compressor to use for the run, validating
+// it's registered (gzip always is, others like zstd need to be registered with
+// encoding.RegisterCompressor, both on the client and server side).
+func (o *GRPCRunnerOptions) compressorName() (string, error) {
+	name := o.GRPCCompressor
+	if name == "" && o.GrpcCompression {
+		name = gzip.Name
+	}
+	if name != "" && encoding.GetCompressor(name) == nil {
+		return "", fmt.Errorf("grpc compressor %q isn't registered (see encoding.RegisterCompressor)", name)
+	}
+	return name, nil
+}
+
+// bytesCounter is a stats.Handler counting the compressed (on the wire) and uncompressed
+// sizes of the messages sent and received.
+type bytesCounter struct {
+	compressed   atomic.Int64
+	uncompressed atomic.Int64
+}
+
+func (b *bytesCounter) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (b *bytesCounter) HandleRPC(_ context.Context, s stats.RPCStats) {
+	switch p := s.(type) {
+	case *stats.OutPayload:
+		b.compressed.Add(int64(p.CompressedLength))
+		b.uncompressed.Add(int64(p.Length))
+	case *stats.InPayload:
+		b.compressed.Add(int64(p.CompressedLength))
+		b.uncompressed.Add(int64(p.Length))
+	}
+}
+
+func (b *bytesCounter) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (b *bytesCounter) HandleConn(context.Context, stats.ConnStats) {}
+
+// reset zeroes the counters, e.g. after the warmup calls.
+func (b *bytesCounter) reset() {
+	b.compressed.Store(0)
+	b.uncompressed.Store(0)
+}
@@ -21,6 +21,7 @@ import (
 	"os"
 	"runtime"
 	"runtime/pprof"
+	"slices"
 	"strings"
 	"time"
 
@@ -29,19 +30,20 @@ import (
 	"fortio.org/fortio/periodic"
 	"fortio.org/log"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
-	"google.golang.org/grpc/encoding/gzip"
 	"google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/metadata"
+	grpcstatus "google.golang.org/grpc/status"
 )
 
 // Dial dials gRPC using insecure or TLS transport security when serverAddr
-// has prefixHTTPS or cert is provided. If override is set to a non-empty string,
+// has prefixHTTPS or cert (or pins) is provided. If override is set to a non-empty string,
 // it will override the virtual host name of authority in requests.
 func Dial(o *GRPCRunnerOptions) (*grpc.ClientConn, error) {
 	var opts []grpc.DialOption
-	if o.CACert != "" || strings.HasPrefix(o.Destination, fnet.PrefixHTTPS) {
+	if o.CACert != "" || len(o.PinSHA256) > 0 || strings.HasPrefix(o.Destination, fnet.PrefixHTTPS) {
 		tlsConfig, err := o.TLSOptions.TLSConfig()
 		if err != nil {
 			return nil, err
@@ -81,6 +83,15 @@ type GRPCRunnerResults struct {
 	Streams     int
 	Ping        bool
 	Metadata    metadata.MD
+	callOptions []grpc.CallOption
+	// Compressor used (empty for none) and sizes of the messages sent and received, on the wire
+	// (after compression) and before compression.
+	GRPCCompressor         string `json:",omitempty"`
+	CompressedBytesTotal   int64
+	UncompressedBytesTotal int64
+	// Number of calls which failed because they exceeded their deadline (see GRPCRunnerOptions.GRPCCallTimeout).
+	DeadlineExceededCount int64
+	callTimeout           time.Duration
 }
 
 // Run exercises GRPC health check or ping at the target QPS.
@@ -93,11 +104,13 @@ func (grpcstate *GRPCRunnerResults) Run(outCtx context.Context, t periodic.Threa
 	if len(grpcstate.Metadata) != 0 { // filtered one
 		outCtx = metadata.NewOutgoingContext(outCtx, grpcstate.Metadata)
 	}
+	outCtx, cancel := callContext(outCtx, grpcstate.callTimeout)
+	defer cancel()
 	if grpcstate.Ping {
-		res, err = grpcstate.clientP.Ping(outCtx, &grpcstate.reqP)
+		res, err = grpcstate.clientP.Ping(outCtx, &grpcstate.reqP, grpcstate.callOptions...)
 	} else {
 		var r *grpc_health_v1.HealthCheckResponse
-		r, err = grpcstate.clientH.Check(outCtx, &grpcstate.reqH)
+		r, err = grpcstate.clientH.Check(outCtx, &grpcstate.reqH, grpcstate.callOptions...)
 		if r != nil {
 			status = r.GetStatus()
 			res = r
@@ -107,7 +120,11 @@ func (grpcstate *GRPCRunnerResults) Run(outCtx context.Context, t periodic.Threa
 	if err != nil {
 		log.Warnf("Error making grpc call: %v", err)
 		grpcstate.RetCodes[Error]++
-		return false, err.Error()
+		if grpcstatus.Code(err) == codes.DeadlineExceeded {
+			grpcstate.DeadlineExceededCount++
+		}
+		// The status code (e.g. "Unavailable") as details for a bounded number of RunnerResults.ErrorTypes.
+		return false, grpcstatus.Code(err).String()
 	}
 	grpcstate.RetCodes[status.String()]++
 	if status == grpc_health_v1.HealthCheckResponse_SERVING {
@@ -116,6 +133,15 @@ func (grpcstate *GRPCRunnerResults) Run(outCtx context.Context, t periodic.Threa
 	return false, status.String()
 }
 
+// callContext returns the context for a call with a deadline after timeout, when positive,
+// otherwise ctx itself (with a no-op cancel, no need for a new context for each call).
+func callContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return ctx, func() {}
+}
+
 // GRPCRunnerOptions includes the base RunnerOptions plus gRPC specific
 // options.
 type GRPCRunnerOptions struct {
@@ -133,7 +159,13 @@ type GRPCRunnerOptions struct {
 	Metadata           metadata.MD       // input metadata that will be added to the request
 	dialOptions        []grpc.DialOption // gRPC dial options extracted from Metadata (authority and user-agent extracted)
 	filteredMetadata   metadata.MD       // filtered version of Metadata metadata (without authority and user-agent)
-	GrpcCompression    bool              // enable gRPC compression
+	GrpcCompression    bool              // enable gRPC compression (gzip, same as GRPCCompressor "gzip")
+	// Name of the gRPC compressor to use: "" (none, unless GrpcCompression is set), "gzip" or any other
+	// registered with encoding.RegisterCompressor (e.g. "zstd"), on both the client and server sides.
+	GRPCCompressor string
+	// Deadline of each call, propagated to the server, when non-zero. Calls exceeding it fail
+	// with a DEADLINE_EXCEEDED status counted in GRPCRunnerResults.DeadlineExceededCount.
+	GRPCCallTimeout time.Duration
 }
 
 // RunGRPCTest runs an HTTP test and returns the aggregated stats.
@@ -159,30 +191,37 @@ func RunGRPCTest(o *GRPCRunnerOptions) (*GRPCRunnerResults, error) {
 	if pll > 0 {
 		o.RunType += fmt.Sprintf(" PayloadLength=%d", pll)
 	}
-	log.Infof("Starting %s test for %s with %d*%d threads at %.1f qps, compression: %v",
-		o.RunType, o.Destination, o.Streams, o.NumThreads, o.QPS, o.GrpcCompression)
+	compressor, err := o.compressorName()
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Starting %s test for %s with %d*%d threads at %.1f qps, compression: %q",
+		o.RunType, o.Destination, o.Streams, o.NumThreads, o.QPS, compressor)
 	o.NumThreads *= o.Streams
 	r := periodic.NewPeriodicRunner(&o.RunnerOptions)
 	defer r.Options().Abort()
 	numThreads := r.Options().NumThreads // may change
 	o.dialOptions, o.filteredMetadata = extractDialOptionsAndFilter(o.Metadata)
+	counter := &bytesCounter{}
+	// Cloned so the stats handler can't end up in the backing array of a slice shared with other runs.
+	o.dialOptions = append(slices.Clone(o.dialOptions), grpc.WithStatsHandler(counter))
 
 	callOptions := make([]grpc.CallOption, 0)
-	if o.GrpcCompression {
-		callOptions = append(callOptions, grpc.UseCompressor(gzip.Name))
+	if compressor != "" {
+		callOptions = append(callOptions, grpc.UseCompressor(compressor))
 	}
 
 	total := GRPCRunnerResults{
-		RetCodes:    make(HealthResultMap),
-		Destination: o.Destination,
-		Streams:     o.Streams,
-		Ping:        o.UsePing,
-		Metadata:    o.Metadata, // the original one
+		RetCodes:       make(HealthResultMap),
+		Destination:    o.Destination,
+		Streams:        o.Streams,
+		Ping:           o.UsePing,
+		Metadata:       o.Metadata, // the original one
+		GRPCCompressor: compressor,
 	}
 	grpcstate := make([]GRPCRunnerResults, numThreads)
 	out := r.Options().Out // Important as the default value is set from nil to stdout inside NewPeriodicRunner
 	var conn *grpc.ClientConn
-	var err error
 	ts := time.Now().UnixNano()
 	for i := range numThreads {
 		r.Options().Runners[i] = &grpcstate[i]
@@ -197,6 +236,8 @@ func RunGRPCTest(o *GRPCRunnerOptions) (*GRPCRunnerResults, error) {
 			log.Debugf("Reusing previous client connection for %d", i)
 		}
 		grpcstate[i].Ping = o.UsePing
+		grpcstate[i].callOptions = callOptions
+		grpcstate[i].callTimeout = o.GRPCCallTimeout
 		var err error
 		outCtx := context.Background()
 		if o.filteredMetadata.Len() != 0 {
@@ -211,7 +252,9 @@ func RunGRPCTest(o *GRPCRunnerOptions) (*GRPCRunnerResults, error) {
 			}
 			grpcstate[i].reqP = PingMessage{Payload: o.Payload, DelayNanos: o.Delay.Nanoseconds(), Seq: int64(i), Ts: ts}
 			if newConn && o.Exactly <= 0 {
-				_, err = grpcstate[i].clientP.Ping(outCtx, &grpcstate[i].reqP, callOptions...)
+				ctx, cancel := callContext(outCtx, o.GRPCCallTimeout)
+				_, err = grpcstate[i].clientP.Ping(ctx, &grpcstate[i].reqP, callOptions...)
+				cancel()
 			}
 		} else {
 			grpcstate[i].clientH = grpc_health_v1.NewHealthClient(conn)
@@ -220,7 +263,9 @@ func RunGRPCTest(o *GRPCRunnerOptions) (*GRPCRunnerResults, error) {
 			}
 			grpcstate[i].reqH = grpc_health_v1.HealthCheckRequest{Service: o.Service}
 			if newConn && o.Exactly <= 0 {
-				_, err = grpcstate[i].clientH.Check(outCtx, &grpcstate[i].reqH)
+				ctx, cancel := callContext(outCtx, o.GRPCCallTimeout)
+				_, err = grpcstate[i].clientH.Check(ctx, &grpcstate[i].reqH, callOptions...)
+				cancel()
 			}
 		}
 		if !o.AllowInitialErrors && err != nil {
@@ -241,7 +286,10 @@ func RunGRPCTest(o *GRPCRunnerOptions) (*GRPCRunnerResults, error) {
 			log.Critf("Unable to start cpu profile: %v", err)
 		}
 	}
+	counter.reset() // don't count the warmup calls
 	total.RunnerResults = r.Run()
+	total.CompressedBytesTotal = counter.compressed.Load()
+	total.UncompressedBytesTotal = counter.uncompressed.Load()
 	if o.Profiler != "" {
 		pprof.StopCPUProfile()
 		fm, err := os.Create(o.Profiler + ".mem")
@@ -267,6 +315,7 @@ func RunGRPCTest(o *GRPCRunnerOptions) (*GRPCRunnerResults, error) {
 			}
 			total.RetCodes[k] += grpcstate[i].RetCodes[k]
 		}
+		total.DeadlineExceededCount += grpcstate[i].DeadlineExceededCount
 		// TODO: if gRPC client needs 'cleanup'/Close like HTTP one, do it on original NumThreads
 	}
 	// Cleanup state:
@@ -279,9 +328,21 @@ func RunGRPCTest(o *GRPCRunnerOptions) (*GRPCRunnerResults, error) {
 	for _, k := range keys {
 		_, _ = fmt.Fprintf(out, "%s %s : %d\n", which, k, total.RetCodes[k])
 	}
+	if o.GRPCCallTimeout > 0 {
+		_, _ = fmt.Fprintf(out, "Calls exceeding the %v deadline: %d\n", o.GRPCCallTimeout, total.DeadlineExceededCount)
+	}
+	if compressor != "" {
+		_, _ = fmt.Fprintf(out, "Compression %s: %d bytes on the wire for %d uncompressed\n",
+			compressor, total.CompressedBytesTotal, total.UncompressedBytesTotal)
+	}
 	return &total, nil
 }
 
+// Destination returns the host:port the gRPC runner connects to for dest (see grpcDestination).
+func Destination(dest string) string {
+	return grpcDestination(dest)
+}
+
 // grpcDestination parses dest and returns dest:port based on dest being
 // a hostname, IP address, hostname:port, or ip:port. The original dest is
 // returned if dest is an invalid hostname or invalid IP address. An http/https
@@ -16,9 +16,13 @@
 package fgrpc
 
 import (
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"net"
+	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -219,6 +223,97 @@ func TestGRPCRunnerMaxStreams(t *testing.T) {
 	}
 }
 
+func TestGRPCCompressor(t *testing.T) {
+	port := PingServerTCP("0", "", 0, noTLSO)
+	destination := fmt.Sprintf("localhost:%d", port)
+	opts := GRPCRunnerOptions{
+		RunnerOptions: periodic.RunnerOptions{
+			QPS:     100,
+			Exactly: 10,
+		},
+		Destination: destination,
+		UsePing:     true,
+		Payload:     strings.Repeat("compress me ", 100),
+	}
+	o := opts
+	res, err := RunGRPCTest(&o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.GRPCCompressor != "" || res.CompressedBytesTotal != res.UncompressedBytesTotal || res.UncompressedBytesTotal < 2*10*1200 {
+		t.Errorf("Expected no compression, got %q %d %d", res.GRPCCompressor, res.CompressedBytesTotal, res.UncompressedBytesTotal)
+	}
+	o = opts
+	o.GRPCCompressor = "gzip"
+	res, err = RunGRPCTest(&o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.GRPCCompressor != "gzip" || res.CompressedBytesTotal == 0 || 4*res.CompressedBytesTotal > res.UncompressedBytesTotal {
+		t.Errorf("Expected gzip compression, got %q %d %d", res.GRPCCompressor, res.CompressedBytesTotal, res.UncompressedBytesTotal)
+	}
+	o = opts
+	o.GRPCCompressor = "not-registered"
+	if _, err = RunGRPCTest(&o); err == nil {
+		t.Errorf("Expected error for unregistered compressor")
+	}
+}
+
+func TestGRPCCallTimeout(t *testing.T) {
+	parent := context.Background()
+	ctx, cancel := callContext(parent, 0)
+	cancel()
+	if ctx != parent || ctx.Err() != nil {
+		t.Errorf("Expected the parent context without timeout, got %v", ctx)
+	}
+	port := PingServerTCP("0", "", 0, noTLSO)
+	destination := fmt.Sprintf("localhost:%d", port)
+	opts := GRPCRunnerOptions{
+		RunnerOptions: periodic.RunnerOptions{
+			QPS:     -1,
+			Exactly: 4,
+		},
+		Destination:     destination,
+		UsePing:         true,
+		Delay:           100 * time.Millisecond,
+		GRPCCallTimeout: 20 * time.Millisecond,
+	}
+	o := opts
+	res, err := RunGRPCTest(&o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.DeadlineExceededCount != 4 || res.RetCodes[Error] != 4 {
+		t.Errorf("Expected 4 deadline exceeded errors, got %d %v", res.DeadlineExceededCount, res.RetCodes)
+	}
+	if res.DurationHistogram.Max > opts.Delay.Seconds() {
+		t.Errorf("Calls should have timed out before the %v delay, max %v", opts.Delay, res.DurationHistogram.Max)
+	}
+	o = opts
+	o.GRPCCallTimeout = time.Second
+	res, err = RunGRPCTest(&o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.DeadlineExceededCount != 0 || res.RetCodes[grpc_health_v1.HealthCheckResponse_SERVING.String()] != 4 {
+		t.Errorf("Expected no deadline exceeded errors, got %d %v", res.DeadlineExceededCount, res.RetCodes)
+	}
+	// The initial (warmup) calls also time out:
+	o = opts
+	o.Exactly = 0
+	o.Duration = 100 * time.Millisecond
+	if _, err = RunGRPCTest(&o); err == nil {
+		t.Errorf("Expected deadline exceeded error for the initial call")
+	}
+	o = opts
+	o.Exactly = 0
+	o.Duration = 100 * time.Millisecond
+	o.AllowInitialErrors = true
+	if res, err = RunGRPCTest(&o); err != nil || res.DeadlineExceededCount == 0 {
+		t.Errorf("Expected deadline exceeded errors not to be fatal with AllowInitialErrors, got %v %v", res, err)
+	}
+}
+
 func TestGRPCRunnerWithError(t *testing.T) {
 	log.SetLogLevel(log.Info)
 	iPort := PingServerTCP("0", "bar", 0, noTLSO)
@@ -309,6 +404,14 @@ func TestGRPCRunnerWithError(t *testing.T) {
 			t.Errorf("Test case: %s failed. Mismatch between requests %d and errors %v",
 				test.name, totalReq, res.RetCodes)
 		}
+		if len(res.ErrorTypes) == 0 {
+			t.Errorf("Test case: %s missing error types", test.name)
+		}
+		for errType := range res.ErrorTypes {
+			if strings.HasPrefix(errType, "Code(") || strings.Contains(errType, " ") {
+				t.Errorf("Test case: %s unexpected error type %q, not a grpc status code", test.name, errType)
+			}
+		}
 	}
 }
 
@@ -563,3 +666,41 @@ func TestHeaderHandling(t *testing.T) {
 		})
 	}
 }
+
+func TestGRPCCertPinning(t *testing.T) {
+	log.SetLogLevel(log.Info)
+	sPort := PingServerTCP("0", "pin", 0, tlsO)
+	sDest := fmt.Sprintf("localhost:%d", sPort)
+	pemData, err := os.ReadFile(svrCrt)
+	if err != nil {
+		t.Fatalf("Unable to read %s: %v", svrCrt, err)
+	}
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		t.Fatalf("Unable to decode pem from %s", svrCrt)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("Unable to parse %s: %v", svrCrt, err)
+	}
+	goodPin := fhttp.SPKISHA256(cert)
+	badPin := "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="
+	ro := periodic.RunnerOptions{QPS: 10, Duration: 200 * time.Millisecond}
+	tests := []struct {
+		name   string
+		tlsO   fhttp.TLSOptions
+		expect bool
+	}{
+		{"matching pin", fhttp.TLSOptions{CACert: caCrt, PinSHA256: []string{badPin, goodPin}}, true},
+		{"no matching pin with valid chain", fhttp.TLSOptions{CACert: caCrt, PinSHA256: []string{badPin}}, false},
+		{"matching pin, insecure", fhttp.TLSOptions{Insecure: true, PinSHA256: []string{goodPin}}, true},
+		{"no matching pin, insecure", fhttp.TLSOptions{Insecure: true, PinSHA256: []string{badPin}}, false},
+	}
+	for _, test := range tests {
+		o := GRPCRunnerOptions{RunnerOptions: ro, Destination: sDest, TLSOptions: test.tlsO}
+		_, err := RunGRPCTest(&o)
+		if (err == nil) != test.expect {
+			t.Errorf("Test case %q: expected success %v, got err %v", test.name, test.expect, err)
+		}
+	}
+}
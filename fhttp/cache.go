@@ -0,0 +1,66 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp // import "fortio.org/fortio/fhttp"
+
+import (
+	"net/http"
+
+	"fortio.org/log"
+)
+
+// Response validator headers searched (case insensitively) by the fast client.
+var (
+	etagHeader         = []byte("\r\nETag:")
+	lastModifiedHeader = []byte("\r\nLast-Modified:")
+)
+
+// isOK is codeIsOK but also accepting 304 Not Modified when doing cache validation.
+func isOK(code int, cacheValidation bool) bool {
+	return codeIsOK(code) || (cacheValidation && code == http.StatusNotModified)
+}
+
+// cacheState is the per client conditional requests state (see HTTPOptions.CacheValidation).
+type cacheState struct {
+	enabled bool // HTTPOptions.CacheValidation
+	stored  bool // validator already stored (from the first response having one)
+}
+
+// ok returns whether the code is a success, including 304 when cache validation is enabled.
+func (s *cacheState) ok(code int) bool {
+	return isOK(code, s.enabled)
+}
+
+// needed returns true if the response validator still needs to be looked for.
+func (s *cacheState) needed(code int) bool {
+	return s.enabled && !s.stored && codeIsOK(code)
+}
+
+// conditionalHeader returns the conditional request header to send for the response validators,
+// If-None-Match for the etag in priority, or If-Modified-Since, empty name if neither is set.
+func (s *cacheState) conditionalHeader(etag, lastModified string, id int, runID int64) (string, string) {
+	var name, value string
+	switch {
+	case etag != "":
+		name, value = "If-None-Match", etag
+	case lastModified != "":
+		name, value = "If-Modified-Since", lastModified
+	default:
+		return "", ""
+	}
+	s.stored = true
+	log.S(log.Info, "Cache validation: sending conditional requests", log.Str(name, value),
+		log.Attr("thread", id), log.Attr("run", runID))
+	return name, value
+}
@@ -0,0 +1,117 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp // import "fortio.org/fortio/fhttp"
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"fortio.org/log"
+)
+
+// certRotator holds the latest certificate loaded from its cert and key files,
+// reloaded every interval by a background goroutine until its last user releases it.
+type certRotator struct {
+	key               string
+	certFile, keyFile string
+	interval          time.Duration
+	cert              atomic.Value  // *tls.Certificate
+	refs              int           // number of users, under certRotatorsMutex
+	done              chan struct{} // closed to stop the goroutine
+}
+
+var (
+	certRotatorsMutex sync.Mutex
+	// Rotators are shared by all the TLS configs (i.e. all the clients) using the same files and
+	// interval, so there is one goroutine per distinct rotation in use.
+	certRotators = make(map[string]*certRotator)
+)
+
+// getCertRotator returns the rotator for the cert and key files, loading them and starting
+// the reloading goroutine if it's the first use of that combination. The caller must call
+// release when done with it.
+func getCertRotator(certFile, keyFile string, interval time.Duration) (*certRotator, error) {
+	key := fmt.Sprintf("%s\x00%s\x00%v", certFile, keyFile, interval)
+	certRotatorsMutex.Lock()
+	defer certRotatorsMutex.Unlock()
+	if r, found := certRotators[key]; found {
+		r.refs++
+		return r, nil
+	}
+	r := &certRotator{key: key, certFile: certFile, keyFile: keyFile, interval: interval, refs: 1, done: make(chan struct{})}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	certRotators[key] = r
+	go r.run()
+	return r, nil
+}
+
+// release stops the reloading goroutine when called by the last user of the rotator.
+func (r *certRotator) release() {
+	certRotatorsMutex.Lock()
+	defer certRotatorsMutex.Unlock()
+	r.refs--
+	if r.refs > 0 {
+		return
+	}
+	delete(certRotators, r.key)
+	close(r.done)
+}
+
+func (r *certRotator) load() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert.Store(&cert)
+	return nil
+}
+
+func (r *certRotator) run() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			log.LogVf("Certificate rotation: stopped for cert %v / key %v", r.certFile, r.keyFile)
+			return
+		case <-ticker.C:
+		}
+		if err := r.load(); err != nil {
+			log.Errf("Certificate rotation: unable to reload cert %v / key %v, keeping the previous one: %v",
+				r.certFile, r.keyFile, err)
+			continue
+		}
+		log.LogVf("Certificate rotation: reloaded cert %v / key %v", r.certFile, r.keyFile)
+	}
+}
+
+func (r *certRotator) certificate() *tls.Certificate {
+	return r.cert.Load().(*tls.Certificate)
+}
+
+// GetClientCertificate is the tls.Config callback for clients, called on each handshake.
+func (r *certRotator) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.certificate(), nil
+}
+
+// GetCertificate is the tls.Config callback for servers, called on each handshake.
+func (r *certRotator) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.certificate(), nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp // import "fortio.org/fortio/fhttp"
+
+import (
+	"time"
+
+	"fortio.org/log"
+)
+
+// circuitBreaker is the per (std) client circuit breaker state (see HTTPOptions.CircuitBreakerThreshold).
+// Clients are used by a single goroutine so there is no locking.
+type circuitBreaker struct {
+	threshold float64       // HTTPOptions.CircuitBreakerThreshold, 0 (or window 0) is disabled
+	cooldown  time.Duration // HTTPOptions.CircuitBreakerCooldown
+	outcomes  []bool        // ring buffer of the last window requests, true for failures
+	next      int           // next index in outcomes to write to
+	count     int           // number of valid entries in outcomes (< window until it's full)
+	failures  int           // number of true entries in outcomes
+	open      bool
+	openedAt  time.Time
+	probing   bool // half-open: the single probe request is in flight
+}
+
+func newCircuitBreaker(o *HTTPOptions) circuitBreaker {
+	cb := circuitBreaker{threshold: o.CircuitBreakerThreshold, cooldown: o.CircuitBreakerCooldown}
+	if cb.threshold > 0 && o.CircuitBreakerWindow > 0 {
+		cb.outcomes = make([]bool, o.CircuitBreakerWindow)
+	}
+	return cb
+}
+
+func (cb *circuitBreaker) enabled() bool {
+	return cb.outcomes != nil
+}
+
+// allow returns whether a request can be attempted: always when closed, never while open during the
+// cooldown and, after it, once (half-open) until the outcome of that probe request is recorded.
+func (cb *circuitBreaker) allow(id int, runID int64) bool {
+	if !cb.open {
+		return true
+	}
+	if cb.probing || time.Since(cb.openedAt) < cb.cooldown {
+		return false
+	}
+	cb.probing = true
+	log.S(log.Info, "Circuit breaker half-open, sending probe request", log.Attr("thread", id), log.Attr("run", runID))
+	return true
+}
+
+// record adds the outcome of a request, opening the circuit when the window is full and at least
+// the threshold fraction of it failed. The outcome of the half-open probe closes or re-opens it.
+func (cb *circuitBreaker) record(failed bool, id int, runID int64) {
+	if !cb.enabled() {
+		return
+	}
+	if cb.probing {
+		cb.probing = false
+		if failed {
+			cb.openedAt = time.Now()
+			log.S(log.Warning, "Circuit breaker probe failed, staying open", log.Attr("thread", id), log.Attr("run", runID))
+			return
+		}
+		cb.open = false
+		cb.reset()
+		log.S(log.Info, "Circuit breaker closed", log.Attr("thread", id), log.Attr("run", runID))
+		return
+	}
+	if cb.count == len(cb.outcomes) {
+		if cb.outcomes[cb.next] {
+			cb.failures--
+		}
+	} else {
+		cb.count++
+	}
+	cb.outcomes[cb.next] = failed
+	if failed {
+		cb.failures++
+	}
+	cb.next = (cb.next + 1) % len(cb.outcomes)
+	if cb.count < len(cb.outcomes) {
+		return
+	}
+	if rate := float64(cb.failures) / float64(cb.count); rate >= cb.threshold {
+		cb.open = true
+		cb.openedAt = time.Now()
+		log.S(log.Warning, "Circuit breaker open", log.Attr("error-rate", rate), log.Attr("window", cb.count),
+			log.Str("cooldown", cb.cooldown.String()), log.Attr("thread", id), log.Attr("run", runID))
+	}
+}
+
+// reset clears the recent outcomes.
+func (cb *circuitBreaker) reset() {
+	clear(cb.outcomes)
+	cb.next = 0
+	cb.count = 0
+	cb.failures = 0
+}
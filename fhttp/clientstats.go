@@ -0,0 +1,99 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp // import "fortio.org/fortio/fhttp"
+
+// clientStats are the response statistics of a client (or, merged, of all the clients of a run)
+// beyond the return codes and sizes.
+type clientStats struct {
+	hstsDetected      bool
+	forbiddenHeaders  int64
+	webSocketUpgrades int64
+	preloadLinkCount  int64 // std client only.
+	resetRetries      int64 // std client only.
+	preflightCount    int64 // std client only.
+	preflightErrors   int64 // std client only.
+	dedupMismatches   int64
+	serverTiming      *serverTimingState
+	tcpInfo           *tcpInfoState // fast client only.
+}
+
+// clientStatsReporter is implemented by both clients.
+type clientStatsReporter interface {
+	responseStats() clientStats
+}
+
+func (c *Client) responseStats() clientStats {
+	s := clientStats{
+		hstsDetected:      c.hsts.detected,
+		forbiddenHeaders:  c.forbidden.count,
+		webSocketUpgrades: c.wsUpgrades.count,
+		preloadLinkCount:  c.preload.count,
+		resetRetries:      c.resetRetries,
+		dedupMismatches:   c.dedup.mismatches,
+		serverTiming:      &c.serverTiming,
+	}
+	if c.cors != nil {
+		s.preflightCount, s.preflightErrors = c.cors.count, c.cors.errors
+	}
+	return s
+}
+
+func (c *FastClient) responseStats() clientStats {
+	return clientStats{
+		hstsDetected:      c.hsts.detected,
+		forbiddenHeaders:  c.forbidden.count,
+		webSocketUpgrades: c.wsUpgrades.count,
+		dedupMismatches:   c.dedup.mismatches,
+		serverTiming:      &c.serverTiming,
+		tcpInfo:           &c.tcpInfo,
+	}
+}
+
+// newRunStats returns the (empty) clientStats the clients' ones are merged into.
+func newRunStats(o *HTTPRunnerOptions) clientStats {
+	serverTiming := newServerTimingState(&o.HTTPOptions)
+	tcpInfo := newTCPInfoState(o.TCPInfo)
+	return clientStats{serverTiming: &serverTiming, tcpInfo: &tcpInfo}
+}
+
+// merge adds the statistics of a client to s (from newRunStats).
+func (s *clientStats) merge(c clientStats) {
+	s.hstsDetected = s.hstsDetected || c.hstsDetected
+	s.forbiddenHeaders += c.forbiddenHeaders
+	s.webSocketUpgrades += c.webSocketUpgrades
+	s.preloadLinkCount += c.preloadLinkCount
+	s.resetRetries += c.resetRetries
+	s.preflightCount += c.preflightCount
+	s.preflightErrors += c.preflightErrors
+	s.dedupMismatches += c.dedupMismatches
+	if c.serverTiming != nil {
+		s.serverTiming.merge(c.serverTiming)
+	}
+	if c.tcpInfo != nil {
+		s.tcpInfo.merge(c.tcpInfo)
+	}
+}
+
+// addTo sets the counts of the run's results.
+func (s *clientStats) addTo(total *HTTPRunnerResults) {
+	total.HSTSDetected = total.HSTSDetected || s.hstsDetected
+	total.ForbiddenHeaderCount += s.forbiddenHeaders
+	total.WebSocketUpgradeCount += s.webSocketUpgrades
+	total.PreloadLinkCount += s.preloadLinkCount
+	total.ResetRetries += s.resetRetries
+	total.PreflightCount += s.preflightCount
+	total.PreflightErrors += s.preflightErrors
+	total.DedupMismatches += s.dedupMismatches
+}
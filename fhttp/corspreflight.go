@@ -0,0 +1,132 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp // import "fortio.org/fortio/fhttp"
+
+import (
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"fortio.org/log"
+)
+
+const (
+	// defaultCORSMaxAge is how long preflight responses without Access-Control-Max-Age are cached (per the fetch spec).
+	defaultCORSMaxAge = 5 * time.Second
+	// maxCORSCacheEntries bounds the cache, e.g. for urls with {uuid}, it is cleared when reached.
+	maxCORSCacheEntries = 10000
+)
+
+// corsPreflightCache is the per client CORS preflight state: like browsers, an OPTIONS preflight request
+// is sent before a request unless a previous preflight for that url is cached (for its Access-Control-Max-Age).
+type corsPreflightCache struct {
+	expiry         map[string]time.Time // url -> end of validity of its cached preflight
+	requestHeaders string               // Access-Control-Request-Headers of the preflights
+	count          int64
+	errors         int64
+}
+
+func newCORSPreflightCache(h http.Header) *corsPreflightCache {
+	return &corsPreflightCache{expiry: make(map[string]time.Time), requestHeaders: corsRequestHeaders(h)}
+}
+
+// corsRequestHeaders returns the sorted lowercase names of the headers of h which need the server's approval,
+// i.e. except the CORS safelisted ones and the ones set by browsers themselves.
+func corsRequestHeaders(h http.Header) string {
+	var names []string
+	for name := range h {
+		switch strings.ToLower(name) {
+		case "accept", "accept-language", "content-language", "origin", "host", "user-agent", "content-length":
+			continue
+		case "content-type":
+			ct, _, _ := strings.Cut(strings.ToLower(h.Get(name)), ";")
+			ct = strings.TrimSpace(ct)
+			if ct == "application/x-www-form-urlencoded" || ct == "multipart/form-data" || ct == "text/plain" {
+				continue
+			}
+		}
+		names = append(names, strings.ToLower(name))
+	}
+	slices.Sort(names)
+	return strings.Join(names, ",")
+}
+
+// corsMaxAge parses the Access-Control-Max-Age header value, 0 for invalid or negative ones (no caching).
+func corsMaxAge(value string) time.Duration {
+	if value == "" {
+		return defaultCORSMaxAge
+	}
+	seconds, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// preflight sends the CORS preflight request for req, unless a previous one for the same url is still cached.
+// Failures are counted (and logged the first time) but don't prevent sending req.
+func (p *corsPreflightCache) preflight(client *http.Client, req *http.Request, id int, runID int64) {
+	url := req.URL.String()
+	now := time.Now()
+	if exp, found := p.expiry[url]; found && now.Before(exp) {
+		return
+	}
+	p.count++
+	pr, err := http.NewRequestWithContext(req.Context(), http.MethodOptions, url, nil)
+	if err != nil {
+		p.failed(url, err.Error(), id, runID)
+		return
+	}
+	pr.Host = req.Host
+	pr.Header.Set("Origin", req.Header.Get("Origin"))
+	pr.Header.Set("User-Agent", req.Header.Get("User-Agent"))
+	pr.Header.Set("Access-Control-Request-Method", req.Method)
+	if p.requestHeaders != "" {
+		pr.Header.Set("Access-Control-Request-Headers", p.requestHeaders)
+	}
+	resp, err := client.Do(pr)
+	if err != nil {
+		p.failed(url, err.Error(), id, runID)
+		return
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 || resp.Header.Get("Access-Control-Allow-Origin") == "" {
+		p.failed(url, "status "+resp.Status+", allow origin "+strconv.Quote(resp.Header.Get("Access-Control-Allow-Origin")), id, runID)
+		delete(p.expiry, url)
+		return
+	}
+	maxAge := corsMaxAge(resp.Header.Get("Access-Control-Max-Age"))
+	if maxAge == 0 {
+		delete(p.expiry, url)
+		return
+	}
+	if len(p.expiry) >= maxCORSCacheEntries {
+		clear(p.expiry)
+	}
+	p.expiry[url] = now.Add(maxAge)
+}
+
+// failed counts (and logs the first time) a failed preflight.
+func (p *corsPreflightCache) failed(url, reason string, id int, runID int64) {
+	p.errors++
+	if p.errors == 1 {
+		log.S(log.Warning, "CORS preflight failed", log.Str("url", url), log.Str("reason", reason),
+			log.Attr("thread", id), log.Attr("run", runID))
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp // import "fortio.org/fortio/fhttp"
+
+import (
+	"sync/atomic"
+
+	"fortio.org/log"
+)
+
+// DefaultFingerprintHeader is the response header compared by DetectDedup when FingerprintHeader isn't set.
+const DefaultFingerprintHeader = "ETag"
+
+// dedupState is the per client response fingerprint state: the fingerprint header value of the
+// first response having one, shared with the other clients of the run, which the following responses'
+// values are compared to.
+type dedupState struct {
+	header     string // empty when not detecting
+	rawHeader  []byte // CRLF prefixed, colon terminated header searched by the fast client
+	first      *atomic.Pointer[string]
+	mismatches int64
+}
+
+func newDedupState(o *HTTPOptions) dedupState {
+	if !o.DetectDedup {
+		return dedupState{}
+	}
+	header := o.FingerprintHeader
+	if header == "" {
+		header = DefaultFingerprintHeader
+	}
+	first := o.dedupFirst
+	if first == nil { // standalone client.
+		first = new(atomic.Pointer[string])
+	}
+	return dedupState{header: header, rawHeader: []byte("\r\n" + header + ":"), first: first}
+}
+
+// check compares the fingerprint value of a response (empty when the header is missing, then ignored)
+// to the first one of the run, counting (and logging the first) mismatches.
+func (d *dedupState) check(value, url string, id int, runID int64) {
+	if value == "" {
+		return
+	}
+	first := d.first.Load()
+	if first == nil {
+		if d.first.CompareAndSwap(nil, &value) {
+			log.LogVf("[%d] Fingerprint %s: %s", id, d.header, value)
+			return
+		}
+		first = d.first.Load() // set concurrently by another client.
+	}
+	if value == *first {
+		return
+	}
+	d.mismatches++
+	if d.mismatches == 1 {
+		log.S(log.Warning, "Different response fingerprint for the same request", log.Str("header", d.header),
+			log.Str("first", *first), log.Str("value", value), log.Str("url", url),
+			log.Attr("thread", id), log.Attr("run", runID))
+	}
+}
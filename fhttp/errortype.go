@@ -0,0 +1,133 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp // import "fortio.org/fortio/fhttp"
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// Error types, the details of failed requests (and keys of periodic.RunnerResults.ErrorTypes)
+// when no HTTP status was received. Otherwise the details are the HTTP status code, e.g. "503".
+const (
+	ErrorTypeDNS               = "dns"
+	ErrorTypeConnectionRefused = "connection refused"
+	ErrorTypeConnectionReset   = "connection reset"
+	ErrorTypeTimeout           = "timeout"
+	ErrorTypeTLS               = "tls"
+	ErrorTypeEOF               = "eof"
+	ErrorTypeCircuitOpen       = "circuit open"
+	ErrorTypeSocket            = "socket error"
+)
+
+// errorTyper is implemented by both clients and returns the error type of the last StreamFetch,
+// empty when it didn't fail with a transport error.
+type errorTyper interface {
+	lastErrorType() string
+}
+
+// ErrorType classifies a transport error into one of the ErrorType* constants.
+func ErrorType(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var recordErr tls.RecordHeaderError
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	switch {
+	case errors.As(err, &dnsErr):
+		return ErrorTypeDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrorTypeConnectionRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return ErrorTypeConnectionReset
+	case errors.Is(err, os.ErrDeadlineExceeded), errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorTypeTimeout
+	case errors.As(err, &recordErr), errors.As(err, &certErr), errors.As(err, &unknownAuthErr),
+		errors.As(err, &hostnameErr):
+		return ErrorTypeTLS
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrorTypeEOF
+	default:
+		return ErrorTypeSocket
+	}
+}
+
+// errorDetails returns the Run() details for code: the HTTP status or, for transport errors,
+// the error type recorded by the client when it has one.
+func errorDetails(client Fetcher, code int) string {
+	if code < 0 {
+		if t, ok := client.(errorTyper); ok {
+			if errType := t.lastErrorType(); errType != "" {
+				return errType
+			}
+		}
+	}
+	return strconv.Itoa(code)
+}
+
+// socketErrorCode returns the more specific SocketErrorReset, SocketErrorRefused or SocketErrorTimeout
+// code of a SocketError when the client's last error is of that type, 0 otherwise.
+func socketErrorCode(client Fetcher, code int) int {
+	if code != SocketError {
+		return 0
+	}
+	t, ok := client.(errorTyper)
+	if !ok {
+		return 0
+	}
+	switch t.lastErrorType() {
+	case ErrorTypeConnectionReset:
+		return SocketErrorReset
+	case ErrorTypeConnectionRefused:
+		return SocketErrorRefused
+	case ErrorTypeTimeout:
+		return SocketErrorTimeout
+	default:
+		return 0
+	}
+}
+
+// CodeName returns a readable name for the negative (non HTTP status) codes, empty for the other ones.
+func CodeName(code int) string {
+	switch code {
+	case SocketError:
+		return ErrorTypeSocket
+	case SocketErrorReset:
+		return ErrorTypeConnectionReset
+	case SocketErrorRefused:
+		return ErrorTypeConnectionRefused
+	case SocketErrorTimeout:
+		return ErrorTypeTimeout
+	default:
+		return ""
+	}
+}
+
+func (c *Client) lastErrorType() string {
+	return c.errType
+}
+
+func (c *FastClient) lastErrorType() string {
+	return c.errType
+}
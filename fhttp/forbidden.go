@@ -0,0 +1,68 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp // import "fortio.org/fortio/fhttp"
+
+import (
+	"bytes"
+	"net/http"
+	"slices"
+	"strings"
+
+	"fortio.org/log"
+)
+
+// forbiddenHeadersState is the per client forbidden response headers detection state.
+type forbiddenHeadersState struct {
+	names []string // HTTPOptions.ForbiddenResponseHeaders
+	count int64    // responses with at least one of the names
+}
+
+// isForbidden returns true if name is one of the forbidden header names (case insensitively).
+func (f *forbiddenHeadersState) isForbidden(name string) bool {
+	return slices.ContainsFunc(f.names, func(n string) bool {
+		return strings.EqualFold(n, name)
+	})
+}
+
+// found counts (and logs the first time) a response with the forbidden header name.
+func (f *forbiddenHeadersState) found(name, url string, id int, runID int64) {
+	f.count++
+	if f.count == 1 {
+		log.S(log.Warning, "Server replied with a forbidden header", log.Str("header", name), log.Str("url", url),
+			log.Attr("thread", id), log.Attr("run", runID))
+	}
+}
+
+// checkHeader checks the std client response headers.
+func (f *forbiddenHeadersState) checkHeader(h http.Header, url string, id int, runID int64) {
+	for name := range h {
+		if f.isForbidden(name) {
+			f.found(name, url, id, runID)
+			return
+		}
+	}
+}
+
+// checkRaw checks the raw (status line and CRLF separated) response headers of the fast client.
+func (f *forbiddenHeadersState) checkRaw(headers []byte, url string, id int, runID int64) {
+	lines := bytes.Split(headers, []byte("\r\n"))
+	for _, line := range lines[1:] { // skip the status line
+		name, _, found := bytes.Cut(line, []byte(":"))
+		if found && f.isForbidden(string(bytes.TrimSpace(name))) {
+			f.found(string(name), url, id, runID)
+			return
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp // import "fortio.org/fortio/fhttp"
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"fortio.org/log"
+)
+
+// DefaultGeoAPIURL is the geolocation service queried when HTTPOptions.AnnotateGeo is set
+// without a GeoAPIURL. It must return a JSON object with the region and country of the caller's IP.
+const DefaultGeoAPIURL = "https://ipinfo.io/json"
+
+// geoInfo is the subset of the fields returned by the common IP geolocation services
+// (ipinfo.io uses region/country, ip-api.com regionName/countryCode...).
+type geoInfo struct {
+	Region      string `json:"region"`
+	RegionName  string `json:"regionName"`
+	Country     string `json:"country"`
+	CountryCode string `json:"countryCode"`
+}
+
+// String returns the "region, country" of the geo info, using whichever fields are set.
+func (g *geoInfo) String() string {
+	parts := make([]string, 0, 2)
+	for _, v := range [][2]string{{g.Region, g.RegionName}, {g.Country, g.CountryCode}} {
+		if v[0] == "" {
+			v[0] = v[1]
+		}
+		if v[0] != "" {
+			parts = append(parts, v[0])
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// geoLookup queries the source region only once per run (even if requested by multiple goroutines).
+type geoLookup struct {
+	once   sync.Once
+	url    string
+	region string
+}
+
+// get returns the source region, doing the lookup the first time it's called.
+func (g *geoLookup) get() string {
+	g.once.Do(func() {
+		g.region = GeoRegion(g.url)
+	})
+	return g.region
+}
+
+// GeoRegion returns the "region, country" of the source IP as returned by the JSON geolocation
+// service at url (DefaultGeoAPIURL when empty), or an empty string if the lookup fails.
+func GeoRegion(url string) string {
+	if url == "" {
+		url = DefaultGeoAPIURL
+	}
+	var buf bytes.Buffer
+	code := StreamURL(url, &buf)
+	if code != http.StatusOK {
+		log.S(log.Warning, "Geo lookup failed", log.Str("url", url), log.Attr("code", code))
+		return ""
+	}
+	var info geoInfo
+	if err := json.Unmarshal(buf.Bytes(), &info); err != nil {
+		log.S(log.Warning, "Geo lookup invalid response", log.Str("url", url), log.Attr("err", err))
+		return ""
+	}
+	region := info.String()
+	log.S(log.Info, "Geo lookup", log.Str("url", url), log.Str("region", region))
+	return region
+}
@@ -0,0 +1,66 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp // import "fortio.org/fortio/fhttp"
+
+import (
+	"strconv"
+	"strings"
+
+	"fortio.org/log"
+)
+
+// hstsHeader is the Strict-Transport-Security header searched (case insensitively) by the fast client.
+var hstsHeader = []byte("\r\nStrict-Transport-Security:")
+
+// hstsState is the per client HSTS detection state.
+type hstsState struct {
+	detect   bool // HTTPOptions.DetectHSTS
+	insecure bool // TLSOptions.Insecure, to warn the server enforces HSTS
+	detected bool // sticky once a response had HSTS with a positive max-age
+}
+
+// HSTSMaxAge returns the max-age directive of a Strict-Transport-Security header value, -1 if missing or invalid.
+func HSTSMaxAge(value string) int64 {
+	for _, directive := range strings.Split(value, ";") {
+		k, v, found := strings.Cut(strings.TrimSpace(directive), "=")
+		if !found || !strings.EqualFold(strings.TrimSpace(k), "max-age") {
+			continue
+		}
+		maxAge, err := strconv.ParseInt(strings.Trim(strings.TrimSpace(v), `"`), 10, 64)
+		if err != nil {
+			return -1
+		}
+		return maxAge
+	}
+	return -1
+}
+
+// check records (and logs the first time) a Strict-Transport-Security header value with a positive max-age.
+func (h *hstsState) check(value, url string, id int, runID int64) {
+	if h.detected {
+		return
+	}
+	maxAge := HSTSMaxAge(value)
+	if maxAge <= 0 {
+		return
+	}
+	h.detected = true
+	msg := "Server enforces HSTS"
+	if h.insecure {
+		msg = "Server enforces HSTS while the client is configured with -k/Insecure"
+	}
+	log.S(log.Warning, msg, log.Str("url", url), log.Attr("max-age", maxAge),
+		log.Attr("thread", id), log.Attr("run", runID))
+}
@@ -17,19 +17,27 @@ package fhttp // import "fortio.org/fortio/fhttp"
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/tls"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"math"
 	"math/rand"
 	"net"
 	"net/http"
 	"net/http/httptrace"
 	"net/http/httputil"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"fortio.org/fortio/fnet"
@@ -86,6 +94,32 @@ func NewHTTPOptions(url string) *HTTPOptions {
 	return h.Init(url)
 }
 
+// connectTimeout returns the ConnectTimeout or HTTPReqTimeOut when unset.
+func (h *HTTPOptions) connectTimeout() time.Duration {
+	if h.ConnectTimeout > 0 {
+		return h.ConnectTimeout
+	}
+	return h.HTTPReqTimeOut
+}
+
+// responseTimeout returns the ResponseTimeout or HTTPReqTimeOut when unset.
+func (h *HTTPOptions) responseTimeout() time.Duration {
+	if h.ResponseTimeout > 0 {
+		return h.ResponseTimeout
+	}
+	return h.HTTPReqTimeOut
+}
+
+// jitteredTimeout returns timeout plus or minus a uniformly random duration up to jitter
+// (but at least 1ms), or timeout itself when jitter isn't set.
+func jitteredTimeout(timeout, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return timeout
+	}
+	d := timeout - jitter + time.Duration(rand.Int63n(2*int64(jitter)+1)) //nolint:gosec // we want fast not crypto
+	return max(d, time.Millisecond)
+}
+
 // Init initializes the headers in an HTTPOptions (User-Agent).
 func (h *HTTPOptions) Init(url string) *HTTPOptions {
 	if h.initDone {
@@ -114,6 +148,10 @@ const (
 	contentLength = "Content-Length"
 )
 
+// DefaultCORSPreflightOrigin is the Origin header of CORS preflight requests (see HTTPOptions.CORSPreflightMethod)
+// when none is set explicitly.
+const DefaultCORSPreflightOrigin = "https://fortio.org"
+
 // GenerateHeaders completes the header generation, including Content-Type/Length
 // and user credential coming from the HTTP options in addition to extra headers
 // coming from flags and AddAndValidateExtraHeader().
@@ -136,6 +174,18 @@ func (h *HTTPOptions) GenerateHeaders() http.Header {
 	if (payloadLen > 0 || len(h.ContentType) > 0) && len(allHeaders.Get(contentLength)) == 0 {
 		allHeaders.Set(contentLength, strconv.Itoa(payloadLen))
 	}
+	if h.sendsTrailers() {
+		h.setTrailerHeaders(allHeaders)
+	}
+	if h.rangeSet() && len(allHeaders.Get(rangeHeader)) == 0 {
+		allHeaders.Set(rangeHeader, h.rangeValue())
+	}
+	if h.CORSPreflightMethod != "" {
+		allHeaders.Set("Access-Control-Request-Method", h.CORSPreflightMethod)
+	}
+	if (h.CORSPreflightMethod != "" || h.CORSPreflight) && len(allHeaders.Get("Origin")) == 0 {
+		allHeaders.Set("Origin", DefaultCORSPreflightOrigin)
+	}
 	err := h.ValidateAndAddBasicAuthentication(allHeaders)
 	if err != nil {
 		log.Errf("User credential is not valid: %v", err)
@@ -151,7 +201,11 @@ func (h *HTTPOptions) URLSchemeCheck() {
 		log.Errf("Unexpected init with empty url")
 		return
 	}
-	if h.PayloadReader != nil && !h.H2 {
+	if h.PayloadReader != nil && h.PayloadChunkSize > 0 && !h.DisableFastClient {
+		log.Infof("PayloadReader with PayloadChunkSize set, switching to std client")
+		h.DisableFastClient = true
+	}
+	if h.PayloadReader != nil && h.PayloadChunkSize <= 0 && !h.H2 {
 		log.Infof("PayloadReader set, switching to H2")
 		h.H2 = true
 	}
@@ -159,6 +213,25 @@ func (h *HTTPOptions) URLSchemeCheck() {
 		log.Infof("H2 requested, switching to std client")
 		h.DisableFastClient = true
 	}
+	if h.AutoDecompress && !h.DisableFastClient {
+		log.Infof("AutoDecompress requested, switching to std client")
+		h.DisableFastClient = true
+	}
+	if h.CORSPreflight && !h.DisableFastClient {
+		log.Infof("CORSPreflight requested, switching to std client")
+		h.DisableFastClient = true
+	}
+	if jsFetch && (!h.DisableFastClient || h.H2) {
+		log.Infof("Browser (WebAssembly) build, switching to std client using fetch()")
+		h.DisableFastClient = true
+		h.H2 = false // negotiated by the browser
+	}
+	if wsURL, isWS := webSocketURL(h.URL); isWS {
+		log.Warnf("WebSocket url %s isn't supported for load testing, only the upgrade requests are sent (to %s), "+
+			"switching to std client", h.URL, wsURL)
+		h.URL = wsURL
+		h.DisableFastClient = true
+	}
 	hs := fnet.PrefixHTTPS // longer of the 2 prefixes
 	lcURL := h.URL
 	if len(lcURL) > len(hs) {
@@ -187,6 +260,7 @@ type HTTPOptions struct {
 	URL               string
 	NumConnections    int  // num connections (for std client)
 	Compression       bool // defaults to no compression, only used by std client
+	AutoDecompress    bool // gunzip responses even when Accept-Encoding is set explicitly, implies std client
 	DisableFastClient bool // defaults to fast client
 	HTTP10            bool // defaults to http1.1
 	H2                bool // defaults to http1.1 (h2 only for stdclient)
@@ -209,9 +283,59 @@ type HTTPOptions struct {
 	ID               int           `json:"-"` // thread/connect id to use for logging (thread id when used as a runner)
 	UniqueID         int64         `json:"-"` // Run identifier when used through a runner, copied from RunnerOptions.RunID
 	SequentialWarmup bool          // whether to do http(s):// runs warmup sequentially or in parallel (new default is //)
+	WarmupStagger    time.Duration // parallel warmup: thread i waits i*WarmupStagger before its first connection.
 	ConnReuseRange   [2]int        // range of max number of connection to reuse for each thread.
 	// When false, re-resolve the DNS name when the connection breaks.
 	NoResolveEachConn bool
+	// When positive, the resolved address is cached for that long and new connections made after
+	// expiry re-resolve, regardless of NoResolveEachConn (browser like DNS caching).
+	DNSCacheTTL time.Duration
+	// Optional explicit proxy (host:port or http://host:port), overriding the HTTPS_PROXY/HTTP_PROXY
+	// environment variables: connections are tunneled through it using CONNECT (except plain http:// requests
+	// of the std client which are sent to the proxy directly).
+	HTTPProxy string
+	// Optional multipart/form-data parts, when set the encoded body replaces the Payload (and ContentType).
+	MultipartFields []MultipartField
+	// When true, responses with a Strict-Transport-Security header with a positive max-age are
+	// logged (once per client) and reported in HTTPRunnerResults.HSTSDetected.
+	DetectHSTS bool
+	// Response header names (case insensitive) which should never be sent back, e.g. "Authorization"
+	// or an API key header a proxy shouldn't reflect: responses with any of them are counted in
+	// HTTPRunnerResults.ForbiddenHeaderCount.
+	ForbiddenResponseHeaders []string
+	// HTTP/1.1 pipelining (fast client only): when > 1, that many requests are sent back to back on the
+	// connection before reading all the responses in order. Note that most modern servers disable pipelining.
+	PipeliningDepth int
+	// Optional separate timeouts for establishing the connection (including TLS handshake) and for
+	// getting the response. Either defaults to HTTPReqTimeOut when not set (0).
+	ConnectTimeout  time.Duration
+	ResponseTimeout time.Duration
+	// When true, the ETag (or Last-Modified) of the first response having one is sent back in the
+	// If-None-Match (or If-Modified-Since) header of the subsequent requests and 304 Not Modified
+	// responses are counted as successes (and as HTTPRunnerResults.CacheHits).
+	CacheValidation bool
+	// When true, the source region/country is looked up (once per run) from the JSON geolocation
+	// service at GeoAPIURL (DefaultGeoAPIURL when empty) and stored in the results' SourceRegion.
+	AnnotateGeo bool
+	GeoAPIURL   string
+	// Std client only circuit breaker: when at least CircuitBreakerThreshold (fraction, e.g. 0.5) of the
+	// last CircuitBreakerWindow requests failed, the circuit opens and requests fail immediately (-1)
+	// without using the network. After CircuitBreakerCooldown, one probe request is let through
+	// (half-open) which closes the circuit on success or re-opens it for another cooldown on failure.
+	CircuitBreakerThreshold float64
+	CircuitBreakerWindow    int
+	CircuitBreakerCooldown  time.Duration
+	// Optional byte range requested (Range: bytes=RangeStart-RangeEnd header) when either is set,
+	// open ended (bytes=RangeStart-) when RangeEnd isn't set.
+	RangeStart int64
+	RangeEnd   int64
+	// When true, each request is for a random range within the Content-Length returned
+	// by a HEAD (preflight) request done when creating the first client.
+	RangeRandom        bool
+	rangeContentLength int64 // from the preflight HEAD request, when RangeRandom is set
+	// When set, each request's response timeout is randomly varied by up to plus or minus
+	// TimeoutJitter, e.g. to check servers handle clients aborting at various stages cleanly.
+	TimeoutJitter time.Duration
 	// Optional Offset Duration; to offset the histogram of the Connection duration
 	Offset time.Duration
 	// Optional resolution divider for the Connection duration histogram. In seconds. Defaults to 0.001 or 1 millisecond.
@@ -221,7 +345,55 @@ type HTTPOptions struct {
 	// Optional Transport chain factory to use if set. Only effective when using std client.
 	// pass otelhttp.NewTransport for instance.
 	Transport CreateTransport `json:"-"`
-	// These following 2 options are only making sense for single operation (curl) mode.
+	// Optional Signer called before each request is sent, e.g. HMACSHA256Signer for authenticated load tests.
+	Signer Signer `json:"-"`
+	// Fast client only: max size of the response headers in kilobytes, defaults to (and can't be less than)
+	// BufferSizeKb. When the headers don't fit the buffer, it grows (once) so they can be up to HeaderBufferKb
+	// with still BufferSizeKb for the body after them, e.g. for servers sending many large Set-Cookie headers.
+	HeaderBufferKb int
+	// When set, requests are CORS preflight requests for that method: OPTIONS with the Access-Control-Request-Method
+	// header and an Origin (DefaultCORSPreflightOrigin unless set through the extra headers).
+	CORSPreflightMethod string
+	// When set, like browsers do for cross origin requests, a CORS preflight (OPTIONS) request is sent before
+	// the requests, unless a previous preflight for the same url is still cached per its Access-Control-Max-Age
+	// (5s when absent). Requests get an Origin header (DefaultCORSPreflightOrigin unless set through the extra
+	// headers). The preflights are included in the calls durations. Std client only, ignored with CORSPreflightMethod.
+	CORSPreflight bool
+	// Optional trailers sent after the request body, which is then chunked, e.g. for gRPC-web over HTTP/1.1.
+	// Ignored with HTTP10. The std client doesn't send them for empty GET (or HEAD, DELETE...) requests.
+	RequestTrailers http.Header
+	// By default the std client retries an idempotent request (e.g. GET but not POST) once, on a new connection,
+	// when it fails with a connection reset (e.g. the server closed an idle keep-alive connection while the
+	// request was sent), like browsers do. Set to count these resets as errors instead.
+	// See HTTPRunnerResults.ResetRetries.
+	DisableRetryOnReset bool
+	// Also retry the non idempotent requests on connection resets (the server may have processed them).
+	RetryNonIdempotent bool
+	// Keep Nagle's algorithm enabled on the connections: by default, like Go's net package, TCP_NODELAY is set
+	// so small requests are sent immediately instead of being possibly delayed (by up to 200ms).
+	EnableNagle bool
+	// When set, each request gets that header with a runID/threadID/seq value, seq increasing from 1 for each
+	// thread, so the requests can be correlated with e.g. distributed tracing backends' spans.
+	SequenceNumberHeader string
+	// When positive, with PayloadReader set, the body of each request is the next (up to) PayloadChunkSize
+	// bytes read from PayloadReader, e.g. a FIFO an external program writes payloads to, instead of the
+	// whole PayloadReader being streamed as the body of a single request.
+	PayloadChunkSize int
+	// On Linux, sample the fast client connections' kernel TCP_INFO (round trip time, retransmits and congestion
+	// window) when they are established and after each response, see HTTPRunnerResults.TCPMetrics.
+	TCPInfo bool
+	// When true, the FingerprintHeader (DefaultFingerprintHeader, i.e. ETag, when empty) value of the
+	// responses is compared to the one of the first response having it, across all the clients of a run:
+	// for identical requests, e.g. to immutable content through a cache, a different value means different
+	// content was served. Mismatches are counted in HTTPRunnerResults.DedupMismatches.
+	DetectDedup       bool
+	FingerprintHeader string
+	dedupFirst        *atomic.Pointer[string] // shared by the clients of a run, see RunHTTPTest.
+	// When true, the dur of each metric of the responses' Server-Timing headers (e.g. db;dur=12.3) is recorded
+	// in a per metric name histogram, see HTTPRunnerResults.ServerTimings.
+	ParseServerTiming bool
+	// These following 2 options are only making sense for single operation (curl) mode
+	// (unless PayloadChunkSize is set for the PayloadReader).
 	PayloadReader io.Reader `json:"-"` // if set, Payload is ignored and this is used instead.
 	DataWriter    io.Writer `json:"-"` // if set, the response body is written to this writer.
 }
@@ -295,12 +467,59 @@ func (h *HTTPOptions) AllHeaders() http.Header {
 	return headers
 }
 
+// ExtraHeaders returns the extra headers, including the User-Agent (empty when removed) and the special Host
+// one, as the "Name:value" strings AddAndValidateExtraHeader takes, e.g. to serialize them.
+func (h *HTTPOptions) ExtraHeaders() []string {
+	res := make([]string, 0, len(h.extraHeaders)+2)
+	for _, k := range slices.Sorted(maps.Keys(h.extraHeaders)) {
+		for _, v := range h.extraHeaders[k] {
+			res = append(res, k+":"+v)
+		}
+	}
+	if h.extraHeaders.Get(jrpc.UserAgentHeader) == "" {
+		res = append(res, jrpc.UserAgentHeader+":")
+	}
+	if h.hostOverride != "" {
+		res = append(res, "Host:"+h.hostOverride)
+	}
+	return res
+}
+
+// RedactedHeaderValue replaces the values of the sensitive headers in RedactedExtraHeaders.
+const RedactedHeaderValue = "<redacted>"
+
+// IsSensitiveHeader returns true for the headers carrying credentials: Authorization, Proxy-Authorization,
+// Cookie and the ones with "token" or "key" in their name (e.g. X-Api-Key).
+func IsSensitiveHeader(name string) bool {
+	switch lname := strings.ToLower(name); lname {
+	case "authorization", "proxy-authorization", "cookie":
+		return true
+	default:
+		return strings.Contains(lname, "token") || strings.Contains(lname, "key")
+	}
+}
+
+// RedactedExtraHeaders is ExtraHeaders with the values of the sensitive headers (see IsSensitiveHeader)
+// replaced by RedactedHeaderValue, e.g. to save them.
+func (h *HTTPOptions) RedactedExtraHeaders() []string {
+	res := h.ExtraHeaders()
+	for i, hdr := range res {
+		if name, _, _ := strings.Cut(hdr, ":"); IsSensitiveHeader(name) {
+			res[i] = name + ":" + RedactedHeaderValue
+		}
+	}
+	return res
+}
+
 // Method returns the method of the HTTP req.
 func (h *HTTPOptions) Method() string {
+	if h.CORSPreflightMethod != "" {
+		return http.MethodOptions
+	}
 	if len(h.MethodOverride) > 0 {
 		return h.MethodOverride
 	}
-	if len(h.Payload) > 0 || h.ContentType != "" {
+	if len(h.Payload) > 0 || h.PayloadReader != nil || h.ContentType != "" {
 		return fnet.POST
 	}
 	return fnet.GET
@@ -413,10 +632,20 @@ func newHTTPRequest(o *HTTPOptions) (*http.Request, error) {
 	if o.hostOverride != "" {
 		req.Host = o.hostOverride
 	}
+	if o.sendsTrailers() {
+		setRequestTrailers(req, o.Payload, o.RequestTrailers)
+	}
 	// Another workaround for std client otherwise trying to set a default User-Agent
 	if _, ok := req.Header["User-Agent"]; !ok {
 		req.Header.Set("User-Agent", "")
 	}
+	if o.Signer != nil {
+		if err = o.Signer(req); err != nil {
+			log.S(log.Error, "Unable to sign request", log.Attr("err", err),
+				log.Attr("thread", o.ID), log.Attr("run", o.UniqueID))
+			return nil, err
+		}
+	}
 	if !log.LogDebug() {
 		return req, nil
 	}
@@ -451,6 +680,29 @@ type Client struct {
 	connectStats         *stats.Histogram
 	clientTrace          CreateClientTrace
 	dataWriter           io.Writer
+	dnsCache             *dnsCache         // only when DNSCacheTTL is set
+	dnsResolutions       *stats.Occurrence // addresses resolved on dnsCache misses
+	certRotator          *certRotator      // released on Close
+	autoDecompress       bool
+	hsts                 hstsState
+	dedup                dedupState
+	serverTiming         serverTimingState
+	forbidden            forbiddenHeadersState
+	wsUpgrades           wsUpgradeState
+	preload              preloadLinkState
+	cors                 *corsPreflightCache // only when HTTPOptions.CORSPreflight is set
+	cache                cacheState
+	breaker              circuitBreaker
+	rangeLength          int64 // content length for random ranges (HTTPOptions.RangeRandom)
+	timeoutJitter        time.Duration
+	errType              string // error type of the last failed request (see ErrorType)
+	signer               Signer
+	retryOnReset         bool
+	retryNonIdempotent   bool
+	resetRetries         int64 // number of requests retried after a connection reset
+	sequence             sequencer
+	payloadReader        io.Reader // set when each request body is read from it (HTTPOptions.PayloadChunkSize)
+	payloadChunk         []byte
 }
 
 func (c *Client) HasBuffer() bool {
@@ -471,6 +723,10 @@ func (c *Client) Close() {
 	if c.transport != nil {
 		c.transport.CloseIdleConnections()
 	}
+	if c.certRotator != nil {
+		c.certRotator.release()
+		c.certRotator = nil
+	}
 }
 
 // ChangeURL only for standard client, allows fetching a different URL.
@@ -494,7 +750,63 @@ func (c *Client) Fetch(ctx context.Context) (int, []byte, int) {
 // StreamFetch fetches the byte and code for pre-created std client.
 // header length (3rd returned value) is always 0 for that client
 // and only available with the fastclient.
+// When the circuit breaker is open, -1 is returned without attempting the request.
 func (c *Client) StreamFetch(ctx context.Context) (int, int64, uint) {
+	c.errType = ""
+	if !c.breaker.allow(c.id, c.runID) {
+		c.errType = ErrorTypeCircuitOpen
+		return -1, -1, 0
+	}
+	code, n, headerLen := c.streamFetch(ctx)
+	c.breaker.record(!c.cache.ok(code), c.id, c.runID)
+	return code, n, headerLen
+}
+
+// setBody sets the body of req, and GetBody (used by signers and redirects) to match it.
+func setBody(req *http.Request, body []byte) {
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+}
+
+// isIdempotent returns true for the requests which can be retried: idempotent methods (RFC 9110)
+// or with an Idempotency-Key header, like net/http's own retries.
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	if _, ok := req.Header["Idempotency-Key"]; ok {
+		return true
+	}
+	_, ok := req.Header["X-Idempotency-Key"]
+	return ok
+}
+
+// rewindBody makes the body of req readable again for a retry, returns false if it can't be
+// (streamed PayloadReader body).
+func rewindBody(req *http.Request) bool {
+	if req.Body == nil || req.Body == http.NoBody {
+		return true
+	}
+	if req.GetBody == nil {
+		return false
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return false
+	}
+	req.Body = body
+	return true
+}
+
+func (c *Client) streamFetch(ctx context.Context) (int, int64, uint) {
+	if c.timeoutJitter > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, jitteredTimeout(c.client.Timeout-c.timeoutJitter, c.timeoutJitter))
+		defer cancel()
+	}
 	// req can't be null (client itself would be null in that case)
 	var req *http.Request
 	if c.clientTrace != nil {
@@ -523,18 +835,68 @@ func (c *Client) StreamFetch(ctx context.Context) (int, int64, uint) {
 			body = strings.Replace(body, uuidToken, generateUUID(), 1)
 		}
 		bodyBytes := []byte(body)
-		req.ContentLength = safecast.MustConvert[int64](len(bodyBytes))
-		req.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+		if req.Trailer == nil {
+			req.ContentLength = safecast.MustConvert[int64](len(bodyBytes))
+		}
+		setBody(req, bodyBytes)
 	} else if len(c.body) > 0 {
-		req.Body = io.NopCloser(bytes.NewReader(c.body))
+		setBody(req, c.body)
+	}
+	if c.payloadReader != nil {
+		n, err := c.payloadReader.Read(c.payloadChunk)
+		if n == 0 {
+			if err == nil {
+				err = io.ErrNoProgress
+			}
+			log.S(log.Error, "Unable to read payload", log.Attr("err", err), log.Attr("thread", c.id), log.Attr("run", c.runID))
+			c.errType = ErrorType(err)
+			return -1, -1, 0
+		}
+		if req.Trailer == nil {
+			req.ContentLength = int64(n)
+		}
+		setBody(req, c.payloadChunk[:n])
+	}
+	if c.rangeLength > 0 {
+		req.Header.Set(rangeHeader, randomRange(c.rangeLength))
+	}
+	if c.sequence.header != "" {
+		req.Header.Set(c.sequence.header, c.sequence.next())
+	}
+	if c.signer != nil {
+		if err := c.signer(req); err != nil {
+			log.S(log.Error, "Unable to sign request", log.Attr("err", err), log.Attr("thread", c.id), log.Attr("run", c.runID))
+			c.errType = ErrorTypeSigning
+			return -1, -1, 0
+		}
+	}
+	if c.cors != nil {
+		c.cors.preflight(c.client, req, c.id, c.runID)
 	}
 	resp, err := c.client.Do(req)
+	if err != nil && c.retryOnReset && errors.Is(err, syscall.ECONNRESET) &&
+		(c.retryNonIdempotent || isIdempotent(req)) && rewindBody(req) {
+		c.resetRetries++
+		log.S(log.Info, "Connection reset, retrying request", log.Attr("err", err),
+			log.Attr("thread", c.id), log.Attr("run", c.runID))
+		// The other idle connections may be as stale as the reset one: retry on a fresh connection.
+		c.client.CloseIdleConnections()
+		resp, err = c.client.Do(req)
+	}
 	if err != nil {
 		log.S(log.Error, "Unable to send request",
 			log.Attr("method", req.Method), log.Attr("url", c.url), log.Attr("err", err),
 			log.Attr("thread", c.id), log.Attr("run", c.runID))
+		c.errType = ErrorType(err)
 		return -1, -1, 0
 	}
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		// The body is then the upgraded connection, which would never end.
+		resp.Body.Close()
+		c.wsUpgrades.upgraded(c.url, c.id, c.runID)
+		c.errType = ErrorTypeWebSocketUpgrade
+		return SocketError, -1, 0
+	}
 	var data []byte
 	if log.LogDebug() {
 		if data, err = httputil.DumpResponse(resp, false); err != nil {
@@ -547,26 +909,179 @@ func (c *Client) StreamFetch(ctx context.Context) (int, int64, uint) {
 		c.dataWriter = io.Discard
 	}
 	var n int64
-	n, err = io.Copy(c.dataWriter, resp.Body)
-	resp.Body.Close()
+	body := resp.Body
+	if c.autoDecompress {
+		if body, err = decompressedBody(resp); err != nil {
+			body = resp.Body // still needs closing
+		}
+	}
+	if err == nil {
+		n, err = io.Copy(c.dataWriter, body)
+	}
+	body.Close()
 	if err != nil {
 		log.S(log.Error, "Unable to read response",
 			log.Attr("err", err), log.Attr("thread", c.id), log.Attr("run", c.runID))
 		code := resp.StatusCode
-		if codeIsOK(code) {
+		if c.cache.ok(code) {
 			code = http.StatusNoContent
 			log.S(log.Warning, "Ok code despite read error, switching code to 204", log.Attr("thread", c.id), log.Attr("run", c.runID))
 		}
 		return code, n, 0
 	}
 	code := resp.StatusCode
+	if c.hsts.detect {
+		c.hsts.check(resp.Header.Get("Strict-Transport-Security"), c.url, c.id, c.runID)
+	}
+	if c.dedup.header != "" {
+		c.dedup.check(resp.Header.Get(c.dedup.header), c.url, c.id, c.runID)
+	}
+	if c.serverTiming.enabled {
+		c.serverTiming.checkHeader(resp.Header)
+	}
+	if len(c.forbidden.names) > 0 {
+		c.forbidden.checkHeader(resp.Header, c.url, c.id, c.runID)
+	}
+	if c.preload.enabled {
+		c.preload.check(resp.Header, c.url, c.id, c.runID)
+	}
+	if c.cache.needed(code) {
+		name, value := c.cache.conditionalHeader(resp.Header.Get("ETag"), resp.Header.Get("Last-Modified"), c.id, c.runID)
+		if name != "" {
+			c.req.Header.Set(name, value)
+		}
+	}
 	log.Debugf("[%d] Got %d : %s for %s %s - response is %d bytes", c.id, code, resp.Status, req.Method, c.url, len(data))
-	if c.logErrors && !codeIsOK(code) {
+	if c.logErrors && !c.cache.ok(code) {
 		log.S(log.Warning, "Non ok http code", log.Attr("code", code), log.Attr("thread", c.id), log.Attr("run", c.runID))
 	}
 	return code, n, 0
 }
 
+// gzipBody is the gunzipped response body, closing both the gzip reader and the response body.
+type gzipBody struct {
+	*gzip.Reader
+	body io.Closer
+}
+
+func (g *gzipBody) Close() error {
+	err := g.Reader.Close()
+	if bErr := g.body.Close(); err == nil {
+		err = bErr
+	}
+	return err
+}
+
+// decompressedBody returns a reader of the gunzipped body for gzip encoded responses
+// (not already transparently decoded by the transport), or the raw body otherwise.
+// Closing it closes the response body. Brotli (br) isn't supported as the package isn't
+// a dependency of fortio.
+func decompressedBody(resp *http.Response) (io.ReadCloser, error) {
+	enc := strings.ToLower(resp.Header.Get("Content-Encoding"))
+	switch enc {
+	case "":
+		return resp.Body, nil
+	case "gzip":
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return &gzipBody{Reader: zr, body: resp.Body}, nil
+	default:
+		log.LogVf("Unsupported Content-Encoding %q, not decompressing", enc)
+		return resp.Body, nil
+	}
+}
+
+// proxyURL returns the parsed HTTPProxy, adding the missing http:// if needed.
+func (h *HTTPOptions) proxyURL() (*url.URL, error) {
+	proxy := h.HTTPProxy
+	if !strings.Contains(proxy, "://") {
+		proxy = fnet.PrefixHTTP + proxy
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, err
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid proxy %q, missing host", h.HTTPProxy)
+	}
+	return u, nil
+}
+
+// proxyAuthorization returns the Proxy-Authorization header value for the user:pass@ of the HTTPProxy url,
+// empty if it has none.
+func (h *HTTPOptions) proxyAuthorization() string {
+	u, err := h.proxyURL()
+	if err != nil || u.User == nil {
+		return ""
+	}
+	password, _ := u.User.Password()
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(u.User.Username()+":"+password))
+}
+
+// connectAddress returns the address the fast client connects to for hostname:port: the UnixDomainSocket,
+// the HTTPProxy (and then the CONNECT target, to the Resolve override if set) or the resolved destination
+// (or its Resolve override).
+func (h *HTTPOptions) connectAddress(ctx context.Context, hostname, port string,
+	usage *stats.Occurrence,
+) (net.Addr, string, error) {
+	if h.UnixDomainSocket != "" {
+		log.S(log.Info, "Using unix domain socket", log.Attr("path", h.UnixDomainSocket),
+			log.Attr("thread", h.ID), log.Attr("run", h.UniqueID))
+		return &net.UnixAddr{Name: h.UnixDomainSocket, Net: fnet.UnixDomainSocket}, "", nil
+	}
+	if h.HTTPProxy != "" {
+		proxyURL, err := h.proxyURL()
+		if err != nil {
+			log.S(log.Error, "Bad proxy", log.Str("proxy", h.HTTPProxy), log.Attr("err", err),
+				log.Attr("thread", h.ID), log.Attr("run", h.UniqueID))
+			return nil, "", err
+		}
+		p, err := net.LookupPort("tcp", port)
+		if err != nil {
+			return nil, "", err
+		}
+		targetHost := hostname
+		if h.Resolve != "" {
+			targetHost = h.Resolve
+		}
+		proxyTarget := net.JoinHostPort(targetHost, strconv.Itoa(p))
+		proxyPort := proxyURL.Port()
+		if proxyPort == "" {
+			proxyPort = "http"
+		}
+		tAddr, err := resolve(ctx, proxyURL.Hostname(), proxyPort, "", usage)
+		if tAddr == nil {
+			return nil, "", err
+		}
+		log.S(log.Info, "Using proxy", log.Str("proxy", proxyURL.Host), log.Str("target", proxyTarget),
+			log.Attr("thread", h.ID), log.Attr("run", h.UniqueID))
+		return tAddr, proxyTarget, nil
+	}
+	tAddr, err := resolve(ctx, hostname, port, h.Resolve, usage)
+	if tAddr == nil { // strangely we get a non nil wrap of nil if returning it as a net.Addr directly
+		return nil, "", err
+	}
+	return tAddr, "", nil
+}
+
+// ConnectAddress returns the address the load test connections to the URL go to, like the fast client
+// does: the UnixDomainSocket, the HTTPProxy or the resolved (or -resolve overridden) URL host and port.
+// The options must have been initialized (see Init).
+func (h *HTTPOptions) ConnectAddress(ctx context.Context) (net.Addr, error) {
+	u, err := url.Parse(h.URL)
+	if err != nil {
+		return nil, err
+	}
+	port := u.Port()
+	if port == "" {
+		port = u.Scheme // ie http which turns into 80
+	}
+	addr, _, err := h.connectAddress(ctx, u.Hostname(), port, stats.NewOccurrence())
+	return addr, err
+}
+
 // GetIPAddress get the IP address that DNS resolves to when using stdClient and connection stats.
 func (c *Client) GetIPAddress() (*stats.Occurrence, *stats.Histogram) {
 	return c.ipAddrUsage, c.connectStats
@@ -590,7 +1105,17 @@ type Transport interface {
 
 // NewStdClient creates a client object that wraps the net/http standard client.
 func NewStdClient(o *HTTPOptions) (*Client, error) {
+	mo, err := o.withMultipart()
+	if err != nil {
+		log.S(log.Error, "Unable to build multipart body", log.Attr("err", err),
+			log.Attr("thread", o.ID), log.Attr("run", o.UniqueID))
+		return nil, err
+	}
+	o = mo
 	o.Init(o.URL) // also normalizes NumConnections etc to be valid.
+	if err := o.initRandomRange(); err != nil {
+		return nil, err
+	}
 	req, err := newHTTPRequest(o)
 	if req == nil {
 		return nil, err
@@ -605,28 +1130,77 @@ func NewStdClient(o *HTTPOptions) (*Client, error) {
 		bodyContainsUUID:     strings.Contains(string(o.Payload), uuidToken),
 		req:                  req,
 		client: &http.Client{
-			Timeout: o.HTTPReqTimeOut,
+			// With jitter, the (shorter) per request timeout is from the context, see streamFetch.
+			Timeout: o.responseTimeout() + max(o.TimeoutJitter, 0),
 		},
 		id:          o.ID,
 		logErrors:   o.LogErrors,
 		ipAddrUsage: stats.NewOccurrence(),
 		// Keep track of timing for connection (re)establishment.
-		connectStats: stats.NewHistogram(o.Offset.Seconds(), o.Resolution),
-		clientTrace:  o.ClientTrace,
-		dataWriter:   o.DataWriter,
-		runID:        o.UniqueID,
+		connectStats:   stats.NewHistogram(o.Offset.Seconds(), o.Resolution),
+		clientTrace:    o.ClientTrace,
+		dataWriter:     o.DataWriter,
+		runID:          o.UniqueID,
+		autoDecompress: o.AutoDecompress,
+		hsts:           hstsState{detect: o.DetectHSTS, insecure: o.Insecure},
+		dedup:          newDedupState(o),
+		serverTiming:   newServerTimingState(o),
+		forbidden:      forbiddenHeadersState{names: o.ForbiddenResponseHeaders},
+		preload:        preloadLinkState{enabled: o.H2},
+		cache:          cacheState{enabled: o.CacheValidation},
+		breaker:        newCircuitBreaker(o),
+		rangeLength:    o.rangeContentLength,
+		timeoutJitter:  o.TimeoutJitter,
+		signer:         o.Signer,
+	}
+	client.retryOnReset = !o.DisableRetryOnReset
+	client.retryNonIdempotent = o.RetryNonIdempotent
+	client.sequence = newSequencer(o.SequenceNumberHeader, o.UniqueID, o.ID)
+	if o.PayloadReader != nil && o.PayloadChunkSize > 0 {
+		client.payloadReader = o.PayloadReader
+		client.payloadChunk = make([]byte, o.PayloadChunkSize)
+	}
+	if o.DNSCacheTTL > 0 {
+		client.dnsCache = &dnsCache{}
+		client.dnsResolutions = stats.NewOccurrence()
+	}
+	if o.CORSPreflight && o.CORSPreflightMethod == "" {
+		client.cors = newCORSPreflightCache(req.Header)
+	}
+	proxy := http.ProxyFromEnvironment
+	if o.HTTPProxy != "" {
+		proxyURL, perr := o.proxyURL()
+		if perr != nil {
+			log.S(log.Error, "Bad proxy", log.Str("proxy", o.HTTPProxy), log.Attr("err", perr))
+			return nil, perr
+		}
+		proxy = http.ProxyURL(proxyURL)
 	}
 	dialCtx := func(ctx context.Context, network, addr string) (net.Conn, error) {
 		// redirect all connections to resolved IP, and use Common Name (CN) as Server Name Indication (SNI) host
-		if o.Resolve != "" {
+		// (not when the connection is to the explicit proxy)
+		if o.Resolve != "" && o.HTTPProxy == "" {
 			addr = o.Resolve + addr[strings.LastIndex(addr, ":"):]
 		}
-		var conn net.Conn
+		if client.dnsCache != nil && o.HTTPProxy == "" {
+			host, port, splitErr := net.SplitHostPort(addr)
+			if splitErr != nil {
+				return nil, splitErr
+			}
+			tAddr, resErr := client.dnsCache.resolve(ctx, host, port, "", o.DNSCacheTTL, client.dnsResolutions)
+			if resErr != nil {
+				return nil, resErr
+			}
+			addr = tAddr.String()
+		}
 		now := time.Now()
-		conn, err = (&net.Dialer{
-			Timeout: o.HTTPReqTimeOut,
+		conn, err := (&net.Dialer{
+			Timeout: o.connectTimeout(),
 		}).DialContext(ctx, network, addr)
 		client.connectStats.Record(time.Since(now).Seconds())
+		if tcpConn, ok := conn.(*net.TCPConn); ok && o.EnableNagle {
+			_ = tcpConn.SetNoDelay(false)
+		}
 		if conn != nil {
 			newRemoteAddress := conn.RemoteAddr().String()
 			// No change when it wasn't set before (first time) and when the value isn't actually changing either.
@@ -644,24 +1218,27 @@ func NewStdClient(o *HTTPOptions) (*Client, error) {
 		MaxIdleConnsPerHost: o.NumConnections,
 		DisableCompression:  !o.Compression,
 		DisableKeepAlives:   o.DisableKeepAlive,
-		Proxy:               http.ProxyFromEnvironment,
+		Proxy:               proxy,
 		DialContext:         dialCtx,
-		TLSHandshakeTimeout: o.HTTPReqTimeOut,
+		TLSHandshakeTimeout: o.connectTimeout(),
 		ForceAttemptHTTP2:   o.H2,
 	}
+	if jsFetch {
+		tr.DialContext = nil // fetch() is only used without custom dialer.
+	}
 	client.transport = tr // internal transport, unwrapped (to close idle conns)
 	if o.https {
-		tr.TLSClientConfig, err = o.TLSOptions.TLSConfig()
+		// Last step that can fail: the cert rotator, if any, is only acquired on success
+		// (and released by Close).
+		tr.TLSClientConfig, client.certRotator, err = o.TLSOptions.tlsConfig()
 		if err != nil {
+			client.Close()
 			return nil, err
 		}
 	} else if o.H2 {
 		// Need to do h2c instead of normal transport
 		// Note: this likely means connection multiplexing / not sure how to force unique connections
 		// with http2.Transport.
-		if err != nil {
-			return nil, err
-		}
 		tr2 := &http2.Transport{
 			AllowHTTP: true,
 			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
@@ -716,7 +1293,11 @@ func Fetch(httpOptions *HTTPOptions) (int, []byte) {
 // Fetch creates a client an performs a fetch according to the HTTP options passed in.
 // To be used only for single fetches or when performance doesn't matter as the client is closed at the end.
 func StreamFetch(httpOptions *HTTPOptions) int {
-	cli, _ := NewClient(httpOptions)
+	cli, err := NewClient(httpOptions)
+	if err != nil {
+		log.Errf("Unable to create client for %s: %v", httpOptions.URL, err)
+		return SocketError
+	}
 	code, _, _ := cli.StreamFetch(context.Background())
 	cli.Close()
 	return code
@@ -742,6 +1323,7 @@ type FastClient struct {
 	keepAlive    bool
 	parseHeaders bool // don't bother in http/1.0
 	halfClose    bool // allow/do half close when keepAlive is false
+	nagle        bool // HTTPOptions.EnableNagle
 	reqTimeout   time.Duration
 	uuidMarkers  [][]byte
 	logErrors    bool
@@ -749,9 +1331,15 @@ type FastClient struct {
 	runID        int64
 	https        bool
 	tlsConfig    *tls.Config
+	certRotator  *certRotator // released on Close
+	// host:port to CONNECT to when using HTTPProxy (dest is then the proxy address).
+	proxyTarget string
+	proxyAuth   string // Proxy-Authorization of the CONNECT requests, if any.
 	// Resolve the DNS name for each connection
 	resolve           string
 	noResolveEachConn bool
+	dnsCacheTTL       time.Duration
+	dnsCache          dnsCache
 	ipAddrUsage       *stats.Occurrence
 	// range of connection reuse threshold that current thread will choose from
 	connReuseRange [2]int
@@ -759,6 +1347,44 @@ type FastClient struct {
 	reuseCount     int
 	connectStats   *stats.Histogram
 	dataWriter     io.Writer
+	// When streaming to dataWriter: how many bytes of the response were already written (flushed)
+	// and are no longer in the buffer, i.e., the offset of buffer[0] in the response.
+	streamed int64
+	// Trailers of the last chunked response (nil if none).
+	trailers http.Header
+	hsts     hstsState
+	cache    cacheState
+	dedup    dedupState
+	// Server-Timing metrics histograms (see HTTPOptions.ParseServerTiming).
+	serverTiming serverTimingState
+	// Responses with forbidden headers detection (see HTTPOptions.ForbiddenResponseHeaders).
+	forbidden forbiddenHeadersState
+	// Responses upgrading the connection (101 Switching Protocols).
+	wsUpgrades wsUpgradeState
+	// Number of requests sent back to back (pipelined) per StreamFetch, 1 when not pipelining.
+	pipelining int
+	// Timeout for establishing new connections (reqTimeout is the response one).
+	connectTimeout time.Duration
+	// Set while reading a pipelined response that isn't the last one of the batch.
+	pipelineMore bool
+	// Offset of the end of the last response read (-1 if unknown), beyond which the
+	// buffer has the beginning of the next pipelined response.
+	respEnd int64
+	// Content length for random ranges (HTTPOptions.RangeRandom), 0 otherwise.
+	rangeLength int64
+	// HTTPOptions.SequenceNumberHeader values.
+	sequence sequencer
+	// HTTPOptions.TCPInfo samples.
+	tcpInfo tcpInfoState
+	// Per request random variation of reqTimeout (HTTPOptions.TimeoutJitter).
+	timeoutJitter time.Duration
+	// Error type of the last failed request (see ErrorType).
+	errType string
+	// HTTPOptions.Signer and the request (without body) it's given copies of, when set.
+	signer  Signer
+	signReq *http.Request
+	// Size the buffer can grow to, plus the body buffer size, to hold large headers (HTTPOptions.HeaderBufferKb).
+	headerBufferSize int
 }
 
 // GetIPAddress get ip address that DNS resolved to when using fast client and connection stats.
@@ -781,16 +1407,32 @@ func (c *FastClient) Close() {
 		c.reader = nil
 		c.socket = nil
 	}
+	if c.certRotator != nil {
+		c.certRotator.release()
+		c.certRotator = nil
+	}
 }
 
 // NewFastClient makes a basic, efficient HTTP 1.0/1.1 client.
 // This function itself doesn't need to be super efficient as it is created at
 // the beginning and then reused many times.
 func NewFastClient(o *HTTPOptions) (Fetcher, error) { //nolint:funlen
+	mo, err := o.withMultipart()
+	if err != nil {
+		log.S(log.Error, "Unable to build multipart body", log.Attr("err", err),
+			log.Attr("thread", o.ID), log.Attr("run", o.UniqueID))
+		return nil, err
+	}
+	o = mo
 	method := o.Method()
 	log.Debugf("NewFastClient %s %s", method, o.URL)
 	payloadLen := len(o.Payload)
 	o.Init(o.URL)
+	if err := o.initRandomRange(); err != nil {
+		log.S(log.Error, "Unable to setup random ranges", log.Attr("err", err),
+			log.Attr("thread", o.ID), log.Attr("run", o.UniqueID))
+		return nil, err
+	}
 	proto := "1.1"
 	if o.HTTP10 {
 		proto = "1.0"
@@ -833,39 +1475,49 @@ func NewFastClient(o *HTTPOptions) (Fetcher, error) { //nolint:funlen
 	// note: Host includes the port
 	bc := FastClient{
 		url: o.URL, host: url.Host, hostname: url.Hostname(), port: url.Port(),
-		http10: o.HTTP10, halfClose: o.AllowHalfClose, logErrors: o.LogErrors, id: o.ID, runID: o.UniqueID,
+		http10: o.HTTP10, halfClose: o.AllowHalfClose, nagle: o.EnableNagle, logErrors: o.LogErrors, id: o.ID, runID: o.UniqueID,
 		https: o.https, connReuseRange: o.ConnReuseRange, connReuse: connReuse,
-		resolve: o.Resolve, noResolveEachConn: o.NoResolveEachConn, ipAddrUsage: stats.NewOccurrence(),
+		resolve: o.Resolve, noResolveEachConn: o.NoResolveEachConn, dnsCacheTTL: o.DNSCacheTTL,
+		ipAddrUsage: stats.NewOccurrence(),
 		// Keep track of timing for connection (re)establishment.
 		connectStats: stats.NewHistogram(o.Offset.Seconds(), o.Resolution),
 		dataWriter:   o.DataWriter,
+		hsts:         hstsState{detect: o.DetectHSTS, insecure: o.Insecure},
+		dedup:        newDedupState(o),
+		serverTiming: newServerTimingState(o),
+		forbidden:    forbiddenHeadersState{names: o.ForbiddenResponseHeaders},
+		cache:        cacheState{enabled: o.CacheValidation},
+		pipelining:   1,
+		rangeLength:  o.rangeContentLength,
 	}
 	if o.https {
-		bc.tlsConfig, err = o.TLSOptions.TLSConfig()
+		bc.tlsConfig, bc.certRotator, err = o.TLSOptions.tlsConfig()
 		if err != nil {
 			return nil, err
 		}
 	}
 	bc.buffer = make([]byte, BufferSizeKb*1024)
+	bc.headerBufferSize = o.HeaderBufferKb * 1024
 	if bc.port == "" {
 		bc.port = url.Scheme // ie HTTP which turns into 80 later
 		log.LogVf("[%d] No port specified, using %s", bc.id, bc.port)
 	}
-	var addr net.Addr
-	if o.UnixDomainSocket != "" {
-		log.S(log.Info, "Using unix domain socket", log.Attr("path", o.UnixDomainSocket),
-			log.Attr("thread", bc.id), log.Attr("run", bc.runID))
-		uds := &net.UnixAddr{Name: o.UnixDomainSocket, Net: fnet.UnixDomainSocket}
-		addr = uds
-	} else {
-		var tAddr *net.TCPAddr // strangely we get a non nil wrap of nil if assigning to addr directly
-		var err error
-		tAddr, err = resolve(context.Background(), bc.hostname, bc.port, o.Resolve, bc.ipAddrUsage)
-		if tAddr == nil {
-			// Error already logged
-			return nil, err
-		}
-		addr = tAddr
+	usage := bc.ipAddrUsage
+	if fnet.FlagResolveIPType.Get() == "dual" {
+		usage = stats.NewOccurrence() // actual address used is recorded on connect
+	}
+	addr, proxyTarget, err := o.connectAddress(context.Background(), bc.hostname, bc.port, usage)
+	if err != nil {
+		// Error already logged
+		bc.Close()
+		return nil, err
+	}
+	bc.proxyTarget = proxyTarget
+	if proxyTarget != "" {
+		bc.proxyAuth = o.proxyAuthorization()
+	}
+	if tAddr, ok := addr.(*net.TCPAddr); ok && proxyTarget == "" {
+		bc.dnsCache.set(bc.hostname, bc.port, tAddr, bc.dnsCacheTTL)
 	}
 	bc.dest = addr
 	// Create the bytes for the request:
@@ -891,17 +1543,41 @@ func NewFastClient(o *HTTPOptions) (Fetcher, error) { //nolint:funlen
 			buf.WriteString("Connection: close\r\n")
 		}
 	}
-	bc.reqTimeout = o.HTTPReqTimeOut
+	if o.PipeliningDepth > 1 {
+		if bc.keepAlive && bc.dataWriter == nil {
+			bc.pipelining = o.PipeliningDepth
+		} else {
+			log.S(log.Warning, "Pipelining requires HTTP/1.1 keep-alive and no output, ignoring",
+				log.Attr("depth", o.PipeliningDepth), log.Attr("thread", bc.id), log.Attr("run", bc.runID))
+		}
+	}
+	bc.reqTimeout = o.responseTimeout()
+	bc.timeoutJitter = o.TimeoutJitter
+	bc.connectTimeout = o.connectTimeout()
 	w := bufio.NewWriter(&buf)
 	// This writes multiple valued headers properly (unlike calling Get() to do it ourselves)
 	_ = o.GenerateHeaders().Write(w)
 	w.Flush()
 	buf.WriteString("\r\n")
 	// Add the payload to HTTP body
-	if payloadLen > 0 {
+	if o.sendsTrailers() {
+		buf.Write(chunkedBody(o.Payload, o.RequestTrailers))
+	} else if payloadLen > 0 {
 		buf.Write(o.Payload)
 	}
 	bc.req = buf.Bytes()
+	if o.Signer != nil {
+		bc.signer = o.Signer
+		bc.signReq, err = newSignRequest(o, method, host)
+		if err != nil {
+			log.S(log.Error, "Unable to create request to sign", log.Attr("err", err),
+				log.Attr("thread", bc.id), log.Attr("run", bc.runID))
+			bc.Close()
+			return nil, err
+		}
+	}
+	bc.sequence = newSequencer(o.SequenceNumberHeader, o.UniqueID, o.ID)
+	bc.tcpInfo = newTCPInfoState(o.TCPInfo)
 	bc.uuidMarkers = [][]byte{}
 	if len(uuidStrings) > 0 {
 		for _, uuidString := range uuidStrings {
@@ -915,58 +1591,197 @@ func NewFastClient(o *HTTPOptions) (Fetcher, error) { //nolint:funlen
 // return the result from the state.
 func (c *FastClient) returnRes() (int, int64, uint) {
 	if c.dataWriter != nil && c.dataWriter != io.Discard {
-		_, _ = c.dataWriter.Write(c.buffer[:c.size])
+		_, _ = c.dataWriter.Write(c.buffer[:c.size-c.streamed])
 	}
 	return c.code, c.size, c.headerLen
 }
 
+// flush writes the response up to the upTo offset to the dataWriter and moves
+// the rest (not yet parsed or written) to the start of the buffer.
+func (c *FastClient) flush(upTo int64) {
+	n := upTo - c.streamed
+	if n <= 0 {
+		return
+	}
+	if c.dataWriter != io.Discard {
+		_, _ = c.dataWriter.Write(c.buffer[:n])
+	}
+	copy(c.buffer, c.buffer[n:c.size-c.streamed])
+	c.streamed = upTo
+}
+
+// setSocketOptions sets the buffer sizes and TCP_NODELAY of a new connection.
+func (c *FastClient) setSocketOptions(socket net.Conn) {
+	fnet.SetSocketOptions(socket, fnet.SocketOptions{
+		ReadBufferSize:  len(c.buffer),
+		WriteBufferSize: len(c.req),
+		Nagle:           c.nagle,
+	})
+}
+
+// connectProxy connects to the destination through the HTTPProxy: CONNECT tunnel then TLS if https.
+func (c *FastClient) connectProxy(ctx context.Context) (net.Conn, *DelayedErrorReader) {
+	now := time.Now()
+	socket, err := c.proxyTunnel(ctx)
+	c.connectStats.Record(time.Since(now).Seconds())
+	if err != nil {
+		log.S(log.Error, "Unable to connect through proxy", log.Str("proxy", c.dest.String()), log.Str("target", c.proxyTarget),
+			log.Attr("err", err), log.Attr("thread", c.id), log.Attr("run", c.runID))
+		c.errType = ErrorType(err)
+		return nil, nil
+	}
+	c.setSocketOptions(socket)
+	return socket, &DelayedErrorReader{r: socket}
+}
+
+func (c *FastClient) proxyTunnel(ctx context.Context) (net.Conn, error) {
+	d := &net.Dialer{Timeout: c.connectTimeout}
+	conn, err := d.DialContext(ctx, c.dest.Network(), c.dest.String())
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Now().Add(c.connectTimeout))
+	req := "CONNECT " + c.proxyTarget + " HTTP/1.1\r\nHost: " + c.proxyTarget + "\r\n"
+	if c.proxyAuth != "" {
+		req += "Proxy-Authorization: " + c.proxyAuth + "\r\n"
+	}
+	_, err = conn.Write([]byte(req + "\r\n"))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// The proxy doesn't send anything after the CONNECT response until we do, so buffering is safe.
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy CONNECT to %s failed: %s", c.proxyTarget, resp.Status)
+	}
+	if c.https {
+		tlsConn := tls.Client(conn, c.tlsConfig)
+		if err = tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
 // connect to destination.
 func (c *FastClient) connect(ctx context.Context) (net.Conn, *DelayedErrorReader) {
 	c.socketCount++
-	var socket net.Conn
 	var err error
 
+	if c.proxyTarget != "" {
+		return c.connectProxy(ctx)
+	}
+	if c.dualStack() {
+		return c.connectDual(ctx)
+	}
 	// Resolve the DNS name when making new connections.
-	if c.socketCount > 1 && !c.noResolveEachConn {
+	if _, isTCP := c.dest.(*net.TCPAddr); isTCP && c.dnsCacheTTL > 0 {
+		c.dest, err = c.dnsCache.resolve(ctx, c.hostname, c.port, c.resolve, c.dnsCacheTTL, c.ipAddrUsage)
+		if err != nil {
+			log.S(log.Error, "Unable to resolve hostname", log.Str("hostname", c.hostname), log.Attr("err", err),
+				log.Attr("thread", c.id), log.Attr("run", c.runID))
+			c.errType = ErrorType(err)
+			return nil, nil
+		}
+	} else if c.socketCount > 1 && !c.noResolveEachConn {
 		c.dest, err = resolve(ctx, c.hostname, c.port, c.resolve, c.ipAddrUsage)
 		log.Debugf("[%d] Hostname %v resolve to ip %v", c.id, c.hostname, c.dest)
 		if err != nil {
 			log.S(log.Error, "Unable to resolve hostname", log.Str("hostname", c.hostname), log.Attr("err", err),
 				log.Attr("thread", c.id), log.Attr("run", c.runID))
+			c.errType = ErrorType(err)
 			return nil, nil
 		}
 	}
 
-	d := &net.Dialer{Timeout: c.reqTimeout}
+	d := &net.Dialer{}
+	return c.dial(ctx, c.dest.String(), func(ctx context.Context) (net.Conn, error) {
+		return d.DialContext(ctx, c.dest.Network(), c.dest.String())
+	})
+}
+
+// dial connects using dialer, then does the TLS handshake when https, all within the connectTimeout:
+// the connection steps common to the single and dual stack connections.
+func (c *FastClient) dial(ctx context.Context, dest string,
+	dialer func(context.Context) (net.Conn, error),
+) (net.Conn, *DelayedErrorReader) {
+	ctx, cancel := context.WithTimeout(ctx, c.connectTimeout)
+	defer cancel()
 	now := time.Now()
-	if c.https {
-		socket, err = tls.DialWithDialer(d, c.dest.Network(), c.dest.String(), c.tlsConfig)
-		c.connectStats.Record(time.Since(now).Seconds())
-		if err != nil {
-			log.S(log.Error, "Unable to TLS connect", log.Attr("dest", c.dest), log.Attr("err", err),
-				log.Attr("thread", c.id), log.Attr("run", c.runID))
-			return nil, nil
-		}
-	} else {
-		socket, err = d.Dial(c.dest.Network(), c.dest.String())
+	socket, err := dialer(ctx)
+	if err != nil {
 		c.connectStats.Record(time.Since(now).Seconds())
+		log.S(log.Error, "Unable to connect", log.Str("dest", dest), log.Attr("err", err),
+			log.Attr("numfd", scli.NumFD()),
+			log.Attr("thread", c.id), log.Attr("run", c.runID))
+		c.errType = ErrorType(err)
+		return nil, nil
+	}
+	if c.https {
+		tlsConn := tls.Client(socket, c.tlsConfig)
+		err = tlsConn.HandshakeContext(ctx)
 		if err != nil {
-			log.S(log.Error, "Unable to connect", log.Attr("dest", c.dest), log.Attr("err", err),
-				log.Attr("numfd", scli.NumFD()),
+			c.connectStats.Record(time.Since(now).Seconds())
+			socket.Close()
+			log.S(log.Error, "Unable to TLS connect", log.Str("dest", dest), log.Attr("err", err),
 				log.Attr("thread", c.id), log.Attr("run", c.runID))
+			c.errType = ErrorType(err)
+			if c.errType == ErrorTypeSocket {
+				c.errType = ErrorTypeTLS
+			}
 			return nil, nil
 		}
+		socket = tlsConn
 	}
-	fnet.SetSocketBuffers(socket, len(c.buffer), len(c.req))
+	c.connectStats.Record(time.Since(now).Seconds())
+	c.setSocketOptions(socket)
 	return socket, &DelayedErrorReader{r: socket}
 }
 
+// dualStack is true when the "dual" resolve-ip-type is used (and not a unix domain socket).
+func (c *FastClient) dualStack() bool {
+	_, isTCP := c.dest.(*net.TCPAddr)
+	return isTCP && fnet.FlagResolveIPType.Get() == "dual"
+}
+
+// connectDual connects using happy eyeballs and records which address (family) won.
+func (c *FastClient) connectDual(ctx context.Context) (net.Conn, *DelayedErrorReader) {
+	host := c.hostname
+	if c.resolve != "" {
+		host = c.resolve
+	}
+	socket, reader := c.dial(ctx, net.JoinHostPort(host, c.port), func(ctx context.Context) (net.Conn, error) {
+		return fnet.DialHappyEyeballs(ctx, host, c.port)
+	})
+	if socket != nil {
+		c.dest = socket.RemoteAddr()
+		c.ipAddrUsage.Record(c.dest.String())
+	}
+	return socket, reader
+}
+
 // Extra error codes outside of the HTTP Status code ranges. ie negative.
 const (
 	// SocketError is return when a transport error occurred: unexpected EOF, connection error, etc...
 	SocketError = -1
 	// RetryOnce is used internally as an error code to allow 1 retry for bad socket reuse.
 	RetryOnce = -2
+	// SocketErrorReset is the runner's SocketErrorCodes key for the connections reset by the peer.
+	SocketErrorReset = -3
+	// SocketErrorRefused is the runner's SocketErrorCodes key for the refused connections.
+	SocketErrorRefused = -4
+	// SocketErrorTimeout is the runner's SocketErrorCodes key for the timeouts.
+	SocketErrorTimeout = -5
 )
 
 // Fetch fetches the URL content. Returns HTTP code, data, offset of body.
@@ -983,7 +1798,10 @@ func (c *FastClient) Fetch(ctx context.Context) (int, []byte, int) {
 func (c *FastClient) StreamFetch(ctx context.Context) (int, int64, uint) {
 	c.code = SocketError
 	c.size = 0
+	c.streamed = 0
 	c.headerLen = 0
+	c.trailers = nil
+	c.errType = ""
 	// Connect or reuse existing socket:
 	conn := c.socket
 	reader := c.reader
@@ -1000,19 +1818,31 @@ func (c *FastClient) StreamFetch(ctx context.Context) (int, int64, uint) {
 		if conn == nil {
 			return c.returnRes()
 		}
+		c.tcpInfo.newConnection(conn, c.id, c.runID)
 	} else {
 		c.reuseCount++
 		log.Debugf("[%d] Reusing socket %v", c.id, c.dest)
 	}
 	c.socket = nil // because of error returns and single retry
-	conErr := conn.SetDeadline(time.Now().Add(c.reqTimeout))
-	// Send the request:
-	req := c.req
-	if len(c.uuidMarkers) > 0 {
-		for _, uuidMarker := range c.uuidMarkers {
-			req = bytes.Replace(req, uuidMarker, []byte(generateUUID()), 1)
+	conErr := conn.SetDeadline(time.Now().Add(jitteredTimeout(c.reqTimeout, c.timeoutJitter)))
+	// Send the request(s):
+	req := c.nextRequest()
+	if c.pipelining > 1 && req != nil {
+		batch := make([]byte, 0, len(req)*c.pipelining)
+		batch = append(batch, req...)
+		for i := 1; i < c.pipelining && req != nil; i++ {
+			req = c.nextRequest() // each request gets its own uuid(s), range, sequence number and signature
+			batch = append(batch, req...)
+		}
+		if req != nil {
+			req = batch
 		}
 	}
+	if req == nil {
+		c.errType = ErrorTypeSigning
+		conn.Close()
+		return c.returnRes()
+	}
 	n, err := conn.Write(req)
 	if err != nil || conErr != nil {
 		if canReuse {
@@ -1023,10 +1853,11 @@ func (c *FastClient) StreamFetch(ctx context.Context) (int, int64, uint) {
 			return c.StreamFetch(ctx) // recurse once
 		}
 		log.S(log.Error, "Unable to write", log.Attr("err", err), log.Attr("thread", c.id), log.Attr("run", c.runID))
+		c.errType = ErrorType(errors.Join(err, conErr))
 		return c.returnRes()
 	}
-	if n != len(c.req) {
-		log.S(log.Error, "Short write", log.Attr("err", err), log.Attr("actual", n), log.Attr("expected", len(c.req)),
+	if n != len(req) {
+		log.S(log.Error, "Short write", log.Attr("err", err), log.Attr("actual", n), log.Attr("expected", len(req)),
 			log.Attr("thread", c.id), log.Attr("run", c.runID))
 		return c.returnRes()
 	}
@@ -1043,16 +1874,101 @@ func (c *FastClient) StreamFetch(ctx context.Context) (int, int64, uint) {
 				log.Attr("err", err), log.Attr("thread", c.id), log.Attr("run", c.runID))
 		}
 	}
+	if c.pipelining > 1 {
+		code, size, headerLen := c.readPipelinedResponses(ctx, reader, conn, canReuse)
+		c.tcpInfo.sample(c.socket, c.id, c.runID)
+		return code, size, headerLen
+	}
 	// Read the response:
 	c.readResponse(reader, conn, canReuse)
 	if c.code == RetryOnce {
 		// Special "eof on reused socket" code
 		return c.StreamFetch(ctx) // recurse once
 	}
+	c.tcpInfo.sample(c.socket, c.id, c.runID) // nil (no sample) if the connection was closed.
 	// Return the result:
 	return c.returnRes()
 }
 
+// nextRequest returns the request to send: c.req or, when needed, a copy with new uuid(s), random range,
+// sequence number and signature. Returns nil if signing failed.
+func (c *FastClient) nextRequest() []byte {
+	req := c.req
+	if len(c.uuidMarkers) > 0 {
+		req = c.replaceUUIDs(req)
+	}
+	if c.rangeLength > 0 {
+		req = insertHeader(req, rangeHeader, randomRange(c.rangeLength))
+	}
+	if c.sequence.header != "" {
+		req = insertHeader(req, c.sequence.header, c.sequence.next())
+	}
+	if c.signer != nil {
+		req = c.sign(req)
+	}
+	return req
+}
+
+// replaceUUIDs returns a copy of req with each uuid marker replaced by a new uuid.
+func (c *FastClient) replaceUUIDs(req []byte) []byte {
+	for _, uuidMarker := range c.uuidMarkers {
+		req = bytes.Replace(req, uuidMarker, []byte(generateUUID()), 1)
+	}
+	return req
+}
+
+// readPipelinedResponses reads, in order, the c.pipelining responses to the requests sent back to back.
+// The returned code is the first non ok one (or SocketError if fewer responses than requests
+// were received), the size is the total of all the responses and the header length is the last one's.
+// The buffer only has the last response read.
+func (c *FastClient) readPipelinedResponses(ctx context.Context, reader *DelayedErrorReader, conn net.Conn,
+	canReuse bool,
+) (int, int64, uint) {
+	var total int64
+	for i := range c.pipelining {
+		c.pipelineMore = i < c.pipelining-1
+		c.respEnd = -1
+		c.headerLen = 0
+		c.socket = nil
+		c.readResponse(reader, conn, canReuse && i == 0)
+		if c.code == RetryOnce {
+			c.pipelineMore = false
+			return c.StreamFetch(ctx) // recurse once
+		}
+		if !c.cache.ok(c.code) {
+			c.pipelineMore = false
+			if i > 0 && c.code == SocketError {
+				log.S(log.Error, "Pipelined response count mismatch", log.Attr("received", i),
+					log.Attr("expected", c.pipelining), log.Attr("thread", c.id), log.Attr("run", c.runID))
+			} else if i > 0 {
+				log.S(log.Error, "Pipelined response error", log.Attr("code", c.code), log.Attr("response", i+1),
+					log.Attr("expected", c.pipelining), log.Attr("thread", c.id), log.Attr("run", c.runID))
+			}
+			return c.code, total + c.size, c.headerLen
+		}
+		if c.pipelineMore && (c.socket == nil || c.respEnd < 0) {
+			// connection closed (or response not delimited) before all the responses were received
+			log.S(log.Error, "Pipelined response count mismatch", log.Attr("received", i+1),
+				log.Attr("expected", c.pipelining), log.Attr("thread", c.id), log.Attr("run", c.runID))
+			if c.socket != nil {
+				_ = reader.Close()
+				c.socket = nil
+			}
+			c.pipelineMore = false
+			c.code = SocketError
+			return c.code, total + c.size, c.headerLen
+		}
+		if !c.pipelineMore {
+			break
+		}
+		// Move the beginning of the next response, if already read, to the start of the buffer:
+		total += c.respEnd
+		c.size = safecast.MustConvert[int64](copy(c.buffer, c.buffer[c.respEnd:c.size]))
+	}
+	c.pipelineMore = false
+	return c.code, total + c.size, c.headerLen
+}
+
 func codeIsOK(code int) bool {
 	// TODO: make this configurable
 	return (code >= 200 && code <= 299) || code == http.StatusTeapot
@@ -1086,11 +2002,32 @@ func (d *DelayedErrorReader) Close() error {
 	return d.err
 }
 
+// growForHeaders grows the buffer, when it's full of incomplete headers and HeaderBufferKb allows it,
+// so the headers can be up to headerBufferSize with BufferSizeKb for the body after them.
+// Returns false when it can't grow (anymore).
+func (c *FastClient) growForHeaders() bool {
+	if c.headerBufferSize <= len(c.buffer) {
+		return false
+	}
+	newBuffer := make([]byte, c.headerBufferSize+BufferSizeKb*1024)
+	copy(newBuffer, c.buffer[:c.size-c.streamed])
+	log.S(log.Info, "Growing buffer for large headers", log.Attr("from", len(c.buffer)), log.Attr("to", len(newBuffer)),
+		log.Attr("thread", c.id), log.Attr("run", c.runID))
+	c.buffer = newBuffer
+	return true
+}
+
 // Response reading:
 //
 //nolint:nestif,funlen,gocognit,gocyclo,maintidx // TODO: refactor - unwiedly/ugly atm.
 func (c *FastClient) readResponse(conn *DelayedErrorReader, socket net.Conn, reusedSocket bool) {
 	maxV := safecast.MustConvert[int64](len(c.buffer))
+	// With a dataWriter the response is streamed to it as it arrives, the buffer then only
+	// needs to hold the headers (and chunk sizes) and doesn't limit the body size.
+	streaming := c.dataWriter != nil
+	if streaming && !c.parseHeaders {
+		maxV = math.MaxInt64
+	}
 	parsedHeaders := false
 	// TODO: safer to start with -1 / SocketError and fix ok for HTTP/1.0
 	c.code = http.StatusOK // In HTTP/1.0 mode we don't bother parsing anything
@@ -1098,12 +2035,16 @@ func (c *FastClient) readResponse(conn *DelayedErrorReader, socket net.Conn, reu
 	keepAlive := c.keepAlive
 	chunkedMode := false
 	checkConnectionClosedHeader := CheckConnectionClosedHeader
-	skipRead := false
+	// Pipelined responses can start with data already read along with the previous one.
+	skipRead := c.size > 0
 	for {
 		// Ugly way to cover the case where we get more than 1 chunk at the end
 		// TODO: need automated tests
 		if !skipRead {
-			nI, err := conn.Read(c.buffer[c.size:])
+			if streaming && (parsedHeaders || !c.parseHeaders) {
+				c.flush(min(maxV, c.size))
+			}
+			nI, err := conn.Read(c.buffer[c.size-c.streamed:])
 			n := safecast.MustConvert[int64](nI)
 			if err != nil {
 				if reusedSocket && c.size == 0 {
@@ -1131,12 +2072,13 @@ func (c *FastClient) readResponse(conn *DelayedErrorReader, socket net.Conn, reu
 					log.Attr("dest", c.dest), log.Str("url", c.url),
 					log.Attr("thread", c.id), log.Attr("run", c.runID))
 				c.code = SocketError
+				c.errType = ErrorType(err)
 				break
 			}
 			c.size += n
 			if log.LogDebug() {
 				log.Debugf("[%d] Read ok %d total %d so far (-%d headers = %d data) %s",
-					c.id, n, c.size, c.headerLen, c.size-safecast.MustConvert[int64](c.headerLen), DebugSummary(c.buffer[c.size-n:c.size], 256))
+					c.id, n, c.size, c.headerLen, c.size-safecast.MustConvert[int64](c.headerLen), DebugSummary(c.buffer[c.size-c.streamed-n:c.size-c.streamed], 256))
 			}
 		}
 		skipRead = false
@@ -1145,8 +2087,16 @@ func (c *FastClient) readResponse(conn *DelayedErrorReader, socket net.Conn, reu
 		if !parsedHeaders && c.parseHeaders && c.size >= retcodeOffset+3 {
 			// even if the bytes are garbage we'll get a non 200 code (bytes are unsigned)
 			c.code = int(ParseDecimal(c.buffer[retcodeOffset : retcodeOffset+3])) // TODO do that only once...
+			if c.code == http.StatusSwitchingProtocols {
+				// Nothing more will be an http response on this connection.
+				c.wsUpgrades.upgraded(c.url, c.id, c.runID)
+				c.code = SocketError
+				c.errType = ErrorTypeWebSocketUpgrade
+				keepAlive = false
+				break
+			}
 			// TODO handle 100 Continue, make the "ok" codes configurable
-			if !codeIsOK(c.code) {
+			if !c.cache.ok(c.code) {
 				if c.logErrors {
 					log.S(log.Warning, "Non ok http code", log.Attr("code", c.code), log.Str("status", string(c.buffer[:retcodeOffset+3])),
 						log.Attr("thread", c.id), log.Attr("run", c.runID))
@@ -1177,11 +2127,31 @@ func (c *FastClient) readResponse(conn *DelayedErrorReader, socket net.Conn, reu
 				if log.LogDebug() {
 					log.Debugf("[%d] headers are %d: %q", c.id, c.headerLen, c.buffer[:idx])
 				}
+				if c.hsts.detect {
+					c.checkHSTS()
+				}
+				if c.dedup.header != "" {
+					c.dedup.check(c.headerValue(c.dedup.rawHeader), c.url, c.id, c.runID)
+				}
+				if c.serverTiming.enabled {
+					c.serverTiming.checkRaw(c.buffer[:c.headerLen-4])
+				}
+				if len(c.forbidden.names) > 0 {
+					c.forbidden.checkRaw(c.buffer[:c.headerLen-4], c.url, c.id, c.runID)
+				}
+				if c.cache.needed(c.code) {
+					c.storeValidator()
+				}
+				if streaming && !keepAlive {
+					maxV = math.MaxInt64 // read until the server closes the connection
+				}
 				// Find the content length or chunked mode
 				if keepAlive {
 					var contentLength int64
 					found, offset := FoldFind(c.buffer[:c.headerLen], contentLengthHeader)
-					if found {
+					if c.code == http.StatusNotModified {
+						maxV = safecast.MustConvert[int64](c.headerLen) // never has a body
+					} else if found {
 						// Content-Length mode:
 						contentLength = ParseDecimal(c.buffer[offset+len(contentLengthHeader) : c.headerLen])
 						if contentLength < 0 {
@@ -1207,6 +2177,10 @@ func (c *FastClient) readResponse(conn *DelayedErrorReader, socket net.Conn, reu
 								continue
 							}
 							maxV = safecast.MustConvert[int64](c.headerLen) + dataStart + contentLength + 2 // extra CR LF
+							if contentLength == 0 {
+								// Empty body: the last chunk (and its trailers) get parsed as the next chunk below.
+								maxV = safecast.MustConvert[int64](c.headerLen)
+							}
 							log.Debugf("[%d] chunk-length is %d (%s) setting max to %d",
 								c.id, contentLength, c.buffer[c.headerLen:safecast.MustConvert[int64](c.headerLen)+dataStart-2],
 								maxV)
@@ -1221,8 +2195,8 @@ func (c *FastClient) readResponse(conn *DelayedErrorReader, socket net.Conn, reu
 							break
 						}
 					} // end of content-length section
-					if maxV > safecast.MustConvert[int64](len(c.buffer)) {
-						log.S(log.Warning, "Buffer is too small for headers + data - change -httpbufferkb flag",
+					if !streaming && maxV > safecast.MustConvert[int64](len(c.buffer)) {
+						log.S(log.Warning, "Buffer is too small for headers + data - change -httpbufferkb (or -httpheaderbufferkb) flag",
 							log.Attr("header_len", c.headerLen),
 							log.Attr("content_length", contentLength),
 							log.Attr("buffer_needed", (safecast.MustConvert[int64](c.headerLen)+contentLength)/1024+1),
@@ -1236,46 +2210,61 @@ func (c *FastClient) readResponse(conn *DelayedErrorReader, socket net.Conn, reu
 							log.S(log.Info, "Server wants to close connection, no keep-alive!", log.Attr("thread", c.id), log.Attr("run", c.runID))
 							keepAlive = false
 							maxV = safecast.MustConvert[int64](len(c.buffer)) // reset to read as much as available
+							if streaming {
+								maxV = math.MaxInt64
+							}
 						}
 					}
 				}
 			}
 		} // end of big if parse header
 		if c.size >= maxV {
+			if !parsedHeaders && c.parseHeaders && c.growForHeaders() {
+				maxV = safecast.MustConvert[int64](len(c.buffer))
+				continue
+			}
 			if !keepAlive {
 				log.S(log.Error, "More data is available but stopping after max, increase -httpbufferkb",
 					log.Attr("max", maxV), log.Attr("thread", c.id), log.Attr("run", c.runID))
 			}
 			if !parsedHeaders && c.parseHeaders {
-				log.S(log.Error, "Buffer too small to even finish reading headers, increase -httpbufferkb to get all the data",
+				log.S(log.Error, "Buffer too small to even finish reading headers, increase -httpheaderbufferkb (or -httpbufferkb)",
 					log.Attr("max", maxV), log.Attr("thread", c.id), log.Attr("run", c.runID))
 				keepAlive = false
 			}
+			c.respEnd = maxV
 			if chunkedMode {
 				// Next chunk:
-				dataStart, nextChunkLen := ParseChunkSize(c.buffer[maxV:c.size])
+				dataStart, nextChunkLen := ParseChunkSize(c.buffer[maxV-c.streamed : c.size-c.streamed])
 				switch nextChunkLen {
 				case -1:
 					if c.size == maxV {
 						log.Debugf("[%d] Couldn't find next chunk size, reading more %d %d", c.id, maxV, c.size)
 					} else {
 						log.S(log.Info, "Partial chunk size, reading more",
-							log.Str("buf", DebugSummary(c.buffer[maxV:c.size], 20)), log.Attr("max", maxV), log.Attr("size", c.size),
+							log.Str("buf", DebugSummary(c.buffer[maxV-c.streamed:c.size-c.streamed], 20)), log.Attr("max", maxV), log.Attr("size", c.size),
 							log.Attr("thread", c.id), log.Attr("run", c.runID))
 					}
 					continue
 				case 0:
 					log.Debugf("[%d] Found last chunk %d %d", c.id, maxV+dataStart, c.size)
-					if c.size != maxV+dataStart+2 || string(c.buffer[c.size-2:c.size]) != "\r\n" {
+					// Optional trailers then the final CR LF:
+					end := c.parseTrailers(maxV + dataStart)
+					if end < 0 {
+						log.Debugf("[%d] End of trailers not found yet, reading more %d %d", c.id, maxV, c.size)
+						continue
+					}
+					c.respEnd = end
+					if (c.size != end && !c.pipelineMore) || string(c.buffer[end-c.streamed-2:end-c.streamed]) != "\r\n" {
 						log.S(log.Error, "Unexpected mismatch at the end",
-							log.Attr("size", c.size), log.Attr("expected", maxV+dataStart+2),
-							log.Attr("end-of_buffer", c.buffer[maxV:c.size]),
+							log.Attr("size", c.size), log.Attr("expected", end),
+							log.Attr("end-of_buffer", c.buffer[maxV-c.streamed:c.size-c.streamed]),
 							log.Attr("thread", c.id), log.Attr("run", c.runID))
 					}
 				default:
 					maxV += dataStart + nextChunkLen + 2 // extra CR LF
 					log.Debugf("[%d] One more chunk %d -> new max %d", c.id, nextChunkLen, maxV)
-					if maxV > safecast.MustConvert[int64](len(c.buffer)) {
+					if !streaming && maxV > safecast.MustConvert[int64](len(c.buffer)) {
 						log.S(log.Error, "Buffer too small for data", log.Attr("size", maxV), log.Attr("thread", c.id), log.Attr("run", c.runID))
 					} else {
 						if maxV <= c.size {
@@ -1290,7 +2279,7 @@ func (c *FastClient) readResponse(conn *DelayedErrorReader, socket net.Conn, reu
 		}
 	} // end of big for loop
 	// Figure out whether to keep or close the socket:
-	if keepAlive && codeIsOK(c.code) && !c.reachedReuseThreshold() {
+	if keepAlive && c.cache.ok(c.code) && (c.pipelineMore || !c.reachedReuseThreshold()) {
 		c.socket = socket // keep the open socket
 		c.reader = conn
 	} else {
@@ -1304,6 +2293,67 @@ func (c *FastClient) readResponse(conn *DelayedErrorReader, socket net.Conn, reu
 	}
 }
 
+// headerValue returns the (trimmed) value of the header (CRLF prefixed, colon terminated) in the
+// response headers, empty if not found.
+func (c *FastClient) headerValue(header []byte) string {
+	found, offset := FoldFind(c.buffer[:c.headerLen], header)
+	if !found {
+		return ""
+	}
+	value := c.buffer[offset+len(header) : c.headerLen]
+	if end := bytes.Index(value, []byte("\r\n")); end >= 0 {
+		value = value[:end]
+	}
+	return strings.TrimSpace(string(value))
+}
+
+// checkHSTS looks for the Strict-Transport-Security header in the response headers.
+func (c *FastClient) checkHSTS() {
+	if value := c.headerValue(hstsHeader); value != "" {
+		c.hsts.check(value, c.url, c.id, c.runID)
+	}
+}
+
+// storeValidator looks for the ETag or Last-Modified response header and, if found, adds
+// the corresponding conditional header to the request sent from now on.
+func (c *FastClient) storeValidator() {
+	name, value := c.cache.conditionalHeader(c.headerValue(etagHeader), c.headerValue(lastModifiedHeader), c.id, c.runID)
+	if name == "" {
+		return
+	}
+	c.req = insertHeader(c.req, name, value)
+}
+
+// parseTrailers parses the (possibly empty) trailers section of a chunked response starting at
+// (response) offset start, right after the last chunk size line, into c.trailers. Returns the offset of
+// the end of the response (after the final CR LF) or -1 if it's not all in the buffer yet.
+func (c *FastClient) parseTrailers(start int64) int64 {
+	section := c.buffer[start-c.streamed : c.size-c.streamed]
+	if bytes.HasPrefix(section, []byte("\r\n")) {
+		return start + 2 // no trailers
+	}
+	idx := bytes.Index(section, []byte("\r\n\r\n"))
+	if idx < 0 {
+		return -1
+	}
+	c.trailers = make(http.Header)
+	for _, line := range strings.Split(string(section[:idx]), "\r\n") {
+		k, v, found := strings.Cut(line, ":")
+		if !found {
+			log.S(log.Warning, "Invalid trailer line", log.Str("line", line), log.Attr("thread", c.id), log.Attr("run", c.runID))
+			continue
+		}
+		c.trailers.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+	}
+	log.Debugf("[%d] Trailers: %v", c.id, c.trailers)
+	return start + int64(idx) + 4
+}
+
+// Trailers returns the trailers of the last (chunked) response, nil if there weren't any.
+func (c *FastClient) Trailers() http.Header {
+	return c.trailers
+}
+
 // Check if current thread reached the connection reuse threshold.
 func (c *FastClient) reachedReuseThreshold() bool {
 	if c.connReuse != 0 && c.reuseCount >= c.connReuse {
@@ -1345,3 +2395,43 @@ func resolve(ctx context.Context, hostname string, port string,
 
 	return addr, err
 }
+
+// dnsCache is the per client cache of the resolved address used when DNSCacheTTL is set.
+type dnsCache struct {
+	mu      sync.Mutex // the std client can dial concurrently
+	key     string     // host:port the addr is for
+	addr    *net.TCPAddr
+	expires time.Time
+}
+
+func (d *dnsCache) set(hostname, port string, addr *net.TCPAddr, ttl time.Duration) {
+	d.mu.Lock()
+	d.key = net.JoinHostPort(hostname, port)
+	d.addr = addr
+	d.expires = time.Now().Add(ttl)
+	d.mu.Unlock()
+}
+
+// resolve returns the cached address for hostname:port if it hasn't expired yet,
+// otherwise resolves it again (recording the new ip in ipAddrUsage) and caches it for ttl.
+func (d *dnsCache) resolve(ctx context.Context, hostname, port, overrideIP string, ttl time.Duration,
+	ipAddrUsage *stats.Occurrence,
+) (*net.TCPAddr, error) {
+	key := net.JoinHostPort(hostname, port)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	if d.addr != nil && d.key == key && now.Before(d.expires) {
+		log.Debugf("Using cached %v for %s, expires in %v", d.addr, key, d.expires.Sub(now))
+		return d.addr, nil
+	}
+	addr, err := resolve(ctx, hostname, port, overrideIP, ipAddrUsage)
+	if err != nil {
+		return nil, err
+	}
+	log.LogVf("DNS cache for %s (re)resolved to %v for %v", key, addr, ttl)
+	d.key = key
+	d.addr = addr
+	d.expires = now.Add(ttl)
+	return addr, nil
+}
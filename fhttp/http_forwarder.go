@@ -24,6 +24,7 @@ import (
 	"net"
 	"net/http"
 	"net/textproto"
+	"path"
 	"strconv"
 	"strings"
 	"sync"
@@ -49,6 +50,13 @@ type TargetConf struct {
 	//	Return       bool   // Will return the result of this target
 }
 
+// SNIRoute configures a MultiServer route: the requests for the hosts matching SNIPattern
+// (see path.Match, e.g. *.example.com) are proxied (like MirrorOrigin targets) to Destination only.
+type SNIRoute struct {
+	SNIPattern  string
+	Destination string
+}
+
 // MultiServerConfig configures the MultiServer and holds the HTTP client it uses for proxying.
 type MultiServerConfig struct {
 	Targets []TargetConf
@@ -56,6 +64,9 @@ type MultiServerConfig struct {
 	//	Javascript bool // return data as UI suitable
 	Name   string
 	client *http.Client
+	// Optional routes, checked in order against the TLS server name (SNI) or, for plain HTTP requests,
+	// the Host header. The requests not matching any are sent to the Targets.
+	SNIRouting []SNIRoute
 }
 
 func makeMirrorRequest(baseURL string, r *http.Request, data []byte) *http.Request {
@@ -139,6 +150,15 @@ func (mcfg *MultiServerConfig) TeeHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 	r.Body.Close()
+	if route := mcfg.sniRoute(r); route != nil {
+		log.LogVf("Routing %s to %s (%s)", r.Host, route.Destination, route.SNIPattern)
+		mcfg.teeSerial(w, r, data, []TargetConf{{Destination: route.Destination, MirrorOrigin: true}})
+		return
+	}
+	if len(mcfg.Targets) == 0 {
+		http.Error(w, "no route for "+r.Host, http.StatusNotFound)
+		return
+	}
 	if mcfg.Serial {
 		mcfg.TeeSerialHandler(w, r, data)
 	} else {
@@ -163,10 +183,35 @@ func setupRequest(r *http.Request, i int, t TargetConf, data []byte) *http.Reque
 	return req
 }
 
+// sniRoute returns the first of the SNIRouting whose pattern matches the request's server name
+// (or host, without port), nil if none does.
+func (mcfg *MultiServerConfig) sniRoute(r *http.Request) *SNIRoute {
+	if len(mcfg.SNIRouting) == 0 {
+		return nil
+	}
+	host := r.Host
+	if r.TLS != nil && r.TLS.ServerName != "" {
+		host = r.TLS.ServerName
+	} else if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	for i := range mcfg.SNIRouting {
+		if match, _ := path.Match(mcfg.SNIRouting[i].SNIPattern, host); match {
+			return &mcfg.SNIRouting[i]
+		}
+	}
+	return nil
+}
+
 // TeeSerialHandler handles teeing off traffic in serial (one at a time) mode.
 func (mcfg *MultiServerConfig) TeeSerialHandler(w http.ResponseWriter, r *http.Request, data []byte) {
+	mcfg.teeSerial(w, r, data, mcfg.Targets)
+}
+
+func (mcfg *MultiServerConfig) teeSerial(w http.ResponseWriter, r *http.Request, data []byte, targets []TargetConf) {
 	first := true
-	for i, t := range mcfg.Targets {
+	for i, t := range targets {
 		req := setupRequest(r, i, t, data)
 		if req == nil {
 			continue
@@ -290,6 +335,15 @@ func CreateProxyClient() *http.Client {
 // The port can be retrieved from it when requesting the 0 port as
 // input for dynamic HTTP server.
 func MultiServer(port string, cfg *MultiServerConfig) (*http.ServeMux, net.Addr) {
+	for i := range cfg.SNIRouting {
+		route := &cfg.SNIRouting[i]
+		route.SNIPattern = strings.ToLower(route.SNIPattern)
+		if _, err := path.Match(route.SNIPattern, ""); err != nil {
+			log.Errf("Invalid SNI routing pattern %q: %v", route.SNIPattern, err)
+			return nil, nil
+		}
+		route.Destination = normalizeDestination(route.Destination, true)
+	}
 	hName := cfg.Name
 	if hName == "" {
 		hName = "Multi on " + port // port could be :0 for dynamic...
@@ -306,15 +360,22 @@ func MultiServer(port string, cfg *MultiServerConfig) (*http.ServeMux, net.Addr)
 	cfg.client = CreateProxyClient()
 	for i := range cfg.Targets {
 		t := &cfg.Targets[i]
-		if t.MirrorOrigin {
-			t.Destination = strings.TrimSuffix(t.Destination, "/") // remove trailing / because we will concatenate the request URI
-		}
-		if !strings.HasPrefix(t.Destination, fnet.PrefixHTTPS) && !strings.HasPrefix(t.Destination, fnet.PrefixHTTP) {
-			log.Infof("Assuming http:// on missing scheme for '%s'", t.Destination)
-			t.Destination = fnet.PrefixHTTP + t.Destination
-		}
+		t.Destination = normalizeDestination(t.Destination, t.MirrorOrigin)
 	}
 	log.Infof("Multi-server on %s running with %+v", aStr, cfg)
 	mux.HandleFunc("/", cfg.TeeHandler)
 	return mux, addr
 }
+
+// normalizeDestination adds the missing http:// scheme to dest and, when mirroring the origin
+// requests, removes its trailing / as the request URI gets concatenated.
+func normalizeDestination(dest string, mirrorOrigin bool) string {
+	if mirrorOrigin {
+		dest = strings.TrimSuffix(dest, "/")
+	}
+	if !strings.HasPrefix(dest, fnet.PrefixHTTPS) && !strings.HasPrefix(dest, fnet.PrefixHTTP) {
+		log.Infof("Assuming http:// on missing scheme for '%s'", dest)
+		dest = fnet.PrefixHTTP + dest
+	}
+	return dest
+}
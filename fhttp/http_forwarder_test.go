@@ -16,7 +16,9 @@ package fhttp
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"testing"
 
@@ -115,3 +117,48 @@ func TestMultiProxyErrors(t *testing.T) {
 		}
 	}
 }
+
+func TestMultiProxySNIRouting(t *testing.T) {
+	_, defaultAddr := ServeTCP("0", "/debug")
+	_, routedAddr := ServeTCP("0", "/debug")
+	mcfg := MultiServerConfig{
+		Targets:    []TargetConf{{Destination: fmt.Sprintf("localhost:%d/", defaultAddr.Port), MirrorOrigin: true}},
+		SNIRouting: []SNIRoute{{SNIPattern: "*.Routed.test", Destination: fmt.Sprintf("localhost:%d/", routedAddr.Port)}},
+	}
+	_, multiAddr := MultiServer("0", &mcfg)
+	url := fmt.Sprintf("http://%s/debug", multiAddr)
+	tests := []struct {
+		host     string
+		expected int
+	}{
+		{"foo.routed.test", routedAddr.Port},
+		{"FOO.routed.test:8080", routedAddr.Port},
+		{"routed.test", defaultAddr.Port},
+		{"localhost", defaultAddr.Port},
+	}
+	for _, tst := range tests {
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+		req.Host = tst.host
+		req.Header.Set("Accept-Encoding", "identity") // mirrored, the response headers aren't.
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Error for %s: %v", tst.host, err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		searchFor := fmt.Sprintf("\nHost: localhost:%d\n", tst.expected)
+		if resp.StatusCode != http.StatusOK || !bytes.Contains(data, []byte(searchFor)) {
+			t.Errorf("Host %s: got %d, missing %q in %s", tst.host, resp.StatusCode, searchFor, DebugSummary(data, 1024))
+		}
+	}
+	// Routes only: 404 for the non matching hosts.
+	mcfg = MultiServerConfig{SNIRouting: []SNIRoute{{SNIPattern: "*.routed.test", Destination: fmt.Sprintf("localhost:%d/", routedAddr.Port)}}}
+	_, multiAddr = MultiServer("0", &mcfg)
+	if code, data := Fetch(&HTTPOptions{URL: fmt.Sprintf("http://%s/debug", multiAddr)}); code != http.StatusNotFound {
+		t.Errorf("Got %d %s instead of 404 for no matching route", code, DebugSummary(data, 256))
+	}
+	mcfg = MultiServerConfig{SNIRouting: []SNIRoute{{SNIPattern: "[bad", Destination: "localhost"}}}
+	if _, addr := MultiServer("0", &mcfg); addr != nil {
+		t.Errorf("Expected error for bad pattern, got %v", addr)
+	}
+}
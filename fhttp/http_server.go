@@ -154,6 +154,7 @@ func echoHandler(w http.ResponseWriter, r *http.Request) {
 	if reqNum > 0 {
 		jrpc.SetHeaderIfMissing(w.Header(), "x-fortio-id", strconv.FormatInt(reqNum, 10))
 	}
+	declareEchoTrailers(w, r)
 	w.WriteHeader(status)
 	if h2Mode {
 		// h2 non gzip, non size case: stream the body back
@@ -170,6 +171,7 @@ func echoHandler(w http.ResponseWriter, r *http.Request) {
 			log.Errf("Error writing response %v to %v", err, r.RemoteAddr)
 		}
 	}
+	echoTrailers(w, r)
 }
 
 // handleCommonArgs common flags for debug and echo handlers from query string only.
@@ -244,6 +246,12 @@ func HTTPServer(name string, port string) (*http.ServeMux, net.Addr) {
 // Port can include binding address and/or be port 0.
 // Takes in a handler.
 func HTTPServerWithHandler(name string, port string, hdlr http.Handler) net.Addr {
+	return HTTPServerWithOptions(name, port, hdlr, fnet.ListenOptions{})
+}
+
+// HTTPServerWithOptions is HTTPServerWithHandler with listener options, e.g. ReusePort
+// to have multiple servers (listeners) sharing the same port.
+func HTTPServerWithOptions(name string, port string, hdlr http.Handler, opts fnet.ListenOptions) net.Addr {
 	h2s := &http2.Server{}
 	s := &http.Server{
 		ReadHeaderTimeout: ServerIdleTimeout.Get(),
@@ -251,7 +259,7 @@ func HTTPServerWithHandler(name string, port string, hdlr http.Handler) net.Addr
 		Handler:           h2c.NewHandler(hdlr, h2s),
 		ErrorLog:          log.NewStdLogger("http2c srv "+name, log.Error),
 	}
-	listener, addr := fnet.Listen(name, port)
+	listener, addr := fnet.ListenWithOptions(name, port, opts)
 	if listener == nil {
 		return nil // error already logged
 	}
@@ -476,6 +484,9 @@ func ServeTLS(port, debugPath string, to *TLSOptions) (*http.ServeMux, net.Addr)
 		mux.Handle(debugPath, Gzip(http.HandlerFunc(DebugHandler)))
 		mux.HandleFunc(EchoDebugPath(debugPath), EchoHandler) // Fix #524
 	}
+	if WebDAVPath != "" {
+		mux.HandleFunc(WebDAVPath, WebDAVHandler)
+	}
 	mux.HandleFunc("/", EchoHandler)
 	return mux, addr
 }
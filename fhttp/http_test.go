@@ -15,23 +15,33 @@
 package fhttp
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
 	"time"
 	"unicode/utf8"
 
 	"fortio.org/fortio/fnet"
 	"fortio.org/fortio/jrpc"
+	"fortio.org/fortio/stats"
 	"fortio.org/log"
 	"github.com/google/uuid"
 )
@@ -608,6 +618,212 @@ func TestReadtimeout(t *testing.T) {
 	}
 }
 
+func TestConnectAndResponseTimeouts(t *testing.T) {
+	m, a := DynamicHTTPServer(false)
+	m.HandleFunc("/", EchoHandler)
+	url := fmt.Sprintf("http://localhost:%d/?delay=300ms", a.Port)
+	for _, stdClient := range []bool{false, true} {
+		// Response timeout shorter than the delay: error even with a long overall timeout.
+		opts := NewHTTPOptions(url)
+		opts.DisableFastClient = stdClient
+		opts.HTTPReqTimeOut = 5 * time.Second
+		opts.ResponseTimeout = 100 * time.Millisecond
+		cli, _ := NewClient(opts)
+		if code, _, _ := cli.Fetch(context.Background()); code != -1 {
+			t.Errorf("std %v: unexpected code %d with short response timeout", stdClient, code)
+		}
+		cli.Close()
+		// Short (but sufficient for localhost) connect timeout doesn't limit the response time.
+		opts = NewHTTPOptions(url)
+		opts.DisableFastClient = stdClient
+		opts.HTTPReqTimeOut = 100 * time.Millisecond
+		opts.ConnectTimeout = 100 * time.Millisecond
+		opts.ResponseTimeout = 2 * time.Second
+		cli, _ = NewClient(opts)
+		if code, _, _ := cli.Fetch(context.Background()); code != http.StatusOK {
+			t.Errorf("std %v: unexpected code %d with long response timeout", stdClient, code)
+		}
+		cli.Close()
+	}
+	opts := HTTPOptions{HTTPReqTimeOut: 3 * time.Second, ConnectTimeout: time.Second}
+	if opts.connectTimeout() != time.Second || opts.responseTimeout() != 3*time.Second {
+		t.Errorf("unexpected timeouts %v %v", opts.connectTimeout(), opts.responseTimeout())
+	}
+}
+
+func TestTimeoutJitter(t *testing.T) {
+	if d := jitteredTimeout(time.Second, 0); d != time.Second {
+		t.Errorf("Expected no change without jitter, got %v", d)
+	}
+	for range 100 {
+		d := jitteredTimeout(time.Second, 100*time.Millisecond)
+		if d < 900*time.Millisecond || d > 1100*time.Millisecond {
+			t.Errorf("Jittered timeout %v out of range", d)
+		}
+		if d = jitteredTimeout(10*time.Millisecond, time.Second); d < time.Millisecond {
+			t.Errorf("Jittered timeout %v below 1ms", d)
+		}
+	}
+	m, a := DynamicHTTPServer(false)
+	m.HandleFunc("/", EchoHandler)
+	url := fmt.Sprintf("http://localhost:%d/?delay=100ms", a.Port)
+	for _, stdClient := range []bool{false, true} {
+		// Timeouts between 10ms and 190ms for a 100ms response: some requests time out, some don't.
+		opts := NewHTTPOptions(url)
+		opts.DisableFastClient = stdClient
+		opts.HTTPReqTimeOut = 100 * time.Millisecond
+		opts.TimeoutJitter = 90 * time.Millisecond
+		opts.DisableKeepAlive = true // don't lose time reconnecting the fast client after timeouts
+		cli, _ := NewClient(opts)
+		codes := map[int]int{}
+		for range 16 {
+			code, _, _ := cli.StreamFetch(context.Background())
+			codes[code]++
+		}
+		cli.Close()
+		if codes[http.StatusOK] == 0 || codes[-1] == 0 || codes[http.StatusOK]+codes[-1] != 16 {
+			t.Errorf("std %v: expected both successes and timeouts, got %v", stdClient, codes)
+		}
+	}
+}
+
+func TestHMACSigner(t *testing.T) {
+	m, a := DynamicHTTPServer(false)
+	var valid, invalid atomic.Int64
+	bodies := make(chan string, 10)
+	m.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ts := r.Header.Get(SignatureTimestampHeader)
+		if ts != "" && r.Header.Get("X-Sig") == HMACSHA256Signature("s3cr3t", body, ts) {
+			valid.Add(1)
+			bodies <- string(body)
+			return
+		}
+		invalid.Add(1)
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	for _, stdClient := range []bool{false, true} {
+		opts := NewHTTPOptions(fmt.Sprintf("http://localhost:%d/{uuid}", a.Port))
+		opts.DisableFastClient = stdClient
+		opts.Payload = []byte("payload {uuid}")
+		opts.Signer = HMACSHA256Signer("s3cr3t", "X-Sig")
+		cli, _ := NewClient(opts)
+		for range 3 {
+			if code, _, _ := cli.StreamFetch(context.Background()); code != http.StatusOK {
+				t.Errorf("std %v: unexpected code %d for signed request", stdClient, code)
+			}
+		}
+		cli.Close()
+	}
+	if valid.Load() != 6 || invalid.Load() != 0 {
+		t.Errorf("Expected 6 valid signatures, got %d valid and %d invalid", valid.Load(), invalid.Load())
+	}
+	close(bodies)
+	seen := map[string]bool{}
+	for b := range bodies {
+		seen[b] = true
+	}
+	if len(seen) != 6 {
+		t.Errorf("Expected each request to have its own (uuid) body, got %v", seen)
+	}
+	// Signer errors: the request isn't sent.
+	for _, stdClient := range []bool{false, true} {
+		opts := NewHTTPOptions(fmt.Sprintf("http://localhost:%d/", a.Port))
+		opts.DisableFastClient = stdClient
+		cli, _ := NewClient(opts)
+		signErr := errors.New("signing failed")
+		switch c := cli.(type) {
+		case *Client:
+			c.signer = func(*http.Request) error { return signErr }
+		case *FastClient:
+			c.signer = func(*http.Request) error { return signErr }
+			c.signReq, _ = newSignRequest(opts, http.MethodGet, "localhost")
+		}
+		if code, _, _ := cli.StreamFetch(context.Background()); code != -1 {
+			t.Errorf("std %v: expected -1 for signing error, got %d", stdClient, code)
+		}
+		if errType := cli.(errorTyper).lastErrorType(); errType != ErrorTypeSigning {
+			t.Errorf("std %v: unexpected error type %q", stdClient, errType)
+		}
+		cli.Close()
+	}
+	if valid.Load()+invalid.Load() != 6 {
+		t.Errorf("Requests with signing errors shouldn't be sent")
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	m, a := DynamicHTTPServer(false)
+	var failing atomic.Bool
+	var requests atomic.Int64
+	m.HandleFunc("/", func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+	opts := NewHTTPOptions(fmt.Sprintf("http://localhost:%d/", a.Port))
+	opts.DisableFastClient = true
+	opts.CircuitBreakerThreshold = 0.5
+	opts.CircuitBreakerWindow = 4
+	opts.CircuitBreakerCooldown = 200 * time.Millisecond
+	cli, _ := NewClient(opts)
+	defer cli.Close()
+	ctx := context.Background()
+	fetch := func() int {
+		code, _, _ := cli.StreamFetch(ctx)
+		return code
+	}
+	// 1 error out of 4 is below the threshold:
+	failing.Store(true)
+	fetch()
+	failing.Store(false)
+	for range 3 {
+		if code := fetch(); code != http.StatusOK {
+			t.Errorf("Unexpected code %d while healthy", code)
+		}
+	}
+	failing.Store(true)
+	for range 2 {
+		if code := fetch(); code != http.StatusServiceUnavailable {
+			t.Errorf("Unexpected code %d while failing", code)
+		}
+	}
+	// Now 2 out of the last 4 failed: open, no more network requests.
+	if requests.Load() != 6 {
+		t.Errorf("Expected 6 requests, got %d", requests.Load())
+	}
+	failing.Store(false)
+	for range 3 {
+		if code := fetch(); code != -1 {
+			t.Errorf("Expected -1 while the circuit is open, got %d", code)
+		}
+	}
+	if requests.Load() != 6 {
+		t.Errorf("Expected no request while the circuit is open, got %d", requests.Load())
+	}
+	// Half-open after the cooldown, failed probe: open again.
+	time.Sleep(250 * time.Millisecond)
+	failing.Store(true)
+	if code := fetch(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected the probe to go through, got %d", code)
+	}
+	if code := fetch(); code != -1 || requests.Load() != 7 {
+		t.Errorf("Expected open circuit after failed probe, got %d (%d requests)", code, requests.Load())
+	}
+	// Server recovered: successful probe closes the circuit.
+	failing.Store(false)
+	time.Sleep(250 * time.Millisecond)
+	for range 5 {
+		if code := fetch(); code != http.StatusOK {
+			t.Errorf("Expected closed circuit after successful probe, got %d", code)
+		}
+	}
+	if requests.Load() != 12 {
+		t.Errorf("Expected 12 requests, got %d", requests.Load())
+	}
+}
+
 // Test Post request with std client and the socket close after answering.
 func TestPayloadWithStdClientAndClosedSocket(t *testing.T) {
 	m, a := DynamicHTTPServer(false)
@@ -717,6 +933,38 @@ func TestSmallBufferAndNoKeepAlive(t *testing.T) {
 	cli.Close()
 }
 
+func TestLargeHeaders(t *testing.T) {
+	m, a := DynamicHTTPServer(false)
+	m.HandleFunc("/", func(w http.ResponseWriter, _ *http.Request) {
+		for i := range 40 { // ~40k of headers
+			w.Header().Add("Set-Cookie", fmt.Sprintf("sso%d=%s", i, strings.Repeat("x", 1024)))
+		}
+		_, _ = w.Write([]byte("hello"))
+	})
+	prev := BufferSizeKb
+	BufferSizeKb = 16
+	defer func() { BufferSizeKb = prev }()
+	opts := NewHTTPOptions(fmt.Sprintf("http://localhost:%d/", a.Port))
+	cli, _ := NewFastClient(opts)
+	_, data, _ := cli.Fetch(context.Background())
+	if len(data) != BufferSizeKb*1024 {
+		t.Errorf("Was expecting truncated headers, got %d", len(data))
+	}
+	cli.Close()
+	opts.HeaderBufferKb = 64
+	cli, _ = NewFastClient(opts)
+	for i := range 2 { // 2nd time with the already grown buffer and reused connection
+		code, data, headerLen := cli.Fetch(context.Background())
+		if code != http.StatusOK || headerLen < 40*1024 || string(data[headerLen:]) != "hello" {
+			t.Errorf("Fetch %d: unexpected code %d, header len %d, body %q", i, code, headerLen, DebugSummary(data[headerLen:], 20))
+		}
+	}
+	if cli.(*FastClient).socketCount != 1 {
+		t.Errorf("Expected connection reuse, got %d sockets", cli.(*FastClient).socketCount)
+	}
+	cli.Close()
+}
+
 func TestBadUrlFastClient(t *testing.T) {
 	opts := NewHTTPOptions("not a valid url")
 	cli, err := NewFastClient(opts)
@@ -1027,6 +1275,49 @@ func TestPayloadSizeLarge(t *testing.T) {
 	}
 }
 
+func TestPayloadChunks(t *testing.T) {
+	mux, addr := DynamicHTTPServer(false)
+	got := make(chan string, 10)
+	mux.HandleFunc("/chunks/", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- r.Method + " " + string(body)
+		w.WriteHeader(http.StatusOK)
+	})
+	reader, writer := io.Pipe()
+	o := HTTPOptions{
+		URL:              fmt.Sprintf("http://localhost:%d/chunks/", addr.Port),
+		PayloadReader:    reader,
+		PayloadChunkSize: 8,
+	}
+	client, _ := NewClient(&o)
+	if _, ok := client.(*Client); !ok || o.H2 {
+		t.Errorf("Expected the (http/1.1) std client for chunked payload reader, got %T h2 %v", client, o.H2)
+	}
+	go func() {
+		for _, payload := range []string{"one", "two", "more than 8 bytes"} {
+			_, _ = writer.Write([]byte(payload))
+		}
+		writer.Close()
+	}()
+	for _, expected := range []string{"POST one", "POST two", "POST more tha", "POST n 8 byte", "POST s"} {
+		code, _, _ := client.StreamFetch(context.Background())
+		if code != http.StatusOK {
+			t.Errorf("Unexpected code %d", code)
+		}
+		if body := <-got; body != expected {
+			t.Errorf("Got %q, expected %q", body, expected)
+		}
+	}
+	// Writer closed: no more payloads.
+	if code, _, _ := client.StreamFetch(context.Background()); code != SocketError {
+		t.Errorf("Expected socket error after the end of the payloads, got %d", code)
+	}
+	if errType := client.(*Client).lastErrorType(); errType != ErrorTypeEOF {
+		t.Errorf("Expected %q error type, got %q", ErrorTypeEOF, errType)
+	}
+	client.Close()
+}
+
 func TestUUIDFastClient(t *testing.T) {
 	m, a := DynamicHTTPServer(false)
 	m.HandleFunc("/", ValidateUUIDPath)
@@ -1249,6 +1540,313 @@ func TestDebugHandlerSortedHeaders(t *testing.T) {
 	}
 }
 
+// TestEchoGzipProbability checks that gzip=50 gives a mix of gzipped and plain responses.
+// Uses the fast client which doesn't decode so we can see the raw gzip payload.
+func TestEchoGzipProbability(t *testing.T) {
+	_, a := ServeTCP("0", "")
+	url := fmt.Sprintf("http://localhost:%d/?gzip=50&size=1000", a.Port)
+	o := HTTPOptions{URL: url}
+	o.AddAndValidateExtraHeader("Accept-Encoding: gzip")
+	client, _ := NewClient(&o)
+	gzipped := 0
+	n := 200
+	for range n {
+		code, data, header := client.Fetch(context.Background())
+		if code != http.StatusOK {
+			t.Errorf("Got %d instead of 200", code)
+		}
+		if bytes.HasPrefix(data[header:], []byte{0x1f, 0x8b}) {
+			gzipped++
+		}
+	}
+	t.Logf("Got %d gzipped out of %d", gzipped, n)
+	if gzipped == 0 || gzipped == n {
+		t.Errorf("Expected a mix of gzipped and plain responses, got %d gzipped out of %d", gzipped, n)
+	}
+}
+
+func TestAutoDecompress(t *testing.T) {
+	_, a := ServeTCP("0", "")
+	url := fmt.Sprintf("http://localhost:%d/?gzip=true", a.Port)
+	payload := []byte("some payload to compress compress compress")
+	for _, auto := range []bool{false, true} {
+		var buf bytes.Buffer
+		// std client either explicitly or implied by AutoDecompress
+		o := HTTPOptions{URL: url, Payload: payload, AutoDecompress: auto, DisableFastClient: !auto, DataWriter: &buf}
+		o.AddAndValidateExtraHeader("Accept-Encoding: gzip")
+		client, _ := NewClient(&o)
+		if !o.DisableFastClient {
+			t.Errorf("Expected AutoDecompress to switch to the std client")
+		}
+		code, _, _ := client.StreamFetch(context.Background())
+		if code != http.StatusOK {
+			t.Errorf("Got %d instead of 200", code)
+		}
+		if auto != bytes.Equal(buf.Bytes(), payload) {
+			t.Errorf("AutoDecompress %v: unexpected body %q", auto, buf.Bytes())
+		}
+		// Transparent decoding doesn't apply when Accept-Encoding is explicit:
+		if !auto && !bytes.HasPrefix(buf.Bytes(), []byte{0x1f, 0x8b}) {
+			t.Errorf("Expected raw gzip body without AutoDecompress, got %q", buf.Bytes())
+		}
+		client.Close()
+	}
+}
+
+type closeCounter struct {
+	io.Reader
+	closed int
+}
+
+func (c *closeCounter) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestDecompressedBodyClose(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write([]byte("gzipped"))
+	zw.Close()
+	for _, enc := range []string{"", "gzip", "br"} {
+		raw := &closeCounter{Reader: bytes.NewReader(gz.Bytes())}
+		resp := &http.Response{Header: http.Header{}, Body: raw}
+		resp.Header.Set("Content-Encoding", enc)
+		body, err := decompressedBody(resp)
+		if err != nil {
+			t.Fatalf("Unexpected error for %q: %v", enc, err)
+		}
+		data, _ := io.ReadAll(body)
+		if (enc == "gzip") != (string(data) == "gzipped") {
+			t.Errorf("Unexpected body for %q: %q", enc, data)
+		}
+		if err = body.Close(); err != nil || raw.closed != 1 {
+			t.Errorf("Closing the %q body should close the response body once: %v %d", enc, err, raw.closed)
+		}
+	}
+}
+
+func TestFastClientStreamingLargeBody(t *testing.T) {
+	body := bytes.Repeat([]byte("0123456789abcdef"), 10*1024*1024/16) // 10MiB, much larger than the buffer
+	mux, addr := DynamicHTTPServer(false)
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("chunked") == "" {
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		}
+		for i := 0; i < len(body); i += 64 * 1024 {
+			_, _ = w.Write(body[i : i+64*1024])
+			w.(http.Flusher).Flush()
+		}
+	})
+	tests := []struct {
+		query     string
+		keepAlive bool
+	}{
+		{"", true},
+		{"", false},
+		{"?chunked=1", true},
+	}
+	for _, tst := range tests {
+		var buf bytes.Buffer
+		url := fmt.Sprintf("http://localhost:%d/large%s", addr.Port, tst.query)
+		o := HTTPOptions{URL: url, DisableKeepAlive: !tst.keepAlive, DataWriter: &buf}
+		client, _ := NewClient(&o)
+		if _, isFast := client.(*FastClient); !isFast {
+			t.Fatalf("Expected fast client, got %T", client)
+		}
+		code, size, header := client.StreamFetch(context.Background())
+		if code != http.StatusOK {
+			t.Errorf("%s (keepalive %v): got %d instead of 200", tst.query, tst.keepAlive, code)
+		}
+		if size != int64(buf.Len()) {
+			t.Errorf("%s (keepalive %v): size %d != %d bytes written", tst.query, tst.keepAlive, size, buf.Len())
+		}
+		data := buf.Bytes()[header:]
+		if tst.query == "" && !bytes.Equal(data, body) {
+			t.Errorf("%s (keepalive %v): body mismatch, got %d bytes, expected %d", tst.query, tst.keepAlive, len(data), len(body))
+		}
+		if len(data) < len(body) {
+			t.Errorf("%s (keepalive %v): body too short %d < %d", tst.query, tst.keepAlive, len(data), len(body))
+		}
+		client.Close()
+	}
+}
+
+func TestRequestTrailers(t *testing.T) {
+	mux, addr := DynamicHTTPServer(false)
+	type received struct {
+		body    string
+		trailer http.Header
+	}
+	got := make(chan received, 1)
+	mux.HandleFunc("/echo-trailers/", func(w http.ResponseWriter, r *http.Request) {
+		EchoHandler(w, r)
+		got <- received{r.Header.Get("Transfer-Encoding") + r.Header.Get("Content-Length"), r.Trailer}
+	})
+	for _, stdClient := range []bool{false, true} {
+		for _, payload := range []string{"", "some payload"} {
+			o := HTTPOptions{
+				URL:               fmt.Sprintf("http://localhost:%d/echo-trailers/", addr.Port),
+				DisableFastClient: stdClient,
+				Payload:           []byte(payload),
+				MethodOverride:    http.MethodPost, // go's std client doesn't send a body, thus trailers, for empty GETs.
+			}
+			if err := o.AddRequestTrailer("grpc-status: 0"); err != nil {
+				t.Fatalf("Unexpected error adding trailer: %v", err)
+			}
+			_ = o.AddRequestTrailer("Grpc-Message:all good")
+			client, _ := NewClient(&o)
+			code, data, header := client.Fetch(context.Background())
+			if code != http.StatusOK || !strings.Contains(string(data[header:]), payload) {
+				t.Errorf("std %v %q: unexpected response %d %q", stdClient, payload, code, data)
+			}
+			r := <-got
+			if r.trailer.Get("Grpc-Status") != "0" || r.trailer.Get("Grpc-Message") != "all good" {
+				t.Errorf("std %v %q: unexpected trailers received %v", stdClient, payload, r.trailer)
+			}
+			if fc, ok := client.(*FastClient); ok {
+				// Echoed back as response trailers:
+				if tr := fc.Trailers(); tr.Get("Grpc-Status") != "0" || tr.Get("Grpc-Message") != "all good" {
+					t.Errorf("%q: unexpected trailers echoed %v", payload, tr)
+				}
+			}
+			client.Close()
+		}
+	}
+	o := HTTPOptions{URL: fmt.Sprintf("http://localhost:%d/echo-trailers/", addr.Port)}
+	if err := o.AddRequestTrailer("no colon"); err == nil {
+		t.Errorf("Expected error for invalid trailer")
+	}
+}
+
+func TestFastClientTrailers(t *testing.T) {
+	mux, addr := DynamicHTTPServer(false)
+	mux.HandleFunc("/trailers", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("none") == "" {
+			w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		}
+		_, _ = w.Write([]byte("abc"))
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte("def"))
+		w.Header().Set("Grpc-Status", "0")
+		w.Header().Set("Grpc-Message", "all good")
+	})
+	for _, stream := range []bool{false, true} {
+		var buf bytes.Buffer
+		o := HTTPOptions{URL: fmt.Sprintf("http://localhost:%d/trailers", addr.Port)}
+		if stream {
+			o.DataWriter = &buf
+		}
+		client, _ := NewFastClient(&o)
+		fc := client.(*FastClient)
+		// Twice to check the socket is properly reused after the trailers.
+		for i := range 2 {
+			code, _, _ := fc.StreamFetch(context.Background())
+			if code != http.StatusOK {
+				t.Errorf("stream %v #%d: got %d instead of 200", stream, i, code)
+			}
+			tr := fc.Trailers()
+			if tr.Get("Grpc-Status") != "0" || tr.Get("Grpc-Message") != "all good" {
+				t.Errorf("stream %v #%d: unexpected trailers %v", stream, i, tr)
+			}
+		}
+		if fc.socketCount != 1 {
+			t.Errorf("stream %v: expected 1 socket, got %d", stream, fc.socketCount)
+		}
+		if stream && !strings.HasSuffix(buf.String(), "\r\nGrpc-Message: all good\r\nGrpc-Status: 0\r\n\r\n") {
+			t.Errorf("unexpected streamed data %q", buf.String())
+		}
+		fc.Close()
+	}
+	o := HTTPOptions{URL: fmt.Sprintf("http://localhost:%d/trailers?none=1", addr.Port)}
+	client, _ := NewFastClient(&o)
+	code, data, header := client.Fetch(context.Background())
+	if code != http.StatusOK || !strings.HasSuffix(string(data[header:]), "0\r\n\r\n") {
+		t.Errorf("unexpected no trailers response %d %q", code, data)
+	}
+	if tr := client.(*FastClient).Trailers(); tr != nil {
+		t.Errorf("expected no trailers, got %v", tr)
+	}
+	client.Close()
+}
+
+func TestFastClientPipelining(t *testing.T) {
+	mux, addr := DynamicHTTPServer(false)
+	mux.HandleFunc("/pipeline/", EchoHandler)
+	mux.HandleFunc("/chunked", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("abc"))
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte("def"))
+	})
+	for _, path := range []string{"/pipeline/?size=50", "/chunked"} {
+		url := fmt.Sprintf("http://localhost:%d%s", addr.Port, path)
+		o := HTTPOptions{URL: url}
+		client, _ := NewFastClient(&o)
+		code, single, _ := client.StreamFetch(context.Background())
+		client.Close()
+		if code != http.StatusOK {
+			t.Fatalf("%s: got %d instead of 200", path, code)
+		}
+		o = HTTPOptions{URL: url, PipeliningDepth: 3}
+		client, _ = NewFastClient(&o)
+		fc := client.(*FastClient)
+		// Twice to check the socket is properly reused after a batch.
+		for i := range 2 {
+			code, size, _ := fc.StreamFetch(context.Background())
+			if code != http.StatusOK {
+				t.Errorf("%s #%d: got %d instead of 200", path, i, code)
+			}
+			if size != 3*single {
+				t.Errorf("%s #%d: got size %d instead of 3 * %d", path, i, size, single)
+			}
+		}
+		if fc.socketCount != 1 {
+			t.Errorf("%s: expected 1 socket, got %d", path, fc.socketCount)
+		}
+		fc.Close()
+	}
+	// Server closing the connection after the first response: count mismatch.
+	o := HTTPOptions{URL: fmt.Sprintf("http://localhost:%d/pipeline/?close=true", addr.Port), PipeliningDepth: 2}
+	client, _ := NewFastClient(&o)
+	if code, _, _ := client.StreamFetch(context.Background()); code != SocketError {
+		t.Errorf("expected socket error on response count mismatch, got %d", code)
+	}
+	client.Close()
+	// Pipelining is ignored without keep-alive.
+	o = HTTPOptions{URL: fmt.Sprintf("http://localhost:%d/pipeline/", addr.Port), PipeliningDepth: 2, DisableKeepAlive: true}
+	client, _ = NewFastClient(&o)
+	if p := client.(*FastClient).pipelining; p != 1 {
+		t.Errorf("expected pipelining to be disabled without keep-alive, got %d", p)
+	}
+	client.Close()
+}
+
+func TestFastClientDualStack(t *testing.T) {
+	_, a := ServeTCP("0", "")
+	fnet.FlagResolveIPType.Set("dual")
+	defer fnet.FlagResolveIPType.Set("ip4")
+	url := fmt.Sprintf("http://localhost:%d/", a.Port)
+	o := HTTPOptions{URL: url, DisableKeepAlive: true}
+	client, _ := NewClient(&o)
+	for range 3 {
+		code, _, _ := client.Fetch(context.Background())
+		if code != http.StatusOK {
+			t.Errorf("Got %d instead of 200", code)
+		}
+	}
+	usage, connStats := client.GetIPAddress()
+	totals := make(map[string]int)
+	usage.AggregateAndToString(totals)
+	sum := 0
+	for _, v := range totals {
+		sum += v
+	}
+	if sum != 3 || connStats.Count != 3 {
+		t.Errorf("Expected 3 connections recorded, got %v and %d", totals, connStats.Count)
+	}
+	client.Close()
+}
+
 func TestEchoHeaders(t *testing.T) {
 	_, a := ServeTCP("0", "")
 	headers := []struct {
@@ -1297,6 +1895,103 @@ func TestEchoHeaders(t *testing.T) {
 	}
 }
 
+func TestReplayHandler(t *testing.T) {
+	m, a := DynamicHTTPServer(false)
+	m.HandleFunc("/", EchoHandler)
+	m.HandleFunc("/replay/", ReplayHandler)
+	base := fmt.Sprintf("localhost:%d/", a.Port)
+	steps := []ReplayStep{
+		{URL: "http://" + base + "?status=201"},
+		{URL: base, Body: "abcdef", DelayBefore: "100ms"},
+		{URL: "http://" + base + "?delay=50ms", Method: http.MethodHead, Headers: map[string]string{"X-Foo": "bar"}},
+		{URL: "http://localhost:1/"},
+	}
+	start := time.Now()
+	res, err := jrpc.CallURL[[]ReplayResult]("http://"+base+"replay/", &steps)
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("Unexpected replay error: %v", err)
+	}
+	if elapsed < 150*time.Millisecond {
+		t.Errorf("Replay too fast %v, delay not applied", elapsed)
+	}
+	r := *res
+	if len(r) != len(steps) {
+		t.Fatalf("Expected %d results, got %+v", len(steps), r)
+	}
+	if r[0].Code != http.StatusCreated || r[0].ResponseSize != 0 {
+		t.Errorf("Unexpected 1st result %+v", r[0])
+	}
+	if r[1].Code != http.StatusOK || r[1].ResponseSize != 6 {
+		t.Errorf("Unexpected 2nd result %+v", r[1])
+	}
+	if r[2].Code != http.StatusOK || r[2].LatencyMs < 50 {
+		t.Errorf("Unexpected 3rd result %+v", r[2])
+	}
+	if r[3].Code != -1 || r[3].Error == "" {
+		t.Errorf("Unexpected 4th result %+v", r[3])
+	}
+	bad := []ReplayStep{{URL: base, DelayBefore: "not a duration"}}
+	_, err = jrpc.CallURL[[]ReplayResult]("http://"+base+"replay/", &bad)
+	if err == nil {
+		t.Errorf("Expected error for bad delayBefore")
+	}
+	tooMany := make([]ReplayStep, MaxReplaySteps+1)
+	for i := range tooMany {
+		tooMany[i].URL = base
+	}
+	_, err = jrpc.CallURL[[]ReplayResult]("http://"+base+"replay/", &tooMany)
+	if err == nil {
+		t.Errorf("Expected error for more than %d steps", MaxReplaySteps)
+	}
+}
+
+func TestWebDAVHandler(t *testing.T) {
+	WebDAVPath = "/webdav/"
+	_, addr := ServeTCP("0", "")
+	WebDAVPath = ""
+	base := fmt.Sprintf("http://localhost:%d/webdav/", addr.Port)
+	tests := []struct {
+		method   string
+		path     string
+		dest     string
+		status   int
+		contains string
+	}{
+		{"PROPFIND", "dir/", "", http.StatusMultiStatus, "<D:href>/webdav/dir/</D:href>"},
+		{"PROPFIND", "a&b.txt", "", http.StatusMultiStatus, "<D:href>/webdav/a&amp;b.txt</D:href>"},
+		{"MKCOL", "dir/", "", http.StatusCreated, ""},
+		{http.MethodPut, "dir/f.txt", "", http.StatusCreated, ""},
+		{http.MethodDelete, "dir/f.txt", "", http.StatusNoContent, ""},
+		{"COPY", "f.txt", base + "g.txt", http.StatusCreated, ""},
+		{"MOVE", "f.txt", base + "h.txt", http.StatusCreated, ""},
+		{"MOVE", "f.txt", "", http.StatusBadRequest, "missing Destination"},
+		{http.MethodPost, "echo", "", http.StatusOK, "some payload"},
+		{"LOCK", "f.txt", "", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tst := range tests {
+		req, _ := http.NewRequestWithContext(context.Background(), tst.method, base+tst.path, strings.NewReader("some payload"))
+		if tst.dest != "" {
+			req.Header.Set("Destination", tst.dest)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", tst.method, tst.path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tst.status {
+			t.Errorf("%s %s: got %d instead of %d", tst.method, tst.path, resp.StatusCode, tst.status)
+		}
+		if !strings.Contains(string(body), tst.contains) {
+			t.Errorf("%s %s: %q doesn't contain %q", tst.method, tst.path, body, tst.contains)
+		}
+		if got := resp.Header.Get("Destination"); got != tst.dest && tst.status == http.StatusCreated {
+			t.Errorf("%s %s: got Destination %q instead of %q", tst.method, tst.path, got, tst.dest)
+		}
+	}
+}
+
 func TestPPROF(t *testing.T) {
 	mux, addrN := HTTPServer("test pprof", "0")
 	addr := addrN.(*net.TCPAddr)
@@ -1446,6 +2141,34 @@ func TestCache(t *testing.T) {
 	}
 }
 
+func TestLayeredFS(t *testing.T) {
+	embedded := fstest.MapFS{
+		"static/img/logo.svg": {Data: []byte("embedded logo")},
+		"static/css/main.css": {Data: []byte("embedded css")},
+	}
+	overlay := fstest.MapFS{
+		"static/img/logo.svg":  {Data: []byte("custom logo")},
+		"static/css/extra.css": {Data: []byte("custom css")},
+	}
+	l := LayeredFS(overlay, embedded)
+	for name, expected := range map[string]string{
+		"static/img/logo.svg":  "custom logo",
+		"static/css/main.css":  "embedded css",
+		"static/css/extra.css": "custom css",
+	} {
+		data, err := fs.ReadFile(l, name)
+		if err != nil || string(data) != expected {
+			t.Errorf("For %s got %q, %v expected %q", name, data, err, expected)
+		}
+	}
+	if _, err := l.Open("static/missing.js"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected not exist error, got %v", err)
+	}
+	if LayeredFS(nil, embedded) == nil {
+		t.Errorf("Expected the embedded fs back for nil overlay")
+	}
+}
+
 func TestLogAndCallNoArg(t *testing.T) {
 	mux, addrN := HTTPServer("test call no arg", "0")
 	called := false
@@ -1661,7 +2384,345 @@ func TestInsecureRequestWithResolve(t *testing.T) {
 	}
 }
 
+func TestMultipartFields(t *testing.T) {
+	mux, addr := DynamicHTTPServer(false)
+	mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f, fh, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(f)
+		fmt.Fprintf(w, "%s|%s|%s|%s|%s", r.FormValue("field"), fh.Filename, fh.Header.Get("Content-Type"),
+			data, r.FormValue("fromfile"))
+	})
+	fpath := path.Join(t.TempDir(), "data.txt")
+	if err := os.WriteFile(fpath, []byte("file content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fields := []MultipartField{
+		{Name: "field", Data: []byte("value1")},
+		{Name: "file", Filename: "a \"quoted\".bin", Data: []byte("abc\x00def")},
+		{Name: "fromfile", FilePath: fpath},
+	}
+	expected := "value1|a \"quoted\".bin|application/octet-stream|abc\x00def|file content"
+	url := fmt.Sprintf("http://localhost:%d/upload", addr.Port)
+	for _, std := range []bool{false, true} {
+		var buf bytes.Buffer
+		o := HTTPOptions{URL: url, DisableFastClient: std, MultipartFields: fields, DataWriter: &buf}
+		client, err := NewClient(&o)
+		if err != nil {
+			t.Fatalf("Unexpected error creating client: %v", err)
+		}
+		// Encoded in the client's own copy of the (shared) options.
+		if o.ContentType != "" || o.Payload != nil || len(o.MultipartFields) != len(fields) {
+			t.Errorf("Unexpected change of the options %q %q %v", o.ContentType, o.Payload, o.MultipartFields)
+		}
+		code, _, header := client.StreamFetch(context.Background())
+		if code != http.StatusOK {
+			t.Errorf("std %v: got %d instead of 200: %s", std, code, buf.String())
+		}
+		body := buf.String()[header:]
+		if body != expected {
+			t.Errorf("std %v: got %q expected %q", std, body, expected)
+		}
+		client.Close()
+	}
+	o := HTTPOptions{URL: url, MultipartFields: []MultipartField{{Name: "big", Data: make([]byte, fnet.MaxPayloadSize)}}}
+	if _, err := NewClient(&o); err == nil {
+		t.Errorf("Expected error for multipart body larger than the max payload size")
+	}
+	o = HTTPOptions{URL: url, MultipartFields: []MultipartField{{Name: "missing", FilePath: "/does/not/exist"}}}
+	if _, err := NewClient(&o); err == nil {
+		t.Errorf("Expected error for missing multipart file")
+	}
+}
+
+// startConnectProxy starts a minimal CONNECT tunnel proxy, returns its address, the count of tunnels made
+// and the last CONNECT request.
+func startConnectProxy(t *testing.T) (string, *atomic.Int64, *atomic.Pointer[http.Request]) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	var count atomic.Int64
+	var last atomic.Pointer[http.Request]
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				req, err := http.ReadRequest(br)
+				if err != nil || req.Method != http.MethodConnect {
+					_, _ = conn.Write([]byte("HTTP/1.1 405 Method Not Allowed\r\n\r\n"))
+					return
+				}
+				last.Store(req)
+				dest, err := net.Dial("tcp", req.Host)
+				if err != nil {
+					_, _ = conn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\n\r\n"))
+					return
+				}
+				count.Add(1)
+				_, _ = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+				go func() {
+					_, _ = io.Copy(dest, br)
+					dest.Close()
+				}()
+				_, _ = io.Copy(conn, dest)
+			}()
+		}
+	}()
+	return l.Addr().String(), &count, &last
+}
+
+func TestHTTPProxyConnect(t *testing.T) {
+	proxy, count, last := startConnectProxy(t)
+	_, a := ServeTCP("0", "")
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	tests := []struct {
+		url        string
+		stdClient  bool
+		proxy      string
+		code       int
+		newTunnels int64
+	}{
+		{fmt.Sprintf("http://localhost:%d/", a.Port), false, proxy, http.StatusOK, 1},
+		{srv.URL, false, "http://" + proxy, http.StatusOK, 1},
+		{srv.URL, true, proxy, http.StatusOK, 1},
+		{"http://localhost:1/", false, proxy, SocketError, 0}, // proxy fails to connect (502)
+	}
+	for _, tst := range tests {
+		before := count.Load()
+		o := HTTPOptions{
+			URL:               tst.url,
+			DisableFastClient: tst.stdClient,
+			HTTPProxy:         tst.proxy,
+			TLSOptions:        TLSOptions{Insecure: true},
+		}
+		code, _ := Fetch(&o)
+		if code != tst.code {
+			t.Errorf("%s (std %v): got %d instead of %d", tst.url, tst.stdClient, code, tst.code)
+		}
+		if n := count.Load() - before; n != tst.newTunnels {
+			t.Errorf("%s (std %v): got %d tunnels instead of %d", tst.url, tst.stdClient, n, tst.newTunnels)
+		}
+	}
+	// Same through fortio's own CONNECT proxy:
+	fortioProxy := fnet.HTTPConnectProxyServer("localhost:0", 0)
+	for _, stdClient := range []bool{false, true} {
+		o := HTTPOptions{
+			URL:               srv.URL,
+			DisableFastClient: stdClient,
+			HTTPProxy:         fortioProxy.String(),
+			TLSOptions:        TLSOptions{Insecure: true},
+		}
+		if code, _ := Fetch(&o); code != http.StatusOK {
+			t.Errorf("%s (std %v) through fnet.HTTPConnectProxyServer: got %d", srv.URL, stdClient, code)
+		}
+	}
+	// Fast client: credentials of the proxy url and -resolve of the CONNECT target.
+	o := HTTPOptions{
+		URL:        strings.Replace(srv.URL, "127.0.0.1", "example.com", 1),
+		HTTPProxy:  "http://user:p%40ss@" + proxy,
+		Resolve:    "127.0.0.1",
+		TLSOptions: TLSOptions{Insecure: true},
+	}
+	if code, _ := Fetch(&o); code != http.StatusOK {
+		t.Errorf("%s with -resolve through proxy: got %d", o.URL, code)
+	}
+	req := last.Load()
+	if auth := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:p@ss")); req.Header.Get("Proxy-Authorization") != auth {
+		t.Errorf("Unexpected proxy authorization %q", req.Header.Get("Proxy-Authorization"))
+	}
+	if _, port, _ := net.SplitHostPort(srv.Listener.Addr().String()); req.Host != "127.0.0.1:"+port {
+		t.Errorf("Unexpected CONNECT target %q", req.Host)
+	}
+	o = HTTPOptions{URL: srv.URL, HTTPProxy: "http://:123"}
+	if _, err := NewClient(&o); err == nil {
+		t.Errorf("Expected error for proxy without host")
+	}
+}
+
+func resolveCount(occ *stats.Occurrence) int {
+	m := make(map[string]int)
+	occ.AggregateAndToString(m)
+	total := 0
+	for _, v := range m {
+		total += v
+	}
+	return total
+}
+
+func TestDNSCacheTTL(t *testing.T) {
+	_, addr := ServeTCP("0", "/debug/")
+	url := fmt.Sprintf("http://localhost:%d/debug/", addr.Port)
+	tests := []struct {
+		ttl      time.Duration
+		expected int // number of resolutions for the initial + 5 connections
+	}{
+		{0, 5},               // default: re-resolve each new connection after the first one
+		{time.Hour, 1},       // only initial resolution is used
+		{time.Nanosecond, 6}, // expired by the time of each connect, including first one
+	}
+	for _, tst := range tests {
+		o := NewHTTPOptions(url)
+		o.DisableKeepAlive = true
+		o.DNSCacheTTL = tst.ttl
+		c, err := NewFastClient(o)
+		if err != nil {
+			t.Fatalf("Unable to create client: %v", err)
+		}
+		for range 5 {
+			code, _, _ := c.Fetch(context.Background())
+			if code != http.StatusOK {
+				t.Errorf("Unexpected code %d with ttl %v", code, tst.ttl)
+			}
+		}
+		occ, _ := c.GetIPAddress()
+		if n := resolveCount(occ); n != tst.expected {
+			t.Errorf("Got %d resolutions with ttl %v, expected %d", n, tst.ttl, tst.expected)
+		}
+		c.Close()
+	}
+	// std client with cache: number of resolutions for 3 connections
+	for ttl, expected := range map[time.Duration]int{time.Hour: 1, time.Nanosecond: 3} {
+		o := NewHTTPOptions(url)
+		o.DisableFastClient = true
+		o.DisableKeepAlive = true
+		o.DNSCacheTTL = ttl
+		c, err := NewStdClient(o)
+		if err != nil {
+			t.Fatalf("Unable to create std client: %v", err)
+		}
+		for range 3 {
+			code, _, _ := c.Fetch(context.Background())
+			if code != http.StatusOK {
+				t.Errorf("Unexpected std client code %d with dns cache", code)
+			}
+		}
+		if n := resolveCount(c.dnsResolutions); n != expected {
+			t.Errorf("Got %d std client resolutions with ttl %v, expected %d", n, ttl, expected)
+		}
+		c.Close()
+	}
+}
+
 // ValidateUUIDPath is an HTTP server handler validating /{uuid}.
+// resetFirstConnServer accepts connections on a new listener, resetting (RST) the first one after
+// reading its request and replying 200 to the requests on the other ones.
+func resetFirstConnServer(t *testing.T) net.Addr {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for i := 0; ; i++ {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn, first bool) {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				for {
+					req, err := http.ReadRequest(br)
+					if err != nil {
+						return
+					}
+					_, _ = io.Copy(io.Discard, req.Body)
+					if first {
+						_ = conn.(*net.TCPConn).SetLinger(0)
+						return
+					}
+					_, _ = conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"))
+				}
+			}(conn, i == 0)
+		}
+	}()
+	return l.Addr()
+}
+
+func TestRetryOnReset(t *testing.T) {
+	tests := []struct {
+		payload       string
+		disable       bool
+		nonIdempotent bool
+		retried       bool
+	}{
+		{"", false, false, true},              // GET is retried
+		{"some payload", false, false, false}, // POST isn't
+		{"some payload", false, true, true},   // unless opted in
+		{"", true, false, false},              // disabled
+		{"some payload", true, true, false},   // disabled
+	}
+	for _, tst := range tests {
+		addr := resetFirstConnServer(t)
+		o := HTTPOptions{
+			URL:                 "http://" + addr.String() + "/",
+			Payload:             []byte(tst.payload),
+			DisableRetryOnReset: tst.disable,
+			RetryNonIdempotent:  tst.nonIdempotent,
+		}
+		client, _ := NewStdClient(&o)
+		code, _, _ := client.StreamFetch(context.Background())
+		expectedCode, expectedRetries := -1, int64(0)
+		if tst.retried {
+			expectedCode, expectedRetries = http.StatusOK, 1
+		}
+		if code != expectedCode {
+			t.Errorf("%+v: got code %d, expected %d", tst, code, expectedCode)
+		}
+		if client.responseStats().resetRetries != expectedRetries {
+			t.Errorf("%+v: got %d reset retries, expected %d", tst, client.responseStats().resetRetries, expectedRetries)
+		}
+		client.Close()
+	}
+}
+
+func TestSequenceNumberHeader(t *testing.T) {
+	mux, addr := DynamicHTTPServer(false)
+	got := make(chan string, 10)
+	mux.HandleFunc("/seq/", func(w http.ResponseWriter, r *http.Request) {
+		got <- r.Header.Get("X-Fortio-Seq")
+		w.WriteHeader(http.StatusOK)
+	})
+	for _, stdClient := range []bool{false, true} {
+		o := HTTPOptions{
+			URL:                  fmt.Sprintf("http://localhost:%d/seq/", addr.Port),
+			DisableFastClient:    stdClient,
+			SequenceNumberHeader: "X-Fortio-Seq",
+		}
+		o.ID = 3
+		o.UniqueID = 42
+		client, _ := NewClient(&o)
+		for i := 1; i <= 3; i++ {
+			code, _, _ := client.StreamFetch(context.Background())
+			if code != http.StatusOK {
+				t.Errorf("std %v: unexpected code %d", stdClient, code)
+			}
+			expected := fmt.Sprintf("42/3/%d", i)
+			if v := <-got; v != expected {
+				t.Errorf("std %v: got sequence header %q, expected %q", stdClient, v, expected)
+			}
+		}
+		client.Close()
+	}
+}
+
 func ValidateUUIDPath(w http.ResponseWriter, r *http.Request) {
 	if log.LogVerbose() {
 		log.LogRequest(r, "ValidateUUIDPath")
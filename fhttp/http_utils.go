@@ -16,9 +16,11 @@ package fhttp // import "fortio.org/fortio/fhttp"
 
 import (
 	"compress/gzip"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
+	"errors"
 	"html/template"
 	"io"
 	"math/rand"
@@ -45,6 +47,12 @@ type TLSOptions struct {
 	Cert             string // `Path` to the certificate file to be used
 	Key              string // `Path` to the key file used
 	UnixDomainSocket string // `Path` of Unix domain socket to use instead of host:port
+	// Base64 encoded SHA-256 hashes of the server's leaf certificate public key (SPKI),
+	// when non-empty one of them must match in addition to the normal chain verification.
+	PinSHA256 []string
+	// When positive, Cert and Key are re-read every CertRotationInterval and the new certificate
+	// is used for the next TLS handshakes, e.g. to replace short-lived certificates during long runs.
+	CertRotationInterval time.Duration
 }
 
 func (to *TLSOptions) DoTLS() bool {
@@ -54,17 +62,37 @@ func (to *TLSOptions) DoTLS() bool {
 // TLSConfig creates a tls.Config based on input TLSOptions.
 // For https, ServerName is set later (once host is determined after URL parsing
 // and depending on hostOverride). Used for both client and server TLS config.
+// With CertRotationInterval, the certificate keeps being reloaded for the life of the process
+// (the std and fast clients instead stop when closed).
 func (to *TLSOptions) TLSConfig() (*tls.Config, error) {
+	res, _, err := to.tlsConfig()
+	return res, err
+}
+
+// tlsConfig is TLSConfig also returning the certificate rotator, when CertRotationInterval
+// is set, which must be released once the config is no longer used.
+func (to *TLSOptions) tlsConfig() (*tls.Config, *certRotator, error) {
+	var rotator *certRotator
 	res := &tls.Config{MinVersion: tls.VersionTLS12}
 	if to.Insecure {
 		log.LogVf("Using insecure https")
 		res.InsecureSkipVerify = true
 	}
-	if len(to.Cert) > 0 && len(to.Key) > 0 {
+	if len(to.Cert) > 0 && len(to.Key) > 0 && to.CertRotationInterval > 0 {
+		var err error
+		rotator, err = getCertRotator(to.Cert, to.Key, to.CertRotationInterval)
+		if err != nil {
+			log.Errf("LoadX509KeyPair error for cert %v / key %v: %v", to.Cert, to.Key, err)
+			return nil, nil, err
+		}
+		log.LogVf("Reloading cert %v / key %v every %v", to.Cert, to.Key, to.CertRotationInterval)
+		res.GetClientCertificate = rotator.GetClientCertificate
+		res.GetCertificate = rotator.GetCertificate
+	} else if len(to.Cert) > 0 && len(to.Key) > 0 {
 		cert, err := tls.LoadX509KeyPair(to.Cert, to.Key)
 		if err != nil {
 			log.Errf("LoadX509KeyPair error for cert %v / key %v: %v", to.Cert, to.Key, err)
-			return nil, err
+			return nil, nil, err
 		}
 		res.Certificates = []tls.Certificate{cert}
 	}
@@ -73,7 +101,10 @@ func (to *TLSOptions) TLSConfig() (*tls.Config, error) {
 		caCert, err := os.ReadFile(to.CACert)
 		if err != nil {
 			log.Errf("Unable to read CA from %v: %v", to.CACert, err)
-			return nil, err
+			if rotator != nil {
+				rotator.release()
+			}
+			return nil, nil, err
 		}
 		log.LogVf("Using custom CA from %v", to.CACert)
 		caCertPool := x509.NewCertPool()
@@ -84,7 +115,40 @@ func (to *TLSOptions) TLSConfig() (*tls.Config, error) {
 		res.ClientAuth = tls.RequireAndVerifyClientCert
 		res.ClientCAs = res.RootCAs
 	}
-	return res, nil
+	if len(to.PinSHA256) > 0 {
+		log.LogVf("Using certificate pinning with %d pin(s)", len(to.PinSHA256))
+		res.VerifyPeerCertificate = to.verifyPins
+	}
+	return res, rotator, nil
+}
+
+// SPKISHA256 returns the base64 encoded SHA-256 hash of the certificate's
+// public key info, the format expected in TLSOptions.PinSHA256.
+func SPKISHA256(cert *x509.Certificate) string {
+	h := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// verifyPins is the tls.Config.VerifyPeerCertificate callback checking the leaf
+// certificate against the pins. It is called after the normal chain verification
+// (unless Insecure is set, in which case pinning is the only check).
+func (to *TLSOptions) verifyPins(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return errors.New("no server certificate to check pins against")
+	}
+	leaf, err := x509.ParseCertificate(rawCerts[0])
+	if err != nil {
+		return err
+	}
+	h := SPKISHA256(leaf)
+	for _, pin := range to.PinSHA256 {
+		if pin == h {
+			log.LogVf("Certificate pin %s matched", h)
+			return nil
+		}
+	}
+	log.Errf("Server certificate %q public key hash %s doesn't match any of the pins %v", leaf.Subject, h, to.PinSHA256)
+	return errors.New("server certificate doesn't match any pinned sha256")
 }
 
 // Used for the fast case insensitive search.
@@ -480,6 +544,8 @@ func generateClose(closeStr string) bool {
 
 // generateGzip from string, format: gzip=true or gzip=100 for 100% gzip
 // gzip=42.3 for 42.3% gzip result (if Accept-Encoding is gzip).
+// Note that the fast client doesn't decode gzip; use the std client (-stdclient -compression)
+// to get transparently decompressed responses.
 func generateGzip(gzipStr string) bool {
 	return generateSingleProbability(gzipStr, "gzip")
 }
@@ -535,12 +601,14 @@ func NewGzipHTTPResponseWriter(w http.ResponseWriter) *GzipResponseWriter {
 	return &GzipResponseWriter{ResponseWriter: w, Writer: gz, gz: gz}
 }
 
-// Gzip wraps a handler for automatic gzip.
+// Gzip wraps a handler for automatic gzip, except for byte Range requests (as the ranges are of the
+// uncompressed content).
 func Gzip(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
 		// in our case we only wrap if we decided (gzip=x % rolled true) to gzip and so we already checked headers
 		// but leaving the check so this can be reused in generic code.
-		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") || r.Header.Get("Range") != "" {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -643,6 +711,7 @@ func CommonHTTPOptionsFromForm(r *http.Request) *HTTPOptions {
 	methodOverride := r.FormValue("X")
 	logErrors := (r.FormValue("log-errors") == "on")
 	h2 := (r.FormValue("h2") == "on")
+	serverTiming := (r.FormValue("server-timing") == "on")
 	httpsInsecure := (r.FormValue("https-insecure") == "on")
 	resolve := r.FormValue("resolve")
 	timeoutStr := strings.TrimSpace(r.FormValue("timeout"))
@@ -654,6 +723,7 @@ func CommonHTTPOptionsFromForm(r *http.Request) *HTTPOptions {
 	httpopts.Insecure = httpsInsecure
 	httpopts.Resolve = resolve
 	httpopts.H2 = h2
+	httpopts.ParseServerTiming = serverTiming
 	httpopts.LogErrors = logErrors
 	httpopts.MethodOverride = methodOverride
 	if len(payload) > 0 {
@@ -0,0 +1,93 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp // import "fortio.org/fortio/fhttp"
+
+import (
+	"encoding/json"
+
+	"fortio.org/fortio/stats"
+)
+
+// httpCheckpointState is the part of the HTTP runner results saved in the periodic.Checkpoint RunnerState.
+type httpCheckpointState struct {
+	RetCodes         map[int]int64
+	SocketErrorCodes map[int]int64 `json:",omitempty"`
+	Sizes            *stats.HistogramData
+	HeaderSizes      *stats.HistogramData
+}
+
+// httpCheckpoint is the periodic.CheckpointHook of an HTTP run: its return codes and sizes are checkpointed.
+type httpCheckpoint struct {
+	total   *HTTPRunnerResults // only for the sizes histograms layout.
+	threads []HTTPRunnerResults
+	resumed httpCheckpointState
+}
+
+// CheckpointState implements periodic.CheckpointHook, the threads' results are added to the resumed ones.
+func (c *httpCheckpoint) CheckpointState() (json.RawMessage, error) {
+	res := HTTPRunnerResults{
+		RetCodes:    make(map[int]int64),
+		sizes:       c.total.sizes.Clone(),
+		headerSizes: c.total.headerSizes.Clone(),
+	}
+	c.resumed.addTo(&res)
+	for i := range c.threads {
+		t := &c.threads[i]
+		for k, v := range t.RetCodes {
+			res.RetCodes[k] += v
+		}
+		for k, v := range t.SocketErrorCodes {
+			if res.SocketErrorCodes == nil {
+				res.SocketErrorCodes = make(map[int]int64)
+			}
+			res.SocketErrorCodes[k] += v
+		}
+		if t.sizes != nil {
+			res.sizes.Transfer(t.sizes.Clone())
+			res.headerSizes.Transfer(t.headerSizes.Clone())
+		}
+	}
+	return json.Marshal(httpCheckpointState{
+		RetCodes:         res.RetCodes,
+		SocketErrorCodes: res.SocketErrorCodes,
+		Sizes:            res.sizes.Export(),
+		HeaderSizes:      res.headerSizes.Export(),
+	})
+}
+
+// ResumeState implements periodic.CheckpointHook.
+func (c *httpCheckpoint) ResumeState(state json.RawMessage) error {
+	return json.Unmarshal(state, &c.resumed)
+}
+
+// addTo adds the checkpointed results to r's and returns the return codes r.RetCodes didn't have.
+func (s *httpCheckpointState) addTo(r *HTTPRunnerResults) []int {
+	var added []int
+	for k, v := range s.RetCodes {
+		if _, exists := r.RetCodes[k]; !exists {
+			added = append(added, k)
+		}
+		r.RetCodes[k] += v
+	}
+	for k, v := range s.SocketErrorCodes {
+		if r.SocketErrorCodes == nil {
+			r.SocketErrorCodes = make(map[int]int64)
+		}
+		r.SocketErrorCodes[k] += v
+	}
+	r.sizes.AddData(s.Sizes)
+	r.headerSizes.AddData(s.HeaderSizes)
+	return added
+}
@@ -15,14 +15,23 @@
 package fhttp
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
 	"fmt"
+	"io"
+	"maps"
+	"net/http"
 	"os"
 	"runtime"
 	"runtime/pprof"
+	"slices"
 	"sort"
-	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"fortio.org/fortio/jrpc"
@@ -52,26 +61,145 @@ type HTTPRunnerResults struct {
 	SocketCount int64
 	// Connection Time stats
 	ConnectionStats *stats.HistogramData
-	// HTTP status code to abort the run on (-1 for connection or other socket error)
+	// HTTP status code to abort the run on (-1 for connection or other socket error, or only the more
+	// specific SocketErrorReset, SocketErrorRefused or SocketErrorTimeout ones)
 	AbortOn int
 	aborter *periodic.Aborter
+	// Options the run was started with, so it can be replayed (see rapi's /rest/replay).
+	// The extra headers are in its Headers.
+	OriginalOptions *HTTPRunnerOptions `json:",omitempty"`
+	// Number of responses whose body didn't match the payload (when VerifyResponseHash is set).
+	ChecksumErrors int64
+	verifyHash     bool
+	verifyGzip     bool
+	expectedHash   [sha256.Size]byte
+	// Number of TRACE responses not echoing all the sent headers (when VerifyTraceEcho is set).
+	TraceEchoErrors int64
+	verifyTrace     bool
+	traceHeaders    http.Header // headers expected in the TRACE echo
+
+	// Number of 3xx responses (redirects which were not followed).
+	RedirectCount int64
+	// Whether a response had a Strict-Transport-Security header with a positive max-age (when DetectHSTS is set).
+	HSTSDetected bool
+	// Number of responses with one of the ForbiddenResponseHeaders.
+	ForbiddenHeaderCount int64
+	// Number of 101 Switching Protocols (e.g. WebSocket upgrade) responses, counted as socket errors.
+	WebSocketUpgradeCount int64
+	// Number of Link: rel=preload response headers' links, i.e. HTTP/2 server push candidates (when H2 is set):
+	// Go's HTTP/2 client disables actual server push.
+	PreloadLinkCount int64
+	// Number of std client requests retried after a connection reset (unless DisableRetryOnReset is set).
+	ResetRetries int64
+	// Number of CORS preflight requests sent, and failed, when CORSPreflight is set.
+	PreflightCount  int64
+	PreflightErrors int64
+	// Number of 304 Not Modified responses (when CacheValidation is set), not counted as redirects.
+	CacheHits       int64
+	cacheValidation bool // per thread copy of HTTPOptions.CacheValidation
+
+	// Number of 206 Partial Content responses (for range requests).
+	PartialContentCount int64
+	// Kernel TCP_INFO metrics of the fast client connections, when TCPInfo is set (Linux only).
+	TCPMetrics *TCPMetrics `json:",omitempty"`
+	// Number of responses whose fingerprint header differs from the first one (when DetectDedup is set).
+	DedupMismatches int64
+	// Histograms, in seconds, of the Server-Timing durations of each metric name (when ParseServerTiming is set),
+	// of up to MaxServerTimingMetrics names.
+	ServerTimings map[string]*stats.HistogramData `json:",omitempty"`
+	// Breakdown of the RetCodes' SocketError (-1) count into SocketErrorReset, SocketErrorRefused
+	// and SocketErrorTimeout (the other socket errors aren't in it).
+	SocketErrorCodes map[int]int64 `json:",omitempty"`
 }
 
 // Run tests HTTP request fetching. Main call being run at the target QPS.
 // To be set as the Function in RunnerOptions.
 func (httpstate *HTTPRunnerResults) Run(ctx context.Context, t periodic.ThreadID) (bool, string) {
 	log.Debugf("Calling in %d", t)
+	if httpstate.verifyHash || httpstate.verifyTrace {
+		return httpstate.runAndVerify(ctx)
+	}
 	code, size, headerSize := httpstate.client.StreamFetch(ctx)
+	return httpstate.recordResult(code, size, headerSize)
+}
+
+// recordResult updates the RetCodes, the sizes histograms and checks AbortOn for 1 response,
+// returns the Run status and details.
+func (httpstate *HTTPRunnerResults) recordResult(code int, size int64, headerSize uint) (bool, string) {
 	log.Debugf("Got in %3d hsz %d sz %d - will abort on %d", code, headerSize, size, httpstate.AbortOn)
 	httpstate.RetCodes[code]++
+	sc := socketErrorCode(httpstate.client, code)
+	if sc != 0 {
+		httpstate.SocketErrorCodes[sc]++
+	}
 	httpstate.sizes.Record(float64(size))
 	httpstate.headerSizes.Record(float64(headerSize))
-	if httpstate.AbortOn == code {
+	if httpstate.AbortOn == code || (sc != 0 && httpstate.AbortOn == sc) {
 		httpstate.aborter.Abort(false)
 		log.S(log.Info, "Aborted run because of http code",
 			log.Attr("run", httpstate.RunID), log.Attr("code", code), log.Attr("size", size))
 	}
-	return codeIsOK(code), strconv.Itoa(code)
+	return isOK(code, httpstate.cacheValidation), errorDetails(httpstate.client, code)
+}
+
+// runAndVerify is the Run variant used when VerifyResponseHash or VerifyTraceEcho is set: it fetches
+// the full response and checks the body's sha256 against the one of the payload or the TRACE echo.
+func (httpstate *HTTPRunnerResults) runAndVerify(ctx context.Context) (bool, string) {
+	code, data, headerSize := httpstate.client.Fetch(ctx)
+	size := len(data)
+	ok, details := httpstate.recordResult(code, int64(size), uint(headerSize)) //nolint:gosec // headerSize is never negative.
+	if ok && httpstate.verifyHash && !httpstate.bodyMatches(data[headerSize:]) {
+		httpstate.ChecksumErrors++
+		log.S(log.Warning, "Response body checksum mismatch", log.Attr("run", httpstate.RunID),
+			log.Attr("code", code), log.Attr("body_size", size-headerSize))
+		return false, "checksum"
+	}
+	if ok && httpstate.verifyTrace && !httpstate.traceEchoMatches(data[headerSize:]) {
+		httpstate.TraceEchoErrors++
+		log.S(log.Warning, "TRACE response doesn't echo the request headers", log.Attr("run", httpstate.RunID),
+			log.Attr("code", code), log.Attr("body_size", size-headerSize))
+		return false, "trace echo"
+	}
+	return ok, details
+}
+
+// bodyMatches returns true if the sha256 of body (gunzipped first if VerifyResponseHashGzip is set
+// and the body is gzip encoded) is the same as the expected payload's.
+func (httpstate *HTTPRunnerResults) bodyMatches(body []byte) bool {
+	if httpstate.verifyGzip && len(body) >= 2 && body[0] == 0x1f && body[1] == 0x8b {
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			log.LogVf("Unable to create gzip reader for response: %v", err)
+			return false
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, zr) //nolint:gosec // the server is under test, we want to hash everything it sends.
+		if err != nil {
+			log.LogVf("Unable to gunzip response: %v", err)
+			return false
+		}
+		return bytes.Equal(h.Sum(nil), httpstate.expectedHash[:])
+	}
+	return sha256.Sum256(body) == httpstate.expectedHash
+}
+
+// traceEchoMatches returns true if body is a request (i.e. the message/http TRACE echo) with all the sent headers.
+func (httpstate *HTTPRunnerResults) traceEchoMatches(body []byte) bool {
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(body)))
+	if err != nil {
+		log.LogVf("Unable to parse TRACE echo: %v", err)
+		return false
+	}
+	for name, values := range httpstate.traceHeaders {
+		echoed := req.Header.Values(name)
+		for _, v := range values {
+			if !slices.Contains(echoed, strings.TrimSpace(v)) {
+				log.LogVf("TRACE echo is missing header %s: %s (got %q)", name, v, echoed)
+				return false
+			}
+		}
+	}
+	return true
 }
 
 // HTTPRunnerOptions includes the base RunnerOptions plus HTTP specific
@@ -83,6 +211,21 @@ type HTTPRunnerOptions struct {
 	AllowInitialErrors bool   // whether initial errors don't cause an abort
 	// Which status code cause an abort of the run (default 0 = don't abort; reminder -1 is returned for socket errors)
 	AbortOn int
+	// Check that each response body has the same sha256 as the payload (i.e. an echo server),
+	// mismatches are counted in ChecksumErrors. Fetches the whole response in memory so
+	// it's slower, specially with the std client.
+	VerifyResponseHash bool
+	// Same as VerifyResponseHash but gzip encoded responses are decompressed before hashing.
+	// Needed with the std client only when -compression is set (as it otherwise decodes gzip itself)
+	// and with the fast client as it never decodes gzip.
+	VerifyResponseHashGzip bool
+	// Check that each (TRACE method) response body echoes all the request headers,
+	// mismatches are counted in TraceEchoErrors. Also fetches the whole response in memory.
+	VerifyTraceEcho bool
+	// Extra headers, including the Host and User-Agent ones, as "Name:value" strings. Only set in the
+	// results' OriginalOptions, as the HTTPOptions' ones aren't serialized, for replays. The values
+	// of the sensitive ones (credentials) are redacted, see RedactedExtraHeaders.
+	Headers []string `json:",omitempty"`
 }
 
 func NewErrorResult(o *HTTPRunnerOptions, message string, err error) *HTTPRunnerResults {
@@ -109,6 +252,9 @@ func NewErrorResult(o *HTTPRunnerOptions, message string, err error) *HTTPRunner
 //nolint:funlen, gocognit, gocyclo, maintidx
 func RunHTTPTest(o *HTTPRunnerOptions) (*HTTPRunnerResults, error) {
 	o.RunType = "HTTP"
+	original := *o // copy before the runner options get moved and normalized
+	original.Runners = nil
+	original.Headers = o.RedactedExtraHeaders()
 	warmupMode := "parallel"
 	if o.SequentialWarmup {
 		warmupMode = "sequential"
@@ -142,12 +288,36 @@ func RunHTTPTest(o *HTTPRunnerOptions) (*HTTPRunnerResults, error) {
 		headerSizes: stats.NewHistogram(0, 5),
 		AbortOn:     o.AbortOn,
 		aborter:     aborter,
+		verifyHash:  o.VerifyResponseHash || o.VerifyResponseHashGzip,
+		verifyGzip:  o.VerifyResponseHashGzip,
+	}
+	if total.verifyHash {
+		total.expectedHash = sha256.Sum256(o.HTTPOptions.Payload)
 	}
-	httpstate := make([]HTTPRunnerResults, numThreads)
+	if o.VerifyTraceEcho {
+		total.verifyTrace = true
+		total.traceHeaders = o.HTTPOptions.GenerateHeaders()
+	}
+	total.OriginalOptions = &original
+	var geo *geoLookup
+	if o.AnnotateGeo {
+		geo = &geoLookup{url: o.GeoAPIURL}
+		go geo.get() // in parallel with the clients setup and the run, waited for at the end.
+	}
+	if o.DetectDedup {
+		o.HTTPOptions.dedupFirst = new(atomic.Pointer[string]) // the first fingerprint of the run.
+	}
+	// Probe once for the whole run, all the clients then share the Content-Length.
+	if err := o.HTTPOptions.initRandomRange(); err != nil {
+		aborter.RecordStart() // virtual/fake start so when we use the start chan later to wait it doesn't hang
+		return NewErrorResult(o, "init error", err), err
+	}
+	numClients := r.Options().MaxRunners() // more than numThreads with AutoScale
+	httpstate := make([]HTTPRunnerResults, numClients)
 	// First build all the clients sequentially. This ensures we do not have data races when
 	// constructing requests.
 	ctx := context.Background()
-	for i := range numThreads {
+	for i := range numClients {
 		r.Options().Runners[i] = &httpstate[i]
 		// Temp mutate the option so each client gets a logging id
 		o.HTTPOptions.ID = i
@@ -159,9 +329,9 @@ func RunHTTPTest(o *HTTPRunnerOptions) (*HTTPRunnerResults, error) {
 			aborter.RecordStart() // virtual/fake start so when we use the start chan later to wait it doesn't hang
 			return NewErrorResult(o, "init error", err), err
 		}
-		if o.SequentialWarmup && o.Exactly <= 0 {
+		if o.SequentialWarmup && o.Exactly <= 0 && i < numThreads {
 			code, dataLen, headerSize := httpstate[i].client.StreamFetch(ctx)
-			if !o.AllowInitialErrors && !codeIsOK(code) {
+			if !o.AllowInitialErrors && !isOK(code, o.CacheValidation) {
 				codeErr := fmt.Errorf("error %d for %s (%d body bytes), thread# %d", code, o.URL, dataLen, i)
 				aborter.RecordStart()
 				return NewErrorResult(o, "initial http error", codeErr), codeErr
@@ -174,15 +344,32 @@ func RunHTTPTest(o *HTTPRunnerOptions) (*HTTPRunnerResults, error) {
 		httpstate[i].sizes = total.sizes.Clone()
 		httpstate[i].headerSizes = total.headerSizes.Clone()
 		httpstate[i].RetCodes = make(map[int]int64)
+		httpstate[i].SocketErrorCodes = make(map[int]int64)
 		httpstate[i].AbortOn = total.AbortOn
 		httpstate[i].aborter = total.aborter
+		httpstate[i].verifyHash = total.verifyHash
+		httpstate[i].verifyGzip = total.verifyGzip
+		httpstate[i].expectedHash = total.expectedHash
+		httpstate[i].verifyTrace = total.verifyTrace
+		httpstate[i].traceHeaders = total.traceHeaders
+		httpstate[i].cacheValidation = o.CacheValidation
 	}
 	if o.Exactly <= 0 && !o.SequentialWarmup {
+		aborter.Lock()
+		stop := aborter.StopChan // copy, Abort() sets it to nil.
+		aborter.Unlock()
 		warmup := errgroup{}
 		for i := range numThreads {
 			warmup.Go(func() error {
+				if o.WarmupStagger > 0 && i > 0 {
+					select {
+					case <-stop:
+						return nil // the run will end right away.
+					case <-time.After(time.Duration(i) * o.WarmupStagger):
+					}
+				}
 				code, dataLen, headerSize := httpstate[i].client.StreamFetch(ctx)
-				if !o.AllowInitialErrors && !codeIsOK(code) {
+				if !o.AllowInitialErrors && !isOK(code, o.CacheValidation) {
 					return fmt.Errorf("error %d for %s (%d bytes)", code, o.URL, dataLen)
 				}
 				if i == 0 && log.LogVerbose() {
@@ -195,6 +382,11 @@ func RunHTTPTest(o *HTTPRunnerOptions) (*HTTPRunnerResults, error) {
 			return NewErrorResult(o, "warmup error", err), err
 		}
 	}
+	var checkpoint *httpCheckpoint
+	if r.Options().CheckpointFile != "" {
+		checkpoint = &httpCheckpoint{total: &total, threads: httpstate}
+		r.Options().CheckpointHook = checkpoint
+	}
 	// TODO avoid copy pasta with grpcrunner
 	var fc *os.File
 	if o.Profiler != "" {
@@ -209,6 +401,9 @@ func RunHTTPTest(o *HTTPRunnerOptions) (*HTTPRunnerResults, error) {
 		}
 	}
 	total.RunnerResults = r.Run()
+	if geo != nil {
+		total.SourceRegion = geo.get()
+	}
 	if o.Profiler != "" {
 		pprof.StopCPUProfile()
 		fc.Close()
@@ -226,10 +421,14 @@ func RunHTTPTest(o *HTTPRunnerOptions) (*HTTPRunnerResults, error) {
 	}
 	// Connection stats, aggregated
 	connectionStats := stats.NewHistogram(o.HTTPOptions.Offset.Seconds(), o.HTTPOptions.Resolution)
-	// Numthreads may have reduced:
+	runStats := newRunStats(o)
+	// Numthreads may have reduced (or increased with AutoScale):
 	numThreads = total.RunnerResults.NumThreads
 	// But we also must cleanup all the created clients.
 	keys := []int{}
+	if checkpoint != nil {
+		keys = append(keys, checkpoint.resumed.addTo(&total)...) // results of the resumed run, if any.
+	}
 	fmt.Fprintf(out, "# Socket and IP used for each connection:\n")
 	for i := range numThreads {
 		// Get the report on the IP address each thread use to send traffic
@@ -248,16 +447,62 @@ func RunHTTPTest(o *HTTPRunnerOptions) (*HTTPRunnerResults, error) {
 			}
 			total.RetCodes[k] += httpstate[i].RetCodes[k]
 		}
+		for k, v := range httpstate[i].SocketErrorCodes {
+			if total.SocketErrorCodes == nil {
+				total.SocketErrorCodes = make(map[int]int64)
+			}
+			total.SocketErrorCodes[k] += v
+		}
+		total.ChecksumErrors += httpstate[i].ChecksumErrors
+		total.TraceEchoErrors += httpstate[i].TraceEchoErrors
+		if c, ok := httpstate[i].client.(clientStatsReporter); ok {
+			runStats.merge(c.responseStats())
+		}
 		total.sizes.Transfer(httpstate[i].sizes)
 		total.headerSizes.Transfer(httpstate[i].headerSizes)
 		connectionStats.Transfer(connStats)
 	}
+	for i := numThreads; i < numClients; i++ {
+		httpstate[i].client.Close() // unused (by AutoScale)
+	}
+	runStats.addTo(&total)
 	total.ConnectionStats = connectionStats.Export().CalcPercentiles(o.Percentiles)
 	if log.Log(log.Info) {
 		total.ConnectionStats.Print(out, "Connection time histogram (s)")
 	} else if log.Log(log.Warning) {
 		connectionStats.Counter.Print(out, "Connection time (s)")
 	}
+	tcpRTT, tcpCwnd, tcpRetransmits := runStats.tcpInfo.rtt, runStats.tcpInfo.cwnd, runStats.tcpInfo.retransmits
+	if o.TCPInfo && tcpRTT.Count > 0 {
+		total.TCPMetrics = &TCPMetrics{
+			RTT:         tcpRTT.Export().CalcPercentiles(o.Percentiles),
+			Cwnd:        tcpCwnd.Export().CalcPercentiles(o.Percentiles),
+			Retransmits: tcpRetransmits,
+		}
+		if log.Log(log.Info) {
+			total.TCPMetrics.RTT.Print(out, "TCP round trip time histogram (s)")
+		} else {
+			tcpRTT.Counter.Print(out, "TCP round trip time (s)")
+		}
+		tcpCwnd.Counter.Print(out, "TCP congestion window (segments)")
+		_, _ = fmt.Fprintf(out, "TCP retransmitted segments: %d\n", tcpRetransmits)
+	}
+	serverTimings, serverTimingsDropped := runStats.serverTiming.histograms, runStats.serverTiming.dropped
+	if serverTimingsDropped > 0 {
+		log.S(log.Warning, "Too many Server-Timing metric names, durations of the extra ones dropped",
+			log.Attr("max", MaxServerTimingMetrics), log.Attr("dropped", serverTimingsDropped))
+	}
+	if len(serverTimings) > 0 {
+		total.ServerTimings = make(map[string]*stats.HistogramData, len(serverTimings))
+		for _, name := range slices.Sorted(maps.Keys(serverTimings)) {
+			total.ServerTimings[name] = serverTimings[name].Export().CalcPercentiles(o.Percentiles)
+			if log.Log(log.Info) {
+				total.ServerTimings[name].Print(out, "Server-Timing "+name+" histogram (s)")
+			} else if log.Log(log.Warning) {
+				serverTimings[name].Counter.Print(out, "Server-Timing "+name+" (s)")
+			}
+		}
+	}
 
 	// Sort the ip address form largest to smallest based on its usage count
 	ipList := make([]string, 0, len(total.IPCountMap))
@@ -273,14 +518,74 @@ func RunHTTPTest(o *HTTPRunnerOptions) (*HTTPRunnerResults, error) {
 	r.Options().ReleaseRunners()
 	sort.Ints(keys)
 	totalCount := float64(total.DurationHistogram.Count)
-	_, _ = fmt.Fprintf(out, "Sockets used: %d (for perfect keepalive, would be %d)\n", total.SocketCount, r.Options().NumThreads)
+	_, _ = fmt.Fprintf(out, "Sockets used: %d (for perfect keepalive, would be %d)\n", total.SocketCount, numThreads)
 	_, _ = fmt.Fprintf(out, "Uniform: %t, Jitter: %t, Catchup allowed: %t\n", total.Uniform, total.Jitter, !total.NoCatchUp)
 	_, _ = fmt.Fprintf(out, "IP addresses distribution:\n")
 	for _, v := range ipList {
 		_, _ = fmt.Fprintf(out, "%s: %d\n", v, total.IPCountMap[v])
 	}
 	for _, k := range keys {
-		_, _ = fmt.Fprintf(out, "Code %3d : %d (%.1f %%)\n", k, total.RetCodes[k], 100.*float64(total.RetCodes[k])/totalCount)
+		name := CodeName(k)
+		if name != "" {
+			name = " (" + name + ")"
+		}
+		_, _ = fmt.Fprintf(out, "Code %3d%s : %d (%.1f %%)\n", k, name, total.RetCodes[k], 100.*float64(total.RetCodes[k])/totalCount)
+		if k != SocketError {
+			continue
+		}
+		for _, sc := range []int{SocketErrorReset, SocketErrorRefused, SocketErrorTimeout} {
+			if n := total.SocketErrorCodes[sc]; n > 0 {
+				_, _ = fmt.Fprintf(out, "  of which %3d (%s) : %d (%.1f %%)\n", sc, CodeName(sc), n, 100.*float64(n)/totalCount)
+			}
+		}
+	}
+	for _, k := range keys {
+		if k == http.StatusNotModified && total.CacheValidation {
+			total.CacheHits += total.RetCodes[k]
+			continue
+		}
+		if k >= http.StatusMultipleChoices && k < http.StatusBadRequest {
+			total.RedirectCount += total.RetCodes[k]
+		}
+	}
+	total.PartialContentCount = total.RetCodes[http.StatusPartialContent]
+	if o.RangeRandom || o.rangeSet() {
+		_, _ = fmt.Fprintf(out, "Partial content (206): %d (%.1f %%)\n", total.PartialContentCount,
+			100.*float64(total.PartialContentCount)/totalCount)
+	}
+	if total.CacheValidation {
+		_, _ = fmt.Fprintf(out, "Cache hits (304 Not Modified): %d (%.1f %%)\n", total.CacheHits, 100.*float64(total.CacheHits)/totalCount)
+	}
+	if total.verifyHash {
+		_, _ = fmt.Fprintf(out, "Checksum errors: %d\n", total.ChecksumErrors)
+	}
+	if total.verifyTrace {
+		_, _ = fmt.Fprintf(out, "TRACE echo errors: %d\n", total.TraceEchoErrors)
+	}
+	if total.HSTSDetected {
+		_, _ = fmt.Fprintf(out, "HSTS (Strict-Transport-Security) detected\n")
+	}
+	if total.WebSocketUpgradeCount > 0 {
+		_, _ = fmt.Fprintf(out, "WebSocket upgrades (101 Switching Protocols, connection closed): %d\n", total.WebSocketUpgradeCount)
+	}
+	if total.CORSPreflight {
+		_, _ = fmt.Fprintf(out, "CORS preflights: %d, errors: %d\n", total.PreflightCount, total.PreflightErrors)
+	}
+	if total.PreloadLinkCount > 0 {
+		_, _ = fmt.Fprintf(out, "Preload links (HTTP/2 push candidates): %d\n", total.PreloadLinkCount)
+	}
+	if total.ResetRetries > 0 {
+		_, _ = fmt.Fprintf(out, "Requests retried after a connection reset: %d\n", total.ResetRetries)
+	}
+	if o.DetectDedup {
+		header := o.FingerprintHeader
+		if header == "" {
+			header = DefaultFingerprintHeader
+		}
+		_, _ = fmt.Fprintf(out, "Responses with a different %s fingerprint: %d\n", header, total.DedupMismatches)
+	}
+	if len(total.ForbiddenResponseHeaders) > 0 {
+		_, _ = fmt.Fprintf(out, "Responses with forbidden headers %v: %d\n", total.ForbiddenResponseHeaders, total.ForbiddenHeaderCount)
 	}
 	total.HeaderSizes = total.headerSizes.Export()
 	total.Sizes = total.sizes.Export()
@@ -20,18 +20,28 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io"
 	"math"
+	"net"
 	"net/http"
 	"net/http/httptrace"
 	"os"
 	"path"
+	"reflect"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
+	"fortio.org/fortio/fnet"
+	"fortio.org/fortio/periodic"
 	"fortio.org/log"
 )
 
@@ -497,6 +507,516 @@ func TestAbortOn(t *testing.T) {
 	}
 }
 
+func TestVerifyResponseHash(t *testing.T) {
+	mux, addr := DynamicHTTPServer(false)
+	mux.HandleFunc("/echo/", EchoHandler)
+	mux.HandleFunc("/fixed/", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("not the payload"))
+	})
+	baseURL := fmt.Sprintf("http://localhost:%d/", addr.Port)
+	for _, std := range []bool{false, true} {
+		o := HTTPRunnerOptions{}
+		o.URL = baseURL + "echo/"
+		o.Payload = []byte("some payload to echo back and verify")
+		o.DisableFastClient = std
+		o.VerifyResponseHash = true
+		o.Exactly = 20
+		o.NumThreads = 2
+		o.QPS = 100
+		r, err := RunHTTPTest(&o)
+		if err != nil {
+			t.Fatalf("Error running verify test (std %v): %v", std, err)
+		}
+		if r.ChecksumErrors != 0 {
+			t.Errorf("Unexpected %d checksum errors for echo (std %v)", r.ChecksumErrors, std)
+		}
+		if r.RetCodes[http.StatusOK] != o.Exactly {
+			t.Errorf("Expected %d 200s, got %v (std %v)", o.Exactly, r.RetCodes, std)
+		}
+		o.URL = baseURL + "fixed/"
+		r, err = RunHTTPTest(&o)
+		if err != nil {
+			t.Fatalf("Error running verify mismatch test (std %v): %v", std, err)
+		}
+		if r.ChecksumErrors != o.Exactly {
+			t.Errorf("Expected %d checksum errors, got %d (std %v)", o.Exactly, r.ChecksumErrors, std)
+		}
+		if r.ErrorsDurationHistogram.Count != o.Exactly {
+			t.Errorf("Checksum errors should count as errors, got %d (std %v)", r.ErrorsDurationHistogram.Count, std)
+		}
+	}
+	// Gzip: fast client doesn't decode so only the gzip variant matches
+	o := HTTPRunnerOptions{}
+	o.URL = baseURL + "echo/?gzip=true"
+	o.Payload = []byte(strings.Repeat("compressible payload ", 50))
+	_ = o.AddAndValidateExtraHeader("Accept-Encoding: gzip")
+	o.VerifyResponseHash = true
+	o.Exactly = 10
+	o.NumThreads = 1
+	r, err := RunHTTPTest(&o)
+	if err != nil {
+		t.Fatalf("Error running gzip verify test: %v", err)
+	}
+	if r.ChecksumErrors != o.Exactly {
+		t.Errorf("Expected %d checksum errors without gzip decoding, got %d", o.Exactly, r.ChecksumErrors)
+	}
+	o.VerifyResponseHash = false
+	o.VerifyResponseHashGzip = true
+	r, err = RunHTTPTest(&o)
+	if err != nil {
+		t.Fatalf("Error running gzip verify test 2: %v", err)
+	}
+	if r.ChecksumErrors != 0 {
+		t.Errorf("Unexpected %d checksum errors with gzip decoding", r.ChecksumErrors)
+	}
+}
+
+func TestCORSPreflightAndTraceEcho(t *testing.T) {
+	mux, addr := DynamicHTTPServer(false)
+	var preflights atomic.Int64
+	mux.HandleFunc("/preflight/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") == http.MethodPut &&
+			r.Header.Get("Origin") == DefaultCORSPreflightOrigin {
+			preflights.Add(1)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/trace/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "message/http")
+		_ = r.Write(w)
+	})
+	mux.HandleFunc("/notrace/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "%s %s HTTP/1.1\r\nHost: %s\r\n\r\n", r.Method, r.URL.Path, r.Host)
+	})
+	baseURL := fmt.Sprintf("http://localhost:%d/", addr.Port)
+	for _, std := range []bool{false, true} {
+		o := HTTPRunnerOptions{}
+		o.URL = baseURL + "preflight/"
+		o.CORSPreflightMethod = http.MethodPut
+		o.DisableFastClient = std
+		o.Exactly = 10
+		o.NumThreads = 1
+		o.QPS = 100
+		r, err := RunHTTPTest(&o)
+		if err != nil {
+			t.Fatalf("Error running preflight test (std %v): %v", std, err)
+		}
+		if r.RetCodes[http.StatusNoContent] != o.Exactly || preflights.Load() != o.Exactly {
+			t.Errorf("Expected %d preflights, got %v / %d (std %v)", o.Exactly, r.RetCodes, preflights.Load(), std)
+		}
+		preflights.Store(0)
+		o = HTTPRunnerOptions{}
+		o.URL = baseURL + "trace/"
+		o.MethodOverride = http.MethodTrace
+		_ = o.AddAndValidateExtraHeader("X-Trace-Me: some value")
+		o.DisableFastClient = std
+		o.VerifyTraceEcho = true
+		o.Exactly = 10
+		o.NumThreads = 1
+		o.QPS = 100
+		r, err = RunHTTPTest(&o)
+		if err != nil {
+			t.Fatalf("Error running trace test (std %v): %v", std, err)
+		}
+		if r.TraceEchoErrors != 0 || r.ErrorsDurationHistogram.Count != 0 || r.RetCodes[http.StatusOK] != o.Exactly {
+			t.Errorf("Unexpected %d trace echo errors, %v (std %v)", r.TraceEchoErrors, r.RetCodes, std)
+		}
+		o.URL = baseURL + "notrace/"
+		r, err = RunHTTPTest(&o)
+		if err != nil {
+			t.Fatalf("Error running trace mismatch test (std %v): %v", std, err)
+		}
+		if r.TraceEchoErrors != o.Exactly || r.ErrorsDurationHistogram.Count != o.Exactly {
+			t.Errorf("Expected %d trace echo errors, got %d (std %v)", o.Exactly, r.TraceEchoErrors, std)
+		}
+	}
+}
+
+func TestDetectHSTSAndRedirects(t *testing.T) {
+	mux, addr := DynamicHTTPServer(false)
+	mux.HandleFunc("/echo/", EchoHandler)
+	mux.HandleFunc("/hsts/", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
+		_, _ = w.Write([]byte("ok"))
+	})
+	baseURL := fmt.Sprintf("http://localhost:%d/", addr.Port)
+	for _, std := range []bool{false, true} {
+		o := HTTPRunnerOptions{}
+		o.URL = baseURL + "hsts/"
+		o.DisableFastClient = std
+		o.DetectHSTS = true
+		o.Exactly = 10
+		o.NumThreads = 2
+		o.QPS = 100
+		r, err := RunHTTPTest(&o)
+		if err != nil {
+			t.Fatalf("Error running hsts test (std %v): %v", std, err)
+		}
+		if !r.HSTSDetected || r.RedirectCount != 0 {
+			t.Errorf("Expected HSTS detected and no redirect (std %v), got %v %d", std, r.HSTSDetected, r.RedirectCount)
+		}
+		o.DetectHSTS = false
+		r, err = RunHTTPTest(&o)
+		if err != nil {
+			t.Fatalf("Error running no hsts test (std %v): %v", std, err)
+		}
+		if r.HSTSDetected {
+			t.Errorf("Expected HSTS not detected when DetectHSTS is false (std %v)", std)
+		}
+		o.DetectHSTS = true
+		o.URL = baseURL + "echo/?status=302:50"
+		o.AllowInitialErrors = true
+		r, err = RunHTTPTest(&o)
+		if err != nil {
+			t.Fatalf("Error running redirect test (std %v): %v", std, err)
+		}
+		if r.HSTSDetected {
+			t.Errorf("Unexpected HSTS detected for echo (std %v)", std)
+		}
+		if r.RedirectCount != r.RetCodes[http.StatusFound] || r.RedirectCount == 0 {
+			t.Errorf("Expected redirect count %d to match the 302s %v (std %v)", r.RedirectCount, r.RetCodes, std)
+		}
+	}
+}
+
+func TestForbiddenResponseHeaders(t *testing.T) {
+	mux, addr := DynamicHTTPServer(false)
+	mux.HandleFunc("/echo/", EchoHandler)
+	baseURL := fmt.Sprintf("http://localhost:%d/echo/", addr.Port)
+	for _, std := range []bool{false, true} {
+		o := HTTPRunnerOptions{}
+		o.URL = baseURL + "?header=X-Api-Key:secret"
+		o.DisableFastClient = std
+		o.ForbiddenResponseHeaders = []string{"authorization", "x-api-key"}
+		o.Exactly = 10
+		o.NumThreads = 2
+		o.QPS = 100
+		r, err := RunHTTPTest(&o)
+		if err != nil {
+			t.Fatalf("Error running forbidden headers test (std %v): %v", std, err)
+		}
+		if r.ForbiddenHeaderCount != 10 {
+			t.Errorf("Expected 10 responses with forbidden headers (std %v), got %d", std, r.ForbiddenHeaderCount)
+		}
+		o.URL = baseURL + "?header=X-Api-Key-Id:1"
+		r, err = RunHTTPTest(&o)
+		if err != nil {
+			t.Fatalf("Error running no forbidden headers test (std %v): %v", std, err)
+		}
+		if r.ForbiddenHeaderCount != 0 {
+			t.Errorf("Expected no forbidden headers (std %v), got %d", std, r.ForbiddenHeaderCount)
+		}
+	}
+}
+
+func TestDetectDedup(t *testing.T) {
+	mux, addr := DynamicHTTPServer(false)
+	var count atomic.Int64
+	mux.HandleFunc("/cached/", func(w http.ResponseWriter, _ *http.Request) {
+		etag := `"v1"`
+		if count.Add(1)%5 == 0 {
+			etag = `"v2"` // every 5th response is different content
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte("immutable"))
+	})
+	mux.HandleFunc("/perconn/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", strconv.Quote(r.RemoteAddr))
+	})
+	mux.HandleFunc("/echo/", EchoHandler)
+	for _, std := range []bool{false, true} {
+		count.Store(0)
+		o := HTTPRunnerOptions{}
+		o.URL = fmt.Sprintf("http://localhost:%d/cached/", addr.Port)
+		o.DisableFastClient = std
+		o.DetectDedup = true
+		o.Exactly = 10
+		o.NumThreads = 1
+		o.QPS = 100
+		r, err := RunHTTPTest(&o)
+		if err != nil {
+			t.Fatalf("Error running dedup test (std %v): %v", std, err)
+		}
+		if r.DedupMismatches != 2 {
+			t.Errorf("Expected 2 fingerprint mismatches (std %v), got %d", std, r.DedupMismatches)
+		}
+		o.URL = fmt.Sprintf("http://localhost:%d/echo/?header=Content-MD5:abc", addr.Port)
+		o.FingerprintHeader = "content-md5"
+		r, err = RunHTTPTest(&o)
+		if err != nil {
+			t.Fatalf("Error running Content-MD5 dedup test (std %v): %v", std, err)
+		}
+		if r.DedupMismatches != 0 {
+			t.Errorf("Expected no Content-MD5 mismatches (std %v), got %d", std, r.DedupMismatches)
+		}
+		// The first fingerprint is shared across the clients: a different one per connection is detected.
+		o.URL = fmt.Sprintf("http://localhost:%d/perconn/", addr.Port)
+		o.FingerprintHeader = ""
+		o.NumThreads = 2
+		r, err = RunHTTPTest(&o)
+		if err != nil {
+			t.Fatalf("Error running per connection dedup test (std %v): %v", std, err)
+		}
+		if r.DedupMismatches != 5 || r.SocketCount != 2 {
+			t.Errorf("Expected the 5 responses of the 2nd connection to mismatch (std %v), got %d (%d sockets)",
+				std, r.DedupMismatches, r.SocketCount)
+		}
+	}
+}
+
+func TestParseServerTiming(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected map[string]float64
+	}{
+		{"", nil},
+		{"cache;desc=hit", nil},
+		{"db;dur=53.2", map[string]float64{"db": 53.2}},
+		{`db;dur=53, app;desc="render, layout";dur=47.2, cache;desc=hit`, map[string]float64{"db": 53, "app": 47.2}},
+		{`total;DUR="12.5"`, map[string]float64{"total": 12.5}},
+		{"bad;dur=abc, neg;dur=-1,ok;dur=0", map[string]float64{"ok": 0}},
+	}
+	for _, tst := range tests {
+		res := ParseServerTiming(tst.value)
+		if !reflect.DeepEqual(res, tst.expected) {
+			t.Errorf("ParseServerTiming(%q) got %v expected %v", tst.value, res, tst.expected)
+		}
+	}
+}
+
+func TestServerTimingsCap(t *testing.T) {
+	o := NewHTTPOptions("http://localhost/")
+	o.ParseServerTiming = true
+	s := newServerTimingState(o)
+	for i := range MaxServerTimingMetrics + 8 {
+		s.record(fmt.Sprintf("m%d;dur=1", i))
+	}
+	s.record("m0;dur=2") // existing ones are still recorded.
+	if len(s.histograms) != MaxServerTimingMetrics || s.dropped != 8 || s.histograms["m0"].Count != 2 {
+		t.Errorf("Expected %d metrics and 8 dropped, got %d and %d", MaxServerTimingMetrics, len(s.histograms), s.dropped)
+	}
+}
+
+func TestServerTimings(t *testing.T) {
+	mux, addr := DynamicHTTPServer(false)
+	mux.HandleFunc("/timed/", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Add("Server-Timing", "db;dur=20, render;desc=\"html\";dur=5")
+		w.Header().Add("Server-Timing", "cache;desc=miss")
+		w.Header().Add("Server-Timing", "auth;dur=1")
+		_, _ = w.Write([]byte("ok"))
+	})
+	for _, std := range []bool{false, true} {
+		o := HTTPRunnerOptions{}
+		o.URL = fmt.Sprintf("http://localhost:%d/timed/", addr.Port)
+		o.DisableFastClient = std
+		o.ParseServerTiming = true
+		o.Exactly = 10
+		o.NumThreads = 2
+		o.QPS = 100
+		r, err := RunHTTPTest(&o)
+		if err != nil {
+			t.Fatalf("Error running server timing test (std %v): %v", std, err)
+		}
+		if len(r.ServerTimings) != 3 {
+			t.Fatalf("Expected 3 server timing metrics (std %v), got %v", std, r.ServerTimings)
+		}
+		for name, avg := range map[string]float64{"db": 0.020, "render": 0.005, "auth": 0.001} {
+			h := r.ServerTimings[name]
+			if h == nil || h.Count != 10 || math.Abs(h.Avg-avg) > 1e-9 {
+				t.Errorf("Unexpected %s server timing histogram (std %v): %+v", name, std, h)
+			}
+		}
+	}
+}
+
+func TestWebSocketUpgrade(t *testing.T) {
+	mux, addr := DynamicHTTPServer(false)
+	done := make(chan struct{})
+	defer close(done)
+	mux.HandleFunc("/ws/", func(w http.ResponseWriter, _ *http.Request) {
+		conn, bufrw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Errorf("Unable to hijack: %v", err)
+			return
+		}
+		_, _ = bufrw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		_ = bufrw.Flush()
+		go func() { // keep the connection open (as a websocket would) until the end of the test.
+			<-done
+			conn.Close()
+		}()
+	})
+	for _, url := range []string{"http://localhost:%d/ws/", "ws://localhost:%d/ws/"} {
+		for _, std := range []bool{false, true} {
+			o := HTTPRunnerOptions{}
+			o.URL = fmt.Sprintf(url, addr.Port)
+			o.DisableFastClient = std
+			o.Exactly = 4
+			o.NumThreads = 1
+			o.QPS = 100
+			r, err := RunHTTPTest(&o)
+			if err != nil {
+				t.Fatalf("Error running websocket test (%s, std %v): %v", url, std, err)
+			}
+			if r.WebSocketUpgradeCount != 4 || r.RetCodes[SocketError] != 4 || r.ErrorTypes[ErrorTypeWebSocketUpgrade] != 4 {
+				t.Errorf("Expected 4 websocket upgrade errors (%s, std %v), got %d %v %v",
+					url, std, r.WebSocketUpgradeCount, r.RetCodes, r.ErrorTypes)
+			}
+			if strings.HasPrefix(url, "ws:") && (!r.DisableFastClient || !strings.HasPrefix(r.URL, "http://")) {
+				t.Errorf("Expected ws:// url to switch to std client and http://, got %v %s", r.DisableFastClient, r.URL)
+			}
+		}
+	}
+}
+
+func TestPreloadLinks(t *testing.T) {
+	mux, addr := DynamicHTTPServer(false)
+	mux.HandleFunc("/push/", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Add("Link", "</style.css>; rel=preload; as=style, </app.js>; rel=\"preload modulepreload\"")
+		w.Header().Add("Link", "</img.png>; rel=preload; nopush, </next>; rel=next")
+	})
+	for _, h2 := range []bool{false, true} {
+		o := HTTPRunnerOptions{}
+		o.URL = fmt.Sprintf("http://localhost:%d/push/", addr.Port)
+		o.H2 = h2
+		o.Exactly = 5
+		o.NumThreads = 1
+		o.QPS = 100
+		r, err := RunHTTPTest(&o)
+		if err != nil {
+			t.Fatalf("Error running push test (h2 %v): %v", h2, err)
+		}
+		expected := int64(0)
+		if h2 {
+			expected = 10 // 2 preload (not nopush) links per response
+		}
+		if r.PreloadLinkCount != expected {
+			t.Errorf("Expected %d preload links (h2 %v), got %d", expected, h2, r.PreloadLinkCount)
+		}
+	}
+}
+
+func TestCORSPreflightCache(t *testing.T) {
+	mux, addr := DynamicHTTPServer(false)
+	var preflights atomic.Int64
+	mux.HandleFunc("/cors/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodOptions {
+			return
+		}
+		preflights.Add(1)
+		if r.Header.Get("Access-Control-Request-Method") != http.MethodPost ||
+			r.Header.Get("Access-Control-Request-Headers") != "content-type,x-custom" ||
+			r.Header.Get("Origin") != DefaultCORSPreflightOrigin {
+			t.Errorf("Unexpected preflight headers %v", r.Header)
+		}
+		if origin := r.URL.Query().Get("allow"); origin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		w.Header().Set("Access-Control-Max-Age", r.URL.Query().Get("max-age"))
+	})
+	tests := []struct {
+		query      string
+		preflights int64
+		errors     int64
+	}{
+		{"allow=*&max-age=60", 1, 0},
+		{"allow=*&max-age=0", 5, 0},
+		{"max-age=60", 5, 5}, // failed preflights aren't cached
+	}
+	for _, tst := range tests {
+		preflights.Store(0)
+		o := HTTPRunnerOptions{}
+		o.URL = fmt.Sprintf("http://localhost:%d/cors/?%s", addr.Port, tst.query)
+		o.CORSPreflight = true
+		o.ContentType = "application/json"
+		o.Payload = []byte("{}")
+		_ = o.AddAndValidateExtraHeader("X-Custom: foo")
+		o.Exactly = 5
+		o.NumThreads = 1
+		o.QPS = 100
+		r, err := RunHTTPTest(&o)
+		if err != nil {
+			t.Fatalf("Error running cors test %s: %v", tst.query, err)
+		}
+		if !r.DisableFastClient {
+			t.Errorf("Expected CORSPreflight to switch to the std client")
+		}
+		if r.PreflightCount != tst.preflights || r.PreflightErrors != tst.errors || preflights.Load() != tst.preflights {
+			t.Errorf("Expected %d preflights %d errors for %s, got %d %d (server %d)",
+				tst.preflights, tst.errors, tst.query, r.PreflightCount, r.PreflightErrors, preflights.Load())
+		}
+		if r.RetCodes[http.StatusOK] != 5 {
+			t.Errorf("Expected 5 ok requests for %s, got %v", tst.query, r.RetCodes)
+		}
+	}
+}
+
+func TestHSTSMaxAge(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected int64
+	}{
+		{"max-age=31536000", 31536000},
+		{"max-age=0", 0},
+		{"includeSubDomains; MAX-AGE = \"600\" ; preload", 600},
+		{"max-age=abc", -1},
+		{"includeSubDomains", -1},
+		{"", -1},
+	}
+	for _, tst := range tests {
+		if got := HSTSMaxAge(tst.value); got != tst.expected {
+			t.Errorf("HSTSMaxAge(%q) = %d, expected %d", tst.value, got, tst.expected)
+		}
+	}
+}
+
+func TestWarmupStagger(t *testing.T) {
+	mux, addr := DynamicHTTPServer(false)
+	var mu sync.Mutex
+	var times []time.Time
+	mux.HandleFunc("/stagger/", func(w http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		times = append(times, time.Now())
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	})
+	o := HTTPRunnerOptions{}
+	o.URL = fmt.Sprintf("http://localhost:%d/stagger/", addr.Port)
+	o.NumThreads = 4
+	o.QPS = 1
+	o.Duration = 10 * time.Millisecond
+	o.WarmupStagger = 50 * time.Millisecond
+	_, err := RunHTTPTest(&o)
+	if err != nil {
+		t.Fatalf("Error running stagger test: %v", err)
+	}
+	mu.Lock()
+	if len(times) < o.NumThreads {
+		t.Fatalf("Expected at least %d warmup requests, got %d", o.NumThreads, len(times))
+	}
+	// The first 4 requests are the warmup ones, spread over 3*50ms.
+	spread := times[o.NumThreads-1].Sub(times[0])
+	if spread < 140*time.Millisecond {
+		t.Errorf("Warmup requests not staggered enough: %v", spread)
+	}
+	mu.Unlock()
+	// Aborting during the stagger doesn't wait for the 3*1s.
+	o.WarmupStagger = time.Second
+	aborter := periodic.NewAborter()
+	o.Stop = aborter
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		aborter.Abort(false)
+	}()
+	start := time.Now()
+	if _, err = RunHTTPTest(&o); err != nil {
+		t.Errorf("Error running aborted stagger test: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Aborted warmup stagger took %v", elapsed)
+	}
+}
+
 func TestConnectionReuseRange(t *testing.T) {
 	mux, addr := DynamicHTTPServer(false)
 	mux.HandleFunc("/foo/", EchoHandler)
@@ -676,3 +1196,309 @@ func TestRunnerErrors(t *testing.T) {
 		t.Error("Expecting an error because of invalid url")
 	}
 }
+
+func TestCacheValidation(t *testing.T) {
+	mux, addr := DynamicHTTPServer(false)
+	var conditional atomic.Int64
+	mux.HandleFunc("/etag/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditional.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = w.Write([]byte("some content"))
+	})
+	mux.HandleFunc("/lastmod/", func(w http.ResponseWriter, r *http.Request) {
+		lastMod := "Wed, 21 Oct 2015 07:28:00 GMT"
+		w.Header().Set("Last-Modified", lastMod)
+		if r.Header.Get("If-Modified-Since") == lastMod {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = w.Write([]byte("some content"))
+	})
+	baseURL := fmt.Sprintf("http://localhost:%d/", addr.Port)
+	for _, std := range []bool{false, true} {
+		for _, path := range []string{"etag/", "lastmod/"} {
+			o := HTTPRunnerOptions{}
+			o.URL = baseURL + path
+			o.DisableFastClient = std
+			o.CacheValidation = true
+			o.Exactly = 10
+			o.NumThreads = 2
+			o.QPS = 100
+			r, err := RunHTTPTest(&o)
+			if err != nil {
+				t.Fatalf("Error running cache test (std %v %s): %v", std, path, err)
+			}
+			// The first request of each of the 2 threads gets the validator, the rest are all conditional:
+			if r.CacheHits != 8 || r.RetCodes[http.StatusNotModified] != 8 || r.RedirectCount != 0 {
+				t.Errorf("Expected 8 cache hits (std %v %s), got %d %v %d", std, path, r.CacheHits, r.RetCodes, r.RedirectCount)
+			}
+			if r.ErrorsDurationHistogram.Count != 0 {
+				t.Errorf("Expected 304s to be successes (std %v %s), got %d errors", std, path, r.ErrorsDurationHistogram.Count)
+			}
+			if !std && r.SocketCount != 2 {
+				t.Errorf("Expected 304s to keep the connection alive, got %d sockets (%s)", r.SocketCount, path)
+			}
+		}
+	}
+	if conditional.Load() != 16 {
+		t.Errorf("Expected 16 conditional etag requests, got %d", conditional.Load())
+	}
+	// Without cache validation, no conditional request:
+	o := HTTPRunnerOptions{}
+	o.URL = baseURL + "etag/"
+	o.Exactly = 4
+	r, err := RunHTTPTest(&o)
+	if err != nil || r.CacheHits != 0 || r.RetCodes[http.StatusOK] != 4 {
+		t.Errorf("Unexpected results without cache validation: %v %d %v", err, r.CacheHits, r.RetCodes)
+	}
+}
+
+func TestAnnotateGeo(t *testing.T) {
+	mux, addr := DynamicHTTPServer(false)
+	var lookups atomic.Int64
+	mux.HandleFunc("/echo/", EchoHandler)
+	mux.HandleFunc("/geo/", func(w http.ResponseWriter, _ *http.Request) {
+		lookups.Add(1)
+		_, _ = w.Write([]byte(`{"ip":"10.1.2.3","region":"Oregon","country":"US"}`))
+	})
+	mux.HandleFunc("/geo2/", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"status":"success","regionName":"Ile-de-France","countryCode":"FR"}`))
+	})
+	baseURL := fmt.Sprintf("http://localhost:%d/", addr.Port)
+	o := HTTPRunnerOptions{}
+	o.URL = baseURL + "echo/"
+	o.Exactly = 10
+	o.NumThreads = 2
+	o.AnnotateGeo = true
+	o.GeoAPIURL = baseURL + "geo/"
+	r, err := RunHTTPTest(&o)
+	if err != nil {
+		t.Fatalf("Error running geo test: %v", err)
+	}
+	if r.SourceRegion != "Oregon, US" {
+		t.Errorf("Expected source region Oregon, US, got %q", r.SourceRegion)
+	}
+	if lookups.Load() != 1 {
+		t.Errorf("Expected a single geo lookup for the run, got %d", lookups.Load())
+	}
+	if region := GeoRegion(baseURL + "geo2/"); region != "Ile-de-France, FR" {
+		t.Errorf("Unexpected region %q", region)
+	}
+	// Failed lookup: no region but the run still happens.
+	o.GeoAPIURL = baseURL + "echo/?status=503"
+	r, err = RunHTTPTest(&o)
+	if err != nil || r.SourceRegion != "" || r.RetCodes[http.StatusOK] != 10 {
+		t.Errorf("Unexpected results with failing geo lookup: %v %q %v", err, r.SourceRegion, r.RetCodes)
+	}
+	// Not annotated by default:
+	o.AnnotateGeo = false
+	o.GeoAPIURL = baseURL + "geo/"
+	r, _ = RunHTTPTest(&o)
+	if r.SourceRegion != "" || lookups.Load() != 1 {
+		t.Errorf("Unexpected geo lookup without AnnotateGeo: %q %d", r.SourceRegion, lookups.Load())
+	}
+}
+
+func TestRangeRequests(t *testing.T) {
+	mux, addr := DynamicHTTPServer(false)
+	content := strings.Repeat("0123456789", 100)
+	var mu sync.Mutex
+	ranges := map[string]int{}
+	mux.HandleFunc("/content/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges[r.Method+" "+r.Header.Get("Range")]++
+		mu.Unlock()
+		http.ServeContent(w, r, "content.txt", time.Time{}, strings.NewReader(content))
+	})
+	url := fmt.Sprintf("http://localhost:%d/content/", addr.Port)
+	for _, std := range []bool{false, true} {
+		// Fixed range
+		o := HTTPRunnerOptions{}
+		o.URL = url
+		o.DisableFastClient = std
+		o.RangeStart = 10
+		o.RangeEnd = 19
+		o.Exactly = 10
+		o.NumThreads = 2
+		o.QPS = 100
+		r, err := RunHTTPTest(&o)
+		if err != nil {
+			t.Fatalf("Error running fixed range test (std %v): %v", std, err)
+		}
+		if r.PartialContentCount != 10 || r.RetCodes[http.StatusPartialContent] != 10 || r.ErrorsDurationHistogram.Count != 0 {
+			t.Errorf("Expected 10 successful 206 (std %v), got %d %v", std, r.PartialContentCount, r.RetCodes)
+		}
+		if !std && (r.Sizes.Min != r.Sizes.Max || r.Sizes.Min <= 10 || r.Sizes.Min >= 250) {
+			t.Errorf("Unexpected sizes for the 10 bytes range %+v", r.Sizes)
+		}
+		// Random ranges
+		o = HTTPRunnerOptions{}
+		o.URL = url
+		o.DisableFastClient = std
+		o.RangeRandom = true
+		o.Exactly = 20
+		o.NumThreads = 2
+		o.QPS = 100
+		r, err = RunHTTPTest(&o)
+		if err != nil {
+			t.Fatalf("Error running random range test (std %v): %v", std, err)
+		}
+		if r.PartialContentCount != 20 || r.ErrorsDurationHistogram.Count != 0 {
+			t.Errorf("Expected 20 successful random 206 (std %v), got %d %v", std, r.PartialContentCount, r.RetCodes)
+		}
+	}
+	mu.Lock()
+	if ranges["GET bytes=10-19"] != 20 {
+		t.Errorf("Expected 20 fixed range requests, got %v", ranges)
+	}
+	if ranges["HEAD "] != 2 {
+		t.Errorf("Expected a single preflight HEAD per run, got %v", ranges)
+	}
+	if len(ranges) < 10 {
+		t.Errorf("Expected many different random ranges, got %v", ranges)
+	}
+	mu.Unlock()
+	// Open ended range
+	o := NewHTTPOptions(url)
+	o.RangeStart = 995
+	code, data := Fetch(o)
+	if code != http.StatusPartialContent || !bytes.HasSuffix(data, []byte("\r\n\r\n56789")) {
+		t.Errorf("Unexpected open ended range response %d %q", code, DebugSummary(data, 256))
+	}
+	// No content length: error creating the client
+	o = NewHTTPOptions(fmt.Sprintf("http://localhost:%d/nope/", addr.Port))
+	o.RangeRandom = true
+	if _, err := NewClient(o); err == nil {
+		t.Errorf("Expected error for random range without content length")
+	}
+}
+
+func TestErrorTypes(t *testing.T) {
+	mux, addr := DynamicHTTPServer(false)
+	mux.HandleFunc("/echo/", EchoHandler)
+	o := HTTPRunnerOptions{}
+	o.URL = fmt.Sprintf("http://localhost:%d/echo/?status=503", addr.Port)
+	o.Exactly = 6
+	o.NumThreads = 2
+	r, err := RunHTTPTest(&o)
+	if err != nil {
+		t.Fatalf("Error running 503 test: %v", err)
+	}
+	if expected := map[string]int64{"503": 6}; !reflect.DeepEqual(r.ErrorTypes, expected) {
+		t.Errorf("Unexpected error types %v, expected %v", r.ErrorTypes, expected)
+	}
+	// Closed port: connection refused, for both clients.
+	l, closedAddr := fnet.Listen("closed", "localhost:0")
+	l.Close()
+	for _, std := range []bool{false, true} {
+		o.URL = fmt.Sprintf("http://localhost:%d/", closedAddr.(*net.TCPAddr).Port)
+		o.DisableFastClient = std
+		r, err = RunHTTPTest(&o)
+		if err != nil {
+			t.Fatalf("Error running connection refused test (std %v): %v", std, err)
+		}
+		expected := map[string]int64{ErrorTypeConnectionRefused: 6}
+		if !reflect.DeepEqual(r.ErrorTypes, expected) {
+			t.Errorf("Unexpected error types (std %v) %v, expected %v", std, r.ErrorTypes, expected)
+		}
+		if r.RetCodes[SocketError] != 6 || len(r.RetCodes) != 1 {
+			t.Errorf("Expected 6 %d codes (std %v), got %v", SocketError, std, r.RetCodes)
+		}
+		if expected := map[int]int64{SocketErrorRefused: 6}; !reflect.DeepEqual(r.SocketErrorCodes, expected) {
+			t.Errorf("Unexpected socket error codes (std %v) %v, expected %v", std, r.SocketErrorCodes, expected)
+		}
+	}
+	for code, name := range map[int]string{
+		SocketError: ErrorTypeSocket, SocketErrorReset: ErrorTypeConnectionReset, SocketErrorRefused: ErrorTypeConnectionRefused,
+		SocketErrorTimeout: ErrorTypeTimeout, http.StatusOK: "",
+	} {
+		if actual := CodeName(code); actual != name {
+			t.Errorf("CodeName(%d) got %q, expected %q", code, actual, name)
+		}
+	}
+	// Error classification:
+	for _, tst := range []struct {
+		err      error
+		expected string
+	}{
+		{&net.DNSError{Err: "no such host", Name: "foo.invalid", IsNotFound: true}, ErrorTypeDNS},
+		{fmt.Errorf("read: %w", syscall.ECONNRESET), ErrorTypeConnectionReset},
+		{context.DeadlineExceeded, ErrorTypeTimeout},
+		{os.ErrDeadlineExceeded, ErrorTypeTimeout},
+		{io.ErrUnexpectedEOF, ErrorTypeEOF},
+		{x509.UnknownAuthorityError{}, ErrorTypeTLS},
+		{errors.New("something else"), ErrorTypeSocket},
+	} {
+		if actual := ErrorType(tst.err); actual != tst.expected {
+			t.Errorf("ErrorType(%v) got %q, expected %q", tst.err, actual, tst.expected)
+		}
+	}
+}
+
+func TestTCPInfoMetrics(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("TCP_INFO is only supported on linux")
+	}
+	mux, addr := DynamicHTTPServer(false)
+	mux.HandleFunc("/echo/", EchoHandler)
+	o := HTTPRunnerOptions{}
+	o.URL = fmt.Sprintf("http://localhost:%d/echo/", addr.Port)
+	o.Exactly = 10
+	o.NumThreads = 2
+	o.QPS = -1
+	o.TCPInfo = true
+	res, err := RunHTTPTest(&o)
+	if err != nil {
+		t.Fatalf("Error running test: %v", err)
+	}
+	m := res.TCPMetrics
+	if m == nil {
+		t.Fatalf("Expected TCP metrics")
+	}
+	// 1 sample for each of the 2 connections then 1 after each response.
+	if m.RTT.Count != 12 || m.Cwnd.Count != 12 || m.RTT.Max <= 0 || m.Cwnd.Min < 1 {
+		t.Errorf("Unexpected TCP metrics %+v %+v", m.RTT, m.Cwnd)
+	}
+	o.TCPInfo = false
+	if res, err = RunHTTPTest(&o); err != nil || res.TCPMetrics != nil {
+		t.Errorf("Unexpected TCP metrics without TCPInfo: %v %v", res.TCPMetrics, err)
+	}
+}
+
+func TestCheckpointResumeRetCodes(t *testing.T) {
+	mux, addr := DynamicHTTPServer(false)
+	var calls atomic.Int64
+	mux.HandleFunc("/checkpoint/", func(w http.ResponseWriter, _ *http.Request) {
+		if calls.Add(1) == 5 {
+			w.WriteHeader(http.StatusTeapot) // interrupts the first run, see AbortOn.
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	file := path.Join(t.TempDir(), "checkpoint.json")
+	o := HTTPRunnerOptions{}
+	o.URL = fmt.Sprintf("http://localhost:%d/checkpoint/", addr.Port)
+	o.Exactly = 20
+	o.NumThreads = 1
+	o.QPS = -1
+	o.CheckpointFile = file
+	o.AbortOn = http.StatusTeapot
+	res, err := RunHTTPTest(&o)
+	if err != nil || res.DurationHistogram.Count != 5 {
+		t.Fatalf("Unexpected interrupted run %d calls, %v", res.DurationHistogram.Count, err)
+	}
+	o.AbortOn = 0
+	res, err = RunHTTPTest(&o)
+	if err != nil {
+		t.Fatalf("Error resuming: %v", err)
+	}
+	// The results include the return codes and sizes of the calls before the interruption.
+	if res.RetCodes[http.StatusOK] != 19 || res.RetCodes[http.StatusTeapot] != 1 || res.Sizes.Count != 20 ||
+		res.HeaderSizes.Count != 20 {
+		t.Errorf("Unexpected resumed results %v sizes %d header sizes %d", res.RetCodes, res.Sizes.Count, res.HeaderSizes.Count)
+	}
+}
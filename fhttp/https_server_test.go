@@ -17,11 +17,24 @@ package fhttp
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
 	"io"
+	"math/big"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -225,3 +238,216 @@ func TestDefaultQueryParam(t *testing.T) {
 		t.Errorf("Got %d instead of 200 with bad default query", code)
 	}
 }
+
+// selfSignedCert returns a new PEM encoded self-signed client certificate for cn and its key.
+func selfSignedCert(t *testing.T, cn string) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Unable to create certificate: %v", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Unable to marshal key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+// writeFile atomically replaces file's content, so a reload never sees a partial file.
+func writeFile(t *testing.T, file string, data []byte) {
+	err := os.WriteFile(file+".tmp", data, 0o600)
+	if err == nil {
+		err = os.Rename(file+".tmp", file)
+	}
+	if err != nil {
+		t.Errorf("Unable to write %s: %v", file, err)
+	}
+}
+
+func TestCertRotation(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, caFile := path.Join(dir, "client.crt"), path.Join(dir, "client.key"), path.Join(dir, "ca.crt")
+	initialCert, initialKey := selfSignedCert(t, "initial")
+	rotatedCert, rotatedKey := selfSignedCert(t, "rotated")
+	// The server trusts both the initial and the rotated self-signed client certificates.
+	writeFile(t, caFile, append(append([]byte{}, initialCert...), rotatedCert...))
+	writeFile(t, certFile, initialCert)
+	writeFile(t, keyFile, initialKey)
+	m, a := ServeTLS("0", "", &TLSOptions{Cert: svrCrt, Key: svrKey, CACert: caFile, MTLS: true})
+	if m == nil || a == nil {
+		t.Fatalf("Failed to create server %v %v", m, a)
+	}
+	var seen sync.Map
+	m.HandleFunc("/rotation/", func(w http.ResponseWriter, r *http.Request) {
+		seen.Store(r.TLS.PeerCertificates[0].Subject.CommonName, true)
+	})
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		// Key first: the reloads in between fail (mismatch) and keep using the initial certificate.
+		writeFile(t, keyFile, rotatedKey)
+		writeFile(t, certFile, rotatedCert)
+	}()
+	opts := HTTPRunnerOptions{}
+	opts.QPS = 50
+	opts.Duration = 1 * time.Second
+	opts.URL = fmt.Sprintf("https://localhost:%d/rotation/", a.(*net.TCPAddr).Port)
+	opts.TLSOptions = TLSOptions{CACert: caCrt, Cert: certFile, Key: keyFile, CertRotationInterval: 50 * time.Millisecond}
+	opts.DisableKeepAlive = true // new handshake for each request
+	res, err := RunHTTPTest(&opts)
+	if err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if res.RetCodes[http.StatusOK] != res.DurationHistogram.Count || res.ErrorsDurationHistogram.Count != 0 {
+		t.Errorf("Unexpected errors during rotation: %+v", res.RetCodes)
+	}
+	for _, cn := range []string{"initial", "rotated"} {
+		if _, found := seen.Load(cn); !found {
+			t.Errorf("Server didn't get requests with the %s certificate", cn)
+		}
+	}
+	// The clients are closed at the end of the run, stopping the rotation.
+	certRotatorsMutex.Lock()
+	n := len(certRotators)
+	certRotatorsMutex.Unlock()
+	if n != 0 {
+		t.Errorf("Expected the certificate rotation to be stopped, got %d rotators", n)
+	}
+}
+
+// testCA writes a new CA certificate and key in dir and returns their paths and the CA pool.
+func testCA(t *testing.T, dir string) (string, string, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "fortio test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Unable to create certificate: %v", err)
+	}
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	certFile, keyFile := path.Join(dir, "bump-ca.crt"), path.Join(dir, "bump-ca.key")
+	writeFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}))
+	ca, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	return certFile, keyFile, pool
+}
+
+func TestSSLBumpServer(t *testing.T) {
+	certFile, keyFile, pool := testCA(t, t.TempDir())
+	if _, err := SSLBumpServer("0", &SSLBumpOptions{CACert: certFile, CAKey: "/does/not/exist"}); err == nil {
+		t.Errorf("Expected error with missing CA key")
+	}
+	echo, err := SSLBumpServer("0", &SSLBumpOptions{CACert: certFile, CAKey: keyFile, Handler: http.HandlerFunc(EchoHandler)})
+	if err != nil {
+		t.Fatalf("Unable to start ssl bump server: %v", err)
+	}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("from the destination"))
+	}))
+	defer srv.Close()
+	forward, err := SSLBumpServer("0", &SSLBumpOptions{CACert: certFile, CAKey: keyFile, Insecure: true})
+	if err != nil {
+		t.Fatalf("Unable to start forwarding ssl bump server: %v", err)
+	}
+	tests := []struct {
+		proxy    net.Addr
+		url      string
+		certName string
+		body     string
+	}{
+		{echo, "https://bumped.example.com/foo", "bumped.example.com", "some payload"},
+		{forward, srv.URL, "127.0.0.1", "from the destination"},
+	}
+	for _, tst := range tests {
+		proxyURL, _ := url.Parse("http://" + tst.proxy.String())
+		client := &http.Client{Transport: &http.Transport{
+			Proxy:           http.ProxyURL(proxyURL),
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		}}
+		resp, err := client.Post(tst.url, "text/plain", strings.NewReader("some payload"))
+		if err != nil {
+			t.Fatalf("Unable to fetch %s through ssl bump proxy: %v", tst.url, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || string(body) != tst.body {
+			t.Errorf("%s: unexpected response %d %q", tst.url, resp.StatusCode, body)
+		}
+		if cn := resp.TLS.PeerCertificates[0].Subject.CommonName; cn != tst.certName {
+			t.Errorf("%s: unexpected certificate for %q", tst.url, cn)
+		}
+	}
+	// Not a CONNECT request:
+	resp, err := http.Get("http://" + echo.String() + "/")
+	if err != nil {
+		t.Fatalf("Unable to fetch from ssl bump proxy: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for non CONNECT request, got %d", resp.StatusCode)
+	}
+}
+
+func TestSSLBumpCertificates(t *testing.T) {
+	certFile, keyFile, _ := testCA(t, t.TempDir())
+	b, err := newSSLBumper(&SSLBumpOptions{CACert: certFile, CAKey: keyFile, MaxCertificates: 2})
+	if err != nil {
+		t.Fatalf("Unable to create ssl bumper: %v", err)
+	}
+	// Concurrent requests for the same host share the single generated certificate.
+	certs := make([]*tls.Certificate, 10)
+	var wg sync.WaitGroup
+	for i := range certs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			certs[i], _ = b.certificate("a.example.com")
+		}()
+	}
+	wg.Wait()
+	for i, c := range certs {
+		if c == nil || c != certs[0] {
+			t.Errorf("Unexpected certificate %d: %p vs %p", i, c, certs[0])
+		}
+	}
+	// Least recently used eviction:
+	for _, host := range []string{"b.example.com", "a.example.com", "c.example.com"} {
+		if _, err = b.certificate(host); err != nil {
+			t.Fatalf("Unable to get certificate for %s: %v", host, err)
+		}
+	}
+	if len(b.certs) != 2 || b.lru.Len() != 2 || len(b.pending) != 0 {
+		t.Errorf("Unexpected cache sizes %d %d %d", len(b.certs), b.lru.Len(), len(b.pending))
+	}
+	if _, found := b.certs["b.example.com"]; found {
+		t.Errorf("Expected b.example.com to be evicted")
+	}
+	if c, _ := b.certificate("a.example.com"); c != certs[0] {
+		t.Errorf("Expected a.example.com to still be cached")
+	}
+}
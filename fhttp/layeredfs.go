@@ -0,0 +1,43 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp // import "fortio.org/fortio/fhttp"
+
+import (
+	"errors"
+	"io/fs"
+)
+
+type layeredFS struct {
+	overlay  fs.FS
+	embedded fs.FS
+}
+
+// LayeredFS returns a fs.FS which serves the files from overlay when they exist there
+// and falls back to embedded otherwise (e.g. to override some of the embedded static files).
+// A nil overlay returns embedded as is.
+func LayeredFS(overlay fs.FS, embedded fs.FS) fs.FS {
+	if overlay == nil {
+		return embedded
+	}
+	return &layeredFS{overlay: overlay, embedded: embedded}
+}
+
+func (l *layeredFS) Open(name string) (fs.File, error) {
+	f, err := l.overlay.Open(name)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return f, err
+	}
+	return l.embedded.Open(name)
+}
@@ -0,0 +1,91 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp // import "fortio.org/fortio/fhttp"
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"strings"
+
+	"fortio.org/fortio/fnet"
+	"fortio.org/log"
+)
+
+// MultipartField is one part of a multipart/form-data request body (see HTTPOptions.MultipartFields).
+// The content is Data, or read from FilePath when Data is nil. Parts with a Filename are file
+// uploads (with ContentType defaulting to application/octet-stream), other ones are regular form values.
+type MultipartField struct {
+	Name        string
+	Filename    string
+	ContentType string
+	Data        []byte
+	FilePath    string
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// withMultipart returns h when it has no MultipartFields, otherwise a copy of h with the Payload and
+// ContentType replaced by their multipart/form-data encoding: each client gets its own without changing
+// the options shared by the clients of a run. Errors out if the body would be larger than fnet.MaxPayloadSize.
+func (h *HTTPOptions) withMultipart() (*HTTPOptions, error) {
+	if len(h.MultipartFields) == 0 {
+		return h, nil
+	}
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for _, f := range h.MultipartFields {
+		data := f.Data
+		if data == nil && f.FilePath != "" {
+			var err error
+			data, err = os.ReadFile(f.FilePath)
+			if err != nil {
+				log.Errf("Unable to read multipart file %q: %v", f.FilePath, err)
+				return nil, err
+			}
+		}
+		header := make(textproto.MIMEHeader)
+		disposition := fmt.Sprintf(`form-data; name="%s"`, quoteEscaper.Replace(f.Name))
+		ct := f.ContentType
+		if f.Filename != "" {
+			disposition += fmt.Sprintf(`; filename="%s"`, quoteEscaper.Replace(f.Filename))
+			if ct == "" {
+				ct = "application/octet-stream"
+			}
+		}
+		header.Set("Content-Disposition", disposition)
+		if ct != "" {
+			header.Set("Content-Type", ct)
+		}
+		part, err := w.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+		_, _ = part.Write(data) // writes to bytes.Buffer don't fail
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	if buf.Len() > fnet.MaxPayloadSize {
+		return nil, fmt.Errorf("multipart body size %d exceeds the max payload size %d", buf.Len(), fnet.MaxPayloadSize)
+	}
+	c := *h
+	c.Payload = buf.Bytes()
+	c.ContentType = w.FormDataContentType()
+	c.MultipartFields = nil // encoded.
+	return &c, nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp // import "fortio.org/fortio/fhttp"
+
+import (
+	"net/http"
+	"strings"
+
+	"fortio.org/log"
+)
+
+// preloadLinkState is the per client count of the Link: <url>; rel=preload response headers' links:
+// Go's HTTP/2 client disables server push (SETTINGS_ENABLE_PUSH=0, there is no API to receive the
+// pushed responses) so these, which push capable servers use to decide what to push (and browsers
+// to preload), are counted as the server push candidates instead.
+type preloadLinkState struct {
+	enabled bool // HTTPOptions.H2
+	count   int64
+}
+
+// check counts the preload links of the response headers h.
+func (p *preloadLinkState) check(h http.Header, url string, id int, runID int64) {
+	n := preloadLinks(h.Values("Link"))
+	if n == 0 {
+		return
+	}
+	if p.count == 0 {
+		log.S(log.Info, "Server sent preload (push candidates) links", log.Attr("count", n), log.Str("url", url),
+			log.Attr("thread", id), log.Attr("run", runID))
+	}
+	p.count += n
+}
+
+// preloadLinks returns the number of rel=preload links (RFC 8288) in the Link header values,
+// excluding the nopush ones.
+func preloadLinks(values []string) int64 {
+	var n int64
+	for _, v := range values {
+		for _, link := range strings.Split(v, ",") {
+			preload, nopush := false, false
+			for _, param := range strings.Split(link, ";")[1:] {
+				name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+				switch strings.ToLower(strings.TrimSpace(name)) {
+				case "rel":
+					for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(value), `"`)) {
+						preload = preload || strings.EqualFold(rel, "preload")
+					}
+				case "nopush":
+					nopush = true
+				}
+			}
+			if preload && !nopush {
+				n++
+			}
+		}
+	}
+	return n
+}
@@ -0,0 +1,87 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp // import "fortio.org/fortio/fhttp"
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net/http"
+
+	"fortio.org/log"
+)
+
+const rangeHeader = "Range"
+
+// rangeSet returns whether a fixed byte range is requested (see HTTPOptions.RangeStart).
+func (h *HTTPOptions) rangeSet() bool {
+	return !h.RangeRandom && (h.RangeStart > 0 || h.RangeEnd > 0)
+}
+
+// rangeValue returns the fixed Range header value, open ended when RangeEnd isn't set.
+func (h *HTTPOptions) rangeValue() string {
+	if h.RangeEnd <= 0 {
+		return fmt.Sprintf("bytes=%d-", h.RangeStart)
+	}
+	return fmt.Sprintf("bytes=%d-%d", h.RangeStart, h.RangeEnd)
+}
+
+// initRandomRange does, once for the options, the HEAD preflight request getting the
+// Content-Length within which random ranges are then generated (when RangeRandom is set).
+func (h *HTTPOptions) initRandomRange() error {
+	if !h.RangeRandom || h.rangeContentLength > 0 {
+		return nil
+	}
+	head := *h
+	head.RangeRandom = false
+	head.RangeStart, head.RangeEnd = 0, 0
+	head.MethodOverride = http.MethodHead
+	head.DisableFastClient = true
+	head.Payload = nil
+	head.DataWriter = nil
+	cli, err := NewStdClient(&head)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	resp, err := cli.client.Do(cli.req)
+	if err != nil {
+		return fmt.Errorf("random range HEAD preflight request failed: %w", err)
+	}
+	resp.Body.Close()
+	if !codeIsOK(resp.StatusCode) || resp.ContentLength <= 0 {
+		return fmt.Errorf("random range HEAD preflight: no Content-Length (code %d, length %d)",
+			resp.StatusCode, resp.ContentLength)
+	}
+	h.rangeContentLength = resp.ContentLength
+	log.S(log.Info, "Random ranges", log.Str("url", h.URL), log.Attr("content-length", h.rangeContentLength))
+	return nil
+}
+
+// randomRange returns a Range header value for a random (non empty) range within [0, length).
+func randomRange(length int64) string {
+	start := rand.Int63n(length)             //nolint:gosec // we want fast not crypto
+	end := start + rand.Int63n(length-start) //nolint:gosec // we want fast not crypto
+	return fmt.Sprintf("bytes=%d-%d", start, end)
+}
+
+// insertHeader returns a copy of the raw request req with the name: value header added after the existing ones.
+func insertHeader(req []byte, name, value string) []byte {
+	end := bytes.Index(req, []byte("\r\n\r\n")) + 2 // keep the CRLF of the last header
+	res := make([]byte, 0, len(req)+len(name)+len(value)+4)
+	res = append(res, req[:end]...)
+	res = append(res, name+": "+value+"\r\n"...)
+	return append(res, req[end:]...)
+}
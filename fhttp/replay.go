@@ -0,0 +1,150 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp // import "fortio.org/fortio/fhttp"
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"fortio.org/fortio/fnet"
+	"fortio.org/fortio/jrpc"
+	"fortio.org/log"
+)
+
+// MaxReplaySteps is the maximum number of steps accepted in one ReplayHandler request.
+const MaxReplaySteps = 100
+
+// ReplayStep is one request of the sequence POSTed (as a JSON array) to the ReplayHandler.
+type ReplayStep struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method,omitempty"` // defaults to GET, or POST when there is a Body
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	// Delay (Go duration string, e.g. "100ms") to wait before making this request, capped to MaxDelay.
+	DelayBefore string `json:"delayBefore,omitempty"`
+}
+
+// ReplayResult is the outcome of each ReplayStep, Code is -1 (and Error set) when the request failed.
+type ReplayResult struct {
+	Code         int     `json:"code"`
+	LatencyMs    float64 `json:"latency_ms"`
+	ResponseSize int64   `json:"responseSize"`
+	Error        string  `json:"error,omitempty"`
+}
+
+// ReplayHandler executes in order the sequence of requests described by the JSON array of ReplayStep
+// in the request body and replies the JSON array of their ReplayResult (lightweight scenario replay).
+// Note this should only be made available to trusted clients.
+func ReplayHandler(w http.ResponseWriter, r *http.Request) {
+	log.LogRequest(r, "Replay")
+	if r.Method != http.MethodPost {
+		_ = jrpc.ReplyError(w, "replay needs a POST with a JSON array of steps", nil)
+		return
+	}
+	steps, err := jrpc.ProcessRequest[[]ReplayStep](r)
+	if err != nil {
+		_ = jrpc.ReplyError(w, "request error", err)
+		return
+	}
+	if len(*steps) > MaxReplaySteps {
+		_ = jrpc.ReplyError(w, fmt.Sprintf("too many steps %d > %d", len(*steps), MaxReplaySteps), nil)
+		return
+	}
+	delays := make([]time.Duration, len(*steps))
+	for i, s := range *steps {
+		if strings.TrimSpace(s.URL) == "" {
+			_ = jrpc.ReplyError(w, fmt.Sprintf("step %d", i), errors.New("missing url"))
+			return
+		}
+		if s.DelayBefore != "" {
+			delays[i], err = time.ParseDuration(s.DelayBefore)
+			if err != nil {
+				_ = jrpc.ReplyError(w, fmt.Sprintf("step %d invalid delayBefore", i), err)
+				return
+			}
+			if delays[i] > MaxDelay.Get() {
+				delays[i] = MaxDelay.Get()
+			}
+		}
+	}
+	client := getProxyClient()
+	results := make([]ReplayResult, 0, len(*steps))
+	for i, s := range *steps {
+		if delays[i] > 0 {
+			select {
+			case <-r.Context().Done():
+				log.Warnf("Replay aborted at step %d: %v", i, r.Context().Err())
+				return
+			case <-time.After(delays[i]):
+			}
+		}
+		results = append(results, replayStep(r, client, &s))
+	}
+	_ = jrpc.ReplyOk(w, &results)
+}
+
+// replayStep makes the single request s on behalf of r.
+func replayStep(r *http.Request, client *http.Client, s *ReplayStep) ReplayResult {
+	url := strings.TrimSpace(s.URL)
+	if !strings.HasPrefix(url, fnet.PrefixHTTP) && !strings.HasPrefix(url, fnet.PrefixHTTPS) {
+		url = fnet.PrefixHTTP + url
+	}
+	method := s.Method
+	var body io.Reader
+	if s.Body != "" {
+		body = strings.NewReader(s.Body)
+		if method == "" {
+			method = http.MethodPost
+		}
+	}
+	if method == "" {
+		method = http.MethodGet
+	}
+	res := ReplayResult{Code: -1}
+	req, err := http.NewRequestWithContext(r.Context(), method, url, body)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	for k, v := range s.Headers {
+		if strings.EqualFold(k, "Host") {
+			req.Host = v
+			continue
+		}
+		req.Header.Set(k, v)
+	}
+	OnBehalfOfRequest(req, r)
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		res.LatencyMs = 1000. * time.Since(start).Seconds()
+		res.Error = err.Error()
+		log.Warnf("Replay error for %s %q: %v", method, url, err)
+		return res
+	}
+	res.ResponseSize, err = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	res.LatencyMs = 1000. * time.Since(start).Seconds()
+	res.Code = resp.StatusCode
+	if err != nil {
+		res.Error = err.Error()
+	}
+	log.LogVf("Replay %s %q: %d, %d bytes in %.3f ms", method, url, res.Code, res.ResponseSize, res.LatencyMs)
+	return res
+}
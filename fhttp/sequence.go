@@ -0,0 +1,34 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp // import "fortio.org/fortio/fhttp"
+
+import "strconv"
+
+// sequencer generates the HTTPOptions.SequenceNumberHeader values of a client (thread).
+type sequencer struct {
+	header string // empty when not enabled
+	prefix string // "runID/threadID/"
+	seq    int64
+}
+
+func newSequencer(header string, runID int64, id int) sequencer {
+	return sequencer{header: header, prefix: strconv.FormatInt(runID, 10) + "/" + strconv.Itoa(id) + "/"}
+}
+
+// next returns the next value: runID/threadID/seq with seq starting at 1.
+func (s *sequencer) next() string {
+	s.seq++
+	return s.prefix + strconv.FormatInt(s.seq, 10)
+}
@@ -0,0 +1,157 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp // import "fortio.org/fortio/fhttp"
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"fortio.org/fortio/stats"
+)
+
+// serverTimingHeader is the Server-Timing header searched (case insensitively) by the fast client.
+var serverTimingHeader = []byte("\r\nServer-Timing:")
+
+// ParseServerTiming returns the dur (in milliseconds) of each metric of a Server-Timing header
+// value, e.g. `db;dur=53.2, app;desc="render";dur=47.2, cache;desc=hit`. Metrics without a valid
+// dur are omitted.
+func ParseServerTiming(value string) map[string]float64 {
+	var res map[string]float64
+	for _, metric := range splitOutsideQuotes(value, ',') {
+		params := splitOutsideQuotes(metric, ';')
+		name := strings.TrimSpace(params[0])
+		if name == "" {
+			continue
+		}
+		for _, p := range params[1:] {
+			k, v, found := strings.Cut(p, "=")
+			if !found || !strings.EqualFold(strings.TrimSpace(k), "dur") {
+				continue
+			}
+			dur, err := strconv.ParseFloat(strings.Trim(strings.TrimSpace(v), `"`), 64)
+			if err != nil || dur < 0 {
+				break
+			}
+			if res == nil {
+				res = make(map[string]float64)
+			}
+			res[name] = dur
+			break
+		}
+	}
+	return res
+}
+
+// splitOutsideQuotes splits s at each sep which isn't inside a quoted string (e.g. a desc).
+func splitOutsideQuotes(s string, sep byte) []string {
+	var res []string
+	inQuotes := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++ // skip the escaped character
+		case '"':
+			inQuotes = !inQuotes
+		case sep:
+			if !inQuotes {
+				res = append(res, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(res, s[start:])
+}
+
+// MaxServerTimingMetrics is the maximum number of Server-Timing metric names recorded, per client and
+// for the run: the durations of the other metrics are only counted, as dropped.
+const MaxServerTimingMetrics = 32
+
+// serverTimingState is the per client Server-Timing histograms (in seconds) of each metric name.
+type serverTimingState struct {
+	enabled    bool
+	offset     float64
+	resolution float64
+	histograms map[string]*stats.Histogram
+	dropped    int64
+}
+
+func newServerTimingState(o *HTTPOptions) serverTimingState {
+	return serverTimingState{
+		enabled:    o.ParseServerTiming,
+		offset:     o.Offset.Seconds(),
+		resolution: o.Resolution,
+		histograms: make(map[string]*stats.Histogram),
+	}
+}
+
+// record adds the durations of the Server-Timing header value to the metrics' histograms.
+func (s *serverTimingState) record(value string) {
+	for name, dur := range ParseServerTiming(value) {
+		h, found := s.histograms[name]
+		if !found {
+			if len(s.histograms) >= MaxServerTimingMetrics {
+				s.dropped++
+				continue
+			}
+			h = stats.NewHistogram(s.offset, s.resolution)
+			s.histograms[name] = h
+		}
+		h.Record(dur / 1000.)
+	}
+}
+
+// checkHeader records the Server-Timing headers of the std client's response.
+func (s *serverTimingState) checkHeader(h http.Header) {
+	for _, v := range h.Values("Server-Timing") {
+		s.record(v)
+	}
+}
+
+// checkRaw records all the Server-Timing headers of the fast client's raw response headers.
+func (s *serverTimingState) checkRaw(headers []byte) {
+	for {
+		found, offset := FoldFind(headers, serverTimingHeader)
+		if !found {
+			return
+		}
+		headers = headers[offset+len(serverTimingHeader):]
+		end := bytes.Index(headers, []byte("\r\n"))
+		if end < 0 {
+			end = len(headers)
+		}
+		s.record(string(headers[:end]))
+		headers = headers[end:]
+	}
+}
+
+// merge adds the histograms of o (another client's) to s, still capped to MaxServerTimingMetrics names.
+func (s *serverTimingState) merge(o *serverTimingState) {
+	s.dropped += o.dropped
+	for name, h := range o.histograms {
+		sh, found := s.histograms[name]
+		if !found {
+			if len(s.histograms) >= MaxServerTimingMetrics {
+				s.dropped += h.Count
+				continue
+			}
+			sh = stats.NewHistogram(s.offset, s.resolution)
+			s.histograms[name] = sh
+		}
+		sh.Transfer(h)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp // import "fortio.org/fortio/fhttp"
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"fortio.org/log"
+)
+
+// Signer signs a request, typically by adding header(s) computed from a secret and the request
+// content (see HMACSHA256Signer). It is called before each request is sent (see HTTPOptions.Signer).
+// The fast client calls it with an equivalent *http.Request (same method, URL, headers and body)
+// and only uses the headers it added.
+type Signer func(req *http.Request) error
+
+// SignatureTimestampHeader is the header set by HMACSHA256Signer with the (unix seconds) timestamp used in the signature.
+const SignatureTimestampHeader = "X-Signature-Timestamp"
+
+// ErrorTypeSigning is the error type (see ErrorType) of requests not sent because the Signer failed.
+const ErrorTypeSigning = "signing"
+
+// HMACSHA256Signer returns a Signer setting the headerName header to the hex encoded
+// HMAC-SHA256(key, body+timestamp), with the timestamp in the SignatureTimestampHeader header.
+func HMACSHA256Signer(key, headerName string) Signer {
+	return func(req *http.Request) error {
+		body, err := requestBody(req)
+		if err != nil {
+			return err
+		}
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(SignatureTimestampHeader, ts)
+		req.Header.Set(headerName, HMACSHA256Signature(key, body, ts))
+		return nil
+	}
+}
+
+// HMACSHA256Signature returns the hex encoded HMAC-SHA256(key, body+timestamp), e.g. for a server
+// to check the signature of HMACSHA256Signer requests.
+func HMACSHA256Signature(key string, body []byte, timestamp string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(body)
+	mac.Write([]byte(timestamp))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// requestBody returns the body of req, which is left readable again for sending.
+func requestBody(req *http.Request) ([]byte, error) {
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, err
+}
+
+// newSignRequest returns the request template signed copies of the fast client's raw requests are made from.
+func newSignRequest(o *HTTPOptions, method, host string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(context.Background(), method, o.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = o.GenerateHeaders()
+	req.Host = host
+	return req, nil
+}
+
+// sign returns a copy of the raw request req with the headers added by the Signer,
+// or nil if signing failed.
+func (c *FastClient) sign(req []byte) []byte {
+	r := c.signReq.Clone(context.Background())
+	headerEnd := bytes.Index(req, []byte("\r\n\r\n"))
+	body := req[headerEnd+4:]
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	// Path and query can have had uuids replaced: use the actual ones from the request line.
+	if fields := bytes.SplitN(req[:bytes.IndexByte(req, '\n')], []byte(" "), 3); len(fields) == 3 {
+		if u, err := url.ParseRequestURI(string(fields[1])); err == nil {
+			r.URL.Path, r.URL.RawPath, r.URL.RawQuery = u.Path, u.RawPath, u.RawQuery
+		}
+	}
+	if err := c.signer(r); err != nil {
+		log.S(log.Error, "Unable to sign request", log.Attr("err", err), log.Attr("thread", c.id), log.Attr("run", c.runID))
+		return nil
+	}
+	for name, values := range r.Header {
+		if _, found := c.signReq.Header[name]; found {
+			continue
+		}
+		for _, v := range values {
+			req = insertHeader(req, name, v)
+		}
+	}
+	return req
+}
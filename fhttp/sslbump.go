@@ -0,0 +1,303 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp // import "fortio.org/fortio/fhttp"
+
+import (
+	"container/list"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+	"time"
+
+	"fortio.org/fortio/fnet"
+	"fortio.org/log"
+)
+
+// DefaultSSLBumpMaxCertificates is the default SSLBumpOptions.MaxCertificates.
+const DefaultSSLBumpMaxCertificates = 1000
+
+// SSLBumpOptions are the options of SSLBumpServer.
+type SSLBumpOptions struct {
+	// Paths of the (PEM) CA certificate and key signing the generated certificates, which
+	// the clients must trust.
+	CACert string
+	CAKey  string
+	// Handler serves the decrypted requests. When nil, they are forwarded (httputil.ReverseProxy)
+	// to the CONNECT destination over a new TLS connection.
+	Handler http.Handler
+	// Skip the verification of the destinations' certificates when forwarding.
+	Insecure bool
+	// Maximum number of generated certificates kept (the least recently used are evicted),
+	// DefaultSSLBumpMaxCertificates when 0.
+	MaxCertificates int
+}
+
+// sslBumper intercepts CONNECT tunnels, see SSLBumpServer.
+type sslBumper struct {
+	ca       *x509.Certificate
+	caKey    crypto.Signer
+	handler  http.Handler
+	forward  *http.Transport
+	maxCerts int
+	mutex    sync.Mutex               // protects certs, lru and pending
+	certs    map[string]*list.Element // of *bumpCert, in lru
+	lru      *list.List               // most recently used first
+	pending  map[string]*bumpCertCall // certificates being generated, once per host at a time
+}
+
+// bumpCert is a cached generated certificate.
+type bumpCert struct {
+	host string
+	cert *tls.Certificate
+}
+
+// bumpCertCall is a certificate generation in progress, waited on by the other requests for the same host.
+type bumpCertCall struct {
+	done chan struct{}
+	cert *tls.Certificate
+	err  error
+}
+
+// SSLBumpServer starts an HTTPS intercepting ("SSL bump") forward proxy on port: like a CONNECT proxy
+// (see fnet.HTTPConnectProxyServer) but instead of tunneling the raw bytes, TLS is terminated with a
+// certificate for the requested host generated on the fly and signed by the CACert, and the decrypted
+// requests are served by the Handler or forwarded to the destination. Like corporate proxies inspecting
+// HTTPS traffic, so the clients must trust the CA.
+func SSLBumpServer(port string, o *SSLBumpOptions) (net.Addr, error) {
+	b, err := newSSLBumper(o)
+	if err != nil {
+		return nil, err
+	}
+	listener, addr := fnet.Listen("ssl bump proxy", port)
+	if listener == nil {
+		return nil, fmt.Errorf("unable to listen on %q", port) // details already logged
+	}
+	s := &http.Server{
+		ReadHeaderTimeout: ServerIdleTimeout.Get(),
+		Handler:           b,
+		ErrorLog:          log.NewStdLogger("ssl bump proxy", log.Error),
+	}
+	go func() {
+		err := s.Serve(listener)
+		if err != nil {
+			log.Fatalf("Unable to serve ssl bump proxy on %s: %v", addr.String(), err)
+		}
+	}()
+	return addr, nil
+}
+
+// newSSLBumper loads the CA of o.
+func newSSLBumper(o *SSLBumpOptions) (*sslBumper, error) {
+	caPair, err := tls.LoadX509KeyPair(o.CACert, o.CAKey)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := x509.ParseCertificate(caPair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	if !ca.IsCA {
+		return nil, fmt.Errorf("%s is not a CA certificate", o.CACert)
+	}
+	caKey, ok := caPair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported CA key type")
+	}
+	b := &sslBumper{
+		ca:       ca,
+		caKey:    caKey,
+		handler:  o.Handler,
+		maxCerts: o.MaxCertificates,
+		certs:    make(map[string]*list.Element),
+		lru:      list.New(),
+		pending:  make(map[string]*bumpCertCall),
+	}
+	if b.maxCerts <= 0 {
+		b.maxCerts = DefaultSSLBumpMaxCertificates
+	}
+	if b.handler == nil {
+		b.forward = http.DefaultTransport.(*http.Transport).Clone()
+		b.forward.TLSClientConfig = &tls.Config{InsecureSkipVerify: o.Insecure} //nolint:gosec // user requested.
+	}
+	return b, nil
+}
+
+// ServeHTTP handles the CONNECT requests: hijacks the connection and serves the decrypted requests on it.
+func (b *sslBumper) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect {
+		w.Header().Set("Allow", http.MethodConnect)
+		http.Error(w, "Only CONNECT is supported by this proxy", http.StatusMethodNotAllowed)
+		return
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Unable to hijack the connection", http.StatusInternalServerError)
+		return
+	}
+	conn, _, err := hj.Hijack()
+	if err != nil {
+		log.S(log.Error, "Unable to hijack CONNECT connection", log.Attr("err", err), log.Str("dest", r.Host))
+		return
+	}
+	if _, err = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n")); err != nil {
+		_ = conn.Close()
+		return
+	}
+	dest := r.Host
+	hostname, _, err := net.SplitHostPort(dest)
+	if err != nil {
+		hostname = dest
+	}
+	tlsConn := tls.Server(conn, &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"http/1.1"},
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if hello.ServerName != "" {
+				return b.certificate(hello.ServerName)
+			}
+			return b.certificate(hostname)
+		},
+	})
+	log.S(log.Info, "SSL bump intercepting", log.Str("client", r.RemoteAddr), log.Str("dest", dest))
+	l := &singleConnListener{conn: make(chan net.Conn, 1), done: make(chan struct{}), addr: conn.LocalAddr()}
+	l.conn <- tlsConn
+	s := &http.Server{
+		ReadHeaderTimeout: ServerIdleTimeout.Get(),
+		IdleTimeout:       ServerIdleTimeout.Get(),
+		Handler:           b.innerHandler(dest),
+		ErrorLog:          log.NewStdLogger("ssl bump "+dest, log.Error),
+		ConnState: func(_ net.Conn, state http.ConnState) {
+			if state == http.StateClosed || state == http.StateHijacked {
+				_ = l.Close()
+			}
+		},
+	}
+	_ = s.Serve(l) // returns once the connection is closed
+}
+
+// innerHandler returns the handler of the decrypted requests for the CONNECT destination dest.
+func (b *sslBumper) innerHandler(dest string) http.Handler {
+	if b.handler != nil {
+		return b.handler
+	}
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL.Scheme = "https"
+			pr.Out.URL.Host = dest
+		},
+		Transport: b.forward,
+		ErrorLog:  log.NewStdLogger("ssl bump forward "+dest, log.Error),
+	}
+}
+
+// certificate returns the (cached) certificate for host, signed by the CA. The certificates are
+// generated outside of the lock, once for the concurrent requests for the same host.
+func (b *sslBumper) certificate(host string) (*tls.Certificate, error) {
+	b.mutex.Lock()
+	if e, found := b.certs[host]; found {
+		b.lru.MoveToFront(e)
+		b.mutex.Unlock()
+		return e.Value.(*bumpCert).cert, nil
+	}
+	if c, found := b.pending[host]; found {
+		b.mutex.Unlock()
+		<-c.done
+		return c.cert, c.err
+	}
+	c := &bumpCertCall{done: make(chan struct{})}
+	b.pending[host] = c
+	b.mutex.Unlock()
+	c.cert, c.err = b.generateCertificate(host)
+	b.mutex.Lock()
+	delete(b.pending, host)
+	if c.err == nil {
+		b.certs[host] = b.lru.PushFront(&bumpCert{host: host, cert: c.cert})
+		if b.lru.Len() > b.maxCerts {
+			oldest := b.lru.Remove(b.lru.Back()).(*bumpCert)
+			delete(b.certs, oldest.host)
+		}
+	}
+	b.mutex.Unlock()
+	close(c.done)
+	return c.cert, c.err
+}
+
+// generateCertificate returns a new certificate for host, signed by the CA.
+func (b *sslBumper) generateCertificate(host string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     b.ca.NotAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, b.ca, &key.PublicKey, b.caKey)
+	if err != nil {
+		return nil, err
+	}
+	log.S(log.Verbose, "SSL bump generated certificate", log.Str("host", host))
+	return &tls.Certificate{Certificate: [][]byte{der, b.ca.Raw}, PrivateKey: key}, nil
+}
+
+// singleConnListener is a net.Listener returning a single connection, then blocking until closed.
+type singleConnListener struct {
+	conn chan net.Conn
+	done chan struct{}
+	once sync.Once
+	addr net.Addr
+}
+
+func (l *singleConnListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conn:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *singleConnListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *singleConnListener) Addr() net.Addr {
+	return l.addr
+}
@@ -0,0 +1,91 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp // import "fortio.org/fortio/fhttp"
+
+import (
+	"net"
+
+	"fortio.org/fortio/fnet"
+	"fortio.org/fortio/stats"
+	"fortio.org/log"
+)
+
+// TCPMetrics are the aggregated kernel TCP_INFO samples of the fast client connections (see HTTPOptions.TCPInfo).
+type TCPMetrics struct {
+	// Smoothed round trip times, in seconds.
+	RTT *stats.HistogramData
+	// Congestion windows, in segments.
+	Cwnd *stats.HistogramData
+	// Retransmitted segments, across all the connections.
+	Retransmits int64
+}
+
+// tcpInfoState is the fast client's TCP_INFO sampling state.
+type tcpInfoState struct {
+	enabled     bool
+	rtt         *stats.Histogram
+	cwnd        *stats.Histogram
+	retransmits int64
+	// Retransmits of the current connection at the last sample, the kernel's count being per connection.
+	lastRetransmits uint32
+	warned          bool
+}
+
+func newTCPInfoHistograms() (rtt, cwnd *stats.Histogram) {
+	return stats.NewHistogram(0, 0.0001), stats.NewHistogram(0, 1)
+}
+
+func newTCPInfoState(enabled bool) tcpInfoState {
+	s := tcpInfoState{enabled: enabled}
+	if enabled {
+		s.rtt, s.cwnd = newTCPInfoHistograms()
+	}
+	return s
+}
+
+// newConnection samples a just established connection.
+func (s *tcpInfoState) newConnection(conn net.Conn, id int, runID int64) {
+	s.lastRetransmits = 0
+	s.sample(conn, id, runID)
+}
+
+// sample records the current TCP_INFO of the connection.
+func (s *tcpInfoState) sample(conn net.Conn, id int, runID int64) {
+	if !s.enabled || conn == nil {
+		return
+	}
+	info, err := fnet.GetTCPInfo(conn)
+	if err != nil {
+		if !s.warned {
+			s.warned = true
+			log.S(log.Warning, "Unable to get TCP_INFO", log.Attr("err", err), log.Attr("thread", id), log.Attr("run", runID))
+		}
+		return
+	}
+	s.rtt.Record(info.RTT.Seconds())
+	s.cwnd.Record(float64(info.Cwnd))
+	s.retransmits += int64(info.Retransmits - s.lastRetransmits)
+	s.lastRetransmits = info.Retransmits
+}
+
+// merge adds the samples of o (another client's) to s.
+func (s *tcpInfoState) merge(o *tcpInfoState) {
+	if !s.enabled || !o.enabled {
+		return
+	}
+	s.rtt.Transfer(o.rtt)
+	s.cwnd.Transfer(o.cwnd)
+	s.retransmits += o.retransmits
+}
@@ -0,0 +1,96 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp // import "fortio.org/fortio/fhttp"
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AddRequestTrailer adds a "key:value" trailer to RequestTrailers.
+func (h *HTTPOptions) AddRequestTrailer(trailer string) error {
+	key, value, found := strings.Cut(trailer, ":")
+	key = strings.TrimSpace(key)
+	if !found || key == "" {
+		return fmt.Errorf("invalid trailer '%s', expecting Key: Value", trailer)
+	}
+	if h.RequestTrailers == nil {
+		h.RequestTrailers = make(http.Header)
+	}
+	h.RequestTrailers.Add(key, strings.TrimSpace(value))
+	return nil
+}
+
+// sendsTrailers returns true when requests have trailers (and thus a chunked body).
+func (h *HTTPOptions) sendsTrailers() bool {
+	return len(h.RequestTrailers) > 0 && !h.HTTP10
+}
+
+// setTrailerHeaders replaces the Content-Length of headers by the chunked Transfer-Encoding
+// and announces the RequestTrailers names in the Trailer header.
+func (h *HTTPOptions) setTrailerHeaders(headers http.Header) {
+	names := make([]string, 0, len(h.RequestTrailers))
+	for name := range h.RequestTrailers {
+		names = append(names, http.CanonicalHeaderKey(name))
+	}
+	sort.Strings(names)
+	headers.Del(contentLength)
+	headers.Set("Transfer-Encoding", "chunked")
+	headers.Set("Trailer", strings.Join(names, ", "))
+}
+
+// chunkedBody returns the payload as a chunked body (RFC 7230 section 4.1): a single chunk,
+// unless the payload is empty, followed by the last (0 sized) chunk and the trailers.
+func chunkedBody(payload []byte, trailers http.Header) []byte {
+	var buf bytes.Buffer
+	if len(payload) > 0 {
+		buf.WriteString(strconv.FormatInt(int64(len(payload)), 16) + "\r\n")
+		buf.Write(payload)
+		buf.WriteString("\r\n")
+	}
+	buf.WriteString("0\r\n")
+	_ = trailers.Write(&buf)
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
+
+// setRequestTrailers makes the std client send req's body chunked, followed by the trailers.
+func setRequestTrailers(req *http.Request, body []byte, trailers http.Header) {
+	req.Trailer = trailers.Clone()
+	req.ContentLength = -1 // unknown: chunked
+	if req.Body == nil || req.Body == http.NoBody {
+		setBody(req, body) // even empty, a body is needed for the trailers to be sent
+	}
+}
+
+// declareEchoTrailers announces, before the response headers are written, the trailers of the request r
+// as trailers of the response, so echoTrailers can set them once the request body has been read.
+func declareEchoTrailers(w http.ResponseWriter, r *http.Request) {
+	for name := range r.Trailer {
+		w.Header().Add("Trailer", name)
+	}
+}
+
+// echoTrailers sets the response trailers declared by declareEchoTrailers to the values of the
+// request's ones, available once its body has been read.
+func echoTrailers(w http.ResponseWriter, r *http.Request) {
+	for name, values := range r.Trailer {
+		w.Header()[name] = values
+	}
+}
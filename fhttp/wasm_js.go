@@ -0,0 +1,36 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build js && wasm
+
+package fhttp // import "fortio.org/fortio/fhttp"
+
+import "fortio.org/fortio/periodic"
+
+// jsFetch is true in the browser (WebAssembly) build: there are no sockets there, the std client's
+// net/http then uses the browser's fetch() API, as long as its transport doesn't have a custom dialer.
+const jsFetch = true
+
+// RunHTTPTestWASM runs an HTTP load test of url from the browser (using the std client through fetch()),
+// with the other options from opts, and returns the results (or the error result if it can't start).
+// Note that the target server must allow the page's origin through CORS.
+func RunHTTPTestWASM(url string, opts HTTPRunnerOptions) periodic.RunnerResults {
+	opts.URL = url
+	opts.DisableFastClient = true
+	res, _ := RunHTTPTest(&opts) // errors are logged and included in the (error) result.
+	if res == nil {
+		return NewErrorResult(&opts, "run error", nil).RunnerResults
+	}
+	return res.RunnerResults
+}
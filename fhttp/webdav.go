@@ -0,0 +1,96 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp // import "fortio.org/fortio/fhttp"
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"fortio.org/log"
+)
+
+// WebDAVPath is the path, e.g. /webdav/, the echo servers started after it is set (see ServeTLS)
+// serve WebDAVHandler on. Empty (the default) for none.
+var WebDAVPath string
+
+// webDAVMethods are the methods handled by WebDAVHandler, besides the ones it passes to EchoHandler.
+const webDAVMethods = "OPTIONS, GET, HEAD, POST, PUT, DELETE, MKCOL, COPY, MOVE, PROPFIND"
+
+// WebDAVHandler is a fake WebDAV server, to load test WebDAV clients or compare with actual storage
+// backends: PROPFIND returns a minimal 207 Multi-Status for the requested path, MKCOL and PUT (whose
+// body is discarded) 201 Created, DELETE 204 No Content and COPY and MOVE 201 Created with the request's
+// Destination header echoed back. Other methods are handled by EchoHandler. Like for the echo handler,
+// the delay, close and header query arguments are supported.
+func WebDAVHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPost:
+		EchoHandler(w, r)
+		return
+	}
+	if log.LogVerbose() {
+		log.LogRequest(r, "WebDAV")
+	}
+	handleCommonArgs(w, r)
+	_, _ = io.Copy(io.Discard, r.Body)
+	switch r.Method {
+	case http.MethodOptions:
+		w.Header().Set("Dav", "1")
+		w.Header().Set("Allow", webDAVMethods)
+		w.WriteHeader(http.StatusOK)
+	case "PROPFIND":
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.WriteHeader(http.StatusMultiStatus)
+		if _, err := w.Write(propfindResponse(r.URL.Path)); err != nil {
+			log.Errf("Error writing PROPFIND response to %v: %v", r.RemoteAddr, err)
+		}
+	case "MKCOL", http.MethodPut:
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		w.WriteHeader(http.StatusNoContent)
+	case "COPY", "MOVE":
+		dest := r.Header.Get("Destination")
+		if dest == "" {
+			http.Error(w, "missing Destination header", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Destination", dest)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.Header().Set("Allow", webDAVMethods)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// propfindResponse returns the Multi-Status body of a PROPFIND of path: a single response with its
+// resource type (a collection when path ends with /) and a last modified time of now.
+func propfindResponse(path string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString("<D:multistatus xmlns:D=\"DAV:\">\n<D:response>\n<D:href>")
+	_ = xml.EscapeText(&buf, []byte(path))
+	buf.WriteString("</D:href>\n<D:propstat>\n<D:prop>\n")
+	if strings.HasSuffix(path, "/") {
+		buf.WriteString("<D:resourcetype><D:collection/></D:resourcetype>\n")
+	} else {
+		buf.WriteString("<D:resourcetype/>\n")
+	}
+	buf.WriteString("<D:getlastmodified>" + time.Now().UTC().Format(http.TimeFormat) + "</D:getlastmodified>\n")
+	buf.WriteString("</D:prop>\n<D:status>HTTP/1.1 200 OK</D:status>\n</D:propstat>\n</D:response>\n</D:multistatus>\n")
+	return buf.Bytes()
+}
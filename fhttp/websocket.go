@@ -0,0 +1,59 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fhttp // import "fortio.org/fortio/fhttp"
+
+import (
+	"strings"
+
+	"fortio.org/fortio/fnet"
+	"fortio.org/log"
+)
+
+// ErrorTypeWebSocketUpgrade is the error type (see ErrorType) of the 101 Switching Protocols
+// responses: the connection is closed as the clients don't speak the upgraded protocol.
+const ErrorTypeWebSocketUpgrade = "websocket upgrade"
+
+// WebSocket URL schemes, replaced by their http equivalent (see HTTPOptions.URLSchemeCheck).
+const (
+	prefixWS  = "ws://"
+	prefixWSS = "wss://"
+)
+
+// wsUpgradeState is the per client count of responses upgrading the connection.
+type wsUpgradeState struct {
+	count int64
+}
+
+// upgraded records (and logs the first time) a 101 Switching Protocols response.
+func (s *wsUpgradeState) upgraded(url string, id int, runID int64) {
+	s.count++
+	if s.count == 1 {
+		log.S(log.Warning, "Server upgraded to WebSocket, connection closed", log.Str("url", url),
+			log.Attr("thread", id), log.Attr("run", runID))
+	}
+}
+
+// webSocketURL returns the http(s) equivalent of a ws:// or wss:// url, and false if it isn't a WebSocket url.
+func webSocketURL(url string) (string, bool) {
+	lcURL := strings.ToLower(url[:min(len(url), len(prefixWSS))])
+	switch {
+	case strings.HasPrefix(lcURL, prefixWS):
+		return fnet.PrefixHTTP + url[len(prefixWS):], true
+	case strings.HasPrefix(lcURL, prefixWSS):
+		return fnet.PrefixHTTPS + url[len(prefixWSS):], true
+	default:
+		return url, false
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fnet // import "fortio.org/fortio/fnet"
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"fortio.org/log"
+)
+
+// BandwidthResult is the outcome of a NetCatBandwidth test.
+type BandwidthResult struct {
+	Duration time.Duration
+	TxBytes  int64 // bytes sent
+	RxBytes  int64 // bytes received back, e.g. from an echo server
+}
+
+// TxMBps returns the sending throughput in MB/s (10^6 bytes per second).
+func (r *BandwidthResult) TxMBps() float64 {
+	return float64(r.TxBytes) / 1e6 / r.Duration.Seconds()
+}
+
+// RxMBps returns the receiving throughput in MB/s (10^6 bytes per second).
+func (r *BandwidthResult) RxMBps() float64 {
+	return float64(r.RxBytes) / 1e6 / r.Duration.Seconds()
+}
+
+// Print writes the bytes transferred and throughput in both directions to out.
+func (r *BandwidthResult) Print(out io.Writer) {
+	_, _ = fmt.Fprintf(out, "Bandwidth test for %v: TX %d bytes, %.2f MB/s; RX %d bytes, %.2f MB/s\n",
+		r.Duration.Round(time.Millisecond), r.TxBytes, r.TxMBps(), r.RxBytes, r.RxMBps())
+}
+
+// NetCatBandwidth connects to the TCP destination and, instead of NetCat's piping, sends zeros as fast
+// as possible for duration (or until ctx is done) while reading what the destination sends back,
+// e.g. an echo server, and returns the bytes transferred in both directions.
+func NetCatBandwidth(ctx context.Context, dest string, duration time.Duration) (*BandwidthResult, error) {
+	log.Infof("TCP NetCat bandwidth test to %s for %v", dest, duration)
+	a, err := TCPResolveDestination(ctx, dest)
+	if a == nil {
+		return nil, err // already logged
+	}
+	d, err := net.DialTCP("tcp", nil, a)
+	if err != nil {
+		log.Errf("Connection error to %q: %v", dest, err)
+		return nil, err
+	}
+	defer d.Close()
+	var tx, rx atomic.Int64
+	var wg sync.WaitGroup
+	wg.Add(2)
+	start := time.Now()
+	go func() {
+		buf := make([]byte, 32*KILOBYTE)
+		for {
+			n, err := d.Write(buf)
+			tx.Add(int64(n))
+			if err != nil {
+				break
+			}
+		}
+		wg.Done()
+	}()
+	go func() {
+		buf := make([]byte, 32*KILOBYTE)
+		for {
+			n, err := d.Read(buf)
+			rx.Add(int64(n))
+			if err != nil {
+				break
+			}
+		}
+		wg.Done()
+	}()
+	select {
+	case <-time.After(duration):
+	case <-ctx.Done():
+	}
+	elapsed := time.Since(start)
+	// Unblocks both goroutines:
+	_ = d.SetDeadline(time.Now())
+	wg.Wait()
+	res := &BandwidthResult{Duration: elapsed, TxBytes: tx.Load(), RxBytes: rx.Load()}
+	log.Infof("Bandwidth test to %s done: sent %d, received %d bytes in %v", dest, res.TxBytes, res.RxBytes, elapsed)
+	return res, nil
+}
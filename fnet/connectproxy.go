@@ -0,0 +1,127 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fnet // import "fortio.org/fortio/fnet"
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"fortio.org/log"
+)
+
+// DefaultConnectProxyTimeout is the HTTPConnectProxyServer timeout used when 0 is passed.
+// Same default as the HTTP request timeout (-timeout).
+const DefaultConnectProxyTimeout = 3 * time.Second
+
+// HTTPConnectProxyServer starts an HTTP CONNECT (forward) proxy on addr (port, host:port or Unix domain
+// socket path), e.g. to test HTTP clients (like fortio's own with HTTPOptions.HTTPProxy) behind a proxy:
+// for each "CONNECT host:port HTTP/1.1" request, it dials host:port, replies 200 and then splices both
+// connections. Other requests get an error reply. Each tunnel is logged, with the bytes transferred in
+// both directions, when it ends. Reading the request and dialing are each bounded by timeout
+// (DefaultConnectProxyTimeout when 0). Returns nil if it can't listen on addr (error already logged).
+func HTTPConnectProxyServer(addr string, timeout time.Duration) net.Addr {
+	if timeout <= 0 {
+		timeout = DefaultConnectProxyTimeout
+	}
+	listener, lAddr := Listen("http connect proxy", addr)
+	if listener == nil {
+		return nil
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				log.Errf("Connect proxy: error accepting: %v", err)
+				continue
+			}
+			go handleConnectRequest(conn, timeout)
+		}
+	}()
+	return lAddr
+}
+
+// connectReply writes a (non 200) reply to the CONNECT request and closes the connection.
+func connectReply(conn net.Conn, status int, extra string) {
+	_, _ = fmt.Fprintf(conn, "HTTP/1.1 %d %s\r\n%sContent-Length: 0\r\nConnection: close\r\n\r\n",
+		status, http.StatusText(status), extra)
+	_ = conn.Close()
+}
+
+func handleConnectRequest(conn net.Conn, timeout time.Duration) {
+	client := conn.RemoteAddr().String()
+	br := bufio.NewReader(conn)
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		log.S(log.Warning, "Connect proxy: invalid request", log.Str("client", client), log.Attr("err", err))
+		connectReply(conn, http.StatusBadRequest, "")
+		return
+	}
+	if req.Method != http.MethodConnect {
+		log.S(log.Warning, "Connect proxy: unsupported method", log.Str("client", client), log.Str("method", req.Method),
+			log.Str("url", req.RequestURI))
+		connectReply(conn, http.StatusMethodNotAllowed, "Allow: CONNECT\r\n")
+		return
+	}
+	dest := req.Host
+	start := time.Now()
+	d, err := net.DialTimeout("tcp", dest, timeout)
+	if err != nil {
+		log.S(log.Warning, "Connect proxy: unable to connect", log.Str("client", client), log.Str("dest", dest),
+			log.Attr("err", err))
+		status := http.StatusBadGateway
+		if os.IsTimeout(err) {
+			status = http.StatusGatewayTimeout
+		}
+		connectReply(conn, status, "")
+		return
+	}
+	_ = conn.SetReadDeadline(time.Time{}) // the tunnel itself has no timeout
+	if _, err = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n")); err != nil {
+		log.S(log.Warning, "Connect proxy: unable to reply", log.Str("client", client), log.Attr("err", err))
+		_ = d.Close()
+		_ = conn.Close()
+		return
+	}
+	var sent, received int64
+	var wg sync.WaitGroup
+	wg.Add(2)
+	// The client may have sent more than the request already (e.g. the TLS hello), in br's buffer.
+	go connectTransfer(&wg, d, conn, br, &sent)
+	connectTransfer(&wg, conn, d, d, &received)
+	wg.Wait()
+	_ = d.Close()
+	_ = conn.Close()
+	log.S(log.Info, "Connect proxy tunnel", log.Str("client", client), log.Str("dest", dest),
+		log.Attr("bytes_sent", sent), log.Attr("bytes_received", received), log.Attr("elapsed", time.Since(start)))
+}
+
+// connectTransfer copies r, the reader of src, to dst and sets n to the bytes transferred.
+func connectTransfer(wg *sync.WaitGroup, dst net.Conn, src net.Conn, r io.Reader, n *int64) {
+	var oErr error
+	*n, oErr = io.Copy(dst, r)
+	halfClose(dst, src, oErr)
+	wg.Done()
+}
@@ -0,0 +1,138 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fnet // import "fortio.org/fortio/fnet"
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"fortio.org/log"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DNSMessageContentType is the media type of DNS wire format queries and responses (RFC 8484).
+const DNSMessageContentType = "application/dns-message"
+
+// DOHTimeout is the maximum duration of each DNS over HTTPS query made by DOHResolver.
+var DOHTimeout = 5 * time.Second
+
+// ResolveFunc returns the IPs of host, filtered by resolveType like ResolveAll.
+type ResolveFunc func(ctx context.Context, host, resolveType string) ([]net.IP, error)
+
+// DOHResolver returns a ResolveFunc doing DNS over HTTPS (RFC 8484) queries to the url
+// (e.g. https://cloudflare-dns.com/dns-query): the wire format query is sent, base64url encoded,
+// as the dns= parameter of a GET request. The A (and/or AAAA, depending on the resolveType) records
+// of the answers are returned in order, the first one being used by the "doh" dns method.
+func DOHResolver(url string) ResolveFunc {
+	client := &http.Client{Timeout: DOHTimeout}
+	return func(ctx context.Context, host, resolveType string) ([]net.IP, error) {
+		var qTypes []dnsmessage.Type
+		switch resolveType {
+		case "ip4":
+			qTypes = []dnsmessage.Type{dnsmessage.TypeA}
+		case "ip6":
+			qTypes = []dnsmessage.Type{dnsmessage.TypeAAAA}
+		default:
+			qTypes = []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA}
+		}
+		var res []net.IP
+		for _, qType := range qTypes {
+			ips, err := dohQuery(ctx, client, url, host, qType)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, ips...)
+		}
+		if len(res) == 0 {
+			return nil, fmt.Errorf("no %v record found for %q using %s", qTypes, host, url)
+		}
+		log.LogVf("DoH %s resolved %q to %v", url, host, res)
+		return res, nil
+	}
+}
+
+// dohQuery sends the qType question for host to the DoH url and returns the matching answers.
+func dohQuery(ctx context.Context, client *http.Client, url, host string, qType dnsmessage.Type) ([]net.IP, error) {
+	name, err := dnsmessage.NewName(strings.TrimSuffix(host, ".") + ".")
+	if err != nil {
+		return nil, err
+	}
+	// ID 0 as recommended by RFC 8484 for http caches friendliness.
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: qType, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+	sep := "?"
+	if strings.Contains(url, "?") {
+		sep = "&"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+sep+"dns="+base64.RawURLEncoding.EncodeToString(packed), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", DNSMessageContentType)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH query for %q to %s returned status %d", host, url, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*int64(KILOBYTE))) // max DNS message size
+	if err != nil {
+		return nil, err
+	}
+	var reply dnsmessage.Message
+	if err = reply.Unpack(body); err != nil {
+		return nil, fmt.Errorf("invalid DoH response for %q from %s: %w", host, url, err)
+	}
+	if reply.RCode != dnsmessage.RCodeSuccess {
+		return nil, fmt.Errorf("DoH query for %q to %s failed: %v", host, url, reply.RCode)
+	}
+	var res []net.IP
+	for _, a := range reply.Answers {
+		switch b := a.Body.(type) {
+		case *dnsmessage.AResource:
+			res = append(res, net.IP(b.A[:]))
+		case *dnsmessage.AAAAResource:
+			res = append(res, net.IP(b.AAAA[:]))
+		}
+	}
+	return res, nil
+}
+
+// errNoDOHURL is returned when the "doh" dns method is used without a FlagDOHURL.
+var errNoDOHURL = errors.New("the doh dns method needs a DoH server url (-doh-url)")
+
+// dohResolve is the ResolveAll lookup for the "doh" dns method, using the FlagDOHURL server.
+func dohResolve(ctx context.Context, host, resolveType string) ([]net.IP, error) {
+	url := FlagDOHURL.Get()
+	if url == "" {
+		return nil, errNoDOHURL
+	}
+	return DOHResolver(url)(ctx, host, resolveType)
+}
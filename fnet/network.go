@@ -29,6 +29,7 @@ import (
 
 	"fortio.org/dflag"
 	"fortio.org/fortio/jrpc"
+	"fortio.org/fortio/stats"
 	"fortio.org/fortio/version"
 	"fortio.org/log"
 	"fortio.org/safecast"
@@ -68,13 +69,18 @@ var (
 	// for localhost but fail to connect. So we made the default ip4 only.
 	// See bincommon/commonflags.go for how an actual dflag is plugged here.
 	FlagResolveIPType = dflag.New("ip4",
-		"Resolve `type`: ip4 for ipv4, ip6 for ipv6 only, use ip for both")
+		"Resolve `type`: ip4 for ipv4, ip6 for ipv6 only, use ip for both, "+
+			"dual for both with parallel (happy eyeballs) connection attempts in the fast http client")
 	// FlagResolveMethod decides which method to use when multiple IPs are returned for a given name
 	// default assumes one gets all the IPs in the first call and does round-robin across these.
 	// first just picks the first answer, rr rounds robin on each answer.
 	FlagResolveMethod = dflag.New("cached-rr",
 		"When a name resolves to multiple ip, which `method` to pick: cached-rr for cached round-robin, rnd for random, "+
-			"first for first answer (pre 1.30 behavior), rr for round-robin.").WithValidator(dnsMethodValidator)
+			"first for first answer (pre 1.30 behavior), rr for round-robin, "+
+			"doh for the first answer of the -doh-url DNS over HTTPS server.").WithValidator(dnsMethodValidator)
+	// FlagDOHURL is the DNS over HTTPS server url used by the "doh" FlagResolveMethod (see DOHResolver).
+	FlagDOHURL = dflag.New("", "DNS over HTTPS (RFC 8484) server `url` to resolve names with when -dns-method is doh, "+
+		"e.g. https://cloudflare-dns.com/dns-query")
 	// cache for cached-rr mode.
 	dnsMutex sync.Mutex
 	// all below are updated under lock.
@@ -89,11 +95,12 @@ func dnsMethodValidator(inp string) error {
 		"rnd":       true,
 		"rr":        true,
 		"first":     true,
+		"doh":       true,
 	}
 	if valid[inp] {
 		return nil
 	}
-	return errors.New("invalid value for dns method, should be one of cached-rr, first, rnd or rr")
+	return errors.New("invalid value for dns method, should be one of cached-rr, doh, first, rnd or rr")
 }
 
 //nolint:gochecknoinits // needed here (unit change)
@@ -134,6 +141,18 @@ func NormalizePort(port string) string {
 // This logs critical on error and returns nil (is meant for servers
 // that must start).
 func Listen(name string, port string) (net.Listener, net.Addr) {
+	return ListenWithOptions(name, port, ListenOptions{})
+}
+
+// ListenOptions are the optional socket settings of ListenWithOptions.
+type ListenOptions struct {
+	// Sets SO_REUSEPORT (Linux and macOS only) so several listeners, each with their own accepting
+	// goroutine, can bind the same port, the kernel then distributes the incoming connections among them.
+	ReusePort bool
+}
+
+// ListenWithOptions is Listen with the additional ListenOptions (ignored for Unix domain sockets).
+func ListenWithOptions(name string, port string, opts ListenOptions) (net.Listener, net.Addr) {
 	sockType := "tcp"
 	nPort := port
 	if strings.Contains(port, "/") {
@@ -141,7 +160,11 @@ func Listen(name string, port string) (net.Listener, net.Addr) {
 	} else {
 		nPort = NormalizePort(port)
 	}
-	listener, err := net.Listen(sockType, nPort)
+	var lc net.ListenConfig
+	if opts.ReusePort && sockType != UnixDomainSocket {
+		lc.Control = reusePortControl
+	}
+	listener, err := lc.Listen(context.Background(), sockType, nPort)
 	if err != nil {
 		log.Critf("Can't listen to %s socket %v (%v) for %s: %v", sockType, port, nPort, name, err)
 		return nil, nil
@@ -181,7 +204,13 @@ func handleTCPEchoRequest(name string, conn net.Conn) {
 
 // TCPEchoServer starts a TCP Echo Server on given port, name is for logging.
 func TCPEchoServer(name string, port string) net.Addr {
-	listener, addr := Listen(name, port)
+	return TCPEchoServerWithOptions(name, port, ListenOptions{})
+}
+
+// TCPEchoServerWithOptions is TCPEchoServer with ListenOptions, e.g. ReusePort to start
+// multiple echo servers (accept loops) on the same port.
+func TCPEchoServerWithOptions(name string, port string, opts ListenOptions) net.Addr {
+	listener, addr := ListenWithOptions(name, port, opts)
 	if listener == nil {
 		return nil // error already logged
 	}
@@ -201,6 +230,163 @@ func TCPEchoServer(name string, port string) net.Addr {
 	return addr
 }
 
+// EchoStats are the statistics of an EchoServer.
+type EchoStats struct {
+	Connections int64 // accepted connections
+	BytesEchoed int64
+	Errors      int64 // read or write errors (EOF excluded)
+	// Time from first byte received to last byte sent for each connection which received data, in seconds.
+	LatencyHistogram *stats.HistogramData
+}
+
+// EchoServer is the handle of a TCP echo server started with TCPEchoServerWithMetrics.
+type EchoServer struct {
+	Addr        net.Addr
+	name        string
+	listener    net.Listener
+	wg          sync.WaitGroup
+	mutex       sync.Mutex // protects the fields below
+	conns       map[net.Conn]struct{}
+	closing     bool
+	connections int64
+	bytesEchoed int64
+	errors      int64
+	latency     *stats.Histogram
+}
+
+// TCPEchoServerWithMetrics starts a TCP Echo Server on given port, name is for logging, like
+// TCPEchoServer but with statistics (see Stats()) and a clean Shutdown().
+func TCPEchoServerWithMetrics(name string, port string) (*EchoServer, error) {
+	listener, addr := Listen(name, port)
+	if listener == nil {
+		return nil, fmt.Errorf("unable to listen on %q for %s", port, name) // details already logged
+	}
+	s := &EchoServer{
+		Addr:     addr,
+		name:     name,
+		listener: listener,
+		conns:    make(map[net.Conn]struct{}),
+		latency:  stats.NewHistogram(0, 0.0001),
+	}
+	s.wg.Add(1)
+	go s.acceptLoop()
+	return s, nil
+}
+
+func (s *EchoServer) acceptLoop() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			s.mutex.Lock()
+			closing := s.closing
+			s.mutex.Unlock()
+			if closing {
+				return
+			}
+			log.Errf("TCP echo server (%v) error accepting: %v", s.name, err)
+			continue
+		}
+		log.LogVf("TCP echo server (%v) accepted connection from %v -> %v", s.name, conn.RemoteAddr(), conn.LocalAddr())
+		s.mutex.Lock()
+		if s.closing {
+			s.mutex.Unlock()
+			_ = conn.Close()
+			return
+		}
+		s.connections++
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mutex.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *EchoServer) handle(conn net.Conn) {
+	defer s.wg.Done()
+	SetSocketBuffers(conn, 32*KILOBYTE, 32*KILOBYTE)
+	buf := make([]byte, 32*KILOBYTE)
+	var first, last time.Time
+	var total int64
+	hadError := false
+	for {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			if first.IsZero() {
+				first = time.Now()
+			}
+			w, wErr := conn.Write(buf[:n])
+			total += int64(w)
+			last = time.Now()
+			if wErr != nil {
+				log.LogVf("TCP echo server (%v) write error to %v: %v", s.name, conn.RemoteAddr(), wErr)
+				hadError = true
+				break
+			}
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.LogVf("TCP echo server (%v) read error from %v: %v", s.name, conn.RemoteAddr(), err)
+				hadError = true
+			}
+			break
+		}
+	}
+	_ = conn.Close()
+	log.LogVf("TCP echo server (%v) echoed %d bytes from %v to itself (err=%v)", s.name, total, conn.RemoteAddr(), hadError)
+	s.mutex.Lock()
+	delete(s.conns, conn)
+	s.bytesEchoed += total
+	if hadError && !s.closing {
+		s.errors++
+	}
+	if !first.IsZero() {
+		s.latency.Record(last.Sub(first).Seconds())
+	}
+	s.mutex.Unlock()
+}
+
+// Stats returns a snapshot of the echo server's statistics.
+func (s *EchoServer) Stats() EchoStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return EchoStats{
+		Connections:      s.connections,
+		BytesEchoed:      s.bytesEchoed,
+		Errors:           s.errors,
+		LatencyHistogram: s.latency.Export(),
+	}
+}
+
+// Shutdown stops accepting new connections and waits for the in-flight ones to be closed by
+// their clients. If the context expires first, the remaining connections are closed and
+// the context's error is returned.
+func (s *EchoServer) Shutdown(ctx context.Context) error {
+	s.mutex.Lock()
+	s.closing = true
+	s.mutex.Unlock()
+	err := s.listener.Close()
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		log.Infof("TCP echo server (%v) shutdown complete", s.name)
+		return err
+	case <-ctx.Done():
+	}
+	s.mutex.Lock()
+	log.Warnf("TCP echo server (%v) forcing close of %d connections: %v", s.name, len(s.conns), ctx.Err())
+	for c := range s.conns {
+		_ = c.Close()
+	}
+	s.mutex.Unlock()
+	<-done
+	return ctx.Err()
+}
+
 func handleUDPEchoRequest(name string, conn *net.UDPConn, addr *net.UDPAddr, buf []byte) {
 	wb, err := conn.WriteToUDP(buf, addr)
 	log.LogVf("UDP echo server (%v) echoed %d bytes back to %v (err=%v)", name, wb, addr, err)
@@ -247,6 +433,8 @@ func GetPort(lAddr net.Addr) string {
 		lPort = lAddr.(*net.UnixAddr).Name
 	case "udp":
 		lPort = strconv.Itoa(lAddr.(*net.UDPAddr).Port)
+	case "sctp":
+		lPort = strconv.Itoa(lAddr.(*SCTPAddr).Port)
 	default:
 		lPort = strconv.Itoa(lAddr.(*net.TCPAddr).Port)
 	}
@@ -395,7 +583,7 @@ func ResolveByProto(ctx context.Context, host string, port string, proto string)
 			idx = dnsRoundRobin % safecast.MustConvert[uint32](len(addrs))
 			dnsRoundRobin++
 			log.Debugf("Using rr address #%d for %s : %v", idx, host, addrs)
-		case "first":
+		case "first", "doh":
 			log.Debugf("Using first address for %s : %v", host, addrs)
 		case "rnd":
 			//nolint:gosec // we want fast not crypto
@@ -423,16 +611,110 @@ func ResolveAll(ctx context.Context, host, resolveType string) ([]net.IP, error)
 		log.LogVf("Resolved %s already an IP as addr", host)
 		return []net.IP{isAddr}, nil
 	}
-	if resolveType == "" {
+	if resolveType == "" || resolveType == "dual" {
 		resolveType = "ip"
 	}
-	addrs, err := net.DefaultResolver.LookupIP(ctx, resolveType, host)
+	var addrs []net.IP
+	var err error
+	if FlagResolveMethod.Get() == "doh" {
+		addrs, err = dohResolve(ctx, host, resolveType)
+	} else {
+		addrs, err = net.DefaultResolver.LookupIP(ctx, resolveType, host)
+	}
 	if err != nil {
 		log.Errf("Unable to lookup %q: %v", host, err)
 	}
 	return addrs, err
 }
 
+// HappyEyeballsDelay is how long DialHappyEyeballs waits on the first (IPv6) connection attempt
+// before also starting the IPv4 one. 250ms is the recommended value in RFC 8305.
+var HappyEyeballsDelay = 250 * time.Millisecond
+
+type dialResult struct {
+	conn net.Conn
+	err  error
+}
+
+// DialHappyEyeballs resolves host and races a TCP connection to the first IPv6 address against
+// one to the first IPv4 address (started HappyEyeballsDelay later or as soon as the IPv6 attempt fails),
+// similar to RFC 8305. Returns the first successful connection, the RemoteAddr() tells which family won.
+func DialHappyEyeballs(ctx context.Context, host, port string) (net.Conn, error) {
+	portNum, err := net.LookupPort("tcp", port)
+	if err != nil {
+		log.Errf("Unable to resolve tcp port '%s' : %v", port, err)
+		return nil, err
+	}
+	addrs, err := ResolveAll(ctx, host, "ip")
+	if err != nil {
+		return nil, err // already logged
+	}
+	var ip6, ip4 net.IP
+	for _, a := range addrs {
+		if a.To4() != nil {
+			if ip4 == nil {
+				ip4 = a
+			}
+		} else if ip6 == nil {
+			ip6 = a
+		}
+	}
+	candidates := make([]net.IP, 0, 2)
+	if ip6 != nil {
+		candidates = append(candidates, ip6)
+	}
+	if ip4 != nil {
+		candidates = append(candidates, ip4)
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no address found for %q", host)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan dialResult, len(candidates))
+	firstFailed := make(chan struct{})
+	for i, ip := range candidates {
+		go func() {
+			if i > 0 {
+				select {
+				case <-time.After(HappyEyeballsDelay):
+				case <-firstFailed:
+				case <-ctx.Done():
+					results <- dialResult{nil, ctx.Err()}
+					return
+				}
+			}
+			var d net.Dialer
+			conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(ip.String(), strconv.Itoa(portNum)))
+			if err != nil && i == 0 {
+				close(firstFailed)
+			}
+			results <- dialResult{conn, err}
+		}()
+	}
+	var errs []error
+	for range candidates {
+		res := <-results
+		if res.err == nil {
+			log.LogVf("Happy eyeballs connected to %v for %s:%s", res.conn.RemoteAddr(), host, port)
+			cancel()
+			// close the losing connection if it also succeeded
+			go func(n int) {
+				for range n {
+					if r := <-results; r.conn != nil {
+						r.conn.Close()
+					}
+				}
+			}(len(candidates) - 1 - len(errs))
+			return res.conn, nil
+		}
+		errs = append(errs, res.err)
+	}
+	err = errors.Join(errs...)
+	log.Errf("Unable to connect to any of %v for %s:%s: %v", candidates, host, port, err)
+	return nil, err
+}
+
 // UDPResolveDestination returns the UDP address of the "host:port" suitable for net.Dial.
 // nil and the error in case of errors.
 func UDPResolveDestination(ctx context.Context, dest string) (*net.UDPAddr, error) {
@@ -480,28 +762,57 @@ func Copy(dst io.Writer, src io.Reader) (written int64, err error) {
 	return written, err
 }
 
+// SocketOptions are the TCP socket settings applied by SetSocketOptions.
+type SocketOptions struct {
+	ReadBufferSize  int
+	WriteBufferSize int
+	// Nagle keeps Nagle's algorithm (coalescing of small writes, which can delay small requests)
+	// enabled instead of setting TCP_NODELAY.
+	Nagle bool
+}
+
+// TCPInfo is the subset of a connection's kernel TCP_INFO returned by GetTCPInfo (Linux only).
+type TCPInfo struct {
+	RTT         time.Duration // smoothed round trip time
+	RTTVar      time.Duration // round trip time variation
+	Retransmits uint32        // total number of retransmitted segments since the connection was established
+	Cwnd        uint32        // congestion window, in segments
+}
+
 // SetSocketBuffers sets the read and write buffer size of the socket. Also sets TCP SetNoDelay().
 func SetSocketBuffers(socket net.Conn, readBufferSize, writeBufferSize int) {
+	SetSocketOptions(socket, SocketOptions{ReadBufferSize: readBufferSize, WriteBufferSize: writeBufferSize})
+}
+
+// SetSocketOptions sets the buffer sizes and TCP_NODELAY (unless opts.Nagle) of a TCP socket.
+func SetSocketOptions(socket net.Conn, opts SocketOptions) {
 	tcpSock, ok := socket.(*net.TCPConn)
 	if !ok {
 		log.LogVf("Not setting socket options on non tcp socket %v", socket.RemoteAddr())
 		return
 	}
 	// For now those errors are not critical/breaking
-	if err := tcpSock.SetNoDelay(true); err != nil {
+	if err := tcpSock.SetNoDelay(!opts.Nagle); err != nil {
 		log.Warnf("Unable to connect to set tcp no delay %+v: %v", socket, err)
 	}
-	if err := tcpSock.SetWriteBuffer(writeBufferSize); err != nil {
-		log.Warnf("Unable to connect to set write buffer %d %+v: %v", writeBufferSize, socket, err)
+	if err := tcpSock.SetWriteBuffer(opts.WriteBufferSize); err != nil {
+		log.Warnf("Unable to connect to set write buffer %d %+v: %v", opts.WriteBufferSize, socket, err)
 	}
-	if err := tcpSock.SetReadBuffer(readBufferSize); err != nil {
-		log.Warnf("Unable to connect to read buffer %d %+v: %v", readBufferSize, socket, err)
+	if err := tcpSock.SetReadBuffer(opts.ReadBufferSize); err != nil {
+		log.Warnf("Unable to connect to read buffer %d %+v: %v", opts.ReadBufferSize, socket, err)
 	}
 }
 
 func transfer(wg *sync.WaitGroup, dst net.Conn, src net.Conn) {
 	n, oErr := io.Copy(dst, src) // keep original error for logs below
 	log.LogVf("Proxy: transferred %d bytes from %v to %v (err=%v)", n, src.RemoteAddr(), dst.RemoteAddr(), oErr)
+	halfClose(dst, src, oErr)
+	wg.Done()
+}
+
+// halfClose closes the read side of src and the write side of dst once a transfer is done,
+// oErr is the transfer's error, for logs.
+func halfClose(dst net.Conn, src net.Conn, oErr error) {
 	sTCP, ok := src.(*net.TCPConn)
 	if ok {
 		err := sTCP.CloseRead()
@@ -516,7 +827,6 @@ func transfer(wg *sync.WaitGroup, dst net.Conn, src net.Conn) {
 			log.Errf("Proxy: error CloseWrite on dst %v: %v,%v", dst.RemoteAddr(), err, oErr)
 		}
 	}
-	wg.Done()
 }
 
 // ErrNilDestination returned when trying to proxy to a nil address.
@@ -678,11 +988,14 @@ func SmallReadUntil(r io.Reader, stopByte byte, maxV int) ([]byte, bool, error)
 }
 
 // NetCat connects to the destination and reads from in, sends to the socket, and write what it reads from the socket to out.
-// if the destination starts with udp:// UDP is used otherwise TCP.
+// if the destination starts with udp:// UDP is used, sctp:// SCTP (Linux only) otherwise TCP.
 func NetCat(ctx context.Context, dest string, in io.Reader, out io.Writer, stopOnEOF bool) error {
 	if strings.HasPrefix(dest, UDPPrefix) {
 		return UDPNetCat(ctx, dest, in, out, stopOnEOF)
 	}
+	if strings.HasPrefix(dest, SCTPPrefix) {
+		return SCTPNetCat(ctx, dest, in, out, stopOnEOF)
+	}
 	log.Infof("TCP NetCat to %s, stop on eof %v", dest, stopOnEOF)
 	a, err := TCPResolveDestination(ctx, dest)
 	if a == nil {
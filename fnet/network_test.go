@@ -18,10 +18,15 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -30,6 +35,7 @@ import (
 	"fortio.org/fortio/fnet"
 	"fortio.org/fortio/version"
 	"fortio.org/log"
+	"golang.org/x/net/dns/dnsmessage"
 )
 
 func TestNormalizePort(t *testing.T) {
@@ -234,6 +240,64 @@ func TestTcpEcho(t *testing.T) {
 	}
 }
 
+func TestTCPEchoServerWithMetrics(t *testing.T) {
+	srv, err := fnet.TCPEchoServerWithMetrics("test-tcp-echo-metrics", ":0")
+	if err != nil {
+		t.Fatalf("Unable to start echo server: %v", err)
+	}
+	dAddr := net.TCPAddr{Port: srv.Addr.(*net.TCPAddr).Port}
+	data := "hello echo with metrics"
+	for range 3 {
+		d, err := net.DialTCP("tcp", nil, &dAddr)
+		if err != nil {
+			t.Fatalf("can't connect to our echo server: %v", err)
+		}
+		_, _ = d.Write([]byte(data))
+		_ = d.CloseWrite()
+		res, err := io.ReadAll(d)
+		if err != nil || string(res) != data {
+			t.Errorf("Unexpected echo %q, %v", res, err)
+		}
+		d.Close()
+	}
+	// One in-flight connection that never closes: forced by Shutdown's timeout.
+	inFlight, err := net.DialTCP("tcp", nil, &dAddr)
+	if err != nil {
+		t.Fatalf("can't connect to our echo server: %v", err)
+	}
+	defer inFlight.Close()
+	_, _ = inFlight.Write([]byte("x"))
+	buf := make([]byte, 1)
+	_, _ = io.ReadFull(inFlight, buf)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = srv.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded on shutdown with an in-flight connection, got %v", err)
+	}
+	st := srv.Stats()
+	if st.Connections != 4 || st.BytesEchoed != int64(3*len(data)+1) || st.Errors != 0 {
+		t.Errorf("Unexpected stats %+v", st)
+	}
+	if st.LatencyHistogram.Count != 4 {
+		t.Errorf("Unexpected latency histogram count %d", st.LatencyHistogram.Count)
+	}
+	if _, err = net.DialTCP("tcp", nil, &dAddr); err == nil {
+		t.Errorf("Expected connection error after shutdown")
+	}
+	// Clean shutdown when nothing is in flight
+	srv2, err := fnet.TCPEchoServerWithMetrics("test-tcp-echo-metrics2", ":0")
+	if err != nil {
+		t.Fatalf("Unable to start echo server: %v", err)
+	}
+	if err = srv2.Shutdown(context.Background()); err != nil {
+		t.Errorf("Unexpected shutdown error %v", err)
+	}
+	if _, err = fnet.TCPEchoServerWithMetrics("test-tcp-echo-metrics3", fnet.GetPort(srv.Addr)+"x"); err == nil {
+		t.Errorf("Expected error on invalid port")
+	}
+}
+
 func TestUdpEcho(t *testing.T) {
 	ctx := context.Background()
 	for i := 0; i <= 1; i++ {
@@ -267,6 +331,55 @@ func (cbb *ErroringWriter) Write(buf []byte) (int, error) {
 }
 
 // Also tests NetCat and copy.
+func TestSTUN(t *testing.T) {
+	// RFC 5769 2.2 sample IPv4 response XOR-MAPPED-ADDRESS.
+	id := fnet.STUNTransactionID{0xb7, 0xe7, 0xa7, 0x01, 0xbc, 0x34, 0xd6, 0x86, 0xfa, 0x87, 0xdf, 0xae}
+	v4 := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 32853}
+	resp := fnet.STUNBindingResponse(id, v4)
+	expected := []byte{0x00, 0x20, 0x00, 0x08, 0x00, 0x01, 0xa1, 0x47, 0xe1, 0x12, 0xa6, 0x43}
+	if !bytes.Equal(resp[fnet.STUNHeaderSize:], expected) {
+		t.Errorf("Unexpected XOR-MAPPED-ADDRESS % x vs % x", resp[fnet.STUNHeaderSize:], expected)
+	}
+	for _, addr := range []*net.UDPAddr{v4, {IP: net.ParseIP("2001:db8:1234:5678:11:2233:4455:6677"), Port: 32853}} {
+		got, err := fnet.ParseSTUNBindingResponse(fnet.STUNBindingResponse(id, addr), id)
+		if err != nil || !got.IP.Equal(addr.IP) || got.Port != addr.Port {
+			t.Errorf("Round trip of %v failed: %v %v", addr, got, err)
+		}
+	}
+	otherID := id
+	otherID[0]++
+	if _, err := fnet.ParseSTUNBindingResponse(resp, otherID); err == nil {
+		t.Errorf("Expected error for transaction id mismatch")
+	}
+	if _, _, err := fnet.ParseSTUNHeader([]byte("not a stun message at all")); err == nil {
+		t.Errorf("Expected error for non STUN message")
+	}
+	// Against the server:
+	addr := fnet.STUNEchoServer("0")
+	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: addr.(*net.UDPAddr).Port})
+	if err != nil {
+		t.Fatalf("Unable to dial stun server: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err = conn.Write(fnet.STUNBindingRequest(id)); err != nil {
+		t.Fatalf("Unable to write: %v", err)
+	}
+	buf := make([]byte, 512)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Unable to read stun response: %v", err)
+	}
+	reflexive, err := fnet.ParseSTUNBindingResponse(buf[:n], id)
+	if err != nil {
+		t.Fatalf("Invalid response from stun server: %v", err)
+	}
+	local := conn.LocalAddr().(*net.UDPAddr)
+	if !reflexive.IP.Equal(local.IP) || reflexive.Port != local.Port {
+		t.Errorf("Reflexive address %v doesn't match local %v", reflexive, local)
+	}
+}
+
 func TestTCPEchoServerErrors(t *testing.T) {
 	addr := fnet.TCPEchoServer("test-tcp-echo", ":0")
 	dAddr := net.TCPAddr{Port: addr.(*net.TCPAddr).Port}
@@ -297,6 +410,22 @@ func TestNetCatErrors(t *testing.T) {
 	}
 }
 
+func TestSCTPNetCat(t *testing.T) {
+	addr := fnet.SCTPEchoServer("test-sctp-echo", ":0")
+	if addr == nil {
+		t.Skip("SCTP not supported on this platform/kernel")
+	}
+	var out bytes.Buffer
+	dest := fnet.SCTPPrefix + "localhost:" + fnet.GetPort(addr)
+	err := fnet.NetCat(context.Background(), dest, strings.NewReader("hello sctp"), &out, true)
+	if err != nil {
+		t.Errorf("Unexpected sctp netcat error: %v", err)
+	}
+	if out.String() != "hello sctp" {
+		t.Errorf("Expected echo of our message, got %q", out.String())
+	}
+}
+
 func TestSetSocketBuffersError(t *testing.T) {
 	c := &net.UnixConn{}
 	fnet.SetSocketBuffers(c, 512, 256) // triggers 22:11:14 V network.go:245> Not setting socket options on non-TCP socket <nil>
@@ -409,6 +538,57 @@ func TestUnixDomain(t *testing.T) {
 	}
 }
 
+func udpRoundTrip(t *testing.T, addr net.Addr, msg string) (string, error) {
+	t.Helper()
+	c, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: addr.(*net.UDPAddr).Port})
+	if err != nil {
+		t.Fatalf("Unable to dial udp proxy %v: %v", addr, err)
+	}
+	defer c.Close()
+	if _, err = c.Write([]byte(msg)); err != nil {
+		return "", err
+	}
+	_ = c.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	buf := make([]byte, 1024)
+	n, err := c.Read(buf)
+	return string(buf[:n]), err
+}
+
+func TestUDPProxy(t *testing.T) {
+	echoAddr := fnet.UDPEchoServer("udp-echo-proxy-test", ":0", false)
+	dest := fmt.Sprintf("udp://localhost:%d/", echoAddr.(*net.UDPAddr).Port)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr, err := fnet.UDPProxyToDestination(ctx, "localhost:0", dest)
+	if err != nil {
+		t.Fatalf("Unexpected error starting udp proxy: %v", err)
+	}
+	for _, msg := range []string{"hello", "world"} {
+		reply, err := udpRoundTrip(t, addr, msg)
+		if err != nil || reply != msg {
+			t.Errorf("Expected %q echoed through the proxy, got %q, %v", msg, reply, err)
+		}
+	}
+	// Max clients: 2nd concurrent client gets dropped.
+	prev := fnet.UDPProxyMaxClients
+	fnet.UDPProxyMaxClients = 1
+	addr2, err := fnet.UDPProxyToDestination(ctx, "localhost:0", dest)
+	fnet.UDPProxyMaxClients = prev
+	if err != nil {
+		t.Fatalf("Unexpected error starting 2nd udp proxy: %v", err)
+	}
+	c1, _ := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: addr2.(*net.UDPAddr).Port})
+	defer c1.Close()
+	_, _ = c1.Write([]byte("first"))
+	time.Sleep(50 * time.Millisecond)
+	if reply, err := udpRoundTrip(t, addr2, "second"); err == nil {
+		t.Errorf("Expected 2nd client to be dropped, got %q", reply)
+	}
+	if _, err = fnet.UDPProxyToDestination(ctx, "localhost:0", "not-a-host-port"); err == nil {
+		t.Errorf("Expected error for bad destination")
+	}
+}
+
 func TestProxyErrors(t *testing.T) {
 	ctx := context.Background()
 	addr := fnet.ProxyToDestination(ctx, ":0", "doesnotexist.fortio.org:80")
@@ -793,6 +973,254 @@ func TestResolveNoFilter(t *testing.T) {
 	}
 }
 
+func TestDialHappyEyeballs(t *testing.T) {
+	addr := fnet.TCPEchoServer("test-happy-eyeballs", ":0")
+	port := strconv.Itoa(addr.(*net.TCPAddr).Port)
+	for _, host := range []string{"127.0.0.1", "localhost"} {
+		conn, err := fnet.DialHappyEyeballs(context.Background(), host, port)
+		if err != nil {
+			t.Fatalf("Unexpected error connecting to %s:%s: %v", host, port, err)
+		}
+		t.Logf("Connected to %s for %s", conn.RemoteAddr(), host)
+		data := "happy eyeballs"
+		_, _ = conn.Write([]byte(data))
+		res := make([]byte, 64)
+		n, err := conn.Read(res)
+		if err != nil {
+			t.Errorf("read error: %v", err)
+		}
+		if string(res[:n]) != data {
+			t.Errorf("Unexpected echo %q, expected %q", res[:n], data)
+		}
+		conn.Close()
+	}
+	// Nothing listening on port 1 (hopefully) for either family.
+	_, err := fnet.DialHappyEyeballs(context.Background(), "localhost", "1")
+	if err == nil {
+		t.Errorf("Expected error connecting to port 1")
+	}
+	_, err = fnet.DialHappyEyeballs(context.Background(), "", port)
+	if err == nil {
+		t.Errorf("Expected error for empty host")
+	}
+}
+
+func TestTimestampedProxy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv, err := fnet.TCPEchoServerWithMetrics("test-tcp-echo-ts", "localhost:0")
+	if err != nil {
+		t.Fatalf("Unable to start echo server: %v", err)
+	}
+	defer srv.Shutdown(ctx)
+	egress, err := fnet.TimestampedProxy(ctx, "localhost:0", srv.Addr.String(), fnet.TimestampFromClients)
+	if err != nil {
+		t.Fatalf("Unable to start egress proxy: %v", err)
+	}
+	ingress, err := fnet.TimestampedProxy(ctx, "localhost:0", egress.Addr.String(), fnet.TimestampToDestination)
+	if err != nil {
+		t.Fatalf("Unable to start ingress proxy: %v", err)
+	}
+	if _, err = fnet.TimestampedProxy(ctx, "localhost:0", srv.Addr.String(), fnet.TimestampMode(0)); err == nil {
+		t.Errorf("Expected error for invalid mode")
+	}
+	d, err := net.Dial("tcp", ingress.Addr.String())
+	if err != nil {
+		t.Fatalf("can't connect to our proxy: %v", err)
+	}
+	defer d.Close()
+	data := "F\000oBar\000\001 through 2 timestamped proxies"
+	for range 3 {
+		_, _ = d.Write([]byte(data))
+		res := make([]byte, len(data))
+		if _, err = io.ReadFull(d, res); err != nil || string(res) != data {
+			t.Errorf("Unexpected echo %q, %v", res, err)
+		}
+	}
+	_ = d.(*net.TCPConn).CloseWrite()
+	if res, err := io.ReadAll(d); err != nil || len(res) != 0 {
+		t.Errorf("Unexpected extra data %q, %v", res, err)
+	}
+	// Each chunk is echoed as is (and is small enough to not be split): 3 in each direction.
+	if h := egress.LatencyHistogram(); h.Count != 3 || h.Min < 0 || h.Max > 1 {
+		t.Errorf("Unexpected egress latency histogram %+v", h)
+	}
+	if h := ingress.LatencyHistogram(); h.Count != 3 || h.Min < 0 || h.Max > 1 {
+		t.Errorf("Unexpected ingress latency histogram %+v", h)
+	}
+}
+
+func TestHTTPConnectProxyServer(t *testing.T) {
+	dest := fnet.TCPEchoServer("test-tcp-echo-connect", "localhost:0")
+	addr := fnet.HTTPConnectProxyServer("localhost:0", 0)
+	if addr == nil {
+		t.Fatalf("Unable to start connect proxy")
+	}
+	d, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatalf("can't connect to our proxy: %v", err)
+	}
+	defer d.Close()
+	data := "F\000oBar\000\001 through a CONNECT tunnel"
+	// Data sent right after the request (before the reply) must go through too.
+	_, _ = fmt.Fprintf(d, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n%s", dest, dest, data)
+	br := bufio.NewReader(d)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Unexpected CONNECT response %+v, %v", resp, err)
+	}
+	res := make([]byte, len(data))
+	if _, err = io.ReadFull(br, res); err != nil || string(res) != data {
+		t.Errorf("Unexpected echo %q, %v", res, err)
+	}
+	_ = d.(*net.TCPConn).CloseWrite()
+	if res, err := io.ReadAll(br); err != nil || len(res) != 0 {
+		t.Errorf("Unexpected extra data %q, %v", res, err)
+	}
+	tests := []struct {
+		request string
+		code    int
+	}{
+		{"GET http://" + dest.String() + "/ HTTP/1.1\r\nHost: " + dest.String() + "\r\n\r\n", http.StatusMethodNotAllowed},
+		{"CONNECT localhost:1 HTTP/1.1\r\nHost: localhost:1\r\n\r\n", http.StatusBadGateway},
+		{"not http\r\n\r\n", http.StatusBadRequest},
+	}
+	for _, tst := range tests {
+		c, err := net.Dial("tcp", addr.String())
+		if err != nil {
+			t.Fatalf("can't connect to our proxy: %v", err)
+		}
+		_, _ = c.Write([]byte(tst.request))
+		resp, err := http.ReadResponse(bufio.NewReader(c), nil)
+		if err != nil || resp.StatusCode != tst.code {
+			t.Errorf("%q: unexpected response %+v, %v instead of %d", tst.request, resp, err, tst.code)
+		}
+		c.Close()
+	}
+	// Incomplete request: replied to (and closed) after the proxy's timeout.
+	addr = fnet.HTTPConnectProxyServer("localhost:0", 100*time.Millisecond)
+	c, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatalf("can't connect to our proxy: %v", err)
+	}
+	defer c.Close()
+	_, _ = c.Write([]byte("CONNECT localhost:1 HTTP/1.1\r\n"))
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	resp, err = http.ReadResponse(bufio.NewReader(c), nil)
+	if err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Unexpected response to incomplete request %+v, %v", resp, err)
+	}
+}
+
+func TestNetCatBandwidth(t *testing.T) {
+	addr := fnet.TCPEchoServer("test-bw-echo", ":0")
+	dest := "localhost:" + fnet.GetPort(addr)
+	res, err := fnet.NetCatBandwidth(context.Background(), dest, 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Unexpected bandwidth test error: %v", err)
+	}
+	if res.TxBytes == 0 || res.RxBytes == 0 || res.RxBytes > res.TxBytes {
+		t.Errorf("Unexpected bandwidth result %+v", res)
+	}
+	if res.Duration < 200*time.Millisecond || res.TxMBps() <= 0 || res.RxMBps() <= 0 {
+		t.Errorf("Unexpected bandwidth result duration/rates %+v", res)
+	}
+	var out strings.Builder
+	res.Print(&out)
+	if !strings.HasPrefix(out.String(), "Bandwidth test for ") || !strings.Contains(out.String(), " MB/s") {
+		t.Errorf("Unexpected bandwidth output %q", out.String())
+	}
+	_, err = fnet.NetCatBandwidth(context.Background(), "localhost:1", time.Second)
+	if err == nil {
+		t.Errorf("Expected error connecting to closed port")
+	}
+}
+
+// dohTestServer answers the DoH queries for doh.fortio.test with 2 A and 1 AAAA records.
+func dohTestServer(t *testing.T) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/dns-query" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Accept") != fnet.DNSMessageContentType {
+			http.Error(w, "bad accept header", http.StatusBadRequest)
+			return
+		}
+		data, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		var req dnsmessage.Message
+		if err != nil || req.Unpack(data) != nil || len(req.Questions) != 1 {
+			http.Error(w, "bad dns query", http.StatusBadRequest)
+			return
+		}
+		q := req.Questions[0]
+		resp := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: req.ID, Response: true, RCode: dnsmessage.RCodeNameError},
+			Questions: req.Questions,
+		}
+		if q.Name.String() == "doh.fortio.test." {
+			resp.RCode = dnsmessage.RCodeSuccess
+			hdr := dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: q.Class, TTL: 60}
+			switch q.Type { //nolint:exhaustive // only A and AAAA are answered.
+			case dnsmessage.TypeA:
+				resp.Answers = []dnsmessage.Resource{
+					{Header: hdr, Body: &dnsmessage.AResource{A: [4]byte{127, 0, 0, 2}}},
+					{Header: hdr, Body: &dnsmessage.AResource{A: [4]byte{127, 0, 0, 3}}},
+				}
+			case dnsmessage.TypeAAAA:
+				resp.Answers = []dnsmessage.Resource{
+					{Header: hdr, Body: &dnsmessage.AAAAResource{AAAA: [16]byte{15: 1}}},
+				}
+			}
+		}
+		out, _ := resp.Pack()
+		w.Header().Set("Content-Type", fnet.DNSMessageContentType)
+		_, _ = w.Write(out)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL + "/dns-query"
+}
+
+func TestDOHResolver(t *testing.T) {
+	url := dohTestServer(t)
+	ctx := context.Background()
+	resolve := fnet.DOHResolver(url)
+	ips, err := resolve(ctx, "doh.fortio.test", "ip4")
+	if err != nil {
+		t.Fatalf("Unexpected DoH error: %v", err)
+	}
+	if len(ips) != 2 || ips[0].String() != "127.0.0.2" || ips[1].String() != "127.0.0.3" {
+		t.Errorf("Unexpected DoH ip4 result %v", ips)
+	}
+	ips, err = resolve(ctx, "doh.fortio.test", "ip")
+	if err != nil || len(ips) != 3 || ips[2].String() != "::1" {
+		t.Errorf("Unexpected DoH ip result %v, %v", ips, err)
+	}
+	if _, err = resolve(ctx, "nxdomain.fortio.test", "ip4"); err == nil {
+		t.Errorf("Expected error for NXDOMAIN DoH answer")
+	}
+	if _, err = fnet.DOHResolver(url+"/bad?x=1")(ctx, "doh.fortio.test", "ip4"); err == nil {
+		t.Errorf("Expected error for non DoH url")
+	}
+	// Through the dns method flag:
+	if err = fnet.FlagResolveMethod.Set("doh"); err != nil {
+		t.Fatalf("Unable to set doh dns method: %v", err)
+	}
+	defer fnet.FlagResolveMethod.Set("cached-rr")
+	if _, err = fnet.TCPResolveDestination(ctx, "doh.fortio.test:80"); err == nil {
+		t.Errorf("Expected error for doh dns method without url")
+	}
+	_ = fnet.FlagDOHURL.Set(url)
+	defer fnet.FlagDOHURL.Set("")
+	addr, err := fnet.TCPResolveDestination(ctx, "doh.fortio.test:80")
+	if err != nil {
+		t.Fatalf("Unexpected doh dns method error: %v", err)
+	}
+	if addr.String() != "127.0.0.2:80" {
+		t.Errorf("Expected first DoH answer, got %v", addr)
+	}
+}
+
 // --- max logging for tests
 
 func init() {
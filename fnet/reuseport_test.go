@@ -0,0 +1,102 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || darwin
+
+package fnet_test
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"runtime"
+	"testing"
+
+	"fortio.org/fortio/fnet"
+)
+
+func TestListenReusePort(t *testing.T) {
+	opts := fnet.ListenOptions{ReusePort: true}
+	l1, addr := fnet.ListenWithOptions("reuse-1", "localhost:0", opts)
+	if l1 == nil {
+		t.Fatalf("Unable to listen with SO_REUSEPORT")
+	}
+	defer l1.Close()
+	port := addr.String()
+	l2, _ := fnet.ListenWithOptions("reuse-2", port, opts)
+	if l2 == nil {
+		t.Fatalf("Unable to listen a second time on %s with SO_REUSEPORT", port)
+	}
+	defer l2.Close()
+	// Without the option on the new socket, the port is busy:
+	if l3, _ := fnet.Listen("no-reuse", port); l3 != nil {
+		l3.Close()
+		t.Errorf("Expected second listen on %s without SO_REUSEPORT to fail", port)
+	}
+	// Both echo servers on the same port answer:
+	eAddr := fnet.TCPEchoServerWithOptions("reuse-echo-1", "localhost:0", opts)
+	fnet.TCPEchoServerWithOptions("reuse-echo-2", eAddr.String(), opts)
+	for i := range 10 {
+		if err := echoOnce(eAddr.String()); err != nil {
+			t.Errorf("Echo %d failed: %v", i, err)
+		}
+	}
+}
+
+// echoOnce connects to the echo server at addr and checks a small message is echoed back.
+func echoOnce(addr string) error {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	msg := []byte("ping")
+	if _, err = conn.Write(msg); err != nil {
+		return err
+	}
+	buf := make([]byte, len(msg))
+	if _, err = io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	if string(buf) != string(msg) {
+		return fmt.Errorf("unexpected echo %q", buf)
+	}
+	return nil
+}
+
+// benchmarkEchoServers measures new connections + echo throughput against
+// numListeners echo servers (accept loops) sharing the same port.
+func benchmarkEchoServers(b *testing.B, numListeners int) {
+	opts := fnet.ListenOptions{ReusePort: numListeners > 1}
+	addr := fnet.TCPEchoServerWithOptions("", "localhost:0", opts).String()
+	for range numListeners - 1 {
+		fnet.TCPEchoServerWithOptions("", addr, opts)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := echoOnce(addr); err != nil {
+				b.Errorf("Echo failed: %v", err)
+			}
+		}
+	})
+}
+
+func BenchmarkEchoSingleListener(b *testing.B) {
+	benchmarkEchoServers(b, 1)
+}
+
+func BenchmarkEchoReusePortListeners(b *testing.B) {
+	benchmarkEchoServers(b, runtime.GOMAXPROCS(0))
+}
@@ -0,0 +1,88 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fnet // import "fortio.org/fortio/fnet"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"fortio.org/log"
+)
+
+// SCTPPrefix is the prefix that given to NetCat switches to SCTP.
+const SCTPPrefix = "sctp://"
+
+// ErrUnsupported is returned by the SCTP functions on platforms (or kernels) without SCTP support.
+var ErrUnsupported = fmt.Errorf("sctp: %w", errors.ErrUnsupported)
+
+// SCTPAddr is the address of SCTP endpoints.
+type SCTPAddr struct {
+	HostPortAddr
+}
+
+// Network returns "sctp".
+func (a *SCTPAddr) Network() string {
+	return "sctp"
+}
+
+// SCTPResolveDestination returns the SCTP address of the "host:port" or "sctp://host:port/" destination.
+// nil in case of errors.
+func SCTPResolveDestination(ctx context.Context, dest string) (*SCTPAddr, error) {
+	dest = strings.TrimSuffix(strings.TrimPrefix(dest, SCTPPrefix), "/")
+	i := strings.LastIndex(dest, ":") // important so [::1]:port works
+	if i < 0 {
+		log.Errf("Destination '%s' is not host:port format", dest)
+		return nil, fmt.Errorf("destination '%s' is not host:port format", dest)
+	}
+	// sctp uses the same port numbers as tcp.
+	addr, err := ResolveByProto(ctx, dest[0:i], dest[i+1:], "tcp")
+	if err != nil {
+		return nil, err
+	}
+	return &SCTPAddr{*addr}, nil
+}
+
+// SCTPNetCat handles SCTP part of NetCat. Each read from in is sent as one SCTP message.
+func SCTPNetCat(ctx context.Context, dest string, in io.Reader, out io.Writer, stopOnEOF bool) error {
+	log.Infof("SCTP NetCat to %s, stop on eof %v", dest, stopOnEOF)
+	a, err := SCTPResolveDestination(ctx, dest)
+	if a == nil {
+		return err // already logged
+	}
+	d, err := DialSCTP(a)
+	if err != nil {
+		log.Errf("Connection error to %q: %v", dest, err)
+		return err
+	}
+	defer d.Close()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	var rb int64
+	var re error
+	go func() {
+		rb, re = Copy(out, d)
+		wg.Done()
+	}()
+	wb, we := Copy(d, in)
+	_ = d.SetReadDeadline(time.Now().Add(400 * time.Millisecond))
+	wg.Wait()
+	log.Infof("Read %d, Wrote %d bytes to SCTP %v (re %v we %v)", rb, wb, a, re, we)
+	return we
+}
@@ -0,0 +1,219 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package fnet // import "fortio.org/fortio/fnet"
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"fortio.org/fortio/version"
+	"fortio.org/log"
+)
+
+// sctpConn is a net.Conn over a one-to-many (SOCK_SEQPACKET) SCTP socket, sending to a single peer.
+// The socket is non-blocking and integrated with the runtime poller through os.File so deadlines work.
+type sctpConn struct {
+	f      *os.File
+	rc     syscall.RawConn
+	peer   syscall.Sockaddr
+	remote *SCTPAddr
+}
+
+func sctpSockaddr(ip net.IP, port int) (int, syscall.Sockaddr) {
+	if ip4 := ip.To4(); ip4 != nil {
+		sa := &syscall.SockaddrInet4{Port: port}
+		copy(sa.Addr[:], ip4)
+		return syscall.AF_INET, sa
+	}
+	sa := &syscall.SockaddrInet6{Port: port}
+	copy(sa.Addr[:], ip.To16()) // nil ip is the any address
+	return syscall.AF_INET6, sa
+}
+
+func sctpAddrFromSockaddr(sa syscall.Sockaddr) *SCTPAddr {
+	switch sa := sa.(type) {
+	case *syscall.SockaddrInet4:
+		return &SCTPAddr{HostPortAddr{IP: net.IP(sa.Addr[:]).To16(), Port: sa.Port}}
+	case *syscall.SockaddrInet6:
+		return &SCTPAddr{HostPortAddr{IP: net.IP(sa.Addr[:]), Port: sa.Port}}
+	}
+	return nil
+}
+
+func newSCTPSocket(family int) (*os.File, syscall.RawConn, error) {
+	fd, err := syscall.Socket(family, syscall.SOCK_SEQPACKET|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, syscall.IPPROTO_SCTP)
+	if err != nil {
+		if errors.Is(err, syscall.EPROTONOSUPPORT) || errors.Is(err, syscall.ESOCKTNOSUPPORT) {
+			err = ErrUnsupported
+		}
+		log.Errf("Unable to create sctp socket: %v", err)
+		return nil, nil, err
+	}
+	f := os.NewFile(uintptr(fd), "sctp")
+	rc, err := f.SyscallConn()
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, err
+	}
+	return f, rc, nil
+}
+
+// recvFrom reads one message (or the first len(b) bytes of it), waiting for it using the poller.
+func recvFrom(rc syscall.RawConn, b []byte) (n int, from syscall.Sockaddr, err error) {
+	rerr := rc.Read(func(fd uintptr) bool {
+		n, from, err = syscall.Recvfrom(int(fd), b, 0)
+		return !errors.Is(err, syscall.EAGAIN)
+	})
+	if rerr != nil {
+		return 0, nil, rerr
+	}
+	return n, from, err
+}
+
+func sendTo(rc syscall.RawConn, b []byte, to syscall.Sockaddr) (err error) {
+	werr := rc.Write(func(fd uintptr) bool {
+		err = syscall.Sendto(int(fd), b, 0, to)
+		return !errors.Is(err, syscall.EAGAIN)
+	})
+	if werr != nil {
+		return werr
+	}
+	return err
+}
+
+// DialSCTP returns a connection to the SCTP destination, each Write is sent as one message
+// and each Read returns (up to len(b) of) one message. The association is established on the first Write.
+func DialSCTP(dest *SCTPAddr) (net.Conn, error) {
+	family, sa := sctpSockaddr(dest.IP, dest.Port)
+	f, rc, err := newSCTPSocket(family)
+	if err != nil {
+		return nil, err
+	}
+	return &sctpConn{f: f, rc: rc, peer: sa, remote: dest}, nil
+}
+
+func (c *sctpConn) Read(b []byte) (int, error) {
+	n, _, err := recvFrom(c.rc, b)
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 && len(b) > 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+func (c *sctpConn) Write(b []byte) (int, error) {
+	if err := sendTo(c.rc, b, c.peer); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *sctpConn) Close() error {
+	return c.f.Close()
+}
+
+func (c *sctpConn) LocalAddr() net.Addr {
+	var sa syscall.Sockaddr
+	_ = c.rc.Control(func(fd uintptr) {
+		sa, _ = syscall.Getsockname(int(fd))
+	})
+	return sctpAddrFromSockaddr(sa)
+}
+
+func (c *sctpConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func (c *sctpConn) SetDeadline(t time.Time) error {
+	return c.f.SetDeadline(t)
+}
+
+func (c *sctpConn) SetReadDeadline(t time.Time) error {
+	return c.f.SetReadDeadline(t)
+}
+
+func (c *sctpConn) SetWriteDeadline(t time.Time) error {
+	return c.f.SetWriteDeadline(t)
+}
+
+// SCTPEchoServer starts a SCTP Echo Server on given port, name is for logging.
+// Each message received is sent back, as is, to the association it came from.
+func SCTPEchoServer(name string, port string) net.Addr {
+	tAddr, err := net.ResolveTCPAddr("tcp", NormalizePort(port))
+	if err != nil {
+		log.Errf("Unable to resolve sctp listen address %q: %v", port, err)
+		return nil
+	}
+	family, sa := sctpSockaddr(tAddr.IP, tAddr.Port)
+	f, rc, err := newSCTPSocket(family)
+	if err != nil {
+		return nil // already logged
+	}
+	var lsa syscall.Sockaddr
+	cerr := rc.Control(func(fd uintptr) {
+		if err = syscall.Bind(int(fd), sa); err != nil {
+			return
+		}
+		if err = syscall.Listen(int(fd), syscall.SOMAXCONN); err != nil {
+			return
+		}
+		lsa, err = syscall.Getsockname(int(fd))
+	})
+	if cerr != nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Errf("Can't listen to sctp %v: %v", tAddr, err)
+		_ = f.Close()
+		return nil
+	}
+	addr := sctpAddrFromSockaddr(lsa)
+	if len(name) > 0 {
+		log.Printf("Fortio %s %s server listening on sctp %s", version.Short(), name, addr)
+	}
+	go func() {
+		buf := make([]byte, MaxPayloadSize)
+		for {
+			n, from, err := recvFrom(rc, buf)
+			if errors.Is(err, os.ErrClosed) {
+				return
+			}
+			if err != nil {
+				log.Errf("SCTP echo server (%v) error reading: %v", name, err)
+				// e.g. an association reset by its peer, otherwise reading again would fail the same way.
+				var errno syscall.Errno
+				if errors.As(err, &errno) && errno.Temporary() {
+					continue
+				}
+				_ = f.Close()
+				return
+			}
+			if err = sendTo(rc, buf[:n], from); err != nil {
+				log.Errf("SCTP echo server (%v) error writing %d bytes to %v: %v", name, n, sctpAddrFromSockaddr(from), err)
+				continue
+			}
+			log.LogVf("SCTP echo server (%v) echoed %d bytes to %v", name, n, sctpAddrFromSockaddr(from))
+		}
+	}()
+	return addr
+}
@@ -0,0 +1,34 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+
+package fnet // import "fortio.org/fortio/fnet"
+
+import (
+	"net"
+
+	"fortio.org/log"
+)
+
+// DialSCTP is only supported on Linux, returns ErrUnsupported.
+func DialSCTP(_ *SCTPAddr) (net.Conn, error) {
+	return nil, ErrUnsupported
+}
+
+// SCTPEchoServer is only supported on Linux, logs an error and returns nil.
+func SCTPEchoServer(name string, _ string) net.Addr {
+	log.Errf("Can't start sctp echo server %s: %v", name, ErrUnsupported)
+	return nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || darwin
+
+package fnet_test
+
+import (
+	"net"
+	"testing"
+
+	"fortio.org/fortio/fnet"
+	"golang.org/x/sys/unix"
+)
+
+func noDelay(t *testing.T, conn *net.TCPConn) int {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		t.Fatalf("Unable to get raw conn: %v", err)
+	}
+	var v int
+	var serr error
+	err = raw.Control(func(fd uintptr) {
+		v, serr = unix.GetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_NODELAY)
+	})
+	if err != nil || serr != nil {
+		t.Fatalf("Unable to get TCP_NODELAY: %v %v", err, serr)
+	}
+	return v
+}
+
+func TestSetSocketOptionsNagle(t *testing.T) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer l.Close()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Unable to connect: %v", err)
+	}
+	defer conn.Close()
+	tcpConn := conn.(*net.TCPConn)
+	fnet.SetSocketOptions(conn, fnet.SocketOptions{ReadBufferSize: 1024, WriteBufferSize: 1024, Nagle: true})
+	if v := noDelay(t, tcpConn); v != 0 {
+		t.Errorf("Expected TCP_NODELAY off with Nagle, got %d", v)
+	}
+	fnet.SetSocketBuffers(conn, 1024, 1024)
+	if v := noDelay(t, tcpConn); v == 0 {
+		t.Errorf("Expected TCP_NODELAY on by default, got %d", v)
+	}
+}
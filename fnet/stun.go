@@ -0,0 +1,163 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fnet // import "fortio.org/fortio/fnet"
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+
+	"fortio.org/log"
+)
+
+// Minimal STUN (RFC 5389) support: binding requests and responses with the XOR-MAPPED-ADDRESS.
+const (
+	// STUNHeaderSize is the size of the STUN message header.
+	STUNHeaderSize = 20
+	// STUNMagicCookie is the fixed value of bytes 4-7 of STUN messages.
+	STUNMagicCookie = 0x2112A442
+
+	stunBindingRequest    = 0x0001
+	stunBindingSuccess    = 0x0101
+	stunXORMappedAddress  = 0x0020
+	stunFamilyIPv4        = 0x01
+	stunFamilyIPv6        = 0x02
+	stunTransactionIDSize = 12
+)
+
+// STUNTransactionID is the 96 bits transaction id of STUN messages.
+type STUNTransactionID [stunTransactionIDSize]byte
+
+var errNotSTUN = errors.New("not a STUN message")
+
+// stunMessage returns the header for the given type and attributes length followed by the attributes.
+func stunMessage(msgType uint16, id STUNTransactionID, attributes []byte) []byte {
+	msg := make([]byte, STUNHeaderSize, STUNHeaderSize+len(attributes))
+	binary.BigEndian.PutUint16(msg[0:2], msgType)
+	binary.BigEndian.PutUint16(msg[2:4], uint16(len(attributes))) //nolint:gosec // attributes are small
+	binary.BigEndian.PutUint32(msg[4:8], STUNMagicCookie)
+	copy(msg[8:STUNHeaderSize], id[:])
+	return append(msg, attributes...)
+}
+
+// ParseSTUNHeader checks the STUN header of the message and returns its type and transaction id.
+func ParseSTUNHeader(msg []byte) (uint16, STUNTransactionID, error) {
+	var id STUNTransactionID
+	if len(msg) < STUNHeaderSize || msg[0]&0xC0 != 0 || binary.BigEndian.Uint32(msg[4:8]) != STUNMagicCookie {
+		return 0, id, errNotSTUN
+	}
+	if int(binary.BigEndian.Uint16(msg[2:4])) != len(msg)-STUNHeaderSize {
+		return 0, id, fmt.Errorf("invalid STUN message length %d for %d bytes", binary.BigEndian.Uint16(msg[2:4]), len(msg))
+	}
+	copy(id[:], msg[8:STUNHeaderSize])
+	return binary.BigEndian.Uint16(msg[0:2]), id, nil
+}
+
+// STUNBindingRequest returns a (attribute-less) STUN binding request with the given transaction id.
+func STUNBindingRequest(id STUNTransactionID) []byte {
+	return stunMessage(stunBindingRequest, id, nil)
+}
+
+// STUNBindingResponse returns the STUN binding success response, for the transaction id,
+// with the XOR-MAPPED-ADDRESS attribute set to addr (the client's reflexive address).
+func STUNBindingResponse(id STUNTransactionID, addr *net.UDPAddr) []byte {
+	family, ip := byte(stunFamilyIPv4), addr.IP.To4()
+	if ip == nil {
+		family, ip = stunFamilyIPv6, addr.IP.To16()
+	}
+	attr := make([]byte, 8+len(ip))
+	binary.BigEndian.PutUint16(attr[0:2], stunXORMappedAddress)
+	binary.BigEndian.PutUint16(attr[2:4], uint16(4+len(ip))) //nolint:gosec // 8 or 20
+	attr[5] = family
+	binary.BigEndian.PutUint16(attr[6:8], uint16(addr.Port)^(STUNMagicCookie>>16)) //nolint:gosec // port is 16 bits
+	stunXOR(attr[8:], ip, id)
+	return stunMessage(stunBindingSuccess, id, attr)
+}
+
+// stunXOR sets dst to ip xor'ed with the magic cookie followed by the transaction id.
+func stunXOR(dst, ip []byte, id STUNTransactionID) {
+	var key [16]byte
+	binary.BigEndian.PutUint32(key[0:4], STUNMagicCookie)
+	copy(key[4:], id[:])
+	for i := range ip {
+		dst[i] = ip[i] ^ key[i]
+	}
+}
+
+// ParseSTUNBindingResponse checks the msg is the binding success response for the transaction id
+// and returns the XOR-MAPPED-ADDRESS it contains.
+func ParseSTUNBindingResponse(msg []byte, id STUNTransactionID) (*net.UDPAddr, error) {
+	msgType, respID, err := ParseSTUNHeader(msg)
+	if err != nil {
+		return nil, err
+	}
+	if msgType != stunBindingSuccess || respID != id {
+		return nil, fmt.Errorf("unexpected STUN message type 0x%04x or transaction id", msgType)
+	}
+	attrs := msg[STUNHeaderSize:]
+	for len(attrs) >= 4 {
+		attrType := binary.BigEndian.Uint16(attrs[0:2])
+		attrLen := int(binary.BigEndian.Uint16(attrs[2:4]))
+		if len(attrs) < 4+attrLen {
+			break
+		}
+		value := attrs[4 : 4+attrLen]
+		if attrType == stunXORMappedAddress && attrLen >= 8 {
+			ipLen := net.IPv4len
+			if value[1] == stunFamilyIPv6 {
+				ipLen = net.IPv6len
+			}
+			if attrLen < 4+ipLen {
+				break
+			}
+			ip := make(net.IP, ipLen)
+			stunXOR(ip, value[4:4+ipLen], id)
+			port := binary.BigEndian.Uint16(value[2:4]) ^ (STUNMagicCookie >> 16)
+			return &net.UDPAddr{IP: ip, Port: int(port)}, nil
+		}
+		attrs = attrs[4+(attrLen+3)/4*4:] // attributes are padded to 4 bytes
+	}
+	return nil, errors.New("no valid XOR-MAPPED-ADDRESS in STUN response")
+}
+
+// STUNEchoServer starts a minimal STUN server on the given port (0 for dynamic port): binding requests
+// get a binding success response with the client's reflexive address, other packets are ignored.
+// Useful for latency measurements from WebRTC clients or IoT devices (and fortio's udp STUN mode).
+func STUNEchoServer(port string) net.Addr {
+	name := "stun-echo"
+	listener, addr := UDPListen(name, port)
+	if listener == nil {
+		return nil // error already logged
+	}
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			size, from, err := listener.ReadFromUDP(buf)
+			if err != nil {
+				log.Critf("STUN echo server (%v) error reading: %v", name, err)
+				continue
+			}
+			msgType, id, err := ParseSTUNHeader(buf[:size])
+			if err != nil || msgType != stunBindingRequest {
+				log.LogVf("STUN echo server (%v) ignoring %d bytes from %v: type 0x%04x, %v", name, size, from, msgType, err)
+				continue
+			}
+			wb, err := listener.WriteToUDP(STUNBindingResponse(id, from), from)
+			log.LogVf("STUN echo server (%v) replied %d bytes to %v (err=%v)", name, wb, from, err)
+		}
+	}()
+	return addr
+}
@@ -0,0 +1,58 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package fnet // import "fortio.org/fortio/fnet"
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// GetTCPInfo returns the kernel's TCP_INFO of the (TCP, or TLS over TCP) connection.
+func GetTCPInfo(conn net.Conn) (TCPInfo, error) {
+	if tlsConn, ok := conn.(interface{ NetConn() net.Conn }); ok {
+		conn = tlsConn.NetConn()
+	}
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return TCPInfo{}, fmt.Errorf("TCP_INFO: not a socket: %T", conn)
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return TCPInfo{}, err
+	}
+	var info *unix.TCPInfo
+	var serr error
+	err = raw.Control(func(fd uintptr) {
+		info, serr = unix.GetsockoptTCPInfo(int(fd), unix.IPPROTO_TCP, unix.TCP_INFO) //nolint:gosec // fd fits in an int.
+	})
+	if err != nil {
+		return TCPInfo{}, err
+	}
+	if serr != nil {
+		return TCPInfo{}, serr
+	}
+	return TCPInfo{
+		RTT:         time.Duration(info.Rtt) * time.Microsecond,
+		RTTVar:      time.Duration(info.Rttvar) * time.Microsecond,
+		Retransmits: info.Total_retrans,
+		Cwnd:        info.Snd_cwnd,
+	}, nil
+}
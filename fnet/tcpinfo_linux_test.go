@@ -0,0 +1,52 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package fnet_test
+
+import (
+	"net"
+	"testing"
+
+	"fortio.org/fortio/fnet"
+)
+
+func TestGetTCPInfo(t *testing.T) {
+	addr := fnet.TCPEchoServer("test-tcpinfo", "localhost:0")
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatalf("Unable to connect: %v", err)
+	}
+	defer conn.Close()
+	if _, err = conn.Write([]byte("hello")); err != nil {
+		t.Fatalf("Unable to write: %v", err)
+	}
+	buf := make([]byte, 5)
+	if _, err = conn.Read(buf); err != nil {
+		t.Fatalf("Unable to read: %v", err)
+	}
+	info, err := fnet.GetTCPInfo(conn)
+	if err != nil {
+		t.Fatalf("Unable to get TCP_INFO: %v", err)
+	}
+	if info.RTT <= 0 || info.Cwnd == 0 {
+		t.Errorf("Unexpected TCP_INFO %+v", info)
+	}
+	l, _ := fnet.UDPListen("test-tcpinfo-udp", "localhost:0")
+	defer l.Close()
+	if _, err = fnet.GetTCPInfo(l); err == nil {
+		t.Errorf("Expected error for UDP socket")
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fnet // import "fortio.org/fortio/fnet"
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"fortio.org/fortio/stats"
+	"fortio.org/log"
+)
+
+// TimestampMode is the side of a pair of timestamped proxies (see TimestampedProxy).
+type TimestampMode int
+
+const (
+	// TimestampToDestination is the client side proxy: it adds timestamps to the chunks forwarded
+	// to its destination, which must be a TimestampFromClients proxy, and strips them from the replies.
+	TimestampToDestination TimestampMode = iota + 1
+	// TimestampFromClients is the destination side proxy: it strips the timestamps of the chunks
+	// received from its (TimestampToDestination proxy) clients and adds them to the replies.
+	TimestampFromClients
+)
+
+func (m TimestampMode) String() string {
+	switch m {
+	case TimestampToDestination:
+		return "to-destination"
+	case TimestampFromClients:
+		return "from-clients"
+	default:
+		return fmt.Sprintf("TimestampMode(%d)", int(m))
+	}
+}
+
+// TimestampedProxyDialTimeout is the timeout of the connections TimestampedProxy makes to its destination.
+var TimestampedProxyDialTimeout = 5 * time.Second
+
+// tsHeaderSize is the size of the header of each timestamped chunk: 8 bytes little-endian unix
+// nanoseconds timestamp followed by the 4 bytes little-endian length of the chunk, as TCP doesn't
+// preserve the chunks boundaries.
+const tsHeaderSize = 8 + 4
+
+// ProxyInfo is the handle of a proxy started with TimestampedProxy.
+type ProxyInfo struct {
+	Addr    net.Addr
+	Mode    TimestampMode
+	dest    net.Addr
+	mutex   sync.Mutex // protects the latency histogram
+	latency *stats.Histogram
+}
+
+// TimestampedProxy starts a TCP proxy from listenPort to destination, like ProxyToDestination, which
+// also measures the one-way propagation delay between 2 such proxies, one of each TimestampMode:
+// each chunk sent from one to the other gets prefixed by its sending time, which the receiving
+// proxy strips to record the delay in its LatencyHistogram(). Only the traffic between the 2
+// proxies is modified, so e.g. fortio load -> TimestampToDestination proxy -> network ->
+// TimestampFromClients proxy -> server measures the network latency in both directions.
+// The delays are only accurate when the 2 proxies' clocks are synchronized (NTP).
+// The proxy stops accepting connections when ctx is done.
+func TimestampedProxy(ctx context.Context, listenPort, destination string, mode TimestampMode) (*ProxyInfo, error) {
+	if mode != TimestampToDestination && mode != TimestampFromClients {
+		return nil, fmt.Errorf("invalid timestamp mode %v", mode)
+	}
+	dest, err := TCPResolveDestination(ctx, destination)
+	if err != nil {
+		return nil, err
+	}
+	listener, addr := Listen(fmt.Sprintf("timestamped (%v) proxy for %v", mode, dest), listenPort)
+	if listener == nil {
+		return nil, fmt.Errorf("unable to listen on %q", listenPort) // details already logged
+	}
+	p := &ProxyInfo{
+		Addr:    addr,
+		Mode:    mode,
+		dest:    dest,
+		latency: stats.NewHistogram(0, 0.0001),
+	}
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Errf("Timestamped proxy: error accepting: %v", err)
+				continue
+			}
+			log.LogVf("Timestamped proxy: accepted connection from %v -> %v (for %v)", conn.RemoteAddr(), conn.LocalAddr(), dest)
+			go p.handle(conn)
+		}
+	}()
+	return p, nil
+}
+
+// LatencyHistogram returns a snapshot of the one-way delays, in seconds, of the timestamped
+// chunks received by this proxy, for all connections.
+func (p *ProxyInfo) LatencyHistogram() *stats.HistogramData {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.latency.Export()
+}
+
+func (p *ProxyInfo) record(delay time.Duration) {
+	p.mutex.Lock()
+	p.latency.Record(delay.Seconds())
+	p.mutex.Unlock()
+}
+
+func (p *ProxyInfo) handle(conn net.Conn) {
+	d, err := net.DialTimeout(p.dest.Network(), p.dest.String(), TimestampedProxyDialTimeout)
+	if err != nil {
+		log.Errf("Timestamped proxy: unable to connect to %v for %v : %v", p.dest, conn.RemoteAddr(), err)
+		_ = conn.Close()
+		return
+	}
+	// The peer proxy side, which timestamped chunks are exchanged with:
+	peer, plain := d, conn
+	if p.Mode == TimestampFromClients {
+		peer, plain = conn, d
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go p.transferAddingTimestamps(&wg, peer, plain)
+	p.transferStrippingTimestamps(&wg, plain, peer)
+	wg.Wait()
+	log.LogVf("Timestamped proxy: both sides of transfer to %v for %v done", p.dest, conn.RemoteAddr())
+	_ = d.Close()
+	_ = conn.Close()
+}
+
+// transferAddingTimestamps copies src to dst with each chunk read prefixed by the header.
+func (p *ProxyInfo) transferAddingTimestamps(wg *sync.WaitGroup, dst net.Conn, src net.Conn) {
+	buf := make([]byte, tsHeaderSize+32*KILOBYTE)
+	var total int64
+	var oErr error
+	for {
+		n, err := src.Read(buf[tsHeaderSize:])
+		if n > 0 {
+			binary.LittleEndian.PutUint64(buf, uint64(time.Now().UnixNano())) //nolint:gosec // time is positive.
+			binary.LittleEndian.PutUint32(buf[8:], uint32(n))                 //nolint:gosec // n is at most 32k.
+			if _, oErr = dst.Write(buf[:tsHeaderSize+n]); oErr != nil {
+				break
+			}
+			total += int64(n)
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				oErr = err
+			}
+			break
+		}
+	}
+	log.LogVf("Timestamped proxy: transferred %d bytes from %v to %v, adding timestamps (err=%v)",
+		total, src.RemoteAddr(), dst.RemoteAddr(), oErr)
+	halfClose(dst, src, oErr)
+	wg.Done()
+}
+
+// transferStrippingTimestamps copies the chunks read from src to dst without their header,
+// recording their delay.
+func (p *ProxyInfo) transferStrippingTimestamps(wg *sync.WaitGroup, dst net.Conn, src net.Conn) {
+	header := make([]byte, tsHeaderSize)
+	buf := make([]byte, 32*KILOBYTE)
+	var total, chunks int64
+	var sum time.Duration
+	var oErr error
+	for {
+		_, err := io.ReadFull(src, header)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				oErr = err
+			}
+			break
+		}
+		delay := time.Since(time.Unix(0, int64(binary.LittleEndian.Uint64(header)))) //nolint:gosec // sent as positive.
+		n := int(binary.LittleEndian.Uint32(header[8:]))
+		if n > len(buf) {
+			oErr = fmt.Errorf("invalid timestamped chunk length %d", n)
+			break
+		}
+		if _, oErr = io.ReadFull(src, buf[:n]); oErr != nil {
+			break
+		}
+		p.record(delay)
+		chunks++
+		sum += delay
+		if _, oErr = dst.Write(buf[:n]); oErr != nil {
+			break
+		}
+		total += int64(n)
+	}
+	if chunks > 0 {
+		log.LogVf("Timestamped proxy: %d chunks from %v average delay %v", chunks, src.RemoteAddr(), sum/time.Duration(chunks))
+	}
+	log.LogVf("Timestamped proxy: transferred %d bytes from %v to %v, stripping timestamps (err=%v)",
+		total, src.RemoteAddr(), dst.RemoteAddr(), oErr)
+	halfClose(dst, src, oErr)
+	wg.Done()
+}
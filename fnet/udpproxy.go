@@ -0,0 +1,162 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fnet // import "fortio.org/fortio/fnet"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"fortio.org/log"
+)
+
+const maxUDPPacketSize = 65535 // largest possible UDP datagram
+
+var (
+	// UDPProxyMaxClients is the maximum number of concurrent client (source address) sessions per UDP proxy,
+	// packets from new clients beyond that are dropped.
+	UDPProxyMaxClients = 1024
+	// UDPProxySessionTimeout is how long a UDP proxy session is kept without traffic in either direction.
+	UDPProxySessionTimeout = 1 * time.Minute
+)
+
+// udpProxySession is the outbound socket to the destination for 1 client.
+type udpProxySession struct {
+	conn     *net.UDPConn
+	lastSeen atomic.Int64 // unix nano of the last packet from the client
+}
+
+type udpProxy struct {
+	listener   *net.UDPConn
+	dest       *net.UDPAddr
+	maxClients int
+	timeout    time.Duration
+	mu         sync.Mutex
+	sessions   map[string]*udpProxySession
+}
+
+// UDPProxyToDestination starts a UDP proxy listening on localAddr (port or addr:port) forwarding the packets
+// to destAddr (host:port or udp://host:port/). Each client (source address) gets its own outbound socket
+// so the replies can be relayed back to it, up to UDPProxyMaxClients sessions, closed after
+// UDPProxySessionTimeout without traffic. The proxy stops when ctx is done.
+func UDPProxyToDestination(ctx context.Context, localAddr, destAddr string) (net.Addr, error) {
+	dest, err := UDPResolveDestination(ctx, destAddr)
+	if err != nil {
+		return nil, err
+	}
+	listener, addr := UDPListen(fmt.Sprintf("udp proxy for %v", dest), localAddr)
+	if listener == nil {
+		return nil, fmt.Errorf("unable to listen on udp %q", localAddr) // details already logged
+	}
+	p := &udpProxy{
+		listener:   listener,
+		dest:       dest,
+		maxClients: UDPProxyMaxClients,
+		timeout:    UDPProxySessionTimeout,
+		sessions:   make(map[string]*udpProxySession),
+	}
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+	go p.run()
+	return addr, nil
+}
+
+func (p *udpProxy) run() {
+	buf := make([]byte, maxUDPPacketSize)
+	for {
+		n, src, err := p.listener.ReadFromUDP(buf)
+		if errors.Is(err, net.ErrClosed) {
+			break
+		}
+		if err != nil {
+			log.Errf("UDP proxy for %v error reading: %v", p.dest, err)
+			continue
+		}
+		s := p.session(src)
+		if s == nil {
+			continue // already logged
+		}
+		s.lastSeen.Store(time.Now().UnixNano())
+		if _, err = s.conn.Write(buf[:n]); err != nil {
+			log.Errf("UDP proxy error forwarding %d bytes from %v to %v: %v", n, src, p.dest, err)
+		}
+	}
+	p.mu.Lock()
+	for _, s := range p.sessions {
+		_ = s.conn.Close()
+	}
+	p.mu.Unlock()
+	log.LogVf("UDP proxy for %v stopped", p.dest)
+}
+
+// session returns the existing or a new session for src, nil if it can't be created.
+func (p *udpProxy) session(src *net.UDPAddr) *udpProxySession {
+	key := src.String()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if s, found := p.sessions[key]; found {
+		return s
+	}
+	if len(p.sessions) >= p.maxClients {
+		log.Warnf("UDP proxy for %v reached max %d clients, dropping packet from %v", p.dest, p.maxClients, src)
+		return nil
+	}
+	conn, err := net.DialUDP("udp", nil, p.dest)
+	if err != nil {
+		log.Errf("UDP proxy: unable to connect to %v for %v: %v", p.dest, src, err)
+		return nil
+	}
+	s := &udpProxySession{conn: conn}
+	p.sessions[key] = s
+	log.LogVf("UDP proxy: new session %v -> %v (%d sessions)", src, conn.LocalAddr(), len(p.sessions))
+	go p.relay(key, src, s)
+	return s
+}
+
+// relay sends the replies from the destination back to the client, until the session times out.
+func (p *udpProxy) relay(key string, src *net.UDPAddr, s *udpProxySession) {
+	buf := make([]byte, maxUDPPacketSize)
+	for {
+		_ = s.conn.SetReadDeadline(time.Now().Add(p.timeout))
+		n, err := s.conn.Read(buf)
+		if os.IsTimeout(err) {
+			if time.Since(time.Unix(0, s.lastSeen.Load())) < p.timeout {
+				continue // client still active
+			}
+			log.LogVf("UDP proxy: session %v timed out", src)
+			break
+		}
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Errf("UDP proxy: error reading from %v for %v: %v", p.dest, src, err)
+			}
+			break
+		}
+		if _, err = p.listener.WriteToUDP(buf[:n], src); err != nil {
+			log.Errf("UDP proxy: error relaying %d bytes back to %v: %v", n, src, err)
+		}
+	}
+	p.mu.Lock()
+	delete(p.sessions, key)
+	p.mu.Unlock()
+	_ = s.conn.Close()
+}
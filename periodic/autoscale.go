@@ -0,0 +1,96 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package periodic // import "fortio.org/fortio/periodic"
+
+import (
+	"math"
+	"runtime"
+	"time"
+
+	"fortio.org/log"
+)
+
+// autoScaleThreshold is the fraction of the target qps below which AutoScale adds threads.
+const autoScaleThreshold = 0.95
+
+// autoScaleInterval is how often AutoScale checks the actual qps (variable for tests).
+var autoScaleInterval = 5 * time.Second
+
+// autoScale is the AutoScale monitor: every autoScaleInterval it computes the qps over that window and
+// when it's below autoScaleThreshold of the target, starts (using startThread) enough new threads to make up
+// for the difference assuming they'll be as blocked as the current ones. Returns the total number of threads
+// once the run is over or MaxThreads is reached.
+func (r *periodicRunner) autoScale(runnerChan chan struct{}, start time.Time,
+	startThread func(t ThreadID, numCalls int64, start time.Time, runner *periodicRunner),
+) int {
+	threads := r.NumThreads
+	maxThreads := r.NumThreads
+	for maxThreads < min(r.MaxThreads, len(r.Runners)) && r.Runners[maxThreads] != nil {
+		maxThreads++
+	}
+	if maxThreads < r.MaxThreads {
+		log.Warnf("AutoScale limited to %d threads instead of %d by the number of Runners", maxThreads, r.MaxThreads)
+	}
+	hasDuration := (r.Duration > 0)
+	endTime := start.Add(r.Duration)
+	perThreadQPS := r.QPS / float64(r.rateLimitedThreads())
+	var lastCalls int64
+	lastTime := start
+	for threads < maxThreads {
+		wait := autoScaleInterval
+		if hasDuration {
+			wait = min(wait, time.Until(endTime))
+		}
+		select {
+		case <-runnerChan:
+			return threads
+		case <-time.After(wait):
+			// check the qps
+		}
+		now := time.Now()
+		if hasDuration && !now.Before(endTime) {
+			break
+		}
+		calls := r.calls.Load()
+		windowQPS := float64(calls-lastCalls) / now.Sub(lastTime).Seconds()
+		lastCalls, lastTime = calls, now
+		if windowQPS >= autoScaleThreshold*r.QPS {
+			continue
+		}
+		extra := &periodicRunner{RunnerOptions: r.RunnerOptions, calls: r.calls}
+		extra.Uniform = false
+		var numCalls int64
+		if hasDuration {
+			extra.Duration = endTime.Sub(now)
+			numCalls = int64(perThreadQPS * extra.Duration.Seconds())
+			if numCalls < 2 {
+				break // not enough time left for the new threads to help
+			}
+		}
+		add := threads // no call completed at all in the window: double
+		if windowQPS > 0 {
+			add = int(math.Ceil((r.QPS - windowQPS) * float64(threads) / windowQPS))
+		}
+		add = min(add, maxThreads-threads)
+		log.S(log.Warning, "AutoScale adding threads", log.Attr("run", r.RunID), log.Attr("qps", windowQPS),
+			log.Attr("target", r.QPS), log.Attr("threads", threads), log.Attr("adding", add),
+			log.Attr("goroutines", runtime.NumGoroutine()))
+		for range add {
+			startThread(ThreadID(threads), numCalls, now, extra)
+			threads++
+		}
+	}
+	return threads
+}
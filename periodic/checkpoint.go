@@ -0,0 +1,270 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package periodic // import "fortio.org/fortio/periodic"
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"fortio.org/fortio/stats"
+	"fortio.org/log"
+)
+
+// DefaultCheckpointInterval is how often the run state is saved when RunnerOptions.CheckpointInterval isn't set.
+var DefaultCheckpointInterval = time.Minute
+
+// Checkpoint is the state of a run saved to RunnerOptions.CheckpointFile, which an interrupted run is
+// resumed from.
+type Checkpoint struct {
+	ID                string
+	StartTime         time.Time
+	RequestedDuration string
+	// Running time so far, across all the resumes.
+	Elapsed                 time.Duration
+	DurationHistogram       *stats.HistogramData
+	ErrorsDurationHistogram *stats.HistogramData
+	ErrorTypes              map[string]int64 `json:",omitempty"`
+	// Options of the run, which must match to resume it.
+	Options CheckpointOptions
+	// Runner specific results, see CheckpointHook.
+	RunnerState json.RawMessage `json:",omitempty"`
+}
+
+// CheckpointHook is implemented by the runners checkpointing their own results (e.g. the HTTP return codes),
+// see RunnerOptions.CheckpointHook. As the runners' results aren't safe to read while the run is in progress,
+// they are only saved when the run is interrupted: resuming from a periodic checkpoint (e.g. after a crash)
+// only restores the ones of the previous interruptions.
+type CheckpointHook interface {
+	// CheckpointState returns the runner's results so far, including the resumed ones. Only called once
+	// the threads are done.
+	CheckpointState() (json.RawMessage, error)
+	// ResumeState is called, before the run, with the RunnerState of the checkpoint being resumed, for the
+	// runner to include it in its results.
+	ResumeState(state json.RawMessage) error
+}
+
+// CheckpointOptions are the options defining a run, a Checkpoint is only resumed by a run with the same ones.
+// The others, e.g. the QPS or number of threads, can be changed when resuming.
+type CheckpointOptions struct {
+	RunType    string
+	Target     string
+	Labels     string
+	Duration   time.Duration
+	Exactly    int64
+	Resolution float64
+	Offset     time.Duration
+	UseHDR     bool
+}
+
+// checkpointOptions returns the options defining the run, see CheckpointOptions.
+func (r *RunnerOptions) checkpointOptions() CheckpointOptions {
+	return CheckpointOptions{
+		RunType:    r.RunType,
+		Target:     r.CheckpointTarget,
+		Labels:     r.Labels,
+		Duration:   r.Duration,
+		Exactly:    r.Exactly,
+		Resolution: r.Resolution,
+		Offset:     r.Offset,
+		UseHDR:     r.UseHDR,
+	}
+}
+
+// LoadCheckpoint reads the checkpoint file at path, nil (and no error) when it doesn't exist.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil //nolint:nilnil // no checkpoint isn't an error.
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c Checkpoint
+	if err = json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Save writes the checkpoint to path, atomically (through a temporary file renamed to path) so an
+// interruption while saving doesn't lose the previous checkpoint.
+func (c *Checkpoint) Save(path string) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// resumeCheckpoint loads the CheckpointFile, when there is one, and adjusts the options to only run
+// the remaining duration or calls, with the same ID. Returns the checkpoint, nil when not resuming,
+// and whether it already has all the Exactly calls. Errors when the checkpoint is of a different run.
+func (r *periodicRunner) resumeCheckpoint() (*Checkpoint, bool, error) {
+	r.checkpointOpts = r.checkpointOptions()
+	c, err := LoadCheckpoint(r.CheckpointFile)
+	if err != nil {
+		log.Errf("Unable to resume, starting from scratch: %v", err)
+		return nil, false, nil
+	}
+	if c == nil {
+		return nil, false, nil
+	}
+	if c.Options != r.checkpointOpts {
+		log.S(log.Error, "Checkpoint is of a different run, not resuming it", log.Str("file", r.CheckpointFile),
+			log.Attr("checkpoint", c.Options), log.Attr("run", r.checkpointOpts))
+		return nil, false, fmt.Errorf("checkpoint %s is of a different run (%+v)", r.CheckpointFile, c.Options)
+	}
+	var calls int64
+	if c.DurationHistogram != nil {
+		calls = c.DurationHistogram.Count
+	}
+	complete := false
+	switch {
+	case r.Exactly > 0 && calls >= r.Exactly:
+		complete = true
+	case r.Exactly > 0:
+		r.Exactly -= calls
+	case r.Duration > 0:
+		r.Duration = max(r.Duration-c.Elapsed, time.Millisecond)
+	}
+	if r.CheckpointHook != nil && c.RunnerState != nil {
+		if err = r.CheckpointHook.ResumeState(c.RunnerState); err != nil {
+			log.Errf("Unable to resume the runner results of checkpoint %s: %v", r.CheckpointFile, err)
+		}
+	}
+	r.ID = c.ID
+	_, _ = fmt.Fprintf(r.Out, "Resuming run %s from checkpoint %s after %v and %d calls\n", c.ID, r.CheckpointFile, c.Elapsed, calls)
+	return c, complete, nil
+}
+
+// setupCheckpoint returns the checkpoint the run starting at start continues (the resumed one, whose
+// error types are carried over, or a new one) and creates the live histograms the checkpoints are made of.
+func (r *periodicRunner) setupCheckpoint(resumed *Checkpoint, start time.Time, requestedDuration string) *Checkpoint {
+	if r.LiveHistogram == nil {
+		r.LiveHistogram = r.NewLiveHistogram()
+	}
+	if r.LiveErrorHistogram == nil {
+		r.LiveErrorHistogram = r.NewLiveHistogram()
+	}
+	if resumed == nil {
+		return &Checkpoint{ID: r.ID, StartTime: start, RequestedDuration: requestedDuration, Options: r.checkpointOpts}
+	}
+	for k, v := range resumed.ErrorTypes {
+		r.errorTypes.add(k, v)
+	}
+	return resumed
+}
+
+// startCheckpoints saves the checkpoint of the run in progress every CheckpointInterval, from the live
+// histograms, and aborts the run on SIGTERM (e.g. a preemptible VM being stopped), until done is closed.
+func (r *periodicRunner) startCheckpoints(done chan struct{}, base *Checkpoint, start time.Time) {
+	interval := r.CheckpointInterval
+	if interval <= 0 {
+		interval = DefaultCheckpointInterval
+	}
+	term := make(chan os.Signal, 1)
+	signal.Notify(term, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(term)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-term:
+				log.Warnf("Terminate signal received, interrupting the run (checkpoint %s)", r.CheckpointFile)
+				r.Abort()
+			case <-ticker.C:
+				r.saveCheckpoint(r.currentCheckpoint(base, start))
+			}
+		}
+	}()
+}
+
+// currentCheckpoint returns the base checkpoint updated with the calls done since start.
+func (r *periodicRunner) currentCheckpoint(base *Checkpoint, start time.Time) *Checkpoint {
+	c := *base
+	c.Elapsed += time.Since(start)
+	durations := r.LiveHistogram.Snapshot()
+	durations.AddData(base.DurationHistogram)
+	c.DurationHistogram = durations.Export()
+	errs := r.LiveErrorHistogram.Snapshot()
+	errs.AddData(base.ErrorsDurationHistogram)
+	c.ErrorsDurationHistogram = errs.Export()
+	r.errorTypes.mutex.Lock()
+	c.ErrorTypes = maps.Clone(r.errorTypes.counts) // includes the base ones.
+	r.errorTypes.mutex.Unlock()
+	return &c
+}
+
+func (r *periodicRunner) saveCheckpoint(c *Checkpoint) {
+	if err := c.Save(r.CheckpointFile); err != nil {
+		log.Errf("Unable to save checkpoint %s: %v", r.CheckpointFile, err)
+		return
+	}
+	log.LogVf("Saved checkpoint %s: %v, %d calls", r.CheckpointFile, c.Elapsed, c.DurationHistogram.Count)
+}
+
+// endCheckpoint saves the final checkpoint of an interrupted run, so it can be resumed, or removes the
+// checkpoint file of a completed one.
+func (r *periodicRunner) endCheckpoint(interrupted bool, result *RunnerResults, requestedDuration string) {
+	if !interrupted {
+		if err := os.Remove(r.CheckpointFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Errf("Unable to remove checkpoint %s: %v", r.CheckpointFile, err)
+		}
+		return
+	}
+	var state json.RawMessage
+	if r.CheckpointHook != nil {
+		var err error
+		if state, err = r.CheckpointHook.CheckpointState(); err != nil {
+			log.Errf("Unable to checkpoint the runner results: %v", err)
+		}
+	}
+	r.saveCheckpoint(&Checkpoint{
+		ID:                      result.ID,
+		StartTime:               result.StartTime,
+		RequestedDuration:       requestedDuration,
+		Elapsed:                 result.ActualDuration,
+		DurationHistogram:       result.DurationHistogram,
+		ErrorsDurationHistogram: result.ErrorsDurationHistogram,
+		ErrorTypes:              result.ErrorTypes,
+		Options:                 r.checkpointOpts,
+		RunnerState:             state,
+	})
+	_, _ = fmt.Fprintf(r.Out, "Run interrupted, saved checkpoint %s to resume it\n", r.CheckpointFile)
+}
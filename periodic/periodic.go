@@ -23,15 +23,22 @@
 package periodic // import "fortio.org/fortio/periodic"
 
 import (
+	"bytes"
+	"cmp"
 	"context"
 	"fmt"
 	"io"
+	"maps"
 	"math/rand"
 	"os"
 	"os/signal"
 	"runtime"
+	"runtime/pprof"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"fortio.org/fortio/jrpc"
@@ -59,22 +66,70 @@ type Runnable interface {
 	// Run returns a boolean, true for normal/success, false otherwise.
 	// with details being an optional string that can be put in the access logs.
 	// Statistics are split into two sets.
+	// ctx is canceled when the run is aborted: calls in progress should then return as soon as possible
+	// (and are recorded like the other ones, typically as errors).
 	Run(ctx context.Context, id ThreadID) (status bool, details string)
 }
 
-// MakeRunners creates an array of NumThreads identical Runnable instances
+// ConcurrentRunnable is implemented by the Runnables which support a new Run call for a ThreadID while
+// a previous, abandoned, one is still in progress. Required to use RunTimeout.
+type ConcurrentRunnable interface {
+	Runnable
+	// ConcurrentSafe returns true when Run can be called concurrently for the same ThreadID.
+	ConcurrentSafe() bool
+}
+
+// concurrentSafe returns true if all the Runnables support concurrent calls (see ConcurrentRunnable).
+func concurrentSafe(runners []Runnable) bool {
+	for _, rr := range runners {
+		if c, ok := rr.(ConcurrentRunnable); !ok || !c.ConcurrentSafe() {
+			return false
+		}
+	}
+	return true
+}
+
+// MakeRunners creates an array of MaxRunners() identical Runnable instances
 // (for the (rare/test) cases where there is no unique state needed).
 func (r *RunnerOptions) MakeRunners(rr Runnable) {
-	log.Infof("Making %d clone of %+v", r.NumThreads, rr)
-	if len(r.Runners) < r.NumThreads {
-		log.Infof("Resizing runners from %d to %d", len(r.Runners), r.NumThreads)
-		r.Runners = make([]Runnable, r.NumThreads)
+	n := r.MaxRunners()
+	log.Infof("Making %d clone of %+v", n, rr)
+	if len(r.Runners) < n {
+		log.Infof("Resizing runners from %d to %d", len(r.Runners), n)
+		r.Runners = make([]Runnable, n)
 	}
-	for i := range r.NumThreads {
+	for i := range n {
 		r.Runners[i] = rr
 	}
 }
 
+// threadPriority returns the priority of thread id, see ThreadPriority.
+func (r *RunnerOptions) threadPriority(id ThreadID) int {
+	if int(id) < len(r.ThreadPriority) {
+		return r.ThreadPriority[id]
+	}
+	return 1
+}
+
+// rateLimitedThreads returns how many of the NumThreads share the QPS (at least 1).
+func (r *RunnerOptions) rateLimitedThreads() int {
+	n := 0
+	for t := range r.NumThreads {
+		if r.threadPriority(ThreadID(t)) != 0 {
+			n++
+		}
+	}
+	return max(n, 1)
+}
+
+// MaxRunners returns how many Runners may be used: NumThreads or MaxThreads when AutoScale is set.
+func (r *RunnerOptions) MaxRunners() int {
+	if r.AutoScale && r.MaxThreads > r.NumThreads {
+		return r.MaxThreads
+	}
+	return r.NumThreads
+}
+
 // ReleaseRunners clear the runners state.
 func (r *RunnerOptions) ReleaseRunners() {
 	for idx := range r.Runners {
@@ -205,6 +260,8 @@ type RunnerOptions struct {
 	Out io.Writer `json:"-"`
 	// Extra data to be copied back to the results (to be saved/JSON serialized)
 	Labels string
+	// Optional structured metadata (e.g. env, version, team), also copied back to the results.
+	Tags map[string]string `json:",omitempty"`
 	// Aborter to interrupt a run. Will be created if not set/left nil. Or you
 	// can pass your own. It is very important this is a pointer and not a field
 	// as RunnerOptions themselves get copied while the channel and lock must
@@ -231,6 +288,62 @@ type RunnerOptions struct {
 	AccessLogger AccessLogger `json:"-"`
 	// No catch-up: if true we will do exactly the requested QPS and not try to catch up if the target is temporarily slow.
 	NoCatchUp bool
+	// In qps mode, calls leaving less than IdleThreshold of their thread's interval between calls (1/per thread qps)
+	// idle are counted as slow in SlowRunnerCount, and a warning is logged (once per thread) when more than 5% of
+	// a thread's calls are slow: the target is too slow for the requested qps. Default (0) is a 10th of the interval.
+	IdleThreshold time.Duration
+	// Only record 1 out of SampleRate calls in the histograms (and count that one SampleRate times, or for the
+	// fewer calls left for the last one of each thread, so the count is exact).
+	// Trades histogram accuracy for less overhead at very high qps. Default (0 or 1) records every call.
+	SampleRate int
+	// Optional warmup phase before the main run: for WarmupDuration at WarmupQPS (total across threads like QPS,
+	// 0 means same as QPS, negative is max speed). Warmup calls aren't counted in the main histograms or Exactly
+	// but reported separately in the WarmupHistogram of the results.
+	WarmupDuration time.Duration
+	WarmupQPS      float64
+	// When AutoScale is set, in qps mode for a duration (or until stopped), the actual qps is checked
+	// every 5 seconds and if it is below 95% of the target because the calls are blocking the threads,
+	// additional threads are started, up to MaxThreads (which must be larger than NumThreads, and
+	// requires as many Runners). The added threads each run at the same target qps as the initial ones.
+	AutoScale  bool
+	MaxThreads int
+	// Optional per thread priority, for mixed workloads: threads with priority 0 run at max speed (for instance
+	// a few "canary" threads to detect tail latency) while the other ones, including the threads beyond the
+	// length of the slice, are rate limited and share the QPS. Empty means all threads are rate limited.
+	ThreadPriority []int
+	// Optional lock free histograms of all the calls and of the errors durations, updated by the threads
+	// as the run progresses (not including warmup) so they can be read while the run is in flight.
+	// See NewLiveHistogram.
+	LiveHistogram      stats.LiveHistogram `json:"-"`
+	LiveErrorHistogram stats.LiveHistogram `json:"-"`
+	// Optional current qps (sliding window rate of the LiveHistogram count), sampled every second during the run.
+	LiveRate *stats.RateTracker `json:"-"`
+	// Use high dynamic range histograms (see stats.NewHDRHistogram) for the calls durations, more precise
+	// than the default Resolution based layout for distributions spanning several orders of magnitude.
+	UseHDR bool
+	// When set, each Run call is abandoned, counted in TimeoutCount and as a "timeout" error, after RunTimeout
+	// so a stuck call doesn't block its thread: its ctx is canceled and the next calls proceed while the
+	// abandoned one finishes on its own, concurrently. Only used if all the Runners are ConcurrentRunnable
+	// (e.g. the tcprunner's).
+	RunTimeout time.Duration
+	// When set, the state of the run (histograms, error types and elapsed time) is saved to CheckpointFile every
+	// CheckpointInterval (DefaultCheckpointInterval when 0) and when the run is interrupted, including by SIGTERM.
+	// A run started with an existing CheckpointFile resumes from it: same ID and start time, only the remaining
+	// duration (or Exactly calls) is run and the results include the checkpointed calls. The file is removed once
+	// the run completes. The runner specific results (e.g. the HTTP return codes) are only checkpointed through
+	// the CheckpointHook, when set, and otherwise only cover the calls since the last resume.
+	CheckpointFile     string
+	CheckpointInterval time.Duration
+	// Target of the run (e.g. the URL), only used to check a checkpoint is of the same run before resuming it.
+	CheckpointTarget string
+	// Optional hook of the runner to checkpoint and resume its own results along with the run's.
+	CheckpointHook CheckpointHook `json:"-"`
+	// Use a stats.ShardedHistogram, with a shard per CPU that each thread records into, instead of a single
+	// stats.AtomicHistogram for the live histograms (see NewLiveHistogram): less contention with many threads.
+	ShardedHistogram bool
+	// Debug option to count, in RunnerResults.LeakedGoroutines, the goroutines started by the threads' calls
+	// which are still running once the threads are done (using pprof labels, so it has some overhead).
+	LeakDetection bool
 	// Unique 96 character ID used as reference to saved JSON file. Created during Normalize().
 	ID string
 	// Time the object got first normalized, used to generate the unique ID above.
@@ -241,6 +354,8 @@ type RunnerOptions struct {
 type RunnerResults struct {
 	RunType           string
 	Labels            string
+	Tags              map[string]string `json:",omitempty"` // Optional structured metadata, from RunnerOptions.
+	SourceRegion      string            `json:",omitempty"` // Optional region/country the run was sent from.
 	StartTime         time.Time
 	RequestedQPS      string
 	RequestedDuration string // String version of the requested duration or exact count
@@ -260,6 +375,20 @@ type RunnerResults struct {
 	AccessLoggerInfo        string
 	// Same as RunnerOptions ID:  Unique 96 character ID used as reference to saved JSON file. Created during Normalize().
 	ID string
+	// Durations of the warmup phase calls, if WarmupDuration was set.
+	WarmupHistogram *stats.HistogramData `json:",omitempty"`
+	// Count of the error cases by type, the details returned by Run (e.g. the http code or "timeout").
+	ErrorTypes map[string]int64 `json:",omitempty"`
+	// Number of calls, in qps mode, which didn't leave IdleThreshold idle before the next call (see RunnerOptions).
+	SlowRunnerCount int64 `json:",omitempty"`
+	// Longest call duration, including the calls not recorded in the histograms when sampling.
+	MaxRunnerLatency time.Duration
+	// Number of goroutines started by the threads which are still running after they are all done, when
+	// LeakDetection is set: typically Runnable implementations leaving goroutines behind (or connections'
+	// goroutines that remain until the clients are closed).
+	LeakedGoroutines int `json:",omitempty"`
+	// Number of calls abandoned after RunTimeout.
+	TimeoutCount int64 `json:",omitempty"`
 	// If the run doesn't even start because of for instance an invalid host name, this will be set (all omitted on success)
 	jrpc.ServerReply
 }
@@ -276,6 +405,57 @@ func (r *RunnerResults) Result() *RunnerResults {
 	return r
 }
 
+// String implements fmt.Stringer using Summary().
+func (r RunnerResults) String() string {
+	return r.Summary()
+}
+
+// ms formats a duration in seconds as milliseconds.
+func ms(v float64) string {
+	return fmt.Sprintf("%.3gms", 1000.*v)
+}
+
+// Summary returns a multi-line human readable summary of the results: actual qps, average and percentiles.
+func (r RunnerResults) Summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s run %s", r.RunType, r.ID)
+	if r.Labels != "" {
+		fmt.Fprintf(&b, " (%s)", r.Labels)
+	}
+	if r.Error {
+		fmt.Fprintf(&b, " failed: %s %s", r.Message, r.Exception)
+	}
+	fmt.Fprintf(&b, "\nRequested %s qps for %s with %d thread(s)\n", r.RequestedQPS, r.RequestedDuration, r.NumThreads)
+	h := r.DurationHistogram
+	if h == nil {
+		return b.String()
+	}
+	errors := int64(0)
+	if r.ErrorsDurationHistogram != nil {
+		errors = r.ErrorsDurationHistogram.Count
+	}
+	fmt.Fprintf(&b, "Actual qps %.5g over %v : %d calls, %d errors\n", r.ActualQPS, r.ActualDuration, h.Count, errors)
+	fmt.Fprintf(&b, "Latency avg %s +/- %s min %s max %s", ms(h.Avg), ms(h.StdDev), ms(h.Min), ms(h.Max))
+	for _, p := range h.Percentiles {
+		fmt.Fprintf(&b, "\n# target %g%% %s", p.Percentile, ms(p.Value))
+	}
+	return b.String()
+}
+
+// OneLineSummary returns a single line summary, for CI logs, like "QPS=1234.5 p50=1.2ms p99=45.6ms errors=0".
+func (r RunnerResults) OneLineSummary() string {
+	var p50, p99 float64
+	if h := r.DurationHistogram; h != nil && h.Count > 0 {
+		p50 = h.CalcPercentile(50)
+		p99 = h.CalcPercentile(99)
+	}
+	errors := int64(0)
+	if r.ErrorsDurationHistogram != nil {
+		errors = r.ErrorsDurationHistogram.Count
+	}
+	return fmt.Sprintf("QPS=%.1f p50=%s p99=%s errors=%d", r.ActualQPS, ms(p50), ms(p99), errors)
+}
+
 // PeriodicRunner let's you exercise the Function at the given QPS and collect
 // statistics and histogram about the run.
 type PeriodicRunner interface { //nolint:revive
@@ -289,6 +469,47 @@ type PeriodicRunner interface { //nolint:revive
 // Unexposed implementation details for PeriodicRunner.
 type periodicRunner struct {
 	RunnerOptions
+	warmup bool          // true for the warmup phase (copy of) the runner
+	calls  *atomic.Int64 // calls completed across all threads, only set for AutoScale
+	// Count of the failed calls by details (error type), not set for the warmup.
+	errorTypes *errorTypesCounter
+	// Slow calls count and max latency across all the threads, not set for the warmup.
+	slowCalls *slowCallsCounter
+	// Calls abandoned after RunTimeout, across all the threads.
+	timeouts atomic.Int64
+	// Value of the leakLabel pprof label of the threads when LeakDetection is set.
+	leakID string
+	// Options the CheckpointFile must have been saved with to be resumed.
+	checkpointOpts CheckpointOptions
+}
+
+// errorTypesCounter counts the errors by type across all the threads.
+type errorTypesCounter struct {
+	mutex  sync.Mutex
+	counts map[string]int64
+}
+
+func (e *errorTypesCounter) add(details string, n int64) {
+	if details == "" {
+		details = "unknown"
+	}
+	e.mutex.Lock()
+	e.counts[details] += n
+	e.mutex.Unlock()
+}
+
+// slowCallsCounter aggregates the threads' slow calls (see RunnerOptions.IdleThreshold) and max latency.
+type slowCallsCounter struct {
+	mutex      sync.Mutex
+	count      int64
+	maxLatency time.Duration
+}
+
+func (s *slowCallsCounter) add(count int64, maxLatency time.Duration) {
+	s.mutex.Lock()
+	s.count += count
+	s.maxLatency = max(s.maxLatency, maxLatency)
+	s.mutex.Unlock()
 }
 
 var (
@@ -297,6 +518,15 @@ var (
 	gAbortMutex      sync.Mutex
 )
 
+// NewLiveHistogram returns a new histogram for the LiveHistogram or LiveErrorHistogram options, sharded when
+// ShardedHistogram is set. Normalize() must have been called (for the Resolution).
+func (r *RunnerOptions) NewLiveHistogram() stats.LiveHistogram {
+	if r.ShardedHistogram {
+		return stats.NewShardedHistogram(r.Offset.Seconds(), r.Resolution, 0)
+	}
+	return stats.NewAtomicHistogram(r.Offset.Seconds(), r.Resolution)
+}
+
 // Normalize initializes and normalizes the runner options. In particular it sets
 // up the channel that can be used to interrupt the run later.
 // Once Normalize is called, if Run() is skipped, Abort() must be called to
@@ -327,8 +557,11 @@ func (r *RunnerOptions) Normalize() {
 	if r.Duration == 0 {
 		r.Duration = DefaultRunnerOptions.Duration
 	}
+	if r.SampleRate < 1 {
+		r.SampleRate = 1
+	}
 	if r.Runners == nil {
-		r.Runners = make([]Runnable, r.NumThreads)
+		r.Runners = make([]Runnable, r.MaxRunners())
 	}
 	if r.ID == "" {
 		r.GenID()
@@ -394,7 +627,7 @@ func (r *RunnerOptions) Abort() {
 
 // internal version, returning the concrete implementation. logical std::move.
 func newPeriodicRunner(opts *RunnerOptions) *periodicRunner {
-	r := &periodicRunner{*opts} // by default just copy the input params
+	r := &periodicRunner{RunnerOptions: *opts} // by default just copy the input params
 	opts.ReleaseRunners()
 	opts.Stop = nil
 	opts.genTime = nil
@@ -446,8 +679,12 @@ func (r *periodicRunner) runQPSSetup(extra string) (requestedDuration string, re
 		log.Warnf("Lowering number of threads - total call %d -> lowering from %d to %d threads", numCalls, r.NumThreads, newN)
 		r.NumThreads = newN
 	}
-	numCalls /= int64(r.NumThreads)
-	totalCalls := numCalls * int64(r.NumThreads)
+	divider := int64(r.NumThreads)
+	if !useExactly {
+		divider = int64(r.rateLimitedThreads()) // max speed threads (ThreadPriority 0) don't share the qps
+	}
+	numCalls /= divider
+	totalCalls := numCalls * divider
 	if useExactly {
 		leftOver = r.Exactly - totalCalls
 		if log.Log(log.Warning) {
@@ -497,6 +734,13 @@ func (r *periodicRunner) runMaxQPSSetup(extra string) (requestedDuration string,
 func (r *periodicRunner) Run() RunnerResults {
 	aborter := r.Stop
 	runnerChan, shouldAbort := aborter.RecordStart()
+	var resumed *Checkpoint
+	var complete bool // resumed checkpoint already has all the calls.
+	var checkpointErr error
+	origExactly := r.Exactly
+	if r.CheckpointFile != "" && !shouldAbort {
+		resumed, complete, checkpointErr = r.resumeCheckpoint()
+	}
 	useQPS := (r.QPS > 0)
 	// r.Exactly is > 0 if we use Exactly iterations instead of the duration.
 	useExactly := (r.Exactly > 0)
@@ -508,12 +752,20 @@ func (r *periodicRunner) Run() RunnerResults {
 	if r.AccessLogger != nil {
 		extra = " with access logger " + r.AccessLogger.Info()
 	}
+	autoScale := r.AutoScale && useQPS && !useExactly && r.MaxThreads > r.NumThreads
+	if autoScale {
+		extra += fmt.Sprintf(" autoscaling up to %d threads", r.MaxThreads)
+	}
 	requestedQPS := "max"
 	if useQPS {
 		requestedDuration, requestedQPS, numCalls, leftOver = r.runQPSSetup(extra)
 	} else {
 		requestedDuration, numCalls, leftOver = r.runMaxQPSSetup(extra)
 	}
+	r.Exactly = origExactly // only the remaining calls were setup when resuming.
+	if resumed != nil {
+		requestedDuration = resumed.RequestedDuration
+	}
 	runnersLen := len(r.Runners)
 	if runnersLen == 0 {
 		log.Fatalf("Empty runners array !")
@@ -522,59 +774,131 @@ func (r *periodicRunner) Run() RunnerResults {
 		r.MakeRunners(r.Runners[0])
 		log.Warnf("Context array was of %d len, replacing with %d clone of first one", runnersLen, len(r.Runners))
 	}
+	if r.RunTimeout > 0 && !concurrentSafe(r.Runners[:r.MaxRunners()]) {
+		log.Errf("Ignoring run timeout %v: the runners don't support concurrent calls", r.RunTimeout)
+		r.RunTimeout = 0
+	}
 	start := time.Now()
+	r.errorTypes = &errorTypesCounter{counts: make(map[string]int64)}
+	r.slowCalls = &slowCallsCounter{}
 	// Histogram  and stats for Function duration - millisecond precision
-	functionDuration := stats.NewHistogram(r.Offset.Seconds(), r.Resolution)
-	errorsDuration := stats.NewHistogram(r.Offset.Seconds(), r.Resolution)
+	functionDuration := r.newDurationHistogram()
+	errorsDuration := r.newDurationHistogram()
 	// Histogram and stats for Sleep time (negative offset to capture <0 sleep in their own bucket):
 	sleepTime := stats.NewHistogram(-0.001, 0.001)
 	var loggerInfo string
 	if r.AccessLogger != nil {
 		loggerInfo = r.AccessLogger.Info()
 	}
-	if shouldAbort {
-		log.Warnf("Run requested to stop before even starting")
+	if shouldAbort || checkpointErr != nil {
+		reply := jrpc.NewErrorReply("Aborted before even starting", nil)
+		if checkpointErr != nil {
+			reply = jrpc.NewErrorReply("Not resuming the checkpoint of another run", checkpointErr)
+		} else {
+			log.Warnf("Run requested to stop before even starting")
+		}
 		aborter.Reset()
 		return RunnerResults{ // A bit ugly this is almost the same as the big init below in the normal not early abort case.
-			r.RunType, r.Labels, start, requestedQPS, requestedDuration,
+			r.RunType, r.Labels, r.Tags, "", start, requestedQPS, requestedDuration,
 			0, 0, r.NumThreads, version.Short(), functionDuration.Export().CalcPercentiles(r.Percentiles),
 			errorsDuration.Export().CalcPercentiles(r.Percentiles),
-			r.Exactly, r.Jitter, r.Uniform, r.NoCatchUp, r.RunID, loggerInfo, r.ID,
-			*jrpc.NewErrorReply("Aborted before even starting", nil),
+			r.Exactly, r.Jitter, r.Uniform, r.NoCatchUp, r.RunID, loggerInfo, r.ID, nil, nil, 0, 0, 0, 0,
+			*reply,
 		}
 	}
-	if r.NumThreads <= 1 {
+	if r.LeakDetection {
+		r.leakID = strconv.FormatInt(leakIDs.Add(1), 10)
+	}
+	var warmupHistogram *stats.HistogramData
+	if r.WarmupDuration > 0 && !complete {
+		warmupHistogram = r.runWarmup(runnerChan).Export().CalcPercentiles(r.Percentiles)
+		start = time.Now()
+	}
+	var checkpoint *Checkpoint
+	var checkpointDone chan struct{}
+	if r.CheckpointFile != "" {
+		checkpoint = r.setupCheckpoint(resumed, start, requestedDuration)
+		checkpointDone = make(chan struct{})
+		r.startCheckpoints(checkpointDone, checkpoint, start)
+	}
+	var rateDone chan struct{}
+	if r.LiveRate != nil || log.LogVerbose() {
+		rateDone = make(chan struct{})
+		r.startRate(rateDone)
+	}
+	numThreads := r.NumThreads // AutoScale may add more
+	switch {
+	case complete:
+		log.S(log.Info, "Checkpoint already has all the calls", log.Attr("run", r.RunID), log.Attr("calls", r.Exactly))
+	case r.NumThreads <= 1 && !autoScale:
 		log.LogVf("Running single threaded")
-		runOne(0, runnerChan, functionDuration, errorsDuration, sleepTime, numCalls+leftOver, start, r)
-	} else {
+		if r.leakID == "" {
+			runOne(0, runnerChan, functionDuration, errorsDuration, sleepTime, numCalls+leftOver, start, r)
+			break
+		}
+		// In its own goroutine as runOne sets the leak detection label, which would replace the caller's labels.
+		done := make(chan struct{})
+		go func() {
+			runOne(0, runnerChan, functionDuration, errorsDuration, sleepTime, numCalls+leftOver, start, r)
+			close(done)
+		}()
+		<-done
+	default:
 		var wg sync.WaitGroup
+		var mu sync.Mutex // for AutoScale starting threads while the others run
 		var fDs, eDs, sDs []*stats.Histogram
-		for t := range r.NumThreads {
+		startThread := func(t ThreadID, thisNumCalls int64, start time.Time, runner *periodicRunner) {
 			durP := functionDuration.Clone()
 			errP := errorsDuration.Clone()
 			sleepP := sleepTime.Clone()
+			mu.Lock()
 			fDs = append(fDs, durP)
 			eDs = append(eDs, errP)
 			sDs = append(sDs, sleepP)
+			mu.Unlock()
 			wg.Add(1)
+			go func() {
+				runOne(t, runnerChan, durP, errP, sleepP, thisNumCalls, start, runner)
+				wg.Done()
+			}()
+		}
+		if autoScale {
+			r.calls = &atomic.Int64{}
+			wg.Add(1) // before any thread starts so the monitor can add some until it's done.
+			go func() {
+				numThreads = r.autoScale(runnerChan, start, startThread)
+				wg.Done()
+			}()
+		}
+		for t := range r.NumThreads {
 			thisNumCalls := numCalls
 			if (leftOver > 0) && (t == 0) {
 				// The first thread gets to do the additional work
 				thisNumCalls += leftOver
 			}
-			go func(t ThreadID, durP, errP, sleepP *stats.Histogram) {
-				runOne(t, runnerChan, durP, errP, sleepP, thisNumCalls, start, r)
-				wg.Done()
-			}(ThreadID(t), durP, errP, sleepP)
+			startThread(ThreadID(t), thisNumCalls, start, r)
 		}
 		wg.Wait()
-		for t := range r.NumThreads {
+		for t := range fDs {
 			functionDuration.Transfer(fDs[t])
 			errorsDuration.Transfer(eDs[t])
 			sleepTime.Transfer(sDs[t])
 		}
 	}
 	elapsed := time.Since(start)
+	if checkpointDone != nil {
+		close(checkpointDone)
+	}
+	if rateDone != nil {
+		close(rateDone)
+	}
+	if resumed != nil {
+		functionDuration.AddData(resumed.DurationHistogram)
+		errorsDuration.AddData(resumed.ErrorsDurationHistogram)
+		elapsed += resumed.Elapsed
+		start = resumed.StartTime
+	}
+	leaked := r.leakedGoroutines()
 	actualQPS := float64(functionDuration.Count) / elapsed.Seconds()
 	if log.Log(log.Warning) {
 		_, _ = fmt.Fprintf(r.Out, "Ended after %v : %d calls. qps=%.5g\n", elapsed, functionDuration.Count, actualQPS)
@@ -602,13 +926,23 @@ func (r *periodicRunner) Run() RunnerResults {
 		requestedDuration += fmt.Sprintf(", interrupted after %d", actualCount)
 	}
 	result := RunnerResults{
-		r.RunType, r.Labels, start, requestedQPS, requestedDuration,
-		actualQPS, elapsed, r.NumThreads, version.Short(), functionDuration.Export().CalcPercentiles(r.Percentiles),
+		r.RunType, r.Labels, r.Tags, "", start, requestedQPS, requestedDuration,
+		actualQPS, elapsed, numThreads, version.Short(), functionDuration.Export().CalcPercentiles(r.Percentiles),
 		errorsDuration.Export().CalcPercentiles(r.Percentiles),
-		r.Exactly, r.Jitter, r.Uniform, r.NoCatchUp, r.RunID, loggerInfo, r.ID,
-		jrpc.ServerReply{Error: false},
+		r.Exactly, r.Jitter, r.Uniform, r.NoCatchUp, r.RunID, loggerInfo, r.ID, warmupHistogram, r.errorTypes.counts,
+		r.slowCalls.count, r.slowCalls.maxLatency, leaked, r.timeouts.Load(), jrpc.ServerReply{Error: false},
+	}
+	if result.TimeoutCount > 0 {
+		_, _ = fmt.Fprintf(r.Out, "WARNING %d calls were abandoned after the %v run timeout\n", result.TimeoutCount, r.RunTimeout)
+	}
+	if result.SlowRunnerCount > 0 {
+		_, _ = fmt.Fprintf(r.Out, "WARNING %d calls (%.2f%%) were too slow for the requested qps (max %v)\n",
+			result.SlowRunnerCount, 100.*float64(result.SlowRunnerCount)/float64(actualCount), result.MaxRunnerLatency)
 	}
 	if log.Log(log.Warning) {
+		if warmupHistogram != nil {
+			warmupHistogram.Print(r.Out, "Warmup Function Time")
+		}
 		result.DurationHistogram.Print(r.Out, "Aggregated Function Time")
 		result.ErrorsDurationHistogram.Print(r.Out, "Error cases")
 	} else {
@@ -618,18 +952,213 @@ func (r *periodicRunner) Run() RunnerResults {
 		}
 		errorsDuration.Counter.Print(r.Out, "Error cases")
 	}
+	printErrorTypes(r.Out, result.ErrorTypes)
+	interrupted := false
 	select {
-	case <-runnerChan: // nothing
+	case <-runnerChan:
 		log.LogVf("RUNNER aborter already closed")
+		interrupted = true
 	default:
 		log.LogVf("RUNNER aborter not already closed, closing")
 		r.Abort()
 	}
+	if checkpoint != nil {
+		r.endCheckpoint(interrupted, &result, checkpoint.RequestedDuration)
+	}
 	// Setup for reuse even if only unit tests are reusing runners
 	aborter.Reset()
 	return result
 }
 
+// startRate samples the LiveHistogram count, i.e. the calls of all the threads, into LiveRate every second
+// and logs the current qps in verbose mode, until done is closed.
+func (r *periodicRunner) startRate(done chan struct{}) {
+	if r.LiveHistogram == nil {
+		r.LiveHistogram = r.NewLiveHistogram()
+	}
+	if r.LiveRate == nil {
+		r.LiveRate = stats.NewRateTracker(0)
+	}
+	live, rate := r.LiveHistogram, r.LiveRate
+	rate.Sample(time.Now(), live.Count())
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				rate.Sample(now, live.Count())
+				log.S(log.Verbose, "Current qps", log.Attr("run", r.RunID), log.Attr("current_qps", rate.Rate(now)))
+			}
+		}
+	}()
+}
+
+// leakLabel is the pprof label set on the threads, and inherited by the goroutines they start,
+// when LeakDetection is set.
+const leakLabel = "fortio_run"
+
+// leakIDs makes the leakLabel values unique across runs.
+var leakIDs atomic.Int64
+
+// leakedGoroutines returns how many of the goroutines started by the threads' calls are still
+// running once they are all done, 0 when LeakDetection isn't set. Logs when some are left: the Runnable
+// may not exit cleanly, though connections goroutines (e.g. of the std client's pool) can also remain
+// until the clients are closed, thus the Info level.
+func (r *periodicRunner) leakedGoroutines() int {
+	if r.leakID == "" {
+		return 0
+	}
+	n := countLabeledGoroutines(leakLabel, r.leakID)
+	if n > 0 {
+		log.S(log.Info, "Goroutines left running after the run, the Runnable may be leaking them",
+			log.Attr("count", n), log.Attr("run", r.RunID))
+	}
+	return n
+}
+
+// countLabeledGoroutines returns the number of goroutines with the pprof label key set to value,
+// parsed from the text (debug=1) goroutine profile.
+func countLabeledGoroutines(key, value string) int {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		log.Errf("Unable to get the goroutine profile: %v", err)
+		return 0
+	}
+	label := fmt.Sprintf("%q:%q", key, value)
+	total, count := 0, 0
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if n, _, found := strings.Cut(line, " @ "); found {
+			count, _ = strconv.Atoi(n)
+		} else if strings.HasPrefix(line, "# labels: ") && strings.Contains(line, label) {
+			total += count
+		}
+	}
+	return total
+}
+
+// newDurationHistogram returns a new histogram for calls durations: offset and resolution
+// based or HDR when UseHDR is set.
+func (r *RunnerOptions) newDurationHistogram() *stats.Histogram {
+	if r.UseHDR {
+		return stats.NewHDRHistogram(stats.DefaultHDRLowest, stats.DefaultHDRHighest, stats.DefaultHDRSignificantFigures)
+	}
+	return stats.NewHistogram(r.Offset.Seconds(), r.Resolution)
+}
+
+// printErrorTypes prints the count of each error type, most frequent first.
+func printErrorTypes(out io.Writer, errorTypes map[string]int64) {
+	if len(errorTypes) == 0 {
+		return
+	}
+	types := slices.Collect(maps.Keys(errorTypes))
+	slices.SortFunc(types, func(a, b string) int {
+		if c := cmp.Compare(errorTypes[b], errorTypes[a]); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+	_, _ = fmt.Fprintf(out, "Error types:\n")
+	for _, t := range types {
+		_, _ = fmt.Fprintf(out, "%s : %d\n", t, errorTypes[t])
+	}
+}
+
+// runWarmup runs the warmup phase on all threads and returns the (merged) histogram of the calls duration.
+func (r *periodicRunner) runWarmup(runnerChan chan struct{}) *stats.Histogram {
+	w := &periodicRunner{RunnerOptions: r.RunnerOptions, warmup: true, leakID: r.leakID}
+	w.Duration = r.WarmupDuration
+	w.Exactly = 0
+	w.ThreadPriority = nil
+	if r.WarmupQPS != 0 {
+		w.QPS = r.WarmupQPS
+	}
+	var numCalls int64
+	if w.QPS > 0 {
+		numCalls = max(2, int64(w.QPS*w.Duration.Seconds())/int64(w.NumThreads))
+	} else {
+		w.QPS = -1
+	}
+	_, _ = fmt.Fprintf(r.Out, "Warming up for %v at %g qps with %d thread(s)\n", w.Duration, w.QPS, w.NumThreads)
+	warmupDuration := r.newDurationHistogram()
+	errorsDuration := r.newDurationHistogram()     // discarded
+	sleepTime := stats.NewHistogram(-0.001, 0.001) // discarded
+	start := time.Now()
+	var wg sync.WaitGroup
+	durs := make([]*stats.Histogram, w.NumThreads)
+	for t := range w.NumThreads {
+		durs[t] = warmupDuration.Clone()
+		wg.Add(1)
+		go func(t ThreadID, durP, errP, sleepP *stats.Histogram) {
+			runOne(t, runnerChan, durP, errP, sleepP, numCalls, start, w)
+			wg.Done()
+		}(ThreadID(t), durs[t], errorsDuration.Clone(), sleepTime.Clone())
+	}
+	wg.Wait()
+	for t := range w.NumThreads {
+		warmupDuration.Transfer(durs[t])
+	}
+	log.S(log.Info, "Warmup ended", log.Attr("run", r.RunID), log.Attr("elapsed", time.Since(start)),
+		log.Attr("calls", warmupDuration.Count))
+	return warmupDuration
+}
+
+// WarmupKey is the context key set (to true) during the warmup phase calls.
+type WarmupKey struct{}
+
+// IsWarmup returns true if the context passed to Run() is from the warmup phase.
+func IsWarmup(ctx context.Context) bool {
+	w, _ := ctx.Value(WarmupKey{}).(bool)
+	return w
+}
+
+// RunIDKey is the context key holding the RunID of the run for the Run() calls.
+type RunIDKey struct{}
+
+// GetRunID returns the RunID from the context passed to Run() (0 if not set).
+func GetRunID(ctx context.Context) int64 {
+	id, _ := ctx.Value(RunIDKey{}).(int64)
+	return id
+}
+
+// ThreadContext is the metadata of the current Run() call, see ThreadContextFromCtx.
+type ThreadContext struct {
+	ThreadID  ThreadID
+	Iteration int64     // 0 for the first call of the thread (in warmup or in the run proper, see IsWarmup)
+	RunID     int64     // same as GetRunID
+	StartTime time.Time // start time of this call
+}
+
+type threadContextKey struct{}
+
+// threadState is the value behind ThreadContextFromCtx, set once per thread in the context
+// and updated for each call.
+type threadState struct {
+	id        ThreadID
+	runID     int64
+	iteration atomic.Int64
+	start     atomic.Int64 // unix nanoseconds
+}
+
+// ThreadContextFromCtx returns the ThreadContext of the context passed to Run(), false if
+// the context isn't from a periodic runner. The context is shared by all the calls of the
+// thread so this is only valid during Run(): once the call returns (or is abandoned, see
+// RunTimeout), the Iteration and StartTime are the ones of the thread's next calls.
+func ThreadContextFromCtx(ctx context.Context) (ThreadContext, bool) {
+	ts, ok := ctx.Value(threadContextKey{}).(*threadState)
+	if !ok {
+		return ThreadContext{}, false
+	}
+	return ThreadContext{
+		ThreadID:  ts.id,
+		Iteration: ts.iteration.Load(),
+		RunID:     ts.runID,
+		StartTime: time.Unix(0, ts.start.Load()),
+	}, true
+}
+
 // AccessLoggerType is the possible formats of the access logger (ACCESS_JSON or ACCESS_INFLUX).
 type AccessLoggerType int
 
@@ -714,7 +1243,7 @@ func (a *fileAccessLogger) Start(ctx context.Context, threadID ThreadID, iter in
 }
 
 // Report logs a single request to a file.
-func (a *fileAccessLogger) Report(_ context.Context, thread ThreadID, iter int64, time time.Time,
+func (a *fileAccessLogger) Report(ctx context.Context, thread ThreadID, iter int64, time time.Time,
 	latency float64, status bool, details string,
 ) {
 	a.mu.Lock()
@@ -724,8 +1253,9 @@ func (a *fileAccessLogger) Report(_ context.Context, thread ThreadID, iter int64
 		fmt.Fprintf(a.file, "latency,thread=%d,ok=%t value=%f,details=%q %d\n",
 			thread, status, latency, details, time.UnixNano())
 	case AccessJSON:
-		fmt.Fprintf(a.file, "{\"latency\":%f,\"timestamp\":%d,\"thread\":%d,\"iter\":%d,\"ok\":%t,\"details\":%q}\n",
-			latency, time.UnixNano(), thread, iter, status, details)
+		fmt.Fprintf(a.file,
+			"{\"latency\":%f,\"timestamp\":%d,\"thread\":%d,\"iter\":%d,\"runid\":%d,\"ok\":%t,\"details\":%q}\n",
+			latency, time.UnixNano(), thread, iter, GetRunID(ctx), status, details)
 	}
 	a.mu.Unlock()
 }
@@ -735,6 +1265,41 @@ func (a *fileAccessLogger) Info() string {
 	return a.info
 }
 
+// runResult is the outcome of a Runnable's Run call.
+type runResult struct {
+	status  bool
+	details string
+}
+
+// runWithTimeout calls f.Run, in its own goroutine when RunTimeout is set so the call can be abandoned
+// if it doesn't complete within RunTimeout (see RunnerOptions). The abandoned call's ctx is canceled.
+func (r *periodicRunner) runWithTimeout(ctx context.Context, f Runnable, id ThreadID) (bool, string) {
+	if r.RunTimeout <= 0 {
+		return f.Run(ctx, id)
+	}
+	cctx, cancel := context.WithTimeout(ctx, r.RunTimeout)
+	defer cancel()
+	done := make(chan runResult, 1) // buffered so an abandoned call's goroutine can still complete.
+	go func() {
+		status, details := f.Run(cctx, id)
+		done <- runResult{status, details}
+	}()
+	select {
+	case res := <-done:
+		return res.status, res.details
+	case <-cctx.Done():
+		if ctx.Err() != nil {
+			// Aborted rather than timed out: the call was told to return, wait for it like without RunTimeout.
+			res := <-done
+			return res.status, res.details
+		}
+		r.timeouts.Add(1)
+		log.S(log.Verbose, "Call timed out, abandoning it", log.Attr("thread", id), log.Attr("run", r.RunID),
+			log.Attr("timeout", r.RunTimeout))
+		return false, "timeout"
+	}
+}
+
 // runOne runs in 1 go routine (or main one when -c 1 == single threaded mode).
 //
 //nolint:gocognit, gocyclo // we should try to simplify it though.
@@ -744,8 +1309,8 @@ func runOne(id ThreadID, runnerChan chan struct{}, funcTimes, errTimes, sleepTim
 	var i int64
 	endTime := start.Add(r.Duration)
 	tIDStr := fmt.Sprintf("T%03d", id)
-	perThreadQPS := r.QPS / float64(r.NumThreads)
-	useQPS := (perThreadQPS > 0)
+	perThreadQPS := r.QPS / float64(r.rateLimitedThreads())
+	useQPS := (perThreadQPS > 0) && r.threadPriority(id) != 0
 
 	hasDuration := (r.Duration > 0)
 	useExactly := (r.Exactly > 0)
@@ -765,8 +1330,64 @@ func runOne(id ThreadID, runnerChan chan struct{}, funcTimes, errTimes, sleepTim
 			// continue normal execution
 		}
 	}
-	ctx := context.Background()
+	// Canceled when the run is aborted, so the calls in progress can stop early.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := ctx.Done() // not ctx itself, which gets reassigned below
+	go func() {
+		select {
+		case <-runnerChan:
+			cancel()
+		case <-done:
+		}
+	}()
+	if r.leakID != "" {
+		// Set after starting the watcher above, which exits asynchronously, so that only the goroutines started
+		// by the calls inherit the label. Always running in its own goroutine when leakID is set.
+		pprof.SetGoroutineLabels(pprof.WithLabels(context.Background(), pprof.Labels(leakLabel, r.leakID)))
+	}
 	ctx = context.WithValue(ctx, ThreadID(0), id)
+	ctx = context.WithValue(ctx, RunIDKey{}, r.RunID)
+	ts := &threadState{id: id, runID: r.RunID}
+	ctx = context.WithValue(ctx, threadContextKey{}, ts)
+	live, liveErrors := r.LiveHistogram, r.LiveErrorHistogram
+	if r.warmup {
+		ctx = context.WithValue(ctx, WarmupKey{}, true)
+		tIDStr = "W" + tIDStr
+		live = nil
+	}
+	// Slow calls detection, see RunnerOptions.IdleThreshold.
+	var slowThreshold, maxLatency time.Duration
+	var calls, slowCalls int64
+	slowWarned := false
+	// Sampling (see RunnerOptions.SampleRate): each recorded call counts for the ones since the previous
+	// recorded one, the last call of the thread is always recorded, so the count is exact.
+	var unsampled int
+	var last runResult
+	var lastLatency float64
+	record := func(latency float64, status bool, details string, n int) {
+		funcTimes.RecordN(latency, n)
+		if !status {
+			errTimes.RecordN(latency, n)
+			if r.errorTypes != nil {
+				r.errorTypes.add(details, int64(n))
+			}
+		}
+		if live != nil {
+			live.RecordNFrom(int(id), latency, n)
+			if !status && liveErrors != nil {
+				liveErrors.RecordNFrom(int(id), latency, n)
+			}
+		}
+	}
+	if useQPS {
+		interval := time.Duration(float64(time.Second) / perThreadQPS)
+		idle := r.IdleThreshold
+		if idle <= 0 {
+			idle = interval / 10
+		}
+		slowThreshold = interval - idle
+	}
 	var ctx2 context.Context
 MainLoop:
 	for {
@@ -783,18 +1404,37 @@ MainLoop:
 				break
 			}
 		}
-		ctx2 = ctx //nolint:fatcontext // only potentially mutate the original if there is an access logger (yes in the loop).
+		ts.iteration.Store(i)
+		ts.start.Store(fStart.UnixNano())
+		ctx2 = ctx
 		if r.AccessLogger != nil {
-			ctx2 = r.AccessLogger.Start(ctx, id, i, fStart)
+			ctx2 = r.AccessLogger.Start(ctx2, id, i, fStart) //nolint:fatcontext // derived from ctx, not accumulating.
+		}
+		status, details := r.runWithTimeout(ctx2, f, id)
+		fDuration := time.Since(fStart)
+		latency := fDuration.Seconds()
+		calls++
+		maxLatency = max(maxLatency, fDuration)
+		if useQPS && fDuration > slowThreshold {
+			slowCalls++
+			if !slowWarned && calls >= 20 && 20*slowCalls > calls {
+				slowWarned = true
+				log.S(log.Warning, "More than 5% of the calls are too slow for the requested qps",
+					log.Attr("thread", id), log.Attr("run", r.RunID), log.Attr("slow_calls", slowCalls),
+					log.Attr("calls", calls), log.Attr("threshold", slowThreshold))
+			}
 		}
-		status, details := f.Run(ctx2, id)
-		latency := time.Since(fStart).Seconds()
 		if r.AccessLogger != nil {
 			r.AccessLogger.Report(ctx2, id, i, fStart, latency, status, details)
 		}
-		funcTimes.Record(latency)
-		if !status {
-			errTimes.Record(latency)
+		if unsampled++; unsampled >= r.SampleRate {
+			record(latency, status, details, unsampled)
+			unsampled = 0
+		} else {
+			last, lastLatency = runResult{status, details}, latency
+		}
+		if r.calls != nil {
+			r.calls.Add(1)
 		}
 		// if using QPS / pre calc expected call # mode:
 		if useQPS { //nolint:nestif
@@ -846,6 +1486,12 @@ MainLoop:
 			}
 		}
 	}
+	if unsampled > 0 {
+		record(lastLatency, last.status, last.details, unsampled)
+	}
+	if r.slowCalls != nil {
+		r.slowCalls.add(slowCalls, maxLatency)
+	}
 	elapsed := time.Since(start)
 	actualQPS := float64(i) / elapsed.Seconds()
 	log.Infof("%s ended after %v : %d calls. qps=%g", tIDStr, elapsed, i, actualQPS)
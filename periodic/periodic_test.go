@@ -16,15 +16,23 @@ package periodic
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"fmt"
+	"io"
 	"math"
 	"os"
 	"path"
+	"reflect"
+	"regexp"
+	"runtime/pprof"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"fortio.org/fortio/stats"
 	"fortio.org/log"
 )
 
@@ -126,6 +134,113 @@ func TestStart(t *testing.T) {
 	r.Options().ReleaseRunners()
 }
 
+// errorTypesCount fails 2 out of 3 calls, with "timeout" or empty details.
+type errorTypesCount struct {
+	count atomic.Int64
+}
+
+func (c *errorTypesCount) Run(context.Context, ThreadID) (bool, string) {
+	switch c.count.Add(1) % 3 {
+	case 1:
+		return false, "timeout"
+	case 2:
+		return false, ""
+	default:
+		return true, "ok details aren't counted"
+	}
+}
+
+func TestErrorTypes(t *testing.T) {
+	c := errorTypesCount{}
+	o := RunnerOptions{
+		QPS:        -1,
+		NumThreads: 3,
+		Exactly:    30,
+	}
+	r := NewPeriodicRunner(&o)
+	r.Options().MakeRunners(&c)
+	res := r.Run()
+	r.Options().ReleaseRunners()
+	expected := map[string]int64{"timeout": 10, "unknown": 10}
+	if !reflect.DeepEqual(res.ErrorTypes, expected) {
+		t.Errorf("Unexpected error types %v, expected %v", res.ErrorTypes, expected)
+	}
+	if res.ErrorsDurationHistogram.Count != 20 {
+		t.Errorf("Unexpected error count %d", res.ErrorsDurationHistogram.Count)
+	}
+}
+
+type threadContextRecorder struct {
+	sync.Mutex
+	calls map[ThreadID][]ThreadContext
+}
+
+func (c *threadContextRecorder) Run(ctx context.Context, id ThreadID) (bool, string) {
+	tc, ok := ThreadContextFromCtx(ctx)
+	if !ok || tc.ThreadID != id {
+		return false, "bad thread context"
+	}
+	c.Lock()
+	c.calls[id] = append(c.calls[id], tc)
+	c.Unlock()
+	return true, ""
+}
+
+func TestThreadContext(t *testing.T) {
+	if _, ok := ThreadContextFromCtx(context.Background()); ok {
+		t.Errorf("Unexpected thread context in background context")
+	}
+	c := threadContextRecorder{calls: make(map[ThreadID][]ThreadContext)}
+	o := RunnerOptions{
+		QPS:        -1,
+		NumThreads: 2,
+		Exactly:    10,
+		RunID:      42,
+	}
+	r := NewPeriodicRunner(&o)
+	r.Options().MakeRunners(&c)
+	res := r.Run()
+	r.Options().ReleaseRunners()
+	if res.ErrorsDurationHistogram.Count != 0 || len(c.calls) != 2 {
+		t.Fatalf("Unexpected errors %d or threads %d", res.ErrorsDurationHistogram.Count, len(c.calls))
+	}
+	for id, calls := range c.calls {
+		if len(calls) != 5 {
+			t.Errorf("Thread %d: unexpected %d calls", id, len(calls))
+		}
+		for i, tc := range calls {
+			if tc.Iteration != int64(i) || tc.RunID != 42 || tc.StartTime.Before(res.StartTime) ||
+				(i > 0 && tc.StartTime.Before(calls[i-1].StartTime)) {
+				t.Errorf("Thread %d: unexpected context %+v for call %d", id, tc, i)
+			}
+		}
+	}
+}
+
+func TestUseHDR(t *testing.T) {
+	var count int64
+	var lock sync.Mutex
+	c := TestCount{&count, &lock}
+	o := RunnerOptions{
+		QPS:        -1,
+		NumThreads: 2,
+		Exactly:    4,
+		UseHDR:     true,
+	}
+	r := NewPeriodicRunner(&o)
+	r.Options().MakeRunners(&c)
+	res := r.Run()
+	r.Options().ReleaseRunners()
+	// ~100ms calls, with 1% precision instead of the 1ms resolution buckets:
+	h := res.DurationHistogram
+	if h.Count != 4 || len(h.Data) == 0 {
+		t.Fatalf("Unexpected histogram %+v", h)
+	}
+	if last := h.Data[len(h.Data)-1]; last.End-last.Start > 0.002 {
+		t.Errorf("Unexpected HDR bucket width for %+v", last)
+	}
+}
+
 func TestStartMaxQps(t *testing.T) {
 	var count int64
 	var lock sync.Mutex
@@ -231,6 +346,242 @@ func TestExactlyMaxQps(t *testing.T) {
 	r.Options().ReleaseRunners()
 }
 
+func TestSampleRate(t *testing.T) {
+	expected := int64(400)
+	o := RunnerOptions{
+		QPS:        -1, // max qps
+		NumThreads: 4,
+		Exactly:    expected, // 100 per thread, 10 recorded each
+		SampleRate: 10,
+	}
+	r := NewPeriodicRunner(&o)
+	r.Options().MakeRunners(&Noop{})
+	res := r.Run()
+	actual := res.DurationHistogram.Count
+	if actual != expected {
+		t.Errorf("Sampled count %d instead of %d", actual, expected)
+	}
+	sum := int64(0)
+	for _, b := range res.DurationHistogram.Data {
+		if b.Count%10 != 0 {
+			t.Errorf("Sampled bucket count %d isn't a multiple of the sample rate", b.Count)
+		}
+		sum += b.Count
+	}
+	if sum != expected {
+		t.Errorf("Sampled buckets sum %d instead of %d", sum, expected)
+	}
+	r.Options().ReleaseRunners()
+	// Not a multiple of the sample rate: the last partial sample of each thread is still counted exactly.
+	expected = 403
+	o = RunnerOptions{
+		QPS:        -1,
+		NumThreads: 4,
+		Exactly:    expected,
+		SampleRate: 10,
+	}
+	r = NewPeriodicRunner(&o)
+	r.Options().MakeRunners(&Noop{})
+	res = r.Run()
+	if actual = res.DurationHistogram.Count; actual != expected {
+		t.Errorf("Sampled count %d instead of %d", actual, expected)
+	}
+	r.Options().ReleaseRunners()
+}
+
+func TestAutoScale(t *testing.T) {
+	prev := autoScaleInterval
+	autoScaleInterval = 500 * time.Millisecond
+	defer func() { autoScaleInterval = prev }()
+	var count int64
+	var lock sync.Mutex
+	c := TestCount{&count, &lock} // 100ms per call so 10 qps max per thread
+	o := RunnerOptions{
+		QPS:        60,
+		NumThreads: 2,
+		Duration:   1500 * time.Millisecond,
+		AutoScale:  true,
+		MaxThreads: 8,
+	}
+	r := NewPeriodicRunner(&o)
+	r.Options().MakeRunners(&c)
+	if len(r.Options().Runners) != 8 {
+		t.Errorf("Expected 8 runners for AutoScale, got %d", len(r.Options().Runners))
+	}
+	res := r.Run()
+	if res.NumThreads <= 2 || res.NumThreads > 8 {
+		t.Errorf("Expected AutoScale to add threads (up to 8), got %d", res.NumThreads)
+	}
+	// 2 threads alone would do at most 2*10*1.5 = 30 calls
+	if res.DurationHistogram.Count <= 32 {
+		t.Errorf("Expected more calls with AutoScale, got %d", res.DurationHistogram.Count)
+	}
+	r.Options().ReleaseRunners()
+	// Target reachable: no scaling
+	o = RunnerOptions{
+		QPS:        100,
+		NumThreads: 2,
+		Duration:   1200 * time.Millisecond,
+		AutoScale:  true,
+		MaxThreads: 8,
+	}
+	r = NewPeriodicRunner(&o)
+	r.Options().MakeRunners(&Noop{})
+	res = r.Run()
+	if res.NumThreads != 2 {
+		t.Errorf("Expected no thread added when the target qps is reached, got %d", res.NumThreads)
+	}
+	r.Options().ReleaseRunners()
+}
+
+type perThreadCount struct {
+	sync.Mutex
+	counts map[ThreadID]int64
+}
+
+func (c *perThreadCount) Run(_ context.Context, id ThreadID) (bool, string) {
+	c.Lock()
+	c.counts[id]++
+	c.Unlock()
+	time.Sleep(time.Millisecond)
+	return true, ""
+}
+
+func TestThreadPriority(t *testing.T) {
+	c := perThreadCount{counts: make(map[ThreadID]int64)}
+	o := RunnerOptions{
+		QPS:            20,
+		NumThreads:     3,
+		Duration:       1 * time.Second,
+		ThreadPriority: []int{0}, // first thread at max speed, the other 2 share the 20 qps
+	}
+	r := NewPeriodicRunner(&o)
+	r.Options().MakeRunners(&c)
+	res := r.Run()
+	r.Options().ReleaseRunners()
+	t.Logf("Per thread counts: %v", c.counts)
+	if c.counts[0] < 100 {
+		t.Errorf("Expected max speed for thread 0, got %d calls", c.counts[0])
+	}
+	for id := ThreadID(1); id < 3; id++ {
+		if c.counts[id] < 8 || c.counts[id] > 11 {
+			t.Errorf("Expected ~10 calls for rate limited thread %d, got %d", id, c.counts[id])
+		}
+	}
+	if res.DurationHistogram.Count != c.counts[0]+c.counts[1]+c.counts[2] {
+		t.Errorf("Mismatch between histogram count %d and calls %v", res.DurationHistogram.Count, c.counts)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	o := RunnerOptions{
+		QPS:        -1, // max qps
+		NumThreads: 2,
+		Exactly:    100,
+		Labels:     "summary test",
+		RunType:    "Noop",
+	}
+	r := NewPeriodicRunner(&o)
+	r.Options().MakeRunners(&Noop{})
+	res := r.Run()
+	r.Options().ReleaseRunners()
+	summary := res.Summary()
+	t.Logf("Summary:\n%s", summary)
+	for _, s := range []string{"Noop run ", "(summary test)", "Requested max qps for exactly 100 calls with 2 thread(s)",
+		": 100 calls, 0 errors", "Latency avg ", "# target 90% "} {
+		if !strings.Contains(summary, s) {
+			t.Errorf("Summary missing %q", s)
+		}
+	}
+	if s := fmt.Sprint(res); s != summary {
+		t.Errorf("String() %q != Summary() %q", s, summary)
+	}
+	line := res.OneLineSummary()
+	if !regexp.MustCompile(`^QPS=[0-9.]+ p50=[0-9.e+-]+ms p99=[0-9.e+-]+ms errors=0$`).MatchString(line) {
+		t.Errorf("Unexpected one line summary %q", line)
+	}
+	empty := RunnerResults{}
+	if s := empty.OneLineSummary(); s != "QPS=0.0 p50=0ms p99=0ms errors=0" {
+		t.Errorf("Unexpected empty one line summary %q", s)
+	}
+}
+
+type warmupCount struct {
+	sync.Mutex
+	warmup int64
+	main   int64
+}
+
+func (c *warmupCount) Run(ctx context.Context, _ ThreadID) (bool, string) {
+	c.Lock()
+	if IsWarmup(ctx) {
+		c.warmup++
+	} else {
+		c.main++
+	}
+	c.Unlock()
+	return true, ""
+}
+
+func TestWarmup(t *testing.T) {
+	c := warmupCount{}
+	o := RunnerOptions{
+		QPS:            -1,
+		NumThreads:     2,
+		Exactly:        10,
+		WarmupDuration: 500 * time.Millisecond,
+		WarmupQPS:      20,
+	}
+	r := NewPeriodicRunner(&o)
+	r.Options().MakeRunners(&c)
+	res := r.Run()
+	if c.main != 10 || res.DurationHistogram.Count != 10 {
+		t.Errorf("Main phase should be exactly 10 calls, got %d / %d", c.main, res.DurationHistogram.Count)
+	}
+	// 20 qps for 0.5s: 5 per thread.
+	if c.warmup != 10 {
+		t.Errorf("Unexpected warmup calls %d", c.warmup)
+	}
+	if res.WarmupHistogram == nil || res.WarmupHistogram.Count != c.warmup {
+		t.Errorf("Unexpected warmup histogram %+v vs %d calls", res.WarmupHistogram, c.warmup)
+	}
+	r.Options().ReleaseRunners()
+	// No warmup: nil histogram
+	o = RunnerOptions{QPS: -1, NumThreads: 1, Exactly: 5}
+	r = NewPeriodicRunner(&o)
+	r.Options().MakeRunners(&c)
+	res = r.Run()
+	if res.WarmupHistogram != nil {
+		t.Errorf("Unexpected warmup histogram %+v", res.WarmupHistogram)
+	}
+	r.Options().ReleaseRunners()
+}
+
+func benchmarkSampleRate(b *testing.B, sampleRate int) {
+	log.SetLogLevel(log.Error)
+	for n := 0; n < b.N; n++ {
+		o := RunnerOptions{
+			QPS:        -1,
+			NumThreads: 4,
+			Exactly:    1000000,
+			SampleRate: sampleRate,
+			Out:        io.Discard,
+		}
+		r := NewPeriodicRunner(&o)
+		r.Options().MakeRunners(&Noop{})
+		r.Run()
+		r.Options().ReleaseRunners()
+	}
+}
+
+func BenchmarkNoSampling(b *testing.B) {
+	benchmarkSampleRate(b, 1)
+}
+
+func BenchmarkSampling100(b *testing.B) {
+	benchmarkSampleRate(b, 100)
+}
+
 type testAccessLogger struct {
 	sync.Mutex
 	last    int64
@@ -330,6 +681,7 @@ func TestAccessLogFile(t *testing.T) {
 		QPS:        -1, // max qps
 		NumThreads: 4,
 		Exactly:    expected,
+		RunID:      42,
 	}
 
 	for _, format := range []string{"json", "influx"} {
@@ -371,6 +723,9 @@ func TestAccessLogFile(t *testing.T) {
 			if strings.Contains(line, "false") {
 				linesNotOk++
 			}
+			if format == "json" && !strings.Contains(line, `"runid":42,`) {
+				t.Errorf("missing runid in json access log line %q", line)
+			}
 			lineCount++
 		}
 		if lineCount != int(expected) {
@@ -541,6 +896,55 @@ func TestSleepFallingBehind(t *testing.T) {
 	}
 }
 
+func TestSlowRunners(t *testing.T) {
+	var count int64
+	var lock sync.Mutex
+	c := TestCount{&count, &lock} // 100ms per call
+	o := RunnerOptions{
+		QPS:        40, // 20 qps per thread: 50ms interval
+		NumThreads: 2,
+		Exactly:    6,
+	}
+	r := NewPeriodicRunner(&o)
+	r.Options().MakeRunners(&c)
+	res := r.Run()
+	r.Options().ReleaseRunners()
+	if res.SlowRunnerCount != 6 {
+		t.Errorf("Expected all 6 calls to be slow, got %d", res.SlowRunnerCount)
+	}
+	if res.MaxRunnerLatency < 100*time.Millisecond || res.MaxRunnerLatency > 200*time.Millisecond {
+		t.Errorf("Unexpected max latency %v", res.MaxRunnerLatency)
+	}
+	// 100ms calls leave 100ms idle out of their 200ms interval: only slow with a bigger idle threshold.
+	for _, tst := range []struct {
+		idle     time.Duration
+		expected int64
+	}{{0, 0}, {120 * time.Millisecond, 4}} {
+		o = RunnerOptions{
+			QPS:           10, // 5 qps per thread: 200ms interval
+			NumThreads:    2,
+			Exactly:       4,
+			IdleThreshold: tst.idle,
+		}
+		r = NewPeriodicRunner(&o)
+		r.Options().MakeRunners(&c)
+		res = r.Run()
+		r.Options().ReleaseRunners()
+		if res.SlowRunnerCount != tst.expected {
+			t.Errorf("Expected %d slow calls for idle threshold %v, got %d", tst.expected, tst.idle, res.SlowRunnerCount)
+		}
+	}
+	// Max speed runs don't have an interval.
+	o = RunnerOptions{QPS: -1, NumThreads: 1, Exactly: 2}
+	r = NewPeriodicRunner(&o)
+	r.Options().MakeRunners(&c)
+	res = r.Run()
+	r.Options().ReleaseRunners()
+	if res.SlowRunnerCount != 0 || res.MaxRunnerLatency < 100*time.Millisecond {
+		t.Errorf("Expected no slow calls and a max latency for max qps, got %d %v", res.SlowRunnerCount, res.MaxRunnerLatency)
+	}
+}
+
 func Test2Watchers(t *testing.T) {
 	// Wait for previous test to cleanup watchers
 	time.Sleep(200 * time.Millisecond)
@@ -629,6 +1033,133 @@ func TestEarlyAbort(t *testing.T) {
 	}
 }
 
+// blockingRunnable calls block until the context is canceled.
+type blockingRunnable struct {
+	canceled atomic.Int64
+}
+
+func (b *blockingRunnable) Run(ctx context.Context, _ ThreadID) (bool, string) {
+	select {
+	case <-ctx.Done():
+		b.canceled.Add(1)
+		return false, "canceled"
+	case <-time.After(10 * time.Second):
+		return true, ""
+	}
+}
+
+func TestAbortCancelsContext(t *testing.T) {
+	var b blockingRunnable
+	o := RunnerOptions{
+		QPS:        -1,
+		NumThreads: 3,
+		Duration:   20 * time.Second,
+	}
+	o.Normalize()
+	aborter := o.Stop
+	r := NewPeriodicRunner(&o)
+	r.Options().MakeRunners(&b)
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		aborter.Abort(false)
+	}()
+	start := time.Now()
+	res := r.Run()
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Run took %v despite the abort", elapsed)
+	}
+	if n := b.canceled.Load(); n != 3 {
+		t.Errorf("Expected the 3 calls in progress to be canceled, got %d", n)
+	}
+	if res.ErrorsDurationHistogram.Count != 3 {
+		t.Errorf("Expected 3 errors, got %d", res.ErrorsDurationHistogram.Count)
+	}
+}
+
+// leakingRunnable calls leave a goroutine blocked until done is closed.
+type leakingRunnable struct {
+	done chan struct{}
+}
+
+func (l *leakingRunnable) Run(_ context.Context, _ ThreadID) (bool, string) {
+	go func() {
+		<-l.done
+	}()
+	return true, ""
+}
+
+func TestLeakedGoroutines(t *testing.T) {
+	l := leakingRunnable{done: make(chan struct{})}
+	defer close(l.done)
+	o := RunnerOptions{
+		QPS:           -1,
+		NumThreads:    2,
+		Exactly:       20,
+		LeakDetection: true,
+	}
+	r := NewPeriodicRunner(&o)
+	r.Options().MakeRunners(&l)
+	res := r.Run()
+	if res.LeakedGoroutines != 20 {
+		t.Errorf("Expected 20 leaked goroutines, got %d", res.LeakedGoroutines)
+	}
+	// Opt-in debug option:
+	o = RunnerOptions{
+		QPS:        -1,
+		NumThreads: 2,
+		Exactly:    20,
+	}
+	r = NewPeriodicRunner(&o)
+	r.Options().MakeRunners(&l)
+	res = r.Run()
+	if res.LeakedGoroutines != 0 {
+		t.Errorf("Expected no leak detection without LeakDetection, got %d", res.LeakedGoroutines)
+	}
+	var count int64
+	var lock sync.Mutex
+	c := TestCount{&count, &lock}
+	o = RunnerOptions{
+		QPS:           -1,
+		NumThreads:    2,
+		Exactly:       4,
+		LeakDetection: true,
+	}
+	r = NewPeriodicRunner(&o)
+	r.Options().MakeRunners(&c)
+	res = r.Run()
+	if res.LeakedGoroutines != 0 {
+		t.Errorf("Expected no leaked goroutines, got %d", res.LeakedGoroutines)
+	}
+	// Single threaded: the caller's goroutine labels are kept.
+	pprof.Do(context.Background(), pprof.Labels("caller", t.Name()), func(context.Context) {
+		o = RunnerOptions{
+			QPS:           -1,
+			NumThreads:    1,
+			Exactly:       5,
+			LeakDetection: true,
+		}
+		r = NewPeriodicRunner(&o)
+		r.Options().MakeRunners(&l)
+		res = r.Run()
+		if res.LeakedGoroutines != 5 {
+			t.Errorf("Expected 5 leaked goroutines single threaded, got %d", res.LeakedGoroutines)
+		}
+		var buf bytes.Buffer
+		if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+			t.Fatalf("Unable to get the goroutine profile: %v", err)
+		}
+		// Goroutines (with their labels and stack) are separated by blank lines.
+		label := fmt.Sprintf("# labels: {%q:%q}", "caller", t.Name())
+		found := false
+		for _, g := range strings.Split(buf.String(), "\n\n") {
+			found = found || (strings.Contains(g, label) && strings.Contains(g, "periodic.TestLeakedGoroutines"))
+		}
+		if !found {
+			t.Errorf("Expected the caller's label to be kept, not found in %s", buf.String())
+		}
+	})
+}
+
 func TestWAbortWait(t *testing.T) {
 	var count int64
 	var lock sync.Mutex
@@ -668,3 +1199,169 @@ func TestWAbortWait(t *testing.T) {
 		t.Errorf("mismatch between result object and internal count %d %d", count, res.DurationHistogram.Count)
 	}
 }
+
+// stuckRunnable calls block until release is closed for the odd iterations.
+type stuckRunnable struct {
+	release chan struct{}
+	calls   atomic.Int64
+}
+
+func (s *stuckRunnable) Run(_ context.Context, _ ThreadID) (bool, string) {
+	if s.calls.Add(1)%2 == 0 {
+		<-s.release
+	}
+	return true, ""
+}
+
+func (s *stuckRunnable) ConcurrentSafe() bool {
+	return true
+}
+
+func TestRunTimeout(t *testing.T) {
+	s := stuckRunnable{release: make(chan struct{})}
+	o := RunnerOptions{
+		QPS:        -1,
+		NumThreads: 1,
+		Exactly:    6,
+		RunTimeout: 50 * time.Millisecond,
+	}
+	r := NewPeriodicRunner(&o)
+	r.Options().MakeRunners(&s)
+	start := time.Now()
+	res := r.Run()
+	close(s.release)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Run took %v despite the timeouts", elapsed)
+	}
+	if res.TimeoutCount != 3 || res.ErrorsDurationHistogram.Count != 3 || res.ErrorTypes["timeout"] != 3 {
+		t.Errorf("Expected 3 timeouts, got %d %d %v", res.TimeoutCount, res.ErrorsDurationHistogram.Count, res.ErrorTypes)
+	}
+	if res.DurationHistogram.Count != 6 {
+		t.Errorf("Expected 6 calls, got %d", res.DurationHistogram.Count)
+	}
+}
+
+func TestRunTimeoutNotConcurrentSafe(t *testing.T) {
+	var count int64
+	var lock sync.Mutex
+	c := TestCount{&count, &lock}
+	o := RunnerOptions{
+		QPS:        -1,
+		NumThreads: 2,
+		Exactly:    10,
+		RunTimeout: time.Nanosecond,
+	}
+	r := NewPeriodicRunner(&o)
+	r.Options().MakeRunners(&c)
+	res := r.Run()
+	if res.TimeoutCount != 0 || count != 10 {
+		t.Errorf("Expected the run timeout to be ignored, got %d timeouts, %d calls", res.TimeoutCount, count)
+	}
+	if r.Options().RunTimeout != 0 {
+		t.Errorf("Expected RunTimeout to be reset, got %v", r.Options().RunTimeout)
+	}
+}
+
+func TestCheckpointResume(t *testing.T) {
+	var count int64
+	var lock sync.Mutex
+	c := TestCount{&count, &lock}
+	file := path.Join(t.TempDir(), "checkpoint.json")
+	o := RunnerOptions{
+		QPS:                20,
+		NumThreads:         1,
+		Exactly:            30,
+		CheckpointFile:     file,
+		CheckpointInterval: 100 * time.Millisecond,
+	}
+	r := NewPeriodicRunner(&o)
+	r.Options().MakeRunners(&c)
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		r.Options().Abort()
+	}()
+	res := r.Run()
+	r.Options().ReleaseRunners()
+	first := res.DurationHistogram.Count
+	if first <= 0 || first >= 30 {
+		t.Fatalf("Unexpected interrupted run count %d", first)
+	}
+	cp, err := LoadCheckpoint(file)
+	if err != nil || cp == nil {
+		t.Fatalf("Expected a checkpoint in %s, got %v %v", file, cp, err)
+	}
+	if cp.ID != res.ID || cp.DurationHistogram.Count != first || cp.RequestedDuration != "exactly 30 calls" {
+		t.Errorf("Unexpected checkpoint %+v for %s %d calls", cp, res.ID, first)
+	}
+	// Not resumed by a different run:
+	count = 0
+	o = RunnerOptions{QPS: 200, NumThreads: 1, Exactly: 30, CheckpointFile: file, CheckpointTarget: "other"}
+	r = NewPeriodicRunner(&o)
+	r.Options().MakeRunners(&c)
+	res2 := r.Run()
+	r.Options().ReleaseRunners()
+	if !res2.Error || count != 0 {
+		t.Errorf("Expected a different run to refuse the checkpoint, got %+v after %d calls", res2.ServerReply, count)
+	}
+	if _, err = LoadCheckpoint(file); err != nil {
+		t.Errorf("Checkpoint should be left as is: %v", err)
+	}
+	// Resume, with fresh options (and run ID):
+	count = 0
+	o = RunnerOptions{QPS: 200, NumThreads: 1, Exactly: 30, CheckpointFile: file}
+	r = NewPeriodicRunner(&o)
+	r.Options().MakeRunners(&c)
+	res2 = r.Run()
+	r.Options().ReleaseRunners()
+	if count != 30-first {
+		t.Errorf("Resumed run did %d calls, expected the remaining %d", count, 30-first)
+	}
+	if res2.DurationHistogram.Count != 30 {
+		t.Errorf("Resumed run results have %d calls instead of 30", res2.DurationHistogram.Count)
+	}
+	if res2.ID != res.ID || !res2.StartTime.Equal(res.StartTime) || res2.RequestedDuration != "exactly 30 calls" {
+		t.Errorf("Resumed run %s %v %q doesn't continue %s %v", res2.ID, res2.StartTime, res2.RequestedDuration, res.ID, res.StartTime)
+	}
+	if res2.ActualDuration <= res.ActualDuration {
+		t.Errorf("Resumed run duration %v should include the first %v", res2.ActualDuration, res.ActualDuration)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("Checkpoint file should be removed after the run completes: %v", err)
+	}
+	// A checkpoint which already has all the calls (interrupted while finishing) doesn't get more:
+	cp.Options.Exactly = 10
+	cp.DurationHistogram.Count = 10
+	if err = cp.Save(file); err != nil {
+		t.Fatalf("Unable to save checkpoint: %v", err)
+	}
+	count = 0
+	o = RunnerOptions{QPS: 200, NumThreads: 1, Exactly: 10, CheckpointFile: file}
+	r = NewPeriodicRunner(&o)
+	r.Options().MakeRunners(&c)
+	res2 = r.Run()
+	r.Options().ReleaseRunners()
+	if count != 0 || res2.DurationHistogram.Count != 10 || res2.Error {
+		t.Errorf("Complete checkpoint resumed with %d calls, %d total: %+v", count, res2.DurationHistogram.Count, res2.ServerReply)
+	}
+}
+
+func TestShardedLiveHistogram(t *testing.T) {
+	o := RunnerOptions{
+		QPS:              -1,
+		NumThreads:       8,
+		Exactly:          400,
+		ShardedHistogram: true,
+	}
+	o.Normalize()
+	o.LiveHistogram = o.NewLiveHistogram()
+	if _, ok := o.LiveHistogram.(*stats.ShardedHistogram); !ok {
+		t.Fatalf("Expected a sharded live histogram, got %T", o.LiveHistogram)
+	}
+	r := NewPeriodicRunner(&o)
+	r.Options().MakeRunners(&Noop{})
+	res := r.Run()
+	r.Options().ReleaseRunners()
+	if live := o.LiveHistogram.Export(); live.Count != 400 || live.Count != res.DurationHistogram.Count {
+		t.Errorf("Live histogram count %d doesn't match the results' %d", live.Count, res.DurationHistogram.Count)
+	}
+}
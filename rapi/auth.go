@@ -0,0 +1,134 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rapi // import "fortio.org/fortio/rapi"
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"fortio.org/fortio/jrpc"
+	"fortio.org/log"
+)
+
+// AdminUser is the user name whose tokens can stop any run (other users can only stop their own runs).
+const AdminUser = "admin"
+
+// APITokens maps bearer tokens to user names. When set (before AddHandlers), the run, replay and
+// stop REST endpoints require an "Authorization: Bearer TOKEN" header, see AuthMiddleware.
+var APITokens map[string]string
+
+type userContextKey struct{}
+
+// LoadTokens reads the token:username lines (empty lines and # comments are ignored) of the file at path.
+func LoadTokens(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tokens := make(map[string]string)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		token, user, found := strings.Cut(line, ":")
+		token, user = strings.TrimSpace(token), strings.TrimSpace(user)
+		if !found || token == "" || user == "" {
+			return nil, fmt.Errorf("%s:%d: invalid line, expecting token:username", path, i+1)
+		}
+		tokens[token] = user
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("no tokens found in %s", path)
+	}
+	return tokens, nil
+}
+
+// AuthMiddleware only lets requests with a valid "Authorization: Bearer TOKEN" header through to next,
+// with the token's user available to it through UserFromContext. Other requests get a 401 error reply.
+func AuthMiddleware(next http.Handler, tokens map[string]string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := tokenUser(r.Header.Get("Authorization"), tokens)
+		if !ok {
+			log.S(log.Warning, "Unauthorized REST call", log.Str("path", r.URL.Path), log.Str("remote", r.RemoteAddr))
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			_ = jrpc.Reply(w, http.StatusUnauthorized, jrpc.NewErrorReply("unauthorized", nil))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userContextKey{}, user)))
+	})
+}
+
+// tokenUser returns the user of the bearer token of the authorization header value.
+func tokenUser(authorization string, tokens map[string]string) (string, bool) {
+	token, found := strings.CutPrefix(authorization, "Bearer ")
+	if !found || token == "" {
+		return "", false
+	}
+	for t, user := range tokens {
+		// constant time comparison to not leak the tokens through timing.
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return user, true
+		}
+	}
+	return "", false
+}
+
+// UserFromContext returns the user authenticated by AuthMiddleware, false when there is none.
+func UserFromContext(ctx context.Context) (string, bool) {
+	user, ok := ctx.Value(userContextKey{}).(string)
+	return user, ok
+}
+
+// RequestUser returns the user of the request's bearer token, for handlers not wrapped by AuthMiddleware:
+// empty and true when APITokens aren't set, false when the request isn't authorized.
+func RequestUser(r *http.Request) (string, bool) {
+	if APITokens == nil {
+		return "", true
+	}
+	return tokenUser(r.Header.Get("Authorization"), APITokens)
+}
+
+// withAuth wraps the handler with AuthMiddleware when APITokens are set.
+func withAuth(handler http.HandlerFunc) http.Handler {
+	if APITokens == nil {
+		return handler
+	}
+	return AuthMiddleware(handler, APITokens)
+}
+
+// SetRunUser records the user who started the (pending) run runid, the only one, with AdminUser, who can stop it.
+func SetRunUser(runid int64, user string) {
+	uiRunMapMutex.Lock()
+	if status, found := runs[runid]; found {
+		status.User = user
+	}
+	uiRunMapMutex.Unlock()
+}
+
+// StopByRunIDForUser is StopByRunID for user (empty when not using APITokens): allowed is false
+// when the single runid was started by another user, stop all only stops the runs user can stop.
+func StopByRunIDForUser(runid int64, wait bool, user string) (int, string, bool) {
+	return stopRuns(runid, wait, user)
+}
+
+// canStop returns true if the user (empty when not using authentication) can stop the run.
+func canStop(user string, status *Status) bool {
+	return user == "" || user == AdminUser || user == status.User
+}
@@ -0,0 +1,152 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rapi // import "fortio.org/fortio/rapi"
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"fortio.org/fortio/jrpc"
+	"fortio.org/fortio/stats"
+	"fortio.org/log"
+)
+
+const RestCompareURI = "rest/compare"
+
+// LiveRunSnapshot is the current state of an in flight run.
+type LiveRunSnapshot struct {
+	RunID        int64
+	State        StateEnum
+	Labels       string
+	RequestedQPS float64
+	// Actual qps so far (approximate when there is a warmup phase).
+	ActualQPS         float64
+	Elapsed           time.Duration
+	ErrorCount        int64
+	DurationHistogram *stats.HistogramData
+	// Current qps, over the last stats.DefaultRateWindow.
+	CurrentQPS float64
+}
+
+// CompareResult is the reply of the /rest/compare endpoint, deltas are B minus A.
+type CompareResult struct {
+	jrpc.ServerReply
+	A                *LiveRunSnapshot
+	B                *LiveRunSnapshot
+	QPSDelta         float64
+	AvgDelta         float64
+	ErrorCountDelta  int64
+	PercentileDeltas []stats.Percentile
+}
+
+// setRunLive marks the (pending) run runid as needing live histograms, for CompareRuns.
+func setRunLive(runid int64) {
+	uiRunMapMutex.Lock()
+	if status, found := runs[runid]; found {
+		status.live = true
+	}
+	uiRunMapMutex.Unlock()
+}
+
+// liveSnapshot returns the snapshot of the in flight run id, with the percentiles of
+// the duration histogram calculated for the given list (the run's own when nil).
+func liveSnapshot(id int64, percentiles []float64) (*LiveRunSnapshot, error) {
+	uiRunMapMutex.Lock()
+	status, found := runs[id]
+	var res LiveRunSnapshot
+	var start time.Time
+	var warmup time.Duration
+	var live, liveErrors stats.LiveHistogram
+	var rate *stats.RateTracker
+	if found {
+		res.RunID = status.RunID
+		res.State = status.State
+		start = status.startTime
+		if ro := status.RunnerOptions; ro != nil {
+			res.Labels = ro.Labels
+			res.RequestedQPS = ro.QPS
+			warmup = ro.WarmupDuration
+			live, liveErrors, rate = ro.LiveHistogram, ro.LiveErrorHistogram, ro.LiveRate
+			if percentiles == nil {
+				percentiles = slices.Clone(ro.Percentiles)
+			}
+		}
+	}
+	uiRunMapMutex.Unlock()
+	if !found {
+		return nil, fmt.Errorf("run %d not found (not running or already completed)", id)
+	}
+	if live == nil {
+		return nil, fmt.Errorf("run %d hasn't started yet or wasn't started with live=on", id)
+	}
+	res.DurationHistogram = live.Export().CalcPercentiles(percentiles)
+	res.ErrorCount = liveErrors.Count()
+	res.Elapsed = time.Since(start)
+	if rate != nil {
+		res.CurrentQPS = rate.Rate(time.Now())
+	}
+	if elapsed := res.Elapsed - warmup; elapsed > 0 {
+		res.ActualQPS = float64(res.DurationHistogram.Count) / elapsed.Seconds()
+	}
+	return &res, nil
+}
+
+// CompareRuns returns a side by side comparison of the current (live) histograms, actual qps and
+// error counts of the 2 in flight runs idA and idB. The percentiles of A's run options are used for both.
+func CompareRuns(idA, idB int64) (*CompareResult, error) {
+	a, err := liveSnapshot(idA, nil)
+	if err != nil {
+		return nil, err
+	}
+	percentiles := make([]float64, 0, len(a.DurationHistogram.Percentiles))
+	for _, p := range a.DurationHistogram.Percentiles {
+		percentiles = append(percentiles, p.Percentile)
+	}
+	b, err := liveSnapshot(idB, percentiles)
+	if err != nil {
+		return nil, err
+	}
+	res := CompareResult{A: a, B: b}
+	res.QPSDelta = b.ActualQPS - a.ActualQPS
+	res.AvgDelta = b.DurationHistogram.Avg - a.DurationHistogram.Avg
+	res.ErrorCountDelta = b.ErrorCount - a.ErrorCount
+	for i, p := range b.DurationHistogram.Percentiles {
+		res.PercentileDeltas = append(res.PercentileDeltas,
+			stats.Percentile{Percentile: p.Percentile, Value: p.Value - a.DurationHistogram.Percentiles[i].Value})
+	}
+	return &res, nil
+}
+
+// RESTCompareHandler compares the 2 in flight runs `a` and `b` (run ids), see CompareRuns.
+func RESTCompareHandler(w http.ResponseWriter, r *http.Request) {
+	log.LogRequest(r, "REST Compare call")
+	idA, errA := strconv.ParseInt(r.FormValue("a"), 10, 64)
+	idB, errB := strconv.ParseInt(r.FormValue("b"), 10, 64)
+	if errA != nil || errB != nil || idA <= 0 || idB <= 0 {
+		Error(w, "a and b run ids are required", nil)
+		return
+	}
+	res, err := CompareRuns(idA, idB)
+	if err != nil {
+		Error(w, "unable to compare runs", err)
+		return
+	}
+	if err = jrpc.ReplyOk(w, res); err != nil {
+		log.Errf("Error replying to compare: %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rapi // import "fortio.org/fortio/rapi"
+
+import (
+	"net/http"
+)
+
+// CORSOrigin is the Access-Control-Allow-Origin of the REST API responses, e.g. "*" or
+// "https://dashboard.example.com", to use the API from other origins' JavaScript. Empty (default)
+// for no CORS headers. Must be set before AddHandlers.
+var CORSOrigin string
+
+// CORSMiddleware adds the CORS headers allowing origin to call the API to the responses of next
+// and replies directly to the pre-flight OPTIONS requests with 204 No Content.
+func CORSMiddleware(origin string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Access-Control-Allow-Origin", origin)
+		h.Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+		h.Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		if origin != "*" {
+			h.Add("Vary", "Origin")
+		}
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withCORS wraps the handler with CORSMiddleware when CORSOrigin is set.
+// It must be outside of withAuth as pre-flight requests don't have credentials.
+func withCORS(handler http.Handler) http.Handler {
+	if CORSOrigin == "" {
+		return handler
+	}
+	return CORSMiddleware(CORSOrigin, handler)
+}
@@ -16,8 +16,13 @@ package rapi // import "fortio.org/fortio/rapi"
 
 import (
 	"bytes"
+	"crypto/hmac"
 	"crypto/md5" //nolint:gosec // md5 is mandated by tsv format, not our choice
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -29,14 +34,188 @@ import (
 	"time"
 
 	"fortio.org/fortio/fhttp"
+	"fortio.org/fortio/jrpc"
 	"fortio.org/log"
 )
 
 const (
 	JSONExtension = ".json"
 	DataDir       = "data/"
+	// RestDataURI is the prefix for the results deletion API: rest/data/{id}.json.
+	RestDataURI = "rest/data/"
+	// DeleteTokenTTL is how long a delete confirmation token is valid for.
+	DeleteTokenTTL = 60 * time.Second
+	// ChecksumExtension is the extension of the files, next to the saved results, with their checksum.
+	ChecksumExtension = ".sha256"
 )
 
+// deleteKey is the HMAC key for delete tokens, generated at startup and in memory only.
+var deleteKey = func() []byte {
+	k := make([]byte, 32)
+	if _, err := rand.Read(k); err != nil {
+		log.Fatalf("Unable to generate delete token key: %v", err)
+	}
+	return k
+}()
+
+// validResultID checks the id is a plain file name (no path traversal).
+func validResultID(id string) bool {
+	return id != "" && !strings.ContainsAny(id, "/\\") && !strings.HasPrefix(id, ".")
+}
+
+func deleteTokenMAC(id string, expires int64) string {
+	mac := hmac.New(sha256.New, deleteKey)
+	mac.Write([]byte(id + "|" + strconv.FormatInt(expires, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// DeleteToken returns a confirmation token, valid for DeleteTokenTTL, to delete the result id.
+func DeleteToken(id string) string {
+	expires := time.Now().Add(DeleteTokenTTL).Unix()
+	return strconv.FormatInt(expires, 10) + "." + deleteTokenMAC(id, expires)
+}
+
+// DeleteResult deletes the saved result id (without .json extension) from the data dir
+// after validating the token obtained from DeleteToken.
+func DeleteResult(id, token string) error {
+	if !validResultID(id) {
+		return errors.New("invalid result id")
+	}
+	expStr, mac, found := strings.Cut(token, ".")
+	if !found {
+		return errors.New("invalid token")
+	}
+	expires, err := strconv.ParseInt(expStr, 10, 64)
+	if err != nil {
+		return errors.New("invalid token")
+	}
+	if !hmac.Equal([]byte(mac), []byte(deleteTokenMAC(id, expires))) {
+		return errors.New("invalid token")
+	}
+	if time.Now().Unix() > expires {
+		return errors.New("expired token")
+	}
+	fname := path.Join(dataDir, id+JSONExtension)
+	log.Infof("Deleting result %s", fname)
+	if err = os.Remove(fname); err != nil {
+		return err
+	}
+	_ = os.Remove(fname + ChecksumExtension) // older results don't have one.
+	return nil
+}
+
+// checksum returns the "sha256:HEX" checksum of data.
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// ErrNoChecksum is the VerifyResultChecksum error for results saved without checksum.
+var ErrNoChecksum = errors.New("no stored checksum")
+
+// WriteChecksum writes the checksum of data, the content of the result fileName, next to it
+// (fileName + ChecksumExtension) for VerifyResultChecksum.
+func WriteChecksum(fileName string, data []byte) error {
+	return os.WriteFile(fileName+ChecksumExtension, []byte(checksum(data)+"\n"), 0o644) //nolint:gosec // same as data
+}
+
+// ComputeResultChecksum returns the "sha256:HEX" checksum of the current content of the saved result id.
+func ComputeResultChecksum(id string) (string, error) {
+	if !validResultID(id) {
+		return "", errors.New("invalid result id")
+	}
+	data, err := os.ReadFile(path.Join(dataDir, id+JSONExtension))
+	if err != nil {
+		return "", err
+	}
+	return checksum(data), nil
+}
+
+// VerifyResultChecksum checks the saved result id still matches the checksum stored when it was saved.
+func VerifyResultChecksum(id string) error {
+	actual, err := ComputeResultChecksum(id)
+	if err != nil {
+		return err
+	}
+	stored, err := os.ReadFile(path.Join(dataDir, id+JSONExtension+ChecksumExtension))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrNoChecksum, err)
+	}
+	if expected := strings.TrimSpace(string(stored)); actual != expected {
+		return fmt.Errorf("checksum mismatch: stored %s, actual %s", expected, actual)
+	}
+	return nil
+}
+
+// VerifiedResultCacheControl is the Cache-Control header of the verified results replies: they must be
+// revalidated (a conditional request, which is verified again) as the results can be deleted.
+const VerifiedResultCacheControl = "no-cache"
+
+// DeleteTokenReply is the reply to rest/data/{id}.json?confirm-token=true.
+type DeleteTokenReply struct {
+	jrpc.ServerReply
+	ID    string
+	Token string
+}
+
+// RESTDataHandler handles the results deletion 2 steps API:
+// GET rest/data/{id}.json?confirm-token=true returns a token and
+// DELETE rest/data/{id}.json?token=... deletes the result.
+// GET rest/data/{id}.json?verify=1 returns the result after checking it matches the checksum stored
+// when it was saved, with a 409 (conflict) error if it doesn't and a 404 if it has no stored checksum.
+// Replies are gzip compressed for clients accepting it (see AddHandlers).
+func RESTDataHandler(w http.ResponseWriter, r *http.Request) {
+	log.LogRequest(r, "REST Data call")
+	w.Header().Set("Content-Type", "application/json")
+	_, fname := path.Split(r.URL.Path)
+	id, found := strings.CutSuffix(fname, JSONExtension)
+	if !found || !validResultID(id) {
+		Error(w, "invalid result id", nil)
+		return
+	}
+	verify, _ := strconv.ParseBool(r.FormValue("verify"))
+	switch {
+	case r.Method == http.MethodGet && verify:
+		if _, err := os.Stat(path.Join(dataDir, fname)); err != nil {
+			Error(w, "result not found", err)
+			return
+		}
+		if err := VerifyResultChecksum(id); err != nil {
+			log.Warnf("Verification of %q failed: %v", id, err)
+			if errors.Is(err, ErrNoChecksum) {
+				_ = jrpc.Reply(w, http.StatusNotFound, jrpc.NewErrorReply("result has no stored checksum", err))
+				return
+			}
+			_ = jrpc.Reply(w, http.StatusConflict, jrpc.NewErrorReply("result verification failed", err))
+			return
+		}
+		w.Header().Set("Cache-Control", VerifiedResultCacheControl)
+		http.ServeFile(w, r, path.Join(dataDir, fname))
+	case r.Method == http.MethodGet && r.FormValue("confirm-token") == "true":
+		if _, err := os.Stat(path.Join(dataDir, fname)); err != nil {
+			Error(w, "result not found", err)
+			return
+		}
+		reply := DeleteTokenReply{ID: id, Token: DeleteToken(id)}
+		reply.Message = "confirm with DELETE and token= within " + DeleteTokenTTL.String()
+		if err := jrpc.ReplyOk(w, &reply); err != nil {
+			log.Errf("Error replying to delete token request: %v", err)
+		}
+	case r.Method == http.MethodDelete:
+		if err := DeleteResult(id, r.FormValue("token")); err != nil {
+			log.Warnf("Delete of %q refused/failed: %v", id, err)
+			Error(w, "unable to delete result", err)
+			return
+		}
+		reply := jrpc.ServerReply{Message: "deleted " + id}
+		if err := jrpc.ReplyOk(w, &reply); err != nil {
+			log.Errf("Error replying to delete request: %v", err)
+		}
+	default:
+		Error(w, "use GET with confirm-token=true then DELETE with token=", nil)
+	}
+}
+
 // DataList returns the .json files/entries in data dir.
 func DataList() (dataList []string) {
 	files, err := os.ReadDir(dataDir)
@@ -64,8 +243,10 @@ type tsvCache struct {
 }
 
 var (
-	gTSVCache      tsvCache
-	gTSVCacheMutex = &sync.Mutex{}
+	gTSVCache tsvCache
+	// Separate cache for the index with the sha256 checksums column.
+	gTSVChecksumsCache tsvCache
+	gTSVCacheMutex     = &sync.Mutex{}
 	// Starts and end with / where the UI is running from, prefix to data etc.
 	uiPath string
 	// Base URL used for index - useful when running under an ingress with prefix. can be empty otherwise.
@@ -75,14 +256,24 @@ var (
 // format for gcloud transfer
 // https://cloud.google.com/storage/transfer/create-url-list
 func SendTSVDataIndex(urlPrefix string, w http.ResponseWriter) {
+	sendTSVDataIndex(urlPrefix, w, false)
+}
+
+// sendTSVDataIndex is SendTSVDataIndex with, when checksums is true, an additional column
+// with the "sha256:HEX" checksum of each file (see ComputeResultChecksum).
+func sendTSVDataIndex(urlPrefix string, w http.ResponseWriter, checksums bool) {
 	info, err := os.Stat(dataDir)
 	if err != nil {
 		log.Errf("Unable to stat %s: %v", dataDir, err)
 		w.WriteHeader(http.StatusServiceUnavailable)
 		return
 	}
+	cache := &gTSVCache
+	if checksums {
+		cache = &gTSVChecksumsCache
+	}
 	gTSVCacheMutex.Lock() // Kind of a long time to hold a lock... hopefully the FS doesn't hang...
-	useCache := (info.ModTime() == gTSVCache.cachedDirTime) && (len(gTSVCache.cachedResult) > 0)
+	useCache := (info.ModTime() == cache.cachedDirTime) && (len(cache.cachedResult) > 0)
 	if !useCache {
 		var b bytes.Buffer
 		b.WriteString("TsvHttpData-1.0\n")
@@ -95,8 +286,9 @@ func SendTSVDataIndex(urlPrefix string, w http.ResponseWriter) {
 			}
 			//nolint:gosec // This isn't a crypto hash, more like a checksum - and mandated by the spec above, not our choice
 			h := md5.New()
+			sha := sha256.New()
 			var sz int64
-			if sz, err = io.Copy(h, f); err != nil {
+			if sz, err = io.Copy(io.MultiWriter(h, sha), f); err != nil {
 				f.Close()
 				log.Errf("Copy/read error for %s: %v", fname, err)
 				continue
@@ -107,13 +299,18 @@ func SendTSVDataIndex(urlPrefix string, w http.ResponseWriter) {
 			b.WriteString(strconv.FormatInt(sz, 10))
 			b.WriteString("\t")
 			b.WriteString(base64.StdEncoding.EncodeToString(h.Sum(nil)))
+			if checksums {
+				b.WriteString("\tsha256:")
+				b.WriteString(hex.EncodeToString(sha.Sum(nil)))
+			}
 			b.WriteString("\n")
+			f.Close()
 		}
-		gTSVCache.cachedDirTime = info.ModTime()
-		gTSVCache.cachedResult = b.Bytes()
+		cache.cachedDirTime = info.ModTime()
+		cache.cachedResult = b.Bytes()
 	}
-	result := gTSVCache.cachedResult
-	lastModified := gTSVCache.cachedDirTime.Format(http.TimeFormat)
+	result := cache.cachedResult
+	lastModified := cache.cachedDirTime.Format(http.TimeFormat)
 	gTSVCacheMutex.Unlock()
 	log.Infof("Used cached %v to serve %d bytes TSV", useCache, len(result))
 	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
@@ -163,8 +360,10 @@ func ID2URL(r *http.Request, id string) string {
 	return GetDataURL(r) + id + JSONExtension
 }
 
-// LogAndFilterDataRequest logs the data request.
+// LogAndFilterDataRequest logs the data request. The .json results, which can be megabytes for long runs,
+// are gzip compressed for clients accepting it (unless a byte range is requested).
 func LogAndFilterDataRequest(h http.Handler) http.Handler {
+	gz := fhttp.Gzip(h)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.LogRequest(r, "Data")
 		path := r.URL.Path
@@ -177,7 +376,8 @@ func LogAndFilterDataRequest(h http.Handler) http.Handler {
 		if strings.HasSuffix(path, ext) {
 			urlPrefix := GetDataURL(r)
 			log.Infof("Prefix is '%s'", urlPrefix)
-			SendTSVDataIndex(urlPrefix, w)
+			checksums, _ := strconv.ParseBool(r.FormValue("checksums"))
+			sendTSVDataIndex(urlPrefix, w, checksums)
 			return
 		}
 		if !strings.HasSuffix(path, JSONExtension) {
@@ -186,22 +386,28 @@ func LogAndFilterDataRequest(h http.Handler) http.Handler {
 			return
 		}
 		fhttp.CacheOn(w)
-		h.ServeHTTP(w, r)
+		gz.ServeHTTP(w, r)
 	})
 }
 
 func AddDataHandler(mux *http.ServeMux, baseurl, uipath, datadir string) {
 	gTSVCacheMutex.Lock()
 	gTSVCache.cachedResult = []byte{}
+	gTSVChecksumsCache.cachedResult = []byte{}
 	baseURL = baseurl
 	uiPath = uipath
 	SetDataDir(datadir)
 	gTSVCacheMutex.Unlock()
+	gSearchCacheMutex.Lock()
+	gSearchCache.entries = nil
+	gSearchCacheMutex.Unlock()
 	if datadir == "" {
 		log.Infof("No data dir so no handler for data")
 	}
 	fs := http.FileServer(http.Dir(datadir))
 	mux.Handle(uiPath+DataDir, LogAndFilterDataRequest(http.StripPrefix(uiPath+"data", fs)))
+	// also in browse only (report) mode, for the lazy loading of the list:
+	mux.HandleFunc(uiPath+RestDataListURI, RESTDataListHandler)
 	if datadir == "." {
 		var err error
 		datadir, err = os.Getwd()
@@ -0,0 +1,85 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rapi // import "fortio.org/fortio/rapi"
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"fortio.org/fortio/periodic"
+	"fortio.org/fortio/stats"
+	"fortio.org/log"
+)
+
+// DefaultGraphitePort is the Carbon plaintext protocol port used when the host has none.
+const DefaultGraphitePort = "2003"
+
+var (
+	// GraphitePrefix is the first element of the metrics paths sent by SendToGraphite.
+	GraphitePrefix = "fortio"
+	// GraphiteTimeout is the timeout for connecting and sending the metrics to Graphite.
+	GraphiteTimeout = 5 * time.Second
+)
+
+// graphiteSanitize replaces the characters that aren't safe in a Graphite path element by _.
+func graphiteSanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// GraphiteMetrics returns the Graphite plaintext lines for the results: the duration histogram (see
+// stats.HistogramData.ToGraphite), the actual qps and errors count, under GraphitePrefix.runtype[.labels]
+// and timestamped at the end of the run.
+func GraphiteMetrics(results *periodic.RunnerResults) string {
+	prefix := GraphitePrefix + "." + graphiteSanitize(strings.ToLower(results.RunType))
+	if results.Labels != "" {
+		prefix += "." + graphiteSanitize(results.Labels)
+	}
+	ts := results.StartTime.Add(results.ActualDuration)
+	var sb strings.Builder
+	if results.DurationHistogram != nil {
+		sb.WriteString(results.DurationHistogram.ToGraphite(prefix+".duration", ts))
+	}
+	sb.WriteString(stats.GraphiteLine(prefix+".qps", results.ActualQPS, ts))
+	if results.ErrorsDurationHistogram != nil {
+		sb.WriteString(stats.GraphiteLine(prefix+".errors", float64(results.ErrorsDurationHistogram.Count), ts))
+	}
+	return sb.String()
+}
+
+// SendToGraphite sends the results metrics (see GraphiteMetrics) to the Graphite/Carbon server
+// host:port (port defaults to 2003) over TCP.
+func SendToGraphite(host string, results *periodic.RunnerResults) error {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, DefaultGraphitePort)
+	}
+	conn, err := net.DialTimeout("tcp", host, GraphiteTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(GraphiteTimeout))
+	metrics := GraphiteMetrics(results)
+	if _, err = conn.Write([]byte(metrics)); err != nil {
+		return err
+	}
+	log.S(log.Info, "Sent metrics to graphite", log.Str("host", host), log.Attr("lines", strings.Count(metrics, "\n")))
+	return nil
+}
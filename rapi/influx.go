@@ -0,0 +1,79 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rapi // import "fortio.org/fortio/rapi"
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"fortio.org/fortio/fhttp"
+	"fortio.org/fortio/periodic"
+	"fortio.org/log"
+)
+
+var (
+	// InfluxMeasurement is the measurement name of the line sent by SendToInflux.
+	InfluxMeasurement = "fortio"
+	// InfluxTimeout is the timeout for sending the metrics to InfluxDB.
+	InfluxTimeout = 5 * time.Second
+)
+
+// InfluxMetrics returns the InfluxDB line protocol line for the results: tagged with the run_id and
+// the (URL encoded) labels, with the avg_latency, p50 and p99 of the duration histogram (in seconds),
+// the actual_qps, error_count and le_End counts of each histogram bucket (End being its upper bound,
+// stable across runs unlike the bucket index) as fields, timestamped (in nanoseconds) at the end of the run.
+func InfluxMetrics(results *periodic.RunnerResults) string {
+	var sb strings.Builder
+	sb.WriteString(InfluxMeasurement)
+	sb.WriteString(",run_id=")
+	sb.WriteString(strconv.FormatInt(results.RunID, 10))
+	if results.Labels != "" { // empty tag values aren't allowed.
+		sb.WriteString(",labels=")
+		sb.WriteString(url.QueryEscape(results.Labels))
+	}
+	fmt.Fprintf(&sb, " actual_qps=%g", results.ActualQPS)
+	var errors int64
+	if results.ErrorsDurationHistogram != nil {
+		errors = results.ErrorsDurationHistogram.Count
+	}
+	fmt.Fprintf(&sb, ",error_count=%di", errors)
+	if h := results.DurationHistogram; h != nil {
+		fmt.Fprintf(&sb, ",avg_latency=%g,p50=%g,p99=%g", h.Avg, h.CalcPercentile(50), h.CalcPercentile(99))
+		for _, b := range h.Data {
+			fmt.Fprintf(&sb, ",le_%s=%di", strconv.FormatFloat(b.End, 'f', -1, 64), b.Count)
+		}
+	}
+	fmt.Fprintf(&sb, " %d\n", results.StartTime.Add(results.ActualDuration).UnixNano())
+	return sb.String()
+}
+
+// SendToInflux POSTs the results metrics (see InfluxMetrics) to the InfluxDB write endpoint
+// influxURL, e.g. http://influx:8086/write?db=fortio.
+func SendToInflux(influxURL string, results *periodic.RunnerResults) error {
+	o := fhttp.NewHTTPOptions(influxURL)
+	o.DisableFastClient = true
+	o.HTTPReqTimeOut = InfluxTimeout
+	o.ContentType = "text/plain; charset=utf-8"
+	o.Payload = []byte(InfluxMetrics(results))
+	code := fhttp.StreamFetch(o)
+	if code < 200 || code > 299 {
+		return fmt.Errorf("influx write to %s failed with code %d", influxURL, code)
+	}
+	log.S(log.Info, "Sent metrics to influx", log.Str("url", influxURL), log.Attr("code", code))
+	return nil
+}
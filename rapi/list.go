@@ -0,0 +1,147 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rapi // import "fortio.org/fortio/rapi"
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"fortio.org/log"
+)
+
+const (
+	// RestDataListURI is the paginated saved results listing API: rest/data/list?cursor=...&limit=...&sort=...
+	RestDataListURI = "rest/data/list"
+	// DefaultListLimit is the page size of ListResults when not specified (at most MaxSearchResults).
+	DefaultListLimit = 50
+
+	SortTimeDesc = "time_desc" // newest first (default)
+	SortTimeAsc  = "time_asc"  // oldest first
+	SortQPSDesc  = "qps_desc"  // highest actual qps first
+)
+
+// ResultList is the reply of the rest/data/list API, NextCursor is empty on the last page.
+type ResultList struct {
+	Items      []ResultSummary `json:"items"`
+	NextCursor string          `json:"nextCursor"`
+}
+
+// encodeCursor returns the opaque cursor to continue after id, which is at position offset-1.
+func encodeCursor(id string, offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset) + "|" + id))
+}
+
+func decodeCursor(cursor string) (string, int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", 0, errors.New("invalid cursor")
+	}
+	offStr, id, found := strings.Cut(string(b), "|")
+	offset, err := strconv.Atoi(offStr)
+	if !found || err != nil || offset < 0 {
+		return "", 0, errors.New("invalid cursor")
+	}
+	return id, offset, nil
+}
+
+func sortSummaries(summaries []ResultSummary, sortOrder string) error {
+	var less func(a, b *ResultSummary) bool
+	switch sortOrder {
+	case "", SortTimeDesc:
+		less = func(a, b *ResultSummary) bool { return a.StartTime.After(b.StartTime) }
+	case SortTimeAsc:
+		less = func(a, b *ResultSummary) bool { return a.StartTime.Before(b.StartTime) }
+	case SortQPSDesc:
+		less = func(a, b *ResultSummary) bool { return a.ActualQPS > b.ActualQPS }
+	default:
+		return fmt.Errorf("invalid sort %q, should be one of %s, %s or %s", sortOrder, SortTimeDesc, SortTimeAsc, SortQPSDesc)
+	}
+	// Stable so the ties stay in the (newest first) file order.
+	sort.SliceStable(summaries, func(i, j int) bool { return less(&summaries[i], &summaries[j]) })
+	return nil
+}
+
+// ListResults returns up to limit (DefaultListLimit when <= 0, at most MaxSearchResults) saved results summaries
+// sorted by sortOrder (SortTimeDesc when empty), starting after the opaque cursor (empty for the first page)
+// and the cursor for the next page (empty when there are no more results).
+// The cursor encodes the last returned id and its offset: the next page continues after that id
+// if it still exists, at that offset otherwise (when it was deleted in the meantime).
+func ListResults(cursor string, limit int, sortOrder string) ([]ResultSummary, string, error) {
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	limit = min(limit, MaxSearchResults)
+	start := 0
+	lastID := ""
+	if cursor != "" {
+		var err error
+		lastID, start, err = decodeCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	summaries, err := cachedSummaries()
+	if err != nil {
+		return nil, "", err
+	}
+	if err = sortSummaries(summaries, sortOrder); err != nil {
+		return nil, "", err
+	}
+	if lastID != "" {
+		for i := range summaries {
+			if summaries[i].ID == lastID {
+				start = i + 1
+				break
+			}
+		}
+	}
+	start = min(start, len(summaries))
+	end := min(start+limit, len(summaries))
+	next := ""
+	if end < len(summaries) {
+		next = encodeCursor(summaries[end-1].ID, end)
+	}
+	return summaries[start:end], next, nil
+}
+
+// RESTDataListHandler returns a page of the saved results as a JSON ResultList,
+// see ListResults for the cursor, limit and sort query arguments.
+func RESTDataListHandler(w http.ResponseWriter, r *http.Request) {
+	log.LogRequest(r, "REST Data list call")
+	w.Header().Set("Content-Type", "application/json")
+	limit := 0
+	if limitStr := r.FormValue("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil {
+			Error(w, "invalid limit", err)
+			return
+		}
+	}
+	items, next, err := ListResults(r.FormValue("cursor"), limit, r.FormValue("sort"))
+	if err != nil {
+		Error(w, "listing failed", err)
+		return
+	}
+	if err = json.NewEncoder(w).Encode(&ResultList{Items: items, NextCursor: next}); err != nil {
+		log.Errf("Error replying to data list request: %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rapi // import "fortio.org/fortio/rapi"
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"fortio.org/log"
+)
+
+const RestLiveURI = "rest/live"
+
+// liveInterval is how often RESTLiveHandler sends the run's snapshot.
+var liveInterval = time.Second
+
+// RESTLiveHandler streams, as server-sent events, the LiveRunSnapshot (including the current qps) of the
+// in flight run `runid`, started with live=on, every second until the run completes (`end` event) or the
+// client goes away.
+func RESTLiveHandler(w http.ResponseWriter, r *http.Request) {
+	log.LogRequest(r, "REST Live call")
+	runid, err := strconv.ParseInt(r.FormValue("runid"), 10, 64)
+	if err != nil || runid <= 0 {
+		Error(w, "runid is required", err)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		Error(w, "streaming not supported", nil)
+		return
+	}
+	snapshot, err := liveSnapshot(runid, nil)
+	if err != nil {
+		Error(w, "unable to get the live run", err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	ticker := time.NewTicker(liveInterval)
+	defer ticker.Stop()
+	for {
+		data, _ := json.Marshal(snapshot)
+		if _, err = fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			log.LogVf("Live stream of run %d ended: %v", runid, err)
+			return
+		}
+		flusher.Flush()
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+		snapshot, err = liveSnapshot(runid, nil)
+		if err != nil { // run completed (or stopped)
+			_, _ = fmt.Fprintf(w, "event: end\ndata: {}\n\n")
+			flusher.Flush()
+			return
+		}
+	}
+}
@@ -0,0 +1,393 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rapi // import "fortio.org/fortio/rapi"
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+
+	"fortio.org/fortio/fhttp"
+	"fortio.org/fortio/jrpc"
+	"fortio.org/fortio/version"
+	"fortio.org/log"
+)
+
+const RestOpenAPIURI = "rest/openapi.json"
+
+// OpenAPI is the (subset of the) OpenAPI 3.0 document describing the REST API.
+type OpenAPI struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       OpenAPIInfo          `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components OpenAPIComponents    `json:"components"`
+}
+
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type OpenAPIComponents struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+// PathItem has the operations of a path, by (lowercase) method.
+type PathItem struct {
+	Get    *Operation `json:"get,omitempty"`
+	Post   *Operation `json:"post,omitempty"`
+	Delete *Operation `json:"delete,omitempty"`
+}
+
+type Operation struct {
+	Summary     string               `json:"summary"`
+	OperationID string               `json:"operationId"`
+	Parameters  []Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"` // query or path
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Description string                `json:"description,omitempty"`
+	Content     map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is the (subset of the) OpenAPI schema object used for the fortio types.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+}
+
+// schemaGenerator derives schemas from go types, named structs are added (once) to the components.
+type schemaGenerator struct {
+	components map[string]*Schema
+}
+
+var (
+	timeType     = reflect.TypeFor[time.Time]()
+	durationType = reflect.TypeFor[time.Duration]()
+)
+
+// componentName returns the unique name of a named type, e.g. "fhttp.HTTPRunnerResults".
+func componentName(t reflect.Type) string {
+	return path.Base(t.PkgPath()) + "." + t.Name()
+}
+
+// schema returns the schema for values of type t as serialized by encoding/json.
+func (g *schemaGenerator) schema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case durationType:
+		return &Schema{Type: "integer", Format: "int64", Description: "duration in nanoseconds"}
+	}
+	//nolint:exhaustive // the other kinds (func, chan...) can't be serialized, empty (any) schema.
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		name := componentName(t)
+		if _, found := g.components[name]; !found {
+			g.components[name] = &Schema{} // placeholder for recursive types
+			g.components[name] = g.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	default:
+		return &Schema{}
+	}
+}
+
+// structSchema returns the object schema with the json serialized fields of struct type t.
+func (g *schemaGenerator) structSchema(t reflect.Type) *Schema {
+	res := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	g.addFields(res, t)
+	return res
+}
+
+func (g *schemaGenerator) addFields(res *Schema, t reflect.Type) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			g.addFields(res, ft) // embedded struct fields are promoted
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		res.Properties[name] = g.schema(f.Type)
+	}
+}
+
+// restEndpoint describes one of the REST API operations for the spec.
+type restEndpoint struct {
+	uri       string
+	method    string
+	id        string
+	summary   string
+	params    []Parameter
+	response  any // (zero) value of the reply type
+	jsonInput bool
+}
+
+// queryParam returns a string (or type) query parameter.
+func queryParam(name, typ, description string) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, Schema: &Schema{Type: typ}}
+}
+
+func runParams() []Parameter {
+	return []Parameter{
+		{Name: "url", In: "query", Required: true, Description: "URL or destination to load test", Schema: &Schema{Type: "string"}},
+		queryParam("runner", "string", "http (default), grpc, tcp, udp..."),
+		queryParam("qps", "number", "Queries per second, 0 or negative for max"),
+		queryParam("t", "string", "Duration (e.g. 10s) or `on` to run until stopped"),
+		queryParam("n", "integer", "Exact number of calls instead of a duration"),
+		queryParam("c", "integer", "Number of connections/goroutines"),
+		queryParam("p", "string", "Comma separated list of percentiles"),
+		queryParam("r", "number", "Histogram resolution in seconds"),
+		queryParam("labels", "string", "Labels of the run"),
+		queryParam("async", "string", "`on` to return immediately with the run id"),
+		queryParam("save", "string", "`on` to save the result json"),
+		queryParam("notify-url", "string", "URL to POST the result to when an async run completes"),
+		queryParam("priority", "integer", "Queue priority (0 normal, higher is more urgent) when max concurrent runs is reached"),
+		queryParam("payload", "string", "Request body"),
+		queryParam("X", "string", "HTTP method override"),
+		queryParam("H", "string", "Extra header (can be repeated)"),
+		queryParam("timeout", "string", "Request timeout duration"),
+		queryParam("resolve", "string", "IP to use instead of resolving the host"),
+		queryParam("connection-reuse", "string", "Connection reuse range min:max"),
+		queryParam("jsonPath", "string", "Path in the json body to get the options from (e.g. .metadata)"),
+		queryParam("jitter", "string", "`on` for jitter"),
+		queryParam("uniform", "string", "`on` for uniform distribution of the calls"),
+		queryParam("nocatchup", "string", "`on` to not catch up when falling behind the qps"),
+		queryParam("stdclient", "string", "`on` to use the go std http client"),
+		queryParam("h2", "string", "`on` to use HTTP/2"),
+		queryParam("https-insecure", "string", "`on` to skip TLS verification"),
+		queryParam("sequential-warmup", "string", "`on` for sequential warmup"),
+		queryParam("server-timing", "string", "`on` to record the responses' Server-Timing metrics histograms"),
+		queryParam("log-errors", "string", "`on` to log the errors"),
+		queryParam("live", "string", "`on` to keep live histograms, needed to compare the run while in flight"),
+		queryParam("sharded-histogram", "string", "`on` to use a shard per CPU for the live histograms (many connections)"),
+		queryParam("grpc-secure", "string", "`on` for TLS grpc (grpc runner)"),
+		queryParam("ping", "string", "`on` for grpc ping instead of health check (grpc runner)"),
+		queryParam("grpc-ping-delay", "string", "Delay for grpc ping (grpc runner)"),
+	}
+}
+
+func restEndpoints() []restEndpoint {
+	runIDParam := queryParam("runid", "integer", "Run id, 0 or missing for all the runs")
+	resultIDParam := queryParam("id", "string", "Saved result id")
+	resultIDParam.Required = true
+	return []restEndpoint{
+		{
+			RestRunURI, http.MethodGet, "run", "Starts a load test, returns its results or, when async, its id",
+			runParams(), fhttp.HTTPRunnerResults{}, true,
+		},
+		{RestStatusURI, http.MethodGet, "status", "Status of the current runs", []Parameter{runIDParam}, StatusReply{}, false},
+		{RestQueueURI, http.MethodGet, "queue", "Runs waiting for a slot, in start order", nil, QueueReply{}, false},
+		{
+			RestStopURI, http.MethodGet, "stop", "Stops a run (or all)",
+			[]Parameter{runIDParam, queryParam("wait", "string", "`on` to wait for the (single) run to end")}, AsyncReply{}, false,
+		},
+		{
+			RestDNS, http.MethodGet, "dns", "Resolves a host name",
+			[]Parameter{queryParam("name", "string", "Host name")}, DNSReply{}, false,
+		},
+		{
+			RestReplayURI, http.MethodPost, "replay", "Runs again a saved http result with the same options",
+			[]Parameter{resultIDParam, queryParam("async", "string", "`on` to return immediately with the run id")},
+			fhttp.HTTPRunnerResults{}, false,
+		},
+		{
+			RestCompareURI, http.MethodGet, "compare", "Compares the live histograms of 2 in flight runs",
+			[]Parameter{queryParam("a", "integer", "First run id"), queryParam("b", "integer", "Second run id")},
+			CompareResult{}, false,
+		},
+		{
+			RestLiveURI, http.MethodGet, "live",
+			"Server-sent events stream of an in flight run's live snapshot, every second until it completes",
+			[]Parameter{queryParam("runid", "integer", "Run id (started with live=on)")},
+			LiveRunSnapshot{}, false,
+		},
+		{
+			RestComparePrometheusURI, http.MethodGet, "comparePrometheus",
+			"Compares a saved result with a prometheus histogram",
+			[]Parameter{
+				resultIDParam, queryParam("url", "string", "Prometheus scrape URL"),
+				queryParam("metric", "string", "Histogram metric name"),
+			},
+			PrometheusComparison{}, false,
+		},
+		{
+			RestSearchURI, http.MethodGet, "search", "Searches the saved results labels",
+			[]Parameter{queryParam("q", "string", "Space separated words all in the labels")}, []ResultSummary{}, false,
+		},
+		{
+			RestDataListURI, http.MethodGet, "dataList", "Lists (a page of) the saved results",
+			[]Parameter{
+				queryParam("cursor", "string", "Opaque cursor from the previous page"),
+				queryParam("limit", "integer", "Maximum number of results"),
+				queryParam("sort", "string", "Sort order"),
+			},
+			ResultList{}, false,
+		},
+		{
+			RestDataURI + "{id}.json", http.MethodGet, "deleteToken", "Gets a token to delete a saved result",
+			[]Parameter{
+				{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "string"}},
+				queryParam("confirm-token", "string", "Must be true"),
+				queryParam("verify", "string", "1 to get the result instead, or a 409 error if it doesn't match its saved checksum (404 if it has none)"),
+			},
+			DeleteTokenReply{}, false,
+		},
+		{
+			RestDataURI + "{id}.json", http.MethodDelete, "deleteResult", "Deletes a saved result",
+			[]Parameter{
+				{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "string"}},
+				queryParam("token", "string", "Token from the deleteToken call"),
+			},
+			jrpc.ServerReply{}, false,
+		},
+	}
+}
+
+// OpenAPISpec returns the OpenAPI 3.0 document of the REST API served under uiPath (e.g. "/fortio/").
+// The schemas are derived from the go reply types.
+func OpenAPISpec(uiPath string) *OpenAPI {
+	g := schemaGenerator{components: make(map[string]*Schema)}
+	spec := &OpenAPI{
+		OpenAPI: "3.0.3",
+		Info: OpenAPIInfo{
+			Title:       "Fortio REST API",
+			Description: "Load testing runs, status and saved results of a fortio server",
+			Version:     version.Short(),
+		},
+		Paths: make(map[string]*PathItem),
+	}
+	errorSchema := g.schema(reflect.TypeFor[jrpc.ServerReply]())
+	for _, e := range restEndpoints() {
+		op := &Operation{
+			Summary:     e.summary,
+			OperationID: e.id,
+			Parameters:  e.params,
+			Responses: map[string]*Response{
+				"200": {Description: "OK", Content: jsonContent(g.schema(reflect.TypeOf(e.response)))},
+				"400": {Description: "Error", Content: jsonContent(errorSchema)},
+			},
+		}
+		if e.id == "run" {
+			// async mode reply:
+			op.Responses["200"].Content["application/json"].Schema = &Schema{OneOf: []*Schema{
+				g.schema(reflect.TypeOf(e.response)), g.schema(reflect.TypeFor[AsyncReply]()),
+			}}
+		}
+		if e.jsonInput {
+			op.RequestBody = &RequestBody{
+				Description: "Optional json object with the same options as the query parameters (and a headers array)",
+				Content:     jsonContent(&Schema{Type: "object"}),
+			}
+		}
+		p := uiPath + e.uri
+		item := spec.Paths[p]
+		if item == nil {
+			item = &PathItem{}
+			spec.Paths[p] = item
+		}
+		switch e.method {
+		case http.MethodPost:
+			item.Post = op
+		case http.MethodDelete:
+			item.Delete = op
+		default:
+			item.Get = op
+		}
+	}
+	spec.Components.Schemas = g.components
+	return spec
+}
+
+func jsonContent(s *Schema) map[string]*MediaType {
+	return map[string]*MediaType{"application/json": {Schema: s}}
+}
+
+// RESTOpenAPIHandler returns the OpenAPI spec of the REST API.
+func RESTOpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	log.LogRequest(r, "REST OpenAPI call")
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(OpenAPISpec(uiPath)); err != nil {
+		log.Errf("Error replying to openapi request: %v", err)
+	}
+}
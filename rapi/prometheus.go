@@ -0,0 +1,132 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rapi // import "fortio.org/fortio/rapi"
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+
+	"fortio.org/fortio/fhttp"
+	"fortio.org/fortio/jrpc"
+	"fortio.org/fortio/periodic"
+	"fortio.org/fortio/stats"
+	"fortio.org/log"
+)
+
+const RestComparePrometheusURI = "rest/compare-prometheus"
+
+// DefaultComparePercentiles are used when the fortio result doesn't have percentiles.
+var DefaultComparePercentiles = []float64{50, 75, 90, 99, 99.9}
+
+// PrometheusComparison is the reply of the /rest/compare-prometheus endpoint.
+// Deltas are fortio's measurement minus the server's (prometheus) one, so positive
+// values are the overhead outside of what the server measures (network, queuing, client...).
+type PrometheusComparison struct {
+	jrpc.ServerReply
+	ResultID         string
+	Metric           string
+	Fortio           *stats.HistogramData
+	Prometheus       *stats.HistogramData
+	CountDelta       int64
+	AvgDelta         float64
+	PercentileDeltas []stats.Percentile
+	// Number of malformed lines of the scrape, ignored.
+	SkippedLines int `json:",omitempty"`
+}
+
+// ComparePrometheus compares fortio's histogram with one extracted from a prometheus scrape
+// for the given percentiles (calculated on copies of both histograms, returned in the comparison).
+func ComparePrometheus(fortioH, promH *stats.HistogramData, percentiles []float64) *PrometheusComparison {
+	fortio, prom := *fortioH, *promH
+	fortio.Percentiles = nil // CalcPercentiles appends
+	prom.Percentiles = nil
+	res := PrometheusComparison{Fortio: &fortio, Prometheus: &prom}
+	fortio.CalcPercentiles(percentiles)
+	if prom.Count > 0 {
+		prom.CalcPercentiles(percentiles)
+	}
+	res.CountDelta = fortio.Count - prom.Count
+	res.AvgDelta = fortio.Avg - prom.Avg
+	for i, p := range fortio.Percentiles {
+		d := stats.Percentile{Percentile: p.Percentile, Value: p.Value}
+		if prom.Count > 0 {
+			d.Value -= prom.Percentiles[i].Value
+		}
+		res.PercentileDeltas = append(res.PercentileDeltas, d)
+	}
+	return &res
+}
+
+// RESTComparePrometheusHandler fetches the prometheus scrape `url` and compares the `metric`
+// histogram it contains with the duration histogram of the saved fortio result `id`.
+func RESTComparePrometheusHandler(w http.ResponseWriter, r *http.Request) {
+	log.LogRequest(r, "REST Compare Prometheus call")
+	w.Header().Set("Content-Type", "application/json")
+	resID := r.FormValue("id")
+	if !validResultID(resID) {
+		Error(w, "invalid or missing result id", nil)
+		return
+	}
+	scrapeURL := r.FormValue("url")
+	metric := r.FormValue("metric")
+	if scrapeURL == "" || metric == "" {
+		Error(w, "url and metric are required", nil)
+		return
+	}
+	data, err := os.ReadFile(path.Join(dataDir, resID+JSONExtension))
+	if err != nil {
+		log.Errf("Unable to read result %q: %v", resID, err)
+		Error(w, "unable to read result", err)
+		return
+	}
+	var result periodic.RunnerResults
+	if err = json.Unmarshal(data, &result); err != nil || result.DurationHistogram == nil {
+		log.Errf("Unable to deserialize result %q: %v", resID, err)
+		Error(w, "result json deserialization error", err)
+		return
+	}
+	o := fhttp.NewHTTPOptions(scrapeURL)
+	o.DisableFastClient = true // we just want the body
+	code, scrape := fhttp.Fetch(o)
+	if code != http.StatusOK {
+		Error(w, fmt.Sprintf("unable to scrape %s, status %d", scrapeURL, code), nil)
+		return
+	}
+	prom, skipped, err := stats.ParsePrometheusHistogram(scrape, metric)
+	if err != nil {
+		Error(w, "unable to parse prometheus histogram", err)
+		return
+	}
+	if skipped > 0 {
+		log.S(log.Warning, "Skipped malformed prometheus scrape lines", log.Str("url", scrapeURL), log.Attr("count", skipped))
+	}
+	percentiles := make([]float64, 0, len(result.DurationHistogram.Percentiles))
+	for _, p := range result.DurationHistogram.Percentiles {
+		percentiles = append(percentiles, p.Percentile)
+	}
+	if len(percentiles) == 0 {
+		percentiles = DefaultComparePercentiles
+	}
+	res := ComparePrometheus(result.DurationHistogram, prom, percentiles)
+	res.ResultID = resID
+	res.SkippedLines = skipped
+	res.Metric = metric
+	if err = jrpc.ReplyOk(w, res); err != nil {
+		log.Errf("Error replying to compare prometheus: %v", err)
+	}
+}
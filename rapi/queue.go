@@ -0,0 +1,217 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rapi // import "fortio.org/fortio/rapi"
+
+import (
+	"container/heap"
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"fortio.org/fortio/jrpc"
+	"fortio.org/log"
+)
+
+// RestQueueURI is the endpoint returning the runs waiting for a slot (see MaxConcurrentRuns).
+const RestQueueURI = "rest/queue"
+
+// FairScheduleInterval is how long a run must wait in the queue to get its priority increased by 1
+// when FairSchedule is on.
+const FairScheduleInterval = 10 * time.Second
+
+var (
+	// MaxConcurrentRuns is the maximum number of REST/UI runs executing at the same time, 0 (default)
+	// for unlimited. Additional runs wait, in their State pending, in a queue ordered by the runs'
+	// priority (higher first) then arrival order. Must be set before AddHandlers.
+	MaxConcurrentRuns int
+	// FairSchedule prevents the starvation of low priority queued runs: their priority is increased
+	// by 1 for each FairScheduleInterval spent waiting.
+	FairSchedule = true
+
+	runQueueMutex sync.Mutex
+	runQueue      = &waitingRuns{}
+	runningCount  int // number of runs holding a slot, protected by runQueueMutex
+	queueSeq      int64
+)
+
+// queuedRun is a run waiting for a slot.
+type queuedRun struct {
+	runID    int64
+	priority int
+	enqueued time.Time
+	seq      int64         // arrival order, to keep FIFO within a priority
+	ready    chan struct{} // closed when the run gets its slot
+}
+
+// waitingRuns is the heap of queued runs: the top is the run with the highest effective priority,
+// the earliest one in case of ties.
+type waitingRuns struct {
+	items []*queuedRun
+	now   time.Time // reference time for the effective (fair schedule) priorities
+}
+
+// effectivePriority returns the priority of q including the fair schedule increments.
+func (w *waitingRuns) effectivePriority(q *queuedRun) int {
+	if !FairSchedule {
+		return q.priority
+	}
+	return q.priority + int(w.now.Sub(q.enqueued)/FairScheduleInterval)
+}
+
+func (w *waitingRuns) Len() int { return len(w.items) }
+
+func (w *waitingRuns) Less(i, j int) bool {
+	pi, pj := w.effectivePriority(w.items[i]), w.effectivePriority(w.items[j])
+	if pi != pj {
+		return pi > pj
+	}
+	return w.items[i].seq < w.items[j].seq
+}
+
+func (w *waitingRuns) Swap(i, j int) { w.items[i], w.items[j] = w.items[j], w.items[i] }
+
+func (w *waitingRuns) Push(x any) { w.items = append(w.items, x.(*queuedRun)) }
+
+func (w *waitingRuns) Pop() any {
+	n := len(w.items)
+	q := w.items[n-1]
+	w.items[n-1] = nil
+	w.items = w.items[:n-1]
+	return q
+}
+
+// remove removes q from the heap, returns false if it isn't queued (anymore).
+// Must be called with runQueueMutex held.
+func (w *waitingRuns) remove(q *queuedRun) bool {
+	for i, item := range w.items {
+		if item == q {
+			heap.Remove(w, i)
+			return true
+		}
+	}
+	return false
+}
+
+// reorder updates the heap for the current effective priorities (which change with the waiting time).
+// Must be called with runQueueMutex held.
+func (w *waitingRuns) reorder() {
+	w.now = time.Now()
+	heap.Init(w)
+}
+
+// acquireRunSlot blocks until the run can execute according to MaxConcurrentRuns and its priority,
+// or until ctx is done (run stopped while queued or sync client gone): it then returns false and the
+// run must not execute. Each true return must be followed by a releaseRunSlot once the run is done.
+func acquireRunSlot(ctx context.Context, runID int64, priority int) bool {
+	runQueueMutex.Lock()
+	if MaxConcurrentRuns <= 0 || (runningCount < MaxConcurrentRuns && runQueue.Len() == 0) {
+		runningCount++
+		runQueueMutex.Unlock()
+		return true
+	}
+	queueSeq++
+	q := &queuedRun{runID: runID, priority: priority, enqueued: time.Now(), seq: queueSeq, ready: make(chan struct{})}
+	runQueue.reorder()
+	heap.Push(runQueue, q)
+	n := runQueue.Len()
+	runQueueMutex.Unlock()
+	log.S(log.Info, "Run queued", log.Attr("run", runID), log.Attr("priority", priority), log.Attr("waiting", n))
+	select {
+	case <-q.ready:
+	case <-ctx.Done():
+		runQueueMutex.Lock()
+		removed := runQueue.remove(q)
+		runQueueMutex.Unlock()
+		if !removed {
+			releaseRunSlot() // got the slot at the same time, give it to the next one.
+		}
+		log.S(log.Info, "Queued run abandoned", log.Attr("run", runID), log.Attr("waited", time.Since(q.enqueued)))
+		return false
+	}
+	log.S(log.Info, "Run dequeued", log.Attr("run", runID), log.Attr("waited", time.Since(q.enqueued)))
+	return true
+}
+
+// releaseRunSlot frees the slot of a finished run, starting the next queued ones.
+func releaseRunSlot() {
+	runQueueMutex.Lock()
+	runningCount--
+	if runQueue.Len() > 0 {
+		runQueue.reorder()
+	}
+	for runQueue.Len() > 0 && (MaxConcurrentRuns <= 0 || runningCount < MaxConcurrentRuns) {
+		q := heap.Pop(runQueue).(*queuedRun)
+		runningCount++
+		close(q.ready)
+	}
+	runQueueMutex.Unlock()
+}
+
+// QueuedRun is the state of a run waiting for a slot.
+type QueuedRun struct {
+	RunID int64
+	// Priority requested for the run.
+	Priority int
+	// Priority including the FairSchedule increments, used for the ordering.
+	EffectivePriority int
+	// Time spent waiting so far.
+	Waiting time.Duration
+}
+
+// QueueReply is the reply of the queue endpoint.
+type QueueReply struct {
+	jrpc.ServerReply
+	MaxConcurrentRuns int
+	FairSchedule      bool
+	// Number of runs currently executing.
+	Running int
+	// Runs waiting for a slot, in the order they'll start (as of now).
+	Queue []QueuedRun
+}
+
+// GetQueue returns the current state of the runs queue.
+func GetQueue() QueueReply {
+	runQueueMutex.Lock()
+	defer runQueueMutex.Unlock()
+	reply := QueueReply{
+		MaxConcurrentRuns: MaxConcurrentRuns,
+		FairSchedule:      FairSchedule,
+		Running:           runningCount,
+		Queue:             make([]QueuedRun, 0, runQueue.Len()),
+	}
+	runQueue.reorder()
+	sorted := &waitingRuns{items: append([]*queuedRun(nil), runQueue.items...), now: runQueue.now}
+	sort.Sort(sorted)
+	for _, q := range sorted.items {
+		reply.Queue = append(reply.Queue, QueuedRun{
+			RunID:             q.runID,
+			Priority:          q.priority,
+			EffectivePriority: sorted.effectivePriority(q),
+			Waiting:           sorted.now.Sub(q.enqueued),
+		})
+	}
+	return reply
+}
+
+// RESTQueueHandler replies with the runs waiting for a slot (see MaxConcurrentRuns), in start order.
+func RESTQueueHandler(w http.ResponseWriter, r *http.Request) {
+	log.LogRequest(r, "REST Queue call")
+	reply := GetQueue()
+	if err := jrpc.ReplyOk(w, &reply); err != nil {
+		log.Errf("Error replying to queue: %v", err)
+	}
+}
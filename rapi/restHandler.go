@@ -16,7 +16,9 @@
 package rapi // import "fortio.org/fortio/rapi"
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -44,6 +46,7 @@ const (
 	RestStatusURI = "rest/status"
 	RestStopURI   = "rest/stop"
 	RestDNS       = "rest/dns"
+	RestReplayURI = "rest/replay"
 	ModeGRPC      = "grpc"
 )
 
@@ -78,6 +81,12 @@ type Status struct {
 	State         StateEnum
 	RunnerOptions *periodic.RunnerOptions
 	aborter       *periodic.Aborter
+	notifyURL     string    // webhook to POST the result to when the async run completes.
+	startTime     time.Time // when the run started (UpdateRun), for the live actual qps.
+	cancelQueued  func()    // removes the pending run from the queue (see MaxConcurrentRuns).
+	live          bool      // live histograms requested (live=on), see CompareRuns.
+	// User who started the run when using APITokens.
+	User string `json:",omitempty"`
 }
 
 type StatusMap map[int64]*Status
@@ -191,6 +200,40 @@ func FormValue(r *http.Request, json map[string]interface{}, key string) string
 	return res
 }
 
+// runTags returns the run tags from the `tags` JSON object (of strings), either JSON encoded in the
+// query arguments or directly an object (or a JSON encoded string) in the json data.
+func runTags(r *http.Request, jd map[string]interface{}) (map[string]string, error) {
+	if tagsStr := r.FormValue("tags"); tagsStr != "" {
+		return parseTags(tagsStr)
+	}
+	switch v := jd["tags"].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return parseTags(v)
+	case map[string]interface{}:
+		tags := make(map[string]string, len(v))
+		for k, tv := range v {
+			s, ok := tv.(string)
+			if !ok {
+				return nil, fmt.Errorf("tag %q value must be a string, got %T: %v", k, tv, tv)
+			}
+			tags[k] = s
+		}
+		return tags, nil
+	default:
+		return nil, fmt.Errorf("tags must be a JSON object of strings, got %T: %v", v, v)
+	}
+}
+
+func parseTags(tagsStr string) (map[string]string, error) {
+	var tags map[string]string
+	if err := json.Unmarshal([]byte(tagsStr), &tags); err != nil {
+		return nil, fmt.Errorf("tags must be a JSON object of strings: %w", err)
+	}
+	return tags, nil
+}
+
 // RESTRunHandler is API version of UI submit handler.
 // TODO: refactor common option/args/flag parsing between uihandler.go and this.
 func RESTRunHandler(w http.ResponseWriter, r *http.Request) { //nolint:funlen
@@ -234,9 +277,12 @@ func RESTRunHandler(w http.ResponseWriter, r *http.Request) { //nolint:funlen
 	uniform := (FormValue(r, jd, "uniform") == "on")
 	logErrors := (FormValue(r, jd, "log-errors") == "on")
 	nocatchup := (FormValue(r, jd, "nocatchup") == "on")
+	useHDR := (FormValue(r, jd, "hdr") == "on")
+	shardedHistogram := (FormValue(r, jd, "sharded-histogram") == "on")
 	stdClient := (FormValue(r, jd, "stdclient") == "on")
 	h2 := (FormValue(r, jd, "h2") == "on")
 	sequentialWarmup := (FormValue(r, jd, "sequential-warmup") == "on")
+	serverTiming := (FormValue(r, jd, "server-timing") == "on")
 	httpsInsecure := (FormValue(r, jd, "https-insecure") == "on")
 	resolve := FormValue(r, jd, "resolve")
 	timeoutStr := strings.TrimSpace(FormValue(r, jd, "timeout"))
@@ -262,6 +308,18 @@ func RESTRunHandler(w http.ResponseWriter, r *http.Request) { //nolint:funlen
 		Error(w, "URL is required", nil)
 		return
 	}
+	tags, err := runTags(r, jd)
+	if err != nil {
+		Error(w, "invalid tags", err)
+		return
+	}
+	notifyURL := FormValue(r, jd, "notify-url")
+	if notifyURL != "" {
+		if err = ValidateWebhookURL(notifyURL); err != nil {
+			Error(w, "invalid notify-url", err)
+			return
+		}
+	}
 	ro := periodic.RunnerOptions{
 		QPS:         qps,
 		Duration:    dur,
@@ -270,14 +328,24 @@ func RESTRunHandler(w http.ResponseWriter, r *http.Request) { //nolint:funlen
 		Resolution:  resolution,
 		Percentiles: percList,
 		Labels:      labels,
+		Tags:        tags,
 		Exactly:     n,
 		Jitter:      jitter,
 		Uniform:     uniform,
 		NoCatchUp:   nocatchup,
+		UseHDR:      useHDR,
+
+		ShardedHistogram: shardedHistogram,
 	}
 	runid := NextRunID()
 	ro.RunID = runid
 	log.Infof("New run id %d", runid)
+	if user, ok := UserFromContext(r.Context()); ok {
+		SetRunUser(runid, user)
+	}
+	if FormValue(r, jd, "live") == "on" {
+		setRunLive(runid)
+	}
 	defaultOptionsCopy := *fhttp.DefaultHTTPOptions
 	httpopts := &defaultOptionsCopy
 	httpopts.HTTPReqTimeOut = timeout // to be normalized in init, 0 is replaced by default value (for all runners)
@@ -288,6 +356,7 @@ func RESTRunHandler(w http.ResponseWriter, r *http.Request) { //nolint:funlen
 	httpopts.Insecure = httpsInsecure
 	httpopts.Resolve = resolve
 	httpopts.H2 = h2
+	httpopts.ParseServerTiming = serverTiming
 	httpopts.LogErrors = logErrors
 	httpopts.MethodOverride = methodOverride
 	// Set the connection reuse range.
@@ -337,6 +406,9 @@ func RESTRunHandler(w http.ResponseWriter, r *http.Request) { //nolint:funlen
 	// in case of init error.
 	ro.GenID()
 	if async {
+		if notifyURL != "" {
+			SetNotifyURL(runid, notifyURL)
+		}
 		reply := AsyncReply{RunID: runid, Count: 1, ResultID: ro.ID, ResultURL: ID2URL(r, ro.ID)}
 		reply.Message = "started" //nolint:goconst
 		err := jrpc.ReplyOk(w, &reply)
@@ -361,6 +433,30 @@ func Run(w http.ResponseWriter, r *http.Request, jd map[string]interface{},
 	var res periodic.HasRunnerResult
 	var err error
 	var aborter *periodic.Aborter
+	priority, _ := strconv.Atoi(FormValue(r, jd, "priority"))
+	// While queued, the run is abandoned when stopped or, for sync runs, when the client goes away.
+	ctx := context.Background()
+	if w != nil || htmlMode {
+		ctx = r.Context()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	setQueueCancel(ro.RunID, cancel)
+	acquired := acquireRunSlot(ctx, ro.RunID, priority)
+	if acquired && !setQueueCancel(ro.RunID, nil) {
+		releaseRunSlot() // stopped just as it got its slot.
+		acquired = false
+	}
+	if !acquired {
+		RemoveRun(ro.RunID)
+		notifyGlobalWebhook(EventStopped, ro.RunID, StateStopped, "")
+		err = errors.New("run stopped while queued")
+		if w != nil && !htmlMode {
+			Error(w, "Run not started", err)
+		}
+		return nil, "", nil, err
+	}
+	defer releaseRunSlot()
 	if hook != nil {
 		hook(httpopts, ro)
 	}
@@ -430,6 +526,17 @@ func Run(w http.ResponseWriter, r *http.Request, jd map[string]interface{},
 	if doSave && id != "" {
 		savedAs = SaveJSON(id, jsonData)
 	}
+	if notifyURL := getNotifyURL(ro.RunID); notifyURL != "" && res != nil {
+		go notifyWebhook(ro.RunID, notifyURL, res)
+	}
+	event, resultURL := EventStopped, ""
+	if err != nil {
+		event = EventError
+	}
+	if savedAs != "" && r != nil {
+		resultURL = ID2URL(r, id)
+	}
+	notifyGlobalWebhook(event, ro.RunID, StateStopped, resultURL)
 	if err != nil {
 		log.Errf("Init error for %s mode with url %s and options %+v : %v", runner, url, ro, err)
 		if !htmlMode {
@@ -452,6 +559,73 @@ func Run(w http.ResponseWriter, r *http.Request, jd map[string]interface{},
 	return res, savedAs, jsonData, nil
 }
 
+// RESTReplayHandler starts a new http run using the options of a previously saved
+// result (POST with id=saved result id, also supports async=on and save=on).
+func RESTReplayHandler(w http.ResponseWriter, r *http.Request) {
+	log.LogRequest(r, "REST Replay call")
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost {
+		Error(w, "replay requires POST", nil)
+		return
+	}
+	resID := r.FormValue("id")
+	if !validResultID(resID) {
+		Error(w, "invalid or missing result id", nil)
+		return
+	}
+	data, err := os.ReadFile(path.Join(dataDir, resID+JSONExtension))
+	if err != nil {
+		log.Errf("Unable to read result %q: %v", resID, err)
+		Error(w, "unable to read result", err)
+		return
+	}
+	var previous fhttp.HTTPRunnerResults
+	if err = json.Unmarshal(data, &previous); err != nil {
+		log.Errf("Unable to deserialize result %q: %v", resID, err)
+		Error(w, "result json deserialization error", err)
+		return
+	}
+	if previous.OriginalOptions == nil {
+		Error(w, "result doesn't include the original options (not an http run or older version)", nil)
+		return
+	}
+	httpopts := &previous.OriginalOptions.HTTPOptions
+	for _, h := range previous.OriginalOptions.Headers {
+		if name, value, _ := strings.Cut(h, ":"); value == fhttp.RedactedHeaderValue {
+			log.Warnf("Not replaying the redacted %s header of %s", name, resID)
+			continue
+		}
+		if err = httpopts.AddAndValidateExtraHeader(h); err != nil {
+			Error(w, "invalid header in the original options", err)
+			return
+		}
+	}
+	ro := previous.OriginalOptions.RunnerOptions
+	ro.Out = os.Stdout
+	ro.ID = ""
+	runid := NextRunID()
+	ro.RunID = runid
+	ro.GenID()
+	if user, ok := UserFromContext(r.Context()); ok {
+		SetRunUser(runid, user)
+	}
+	url := httpopts.URL
+	log.Infof("Replaying %s as new run id %d for %s", resID, runid, url)
+	if FormValue(r, nil, "async") == "on" {
+		reply := AsyncReply{RunID: runid, Count: 1, ResultID: ro.ID, ResultURL: ID2URL(r, ro.ID)}
+		reply.Message = "started"
+		err := jrpc.ReplyOk(w, &reply)
+		if err != nil {
+			log.Errf("Error replying to start: %v", err)
+		}
+		//nolint:errcheck,contextcheck // all cases handled inside for rapi callers. async code with our own aborter
+		go Run(nil, r, nil, "http", url, &ro, httpopts, false)
+		return
+	}
+	//nolint:errcheck,contextcheck // all cases handled inside for rapi callers. aborter handles context.
+	Run(w, r, nil, "http", url, &ro, httpopts, false)
+}
+
 // RESTStatusHandler will print the state of the runs.
 func RESTStatusHandler(w http.ResponseWriter, r *http.Request) {
 	log.LogRequest(r, "REST Status call")
@@ -477,7 +651,13 @@ func RESTStopHandler(w http.ResponseWriter, r *http.Request) {
 	runid, _ := strconv.ParseInt(r.FormValue("runid"), 10, 64)
 	waitStr := strings.ToLower(r.FormValue("wait"))
 	wait := (waitStr != "" && waitStr != "off" && waitStr != "false")
-	i, rid := StopByRunID(runid, wait)
+	user, _ := UserFromContext(r.Context())
+	i, rid, allowed := stopRuns(runid, wait, user)
+	if !allowed {
+		log.S(log.Warning, "Run stop denied", log.Attr("runid", runid), log.Str("user", user))
+		_ = jrpc.Reply(w, http.StatusForbidden, jrpc.NewErrorReply("run started by another user", nil))
+		return
+	}
 	log.Debugf("REST Stop completed, stopped %d runs, rid %s", i, rid)
 	reply := AsyncReply{RunID: runid, Count: i, ResultID: rid, ResultURL: ID2URL(r, rid)}
 	if wait && i == 1 {
@@ -494,11 +674,25 @@ func RESTStopHandler(w http.ResponseWriter, r *http.Request) {
 // StopByRunID stops all the runs if passed 0 or the runid provided.
 // if wait is true, waits for the run to actually end (single only).
 func StopByRunID(runid int64, wait bool) (int, string) {
+	i, rid, _ := stopRuns(runid, wait, "")
+	return i, rid
+}
+
+// stopRuns is StopByRunID for user (empty when not using APITokens): stop all only stops the
+// runs user can stop and allowed is false when the single runid was started by another user.
+func stopRuns(runid int64, wait bool, user string) (int, string, bool) {
 	uiRunMapMutex.Lock()
 	rid := ""
 	if runid <= 0 { // Stop all
 		i := 0
 		for _, v := range runs {
+			if !canStop(user, v) {
+				continue
+			}
+			if dequeue(v) {
+				i++
+				continue
+			}
 			if v.State != StateRunning {
 				continue
 			}
@@ -513,7 +707,7 @@ func StopByRunID(runid int64, wait bool) (int, string) {
 			// if we stopped more than 1 don't mislead that we have the file IDs
 			rid = ""
 		}
-		return i, rid
+		return i, rid, true
 	}
 	// else: Stop one
 	v, found := runs[runid]
@@ -521,12 +715,21 @@ func StopByRunID(runid int64, wait bool) (int, string) {
 	if !found {
 		uiRunMapMutex.Unlock()
 		log.Infof("Runid %d not found to interrupt", runid)
-		return 0, rid
+		return 0, rid, true
+	}
+	if !canStop(user, v) {
+		uiRunMapMutex.Unlock()
+		return 0, rid, false
+	}
+	if dequeue(v) {
+		uiRunMapMutex.Unlock()
+		log.Infof("Runid %d stopped while queued", runid)
+		return 1, rid, true
 	}
 	if v.State != StateRunning {
 		uiRunMapMutex.Unlock()
 		log.Infof("Runid %d is not running it's %s", runid, v.State.String())
-		return 0, rid
+		return 0, rid, true
 	}
 	rid = v.RunnerOptions.ID
 	v.State = StateStopping
@@ -539,7 +742,34 @@ func StopByRunID(runid int64, wait bool) (int, string) {
 		log.LogVf("REST stop, received all done signal got %v", b)
 	}
 	log.LogVf("Returning from Abort %d call with wait %v", runid, wait)
-	return 1, rid
+	return 1, rid, true
+}
+
+// setQueueCancel records how to remove the pending run runid from the queue, nil once it got its slot.
+// Returns false when the run was stopped while queued.
+func setQueueCancel(runid int64, cancel func()) bool {
+	uiRunMapMutex.Lock()
+	defer uiRunMapMutex.Unlock()
+	status, found := runs[runid]
+	if !found {
+		return true
+	}
+	if status.State == StateStopped {
+		return false
+	}
+	status.cancelQueued = cancel
+	return true
+}
+
+// dequeue stops the run v if it is waiting in the queue, returns false otherwise.
+// Must be called with uiRunMapMutex held.
+func dequeue(v *Status) bool {
+	if v.State != StatePending || v.cancelQueued == nil {
+		return false
+	}
+	v.State = StateStopped // Run() removes it.
+	v.cancelQueued()
+	return true
 }
 
 func RemoveRun(id int64) {
@@ -581,14 +811,41 @@ func AddHandlers(ahook bincommon.FortioHook, mux *http.ServeMux, baseurl, uiPath
 	hook = ahook
 	AddDataHandler(mux, baseurl, uiPath, datadir)
 	restRunPath := uiPath + RestRunURI
-	mux.HandleFunc(restRunPath, RESTRunHandler)
+	mux.Handle(restRunPath, withCORS(withAuth(RESTRunHandler)))
 	restStatusPath := uiPath + RestStatusURI
-	mux.HandleFunc(restStatusPath, RESTStatusHandler)
+	mux.Handle(restStatusPath, withCORS(http.HandlerFunc(RESTStatusHandler)))
 	restStopPath := uiPath + RestStopURI
-	mux.HandleFunc(restStopPath, RESTStopHandler)
+	mux.Handle(restStopPath, withCORS(withAuth(RESTStopHandler)))
 	dnsPath := uiPath + RestDNS
-	mux.HandleFunc(dnsPath, RESTDNSHandler)
-	log.Printf("REST API on %s, %s, %s, %s", restRunPath, restStatusPath, restStopPath, dnsPath)
+	mux.Handle(dnsPath, withCORS(http.HandlerFunc(RESTDNSHandler)))
+	restReplayPath := uiPath + RestReplayURI
+	mux.Handle(restReplayPath, withCORS(withAuth(RESTReplayHandler)))
+	restComparePromPath := uiPath + RestComparePrometheusURI
+	mux.Handle(restComparePromPath, withCORS(http.HandlerFunc(RESTComparePrometheusHandler)))
+	restDataPath := uiPath + RestDataURI
+	mux.Handle(restDataPath, withCORS(fhttp.Gzip(http.HandlerFunc(RESTDataHandler))))
+	restSearchPath := uiPath + RestSearchURI
+	mux.Handle(restSearchPath, withCORS(http.HandlerFunc(RESTSearchHandler)))
+	restComparePath := uiPath + RestCompareURI
+	mux.Handle(restComparePath, withCORS(http.HandlerFunc(RESTCompareHandler)))
+	restLivePath := uiPath + RestLiveURI
+	mux.Handle(restLivePath, withCORS(http.HandlerFunc(RESTLiveHandler)))
+	restOpenAPIPath := uiPath + RestOpenAPIURI
+	mux.Handle(restOpenAPIPath, withCORS(http.HandlerFunc(RESTOpenAPIHandler)))
+	restQueuePath := uiPath + RestQueueURI
+	mux.Handle(restQueuePath, withCORS(http.HandlerFunc(RESTQueueHandler)))
+	log.Printf("REST API on %s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s", restRunPath, restStatusPath, restStopPath,
+		dnsPath, restReplayPath, restComparePromPath, restDataPath, restSearchPath, restComparePath, restLivePath,
+		restOpenAPIPath, restQueuePath)
+	if APITokens != nil {
+		log.Infof("REST run, replay and stop require one of the %d API tokens", len(APITokens))
+	}
+	if CORSOrigin != "" {
+		log.Infof("REST API allowing CORS requests from origin %q", CORSOrigin)
+	}
+	if MaxConcurrentRuns > 0 {
+		log.Infof("REST API running at most %d runs at a time (fair schedule %v)", MaxConcurrentRuns, FairSchedule)
+	}
 }
 
 // SaveJSON save JSON bytes to give file name (.json) in data-path dir.
@@ -604,6 +861,10 @@ func SaveJSON(name string, json []byte) string {
 		log.Errf("Unable to save %s in %s: %v", name, dataDir, err)
 		return ""
 	}
+	// For integrity verification, see VerifyResultChecksum.
+	if err = WriteChecksum(path.Join(dataDir, name), json); err != nil {
+		log.Errf("Unable to save checksum of %s in %s: %v", name, dataDir, err)
+	}
 	// Return the relative path from the /fortio/ UI
 	return DataDir + name
 }
@@ -634,7 +895,15 @@ func UpdateRun(ro *periodic.RunnerOptions) *periodic.Aborter {
 	status.RunnerOptions = ro
 	status.RunnerOptions.Normalize()
 	status.aborter = status.RunnerOptions.Stop // save the aborter before it gets cleared in newPeriodicRunner.
+	if status.live {
+		// Live histograms for CompareRuns (the options, including these pointers, get copied into the runner).
+		status.RunnerOptions.LiveHistogram = status.RunnerOptions.NewLiveHistogram()
+		status.RunnerOptions.LiveErrorHistogram = status.RunnerOptions.NewLiveHistogram()
+		status.RunnerOptions.LiveRate = stats.NewRateTracker(0)
+	}
+	status.startTime = time.Now()
 	uiRunMapMutex.Unlock()
+	notifyGlobalWebhook(EventStarted, ro.RunID, StateRunning, "")
 	return status.aborter
 }
 
@@ -16,14 +16,25 @@
 package rapi
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -32,9 +43,11 @@ import (
 	"fortio.org/fortio/fnet"
 	"fortio.org/fortio/jrpc"
 	"fortio.org/fortio/periodic"
+	"fortio.org/fortio/stats"
 	"fortio.org/fortio/tcprunner"
 	"fortio.org/fortio/udprunner"
 	"fortio.org/log"
+	"fortio.org/sets"
 )
 
 // Generics ftw.
@@ -624,6 +637,68 @@ func TestOtherRunnersRESTApi(t *testing.T) {
 	}
 }
 
+func TestReplayRESTApi(t *testing.T) {
+	mux, addr := fhttp.DynamicHTTPServer(false)
+	mux.HandleFunc("/foo/", fhttp.EchoHandler)
+	var withHeaders atomic.Int64
+	mux.HandleFunc("/headers/", func(_ http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Replay-Test") == "foo" && r.Host == "replay.example.com" {
+			withHeaders.Add(1)
+		}
+	})
+	tmpDir := t.TempDir()
+	AddHandlers(nil, mux, "", "/fortio/", tmpDir)
+	restURL := fmt.Sprintf("http://localhost:%d/fortio/", addr.Port)
+	echoURL := fmt.Sprintf("localhost:%d/foo/", addr.Port)
+	// Replay with -H headers, including Host:
+	runURL := fmt.Sprintf("%s%s?qps=-1&n=5&c=1&url=localhost:%d/headers/&save=on&H=%s&H=%s&H=%s",
+		restURL, RestRunURI, addr.Port, "X-Replay-Test:foo", "Host:replay.example.com", "X-Api-Key:s3cr3t")
+	res := GetResult(t, runURL, "")
+	if res.Error || res.OriginalOptions == nil || len(res.OriginalOptions.Headers) == 0 {
+		t.Fatalf("Unexpected original run with headers %+v", res)
+	}
+	// The credentials aren't saved.
+	if !slices.Contains(res.OriginalOptions.Headers, "X-Api-Key:"+fhttp.RedactedHeaderValue) {
+		t.Errorf("Expected the api key header to be redacted, got %v", res.OriginalOptions.Headers)
+	}
+	replay := FetchResult[fhttp.HTTPRunnerResults](t, restURL+RestReplayURI+"?id="+res.Result().ID, "{}")
+	if replay.Error {
+		t.Fatalf("Unexpected error in headers replay: %+v", replay)
+	}
+	if n := withHeaders.Load(); n != 10 {
+		t.Errorf("Expected the 5 calls of the run and of its replay with the headers, got %d", n)
+	}
+	runURL = fmt.Sprintf("%s%s?qps=-1&n=10&c=2&url=%s&save=on&labels=replay-test", restURL, RestRunURI, echoURL)
+	res = GetResult(t, runURL, "")
+	if res.Error {
+		t.Fatalf("Unexpected error in original run: %+v", res)
+	}
+	if res.OriginalOptions == nil {
+		t.Fatalf("Expected OriginalOptions to be set in result")
+	}
+	if res.OriginalOptions.Exactly != 10 || res.OriginalOptions.NumThreads != 2 {
+		t.Errorf("Unexpected original options %+v", res.OriginalOptions.RunnerOptions)
+	}
+	replayURL := restURL + RestReplayURI + "?id=" + res.Result().ID
+	replay = FetchResult[fhttp.HTTPRunnerResults](t, replayURL, "{}") // non empty payload to get a POST
+	if replay.Error {
+		t.Fatalf("Unexpected error in replay: %+v", replay)
+	}
+	if replay.Result().ID == res.Result().ID || replay.RunID == res.RunID {
+		t.Errorf("Replay should be a new run: %s %d vs %s %d", replay.Result().ID, replay.RunID, res.Result().ID, res.RunID)
+	}
+	if replay.DurationHistogram.Count != 10 || replay.RetCodes[http.StatusOK] != 10 {
+		t.Errorf("Unexpected replay count %d / %v", replay.DurationHistogram.Count, replay.RetCodes)
+	}
+	if replay.URL != res.URL || replay.Labels != "replay-test" {
+		t.Errorf("Replay url/labels mismatch %q %q vs %q", replay.URL, replay.Labels, res.URL)
+	}
+	// Error cases
+	GetErrorResult(t, replayURL, "") // GET
+	GetErrorResult(t, restURL+RestReplayURI+"?id=../foo", "{}")
+	GetErrorResult(t, restURL+RestReplayURI+"?id=doesnotexist", "{}")
+}
+
 func TestNextGet(t *testing.T) {
 	id := NextRunID()
 	ro := GetRun(id)
@@ -679,3 +754,966 @@ func TestStateEnum(t *testing.T) {
 	actual = se.String()
 	t.Errorf("Expected panic, got %q", actual)
 }
+
+func TestComparePrometheusRESTApi(t *testing.T) {
+	mux, addr := fhttp.DynamicHTTPServer(false)
+	mux.HandleFunc("/foo/", fhttp.EchoHandler)
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`# TYPE srv_duration_seconds histogram
+srv_duration_seconds_bucket{le="0.001"} 8
+srv_duration_seconds_bucket{le="0.01"} 10
+srv_duration_seconds_bucket{le="+Inf"} 10
+srv_duration_seconds_bucket{le="bad"} 3
+srv_duration_seconds_sum 0.005
+srv_duration_seconds_count 10
+`))
+	})
+	tmpDir := t.TempDir()
+	AddHandlers(nil, mux, "", "/fortio/", tmpDir)
+	restURL := fmt.Sprintf("http://localhost:%d/fortio/", addr.Port)
+	echoURL := fmt.Sprintf("localhost:%d/foo/", addr.Port)
+	runURL := fmt.Sprintf("%s%s?qps=-1&n=12&c=1&url=%s&save=on&p=50,90", restURL, RestRunURI, echoURL)
+	res := GetResult(t, runURL, "")
+	if res.Error {
+		t.Fatalf("Unexpected error in run: %+v", res)
+	}
+	metricsURL := fmt.Sprintf("http://localhost:%d/metrics", addr.Port)
+	compareURL := fmt.Sprintf("%s%s?id=%s&metric=srv_duration_seconds&url=%s",
+		restURL, RestComparePrometheusURI, res.Result().ID, metricsURL)
+	cmp := FetchResult[PrometheusComparison](t, compareURL, "")
+	if cmp.Error {
+		t.Fatalf("Unexpected error in compare: %+v", cmp)
+	}
+	if cmp.Prometheus.Count != 10 || cmp.Fortio.Count != 12 || cmp.CountDelta != 2 || cmp.SkippedLines != 1 {
+		t.Errorf("Unexpected counts %d %d %d %d", cmp.Prometheus.Count, cmp.Fortio.Count, cmp.CountDelta, cmp.SkippedLines)
+	}
+	if len(cmp.PercentileDeltas) != 2 || cmp.PercentileDeltas[1].Percentile != 90 {
+		t.Errorf("Unexpected percentile deltas %+v", cmp.PercentileDeltas)
+	}
+	expected := cmp.Fortio.Percentiles[1].Value - cmp.Prometheus.Percentiles[1].Value
+	if cmp.PercentileDeltas[1].Value != expected {
+		t.Errorf("Unexpected p90 delta %g vs %g", cmp.PercentileDeltas[1].Value, expected)
+	}
+	// The histograms passed in aren't changed:
+	fortioH := &stats.HistogramData{Count: 1, Data: []stats.Bucket{{Interval: stats.Interval{Start: 0, End: 1}, Count: 1}},
+		Percentiles: []stats.Percentile{{Percentile: 42, Value: 0.5}}}
+	promH := &stats.HistogramData{}
+	c := ComparePrometheus(fortioH, promH, []float64{99})
+	if len(c.Fortio.Percentiles) != 1 || c.Fortio.Percentiles[0].Percentile != 99 ||
+		len(fortioH.Percentiles) != 1 || fortioH.Percentiles[0].Percentile != 42 || promH.Percentiles != nil {
+		t.Errorf("Unexpected percentiles %+v %+v %+v", c.Fortio.Percentiles, fortioH.Percentiles, promH.Percentiles)
+	}
+	// Error cases
+	base := restURL + RestComparePrometheusURI
+	GetErrorResult(t, base+"?id=../x&metric=srv_duration_seconds&url="+metricsURL, "")
+	GetErrorResult(t, base+"?id="+res.Result().ID+"&url="+metricsURL, "")
+	GetErrorResult(t, base+"?id=doesnotexist&metric=srv_duration_seconds&url="+metricsURL, "")
+	GetErrorResult(t, base+"?id="+res.Result().ID+"&metric=not_there&url="+metricsURL, "")
+	GetErrorResult(t, base+"?id="+res.Result().ID+"&metric=srv_duration_seconds&url="+metricsURL+"x", "")
+}
+
+func TestOpenAPIRESTApi(t *testing.T) {
+	mux, addr := fhttp.DynamicHTTPServer(false)
+	AddHandlers(nil, mux, "", "/fortio/", t.TempDir())
+	specURL := fmt.Sprintf("http://localhost:%d/fortio/%s", addr.Port, RestOpenAPIURI)
+	spec := FetchResult[OpenAPI](t, specURL, "")
+	if spec.OpenAPI != "3.0.3" || spec.Info.Title == "" {
+		t.Errorf("Unexpected spec header %+v", spec)
+	}
+	for _, p := range []string{RestRunURI, RestStatusURI, RestStopURI, RestDNS, RestDataListURI, RestQueueURI} {
+		item := spec.Paths["/fortio/"+p]
+		if item == nil || item.Get == nil || item.Get.Responses["200"] == nil {
+			t.Errorf("Missing GET %s in spec: %+v", p, item)
+		}
+	}
+	if item := spec.Paths["/fortio/"+RestDataURI+"{id}.json"]; item == nil || item.Delete == nil || item.Get == nil {
+		t.Errorf("Missing data delete in spec: %+v", item)
+	}
+	if item := spec.Paths["/fortio/"+RestReplayURI]; item == nil || item.Post == nil || item.Get != nil {
+		t.Errorf("Replay should be POST only: %+v", item)
+	}
+	dns := spec.Components.Schemas["rapi.DNSReply"]
+	if dns == nil || dns.Properties["IPv4"] == nil || dns.Properties["IPv4"].Type != "array" ||
+		dns.Properties["message"] == nil { // from the embedded jrpc.ServerReply
+		t.Errorf("Unexpected DNSReply schema %+v", dns)
+	}
+	summary := spec.Components.Schemas["rapi.ResultSummary"]
+	if summary == nil || summary.Properties["startTime"] == nil || summary.Properties["startTime"].Format != "date-time" {
+		t.Errorf("Unexpected ResultSummary schema (json tags) %+v", summary)
+	}
+	// All the references are defined:
+	var check func(s *Schema)
+	check = func(s *Schema) {
+		if s == nil {
+			return
+		}
+		if name, found := strings.CutPrefix(s.Ref, "#/components/schemas/"); found && spec.Components.Schemas[name] == nil {
+			t.Errorf("Undefined schema reference %q", s.Ref)
+		}
+		check(s.Items)
+		check(s.AdditionalProperties)
+		for _, p := range s.Properties {
+			check(p)
+		}
+		for _, o := range s.OneOf {
+			check(o)
+		}
+	}
+	for _, s := range spec.Components.Schemas {
+		check(s)
+	}
+	for _, item := range spec.Paths {
+		for _, op := range []*Operation{item.Get, item.Post, item.Delete} {
+			if op == nil {
+				continue
+			}
+			for _, r := range op.Responses {
+				check(r.Content["application/json"].Schema)
+			}
+		}
+	}
+}
+
+func TestCompareRunsRESTApi(t *testing.T) {
+	mux, addr := fhttp.DynamicHTTPServer(false)
+	mux.HandleFunc("/foo/", fhttp.EchoHandler)
+	AddHandlers(nil, mux, "", "/fortio/", t.TempDir())
+	restURL := fmt.Sprintf("http://localhost:%d/fortio/", addr.Port)
+	echoURL := fmt.Sprintf("localhost:%d/foo/", addr.Port)
+	// 2 async "endless" runs, the 2nd one slower and with errors:
+	runA := GetAsyncResult(t, fmt.Sprintf("%s%s?qps=20&t=on&c=1&p=50,99&url=%s&async=on&live=on&sharded-histogram=on",
+		restURL, RestRunURI, echoURL), "")
+	runB := GetAsyncResult(t, fmt.Sprintf("%s%s?qps=20&t=on&c=1&url=%s%%3Fdelay=5ms%%26status=503:50&async=on&live=on",
+		restURL, RestRunURI, echoURL), "")
+	defer StopByRunID(0, false)
+	time.Sleep(1 * time.Second)
+	uiRunMapMutex.Lock()
+	_, sharded := runs[runA.RunID].RunnerOptions.LiveHistogram.(*stats.ShardedHistogram)
+	uiRunMapMutex.Unlock()
+	if !sharded {
+		t.Errorf("Expected a sharded live histogram for run A")
+	}
+	compareURL := fmt.Sprintf("%s%s?a=%d&b=%d", restURL, RestCompareURI, runA.RunID, runB.RunID)
+	cmp := FetchResult[CompareResult](t, compareURL, "")
+	if cmp.Error {
+		t.Fatalf("Unexpected error in compare: %+v", cmp)
+	}
+	if cmp.A.RunID != runA.RunID || cmp.B.RunID != runB.RunID || cmp.A.State != StateRunning {
+		t.Errorf("Unexpected runs %+v %+v", cmp.A, cmp.B)
+	}
+	if cmp.A.DurationHistogram.Count == 0 || cmp.B.DurationHistogram.Count == 0 || cmp.A.ActualQPS <= 0 {
+		t.Errorf("Expected live data, got %+v %+v", cmp.A, cmp.B)
+	}
+	if cmp.A.ErrorCount != 0 || cmp.B.ErrorCount == 0 || cmp.ErrorCountDelta != cmp.B.ErrorCount {
+		t.Errorf("Unexpected error counts %d %d %d", cmp.A.ErrorCount, cmp.B.ErrorCount, cmp.ErrorCountDelta)
+	}
+	// B uses A's percentiles:
+	if len(cmp.PercentileDeltas) != 2 || cmp.B.DurationHistogram.Percentiles[1].Percentile != 99 {
+		t.Errorf("Unexpected percentiles %+v %+v", cmp.PercentileDeltas, cmp.B.DurationHistogram.Percentiles)
+	}
+	if cmp.AvgDelta <= 0 {
+		t.Errorf("Expected B to be slower, got avg delta %g", cmp.AvgDelta)
+	}
+	// Error cases
+	base := restURL + RestCompareURI
+	GetErrorResult(t, base, "")
+	GetErrorResult(t, fmt.Sprintf("%s?a=%d&b=x", base, runA.RunID), "")
+	GetErrorResult(t, fmt.Sprintf("%s?a=%d&b=%d", base, runA.RunID, runB.RunID+1000), "")
+}
+
+func TestLiveRESTApi(t *testing.T) {
+	mux, addr := fhttp.DynamicHTTPServer(false)
+	mux.HandleFunc("/foo/", fhttp.EchoHandler)
+	AddHandlers(nil, mux, "", "/fortio/", t.TempDir())
+	restURL := fmt.Sprintf("http://localhost:%d/fortio/", addr.Port)
+	echoURL := fmt.Sprintf("localhost:%d/foo/", addr.Port)
+	run := GetAsyncResult(t, fmt.Sprintf("%s%s?qps=50&t=on&c=1&url=%s&async=on&live=on",
+		restURL, RestRunURI, echoURL), "")
+	defer StopByRunID(0, false)
+	resp, err := http.Get(fmt.Sprintf("%s%s?runid=%d", restURL, RestLiveURI, run.RunID))
+	if err != nil {
+		t.Fatalf("Unable to get the live stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Unexpected content type %q", ct)
+	}
+	// 3 snapshots, the last one after the runner sampled the rate at least once.
+	scanner := bufio.NewScanner(resp.Body)
+	var snapshot LiveRunSnapshot
+	for events := 0; events < 3 && scanner.Scan(); {
+		data, found := strings.CutPrefix(scanner.Text(), "data: ")
+		if !found {
+			continue
+		}
+		events++
+		if err = json.Unmarshal([]byte(data), &snapshot); err != nil {
+			t.Fatalf("Unable to unmarshal %q: %v", data, err)
+		}
+	}
+	if snapshot.RunID != run.RunID || snapshot.CurrentQPS < 25 || snapshot.CurrentQPS > 100 {
+		t.Errorf("Unexpected live snapshot %+v", snapshot)
+	}
+	StopByRunID(run.RunID, true)
+	ended := false
+	for scanner.Scan() {
+		if scanner.Text() == "event: end" {
+			ended = true
+		}
+	}
+	if !ended {
+		t.Errorf("Expected an end event once the run is stopped")
+	}
+	GetErrorResult(t, restURL+RestLiveURI, "")
+	GetErrorResult(t, fmt.Sprintf("%s%s?runid=%d", restURL, RestLiveURI, run.RunID), "")
+}
+
+func TestDeleteResultRESTApi(t *testing.T) {
+	mux, addr := fhttp.DynamicHTTPServer(false)
+	tmpDir := t.TempDir()
+	AddHandlers(nil, mux, "", "/fortio/", tmpDir)
+	if err := os.WriteFile(path.Join(tmpDir, "to-delete.json"), []byte("{}"), 0o644); err != nil {
+		t.Fatalf("Unable to create test result: %v", err)
+	}
+	dataURL := fmt.Sprintf("http://localhost:%d/fortio/%sto-delete.json", addr.Port, RestDataURI)
+	tok := FetchResult[DeleteTokenReply](t, dataURL+"?confirm-token=true", "")
+	if tok.Error || tok.Token == "" || tok.ID != "to-delete" {
+		t.Fatalf("Unexpected token reply %+v", tok)
+	}
+	// Token is for that id only, and must be valid:
+	if err := DeleteResult("other", tok.Token); err == nil {
+		t.Errorf("Token should not be valid for another id")
+	}
+	if err := DeleteResult("to-delete", tok.Token+"x"); err == nil {
+		t.Errorf("Tampered token should not be valid")
+	}
+	if err := DeleteResult("to-delete", "123.abc"); err == nil {
+		t.Errorf("Forged token should not be valid")
+	}
+	expired := strconv.FormatInt(time.Now().Add(-time.Second).Unix(), 10)
+	expired += "." + deleteTokenMAC("to-delete", time.Now().Add(-time.Second).Unix())
+	if err := DeleteResult("to-delete", expired); err == nil || err.Error() != "expired token" {
+		t.Errorf("Expected expired token error, got %v", err)
+	}
+	GetErrorResult(t, dataURL, "") // GET without confirm-token
+	req, _ := http.NewRequest(http.MethodDelete, dataURL+"?token=bad", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected bad request for bad token %v %v", resp, err)
+	}
+	resp.Body.Close()
+	req, _ = http.NewRequest(http.MethodDelete, dataURL+"?token="+tok.Token, nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("Unexpected delete response %v %v", resp, err)
+	}
+	resp.Body.Close()
+	if _, err = os.Stat(path.Join(tmpDir, "to-delete.json")); !os.IsNotExist(err) {
+		t.Errorf("Result should have been deleted: %v", err)
+	}
+	// Now that it's gone, can't get a token for it
+	GetErrorResult(t, dataURL+"?confirm-token=true", "")
+	GetErrorResult(t, fmt.Sprintf("http://localhost:%d/fortio/%s.foo.json?confirm-token=true", addr.Port, RestDataURI), "")
+}
+
+func TestResultChecksumRESTApi(t *testing.T) {
+	mux, addr := fhttp.DynamicHTTPServer(false)
+	tmpDir := t.TempDir()
+	AddHandlers(nil, mux, "", "/fortio/", tmpDir)
+	data := []byte(`{"Labels":"checksum test"}`)
+	if SaveJSON("checked", data) == "" {
+		t.Fatalf("Unable to save test result")
+	}
+	sum, err := ComputeResultChecksum("checked")
+	if err != nil || sum != "sha256:"+fmt.Sprintf("%x", sha256.Sum256(data)) {
+		t.Errorf("Unexpected checksum %q %v", sum, err)
+	}
+	stored, err := os.ReadFile(path.Join(tmpDir, "checked.json"+ChecksumExtension))
+	if err != nil || strings.TrimSpace(string(stored)) != sum {
+		t.Errorf("Unexpected stored checksum %q %v", stored, err)
+	}
+	if _, err = ComputeResultChecksum("../checked"); err == nil {
+		t.Errorf("Expected error for invalid id")
+	}
+	dataURL := fmt.Sprintf("http://localhost:%d/fortio/%schecked.json?verify=1", addr.Port, RestDataURI)
+	code, body := getURL(t, dataURL)
+	if code != http.StatusOK || !bytes.Equal(body, data) {
+		t.Errorf("Unexpected verified result %d %q", code, body)
+	}
+	index := fmt.Sprintf("http://localhost:%d/fortio/%sindex.tsv", addr.Port, DataDir)
+	if _, body = getURL(t, index); bytes.Contains(body, []byte(sum)) {
+		t.Errorf("Unexpected checksum in default index %q", body)
+	}
+	if _, body = getURL(t, index+"?checksums=1"); !bytes.Contains(body, []byte("checked.json\t26\t")) ||
+		!bytes.Contains(body, []byte("\t"+sum+"\n")) {
+		t.Errorf("Expected checksum in index %q", body)
+	}
+	// Tampered result:
+	if err = os.WriteFile(path.Join(tmpDir, "checked.json"), []byte(`{"Labels":"tampered"}`), 0o644); err != nil {
+		t.Fatalf("Unable to modify test result: %v", err)
+	}
+	if err = VerifyResultChecksum("checked"); err == nil {
+		t.Errorf("Expected checksum mismatch error")
+	}
+	if code, _ = getURL(t, dataURL); code != http.StatusConflict {
+		t.Errorf("Expected conflict for tampered result, got %d", code)
+	}
+	// Results without stored checksum can't be verified, reported distinctly:
+	if err = os.WriteFile(path.Join(tmpDir, "unchecked.json"), data, 0o644); err != nil {
+		t.Fatalf("Unable to create test result: %v", err)
+	}
+	if code, _ = getURL(t, strings.Replace(dataURL, "checked", "unchecked", 1)); code != http.StatusNotFound {
+		t.Errorf("Expected not found for result without checksum, got %d", code)
+	}
+	if code, _ = getURL(t, strings.Replace(dataURL, "checked", "missing", 1)); code != http.StatusBadRequest {
+		t.Errorf("Expected bad request for missing result, got %d", code)
+	}
+}
+
+func TestResultGzip(t *testing.T) {
+	mux, addr := fhttp.DynamicHTTPServer(false)
+	AddHandlers(nil, mux, "", "/fortio/", t.TempDir())
+	data := []byte(`{"Labels":"gzip test","Data":[` + strings.Repeat(`{"Start":0.001,"End":0.002,"Count":1},`, 100) + `{}]}`)
+	if SaveJSON("compressed", data) == "" {
+		t.Fatalf("Unable to save test result")
+	}
+	for _, tst := range []struct {
+		url          string
+		cacheControl string
+	}{
+		{fmt.Sprintf("http://localhost:%d/fortio/%scompressed.json", addr.Port, DataDir), "max-age=365000000, immutable"},
+		{fmt.Sprintf("http://localhost:%d/fortio/%scompressed.json?verify=1", addr.Port, RestDataURI), VerifiedResultCacheControl},
+	} {
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, tst.url, nil)
+		req.Header.Set("Accept-Encoding", "gzip") // explicitly set so the transport doesn't decompress.
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Error getting %s: %v", tst.url, err)
+		}
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Encoding") != "gzip" {
+			t.Fatalf("Expected gzip 200 reply for %s, got %d %v", tst.url, resp.StatusCode, resp.Header)
+		}
+		if cc := resp.Header.Get("Cache-Control"); cc != tst.cacheControl {
+			t.Errorf("Unexpected Cache-Control %q for %s", cc, tst.url)
+		}
+		if v := resp.Header.Get("Vary"); v != "Accept-Encoding" {
+			t.Errorf("Unexpected Vary %q for %s", v, tst.url)
+		}
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			t.Fatalf("Invalid gzip reply for %s: %v", tst.url, err)
+		}
+		body, err := io.ReadAll(gz)
+		resp.Body.Close()
+		if err != nil || !bytes.Equal(body, data) {
+			t.Errorf("Unexpected uncompressed reply for %s: %q %v", tst.url, body, err)
+		}
+		// Byte ranges are of the uncompressed result:
+		req.Header.Set("Range", "bytes=0-9")
+		if resp, err = http.DefaultClient.Do(req); err != nil {
+			t.Fatalf("Error getting range of %s: %v", tst.url, err)
+		}
+		body, _ = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusPartialContent || resp.Header.Get("Content-Encoding") != "" || !bytes.Equal(body, data[:10]) {
+			t.Errorf("Unexpected range reply for %s: %d %v %q", tst.url, resp.StatusCode, resp.Header, body)
+		}
+	}
+	// Uncompressed for clients not accepting gzip:
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet,
+		fmt.Sprintf("http://localhost:%d/fortio/%scompressed.json", addr.Port, DataDir), nil)
+	req.Header.Set("Accept-Encoding", "identity")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Error getting uncompressed result: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.Header.Get("Content-Encoding") != "" || !bytes.Equal(body, data) {
+		t.Errorf("Unexpected uncompressed result %v %q", resp.Header, body)
+	}
+}
+
+// getURL returns the status code and body of a GET of url.
+func getURL(t *testing.T, url string) (int, []byte) {
+	t.Helper()
+	resp, err := http.Get(url) //nolint:noctx // test
+	if err != nil {
+		t.Fatalf("Error getting %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, body
+}
+
+func TestSearchResultsRESTApi(t *testing.T) {
+	mux, addr := fhttp.DynamicHTTPServer(false)
+	tmpDir := t.TempDir()
+	AddHandlers(nil, mux, "", "/fortio/", tmpDir)
+	write := func(id, content string) {
+		if err := os.WriteFile(path.Join(tmpDir, id+JSONExtension), []byte(content), 0o644); err != nil {
+			t.Fatalf("Unable to create test result %s: %v", id, err)
+		}
+	}
+	write("r1", `{"RunType":"HTTP","Labels":"Prod Canary eu","StartTime":"2026-01-02T03:04:05Z","Big":[1,2,{"a":"b"}],"ActualQPS":12.5}`)
+	write("r2", `{"RunType":"HTTP","Labels":"staging eu","SourceRegion":"Oregon, US","StartTime":"2026-01-03T03:04:05Z","ActualQPS":3}`)
+	write("r3", `not json`)
+	searchURL := fmt.Sprintf("http://localhost:%d/fortio/%s?q=", addr.Port, RestSearchURI)
+	res := *FetchResult[[]ResultSummary](t, searchURL+"canary+PROD", "")
+	if len(res) != 1 || res[0].ID != "r1" || res[0].ActualQPS != 12.5 || res[0].Labels != "Prod Canary eu" ||
+		res[0].StartTime.Year() != 2026 {
+		t.Errorf("Unexpected search result %+v", res)
+	}
+	res = *FetchResult[[]ResultSummary](t, searchURL+"eu", "")
+	if len(res) != 2 || res[0].ID != "r2" || res[1].ID != "r1" || res[0].SourceRegion != "Oregon, US" ||
+		res[1].SourceRegion != "" {
+		t.Errorf("Expected both results, newest first, got %+v", res)
+	}
+	res = *FetchResult[[]ResultSummary](t, searchURL+"nope", "")
+	if len(res) != 0 {
+		t.Errorf("Expected no result, got %+v", res)
+	}
+	// New file invalidates the cache:
+	time.Sleep(10 * time.Millisecond)
+	write("r4", `{"Labels":"eu new","ActualQPS":1}`)
+	res, err := SearchResults("EU", nil)
+	if err != nil || len(res) != 3 || res[0].ID != "r4" {
+		t.Errorf("Expected 3 results including the new one, got %+v %v", res, err)
+	}
+	// Summary statistics of an actual result:
+	h := stats.NewHistogram(0, 0.001)
+	for range 100 {
+		h.Record(0.010)
+	}
+	errs := stats.NewHistogram(0, 0.001)
+	errs.RecordN(0.001, 3)
+	rr := periodic.RunnerResults{
+		Labels:                  "with stats",
+		Tags:                    map[string]string{"env": "staging", "team": "infra"},
+		StartTime:               time.Now(),
+		ActualQPS:               50,
+		ActualDuration:          2 * time.Second,
+		DurationHistogram:       h.Export(),
+		ErrorsDurationHistogram: errs.Export(),
+	}
+	j, _ := json.Marshal(&rr)
+	time.Sleep(10 * time.Millisecond)
+	write("r5", string(j))
+	res, err = SearchResults("stats", nil)
+	if err != nil || len(res) != 1 || res[0].ActualDuration != 2*time.Second || res[0].ErrorCount != 3 ||
+		res[0].P99 != 0.010 {
+		t.Errorf("Unexpected summary statistics %+v %v", res, err)
+	}
+	res = *FetchResult[[]ResultSummary](t, searchURL+"&tag=env:staging&tag=team:infra", "")
+	if len(res) != 1 || res[0].ID != "r5" || res[0].Tags["env"] != "staging" {
+		t.Errorf("Expected only the tagged result, got %+v", res)
+	}
+	res = *FetchResult[[]ResultSummary](t, searchURL+"eu&tag=env:staging", "")
+	if len(res) != 0 {
+		t.Errorf("Expected no result for labels and tag not both matching, got %+v", res)
+	}
+}
+
+func TestRunTags(t *testing.T) {
+	tests := []struct {
+		query    string
+		body     map[string]interface{}
+		expected map[string]string
+		err      bool
+	}{
+		{"", nil, nil, false},
+		{`tags={"env":"staging"}`, nil, map[string]string{"env": "staging"}, false},
+		{"", map[string]interface{}{"tags": map[string]interface{}{"team": "infra", "v": "2"}},
+			map[string]string{"team": "infra", "v": "2"}, false},
+		{"", map[string]interface{}{"tags": `{"a":"b"}`}, map[string]string{"a": "b"}, false},
+		{"tags=notjson", nil, nil, true},
+		{"", map[string]interface{}{"tags": map[string]interface{}{"n": 1.}}, nil, true},
+		{"", map[string]interface{}{"tags": []interface{}{"a"}}, nil, true},
+	}
+	for _, tst := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/fortio/rest/run?"+strings.ReplaceAll(tst.query, `"`, "%22"), nil)
+		tags, err := runTags(r, tst.body)
+		if (err != nil) != tst.err || !reflect.DeepEqual(tags, tst.expected) {
+			t.Errorf("runTags(%q, %v) = %v, %v; expected %v (error %v)", tst.query, tst.body, tags, err, tst.expected, tst.err)
+		}
+	}
+}
+
+func TestDataListRESTApi(t *testing.T) {
+	mux, addr := fhttp.DynamicHTTPServer(false)
+	tmpDir := t.TempDir()
+	AddHandlers(nil, mux, "", "/fortio/", tmpDir)
+	qps := []float64{5, 1, 4, 2, 3}
+	for i, q := range qps {
+		id := fmt.Sprintf("r%d", i)
+		content := fmt.Sprintf(`{"Labels":"run %d","StartTime":"2026-01-0%dT03:04:05Z","ActualQPS":%g}`, i, i+1, q)
+		if err := os.WriteFile(path.Join(tmpDir, id+JSONExtension), []byte(content), 0o644); err != nil {
+			t.Fatalf("Unable to create test result %s: %v", id, err)
+		}
+	}
+	listURL := fmt.Sprintf("http://localhost:%d/fortio/%s?limit=2", addr.Port, RestDataListURI)
+	list := func(sortOrder string) []string {
+		var ids []string
+		cursor := ""
+		for range 10 {
+			res := FetchResult[ResultList](t, listURL+"&sort="+sortOrder+"&cursor="+cursor, "")
+			if len(res.Items) > 2 {
+				t.Errorf("Page larger than the limit: %+v", res.Items)
+			}
+			for _, item := range res.Items {
+				ids = append(ids, item.ID)
+				if item.Size == 0 {
+					t.Errorf("Missing size for %+v", item)
+				}
+			}
+			if res.NextCursor == "" {
+				break
+			}
+			cursor = res.NextCursor
+		}
+		return ids
+	}
+	tests := []struct {
+		sortOrder string
+		expected  string
+	}{
+		{"", "r4 r3 r2 r1 r0"},
+		{SortTimeAsc, "r0 r1 r2 r3 r4"},
+		{SortQPSDesc, "r0 r2 r4 r3 r1"},
+	}
+	for _, tst := range tests {
+		if got := strings.Join(list(tst.sortOrder), " "); got != tst.expected {
+			t.Errorf("For sort %q got %q, expected %q", tst.sortOrder, got, tst.expected)
+		}
+	}
+	// Deleting the last returned id: next page continues at the same offset.
+	items, cursor, err := ListResults("", 2, SortTimeAsc)
+	if err != nil || len(items) != 2 || cursor == "" {
+		t.Fatalf("Unexpected first page %+v %q %v", items, cursor, err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err = os.Remove(path.Join(tmpDir, "r1.json")); err != nil {
+		t.Fatalf("Unable to remove r1: %v", err)
+	}
+	items, _, err = ListResults(cursor, 2, SortTimeAsc)
+	if err != nil || len(items) != 2 || items[0].ID != "r3" {
+		t.Errorf("Expected r3 r4 after r1 deletion, got %+v %v", items, err)
+	}
+	GetErrorResult(t, listURL+"&sort=foo", "")
+	GetErrorResult(t, listURL+"&cursor=not-valid!", "")
+	GetErrorResult(t, fmt.Sprintf("http://localhost:%d/fortio/%s?limit=x", addr.Port, RestDataListURI), "")
+}
+
+func TestAsyncRunWebhook(t *testing.T) {
+	mux, addr := fhttp.DynamicHTTPServer(false)
+	mux.HandleFunc("/echo/", fhttp.EchoHandler)
+	type notification struct {
+		runID string
+		res   fhttp.HTTPRunnerResults
+	}
+	notified := make(chan notification, 1)
+	mux.HandleFunc("/hook", func(w http.ResponseWriter, r *http.Request) {
+		n := notification{runID: r.Header.Get(RunIDHeader)}
+		if err := json.NewDecoder(r.Body).Decode(&n.res); err != nil {
+			t.Errorf("Unable to decode webhook body: %v", err)
+		}
+		notified <- n
+		w.WriteHeader(http.StatusNoContent)
+	})
+	AddHandlers(nil, mux, "", "/fortio/", t.TempDir())
+	runURL := fmt.Sprintf("http://localhost:%d/fortio/%s?qps=100&n=5&url=http://localhost:%d/echo/&async=on&notify-url=%s",
+		addr.Port, RestRunURI, addr.Port, fmt.Sprintf("http://localhost:%d/hook", addr.Port))
+	// An invalid notify-url is rejected upfront.
+	errObj := GetErrorResult(t, strings.Replace(runURL, "notify-url=http://", "notify-url=", 1), "")
+	if errObj.Message != "invalid notify-url" {
+		t.Errorf("Didn't get the expected invalid notify-url error, got %+v", errObj)
+	}
+	asyncObj := GetAsyncResult(t, runURL, "")
+	select {
+	case n := <-notified:
+		if n.runID != strconv.FormatInt(asyncObj.RunID, 10) {
+			t.Errorf("Unexpected run id header %q vs %d", n.runID, asyncObj.RunID)
+		}
+		if n.res.RetCodes[http.StatusOK] != 5 || n.res.Result().ID != asyncObj.ResultID {
+			t.Errorf("Unexpected webhook result %+v", n.res)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Timed out waiting for webhook notification")
+	}
+}
+
+func TestLifecycleWebhook(t *testing.T) {
+	mux, addr := fhttp.DynamicHTTPServer(false)
+	mux.HandleFunc("/echo/", fhttp.EchoHandler)
+	events := make(chan LifecycleEvent, 10)
+	var calls atomic.Int32
+	mux.HandleFunc("/lifecycle", func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable) // first delivery fails, to check the retry.
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		sig := fhttp.HMACSHA256Signature("s3cr3t", body, r.Header.Get(fhttp.SignatureTimestampHeader))
+		if r.Header.Get(WebhookSignatureHeader) != sig {
+			t.Errorf("Invalid signature %q for %s", r.Header.Get(WebhookSignatureHeader), body)
+		}
+		var e LifecycleEvent
+		if err := json.Unmarshal(body, &e); err != nil {
+			t.Errorf("Unable to decode lifecycle event %s: %v", body, err)
+		}
+		events <- e
+	})
+	AddHandlers(nil, mux, "", "/fortio/", t.TempDir())
+	if err := SetLifecycleWebhook("not a url", ""); err == nil {
+		t.Errorf("Expected an error for an invalid lifecycle webhook url")
+	}
+	if err := setLifecycleWebhook(fmt.Sprintf("http://localhost:%d/lifecycle", addr.Port), "s3cr3t", 10*time.Millisecond); err != nil {
+		t.Fatalf("Unexpected lifecycle webhook error: %v", err)
+	}
+	defer func() {
+		_ = SetLifecycleWebhook("", "")
+	}()
+	runURL := fmt.Sprintf("http://localhost:%d/fortio/%s?qps=100&n=5&url=http://localhost:%d/echo/&async=on&save=on",
+		addr.Port, RestRunURI, addr.Port)
+	asyncObj := GetAsyncResult(t, runURL, "")
+	got := make(map[string]LifecycleEvent)
+	for len(got) < 2 {
+		select {
+		case e := <-events:
+			if e.RunID == asyncObj.RunID {
+				got[e.Event] = e
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for lifecycle events, got %+v", got)
+		}
+	}
+	if e := got[EventStarted]; e.State != "running" || e.ResultURL != "" {
+		t.Errorf("Unexpected started event %+v", e)
+	}
+	if e := got[EventStopped]; e.State != "stopped" || e.ResultURL != asyncObj.ResultURL {
+		t.Errorf("Unexpected stopped event %+v, expected result url %q", e, asyncObj.ResultURL)
+	}
+}
+
+func TestSendToGraphite(t *testing.T) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer l.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, aerr := l.Accept()
+		if aerr != nil {
+			received <- aerr.Error()
+			return
+		}
+		data, _ := io.ReadAll(conn)
+		conn.Close()
+		received <- string(data)
+	}()
+	h := stats.NewHistogram(0, 0.001)
+	h.Record(0.002)
+	h.Record(0.004)
+	results := periodic.RunnerResults{
+		RunType:                 "HTTP",
+		Labels:                  "my test.1",
+		StartTime:               time.Unix(1700000000, 0),
+		ActualDuration:          10 * time.Second,
+		ActualQPS:               0.2,
+		DurationHistogram:       h.Export().CalcPercentiles([]float64{90}),
+		ErrorsDurationHistogram: stats.NewHistogram(0, 0.001).Export(),
+	}
+	if err = SendToGraphite(l.Addr().String(), &results); err != nil {
+		t.Fatalf("Unable to send to graphite: %v", err)
+	}
+	lines := <-received
+	for _, expected := range []string{
+		"fortio.http.my_test_1.duration.le_0_002 1 1700000010\n",
+		"fortio.http.my_test_1.duration.count 2 1700000010\n",
+		"fortio.http.my_test_1.duration.avg 0.003 1700000010\n",
+		"fortio.http.my_test_1.duration.p90 ",
+		"fortio.http.my_test_1.duration.p99 ",
+		"fortio.http.my_test_1.qps 0.2 1700000010\n",
+		"fortio.http.my_test_1.errors 0 1700000010\n",
+	} {
+		if !strings.Contains(lines, expected) {
+			t.Errorf("Missing %q in graphite lines:\n%s", expected, lines)
+		}
+	}
+	if lines != GraphiteMetrics(&results) {
+		t.Errorf("Mismatch between sent and expected lines: %q", lines)
+	}
+	// Nothing listening:
+	l.Close()
+	if err = SendToGraphite(l.Addr().String(), &results); err == nil {
+		t.Errorf("Expected error sending to closed port")
+	}
+}
+
+func TestAPITokens(t *testing.T) {
+	tokenFile := path.Join(t.TempDir(), "tokens")
+	err := os.WriteFile(tokenFile, []byte("# users\ntok1:user1\n tok2 : user2 \n\nadm:"+AdminUser+"\n"), 0o600)
+	if err != nil {
+		t.Fatalf("Unable to write tokens: %v", err)
+	}
+	tokens, err := LoadTokens(tokenFile)
+	if err != nil {
+		t.Fatalf("Unable to load tokens: %v", err)
+	}
+	if len(tokens) != 3 || tokens["tok2"] != "user2" || tokens["adm"] != AdminUser {
+		t.Errorf("Unexpected tokens %v", tokens)
+	}
+	_ = os.WriteFile(tokenFile, []byte("tok1:user1\nbadline\n"), 0o600)
+	if _, err = LoadTokens(tokenFile); err == nil || !strings.Contains(err.Error(), ":2:") {
+		t.Errorf("Expected line 2 error, got %v", err)
+	}
+	APITokens = tokens
+	defer func() { APITokens = nil }()
+	mux, addr := fhttp.DynamicHTTPServer(false)
+	mux.HandleFunc("/foo/", fhttp.EchoHandler)
+	AddHandlers(nil, mux, "", "/fortio/", t.TempDir())
+	restURL := fmt.Sprintf("http://localhost:%d/fortio/", addr.Port)
+	runURL := fmt.Sprintf("%s%s?qps=10&t=on&url=localhost:%d/foo/&async=on", restURL, RestRunURI, addr.Port)
+	call := func(url, token string, okCodes ...int) (*AsyncReply, error) {
+		dest := jrpc.NewDestination(url)
+		if token != "" {
+			dest.Headers = &http.Header{"Authorization": []string{"Bearer " + token}}
+		}
+		if len(okCodes) > 0 {
+			dest.OkCodes = sets.New(okCodes...)
+		}
+		return jrpc.Get[AsyncReply](dest)
+	}
+	for _, token := range []string{"", "wrong"} {
+		if _, err = call(runURL, token); err == nil || !strings.Contains(err.Error(), "401") {
+			t.Errorf("Expected 401 error for token %q, got %v", token, err)
+		}
+	}
+	run1, err := call(runURL, "tok1")
+	if err != nil || run1.RunID <= 0 {
+		t.Fatalf("Unable to start run as user1: %v %+v", err, run1)
+	}
+	run2, err := call(runURL, "tok2")
+	if err != nil || run2.RunID <= 0 {
+		t.Fatalf("Unable to start run as user2: %v %+v", err, run2)
+	}
+	defer StopByRunID(0, false)
+	time.Sleep(200 * time.Millisecond) // let the async runs go from pending to running
+	if s := GetRun(run1.RunID); s == nil || s.User != "user1" {
+		t.Errorf("Expected run 1 to be user1's, got %+v", s)
+	}
+	stopURL := fmt.Sprintf("%s%s?runid=%d", restURL, RestStopURI, run1.RunID)
+	if _, err = call(stopURL, ""); err == nil {
+		t.Errorf("Expected unauthenticated stop to fail")
+	}
+	reply, err := call(stopURL, "tok2", http.StatusForbidden)
+	if err != nil || !reply.Error {
+		t.Errorf("Expected user2 to not be allowed to stop user1's run, got %v %+v", err, reply)
+	}
+	// Stop all as user1 only stops user1's run:
+	reply, err = call(fmt.Sprintf("%s%s", restURL, RestStopURI), "tok1")
+	if err != nil || reply.Count != 1 || reply.ResultID != run1.ResultID {
+		t.Errorf("Expected user1 to stop their run, got %v %+v", err, reply)
+	}
+	reply, err = call(fmt.Sprintf("%s%s?runid=%d", restURL, RestStopURI, run2.RunID), "adm")
+	if err != nil || reply.Count != 1 {
+		t.Errorf("Expected admin to stop user2's run, got %v %+v", err, reply)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	CORSOrigin = "https://dashboard.example.com"
+	APITokens = map[string]string{"tok1": "user1"}
+	defer func() {
+		CORSOrigin = ""
+		APITokens = nil
+	}()
+	mux, addr := fhttp.DynamicHTTPServer(false)
+	AddHandlers(nil, mux, "", "/fortio/", t.TempDir())
+	restURL := fmt.Sprintf("http://localhost:%d/fortio/", addr.Port)
+	// Pre-flight requests get through without credentials (even when they are required).
+	for _, uri := range []string{RestStatusURI, RestRunURI} {
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodOptions, restURL+uri, nil)
+		req.Header.Set("Origin", CORSOrigin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Unexpected pre-flight error for %s: %v", uri, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Errorf("Unexpected pre-flight status %d for %s", resp.StatusCode, uri)
+		}
+		if h := resp.Header.Get("Access-Control-Allow-Origin"); h != CORSOrigin {
+			t.Errorf("Unexpected allow origin %q for %s", h, uri)
+		}
+		if h := resp.Header.Get("Access-Control-Allow-Headers"); h != "Content-Type, Authorization" {
+			t.Errorf("Unexpected allow headers %q for %s", h, uri)
+		}
+		// DELETE is needed for the data/{id}.json results deletion.
+		if h := resp.Header.Get("Access-Control-Allow-Methods"); h != "GET, POST, DELETE, OPTIONS" {
+			t.Errorf("Unexpected pre-flight allow methods %q for %s", h, uri)
+		}
+	}
+	// Regular calls, including rejected ones, have the headers too.
+	for uri, code := range map[string]int{RestStatusURI: http.StatusOK, RestRunURI: http.StatusUnauthorized} {
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, restURL+uri, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", uri, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != code {
+			t.Errorf("Unexpected status %d for %s, expected %d", resp.StatusCode, uri, code)
+		}
+		if h := resp.Header.Get("Access-Control-Allow-Methods"); h != "GET, POST, DELETE, OPTIONS" {
+			t.Errorf("Unexpected allow methods %q for %s", h, uri)
+		}
+	}
+}
+
+func TestRunQueue(t *testing.T) {
+	MaxConcurrentRuns = 1
+	defer func() {
+		MaxConcurrentRuns = 0
+		FairSchedule = true
+	}()
+	mux, addr := fhttp.DynamicHTTPServer(false)
+	AddHandlers(nil, mux, "", "/fortio/", t.TempDir())
+	queueURL := fmt.Sprintf("http://localhost:%d/fortio/%s", addr.Port, RestQueueURI)
+	acquireRunSlot(context.Background(), 1, 0) // immediate, takes the only slot
+	started := make(chan int64, 10)
+	queue := func(runID int64, priority int) {
+		go func() {
+			acquireRunSlot(context.Background(), runID, priority)
+			started <- runID
+		}()
+		for len(GetQueue().Queue) < int(runID)-1 {
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	queue(2, 0)
+	queue(3, 5)
+	queue(4, 0)
+	queue(5, 5)
+	q := *FetchResult[QueueReply](t, queueURL, "")
+	if q.Running != 1 || q.MaxConcurrentRuns != 1 || !q.FairSchedule || len(q.Queue) != 4 {
+		t.Fatalf("Unexpected queue %+v", q)
+	}
+	// Higher priority first then arrival order.
+	for i, runID := range []int64{3, 5, 2, 4} {
+		if q.Queue[i].RunID != runID {
+			t.Errorf("Unexpected queue order %+v, expected run %d at %d", q.Queue, runID, i)
+		}
+	}
+	// Run 4 waited long enough to get ahead of the priority 5 ones (but not 2 which waited even longer).
+	runQueueMutex.Lock()
+	for _, w := range runQueue.items {
+		switch w.runID {
+		case 2:
+			w.enqueued = w.enqueued.Add(-70 * time.Second)
+		case 4:
+			w.enqueued = w.enqueued.Add(-60 * time.Second)
+		}
+	}
+	runQueueMutex.Unlock()
+	q = GetQueue()
+	if q.Queue[0].RunID != 2 || q.Queue[0].EffectivePriority != 7 || q.Queue[1].RunID != 4 || q.Queue[2].RunID != 3 {
+		t.Errorf("Unexpected fair schedule order %+v", q.Queue)
+	}
+	FairSchedule = false
+	if q = GetQueue(); q.Queue[0].RunID != 3 || q.Queue[0].EffectivePriority != 5 {
+		t.Errorf("Unexpected order without fair schedule %+v", q.Queue)
+	}
+	for _, expected := range []int64{3, 5, 2, 4} {
+		releaseRunSlot()
+		if runID := <-started; runID != expected {
+			t.Errorf("Run %d started instead of %d", runID, expected)
+		}
+	}
+	releaseRunSlot()
+	if q = GetQueue(); q.Running != 0 || len(q.Queue) != 0 {
+		t.Errorf("Unexpected final queue %+v", q)
+	}
+}
+
+func TestStopQueuedRun(t *testing.T) {
+	MaxConcurrentRuns = 1
+	defer func() { MaxConcurrentRuns = 0 }()
+	mux, addr := fhttp.DynamicHTTPServer(false)
+	mux.HandleFunc("/echo/", fhttp.EchoHandler)
+	AddHandlers(nil, mux, "", "/fortio/", t.TempDir())
+	if !acquireRunSlot(context.Background(), 0, 0) { // takes the only slot
+		t.Fatalf("Unable to get the free slot")
+	}
+	runURL := fmt.Sprintf("http://localhost:%d/fortio/%s?qps=100&n=5&url=http://localhost:%d/echo/&async=on",
+		addr.Port, RestRunURI, addr.Port)
+	runID := GetAsyncResult(t, runURL, "").RunID
+	for len(GetQueue().Queue) != 1 {
+		time.Sleep(5 * time.Millisecond)
+	}
+	stopURL := fmt.Sprintf("http://localhost:%d/fortio/%s?runid=%d", addr.Port, RestStopURI, runID)
+	if res := GetAsyncResult(t, stopURL, ""); res.Count != 1 {
+		t.Errorf("Expected the queued run to be stopped, got %+v", res)
+	}
+	for len(GetQueue().Queue) != 0 || GetRun(runID) != nil {
+		time.Sleep(5 * time.Millisecond)
+	}
+	// Abandoned sync client (context done) while queued:
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan bool)
+	go func() { done <- acquireRunSlot(ctx, 42, 0) }()
+	for len(GetQueue().Queue) != 1 {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if <-done {
+		t.Errorf("Run acquired a slot despite its context being cancelled")
+	}
+	releaseRunSlot()
+	if q := GetQueue(); q.Running != 0 || len(q.Queue) != 0 {
+		t.Errorf("Unexpected final queue %+v", q)
+	}
+}
+
+func TestSendToInflux(t *testing.T) {
+	mux, addr := fhttp.DynamicHTTPServer(false)
+	received := make(chan string, 1)
+	mux.HandleFunc("/write", func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		received <- r.URL.RawQuery + " " + string(data)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	h := stats.NewHistogram(0, 0.001)
+	h.Record(0.002)
+	h.Record(0.004)
+	results := periodic.RunnerResults{
+		RunID:                   42,
+		Labels:                  "my test,1",
+		StartTime:               time.Unix(1700000000, 0),
+		ActualDuration:          10 * time.Second,
+		ActualQPS:               0.2,
+		DurationHistogram:       h.Export(),
+		ErrorsDurationHistogram: stats.NewHistogram(0, 0.001).Export(),
+	}
+	line := InfluxMetrics(&results)
+	for _, expected := range []string{
+		"fortio,run_id=42,labels=my+test%2C1 actual_qps=0.2,error_count=0i,avg_latency=0.003,p50=",
+		",le_0.002=1i,le_0.004=1i 1700000010000000000\n",
+	} {
+		if !strings.Contains(line, expected) {
+			t.Errorf("Missing %q in influx line %q", expected, line)
+		}
+	}
+	influxURL := fmt.Sprintf("http://localhost:%d/write?db=fortio", addr.Port)
+	if err := SendToInflux(influxURL, &results); err != nil {
+		t.Fatalf("Unable to send to influx: %v", err)
+	}
+	if got := <-received; got != "db=fortio "+line {
+		t.Errorf("Unexpected influx write %q", got)
+	}
+	if err := SendToInflux(fmt.Sprintf("http://localhost:%d/notfound", addr.Port), &results); err == nil {
+		t.Errorf("Expected error for 404")
+	}
+}
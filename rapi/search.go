@@ -0,0 +1,234 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rapi // import "fortio.org/fortio/rapi"
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"fortio.org/fortio/stats"
+	"fortio.org/log"
+)
+
+const (
+	RestSearchURI = "rest/search"
+	// MaxSearchResults is the maximum number of entries returned by SearchResults.
+	MaxSearchResults = 200
+)
+
+// ResultSummary is the subset of a saved result returned by the search API.
+type ResultSummary struct {
+	ID        string    `json:"id"`
+	Labels    string    `json:"labels"`
+	StartTime time.Time `json:"startTime"`
+	ActualQPS float64   `json:"actualQPS"`
+	Size      int64     `json:"size"` // of the json file
+	// Region the run was sent from, when it was annotated (-annotate-geo).
+	SourceRegion string `json:"sourceRegion,omitempty"`
+	// Summary statistics (e.g. for the browse UI table).
+	ActualDuration time.Duration `json:"actualDuration"` // in nanoseconds
+	P99            float64       `json:"p99"`            // 99th percentile of the call durations, in seconds
+	ErrorCount     int64         `json:"errorCount"`
+	// Structured metadata of the run, if any.
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+type searchCache struct {
+	cachedDirTime time.Time
+	entries       map[string]ResultSummary
+}
+
+var (
+	gSearchCache      searchCache
+	gSearchCacheMutex = &sync.Mutex{}
+)
+
+// readSummary reads only the top level fields needed for the ResultSummary,
+// stopping as soon as they are all found (they are before the bulk of fortio results).
+func readSummary(id string) (ResultSummary, error) {
+	res := ResultSummary{ID: id}
+	f, err := os.Open(path.Join(dataDir, id+JSONExtension))
+	if err != nil {
+		return res, err
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err == nil {
+		res.Size = info.Size()
+	}
+	dec := json.NewDecoder(f)
+	t, err := dec.Token()
+	if err != nil {
+		return res, err
+	}
+	if d, ok := t.(json.Delim); !ok || d != '{' {
+		return res, fmt.Errorf("%s: not a json object", id)
+	}
+	found := 0
+	for found < 6 && dec.More() {
+		t, err = dec.Token()
+		if err != nil {
+			return res, err
+		}
+		key, _ := t.(string)
+		switch key {
+		case "Labels":
+			err = dec.Decode(&res.Labels)
+			found++
+		case "SourceRegion": // optional, so not counted in found (it's before StartTime when present)
+			err = dec.Decode(&res.SourceRegion)
+		case "Tags": // same as SourceRegion
+			err = dec.Decode(&res.Tags)
+		case "StartTime":
+			err = dec.Decode(&res.StartTime)
+			found++
+		case "ActualQPS":
+			err = dec.Decode(&res.ActualQPS)
+			found++
+		case "ActualDuration":
+			err = dec.Decode(&res.ActualDuration)
+			found++
+		case "DurationHistogram":
+			var h stats.HistogramData
+			if err = dec.Decode(&h); err == nil && h.Count > 0 {
+				res.P99 = h.CalcPercentile(99)
+			}
+			found++
+		case "ErrorsDurationHistogram":
+			var h struct{ Count int64 }
+			err = dec.Decode(&h)
+			res.ErrorCount = h.Count
+			found++
+		default:
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+		}
+		if err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// SearchResults returns the summary of the saved results (newest first, at most MaxSearchResults)
+// whose labels contain, case insensitively, all the space separated words of query and which
+// have all the tags (exact key and value match).
+// The labels are cached in memory and new files are only read when the data dir changes.
+func SearchResults(query string, tags map[string]string) ([]ResultSummary, error) {
+	summaries, err := cachedSummaries()
+	if err != nil {
+		return nil, err
+	}
+	words := strings.Fields(strings.ToLower(query))
+	res := []ResultSummary{}
+	for _, s := range summaries {
+		if !matchesAll(strings.ToLower(s.Labels), words) || !hasTags(s.Tags, tags) {
+			continue
+		}
+		res = append(res, s)
+		if len(res) >= MaxSearchResults {
+			break
+		}
+	}
+	return res, nil
+}
+
+// cachedSummaries returns the summaries of all the (readable) saved results, newest first.
+// New files are only read when the data dir changes.
+func cachedSummaries() ([]ResultSummary, error) {
+	info, err := os.Stat(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	gSearchCacheMutex.Lock()
+	defer gSearchCacheMutex.Unlock()
+	ids := DataList()
+	if info.ModTime() != gSearchCache.cachedDirTime || gSearchCache.entries == nil {
+		entries := make(map[string]ResultSummary, len(ids))
+		for _, id := range ids {
+			if s, ok := gSearchCache.entries[id]; ok {
+				entries[id] = s
+				continue
+			}
+			s, err := readSummary(id)
+			if err != nil {
+				log.Errf("Unable to read labels of %s: %v", id, err)
+				continue
+			}
+			entries[id] = s
+		}
+		gSearchCache.entries = entries
+		gSearchCache.cachedDirTime = info.ModTime()
+	}
+	res := make([]ResultSummary, 0, len(ids))
+	for _, id := range ids {
+		if s, ok := gSearchCache.entries[id]; ok {
+			res = append(res, s)
+		}
+	}
+	return res, nil
+}
+
+func matchesAll(labels string, words []string) bool {
+	for _, w := range words {
+		if !strings.Contains(labels, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasTags returns true if all the wanted tags are in tags.
+func hasTags(tags, wanted map[string]string) bool {
+	for k, v := range wanted {
+		if tv, found := tags[k]; !found || tv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// RESTSearchHandler returns the JSON array of ResultSummary matching the `q` query
+// and the (repeatable) `tag=key:value` filters.
+func RESTSearchHandler(w http.ResponseWriter, r *http.Request) {
+	log.LogRequest(r, "REST Search call")
+	w.Header().Set("Content-Type", "application/json")
+	q := r.FormValue("q") // also parses the form for the tags.
+	var tags map[string]string
+	for _, tag := range r.Form["tag"] {
+		k, v, found := strings.Cut(tag, ":")
+		if !found {
+			Error(w, "invalid tag filter, expecting key:value", nil)
+			return
+		}
+		if tags == nil {
+			tags = make(map[string]string)
+		}
+		tags[k] = v
+	}
+	res, err := SearchResults(q, tags)
+	if err != nil {
+		Error(w, "search failed", err)
+		return
+	}
+	if err = json.NewEncoder(w).Encode(res); err != nil {
+		log.Errf("Error replying to search request: %v", err)
+	}
+}
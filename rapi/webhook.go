@@ -0,0 +1,188 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rapi // import "fortio.org/fortio/rapi"
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"fortio.org/fortio/fhttp"
+	"fortio.org/fortio/periodic"
+	"fortio.org/log"
+)
+
+const (
+	// RunIDHeader is the header carrying the run id in webhook notifications.
+	RunIDHeader = "X-Fortio-Run-ID"
+	// WebhookTimeout is the timeout for webhook notifications.
+	WebhookTimeout = 5 * time.Second
+	// WebhookSignatureHeader is the header carrying the signature of the lifecycle webhook notifications
+	// when a WebhookSecret is set: the fhttp.HMACSHA256Signature of the body and of the (unix seconds)
+	// timestamp of the fhttp.SignatureTimestampHeader header.
+	WebhookSignatureHeader = "X-Fortio-Signature"
+	// The lifecycle webhook events (see LifecycleEvent).
+	EventStarted = "started"
+	EventStopped = "stopped"
+	EventError   = "error"
+	// Number of retries of the failed lifecycle webhook notifications.
+	webhookRetries = 3
+)
+
+// lifecycleWebhook is the configuration of the lifecycle webhook, see SetLifecycleWebhook.
+type lifecycleWebhook struct {
+	url    string
+	secret string
+	delay  time.Duration // between the notification attempts.
+}
+
+// Current lifecycle webhook configuration, nil when not set.
+var lifecycleWebhookConfig atomic.Pointer[lifecycleWebhook]
+
+// SetLifecycleWebhook sets the URL receiving a LifecycleEvent POST for each state change of all the REST/UI runs
+// (unlike the per run notify-url, which gets the results), empty to disable them. When secret isn't empty,
+// it is the key of the WebhookSignatureHeader of the notifications. Returns an error for an invalid webhookURL.
+func SetLifecycleWebhook(webhookURL, secret string) error {
+	return setLifecycleWebhook(webhookURL, secret, 5*time.Second)
+}
+
+func setLifecycleWebhook(webhookURL, secret string, delay time.Duration) error {
+	if webhookURL == "" {
+		lifecycleWebhookConfig.Store(nil)
+		return nil
+	}
+	if err := ValidateWebhookURL(webhookURL); err != nil {
+		return err
+	}
+	lifecycleWebhookConfig.Store(&lifecycleWebhook{url: webhookURL, secret: secret, delay: delay})
+	return nil
+}
+
+// LifecycleEvent is the JSON body POSTed to the lifecycle webhook (see SetLifecycleWebhook).
+type LifecycleEvent struct {
+	Event     string `json:"event"` // EventStarted, EventStopped or EventError.
+	RunID     int64  `json:"runID"`
+	State     string `json:"state"`               // State of the run after the event: running or stopped.
+	ResultURL string `json:"resultURL,omitempty"` // URL of the JSON results, when saved.
+}
+
+// ValidateWebhookURL returns an error if webhookURL isn't an absolute http or https URL.
+func ValidateWebhookURL(webhookURL string) error {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an absolute http(s) URL", webhookURL)
+	}
+	return nil
+}
+
+// SetNotifyURL sets the URL to POST the results of the (pending) run runid to when it completes.
+func SetNotifyURL(runid int64, notifyURL string) {
+	uiRunMapMutex.Lock()
+	if status, found := runs[runid]; found {
+		status.notifyURL = notifyURL
+	}
+	uiRunMapMutex.Unlock()
+}
+
+func getNotifyURL(runid int64) string {
+	uiRunMapMutex.Lock()
+	defer uiRunMapMutex.Unlock()
+	if status, found := runs[runid]; found {
+		return status.notifyURL
+	}
+	return ""
+}
+
+// notifyWebhook POSTs the result as JSON to notifyURL, errors are logged and not retried.
+func notifyWebhook(runID int64, notifyURL string, result periodic.HasRunnerResult) {
+	jsonData, err := json.Marshal(result)
+	if err != nil {
+		log.Errf("Unable to serialize run %d result for webhook: %v", runID, err)
+		return
+	}
+	o := fhttp.NewHTTPOptions(notifyURL)
+	o.DisableFastClient = true
+	o.HTTPReqTimeOut = WebhookTimeout
+	o.ContentType = "application/json"
+	o.Payload = jsonData
+	if err = o.AddAndValidateExtraHeader(RunIDHeader + ": " + strconv.FormatInt(runID, 10)); err != nil {
+		log.Errf("Unable to add run id header: %v", err)
+	}
+	code := fhttp.StreamFetch(o)
+	if code < 200 || code > 299 {
+		log.S(log.Error, "Webhook notification failed", log.Attr("run", runID), log.Str("url", notifyURL), log.Attr("code", code))
+		return
+	}
+	log.S(log.Info, "Webhook notified", log.Attr("run", runID), log.Str("url", notifyURL), log.Attr("code", code))
+}
+
+// notifyGlobalWebhook POSTs, asynchronously, the event of run runID, now in state, to the lifecycle webhook
+// when set. Failed notifications are retried webhookRetries times, the configured delay apart.
+func notifyGlobalWebhook(event string, runID int64, state StateEnum, resultURL string) {
+	cfg := lifecycleWebhookConfig.Load()
+	if cfg == nil {
+		return
+	}
+	webhookURL, secret, delay := cfg.url, cfg.secret, cfg.delay
+	jsonData, err := json.Marshal(LifecycleEvent{Event: event, RunID: runID, State: state.String(), ResultURL: resultURL})
+	if err != nil {
+		log.Errf("Unable to serialize run %d %s event for lifecycle webhook: %v", runID, event, err)
+		return
+	}
+	go func() {
+		for attempt := 0; ; attempt++ {
+			code := postLifecycleEvent(webhookURL, secret, runID, jsonData)
+			if code >= 200 && code <= 299 {
+				log.S(log.Info, "Lifecycle webhook notified", log.Attr("run", runID), log.Str("event", event), log.Attr("code", code))
+				return
+			}
+			if attempt >= webhookRetries {
+				log.S(log.Error, "Lifecycle webhook notification failed", log.Attr("run", runID), log.Str("event", event),
+					log.Str("url", webhookURL), log.Attr("code", code), log.Attr("attempts", attempt+1))
+				return
+			}
+			log.S(log.Warning, "Lifecycle webhook notification failed, will retry", log.Attr("run", runID), log.Str("event", event),
+				log.Attr("code", code), log.Attr("retry_in", delay))
+			time.Sleep(delay)
+		}
+	}()
+}
+
+// postLifecycleEvent POSTs the JSON event body, signed when secret isn't empty, and returns the status code.
+func postLifecycleEvent(webhookURL, secret string, runID int64, body []byte) int {
+	o := fhttp.NewHTTPOptions(webhookURL)
+	o.DisableFastClient = true
+	o.HTTPReqTimeOut = WebhookTimeout
+	o.ContentType = "application/json"
+	o.Payload = body
+	headers := []string{RunIDHeader + ": " + strconv.FormatInt(runID, 10)}
+	if secret != "" {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		headers = append(headers, fhttp.SignatureTimestampHeader+": "+ts,
+			WebhookSignatureHeader+": "+fhttp.HMACSHA256Signature(secret, body, ts))
+	}
+	for _, h := range headers {
+		if err := o.AddAndValidateExtraHeader(h); err != nil {
+			log.Errf("Unable to add lifecycle webhook header: %v", err)
+		}
+	}
+	return fhttp.StreamFetch(o)
+}
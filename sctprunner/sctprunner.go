@@ -0,0 +1,104 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sctprunner
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"fortio.org/fortio/fnet"
+	"fortio.org/fortio/periodic"
+	"fortio.org/fortio/udprunner"
+)
+
+// SCTPTimeOutDefaultValue is the default read timeout for the echo reply.
+var SCTPTimeOutDefaultValue = 750 * time.Millisecond
+
+// SCTPResultMap is the count of each result (SCTPStatusOK or error).
+type SCTPResultMap = udprunner.UDPResultMap
+
+// RunnerResults is the aggregated result of an SCTP run: the udprunner's one, with the SCTP transport.
+type RunnerResults = udprunner.RunnerResults
+
+// SCTPClient is the client used for SCTP echo testing.
+type SCTPClient = udprunner.UDPClient
+
+// SCTPOptions are options to the SCTPClient.
+type SCTPOptions struct {
+	Destination string
+	Payload     []byte // what to send (and check)
+	ReqTimeout  time.Duration
+}
+
+// RunnerOptions includes the base RunnerOptions plus SCTP specific
+// options.
+type RunnerOptions struct {
+	periodic.RunnerOptions
+	SCTPOptions // Need to call Init() to initialize
+}
+
+var (
+	// SCTPURLPrefix is the URL prefix for triggering SCTP load.
+	SCTPURLPrefix = fnet.SCTPPrefix
+	// SCTPStatusOK is the map key on success.
+	SCTPStatusOK = udprunner.UDPStatusOK
+)
+
+// transport is the udprunner.Transport for SCTP (Linux only, see fnet.DialSCTP).
+var transport = udprunner.Transport{
+	Name: "sctp",
+	Resolve: func(ctx context.Context, dest string) (net.Addr, error) {
+		addr, err := fnet.SCTPResolveDestination(ctx, dest)
+		if addr == nil { // avoid returning a non nil net.Addr wrapping nil
+			return nil, err
+		}
+		return addr, nil
+	},
+	Dial: func(addr net.Addr) (net.Conn, error) {
+		return fnet.DialSCTP(addr.(*fnet.SCTPAddr))
+	},
+}
+
+// udpOptions returns the udprunner options using the SCTP transport.
+func (o *SCTPOptions) udpOptions() udprunner.UDPOptions {
+	timeout := o.ReqTimeout
+	if timeout == 0 {
+		timeout = SCTPTimeOutDefaultValue
+	}
+	return udprunner.UDPOptions{
+		Destination: o.Destination,
+		Payload:     o.Payload,
+		ReqTimeout:  timeout,
+		Transport:   &transport,
+	}
+}
+
+// NewSCTPClient creates and initialize and returns a client based on the SCTPOptions.
+func NewSCTPClient(o *SCTPOptions) (*SCTPClient, error) {
+	uo := o.udpOptions()
+	return udprunner.NewUDPClient(&uo)
+}
+
+// RunSCTPTest runs a SCTP test and returns the aggregated stats.
+func RunSCTPTest(o *RunnerOptions) (*RunnerResults, error) {
+	uo := udprunner.RunnerOptions{
+		RunnerOptions: o.RunnerOptions,
+		UDPOptions:    o.udpOptions(),
+	}
+	res, err := udprunner.RunUDPTest(&uo)
+	o.RunnerOptions = uo.RunnerOptions
+	return res, err
+}
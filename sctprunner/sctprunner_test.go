@@ -0,0 +1,55 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sctprunner
+
+import (
+	"fmt"
+	"testing"
+
+	"fortio.org/fortio/fnet"
+)
+
+func TestSCTPRunnerBadDestination(t *testing.T) {
+	opts := RunnerOptions{}
+	opts.QPS = 100
+	opts.Destination = "sctp://doesnotexist.fortio.org:1111"
+	res, err := RunSCTPTest(&opts)
+	if err == nil {
+		t.Fatalf("unexpected success on bad destination %+v", res)
+	}
+	t.Logf("Got expected error: %v", err)
+}
+
+func TestSCTPRunner(t *testing.T) {
+	addr := fnet.SCTPEchoServer("test-sctp-echo-runner", ":0")
+	if addr == nil {
+		t.Skip("SCTP not supported on this platform/kernel")
+	}
+	opts := RunnerOptions{}
+	opts.QPS = 100
+	opts.Destination = fmt.Sprintf("sctp://localhost:%s/", fnet.GetPort(addr))
+	res, err := RunSCTPTest(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	totalReq := res.DurationHistogram.Count
+	sctpOk := res.RetCodes[SCTPStatusOK]
+	if totalReq != sctpOk {
+		t.Errorf("Mismatch between requests %d and ok %v", totalReq, res.RetCodes)
+	}
+	if res.SocketCount != res.RunnerResults.NumThreads {
+		t.Errorf("%d socket used, expected same as thread# %d", res.SocketCount, res.RunnerResults.NumThreads)
+	}
+}
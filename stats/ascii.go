@@ -0,0 +1,85 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats // import "fortio.org/fortio/stats"
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxASCIIRows is the maximum number of bars of PrintASCII: when there are more buckets, consecutive
+// ones are merged.
+const MaxASCIIRows = 40
+
+// asciiBlocks are the partial blocks, in eighths, used for the fractional end of the bars.
+var asciiBlocks = []string{"", "▏", "▎", "▍", "▌", "▋", "▊", "▉"}
+
+// FormatDuration formats a duration in seconds in human-readable units (μs, ms or s).
+func FormatDuration(seconds float64) string {
+	switch {
+	case seconds < 1e-3:
+		return fmt.Sprintf("%.4gμs", seconds*1e6)
+	case seconds < 1:
+		return fmt.Sprintf("%.4gms", seconds*1e3)
+	default:
+		return fmt.Sprintf("%.4gs", seconds)
+	}
+}
+
+// asciiBar returns the bar for count out of maxCount over width characters, using the partial
+// blocks for the fractional part.
+func asciiBar(count, maxCount int64, width int) string {
+	eighths := int(count * int64(width) * 8 / maxCount)
+	return strings.Repeat("█", eighths/8) + asciiBlocks[eighths%8]
+}
+
+// PrintASCII prints the histogram of durations (in seconds) as a bar chart of up to width characters,
+// one bar per bucket (up to MaxASCIIRows), each proportional to its count and labeled with the bucket's
+// range, e.g. for a terminal.
+func (e *HistogramData) PrintASCII(out io.Writer, width int) {
+	if e.Count == 0 || len(e.Data) == 0 {
+		_, _ = fmt.Fprintln(out, "No data")
+		return
+	}
+	group := (len(e.Data) + MaxASCIIRows - 1) / MaxASCIIRows
+	var labels, counts []string
+	var values []int64
+	var maxCount int64
+	for i := 0; i < len(e.Data); i += group {
+		last := min(i+group, len(e.Data)) - 1
+		var count int64
+		for _, b := range e.Data[i : last+1] {
+			count += b.Count
+		}
+		labels = append(labels, FormatDuration(e.Data[i].Start)+" - "+FormatDuration(e.Data[last].End))
+		counts = append(counts, fmt.Sprintf("%d (%.1f%%)", count, 100.*float64(count)/float64(e.Count)))
+		values = append(values, count)
+		maxCount = max(maxCount, count)
+	}
+	labelWidth, countWidth := 0, 0
+	for i := range labels {
+		labelWidth = max(labelWidth, utf8.RuneCountInString(labels[i]))
+		countWidth = max(countWidth, len(counts[i]))
+	}
+	barWidth := max(width-labelWidth-countWidth-4, 10) // " | " and " " separators
+	for i := range labels {
+		pad := strings.Repeat(" ", labelWidth-utf8.RuneCountInString(labels[i]))
+		bar := asciiBar(values[i], maxCount, barWidth)
+		_, _ = fmt.Fprintf(out, "%s%s | %s%s %s\n", pad, labels[i], bar,
+			strings.Repeat(" ", barWidth-utf8.RuneCountInString(bar)), counts[i])
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats // import "fortio.org/fortio/stats"
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// AtomicHistogram is a Histogram which can be recorded into and read from concurrently
+// by many goroutines without locking (using sync/atomic for all the fields).
+type AtomicHistogram struct {
+	Offset  float64 // offset applied to data before fitting into buckets
+	Divider float64 // divider applied to data before fitting into buckets
+	count   atomic.Int64
+	// float64 bits of sum, sum of squares, min and max.
+	sum          atomic.Uint64
+	sumOfSquares atomic.Uint64
+	minV         atomic.Uint64
+	maxV         atomic.Uint64
+	hdata        []atomic.Int64
+}
+
+// NewAtomicHistogram creates a new concurrent safe histogram, see NewHistogram.
+// Divider value can not be zero, otherwise returns nil.
+func NewAtomicHistogram(offset float64, divider float64) *AtomicHistogram {
+	if divider == 0 {
+		return nil
+	}
+	h := &AtomicHistogram{
+		Offset:  offset,
+		Divider: divider,
+		hdata:   make([]atomic.Int64, numBuckets),
+	}
+	h.minV.Store(math.Float64bits(math.Inf(1)))
+	h.maxV.Store(math.Float64bits(math.Inf(-1)))
+	return h
+}
+
+// atomicUpdate atomically replaces the float64 stored (as bits) in a by f(current).
+func atomicUpdate(a *atomic.Uint64, f func(float64) float64) {
+	for {
+		old := a.Load()
+		cur := math.Float64frombits(old)
+		nv := f(cur)
+		if nv == cur || a.CompareAndSwap(old, math.Float64bits(nv)) {
+			return
+		}
+	}
+}
+
+// Record records a data point.
+func (h *AtomicHistogram) Record(v float64) {
+	h.RecordN(v, 1)
+}
+
+// RecordN efficiently records a data point N times.
+func (h *AtomicHistogram) RecordN(v float64, n int) {
+	// min/max first so they are set for any bucket count seen by Snapshot().
+	atomicUpdate(&h.minV, func(cur float64) float64 { return min(cur, v) })
+	atomicUpdate(&h.maxV, func(cur float64) float64 { return max(cur, v) })
+	s := v * float64(n)
+	atomicUpdate(&h.sum, func(cur float64) float64 { return cur + s })
+	atomicUpdate(&h.sumOfSquares, func(cur float64) float64 { return cur + s*s })
+	h.hdata[bucketIndex(v, h.Offset, h.Divider)].Add(int64(n))
+	h.count.Add(int64(n))
+}
+
+// Count returns the number of data points recorded so far.
+func (h *AtomicHistogram) Count() int64 {
+	return h.count.Load()
+}
+
+// Snapshot returns a regular Histogram copy of the current data. When recording is happening
+// concurrently, the Count is the one of the copied buckets and the other fields can
+// include a few more or less data points.
+func (h *AtomicHistogram) Snapshot() *Histogram {
+	res := NewHistogram(h.Offset, h.Divider)
+	var total int64
+	for i := range h.hdata {
+		c := h.hdata[i].Load()
+		res.Hdata[i] = int32(c) //nolint:gosec // we limit ourselves to 32 bits counts.
+		total += c
+	}
+	if total == 0 {
+		return res
+	}
+	res.Count = total
+	res.Sum = math.Float64frombits(h.sum.Load())
+	res.sumOfSquares = math.Float64frombits(h.sumOfSquares.Load())
+	res.Min = math.Float64frombits(h.minV.Load())
+	res.Max = math.Float64frombits(h.maxV.Load())
+	return res
+}
+
+// Export is Snapshot().Export(), see Histogram.Export.
+func (h *AtomicHistogram) Export() *HistogramData {
+	return h.Snapshot().Export()
+}
@@ -0,0 +1,74 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats // import "fortio.org/fortio/stats"
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GraphitePercentiles are always included in the Graphite export, in addition to the
+// already calculated Percentiles of the HistogramData.
+var GraphitePercentiles = []float64{50, 99}
+
+// GraphiteLine returns 1 line of the Graphite (Carbon) plaintext protocol: "path value timestamp\n".
+func GraphiteLine(path string, value float64, timestamp time.Time) string {
+	return fmt.Sprintf("%s %s %d\n", path, strconv.FormatFloat(value, 'f', -1, 64), timestamp.Unix())
+}
+
+// GraphitePercentileName returns the metric name for a percentile, e.g. p99_9 for 99.9
+// (as . is the Graphite path separator).
+func GraphitePercentileName(p float64) string {
+	return "p" + graphiteNumber(p)
+}
+
+// GraphiteBucketName returns the metric name for the bucket ending at end, e.g. le_0_005 for 0.005.
+// Unlike the bucket index, it's stable across runs (as the empty buckets aren't in the exported Data),
+// except for the overflow bucket, which ends at the max.
+func GraphiteBucketName(end float64) string {
+	return "le_" + graphiteNumber(end)
+}
+
+func graphiteNumber(v float64) string {
+	return strings.ReplaceAll(strconv.FormatFloat(v, 'f', -1, 64), ".", "_")
+}
+
+// ToGraphite returns the histogram as Graphite (Carbon) plaintext protocol lines: one per bucket
+// (prefix.le_End count timestamp, see GraphiteBucketName) and the summary metrics prefix.count,
+// prefix.min, prefix.max, prefix.avg, prefix.stddev and the percentiles (e.g. prefix.p50, prefix.p99).
+func (e *HistogramData) ToGraphite(prefix string, timestamp time.Time) string {
+	var sb strings.Builder
+	for _, b := range e.Data {
+		sb.WriteString(GraphiteLine(prefix+"."+GraphiteBucketName(b.End), float64(b.Count), timestamp))
+	}
+	sb.WriteString(GraphiteLine(prefix+".count", float64(e.Count), timestamp))
+	sb.WriteString(GraphiteLine(prefix+".min", e.Min, timestamp))
+	sb.WriteString(GraphiteLine(prefix+".max", e.Max, timestamp))
+	sb.WriteString(GraphiteLine(prefix+".avg", e.Avg, timestamp))
+	sb.WriteString(GraphiteLine(prefix+".stddev", e.StdDev, timestamp))
+	done := make(map[float64]bool)
+	for _, p := range e.Percentiles {
+		sb.WriteString(GraphiteLine(prefix+"."+GraphitePercentileName(p.Percentile), p.Value, timestamp))
+		done[p.Percentile] = true
+	}
+	for _, p := range GraphitePercentiles {
+		if !done[p] {
+			sb.WriteString(GraphiteLine(prefix+"."+GraphitePercentileName(p), e.CalcPercentile(p), timestamp))
+		}
+	}
+	return sb.String()
+}
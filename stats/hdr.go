@@ -0,0 +1,110 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats // import "fortio.org/fortio/stats"
+
+import (
+	"math"
+	"sort"
+)
+
+// Defaults for durations (in seconds) HDR histograms: from 1 microsecond to 1 hour with 2 significant
+// figures (1% precision), which is about 3300 buckets.
+const (
+	DefaultHDRLowest             = 1e-6
+	DefaultHDRHighest            = 3600.
+	DefaultHDRSignificantFigures = 2
+)
+
+// hdrLayout is the bucket layout of a high dynamic range histogram: like https://hdrhistogram.org/
+// the values are grouped by powers of 2, each split in the same number of linear sub buckets,
+// so the relative precision is the same across the whole range.
+type hdrLayout struct {
+	lowest             float64
+	highest            float64
+	significantFigures int
+	bounds             []float64 // upper (included) bound of each bucket, one more bucket for > last
+}
+
+func newHDRLayout(lowest, highest float64, significantFigures int) *hdrLayout {
+	// Sub bucket count is the power of 2 enough to distinguish 1 in 10^significantFigures over half of it:
+	subBucketCount := int64(1) << uint(math.Ceil(math.Log2(2*math.Pow10(significantFigures))))
+	half := subBucketCount / 2
+	l := &hdrLayout{lowest: lowest, highest: highest, significantFigures: significantFigures}
+	// First power of 2 range is linear from 0 with lowest sized buckets:
+	for j := range subBucketCount {
+		l.bounds = append(l.bounds, float64(j+1)*lowest)
+	}
+	for unit := int64(2); l.bounds[len(l.bounds)-1] < highest; unit *= 2 {
+		for j := half; j < subBucketCount; j++ {
+			l.bounds = append(l.bounds, float64((j+1)*unit)*lowest)
+		}
+	}
+	return l
+}
+
+// index returns the index in Hdata of the bucket for v: the first bucket with upper bound >= v
+// (buckets are ]previous bound, bound]), or the extra last one for v > last bound.
+func (l *hdrLayout) index(v float64) int {
+	return sort.SearchFloat64s(l.bounds, v)
+}
+
+func (l *hdrLayout) equal(o *hdrLayout) bool {
+	return l.lowest == o.lowest && l.highest == o.highest && l.significantFigures == o.significantFigures
+}
+
+// NewHDRHistogram creates a high dynamic range histogram, distinguishing values down to
+// lowestDiscernibleValue and up to highestTrackableValue (larger values are only counted in a last
+// bucket up to Max) with significantFigures (1 to 5) precision. Unlike the default layout, it keeps
+// the precision of bimodal distributions, e.g. most values under 1ms and a few over 1s, at the
+// cost of many more buckets. Offset is 0 and Divider is set to lowestDiscernibleValue.
+// Export() produces the same HistogramData as the default layout.
+// Returns nil for invalid parameters.
+func NewHDRHistogram(lowestDiscernibleValue, highestTrackableValue float64, significantFigures int) *Histogram {
+	if lowestDiscernibleValue <= 0 || highestTrackableValue <= lowestDiscernibleValue ||
+		significantFigures < 1 || significantFigures > 5 {
+		return nil
+	}
+	l := newHDRLayout(lowestDiscernibleValue, highestTrackableValue, significantFigures)
+	return &Histogram{
+		Divider: lowestDiscernibleValue,
+		Hdata:   make([]int32, len(l.bounds)+1),
+		hdr:     l,
+	}
+}
+
+// IsHDR returns true for histograms created with NewHDRHistogram.
+func (h *Histogram) IsHDR() bool {
+	return h.hdr != nil
+}
+
+// ToStandard returns a copy of the histogram with the default (NewHistogram) bucket layout,
+// e.g. for comparisons with or compact JSON like older results. The counters are identical and the
+// data points are placed in the new buckets according to the mid point of their original bucket.
+func (h *Histogram) ToStandard(offset, divider float64) *Histogram {
+	res := NewHistogram(offset, divider)
+	if res != nil {
+		res.CopyFrom(h)
+	}
+	return res
+}
+
+// ToHDR returns a copy of the histogram with an HDR bucket layout (see NewHDRHistogram and ToStandard).
+func (h *Histogram) ToHDR(lowestDiscernibleValue, highestTrackableValue float64, significantFigures int) *Histogram {
+	res := NewHDRHistogram(lowestDiscernibleValue, highestTrackableValue, significantFigures)
+	if res != nil {
+		res.CopyFrom(h)
+	}
+	return res
+}
@@ -0,0 +1,291 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats // import "fortio.org/fortio/stats"
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+)
+
+// HDR histogram V2 wire format (https://github.com/HdrHistogram/HdrHistogram) cookies, the low
+// nibble of the second byte is the word size (0x10 for the zig zag LEB128 encoded counts).
+const (
+	hdrEncodingCookie           = 0x1c849313
+	hdrCompressedEncodingCookie = 0x1c849314
+	hdrCookieMask               = ^0xf0
+	hdrHeaderSize               = 40
+	// hdrValueUnit is the value of 1 in the integers of the HDR wire format written by MarshalHDR:
+	// the fortio durations in seconds are thus encoded as microseconds, like most HDR tools expect.
+	hdrValueUnit = DefaultHDRLowest
+)
+
+// hdrWireLayout is the integer buckets layout of the HDR histograms, needed to convert the
+// counts array indexes of the wire format to and from values.
+type hdrWireLayout struct {
+	unitMagnitude               int
+	subBucketHalfCountMagnitude int
+	subBucketHalfCount          int64
+	subBucketMask               uint64
+	leadingZeroCountBase        int
+}
+
+func newHDRWireLayout(lowest int64, significantFigures int) *hdrWireLayout {
+	largestValueWithSingleUnitResolution := 2 * math.Pow10(significantFigures)
+	subBucketCountMagnitude := int(math.Ceil(math.Log2(largestValueWithSingleUnitResolution)))
+	l := &hdrWireLayout{
+		unitMagnitude:               bits.Len64(uint64(lowest)) - 1, //nolint:gosec // lowest is positive.
+		subBucketHalfCountMagnitude: max(subBucketCountMagnitude, 1) - 1,
+	}
+	l.subBucketHalfCount = int64(1) << l.subBucketHalfCountMagnitude
+	l.subBucketMask = uint64(2*l.subBucketHalfCount-1) << l.unitMagnitude //nolint:gosec // positive.
+	l.leadingZeroCountBase = 64 - l.unitMagnitude - l.subBucketHalfCountMagnitude - 1
+	return l
+}
+
+// index returns the counts array index of the (non negative) value v.
+func (l *hdrWireLayout) index(v int64) int {
+	bucketIdx := l.leadingZeroCountBase - bits.LeadingZeros64(uint64(v)|l.subBucketMask) //nolint:gosec // v >= 0.
+	subBucketIdx := v >> (bucketIdx + l.unitMagnitude)
+	return (bucketIdx+1)<<l.subBucketHalfCountMagnitude + int(subBucketIdx-l.subBucketHalfCount)
+}
+
+// bucket returns the lowest value of the index's bucket and the size of its range of values, or an
+// error if the values would overflow.
+func (l *hdrWireLayout) bucket(index int) (int64, int64, error) {
+	bucketIdx := index>>l.subBucketHalfCountMagnitude - 1
+	subBucketIdx := int64(index)&(l.subBucketHalfCount-1) + l.subBucketHalfCount
+	if bucketIdx < 0 {
+		subBucketIdx -= l.subBucketHalfCount
+		bucketIdx = 0
+	}
+	shift := bucketIdx + l.unitMagnitude
+	if shift+l.subBucketHalfCountMagnitude+1 > 62 {
+		return 0, 0, fmt.Errorf("hdr counts index %d out of range", index)
+	}
+	return subBucketIdx << shift, int64(1) << shift, nil
+}
+
+// MarshalHDR writes the histogram in the HDR histogram V2 compressed binary format (as used by
+// HdrHistogram's HistogramLogProcessor, hdrhistogram-plotter, wrk2, Gatling...). The values are
+// encoded as integers in microseconds for durations in seconds (the format's integer to double
+// conversion ratio is set to 1e-6) with 2 significant figures, each bucket's count being recorded
+// at its mid point, so histograms created with NewHDRHistogram's defaults keep their exact buckets.
+// Negative values can't be encoded.
+func (e *HistogramData) MarshalHDR(w io.Writer) error {
+	if e.Count > 0 && e.Min < 0 {
+		return fmt.Errorf("negative values (min %g) can't be encoded in HDR format", e.Min)
+	}
+	if e.Max/hdrValueUnit >= math.MaxInt64/4 {
+		return fmt.Errorf("max %g too large for HDR format", e.Max)
+	}
+	l := newHDRWireLayout(1, DefaultHDRSignificantFigures)
+	var counts []int64
+	for _, b := range e.Data {
+		mid := min(max((b.Start+b.End)/2, e.Min), e.Max)
+		idx := l.index(int64(mid / hdrValueUnit))
+		if idx >= len(counts) {
+			counts = append(counts, make([]int64, idx+1-len(counts))...)
+		}
+		counts[idx] += b.Count
+	}
+	var payload []byte
+	for i := 0; i < len(counts); {
+		count := counts[i]
+		i++
+		if count != 0 {
+			payload = putZigZag(payload, count)
+			continue
+		}
+		zeros := int64(1)
+		for ; i < len(counts) && counts[i] == 0; i++ {
+			zeros++
+		}
+		if zeros > 1 {
+			payload = putZigZag(payload, -zeros)
+		} else {
+			payload = putZigZag(payload, 0)
+		}
+	}
+	var raw bytes.Buffer
+	header := []any{
+		int32(hdrEncodingCookie),
+		int32(len(payload)), //nolint:gosec // bounded by the number of buckets.
+		int32(0),            // normalizing index offset
+		int32(DefaultHDRSignificantFigures),
+		int64(1), // lowest discernible value
+		max(int64(math.Ceil(e.Max/hdrValueUnit)), 2), // highest trackable value
+		hdrValueUnit, // integer to double value conversion ratio
+	}
+	for _, v := range header {
+		_ = binary.Write(&raw, binary.BigEndian, v) // can't fail writing to a bytes.Buffer
+	}
+	raw.Write(payload)
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	_, _ = zw.Write(raw.Bytes())
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	out := binary.BigEndian.AppendUint32(nil, hdrCompressedEncodingCookie)
+	out = binary.BigEndian.AppendUint32(out, uint32(compressed.Len())) //nolint:gosec // small.
+	out = append(out, compressed.Bytes()...)
+	_, err := w.Write(out)
+	return err
+}
+
+// UnmarshalHDR reads a histogram in the HDR histogram V2 binary format, compressed (see MarshalHDR)
+// or not. The HDR buckets with non zero counts become the HistogramData buckets, with values
+// converted using the encoded integer to double conversion ratio (so back to seconds for MarshalHDR's
+// output). As the format only has the counts, Min and Max are the first bucket's start and last
+// bucket's end, and Sum, Avg and StdDev are approximated using the buckets' mid points.
+// Percentiles can be added with CalcPercentiles.
+func UnmarshalHDR(r io.Reader) (*HistogramData, error) {
+	var cookie int32
+	if err := binary.Read(r, binary.BigEndian, &cookie); err != nil {
+		return nil, err
+	}
+	switch cookie & hdrCookieMask {
+	case hdrCompressedEncodingCookie & hdrCookieMask:
+		var length int32
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+			return nil, err
+		}
+		zr, err := zlib.NewReader(io.LimitReader(r, int64(length)))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		if err := binary.Read(zr, binary.BigEndian, &cookie); err != nil {
+			return nil, err
+		}
+		if cookie&hdrCookieMask != hdrEncodingCookie&hdrCookieMask {
+			return nil, fmt.Errorf("unexpected hdr cookie 0x%x in compressed data", cookie)
+		}
+		r = zr
+	case hdrEncodingCookie & hdrCookieMask:
+	default:
+		return nil, fmt.Errorf("unsupported hdr format cookie 0x%x (only V2 is supported)", cookie)
+	}
+	var header struct {
+		PayloadLength          int32
+		NormalizingIndexOffset int32
+		SignificantFigures     int32
+		Lowest                 int64
+		Highest                int64
+		ConversionRatio        float64
+	}
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return nil, err
+	}
+	if header.SignificantFigures < 0 || header.SignificantFigures > 5 || header.Lowest < 1 || header.PayloadLength < 0 {
+		return nil, fmt.Errorf("invalid hdr header %+v", header)
+	}
+	if header.NormalizingIndexOffset != 0 {
+		return nil, errors.New("hdr histograms with normalizing index offset aren't supported")
+	}
+	ratio := header.ConversionRatio
+	if ratio <= 0 {
+		ratio = 1
+	}
+	// Not pre-allocated from the (untrusted) header's length: grows as the data actually arrives.
+	payload, err := io.ReadAll(io.LimitReader(r, int64(header.PayloadLength)))
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) != int(header.PayloadLength) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	l := newHDRWireLayout(header.Lowest, int(header.SignificantFigures))
+	res := HistogramData{}
+	var sumSq float64
+	for idx := 0; len(payload) > 0; {
+		count, rest, err := zigZag(payload)
+		if err != nil {
+			return nil, err
+		}
+		payload = rest
+		if count <= 0 {
+			idx += int(max(-count, 1))
+			continue
+		}
+		start, size, err := l.bucket(idx)
+		if err != nil {
+			return nil, err
+		}
+		idx++
+		b := Bucket{Interval: Interval{Start: float64(start) * ratio, End: float64(start+size) * ratio}, Count: count}
+		res.Data = append(res.Data, b)
+		res.Count += count
+		mid := (b.Start + b.End) / 2
+		res.Sum += float64(count) * mid
+		sumSq += float64(count) * mid * mid
+	}
+	if res.Count == 0 {
+		return &res, nil
+	}
+	var total int64
+	for i := range res.Data {
+		total += res.Data[i].Count
+		res.Data[i].Percent = 100. * float64(total) / float64(res.Count)
+	}
+	res.Min = res.Data[0].Start
+	res.Max = res.Data[len(res.Data)-1].End
+	res.Avg = res.Sum / float64(res.Count)
+	if variance := sumSq/float64(res.Count) - res.Avg*res.Avg; variance > 0 {
+		res.StdDev = math.Sqrt(variance)
+	}
+	return &res, nil
+}
+
+// putZigZag appends the zig zag LEB128 encoding of v used by the HDR format: up to 8 bytes
+// of 7 bits and a last 9th byte with the remaining 8 bits.
+func putZigZag(buf []byte, v int64) []byte {
+	u := uint64(v<<1) ^ uint64(v>>63) //nolint:gosec // zig zag encoding.
+	for range 8 {
+		if u < 0x80 {
+			return append(buf, byte(u))
+		}
+		buf = append(buf, byte(u&0x7f|0x80))
+		u >>= 7
+	}
+	return append(buf, byte(u))
+}
+
+// zigZag decodes the putZigZag encoded value at the start of buf and returns it with the rest of buf.
+func zigZag(buf []byte) (int64, []byte, error) {
+	var u uint64
+	n := 0
+	for ; n < 9; n++ {
+		if n >= len(buf) {
+			return 0, nil, errors.New("truncated hdr counts")
+		}
+		b := buf[n]
+		if n == 8 {
+			u |= uint64(b) << 56
+			break
+		}
+		u |= uint64(b&0x7f) << (7 * n)
+		if b < 0x80 {
+			break
+		}
+	}
+	return int64(u>>1) ^ -int64(u&1), buf[n+1:], nil //nolint:gosec // zig zag decoding.
+}
@@ -0,0 +1,186 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats // import "fortio.org/fortio/stats"
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParsePrometheusHistogram extracts the histogram named metricName from a Prometheus
+// text format scrape (the metricName_bucket, _sum and _count series). When there are
+// multiple series (different labels) for that histogram, they are summed.
+// As prometheus buckets are cumulative and unbounded below, the first bucket starts
+// at 0 (or its upper bound if negative) and the +Inf bucket is treated as ending at the
+// last finite bound. Malformed lines (including the metricName buckets without valid le label)
+// are skipped, their number is returned along with the histogram.
+func ParsePrometheusHistogram(text []byte, metricName string) (*HistogramData, int, error) {
+	buckets := make(map[float64]float64) // le -> cumulative count
+	var sum, count float64
+	found := false
+	skipped := 0
+	scanner := bufio.NewScanner(bytes.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		name, labels, value, err := parsePrometheusLine(line)
+		if err != nil {
+			skipped++
+			continue
+		}
+		switch name {
+		case metricName + "_bucket":
+			le, err := strconv.ParseFloat(labels["le"], 64) // also an error when missing.
+			if err != nil {
+				skipped++
+				continue
+			}
+			buckets[le] += value
+			found = true
+		case metricName + "_sum":
+			sum += value
+		case metricName + "_count":
+			count += value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, skipped, err
+	}
+	if !found {
+		return nil, skipped, fmt.Errorf("histogram %q not found", metricName)
+	}
+	les := make([]float64, 0, len(buckets))
+	for le := range buckets {
+		les = append(les, le)
+	}
+	sort.Float64s(les)
+	if !math.IsInf(les[len(les)-1], 1) {
+		return nil, skipped, fmt.Errorf("histogram %q has no +Inf bucket", metricName)
+	}
+	total := buckets[les[len(les)-1]]
+	if count == 0 {
+		count = total
+	}
+	res := HistogramData{Count: int64(count), Sum: sum}
+	if count == 0 {
+		return &res, skipped, nil
+	}
+	res.Avg = sum / count
+	prevLe := 0.
+	if les[0] < 0 {
+		prevLe = les[0]
+	}
+	var prevCumul, sumSq float64
+	for _, le := range les {
+		cumul := buckets[le]
+		n := cumul - prevCumul
+		end := le
+		if math.IsInf(le, 1) {
+			end = prevLe
+		}
+		if n > 0 {
+			b := Bucket{Interval: Interval{Start: prevLe, End: end}, Count: int64(n), Percent: 100. * cumul / total}
+			res.Data = append(res.Data, b)
+			mid := (b.Start + b.End) / 2
+			sumSq += n * mid * mid
+		}
+		prevCumul = cumul
+		prevLe = end
+	}
+	if len(res.Data) > 0 {
+		res.Min = res.Data[0].Start
+		res.Max = res.Data[len(res.Data)-1].End
+		// Approximation using the buckets' mid points.
+		if variance := sumSq/total - res.Avg*res.Avg; variance > 0 {
+			res.StdDev = math.Sqrt(variance)
+		}
+	}
+	return &res, skipped, nil
+}
+
+// parsePrometheusLine parses one `name{label="value",...} value [timestamp]` sample line.
+func parsePrometheusLine(line string) (string, map[string]string, float64, error) {
+	labels := make(map[string]string)
+	var name, rest string
+	if i := strings.IndexAny(line, "{ \t"); i < 0 {
+		return "", nil, 0, fmt.Errorf("missing value in %q", line)
+	} else if line[i] == '{' {
+		name = line[:i]
+		var err error
+		rest, err = parsePrometheusLabels(line[i+1:], labels)
+		if err != nil {
+			return "", nil, 0, err
+		}
+	} else {
+		name = line[:i]
+		rest = line[i:]
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return "", nil, 0, fmt.Errorf("missing value in %q", line)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return "", nil, 0, fmt.Errorf("invalid value %q: %w", fields[0], err)
+	}
+	return name, labels, value, nil
+}
+
+// parsePrometheusLabels parses the labels after the `{` into labels and returns what
+// is left after the closing `}`.
+func parsePrometheusLabels(s string, labels map[string]string) (string, error) {
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return "", fmt.Errorf("unterminated labels")
+		}
+		if s[0] == '}' {
+			return s[1:], nil
+		}
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 || len(s) < eq+2 || s[eq+1] != '"' {
+			return "", fmt.Errorf("invalid label in %q", s)
+		}
+		key := strings.TrimSpace(s[:eq])
+		s = s[eq+2:]
+		var val strings.Builder
+		i := 0
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					val.WriteByte('\n')
+				default: // \\ and \"
+					val.WriteByte(s[i])
+				}
+				continue
+			}
+			val.WriteByte(s[i])
+		}
+		if i >= len(s) {
+			return "", fmt.Errorf("unterminated label value for %q", key)
+		}
+		labels[key] = val.String()
+		s = s[i+1:]
+	}
+}
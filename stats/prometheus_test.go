@@ -0,0 +1,107 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats
+
+import (
+	"testing"
+)
+
+const promScrape = `# HELP http_request_duration_seconds A histogram of the request duration.
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{code="200",le="0.05"} 20
+http_request_duration_seconds_bucket{code="200",le="0.1"} 60
+http_request_duration_seconds_bucket{code="200",le="0.5"} 90
+http_request_duration_seconds_bucket{code="200",le="1"} 90
+http_request_duration_seconds_bucket{code="200",le="+Inf"} 90
+http_request_duration_seconds_sum{code="200"} 9.5
+http_request_duration_seconds_count{code="200"} 90
+http_request_duration_seconds_bucket{code="500",path="/a \"b\", c}",le="0.05"} 0
+http_request_duration_seconds_bucket{code="500",path="/a \"b\", c}",le="0.1"} 0
+http_request_duration_seconds_bucket{code="500",path="/a \"b\", c}",le="0.5"} 0
+http_request_duration_seconds_bucket{code="500",path="/a \"b\", c}",le="1"} 5
+http_request_duration_seconds_bucket{code="500",path="/a \"b\", c}",le="+Inf"} 10
+http_request_duration_seconds_sum{code="500",path="/a \"b\", c}"} 12.5 1700000000000
+http_request_duration_seconds_count{code="500",path="/a \"b\", c}"} 10
+other_metric 42
+`
+
+func TestParsePrometheusHistogram(t *testing.T) {
+	h, skipped, err := ParsePrometheusHistogram([]byte(promScrape), "http_request_duration_seconds")
+	if err != nil || skipped != 0 {
+		t.Fatalf("Unexpected error: %v (%d skipped)", err, skipped)
+	}
+	if h.Count != 100 || h.Sum != 22 || h.Avg != 0.22 {
+		t.Errorf("Unexpected count/sum/avg %d %g %g", h.Count, h.Sum, h.Avg)
+	}
+	expected := []Bucket{
+		{Interval{0, 0.05}, 20, 20},
+		{Interval{0.05, 0.1}, 60, 40},
+		{Interval{0.1, 0.5}, 90, 30},
+		{Interval{0.5, 1}, 95, 5},
+		{Interval{1, 1}, 100, 5},
+	}
+	if len(h.Data) != len(expected) {
+		t.Fatalf("Got %d buckets, expected %d: %+v", len(h.Data), len(expected), h.Data)
+	}
+	for i := range expected {
+		if h.Data[i] != expected[i] {
+			t.Errorf("Bucket %d: got %+v expected %+v", i, h.Data[i], expected[i])
+		}
+	}
+	if h.Min != 0 || h.Max != 1 {
+		t.Errorf("Unexpected min/max %g %g", h.Min, h.Max)
+	}
+	if p := h.CalcPercentile(50); p < 0.05 || p > 0.1 {
+		t.Errorf("Unexpected median %g", p)
+	}
+	h.CalcPercentiles([]float64{99})
+	if h.Percentiles[0].Value != 1 {
+		t.Errorf("Unexpected p99 %+v", h.Percentiles)
+	}
+}
+
+func TestParsePrometheusHistogramErrors(t *testing.T) {
+	tests := []struct {
+		text string
+		name string
+	}{
+		{promScrape, "not_there"},
+		{"foo_bucket{le=\"1\"} 3\n", "foo"},           // no +Inf
+		{"foo_bucket{code=\"200\"} 3\n", "foo"},       // no le, skipped so not found
+		{"foo_bucket{le=\"+Inf\"} abc\n", "foo"},      // bad value
+		{"foo_bucket{le=\"+Inf} 3\n", "foo"},          // unterminated
+		{"foo_bucket{le=\"+Inf\"}\n", "foo"},          // no value
+		{"foo_bucket{le=\"x\"} 3\n", "foo"},           // bad le
+		{"foo_bucket{le=\"+Inf\",bad} 3\n", "foo"},    // bad label
+		{"foo_bucket{le=\"+Inf\",a=\"b\" 3\n", "foo"}, // unterminated labels
+		{"foo_bucket\n", "foo"},                       // just a name
+	}
+	for _, tst := range tests {
+		if h, _, err := ParsePrometheusHistogram([]byte(tst.text), tst.name); err == nil {
+			t.Errorf("Expected error for %q / %s, got %+v", tst.text, tst.name, h)
+		}
+	}
+	// Malformed lines are skipped and counted:
+	withBad := promScrape + "foo{bad\nhttp_request_duration_seconds_bucket{le=\"x\"} 3\nhttp_request_duration_seconds_count{} abc\n"
+	h, skipped, err := ParsePrometheusHistogram([]byte(withBad), "http_request_duration_seconds")
+	if err != nil || skipped != 3 || h.Count != 100 {
+		t.Errorf("Unexpected result with malformed lines %+v %d %v", h, skipped, err)
+	}
+	// Empty histogram is ok:
+	h, _, err = ParsePrometheusHistogram([]byte("foo_bucket{le=\"+Inf\"} 0\nfoo_count 0\n"), "foo")
+	if err != nil || h.Count != 0 || len(h.Data) != 0 {
+		t.Errorf("Unexpected result for empty histogram %+v %v", h, err)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats // import "fortio.org/fortio/stats"
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultRateWindow is the sliding window used by RateTracker when created with a 0 window.
+var DefaultRateWindow = 10 * time.Second
+
+// number of (time, count) samples kept in the ring buffer of a RateTracker.
+const rateSlots = 50
+
+type rateSample struct {
+	t     time.Time
+	count int64
+}
+
+// RateTracker calculates the rate (per second) of an increasing count, e.g. the calls aggregated across
+// all the threads of a run, over a sliding window, from the periodic samples of that count given to Sample.
+// Safe for concurrent use.
+type RateTracker struct {
+	mutex   sync.Mutex
+	window  time.Duration
+	samples [rateSlots]rateSample // ring buffer of samples at least window/rateSlots apart.
+	last    int                   // index of the latest sample in samples.
+	n       int                   // number of samples in use.
+	latest  rateSample            // most recent sample.
+}
+
+// NewRateTracker returns a RateTracker for the given sliding window (DefaultRateWindow when 0).
+func NewRateTracker(window time.Duration) *RateTracker {
+	if window <= 0 {
+		window = DefaultRateWindow
+	}
+	return &RateTracker{window: window}
+}
+
+// Sample records the current count at time now.
+func (rt *RateTracker) Sample(now time.Time, count int64) {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+	rt.latest = rateSample{now, count}
+	if rt.n > 0 && now.Sub(rt.samples[rt.last].t) < rt.window/rateSlots {
+		return // same slot
+	}
+	rt.last = (rt.last + 1) % rateSlots
+	rt.samples[rt.last] = rt.latest
+	rt.n = min(rt.n+1, rateSlots)
+}
+
+// Rate returns the average increase of the count per second over the window ending at now,
+// 0 when there aren't at least 2 samples in that window.
+func (rt *RateTracker) Rate(now time.Time) float64 {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+	cutoff := now.Add(-rt.window)
+	// find the oldest sample still in the window
+	var base *rateSample
+	for i := range rt.n {
+		s := &rt.samples[(rt.last-i+rateSlots)%rateSlots]
+		if s.t.Before(cutoff) {
+			break
+		}
+		base = s
+	}
+	if base == nil {
+		return 0
+	}
+	elapsed := rt.latest.t.Sub(base.t).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(rt.latest.count-base.count) / elapsed
+}
@@ -0,0 +1,105 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats // import "fortio.org/fortio/stats"
+
+import "runtime"
+
+// LiveHistogram is a histogram which many goroutines, each identified by an id (e.g. their thread
+// number), can record into while it is being read. Implemented by AtomicHistogram and ShardedHistogram.
+type LiveHistogram interface {
+	// RecordNFrom records a data point N times, from the goroutine id.
+	RecordNFrom(id int, v float64, n int)
+	Count() int64
+	Snapshot() *Histogram
+	Export() *HistogramData
+}
+
+// RecordNFrom is RecordN, all the goroutines share the same data.
+func (h *AtomicHistogram) RecordNFrom(_ int, v float64, n int) {
+	h.RecordN(v, n)
+}
+
+// ShardedHistogram is a LiveHistogram for very high concurrency (e.g. 1000+ goroutines) where even
+// the atomic updates of a single AtomicHistogram contend on the same cache lines: goroutine id
+// records into its own shard (id modulo the number of shards) and the reads merge all the shards.
+type ShardedHistogram struct {
+	Offset  float64 // offset applied to data before fitting into buckets
+	Divider float64 // divider applied to data before fitting into buckets
+	shards  []*AtomicHistogram
+}
+
+// NewShardedHistogram creates a new concurrent safe histogram with n shards, runtime.NumCPU() when
+// n <= 0, see NewHistogram. Divider value can not be zero, otherwise returns nil.
+func NewShardedHistogram(offset float64, divider float64, n int) *ShardedHistogram {
+	if divider == 0 {
+		return nil
+	}
+	if n <= 0 {
+		n = runtime.NumCPU()
+	}
+	h := &ShardedHistogram{
+		Offset:  offset,
+		Divider: divider,
+		shards:  make([]*AtomicHistogram, n),
+	}
+	for i := range h.shards {
+		h.shards[i] = NewAtomicHistogram(offset, divider)
+	}
+	return h
+}
+
+// Shard returns the shard goroutine id records into. Goroutines sharing a shard (when there are
+// more of them than shards) can still record concurrently.
+func (h *ShardedHistogram) Shard(id int) *AtomicHistogram {
+	id %= len(h.shards)
+	if id < 0 {
+		id += len(h.shards)
+	}
+	return h.shards[id]
+}
+
+// RecordFrom records a data point from goroutine id.
+func (h *ShardedHistogram) RecordFrom(id int, v float64) {
+	h.Shard(id).Record(v)
+}
+
+// RecordNFrom efficiently records a data point N times from goroutine id.
+func (h *ShardedHistogram) RecordNFrom(id int, v float64, n int) {
+	h.Shard(id).RecordN(v, n)
+}
+
+// Count returns the number of data points recorded so far, in all the shards.
+func (h *ShardedHistogram) Count() int64 {
+	var total int64
+	for _, s := range h.shards {
+		total += s.Count()
+	}
+	return total
+}
+
+// Snapshot returns a regular Histogram merging the current data of all the shards,
+// see AtomicHistogram.Snapshot.
+func (h *ShardedHistogram) Snapshot() *Histogram {
+	res := NewHistogram(h.Offset, h.Divider)
+	for _, s := range h.shards {
+		res.Transfer(s.Snapshot())
+	}
+	return res
+}
+
+// Export is Snapshot().Export(), see Histogram.Export.
+func (h *ShardedHistogram) Export() *HistogramData {
+	return h.Snapshot().Export()
+}
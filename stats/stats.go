@@ -55,9 +55,8 @@ func (c *Counter) RecordN(v float64, n int) {
 	case v > c.Max:
 		c.Max = v
 	}
-	s := v * float64(n)
-	c.Sum += s
-	c.sumOfSquares += (s * s)
+	c.Sum += v * float64(n)
+	c.sumOfSquares += v * v * float64(n)
 }
 
 // Avg returns the average.
@@ -153,7 +152,7 @@ var (
 )
 
 // Histogram extends Counter and adds a histogram.
-// Must be created using NewHistogram or anotherHistogram.Clone()
+// Must be created using NewHistogram, NewHDRHistogram or anotherHistogram.Clone()
 // and not directly.
 type Histogram struct {
 	Counter
@@ -161,6 +160,8 @@ type Histogram struct {
 	Divider float64 // divider applied to data before fitting into buckets
 	// Don't access directly (outside of this package):
 	Hdata []int32 // numValues buckets (one more than values, for last one)
+	// HDR bucket layout instead of the default one when created by NewHDRHistogram.
+	hdr *hdrLayout
 }
 
 // For export of the data:
@@ -272,11 +273,43 @@ func (h *Histogram) RecordN(v float64, n int) {
 
 // Records v value to count times.
 func (h *Histogram) record(v float64, count int) {
+	var idx int
+	if h.hdr != nil {
+		idx = h.hdr.index(v)
+	} else {
+		idx = bucketIndex(v, h.Offset, h.Divider)
+	}
+	h.Hdata[idx] += int32(count) //nolint:gosec // we limit ourselves to 32 bits counts.
+}
+
+// numValues returns the number of bucket (end) values, one less than the number of buckets.
+func (h *Histogram) numValues() int {
+	return len(h.Hdata) - 1
+}
+
+// bucketValue returns the end value of the bucket i (< numValues()).
+func (h *Histogram) bucketValue(i int) float64 {
+	if h.hdr != nil {
+		return h.hdr.bounds[i]
+	}
+	return h.Divider*float64(histogramBucketValues[i]) + h.Offset
+}
+
+// sameLayout returns true if the buckets of h and o are the same.
+func (h *Histogram) sameLayout(o *Histogram) bool {
+	if h.hdr != nil || o.hdr != nil {
+		return h.hdr != nil && o.hdr != nil && h.hdr.equal(o.hdr)
+	}
+	return h.Divider == o.Divider && h.Offset == o.Offset
+}
+
+// bucketIndex returns the index in Hdata of the bucket for v.
+func bucketIndex(v, offset, divider float64) int {
 	// Scaled value to bucketize - we used to subtract epsilon because the interval
 	// is open to the left ] start, end ] so when exactly on start it has
 	// to fall on the previous bucket: which is more correctly done using
 	// math.Ceil()-1 but that doesn't work... so back to epsilon distance.
-	scaledVal := (v - h.Offset) / h.Divider
+	scaledVal := (v - offset) / divider
 	var idx int
 	switch {
 	case scaledVal <= firstValue:
@@ -293,7 +326,7 @@ func (h *Histogram) record(v float64, count int) {
 		log.Debugf("v %f -> scaledVal %.17f ceil %f delta %g - svInt %d", v, scaledVal, math.Ceil(scaledVal), delta, svInt)
 		idx = lookUpIdx(svInt)
 	}
-	h.Hdata[idx] += int32(count) //nolint:gosec // we limit ourselves to 32 bits counts.
+	return idx
 }
 
 // CalcPercentile returns the value for an input percentile
@@ -337,11 +370,10 @@ func (h *Histogram) Export() *HistogramData {
 	res.Sum = h.Counter.Sum
 	res.Avg = h.Counter.Avg()
 	res.StdDev = h.Counter.StdDev()
-	multiplier := h.Divider
-	offset := h.Offset
+	nValues := h.numValues()
 	// calculate the last bucket index
 	lastIdx := -1
-	for i := numBuckets - 1; i >= 0; i-- {
+	for i := len(h.Hdata) - 1; i >= 0; i-- {
 		if h.Hdata[i] > 0 {
 			lastIdx = i
 			break
@@ -352,15 +384,15 @@ func (h *Histogram) Export() *HistogramData {
 	}
 
 	// previous bucket value:
-	prev := histogramBucketValues[0]
+	prev := h.bucketValue(0)
 	var total int64
 	ctrTotal := float64(h.Count)
 	// export the data of each bucket of the histogram
 	for i := 0; i <= lastIdx; i++ {
 		if h.Hdata[i] == 0 {
 			// empty bucket: skip it, but update prev which is needed for next iteration
-			if i < numValues {
-				prev = histogramBucketValues[i]
+			if i < nValues {
+				prev = h.bucketValue(i)
 			}
 			continue
 		}
@@ -370,16 +402,15 @@ func (h *Histogram) Export() *HistogramData {
 			// First entry, start is min
 			b.Start = h.Min
 		} else {
-			b.Start = multiplier*float64(prev) + offset
+			b.Start = prev
 		}
 		b.Percent = 100. * float64(total) / ctrTotal
-		if i < numValues {
-			cur := histogramBucketValues[i]
-			b.End = multiplier*float64(cur) + offset
-			prev = cur
+		if i < nValues {
+			b.End = h.bucketValue(i)
+			prev = b.End
 		} else {
 			// Last Entry
-			b.Start = multiplier*float64(prev) + offset
+			b.Start = prev
 			b.End = h.Max
 		}
 		b.Count = int64(h.Hdata[i])
@@ -454,11 +485,34 @@ func (h *Histogram) Reset() {
 
 // Clone returns a copy of the histogram.
 func (h *Histogram) Clone() *Histogram {
-	hCopy := NewHistogram(h.Offset, h.Divider)
+	hCopy := h.newEmpty()
 	hCopy.CopyFrom(h)
 	return hCopy
 }
 
+// Snapshot copies the current data of h into dst and returns it, reusing the buckets of dst when it has
+// the same layout (e.g. the previous snapshot), or returns Clone() when dst is nil or has a different
+// layout. h is not modified. Together with Reset, this allows periodic (windowed) reporting without
+// allocating new histograms each time.
+func (h *Histogram) Snapshot(dst *Histogram) *Histogram {
+	if dst == nil || !dst.sameLayout(h) || len(dst.Hdata) != len(h.Hdata) {
+		return h.Clone()
+	}
+	dst.Reset()
+	dst.CopyFrom(h)
+	return dst
+}
+
+// newEmpty returns a new histogram with the same parameters (and layout) as h.
+func (h *Histogram) newEmpty() *Histogram {
+	return &Histogram{
+		Offset:  h.Offset,
+		Divider: h.Divider,
+		Hdata:   make([]int32, len(h.Hdata)),
+		hdr:     h.hdr, // immutable, can be shared
+	}
+}
+
 // CopyFrom sets the content of this object to a copy of the src.
 func (h *Histogram) CopyFrom(src *Histogram) {
 	h.Counter = src.Counter
@@ -469,7 +523,7 @@ func (h *Histogram) CopyFrom(src *Histogram) {
 // Src histogram data values will be appended according to this object's
 // offset and divider.
 func (h *Histogram) copyHDataFrom(src *Histogram) {
-	if h.Divider == src.Divider && h.Offset == src.Offset {
+	if h.sameLayout(src) {
 		for i := 0; i < len(h.Hdata); i++ {
 			h.Hdata[i] += src.Hdata[i]
 		}
@@ -483,8 +537,15 @@ func (h *Histogram) copyHDataFrom(src *Histogram) {
 }
 
 // Merge two different histogram with different scale parameters
-// Lowest offset and highest divider value will be selected on new Histogram as scale parameters.
+// Lowest offset and highest divider value will be selected on new Histogram as scale parameters,
+// unless both are HDR histograms with the same layout, which is then kept.
 func Merge(h1 *Histogram, h2 *Histogram) *Histogram {
+	if h1.hdr != nil && h1.sameLayout(h2) {
+		newH := h1.newEmpty()
+		newH.Transfer(h1)
+		newH.Transfer(h2)
+		return newH
+	}
 	divider := h1.Divider
 	offset := h1.Offset
 	if h2.Divider > h1.Divider {
@@ -514,6 +575,23 @@ func (h *Histogram) Transfer(src *Histogram) {
 	src.Reset()
 }
 
+// AddData merges the exported data d (e.g. of a saved Export()) into this Histogram: the buckets' counts
+// are recorded at their end values, so data exported from a histogram of the same layout is restored
+// exactly, and the count, min, max, sum and standard deviation are restored from d.
+func (h *Histogram) AddData(d *HistogramData) {
+	if d == nil || d.Count == 0 {
+		return
+	}
+	src := h.newEmpty()
+	for _, b := range d.Data {
+		src.record(b.End, int(b.Count))
+	}
+	fC := float64(d.Count)
+	src.Count, src.Min, src.Max, src.Sum = d.Count, d.Min, d.Max, d.Sum
+	src.sumOfSquares = fC*d.StdDev*d.StdDev + d.Sum*d.Sum/fC
+	h.Transfer(src)
+}
+
 // ParsePercentiles extracts the percentiles from string (flag).
 func ParsePercentiles(percentiles string) ([]float64, error) {
 	percs := strings.Split(percentiles, ",") // will make a size 1 array for empty input!
@@ -17,11 +17,19 @@ package stats
 import (
 	"bufio"
 	"bytes"
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"io"
+	"math"
 	"math/rand"
 	"os"
 	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -225,6 +233,19 @@ func TestPercentiles1(t *testing.T) {
 	}
 }
 
+func TestCounterRecordN(t *testing.T) {
+	var c, cn Counter
+	for _, v := range []float64{1, 2, 7} {
+		for range 5 {
+			c.Record(v)
+		}
+		cn.RecordN(v, 5) // same as 5 Record(v), as when sampling.
+	}
+	if cn.Count != c.Count || cn.Sum != c.Sum || cn.Avg() != c.Avg() || math.Abs(cn.StdDev()-c.StdDev()) > 1e-9 {
+		t.Errorf("RecordN mismatch: %+v stddev %g vs %+v stddev %g", cn, cn.StdDev(), c, c.StdDev())
+	}
+}
+
 func TestHistogramData(t *testing.T) {
 	h := NewHistogram(0, 1)
 	h.Record(-1)
@@ -657,6 +678,38 @@ h3 after merge - 2 : count 4 avg 50 +/- 35.36 min 10 max 90 sum 200
 	}
 }
 
+func TestHistogramAddData(t *testing.T) {
+	h := NewHistogram(0, 0.001)
+	for _, v := range []float64{0.0005, 0.0012, 0.003, 0.003, 0.047, 0.2, 150} {
+		h.Record(v)
+	}
+	saved := h.Export()
+	jsonData, err := json.Marshal(saved)
+	if err != nil {
+		t.Fatalf("Unable to serialize histogram data: %v", err)
+	}
+	var loaded HistogramData
+	if err = json.Unmarshal(jsonData, &loaded); err != nil {
+		t.Fatalf("Unable to deserialize histogram data: %v", err)
+	}
+	restored := NewHistogram(0, 0.001)
+	restored.AddData(&loaded)
+	if !reflect.DeepEqual(restored.Hdata, h.Hdata) {
+		t.Errorf("Restored buckets differ:\n%v\nvs\n%v", restored.Hdata, h.Hdata)
+	}
+	r := restored.Export()
+	if r.Count != saved.Count || r.Min != saved.Min || r.Max != saved.Max || r.Sum != saved.Sum ||
+		math.Abs(r.StdDev-saved.StdDev) > 1e-9 {
+		t.Errorf("Restored stats %+v differ from saved %+v", r, saved)
+	}
+	// Adding to existing data:
+	restored.AddData(&loaded)
+	restored.AddData(nil)
+	if restored.Count != 2*h.Count || restored.Hdata[0] != 2*h.Hdata[0] || restored.Avg() != h.Avg() {
+		t.Errorf("Unexpected merged data %+v", restored.Export())
+	}
+}
+
 func TestParsePercentiles(t *testing.T) {
 	tests := []struct {
 		str  string    // input
@@ -863,6 +916,60 @@ func TestMultipleConnIPOccurrence(t *testing.T) {
 // 1-2 with count 3
 // 2-2.5 with count 1
 
+func TestRateTracker(t *testing.T) {
+	rt := NewRateTracker(200 * time.Millisecond)
+	now := time.Now()
+	assert.Equal(t, rt.Rate(now), 0., "no data rate")
+	rt.Sample(now, 0)
+	assert.Equal(t, rt.Rate(now), 0., "single sample rate")
+	// 20 calls in 100ms, sampled every 10ms
+	for i := range 10 {
+		rt.Sample(now.Add(time.Duration(i+1)*10*time.Millisecond), int64(2*(i+1)))
+	}
+	assert.Equal(t, rt.Rate(now.Add(100*time.Millisecond)), 200., "rate")
+	// Only the last 200ms count:
+	rt.Sample(now.Add(300*time.Millisecond), 40)
+	assert.Equal(t, rt.Rate(now.Add(300*time.Millisecond)), 100., "sliding window rate")
+	assert.Equal(t, rt.Rate(now.Add(time.Second)), 0., "rate after window")
+	assert.Equal(t, NewRateTracker(0).window, DefaultRateWindow, "default window")
+}
+
+func TestResetAndSnapshot(t *testing.T) {
+	for _, h := range []*Histogram{NewHistogram(0, 1), NewHDRHistogram(DefaultHDRLowest, DefaultHDRHighest, 2)} {
+		h.Record(10)
+		h.Record(20)
+		snap := h.Snapshot(nil)
+		h.Reset()
+		if h.Count != 0 || h.Sum != 0 || h.Min != 0 || h.Max != 0 || h.StdDev() != 0 || len(h.Export().Data) != 0 {
+			t.Errorf("Not reset: %+v", h.Export())
+		}
+		h.Record(5)
+		e := h.Export()
+		if e.Count != 1 || e.Min != 5 || e.Max != 5 || len(e.Data) != 1 || e.Data[0].Count != 1 {
+			t.Errorf("Unexpected data after reset and record: %+v", e)
+		}
+		if snap.Count != 2 || snap.Min != 10 || snap.Max != 20 || snap.IsHDR() != h.IsHDR() {
+			t.Errorf("Snapshot changed by reset: %+v", snap.Export())
+		}
+		// Snapshot into the previous one reuses its buckets.
+		snap2 := h.Snapshot(snap)
+		if snap2 != snap || !reflect.DeepEqual(snap2.Export(), e) {
+			t.Errorf("Unexpected second snapshot %p %p %+v", snap2, snap, snap2.Export())
+		}
+		h.Record(6)
+		if snap2.Count != 1 {
+			t.Errorf("Snapshot changed by record: %+v", snap2.Export())
+		}
+	}
+	// Different layout: new histogram.
+	h := NewHistogram(0, 1)
+	h.Record(1)
+	other := NewHistogram(0, 0.001)
+	if s := h.Snapshot(other); s == other || s.Divider != 1 || s.Count != 1 {
+		t.Errorf("Unexpected snapshot into different layout %+v", s)
+	}
+}
+
 func BenchmarkBucketLookUpWithHighestValue(b *testing.B) {
 	testHistogram := NewHistogram(0, 1)
 	for i := 0; i < b.N; i++ {
@@ -876,3 +983,378 @@ func BenchmarkBucketLookUpWithRandomValues(b *testing.B) {
 		testHistogram.Record(float64(rand.Intn(100000)))
 	}
 }
+
+// benchmarkLiveRecord records b.N values into h from 64 goroutines.
+func benchmarkLiveRecord(b *testing.B, h LiveHistogram) {
+	const numG = 64
+	var wg sync.WaitGroup
+	b.ResetTimer()
+	for g := range numG {
+		wg.Add(1)
+		go func() {
+			for i := g; i < b.N; i += numG {
+				h.RecordNFrom(g, float64(i%1000)/1000., 1)
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkRecord(b *testing.B) {
+	benchmarkLiveRecord(b, NewAtomicHistogram(0, 0.001))
+}
+
+func BenchmarkShardedRecord(b *testing.B) {
+	benchmarkLiveRecord(b, NewShardedHistogram(0, 0.001, 0))
+}
+
+// exactHistogram returns HistogramData with one zero width bucket per value, so the variance estimate is exact.
+func exactHistogram(values []float64) *HistogramData {
+	res := &HistogramData{Min: values[0], Max: values[0]}
+	for _, v := range values {
+		res.Count++
+		res.Sum += v
+		res.Min = min(res.Min, v)
+		res.Max = max(res.Max, v)
+		res.Data = append(res.Data, Bucket{Interval: Interval{Start: v, End: v}, Count: 1})
+	}
+	res.Avg = res.Sum / float64(res.Count)
+	return res
+}
+
+func seq(from, to int) []float64 {
+	var res []float64
+	for i := from; i <= to; i++ {
+		res = append(res, float64(i))
+	}
+	return res
+}
+
+func TestWelchTTest(t *testing.T) {
+	tests := []struct {
+		a, b []float64
+		// R's t.test(a, b) results
+		tStat  float64
+		pValue float64
+	}{
+		{seq(1, 10), seq(7, 20), -5.4349, 1.855e-05},
+		{seq(1, 10), append(seq(7, 20), 200), -1.6329, 0.1245},
+		{seq(7, 20), seq(1, 10), 5.4349, 1.855e-05},
+	}
+	for _, tst := range tests {
+		tStat, pValue := WelchTTest(exactHistogram(tst.a), exactHistogram(tst.b))
+		if math.Abs(tStat-tst.tStat) > 0.01*math.Abs(tst.tStat) {
+			t.Errorf("t-stat %g not within 1%% of %g", tStat, tst.tStat)
+		}
+		if math.Abs(pValue-tst.pValue) > 0.01*tst.pValue {
+			t.Errorf("p-value %g not within 1%% of %g", pValue, tst.pValue)
+		}
+	}
+	// Same distribution isn't significant, shifted one is.
+	h1 := NewHistogram(0, 0.001)
+	h2 := NewHistogram(0, 0.001)
+	h3 := NewHistogram(0, 0.001)
+	for i := range 1000 {
+		v := 0.010 + 0.001*float64(i%10)
+		h1.Record(v)
+		h2.Record(v)
+		h3.Record(v + 0.002)
+	}
+	_, p := WelchTTest(h1.Export(), h2.Export())
+	if p < 0.99 {
+		t.Errorf("Identical histograms p-value %g should be ~1", p)
+	}
+	_, p = WelchTTest(h1.Export(), h3.Export())
+	if p > 0.05 {
+		t.Errorf("Shifted histograms p-value %g should be significant", p)
+	}
+	tStat, p := WelchTTest(h1.Export(), NewHistogram(0, 1).Export())
+	if !math.IsNaN(tStat) || !math.IsNaN(p) {
+		t.Errorf("Expected NaN for empty histogram, got %g %g", tStat, p)
+	}
+}
+
+func TestAtomicHistogram(t *testing.T) {
+	assert.True(t, NewAtomicHistogram(0, 0) == nil, "zero divider should return nil")
+	ah := NewAtomicHistogram(-1, 0.5)
+	h := NewHistogram(-1, 0.5)
+	assert.Equal(t, ah.Export().Count, int64(0), "empty count")
+	const numG = 8
+	const perG = 1000
+	done := make(chan struct{})
+	for g := range numG {
+		go func() {
+			for i := range perG {
+				ah.Record(float64((g*perG+i)%250) / 10.)
+			}
+			done <- struct{}{}
+		}()
+	}
+	// concurrent reads while recording
+	for range 10 {
+		d := ah.Export()
+		assert.True(t, d.Count <= numG*perG, "count too high")
+	}
+	for range numG {
+		<-done
+	}
+	for g := range numG {
+		for i := range perG {
+			h.Record(float64((g*perG+i)%250) / 10.)
+		}
+	}
+	assert.Equal(t, ah.Count(), int64(numG*perG), "count")
+	expected := h.Export().CalcPercentiles([]float64{50, 99})
+	actual := ah.Export().CalcPercentiles([]float64{50, 99})
+	assert.Equal(t, actual.Count, expected.Count, "exported count")
+	assert.Equal(t, actual.Min, expected.Min, "min")
+	assert.Equal(t, actual.Max, expected.Max, "max")
+	assert.True(t, math.Abs(actual.Sum-expected.Sum) < 1e-6, "sum")
+	assert.True(t, math.Abs(actual.StdDev-expected.StdDev) < 1e-6, "stddev")
+	assert.Equal(t, actual.Data, expected.Data, "buckets")
+	assert.Equal(t, actual.Percentiles, expected.Percentiles, "percentiles")
+}
+
+func TestShardedHistogram(t *testing.T) {
+	assert.True(t, NewShardedHistogram(0, 0, 4) == nil, "zero divider should return nil")
+	sh := NewShardedHistogram(-1, 0.5, 3)
+	h := NewHistogram(-1, 0.5)
+	assert.Equal(t, sh.Count(), int64(0), "empty count")
+	assert.True(t, sh.Shard(1) == sh.Shard(4) && sh.Shard(-1) == sh.Shard(2), "shards modulo")
+	const numG = 8
+	const perG = 1000
+	done := make(chan struct{})
+	for g := range numG {
+		go func() {
+			for i := range perG {
+				sh.RecordFrom(g, float64((g*perG+i)%250)/10.)
+			}
+			done <- struct{}{}
+		}()
+	}
+	for range numG {
+		<-done
+	}
+	for g := range numG {
+		for i := range perG {
+			h.Record(float64((g*perG+i)%250) / 10.)
+		}
+	}
+	assert.Equal(t, sh.Count(), int64(numG*perG), "count")
+	assert.Equal(t, sh.Shard(0).Count(), int64(3*perG), "goroutines 0, 3 and 6 shard count")
+	expected := h.Export().CalcPercentiles([]float64{50, 99})
+	actual := sh.Export().CalcPercentiles([]float64{50, 99})
+	assert.Equal(t, actual.Count, expected.Count, "exported count")
+	assert.Equal(t, actual.Min, expected.Min, "min")
+	assert.Equal(t, actual.Max, expected.Max, "max")
+	assert.True(t, math.Abs(actual.Sum-expected.Sum) < 1e-6, "sum")
+	assert.True(t, math.Abs(actual.StdDev-expected.StdDev) < 1e-6, "stddev")
+	assert.Equal(t, actual.Data, expected.Data, "buckets")
+	assert.Equal(t, actual.Percentiles, expected.Percentiles, "percentiles")
+	assert.Equal(t, len(NewShardedHistogram(0, 1, 0).shards), runtime.NumCPU(), "default shards")
+}
+
+func TestToGraphite(t *testing.T) {
+	h := NewHistogram(0, 1)
+	for _, v := range []float64{1, 1, 2, 10} {
+		h.Record(v)
+	}
+	ts := time.Unix(1700000000, 0)
+	actual := h.Export().CalcPercentiles([]float64{99.9}).ToGraphite("fortio.http", ts)
+	expected := `fortio.http.le_1 2 1700000000
+fortio.http.le_2 1 1700000000
+fortio.http.le_10 1 1700000000
+fortio.http.count 4 1700000000
+fortio.http.min 1 1700000000
+fortio.http.max 10 1700000000
+fortio.http.avg 3.5 1700000000
+fortio.http.stddev 3.774917217635375 1700000000
+fortio.http.p99_9 9.996 1700000000
+fortio.http.p50 1 1700000000
+fortio.http.p99 9.96 1700000000
+`
+	assert.Equal(t, actual, expected, "graphite lines")
+	assert.Equal(t, GraphitePercentileName(99.99), "p99_99", "percentile name")
+	assert.Equal(t, GraphitePercentileName(50), "p50", "percentile name")
+	assert.Equal(t, GraphiteBucketName(0.005), "le_0_005", "bucket name")
+}
+
+func TestHDRHistogram(t *testing.T) {
+	assert.True(t, NewHDRHistogram(0, 1, 2) == nil, "zero lowest should return nil")
+	assert.True(t, NewHDRHistogram(1, 1, 2) == nil, "highest <= lowest should return nil")
+	assert.True(t, NewHDRHistogram(1e-6, 1, 6) == nil, "too many significant figures should return nil")
+	h := NewHDRHistogram(DefaultHDRLowest, DefaultHDRHighest, DefaultHDRSignificantFigures)
+	assert.True(t, h.IsHDR(), "should be HDR")
+	assert.Equal(t, len(h.Hdata), 256+24*128+1, "default buckets count")
+	// Bimodal: 99% of the values between 10us and 1ms, 1% between 1s and 10s.
+	r := rand.New(rand.NewSource(42)) //nolint:gosec // deterministic test data
+	values := make([]float64, 0, 10000)
+	for i := range 10000 {
+		exp := -5 + 2*r.Float64()
+		if i%100 == 0 {
+			exp = r.Float64()
+		}
+		v := math.Pow(10, exp)
+		values = append(values, v)
+		h.Record(v)
+	}
+	sort.Float64s(values)
+	percentiles := []float64{10, 50, 90, 98, 99.5, 99.9}
+	res := h.Export().CalcPercentiles(percentiles)
+	assert.Equal(t, res.Count, int64(10000), "count")
+	assert.Equal(t, res.Min, values[0], "min")
+	assert.Equal(t, res.Max, values[len(values)-1], "max")
+	for _, p := range res.Percentiles {
+		exact := values[int(p.Percentile*float64(len(values))/100.)-1]
+		if math.Abs(p.Value-exact)/exact > 0.02 {
+			t.Errorf("p%g: %g too far from %g", p.Percentile, p.Value, exact)
+		}
+	}
+	// Clone and Merge keep the layout, Transfer/ToStandard into the default one.
+	c := h.Clone()
+	assert.True(t, c.IsHDR(), "clone should be HDR")
+	assert.Equal(t, c.Export(), h.Export(), "clone export")
+	m := Merge(c, h.Clone())
+	assert.True(t, m.IsHDR(), "merge should be HDR")
+	assert.Equal(t, m.Count, int64(20000), "merged count")
+	std := h.ToStandard(0, 0.001)
+	assert.False(t, std.IsHDR(), "should be standard")
+	assert.Equal(t, len(std.Hdata), numBuckets, "standard buckets count")
+	stdRes := std.Export()
+	assert.Equal(t, stdRes.Count, res.Count, "standard count")
+	assert.Equal(t, stdRes.Min, res.Min, "standard min")
+	assert.Equal(t, stdRes.Max, res.Max, "standard max")
+	assert.Equal(t, stdRes.Sum, res.Sum, "standard sum")
+	back := std.ToHDR(DefaultHDRLowest, DefaultHDRHighest, DefaultHDRSignificantFigures)
+	assert.True(t, back.IsHDR(), "should be HDR again")
+	assert.Equal(t, back.Count, int64(10000), "converted back count")
+	// Values are in ]previous bound, bound] buckets like the default layout.
+	h2 := NewHDRHistogram(1, 1000, 1)
+	h2.Record(0)
+	h2.Record(1)
+	h2.Record(1.5)
+	h2.Record(2000)
+	d := h2.Export()
+	assert.Equal(t, len(d.Data), 3, "buckets")
+	assert.Equal(t, d.Data[0], Bucket{Interval{0, 1}, 50, 2}, "first bucket")
+	assert.Equal(t, d.Data[1], Bucket{Interval{1, 2}, 75, 1}, "second bucket")
+	assert.Equal(t, d.Data[2].Count, int64(1), "overflow bucket")
+	assert.Equal(t, d.Data[2].End, 2000., "overflow bucket end")
+}
+
+func TestHDRWireFormat(t *testing.T) {
+	for _, v := range []int64{0, 1, -1, 63, -64, 64, 1 << 40, -(1 << 55), math.MaxInt64, math.MinInt64} {
+		buf := putZigZag(nil, v)
+		assert.True(t, len(buf) <= 9, "at most 9 bytes")
+		d, rest, err := zigZag(append(buf, 42))
+		assert.NoError(t, err)
+		assert.Equal(t, d, v, "zig zag round trip")
+		assert.Equal(t, rest, []byte{42}, "rest")
+	}
+	_, _, err := zigZag([]byte{0x80, 0x80})
+	assert.Error(t, err, "truncated varint")
+	h := NewHDRHistogram(DefaultHDRLowest, DefaultHDRHighest, DefaultHDRSignificantFigures)
+	r := rand.New(rand.NewSource(42)) //nolint:gosec // deterministic test data
+	for i := range 10000 {
+		exp := -5 + 2*r.Float64()
+		if i%100 == 0 {
+			exp = r.Float64()
+		}
+		h.Record(math.Pow(10, exp))
+	}
+	orig := h.Export()
+	var buf bytes.Buffer
+	assert.NoError(t, orig.MarshalHDR(&buf))
+	// Same as the "HISTFAAA..." base64 logs of HdrHistogram's tools.
+	assert.True(t, strings.HasPrefix(base64.StdEncoding.EncodeToString(buf.Bytes()), "HISTFAAA"), "compressed V2 cookie")
+	res, err := UnmarshalHDR(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, res.Count, orig.Count, "count")
+	assert.Equal(t, len(res.Data), len(orig.Data), "same buckets")
+	for i := range orig.Data {
+		assert.Equal(t, res.Data[i].Count, orig.Data[i].Count, "bucket count")
+		assert.True(t, math.Abs(res.Data[i].Percent-orig.Data[i].Percent) < 1e-9, "bucket percent")
+		if i > 0 { // first start is Min (and last end is Max) in the original
+			assert.True(t, math.Abs(res.Data[i].Start-orig.Data[i].Start) < 1e-12, "bucket start")
+		}
+		if i < len(orig.Data)-1 {
+			assert.True(t, math.Abs(res.Data[i].End-orig.Data[i].End) < 1e-12, "bucket end")
+		}
+	}
+	assert.True(t, math.Abs(res.Avg-orig.Avg)/orig.Avg < 0.01, "approximate average")
+	// Standard layout: each bucket's count is recorded at its mid point so the percentiles stay
+	// within about half a (100..1000 sized) bucket.
+	std := h.ToStandard(0, 0.000001).Export().CalcPercentiles([]float64{50, 99})
+	buf.Reset()
+	assert.NoError(t, std.MarshalHDR(&buf))
+	res, err = UnmarshalHDR(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, res.Count, std.Count, "standard count")
+	res.CalcPercentiles([]float64{50, 99})
+	for i, p := range res.Percentiles {
+		exp := std.Percentiles[i].Value
+		if math.Abs(p.Value-exp)/exp > 0.06 {
+			t.Errorf("p%g: %g too far from %g", p.Percentile, p.Value, exp)
+		}
+	}
+	// Errors and empty histograms.
+	neg := NewHistogram(-10, 1)
+	neg.Record(-5)
+	assert.Error(t, neg.Export().MarshalHDR(&buf), "negative values")
+	_, err = UnmarshalHDR(bytes.NewReader([]byte{1, 2, 3, 4, 0, 0, 0, 0}))
+	assert.Error(t, err, "bad cookie")
+	buf.Reset()
+	for _, v := range []any{int32(hdrEncodingCookie), int32(math.MaxInt32), int32(0), int32(3), int64(1), int64(1000), float64(1)} {
+		assert.NoError(t, binary.Write(&buf, binary.BigEndian, v))
+	}
+	buf.WriteString("short")
+	_, err = UnmarshalHDR(&buf)
+	assert.Equal(t, err, io.ErrUnexpectedEOF, "payload shorter than its header's length")
+	buf.Reset()
+	assert.NoError(t, NewHistogram(0, 1).Export().MarshalHDR(&buf))
+	res, err = UnmarshalHDR(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, res.Count, int64(0), "empty")
+}
+
+func TestPrintASCII(t *testing.T) {
+	for _, tst := range []struct {
+		seconds  float64
+		expected string
+	}{
+		{0.0000125, "12.5μs"},
+		{0.0015, "1.5ms"},
+		{2.25, "2.25s"},
+	} {
+		assert.Equal(t, FormatDuration(tst.seconds), tst.expected, "format duration")
+	}
+	h := NewHistogram(0, 0.001)
+	for range 16 {
+		h.Record(0.0005)
+	}
+	for range 4 {
+		h.Record(0.0025)
+	}
+	var buf bytes.Buffer
+	h.Export().PrintASCII(&buf, 60)
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	assert.Equal(t, len(lines), 2, "one line per (non empty) bucket")
+	// Bars are width - label - count - separators = 60 - 11 - 10 - 4 = 35 long for the largest count.
+	assert.Equal(t, lines[0], "500μs - 1ms | "+strings.Repeat("█", 35)+" 16 (80.0%)", "first bucket")
+	// 4/16 of 35 is 8.75: 8 full and a 6/8th block.
+	assert.Equal(t, lines[1], "2ms - 2.5ms | "+strings.Repeat("█", 8)+"▊"+strings.Repeat(" ", 26)+" 4 (20.0%)", "last bucket")
+	buf.Reset()
+	NewHistogram(0, 1).Export().PrintASCII(&buf, 60)
+	assert.Equal(t, buf.String(), "No data\n", "empty histogram")
+	// Many buckets get merged:
+	h = NewHistogram(0, 0.0001)
+	for i := range 1000 {
+		h.Record(float64(i) * 0.0001)
+	}
+	buf.Reset()
+	h.Export().PrintASCII(&buf, 80)
+	if n := strings.Count(buf.String(), "\n"); n > MaxASCIIRows {
+		t.Errorf("Too many rows %d", n)
+	}
+}
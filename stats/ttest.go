@@ -0,0 +1,133 @@
+// Copyright 2026 Fortio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats // import "fortio.org/fortio/stats"
+
+import (
+	"math"
+)
+
+// Variance returns the (sample, n-1) variance estimated from the buckets midpoints around the Avg.
+func (e *HistogramData) Variance() float64 {
+	if e.Count < 2 {
+		return 0
+	}
+	sum := 0.
+	for _, b := range e.Data {
+		d := (b.Start+b.End)/2. - e.Avg
+		sum += float64(b.Count) * d * d
+	}
+	return sum / float64(e.Count-1)
+}
+
+// WelchTTest performs Welch's (unequal variances) t-test between the 2 histograms, using their Avg
+// and the Variance() estimated from the buckets. Returns the t statistic and the two-sided p-value:
+// a pValue < 0.05 indicates the difference of the means is statistically significant.
+// Both are NaN when either histogram has less than 2 data points.
+func WelchTTest(a, b *HistogramData) (tStat float64, pValue float64) {
+	if a.Count < 2 || b.Count < 2 {
+		return math.NaN(), math.NaN()
+	}
+	va := a.Variance() / float64(a.Count)
+	vb := b.Variance() / float64(b.Count)
+	diff := a.Avg - b.Avg
+	se2 := va + vb
+	if se2 == 0 {
+		if diff == 0 {
+			return 0, 1
+		}
+		return math.Copysign(math.Inf(1), diff), 0
+	}
+	tStat = diff / math.Sqrt(se2)
+	// Welch-Satterthwaite degrees of freedom.
+	df := se2 * se2 / (va*va/float64(a.Count-1) + vb*vb/float64(b.Count-1))
+	return tStat, studentTwoSided(tStat, df)
+}
+
+// studentTwoSided returns P(|T| > |t|) for the Student's t distribution with df degrees of freedom,
+// which is the regularized incomplete beta function I_x(df/2, 1/2) with x = df/(df+t^2).
+func studentTwoSided(t, df float64) float64 {
+	return incompleteBeta(df/2., 0.5, df/(df+t*t))
+}
+
+// incompleteBeta is the regularized incomplete beta function I_x(a, b), from Numerical Recipes (betai).
+func incompleteBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log1p(-x))
+	// The continued fraction converges rapidly for x < (a+1)/(a+b+2), use the symmetry otherwise.
+	if x < (a+1.)/(a+b+2.) {
+		return front * betaContinuedFraction(a, b, x) / a
+	}
+	return 1. - front*betaContinuedFraction(b, a, 1.-x)/b
+}
+
+// betaContinuedFraction evaluates the continued fraction for incompleteBeta using the modified Lentz's method.
+func betaContinuedFraction(a, b, x float64) float64 {
+	const (
+		maxIterations = 300
+		epsilon       = 1e-15
+		tiny          = 1e-300
+	)
+	qab := a + b
+	qap := a + 1.
+	qam := a - 1.
+	c := 1.
+	d := 1. - qab*x/qap
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1. / d
+	h := d
+	for m := 1; m <= maxIterations; m++ {
+		fm := float64(m)
+		m2 := 2. * fm
+		// Even step.
+		aa := fm * (b - fm) * x / ((qam + m2) * (a + m2))
+		d = 1. + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1. + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1. / d
+		h *= d * c
+		// Odd step.
+		aa = -(a + fm) * (qab + fm) * x / ((a + m2) * (qap + m2))
+		d = 1. + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1. + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1. / d
+		del := d * c
+		h *= del
+		if math.Abs(del-1.) < epsilon {
+			break
+		}
+	}
+	return h
+}
@@ -22,6 +22,7 @@ import (
 	"io"
 	"net"
 	"sort"
+	"sync"
 	"syscall"
 	"time"
 
@@ -44,13 +45,45 @@ type RunnerResults struct {
 	BytesReceived int64
 	client        *TCPClient
 	aborter       *periodic.Aborter
+	// When the run has a RunTimeout: each call uses its own connection, so an abandoned one doesn't
+	// block the next, and the results are updated under mutex.
+	concurrent bool
+	mutex      sync.Mutex
 }
 
 // Run tests TCP request fetching. Main call being run at the target QPS.
 // To be set as the Function in RunnerOptions.
 func (tcpstate *RunnerResults) Run(_ context.Context, t periodic.ThreadID) (bool, string) {
 	log.Debugf("Calling in %d", t)
+	if tcpstate.concurrent {
+		return tcpstate.runConcurrent()
+	}
 	_, err := tcpstate.client.Fetch()
+	return tcpstate.recordResult(err)
+}
+
+// ConcurrentSafe implements periodic.ConcurrentRunnable: calls can only be abandoned, see RunTimeout,
+// when each uses its own connection.
+func (tcpstate *RunnerResults) ConcurrentSafe() bool {
+	return tcpstate.concurrent
+}
+
+// runConcurrent is Run with a new connection for the call, which adds its counters to the thread's client.
+func (tcpstate *RunnerResults) runConcurrent() (bool, string) {
+	tcpstate.mutex.Lock()
+	c := tcpstate.client.perCall()
+	tcpstate.mutex.Unlock()
+	_, err := c.Fetch()
+	c.Close()
+	tcpstate.mutex.Lock()
+	defer tcpstate.mutex.Unlock()
+	tcpstate.client.socketCount += c.socketCount
+	tcpstate.client.bytesSent += c.bytesSent
+	tcpstate.client.bytesReceived += c.bytesReceived
+	return tcpstate.recordResult(err)
+}
+
+func (tcpstate *RunnerResults) recordResult(err error) (bool, string) {
 	if err != nil {
 		errStr := err.Error()
 		tcpstate.RetCodes[errStr]++
@@ -220,6 +253,18 @@ func (c *TCPClient) Fetch() ([]byte, error) {
 	return c.buffer[:n], nil
 }
 
+// perCall returns a copy of the client, without its connection and counters, for 1 Fetch. The message
+// count is incremented in c as if c was doing it.
+func (c *TCPClient) perCall() *TCPClient {
+	cc := *c
+	cc.socket = nil
+	cc.buffer = make([]byte, len(c.buffer))
+	cc.socketCount, cc.bytesSent, cc.bytesReceived = 0, 0, 0
+	c.messageCount++
+	cc.messageCount = c.messageCount - 1 // incremented by Fetch
+	return &cc
+}
+
 // Close closes the last connection and returns the total number of sockets used for the run.
 func (c *TCPClient) Close() int {
 	log.Debugf("Closing %p: %s socket count %d", c, c.destination, c.socketCount)
@@ -266,12 +311,14 @@ func RunTCPTest(o *RunnerOptions) (*RunnerResults, error) {
 		// Set up the stats for each 'thread'
 		tcpstate[i].aborter = total.aborter
 		tcpstate[i].RetCodes = make(TCPResultMap)
+		tcpstate[i].concurrent = r.Options().RunTimeout > 0
 	}
 	total.RunnerResults = r.Run()
 	// Numthreads may have reduced, but it should be ok to accumulate 0s from
 	// unused ones. We also must clean up all the created clients.
 	keys := []string{}
 	for i := range numThreads {
+		tcpstate[i].mutex.Lock() // abandoned calls (see RunTimeout) may still be in progress.
 		total.SocketCount += tcpstate[i].client.Close()
 		total.BytesReceived += tcpstate[i].client.bytesReceived
 		total.BytesSent += tcpstate[i].client.bytesSent
@@ -281,6 +328,7 @@ func RunTCPTest(o *RunnerOptions) (*RunnerResults, error) {
 			}
 			total.RetCodes[k] += tcpstate[i].RetCodes[k]
 		}
+		tcpstate[i].mutex.Unlock()
 	}
 	// Cleanup state:
 	r.Options().ReleaseRunners()
@@ -17,9 +17,11 @@ package tcprunner
 
 import (
 	"fmt"
+	"io"
 	"net"
 	"runtime"
 	"testing"
+	"time"
 
 	"fortio.org/fortio/fnet"
 	"fortio.org/log"
@@ -89,6 +91,43 @@ func TestTCPRunnerLargePayload(t *testing.T) {
 	}
 }
 
+func TestTCPRunTimeout(t *testing.T) {
+	// Accepts the connections but never replies.
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, _ = io.Copy(io.Discard, c)
+				c.Close()
+			}()
+		}
+	}()
+	opts := RunnerOptions{}
+	opts.QPS = -1
+	opts.NumThreads = 1
+	opts.Exactly = 4
+	opts.RunTimeout = 50 * time.Millisecond
+	opts.ReqTimeout = 500 * time.Millisecond
+	opts.Destination = l.Addr().String()
+	start := time.Now()
+	res, err := RunTCPTest(&opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Each stuck call is abandoned, and the next made on a new connection, instead of waiting for ReqTimeout.
+	if res.TimeoutCount != 4 || res.DurationHistogram.Count != 4 || time.Since(start) > 400*time.Millisecond {
+		t.Errorf("Unexpected timeouts %d, calls %d after %v", res.TimeoutCount, res.DurationHistogram.Count, time.Since(start))
+	}
+}
+
 func TestTCPNotLeaking(t *testing.T) {
 	opts := &RunnerOptions{}
 	ngBefore1 := runtime.NumGoroutine()
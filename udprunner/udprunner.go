@@ -17,12 +17,14 @@ package udprunner
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"sort"
+	"strings"
 	"time"
 
 	"fortio.org/fortio/fnet"
@@ -35,6 +37,9 @@ import (
 
 var UDPTimeOutDefaultValue = 750 * time.Millisecond
 
+// Binding responses are the header plus the XOR-MAPPED-ADDRESS, larger for other servers with more attributes.
+const stunMaxResponseSize = 1024
+
 type UDPResultMap map[string]int64
 
 // RunnerResults is the aggregated result of an UDPRunner.
@@ -69,6 +74,43 @@ type UDPOptions struct {
 	Destination string
 	Payload     []byte // what to send (and check)
 	ReqTimeout  time.Duration
+	// Send STUN binding requests (instead of the payload) and check the responses are the matching
+	// binding success, e.g. against fnet.STUNEchoServer or any STUN server.
+	STUNMode bool
+	// Transport to use instead of UDP, e.g. SCTP (see sctprunner).
+	Transport *Transport `json:"-"`
+}
+
+// Transport is how the client reaches the echo Destination, UDP by default.
+type Transport struct {
+	// Lower case protocol name, e.g. "udp": used for the RunType (upper cased) and in the output.
+	Name string
+	// Resolve returns the address of the destination.
+	Resolve func(ctx context.Context, dest string) (net.Addr, error)
+	// Dial connects to the resolved address.
+	Dial func(addr net.Addr) (net.Conn, error)
+}
+
+var udpTransport = Transport{
+	Name: "udp",
+	Resolve: func(ctx context.Context, dest string) (net.Addr, error) {
+		addr, err := fnet.UDPResolveDestination(ctx, dest)
+		if addr == nil { // avoid returning a non nil net.Addr wrapping nil
+			return nil, err
+		}
+		return addr, nil
+	},
+	Dial: func(addr net.Addr) (net.Conn, error) {
+		return net.Dial(addr.Network(), addr.String())
+	},
+}
+
+// transport returns the Transport or the default UDP one.
+func (o *UDPOptions) transport() *Transport {
+	if o.Transport == nil {
+		return &udpTransport
+	}
+	return o.Transport
 }
 
 // RunnerOptions includes the base RunnerOptions plus UDP specific
@@ -92,6 +134,9 @@ type UDPClient struct {
 	destination   string
 	doGenerate    bool
 	reqTimeout    time.Duration
+	stunMode      bool
+	stunID        fnet.STUNTransactionID // of the last request, in STUN mode
+	transport     *Transport
 }
 
 var (
@@ -103,24 +148,32 @@ var (
 	errShortRead = errors.New("short read")
 	errLongRead  = errors.New("bug: long read")
 	errMismatch  = errors.New("read not echoing writes")
+	errSTUN      = errors.New("invalid STUN response")
 )
 
 // NewUDPClient creates and initialize and returns a client based on the UDPOptions.
 func NewUDPClient(o *UDPOptions) (*UDPClient, error) {
-	c := UDPClient{}
+	c := UDPClient{transport: o.transport()}
 	d := o.Destination
 	c.destination = d
-	tAddr, err := fnet.UDPResolveDestination(context.Background(), d)
-	if tAddr == nil {
+	addr, err := c.transport.Resolve(context.Background(), d)
+	if err != nil {
 		return nil, err
 	}
-	c.dest = tAddr
+	c.dest = addr
 	c.req = o.Payload
-	if len(c.req) == 0 { // len(nil) array is also valid and 0
+	c.stunMode = o.STUNMode
+	switch {
+	case c.stunMode:
+		c.req = fnet.STUNBindingRequest(c.stunID)
+	case len(c.req) == 0: // len(nil) array is also valid and 0
 		c.doGenerate = true
 		c.req = tcprunner.GeneratePayload(0, 0)
 	}
 	c.buffer = make([]byte, len(c.req))
+	if c.stunMode {
+		c.buffer = make([]byte, stunMaxResponseSize)
+	}
 	c.reqTimeout = o.ReqTimeout
 	if o.ReqTimeout == 0 {
 		log.Debugf("Request timeout not set, using default %v", UDPTimeOutDefaultValue)
@@ -135,7 +188,7 @@ func NewUDPClient(o *UDPOptions) (*UDPClient, error) {
 
 func (c *UDPClient) connect() (net.Conn, error) {
 	c.socketCount++
-	socket, err := net.Dial(c.dest.Network(), c.dest.String())
+	socket, err := c.transport.Dial(c.dest)
 	if err != nil {
 		log.Errf("Unable to connect to %v : %v", c.dest, err)
 		return nil, err
@@ -165,6 +218,11 @@ func (c *UDPClient) Fetch() ([]byte, error) {
 		// TODO write directly in buffer to avoid generating garbage for GC to clean
 		c.req = tcprunner.GeneratePayload(c.connID, c.messageCount)
 	}
+	if c.stunMode {
+		// new random transaction id for each request (in place, c.req is the same size)
+		_, _ = rand.Read(c.stunID[:])
+		copy(c.req[8:fnet.STUNHeaderSize], c.stunID[:])
+	}
 	n, err := conn.Write(c.req)
 	c.bytesSent += int64(n)
 	if log.LogDebug() {
@@ -193,6 +251,9 @@ func (c *UDPClient) Fetch() ([]byte, error) {
 	if os.IsTimeout(err) {
 		return c.buffer[:n], errTimeout
 	}
+	if c.stunMode {
+		return c.checkSTUN(conn, n)
+	}
 	if n < len(c.req) {
 		return c.buffer[:n], errShortRead
 	}
@@ -208,23 +269,36 @@ func (c *UDPClient) Fetch() ([]byte, error) {
 	return c.buffer[:n], nil
 }
 
+// checkSTUN checks the n bytes read are the binding success for the last request.
+func (c *UDPClient) checkSTUN(conn net.Conn, n int) ([]byte, error) {
+	addr, err := fnet.ParseSTUNBindingResponse(c.buffer[:n], c.stunID)
+	if err != nil {
+		log.Infof("Invalid STUN response %q: %v", string(c.buffer[:n]), err)
+		return c.buffer[:n], errSTUN
+	}
+	log.Debugf("STUN reflexive address %v", addr)
+	c.socket = conn // reuse on success
+	return c.buffer[:n], nil
+}
+
 // Close closes the last connection and returns the total number of sockets used for the run.
 func (c *UDPClient) Close() int {
 	log.Debugf("Closing %p: %s socket count %d", c, c.destination, c.socketCount)
 	if c.socket != nil {
 		if err := c.socket.Close(); err != nil {
-			log.Warnf("Error closing udp client's socket: %v", err)
+			log.Warnf("Error closing %s client's socket: %v", c.transport.Name, err)
 		}
 		c.socket = nil
 	}
 	return c.socketCount
 }
 
-// RunUDPTest runs a UDP test and returns the aggregated stats.
+// RunUDPTest runs a UDP (or other Transport) test and returns the aggregated stats.
 // Some refactoring to avoid copy-pasta between the now 3 runners would be good.
 func RunUDPTest(o *RunnerOptions) (*RunnerResults, error) {
-	o.RunType = "UDP"
-	log.Infof("Starting udp test for %s with %d threads at %.1f qps", o.Destination, o.NumThreads, o.QPS)
+	transport := o.transport()
+	o.RunType = strings.ToUpper(transport.Name)
+	log.Infof("Starting %s test for %s with %d threads at %.1f qps", transport.Name, o.Destination, o.NumThreads, o.QPS)
 	r := periodic.NewPeriodicRunner(&o.RunnerOptions)
 	defer r.Options().Abort()
 	numThreads := r.Options().NumThreads
@@ -277,7 +351,7 @@ func RunUDPTest(o *RunnerOptions) (*RunnerResults, error) {
 	_, _ = fmt.Fprintf(out, "Total Bytes sent: %d, received: %d\n", total.BytesSent, total.BytesReceived)
 	sort.Strings(keys)
 	for _, k := range keys {
-		_, _ = fmt.Fprintf(out, "udp %s : %d (%.1f %%)\n", k, total.RetCodes[k], 100.*float64(total.RetCodes[k])/totalCount)
+		_, _ = fmt.Fprintf(out, "%s %s : %d (%.1f %%)\n", transport.Name, k, total.RetCodes[k], 100.*float64(total.RetCodes[k])/totalCount)
 	}
 	return &total, nil
 }
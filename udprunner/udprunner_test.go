@@ -20,6 +20,7 @@ import (
 	"net"
 	"runtime"
 	"testing"
+	"time"
 
 	"fortio.org/fortio/fnet"
 )
@@ -58,6 +59,33 @@ func TestUDPRunner(t *testing.T) {
 	}
 }
 
+func TestUDPRunnerSTUN(t *testing.T) {
+	addr := fnet.STUNEchoServer(":0")
+	destination := fmt.Sprintf("udp://localhost:%d/", addr.(*net.UDPAddr).Port)
+	opts := RunnerOptions{}
+	opts.QPS = 100
+	opts.Exactly = 20
+	opts.Destination = destination
+	opts.STUNMode = true
+	res, err := RunUDPTest(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RetCodes[UDPStatusOK] != 20 {
+		t.Errorf("Expected 20 ok STUN requests, got %v", res.RetCodes)
+	}
+	// The STUN server doesn't echo non STUN payloads:
+	opts.STUNMode = false
+	opts.ReqTimeout = 50 * time.Millisecond
+	res, err = RunUDPTest(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RetCodes[UDPStatusOK] != 0 || res.RetCodes[errTimeout.Error()] != 20 {
+		t.Errorf("Expected only timeouts for non STUN requests, got %v", res.RetCodes)
+	}
+}
+
 func TestUDPNotLeaking(t *testing.T) {
 	opts := &RunnerOptions{}
 	ngBefore1 := runtime.NumGoroutine()
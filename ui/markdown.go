@@ -0,0 +1,106 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ui // import "fortio.org/fortio/ui"
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Inline markdown: `code`, **bold** and [text](url) links, applied on html escaped text.
+var (
+	mdCode = regexp.MustCompile("`([^`]+)`")
+	mdBold = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	mdLink = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+)
+
+// markdownToHTML converts the small subset of Markdown used by the embedded help page to HTML:
+// # headings, - lists, ``` code blocks, paragraphs and the inline code, bold and links.
+func markdownToHTML(md string) string {
+	var b strings.Builder
+	inList, inCode, inPara := false, false, false
+	closeBlocks := func() {
+		if inList {
+			b.WriteString("</ul>\n")
+			inList = false
+		}
+		if inPara {
+			b.WriteString("</p>\n")
+			inPara = false
+		}
+	}
+	for _, line := range strings.Split(md, "\n") {
+		if strings.HasPrefix(line, "```") {
+			if inCode {
+				b.WriteString("</pre>\n")
+			} else {
+				closeBlocks()
+				b.WriteString("<pre>")
+			}
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			b.WriteString(html.EscapeString(line))
+			b.WriteString("\n")
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			closeBlocks()
+		case strings.HasPrefix(trimmed, "#"):
+			closeBlocks()
+			level := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+			level = min(level, 6)
+			tag := "h" + string(rune('0'+level))
+			b.WriteString("<" + tag + ">" + markdownInline(strings.TrimSpace(trimmed[level:])) + "</" + tag + ">\n")
+		case strings.HasPrefix(trimmed, "- "):
+			if inPara {
+				closeBlocks()
+			}
+			if !inList {
+				b.WriteString("<ul>\n")
+				inList = true
+			}
+			b.WriteString("<li>" + markdownInline(trimmed[2:]) + "</li>\n")
+		default:
+			if inList {
+				closeBlocks()
+			}
+			if !inPara {
+				b.WriteString("<p>")
+				inPara = true
+			} else {
+				b.WriteString("\n")
+			}
+			b.WriteString(markdownInline(trimmed))
+		}
+	}
+	if inCode {
+		b.WriteString("</pre>\n")
+	}
+	closeBlocks()
+	return b.String()
+}
+
+// markdownInline escapes text and converts its inline markdown.
+func markdownInline(text string) string {
+	s := html.EscapeString(text)
+	s = mdCode.ReplaceAllString(s, "<code>$1</code>")
+	s = mdBold.ReplaceAllString(s, "<b>$1</b>")
+	return mdLink.ReplaceAllString(s, `<a href="$2">$1</a>`)
+}
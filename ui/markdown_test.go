@@ -0,0 +1,44 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ui // import "fortio.org/fortio/ui"
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMarkdownToHTML(t *testing.T) {
+	md := "# Title\n\nSome **bold** and `a<b`\ntext with a [link](https://fortio.org/).\n\n" +
+		"- item 1\n- item **2**\n\n```\nx := a && b\n```\n## Sub"
+	expected := "<h1>Title</h1>\n<p>Some <b>bold</b> and <code>a&lt;b</code>\n" +
+		"text with a <a href=\"https://fortio.org/\">link</a>.</p>\n" +
+		"<ul>\n<li>item 1</li>\n<li>item <b>2</b></li>\n</ul>\n" +
+		"<pre>x := a &amp;&amp; b\n</pre>\n<h2>Sub</h2>\n"
+	if got := markdownToHTML(md); got != expected {
+		t.Errorf("Unexpected html:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+func TestHelpMarkdown(t *testing.T) {
+	md, err := templateFS.ReadFile("templates/help.md")
+	if err != nil {
+		t.Fatalf("Unable to read embedded help: %v", err)
+	}
+	h := markdownToHTML(string(md))
+	if !strings.HasPrefix(h, "<h1>Fortio UI help</h1>") || strings.Count(h, "<ul>") != strings.Count(h, "</ul>") ||
+		strings.Count(h, "<pre>") != strings.Count(h, "</pre>") {
+		t.Errorf("Unexpected help html: %s", h)
+	}
+}
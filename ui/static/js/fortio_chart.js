@@ -69,6 +69,18 @@ const logYAxe = {
 let chart = {}
 let overlayChart = {}
 let mchart = {}
+let errChart = {}
+let stChart = {}
+
+const errorTypeColors = [
+  'rgba(179, 42, 18, .75)',
+  'rgba(204, 102, 0, .75)',
+  'rgba(134, 87, 167, .75)',
+  'rgba(36, 64, 238, .75)',
+  'rgba(87, 167, 134, .75)',
+  'rgba(220, 180, 30, .75)',
+  'rgba(120, 120, 120, .75)'
+]
 
 function myRound (v, digits = 6) {
   const p = Math.pow(10, digits)
@@ -243,12 +255,16 @@ function fortioResultToJsChartData (res) {
     title: makeTitle(res),
     dataP,
     dataH,
-    dataE
+    dataE,
+    errorTypes: res.ErrorTypes,
+    serverTimings: res.ServerTimings
   }
 }
 
 function showChart (data) {
   makeChart(data)
+  makeErrorTypesChart(data.errorTypes)
+  makeServerTimingsChart(data.serverTimings)
   // Load configuration (min, max, isLogarithmic, ...) from the update form.
   updateChartOptions(chart)
   toggleVisibility()
@@ -277,6 +293,8 @@ function makeOverlayChart (dataA, dataB) {
   }
   deleteSingleChart()
   deleteMultiChart()
+  deleteErrorTypesChart()
+  deleteServerTimingsChart()
   const ctx = chartEl.getContext('2d')
   const title = makeOverlayChartTitle(dataA.title, dataB.title)
   overlayChart = new Chart(ctx, {
@@ -599,6 +617,109 @@ function deleteMultiChart () {
   mchart = {}
 }
 
+// Pie chart of the ErrorTypes (count of failed calls by type) of a single result, hidden when there are none.
+function makeErrorTypesChart (errorTypes) {
+  deleteErrorTypesChart()
+  const container = document.getElementById('cc2')
+  if (!container || !errorTypes || !objHasProps(errorTypes)) {
+    return
+  }
+  container.style.display = 'block'
+  const labels = Object.keys(errorTypes).sort((a, b) => errorTypes[b] - errorTypes[a])
+  const ctx = document.getElementById('chart2').getContext('2d')
+  errChart = new Chart(ctx, {
+    type: 'pie',
+    data: {
+      labels,
+      datasets: [{
+        data: labels.map(l => errorTypes[l]),
+        backgroundColor: labels.map((l, i) => errorTypeColors[i % errorTypeColors.length])
+      }]
+    },
+    options: {
+      responsive: true,
+      maintainAspectRatio: false,
+      title: {
+        display: true,
+        fontStyle: 'normal',
+        text: 'Error types'
+      }
+    }
+  })
+}
+
+function deleteErrorTypesChart () {
+  const container = document.getElementById('cc2')
+  if (container) {
+    container.style.display = 'none'
+  }
+  if (Object.keys(errChart).length === 0) {
+    return
+  }
+  errChart.destroy()
+  errChart = {}
+}
+
+// Histograms of the Server-Timing metrics durations of a single result, hidden when there are none.
+function makeServerTimingsChart (serverTimings) {
+  deleteServerTimingsChart()
+  const container = document.getElementById('cc3')
+  if (!container || !serverTimings || !objHasProps(serverTimings)) {
+    return
+  }
+  container.style.display = 'block'
+  const datasets = Object.keys(serverTimings).sort().map((name, i) => {
+    const h = serverTimings[name]
+    const data = []
+    if (h.Data) {
+      h.Data.forEach(it => {
+        data.push({ x: myRound(1000.0 * it.Start), y: it.Count }, { x: myRound(1000.0 * it.End), y: it.Count })
+      })
+    }
+    const color = errorTypeColors[(i + 3) % errorTypeColors.length]
+    return {
+      label: name + ' (avg ' + myRound(1000.0 * h.Avg, 3) + ' ms)',
+      data,
+      pointStyle: 'rect',
+      radius: 1,
+      fill: false,
+      borderColor: color,
+      backgroundColor: color,
+      lineTension: 0
+    }
+  })
+  const ctx = document.getElementById('chart3').getContext('2d')
+  stChart = new Chart(ctx, {
+    type: 'line',
+    data: { datasets },
+    options: {
+      responsive: true,
+      maintainAspectRatio: false,
+      title: {
+        display: true,
+        fontStyle: 'normal',
+        text: 'Server-Timing histograms'
+      },
+      scales: {
+        xAxes: [linearXAxe],
+        yAxes: [linearYAxe]
+      }
+    }
+  })
+}
+
+function deleteServerTimingsChart () {
+  const container = document.getElementById('cc3')
+  if (container) {
+    container.style.display = 'none'
+  }
+  if (Object.keys(stChart).length === 0) {
+    return
+  }
+  stChart.destroy()
+  stChart = {}
+}
+
 function deleteSingleChart () {
   if (Object.keys(chart).length === 0) {
     return
@@ -617,6 +738,8 @@ function makeMultiChart () {
   }
   deleteSingleChart()
   deleteOverlayChart()
+  deleteErrorTypesChart()
+  deleteServerTimingsChart()
   const ctx = chartEl.getContext('2d')
   mchart = new Chart(ctx, {
     type: 'line',
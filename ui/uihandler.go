@@ -24,6 +24,7 @@ import (
 	"html"
 	"html/template"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -71,11 +72,14 @@ var (
 	mainTemplate     *template.Template
 	browseTemplate   *template.Template
 	syncTemplate     *template.Template
+	helpTemplate     *template.Template
+	helpHTML         template.HTML // help.md rendered once at startup
 )
 
 const (
 	fetchURI    = "fetch/"
 	fetch2URI   = "fetch2/"
+	replayURI   = "replay/"
 	faviconPath = "/favicon.ico"
 )
 
@@ -125,6 +129,14 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		log.Critf("Stop request from %v for %d", r.RemoteAddr, runid)
 		mode = stop
 	}
+	// Same bearer token requirement and runs ownership as the REST API (see rapi.APITokens).
+	user, authorized := rapi.RequestUser(r)
+	if mode != menu && !authorized {
+		log.S(log.Warning, "Unauthorized UI run/stop", log.Str("remote", r.RemoteAddr))
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
 	// Those only exist/make sense on run mode but go variable declaration...
 	labels := r.FormValue("labels")
 	resolution, _ := strconv.ParseFloat(r.FormValue("r"), 64)
@@ -181,6 +193,9 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		runid = rapi.NextRunID()
 		log.Infof("New run id %d", runid)
 		ro.RunID = runid
+		if user != "" {
+			rapi.SetRunUser(runid, user)
+		}
 	}
 	httpopts.DisableFastClient = stdClient
 	httpopts.SequentialWarmup = sequentialWarmup
@@ -239,7 +254,9 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 	case menu:
 		// nothing more to do
 	case stop:
-		rapi.StopByRunID(runid, false)
+		if _, _, allowed := rapi.StopByRunIDForUser(runid, false, user); !allowed {
+			log.S(log.Warning, "Run stop denied", log.Attr("runid", runid), log.Str("user", user))
+		}
 	case run:
 		// mode == run case:
 		fhttp.OnBehalfOf(httpopts, r)
@@ -287,6 +304,8 @@ func ResultToJsData(w io.Writer, json []byte) {
 type SelectableValue struct {
 	Value    string
 	Selected bool
+	// Optional source region of the result, displayed alongside its ID.
+	Region string
 }
 
 // SelectValues maps the list of values (from DataList) to a list of SelectableValues.
@@ -343,13 +362,15 @@ func BrowseHandler(w http.ResponseWriter, r *http.Request) {
 	yMin := r.FormValue("yMin")
 	yMax := r.FormValue("yMax")
 	yLog, _ := strconv.ParseBool(r.FormValue("yLog"))
-	dataList := rapi.DataList()
+	// The results table is loaded (from rest/data/list), sorted and filtered client side.
 	selectedValues := r.URL.Query()["sel"]
-	preselectedDataList, numSelected := SelectValues(dataList, selectedValues)
+	if selectedValues == nil {
+		selectedValues = []string{}
+	}
 
 	doRender := url != ""
 	doSearch := search != ""
-	doLoadSelected := doSearch || numSelected > 0
+	doLoadSelected := doSearch || len(selectedValues) > 0
 	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
 
 	chartOptions := ChartOptions{
@@ -361,22 +382,22 @@ func BrowseHandler(w http.ResponseWriter, r *http.Request) {
 		YIsLog: yLog,
 	}
 	err := browseTemplate.Execute(w, &struct {
-		R                   *http.Request
-		Extra               string
-		Version             string
-		LogoPath            string
-		ChartJSPath         string
-		URL                 string
-		Search              string
-		ChartOptions        ChartOptions
-		PreselectedDataList []SelectableValue
-		URLHostPort         string
-		DoRender            bool
-		DoSearch            bool
-		DoLoadSelected      bool
+		R              *http.Request
+		Extra          string
+		Version        string
+		LogoPath       string
+		ChartJSPath    string
+		URL            string
+		Search         string
+		ChartOptions   ChartOptions
+		Selected       []string
+		URLHostPort    string
+		DoRender       bool
+		DoSearch       bool
+		DoLoadSelected bool
 	}{
 		r, extraBrowseLabel, version.Short(), logoPath, chartJSPath,
-		url, search, chartOptions, preselectedDataList, urlHostPort,
+		url, search, chartOptions, selectedValues, urlHostPort,
 		doRender, doSearch, doLoadSelected,
 	})
 	if err != nil {
@@ -435,6 +456,18 @@ func Sync(out io.Writer, u string, datadir string) bool {
 	return (code == http.StatusOK)
 }
 
+// HelpHandler renders the embedded help page (documentation of the UI options and results).
+func HelpHandler(w http.ResponseWriter, _ *http.Request) {
+	err := helpTemplate.Execute(w, &struct {
+		Version  string
+		LogoPath string
+		Content  template.HTML
+	}{version.Short(), logoPath, helpHTML})
+	if err != nil {
+		log.Critf("Help template execution failed: %v", err)
+	}
+}
+
 // SyncHandler handles syncing/downloading from TSC URL.
 func SyncHandler(w http.ResponseWriter, r *http.Request) {
 	// logging of request and response is done by log.LogAndCall in mux setup
@@ -648,6 +681,20 @@ type ServerConfig struct {
 	PProfOn                                   bool
 	PercentileList                            []float64
 	TLSOptions                                *fhttp.TLSOptions
+	// Directory whose files (e.g. static/img/logo.svg) override the embedded ones, empty for none.
+	StaticOverlayDir string
+	// Optional bearer tokens to user names map required for the REST run, replay and stop calls (see rapi.APITokens).
+	APITokens map[string]string
+	// Optional Access-Control-Allow-Origin of the REST API (see rapi.CORSOrigin).
+	CORSOrigin string
+	// Maximum number of runs at the same time, 0 for unlimited (see rapi.MaxConcurrentRuns).
+	MaxConcurrentRuns int
+	// Whether queued runs' priority increases while they wait (see rapi.FairSchedule).
+	FairSchedule bool
+	// Optional URL notified of all the runs state changes and key to sign them (see rapi.SetLifecycleWebhook).
+	LifecycleWebhook, WebhookSecret string
+	// Set by Serve to the address the echo (and UI) server listens on.
+	Addr net.Addr
 }
 
 // Serve starts the fhttp.Serve() plus the UI server on the given port
@@ -659,6 +706,7 @@ func Serve(hook bincommon.FortioHook, cfg *ServerConfig) bool {
 	if addr == nil {
 		return false // Error already logged
 	}
+	cfg.Addr = addr
 	if cfg.UIPath == "" {
 		return true
 	}
@@ -681,9 +729,19 @@ func Serve(hook bincommon.FortioHook, cfg *ServerConfig) bool {
 	mux.Handle(fetchPath, http.StripPrefix(fetchPath, http.HandlerFunc(fhttp.FetcherHandler)))
 	// h2 incoming and https outgoing ok fetcher
 	mux.HandleFunc(uiPath+fetch2URI, fhttp.FetcherHandler2)
+	// sequential scenario of requests (JSON array of fhttp.ReplayStep POSTed)
+	mux.HandleFunc(uiPath+replayURI, fhttp.ReplayHandler)
 	fhttp.CheckConnectionClosedHeader = true // needed for proxy to avoid errors
 
 	// New REST apis (includes the data/ handler)
+	rapi.APITokens = cfg.APITokens
+	rapi.CORSOrigin = cfg.CORSOrigin
+	rapi.MaxConcurrentRuns = cfg.MaxConcurrentRuns
+	rapi.FairSchedule = cfg.FairSchedule
+	if err := rapi.SetLifecycleWebhook(cfg.LifecycleWebhook, cfg.WebhookSecret); err != nil {
+		log.Errf("Invalid lifecycle webhook: %v", err)
+		return false
+	}
 	rapi.AddHandlers(hook, mux, cfg.BaseURL, uiPath, cfg.DataDir)
 	rapi.DefaultPercentileList = cfg.PercentileList
 
@@ -695,7 +753,13 @@ func Serve(hook bincommon.FortioHook, cfg *ServerConfig) bool {
 	// link time value or the directory relative to this file to find the static
 	// contents, so no matter where or how the go binary is generated, the static
 	// dir should be found.
-	fs := http.FileServer(http.FS(staticFS))
+	// The optional StaticOverlayDir files take precedence over the embedded ones.
+	static := http.FS(staticFS)
+	if cfg.StaticOverlayDir != "" {
+		log.Infof("Static files overlay from %s", cfg.StaticOverlayDir)
+		static = http.FS(fhttp.LayeredFS(os.DirFS(cfg.StaticOverlayDir), staticFS))
+	}
+	fs := http.FileServer(static)
 	prefix := uiPath + version.Short()
 	mux.Handle(prefix+"/static/", LogAndAddCacheControl(http.StripPrefix(prefix, fs)))
 	mux.Handle(faviconPath, LogAndAddCacheControl(fs))
@@ -716,6 +780,15 @@ func Serve(hook bincommon.FortioHook, cfg *ServerConfig) bool {
 	} else {
 		mux.HandleFunc(uiPath+"sync", log.LogAndCall("Sync", SyncHandler))
 	}
+	helpTemplate, err = template.ParseFS(templateFS, "templates/help.html", "templates/header.html")
+	if err != nil {
+		log.Critf("Unable to parse help template: %v", err)
+	} else if md, mdErr := templateFS.ReadFile("templates/help.md"); mdErr != nil {
+		log.Critf("Unable to read help markdown: %v", mdErr)
+	} else {
+		helpHTML = template.HTML(markdownToHTML(string(md))) //nolint:gosec // from our own embedded and escaped markdown.
+		mux.HandleFunc(uiPath+"help", log.LogAndCall("help", HelpHandler))
+	}
 	dflagsPath := uiPath + "flags"
 	dflagSetURL := dflagsPath + "/set"
 	dflagEndPt := endpoint.NewFlagsEndpoint(flag.CommandLine, dflagSetURL)
@@ -0,0 +1,70 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ui // import "fortio.org/fortio/ui"
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"fortio.org/fortio/fhttp"
+	"fortio.org/fortio/rapi"
+)
+
+func TestHandlerRequiresToken(t *testing.T) {
+	rapi.APITokens = map[string]string{"tok1": "alice"}
+	defer func() { rapi.APITokens = nil }()
+	for _, query := range []string{"stop=Stop&runid=1", "load=Start&url=localhost:8080&n=1"} {
+		w := httptest.NewRecorder()
+		Handler(w, httptest.NewRequest(http.MethodGet, "/fortio/?"+query, nil))
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Token-less UI %s: got %d instead of 401", query, w.Code)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/fortio/?"+query, nil)
+		req.Header.Set("Authorization", "Bearer wrong")
+		w = httptest.NewRecorder()
+		Handler(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Invalid token UI %s: got %d instead of 401", query, w.Code)
+		}
+	}
+	// The menu (no run/stop) doesn't require a token (no template in this test: 500).
+	w := httptest.NewRecorder()
+	Handler(w, httptest.NewRequest(http.MethodGet, "/fortio/", nil))
+	if w.Code == http.StatusUnauthorized {
+		t.Errorf("Menu shouldn't require a token")
+	}
+}
+
+func TestHandlerServerTiming(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Server-Timing", "db;dur=20")
+	}))
+	defer srv.Close()
+	w := httptest.NewRecorder()
+	Handler(w, httptest.NewRequest(http.MethodGet,
+		"/fortio/?load=Start&json=on&runner=http&qps=-1&n=3&c=1&server-timing=on&url="+srv.URL, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("UI run failed: %d %s", w.Code, w.Body.String())
+	}
+	var res fhttp.HTTPRunnerResults
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("Unable to unmarshal %q: %v", w.Body.String(), err)
+	}
+	if db := res.ServerTimings["db"]; db == nil || db.Count != 3 {
+		t.Errorf("Expected the server timing checkbox to record 3 db timings, got %+v", res.ServerTimings)
+	}
+}
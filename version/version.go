@@ -16,6 +16,9 @@
 // The reusable library part and examples moved to [fortio.org/version].
 package version // import "fortio.org/fortio/version"
 import (
+	"runtime/debug"
+	"sort"
+
 	"fortio.org/version"
 )
 
@@ -47,6 +50,34 @@ func Full() string {
 	return fullVersion
 }
 
+// BuildDeps returns the sorted module@version list of the main module and all the (transitive)
+// dependencies the binary was built with, from the runtime BuildInfo, e.g. for security audits
+// of a deployed binary. Replaced modules are shown as module@version => replacement@version.
+// Returns nil if the build info isn't available.
+func BuildDeps() []string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return nil
+	}
+	deps := make([]string, 0, len(bi.Deps)+1)
+	if bi.Main.Path != "" {
+		deps = append(deps, moduleVersion(&bi.Main))
+	}
+	for _, d := range bi.Deps {
+		deps = append(deps, moduleVersion(d))
+	}
+	sort.Strings(deps)
+	return deps
+}
+
+func moduleVersion(m *debug.Module) string {
+	res := m.Path + "@" + m.Version
+	if m.Replace != nil {
+		res += " => " + m.Replace.Path + "@" + m.Replace.Version
+	}
+	return res
+}
+
 // This "burns in" the fortio version. we need to get the "right" versions though.
 // depending if we are a module or main.
 func init() { //nolint:gochecknoinits // we do need an init for this
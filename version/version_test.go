@@ -0,0 +1,40 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package version
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestBuildDeps(t *testing.T) {
+	deps := BuildDeps()
+	if !sort.StringsAreSorted(deps) {
+		t.Errorf("BuildDeps() not sorted: %v", deps)
+	}
+	found := false
+	for _, d := range deps {
+		if strings.HasPrefix(d, "fortio.org/fortio@") {
+			found = true
+		}
+		if !strings.Contains(d, "@") {
+			t.Errorf("Expected module@version, got %q", d)
+		}
+	}
+	if !found {
+		t.Errorf("fortio.org/fortio module not found in %v", deps)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2026 Fortio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build js && wasm
+
+// Browser (WebAssembly) build of the fortio HTTP load generator, see index.html
+// and the wasm target in the Makefile.
+package main
+
+// Do not add any external dependencies we want to keep fortio minimal.
+
+import (
+	"encoding/json"
+	"syscall/js"
+
+	"fortio.org/fortio/fhttp"
+)
+
+func main() {
+	js.Global().Set("fortioRunHTTPTest", js.FuncOf(runHTTPTest))
+	select {} // keep running so the function stays callable.
+}
+
+// runHTTPTest is fortioRunHTTPTest(url, optionsJSON) for javascript: optionsJSON is the optional
+// JSON of the fhttp.HTTPRunnerOptions (e.g. {"QPS": 10, "NumThreads": 2, "Exactly": 100}).
+// Returns a Promise of the JSON of the periodic.RunnerResults, as the run must not block
+// the browser's event loop (which fetch() needs).
+func runHTTPTest(_ js.Value, args []js.Value) any {
+	var url, options string
+	if len(args) > 0 {
+		url = args[0].String()
+	}
+	if len(args) > 1 && args[1].Type() == js.TypeString {
+		options = args[1].String()
+	}
+	executor := js.FuncOf(func(_ js.Value, pArgs []js.Value) any {
+		resolve, reject := pArgs[0], pArgs[1]
+		go func() {
+			opts := fhttp.HTTPRunnerOptions{}
+			if options != "" {
+				if err := json.Unmarshal([]byte(options), &opts); err != nil {
+					reject.Invoke("invalid options: " + err.Error())
+					return
+				}
+			}
+			res, err := json.Marshal(fhttp.RunHTTPTestWASM(url, opts))
+			if err != nil {
+				reject.Invoke(err.Error())
+				return
+			}
+			resolve.Invoke(string(res))
+		}()
+		return nil
+	})
+	defer executor.Release() // the Promise constructor calls it synchronously.
+	return js.Global().Get("Promise").New(executor)
+}